@@ -0,0 +1,498 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// acceptKind 验收报告的 kind 字段，dping verify 据此区分验收报告和快照
+const acceptKind = "acceptance"
+
+// AcceptFile 验收标准文件（YAML）：探测计划、轮数和合同约定的指标
+type AcceptFile struct {
+	Name     string             `yaml:"name"`     // 验收名称，如 北京电信 100M 专线
+	Circuit  string             `yaml:"circuit"`  // 线路编号或合同号
+	Plan     *BatchJob          `yaml:"plan"`     // 探测参数，字段与批量任务相同
+	Rounds   int                `yaml:"rounds"`   // 探测轮数，为 0 时为 1
+	Interval time.Duration      `yaml:"interval"` // 相邻两轮开始的间隔，为 0 时紧接着开始
+	Criteria []*AcceptCriterion `yaml:"criteria"`
+}
+
+// AcceptCriterion 一条验收指标：isp、dt 限定适用的目标（为空时为全部目标），其余字段为上限，未填写的不检查；
+// 各轮的结果合并后计算，全部丢包或探测出错的目标按全部丢包计
+type AcceptCriterion struct {
+	Name       string        `yaml:"name"`
+	Isp        string        `yaml:"isp"`
+	Region     string        `yaml:"dt"`
+	Loss       *float64      `yaml:"loss"`        // 合计丢包率（%）
+	AvgRtt     time.Duration `yaml:"avg_rtt"`     // 按收包数加权的平均 RTT
+	P95Rtt     time.Duration `yaml:"p95_rtt"`     // 各目标平均 RTT 的 p95（按目标权重）
+	TargetLoss *float64      `yaml:"target_loss"` // 单个目标的丢包率（%）
+}
+
+// AcceptCheck 一条指标的一项检查结果，时间以毫秒表示
+type AcceptCheck struct {
+	Criterion string  `json:"criterion"`
+	Metric    string  `json:"metric"` // loss|avg_rtt|p95_rtt|target_loss
+	Limit     float64 `json:"limit"`
+	Actual    float64 `json:"actual"`
+	Unit      string  `json:"unit"`    // % 或 ms
+	Targets   int     `json:"targets"` // 适用的目标数
+	Passed    bool    `json:"passed"`
+	Detail    string  `json:"detail,omitempty"` // 未通过的原因，如丢包最多的目标
+}
+
+// AcceptReport 验收报告：结论、各项检查、验收标准原文和各轮的完整结果，指定签名私钥时对其余全部字段签名
+type AcceptReport struct {
+	Kind          string             `json:"kind"` // 固定为 acceptance
+	SchemaVersion int                `json:"schema_version"`
+	CreatedAt     time.Time          `json:"created_at"`
+	Name          string             `json:"name"`
+	Circuit       string             `json:"circuit,omitempty"`
+	Host          string             `json:"host"`
+	Passed        bool               `json:"passed"`
+	Checks        []*AcceptCheck     `json:"checks"`
+	Criteria      string             `json:"criteria"`        // 验收标准文件的原文
+	CriteriaHash  string             `json:"criteria_sha256"` // 验收标准原文的 SHA-256，便于与合同附件核对
+	Rounds        []*Snapshot        `json:"rounds"`          // 各轮的完整结果
+	Signature     *SnapshotSignature `json:"signature,omitempty"`
+}
+
+// AcceptOptions 验收参数
+type AcceptOptions struct {
+	Criteria string             // 验收标准文件
+	SignKey  ed25519.PrivateKey // 为 nil 时报告不签名
+	Out      string             // JSON 报告路径
+	HTML     string             // 单页 HTML 证书路径，为空时不生成
+}
+
+// LoadAcceptFile 读取验收标准文件，补全探测参数的默认值并校验；未知字段视为错误，避免拼错的指标被静默忽略
+func LoadAcceptFile(path string) (*AcceptFile, []byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取验收标准 %s 失败: %v", path, err)
+	}
+	file := &AcceptFile{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(file); err != nil && err != io.EOF {
+		return nil, nil, fmt.Errorf("解析验收标准 %s 失败: %v", path, err)
+	}
+	if err := file.validate(); err != nil {
+		return nil, nil, fmt.Errorf("验收标准 %s：%v", path, err)
+	}
+	return file, data, nil
+}
+
+// validate 补全默认值并校验探测计划和各项指标
+func (f *AcceptFile) validate() error {
+	if f.Name == "" {
+		return fmt.Errorf("没有验收名称（name）")
+	}
+	if f.Rounds < 0 || f.Interval < 0 {
+		return fmt.Errorf("rounds 和 interval 不能为负数")
+	}
+	f.Rounds = max(f.Rounds, 1)
+	if f.Plan == nil {
+		f.Plan = &BatchJob{}
+	}
+	portSet := f.Plan.Port != 0
+	f.Plan.setDefaults(0)
+	f.Plan.Name = f.Name
+	if portSet && DefaultPort(f.Plan.Proto) == 0 {
+		return fmt.Errorf("port 只在 proto 为 dns、tcp、http 或 https 时生效")
+	}
+	if strings.Contains(f.Plan.Proto, ",") {
+		return fmt.Errorf("验收只支持一种探测方式，当前为 %s", f.Plan.Proto)
+	}
+	if err := ValidateParams(f.Plan.Isp, f.Plan.Region, f.Plan.Concurrency, f.Plan.Count, *f.Plan.Jitter, f.Plan.adaptive(), f.Plan.probe(), f.Plan.targets(), "loss"); err != nil {
+		return fmt.Errorf("plan：%v", err)
+	}
+	if len(f.Criteria) == 0 {
+		return fmt.Errorf("没有验收指标（criteria）")
+	}
+	for i, c := range f.Criteria {
+		if c == nil {
+			return fmt.Errorf("第 %d 条指标为空", i+1)
+		}
+		if c.Name == "" {
+			c.Name = strings.Join(slices.DeleteFunc([]string{c.Isp, c.Region}, func(s string) bool { return s == "" }), " ")
+			if c.Name == "" {
+				c.Name = "全部目标"
+			}
+		}
+		if c.Loss == nil && c.AvgRtt == 0 && c.P95Rtt == 0 && c.TargetLoss == nil {
+			return fmt.Errorf("指标 %s 没有任何上限（loss、avg_rtt、p95_rtt、target_loss）", c.Name)
+		}
+		for _, loss := range []*float64{c.Loss, c.TargetLoss} {
+			if loss != nil && (*loss < 0 || *loss > 100) {
+				return fmt.Errorf("指标 %s 的丢包率必须在 0 到 100 之间，当前为 %g", c.Name, *loss)
+			}
+		}
+		if c.AvgRtt < 0 || c.P95Rtt < 0 {
+			return fmt.Errorf("指标 %s 的 RTT 不能为负数", c.Name)
+		}
+	}
+	return nil
+}
+
+// Accept 按验收标准执行探测计划，评估各项指标，在标准输出显示结论并写入 JSON 报告和 HTML 证书；未通过时返回错误
+func Accept(opts AcceptOptions) (*AcceptReport, error) {
+	file, raw, err := LoadAcceptFile(opts.Criteria)
+	if err != nil {
+		return nil, err
+	}
+	run := file.Plan.options("loss", false)
+	// 结果由验收报告代替，不输出表格，也不与上次运行对比
+	run.Output = OutputOptions{Quiet: true}
+	var rounds []*Snapshot
+	for i := range file.Rounds {
+		start := time.Now()
+		fmt.Fprintf(os.Stderr, "✅ 验收 %s：第 %d/%d 轮\n", file.Name, i+1, file.Rounds)
+		result, err := DPing(run)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 轮探测失败: %v", i+1, err)
+		}
+		rounds = append(rounds, result.Snapshot)
+		if i < file.Rounds-1 {
+			time.Sleep(time.Until(start.Add(file.Interval)))
+		}
+	}
+	report := NewAcceptReport(file, raw, rounds)
+	if opts.SignKey != nil {
+		if err := report.sign(opts.SignKey); err != nil {
+			return nil, err
+		}
+	}
+	printAcceptReport(os.Stdout, report)
+	if err := report.save(opts.Out); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "✅ 验收报告（含各轮结果）已写入 %s\n", opts.Out)
+	if opts.HTML != "" {
+		if err := report.saveHTML(opts.HTML, opts.Out); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "✅ 验收证书已写入 %s\n", opts.HTML)
+	}
+	if !report.Passed {
+		return report, fmt.Errorf("验收未通过")
+	}
+	return report, nil
+}
+
+// acceptTarget 一个目标各轮合并的结果
+type acceptTarget struct {
+	ip, isp, region string
+	weight          float64
+	sent, recv      int
+	rttSum          float64
+}
+
+// NewAcceptReport 合并各轮的结果并逐项检查验收指标
+func NewAcceptReport(file *AcceptFile, raw []byte, rounds []*Snapshot) *AcceptReport {
+	sum := sha256.Sum256(raw)
+	report := &AcceptReport{Kind: acceptKind, SchemaVersion: SchemaVersion, CreatedAt: time.Now(), Name: file.Name, Circuit: file.Circuit,
+		Passed: true, Criteria: string(raw), CriteriaHash: hex.EncodeToString(sum[:]), Rounds: rounds}
+	var order []string
+	targets := make(map[string]*acceptTarget)
+	for _, snap := range rounds {
+		report.Host = snap.Host
+		for _, row := range slices.Concat(snap.Rows, snap.Unanswered) {
+			key := strings.Join([]string{row.DestIP, row.Isp, row.Region}, "|")
+			t := targets[key]
+			if t == nil {
+				t = &acceptTarget{ip: row.DestIP, isp: row.Isp, region: row.Region, weight: targetWeight(row.Weight)}
+				targets[key] = t
+				order = append(order, key)
+			}
+			// 出错的目标没有收发包，按发出 -p 个包全部丢失计
+			sent := row.Sent
+			if sent == 0 {
+				sent = snap.Count
+			}
+			t.sent += sent
+			t.recv += row.Recv
+			t.rttSum += row.AvgRttMs * float64(row.Recv)
+		}
+	}
+	for _, c := range file.Criteria {
+		var matched []*acceptTarget
+		for _, key := range order {
+			if t := targets[key]; (c.Isp == "" || t.isp == c.Isp) && (c.Region == "" || t.region == c.Region) {
+				matched = append(matched, t)
+			}
+		}
+		for _, check := range c.evaluate(matched) {
+			report.Checks = append(report.Checks, check)
+			report.Passed = report.Passed && check.Passed
+		}
+	}
+	return report
+}
+
+// evaluate 检查一条指标的各项上限；没有适用的目标时各项都不通过
+func (c *AcceptCriterion) evaluate(targets []*acceptTarget) []*AcceptCheck {
+	var sent, recv int
+	var rttSum float64
+	var rtts []weightedRtt
+	var worst *acceptTarget
+	for _, t := range targets {
+		sent += t.sent
+		recv += t.recv
+		rttSum += t.rttSum
+		if t.recv > 0 {
+			rtts = append(rtts, weightedRtt{ms: t.rttSum / float64(t.recv), weight: t.weight})
+		}
+		if worst == nil || t.loss() > worst.loss() {
+			worst = t
+		}
+	}
+	var checks []*AcceptCheck
+	add := func(metric string, limit, actual float64, unit string, detail string) {
+		check := &AcceptCheck{Criterion: c.Name, Metric: metric, Limit: limit, Actual: actual, Unit: unit, Targets: len(targets)}
+		switch {
+		case len(targets) == 0:
+			check.Detail = "没有适用的目标"
+		case metric != "loss" && metric != "target_loss" && recv == 0:
+			check.Detail = "没有收到回包"
+		default:
+			check.Passed = actual <= limit
+			if !check.Passed {
+				check.Detail = detail
+			}
+		}
+		checks = append(checks, check)
+	}
+	if c.Loss != nil {
+		loss := 100.0
+		if sent > 0 {
+			loss = float64(sent-recv) / float64(sent) * 100
+		}
+		add("loss", *c.Loss, loss, "%", fmt.Sprintf("发 %d 收 %d", sent, recv))
+	}
+	if c.AvgRtt > 0 {
+		avg := 0.0
+		if recv > 0 {
+			avg = rttSum / float64(recv)
+		}
+		add("avg_rtt", durationToMs(c.AvgRtt), avg, "ms", "")
+	}
+	if c.P95Rtt > 0 {
+		p95 := 0.0
+		if len(rtts) > 0 {
+			p95 = rttPercentile(rtts, sloPercentile)
+		}
+		add("p95_rtt", durationToMs(c.P95Rtt), p95, "ms", fmt.Sprintf("%d 个有回包的目标", len(rtts)))
+	}
+	if c.TargetLoss != nil {
+		var loss float64
+		var detail string
+		if worst != nil {
+			loss = worst.loss()
+			detail = fmt.Sprintf("丢包最多的目标 %s（%s %s）", worst.ip, worst.isp, worst.region)
+		}
+		add("target_loss", *c.TargetLoss, loss, "%", detail)
+	}
+	return checks
+}
+
+func (t *acceptTarget) loss() float64 {
+	if t.sent == 0 {
+		return 100
+	}
+	return float64(t.sent-t.recv) / float64(t.sent) * 100
+}
+
+// acceptMetricNames 检查项的中文名称
+var acceptMetricNames = map[string]string{
+	"loss":        "丢包率",
+	"avg_rtt":     "平均 RTT",
+	"p95_rtt":     "p95 RTT",
+	"target_loss": "单目标丢包率",
+}
+
+// MetricName 检查项的中文名称
+func (c *AcceptCheck) MetricName() string {
+	return acceptMetricNames[c.Metric]
+}
+
+// Result 检查结果：通过或未通过及原因
+func (c *AcceptCheck) Result() string {
+	switch {
+	case c.Passed:
+		return "通过"
+	case c.Detail == "":
+		return "未通过"
+	}
+	return "未通过（" + c.Detail + "）"
+}
+
+// Verdict 总体结论
+func (r *AcceptReport) Verdict() string {
+	failed := 0
+	for _, c := range r.Checks {
+		if !c.Passed {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return fmt.Sprintf("通过（%d 项指标全部达标）", len(r.Checks))
+	}
+	return fmt.Sprintf("未通过（%d 项指标中 %d 项未达标）", len(r.Checks), failed)
+}
+
+// signedContent 签名覆盖的内容：去掉签名后报告的紧凑 JSON
+func (r *AcceptReport) signedContent() ([]byte, error) {
+	unsigned := *r
+	unsigned.Signature = nil
+	return json.Marshal(&unsigned)
+}
+
+func (r *AcceptReport) sign(key ed25519.PrivateKey) error {
+	content, err := r.signedContent()
+	if err != nil {
+		return fmt.Errorf("签名验收报告失败: %v", err)
+	}
+	r.Signature = newSignature(content, key)
+	return nil
+}
+
+// printAcceptReport 输出各项检查和结论
+func printAcceptReport(w io.Writer, r *AcceptReport) {
+	fmt.Fprintf(w, "====== 验收 %s ======\n", r.Name)
+	table := newPlainTable(w, []string{"指标", "检查项", "目标数", "上限", "实际", "结果"})
+	for _, c := range r.Checks {
+		table.Append([]string{c.Criterion, c.MetricName(), fmt.Sprint(c.Targets), fmt.Sprintf("%g%s", c.Limit, c.Unit),
+			fmt.Sprintf("%.2f%s", c.Actual, c.Unit), c.Result()})
+	}
+	table.Render()
+	fmt.Fprintf(w, "结论：%s\n", r.Verdict())
+}
+
+// save 将验收报告以 JSON 格式写入文件
+func (r *AcceptReport) save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建验收报告 %s 失败: %v", path, err)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return fmt.Errorf("写入验收报告 %s 失败: %v", path, err)
+	}
+	return nil
+}
+
+// saveHTML 写入单页 HTML 证书，evidence 为 JSON 报告的路径
+func (r *AcceptReport) saveHTML(path, evidence string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建验收证书 %s 失败: %v", path, err)
+	}
+	defer f.Close()
+	if err := r.WriteHTML(f, evidence); err != nil {
+		return fmt.Errorf("写入验收证书 %s 失败: %v", path, err)
+	}
+	return nil
+}
+
+var acceptReportHTML = template.Must(template.New("accept").Funcs(template.FuncMap{"inc": func(i int) int { return i + 1 }}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>线路验收 {{.Report.Name}}</title>
+<style>
+body { font-family: -apple-system, "PingFang SC", "Microsoft YaHei", sans-serif; margin: 24px; color: #222; }
+table { border-collapse: collapse; margin-bottom: 24px; }
+th, td { padding: 4px 10px; border-bottom: 1px solid #ddd; text-align: left; white-space: nowrap; }
+th { background: #f4f4f4; }
+.pass { color: #1a7f37; font-weight: bold; }
+.fail { color: #cf222e; font-weight: bold; }
+.meta { color: #666; }
+.verdict { font-size: 1.6em; }
+</style>
+</head>
+<body>
+{{with .Report}}<h1>线路验收报告：{{.Name}}</h1>
+<p class="meta">{{with .Circuit}}线路 {{.}} · {{end}}探测主机 {{.Host}} · 生成时间 {{.CreatedAt.Format "2006-01-02 15:04:05"}} · 共 {{len .Rounds}} 轮</p>
+<p class="verdict {{if .Passed}}pass{{else}}fail{{end}}">{{if .Passed}}✅{{else}}❌{{end}} {{.Verdict}}</p>
+<table>
+<thead><tr><th>指标</th><th>检查项</th><th>目标数</th><th>上限</th><th>实际</th><th>结果</th></tr></thead>
+<tbody>
+{{range .Checks}}<tr><td>{{.Criterion}}</td><td>{{.MetricName}}</td><td>{{.Targets}}</td><td>{{.Limit}}{{.Unit}}</td><td>{{printf "%.2f" .Actual}}{{.Unit}}</td><td class="{{if .Passed}}pass{{else}}fail{{end}}">{{.Result}}</td></tr>
+{{end}}</tbody>
+</table>
+<h2>各轮探测</h2>
+<table>
+<thead><tr><th>轮次</th><th>开始时间</th><th>运行 ID</th><th>源IP</th><th>每个目标发包</th><th>有回包的目标</th><th>全部丢包的目标</th></tr></thead>
+<tbody>
+{{range $i, $s := .Rounds}}<tr><td>{{inc $i}}</td><td>{{$s.CreatedAt.Format "2006-01-02 15:04:05"}}</td><td>{{$s.RunID}}</td><td>{{$s.Source}}</td><td>{{$s.Count}}</td><td>{{len $s.Rows}}</td><td>{{len $s.Unanswered}}</td></tr>
+{{end}}</tbody>
+</table>
+<h2>验收标准</h2>
+<p class="meta">SHA-256 {{.CriteriaHash}}</p>
+<pre>{{.Criteria}}</pre>
+<p class="meta">{{with .Signature}}报告由 Ed25519 密钥 {{.KeyID}} 签名{{else}}报告未签名{{end}}；各轮全部目标的完整结果见 {{$.Evidence}}{{if .Signature}}，可用 dping verify {{$.Evidence}} 校验签名{{end}}</p>
+{{end}}</body>
+</html>
+`))
+
+// WriteHTML 把验收结论写成单页 HTML 证书，evidence 为随附的 JSON 报告的路径
+func (r *AcceptReport) WriteHTML(w io.Writer, evidence string) error {
+	return acceptReportHTML.Execute(w, struct {
+		Report   *AcceptReport
+		Evidence string
+	}{r, evidence})
+}
+
+// isAcceptReport 判断 JSON 文件是否为验收报告
+func isAcceptReport(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	var head struct {
+		Kind string `json:"kind"`
+	}
+	return json.Unmarshal(data, &head) == nil && head.Kind == acceptKind
+}
+
+// verifyAcceptReport 校验验收报告的签名并输出结论，trusted 非空时要求由该公钥签名
+func verifyAcceptReport(path string, trusted ed25519.PublicKey) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	report := &AcceptReport{}
+	if err := json.Unmarshal(data, report); err != nil {
+		return fmt.Errorf("解析验收报告失败: %v", err)
+	}
+	if report.Signature == nil {
+		return fmt.Errorf("没有签名")
+	}
+	content, err := report.signedContent()
+	if err != nil {
+		return err
+	}
+	if err := checkSignature(report.Signature, content, trusted); err != nil {
+		return err
+	}
+	fmt.Printf("✅ %s: 签名有效（密钥 %s，%s %s），验收 %s：%s\n", path, report.Signature.KeyID,
+		report.CreatedAt.Format("2006-01-02 15:04:05"), report.Host, report.Name, report.Verdict())
+	return nil
+}
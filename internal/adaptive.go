@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"math"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+// AdaptiveOptions 自适应探测参数：RTT 估计稳定后提前结束，波动大时继续探测直到 MaxCount
+type AdaptiveOptions struct {
+	Enabled   bool
+	MaxCount  int           // 单个目标最多发包数量
+	Threshold time.Duration // 95% 置信区间半宽低于该值即认为 RTT 已稳定
+}
+
+// maxPackets 单个目标最多发出的包数：自适应模式下为 MaxCount，否则为 count；-pace 按该包数计算间隔，未收敛的目标也在 -pace 内发完
+func (o AdaptiveOptions) maxPackets(count int) int {
+	if o.Enabled && o.MaxCount > count {
+		return o.MaxCount
+	}
+	return count
+}
+
+// rttEstimator 在线计算 RTT 均值和方差（Welford 算法）
+type rttEstimator struct {
+	n    int
+	mean float64
+	m2   float64
+}
+
+func (e *rttEstimator) add(rtt time.Duration) {
+	e.n++
+	x := float64(rtt)
+	delta := x - e.mean
+	e.mean += delta / float64(e.n)
+	e.m2 += delta * (x - e.mean)
+}
+
+// halfWidth 返回当前 RTT 均值 95% 置信区间的半宽，样本不足时返回最大值
+func (e *rttEstimator) halfWidth() time.Duration {
+	if e.n < 2 {
+		return time.Duration(math.MaxInt64)
+	}
+	stdDev := math.Sqrt(e.m2 / float64(e.n-1))
+	return time.Duration(1.96 * stdDev / math.Sqrt(float64(e.n)))
+}
+
+// applyAdaptive 为 pinger 配置自适应提前结束，至少收到 minCount 个回包后才会判断是否停止
+func applyAdaptive(pinger *ping.Pinger, minCount int, opts AdaptiveOptions) {
+	if !opts.Enabled || opts.MaxCount <= minCount {
+		return
+	}
+	pinger.Count = opts.MaxCount
+	pinger.Timeout = time.Duration(opts.MaxCount)*pinger.Interval + 5*time.Second
+
+	est := &rttEstimator{}
+	pinger.OnRecv = func(pkt *ping.Packet) {
+		est.add(pkt.Rtt)
+		if est.n >= minCount && est.halfWidth() < opts.Threshold {
+			pinger.Stop()
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRTTHalfWidth(t *testing.T) {
+	ms := time.Millisecond
+	for _, c := range []struct {
+		rtts []time.Duration
+		want time.Duration
+	}{
+		{nil, math.MaxInt64},
+		{[]time.Duration{10 * ms}, math.MaxInt64},
+		{[]time.Duration{10 * ms, 10 * ms, 10 * ms}, 0},
+		// 均值 12ms，样本标准差 2ms：1.96×2/√3
+		{[]time.Duration{10 * ms, 12 * ms, 14 * ms}, 2263 * time.Microsecond},
+		// 均值 15ms，样本标准差 √(250/3)≈9.129ms：1.96×9.129/√4
+		{[]time.Duration{5 * ms, 10 * ms, 20 * ms, 25 * ms}, 8946 * time.Microsecond},
+	} {
+		got := internal.RTTHalfWidth(c.rtts...)
+		if d := got - c.want; d < -time.Microsecond || d > time.Microsecond {
+			t.Errorf("%v 的置信区间半宽应为 %s，实际为 %s", c.rtts, c.want, got)
+		}
+	}
+}
+
+func TestAdaptiveStop(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+	const pace = 400 * time.Millisecond
+	for _, c := range []struct {
+		threshold time.Duration
+		sent      int
+	}{
+		// 回环的 RTT 很稳定，发满 -p 个包后半宽即低于 50ms，提前结束
+		{50 * time.Millisecond, 3},
+		// 半宽不可能低于 1ns，发到 -pmax 为止
+		{time.Nanosecond, 20},
+	} {
+		opts := internal.Options{Region: internal.TestsetRegion, Isp: "电信", MaxConcurrency: 1, Count: 3,
+			Adaptive: internal.AdaptiveOptions{Enabled: true, MaxCount: 20, Threshold: c.threshold},
+			Probe:    internal.ProbeOptions{Proto: "tcp", Port: port, Pace: pace},
+			Output:   internal.OutputOptions{Format: "json", NoPager: true, Quiet: true}}
+		start := time.Now()
+		result, err := internal.DPing(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		elapsed := time.Since(start)
+		if rows := result.Snapshot.Rows; len(rows) == 0 || rows[0].Sent != c.sent {
+			t.Errorf("-ci %s 时应发出 %d 个包: %+v", c.threshold, c.sent, rows)
+		}
+		// 按 -pmax 计算间隔，未收敛的目标也在 -pace 内发完
+		if elapsed > pace+time.Second {
+			t.Errorf("-ci %s 用时 %s，超出 -pace %s", c.threshold, elapsed, pace)
+		}
+	}
+	if err := (internal.Options{Count: 3, Adaptive: internal.AdaptiveOptions{Enabled: true, MaxCount: 50, Threshold: time.Millisecond},
+		Probe: internal.ProbeOptions{Pace: 400 * time.Millisecond}}).Validate(); err == nil {
+		t.Error("-pace 内按 -pmax 计算的间隔小于 10ms 时应报错")
+	}
+}
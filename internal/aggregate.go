@@ -0,0 +1,210 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"text/template"
+	"time"
+)
+
+// defaultAggregate 交互界面中未指定 -aggregate 时按服务汇总使用的模板：同一地区和运营商的目标（如全部上海电信的解析服务器）为一个服务
+const defaultAggregate = "{{.Region}}{{.Isp}}"
+
+// serviceAggregate 同一逻辑服务（-aggregate 模板结果相同、源IP和探测方式相同）的多个目标汇总为一行：
+// 丢包率和平均 RTT 按包数汇总，另给出各目标中最好和最差的值
+type serviceAggregate struct {
+	Name      string
+	Source    string
+	Proto     string
+	Members   []*SummaryStatistic
+	totals    *rowTotals
+	BestLoss  float64
+	WorstLoss float64
+	BestRtt   time.Duration // 有回包的目标中最低的平均 RTT，全部没有回包时为 0
+	WorstRtt  time.Duration
+	Worst     *SummaryStatistic // 丢包率最高（相同时平均 RTT 最高）的目标
+}
+
+// aggregateServices 按模板将结果汇总为各服务，服务按其中第一个目标在 list 中的位置排列（即按 -S 排序最靠前的目标）
+func aggregateServices(t *template.Template, list []*SummaryStatistic) []*serviceAggregate {
+	var aggs []*serviceAggregate
+	index := make(map[string]*serviceAggregate)
+	for _, sum := range list {
+		name := groupOf(t, sum)
+		key := name + "|" + sum.Source + "|" + sum.Proto
+		agg := index[key]
+		if agg == nil {
+			agg = &serviceAggregate{Name: name, Source: sum.Source, Proto: sum.Proto, totals: newRowTotals(),
+				BestLoss: sum.PacketLoss, WorstLoss: sum.PacketLoss, Worst: sum}
+			index[key] = agg
+			aggs = append(aggs, agg)
+		}
+		agg.add(sum)
+	}
+	return aggs
+}
+
+func (a *serviceAggregate) add(sum *SummaryStatistic) {
+	a.Members = append(a.Members, sum)
+	a.totals.add(sum)
+	a.BestLoss, a.WorstLoss = min(a.BestLoss, sum.PacketLoss), max(a.WorstLoss, sum.PacketLoss)
+	if sum.TotalRecv > 0 {
+		if a.BestRtt == 0 || sum.AvgRtt < a.BestRtt {
+			a.BestRtt = sum.AvgRtt
+		}
+		a.WorstRtt = max(a.WorstRtt, sum.AvgRtt)
+	}
+	if sum.PacketLoss > a.Worst.PacketLoss || (sum.PacketLoss == a.Worst.PacketLoss && sum.AvgRtt > a.Worst.AvgRtt) {
+		a.Worst = sum
+	}
+}
+
+// Loss 按包数汇总的丢包率
+func (a *serviceAggregate) Loss() float64 {
+	return a.totals.loss()
+}
+
+// AvgRtt 全部回包的平均 RTT
+func (a *serviceAggregate) AvgRtt() time.Duration {
+	return a.totals.avgRtt()
+}
+
+// SnapshotService 快照中一个逻辑服务（-aggregate）的汇总结果，时间以毫秒表示
+type SnapshotService struct {
+	Name             string   `json:"name"`
+	Source           string   `json:"source,omitempty"`
+	Proto            string   `json:"proto,omitempty"`
+	Members          []string `json:"members"`
+	Sent             int      `json:"sent"`
+	Recv             int      `json:"recv"`
+	LossPercent      float64  `json:"loss_percent"`
+	AvgRttMs         float64  `json:"avg_rtt_ms"`
+	BestLossPercent  float64  `json:"best_loss_percent"`
+	WorstLossPercent float64  `json:"worst_loss_percent"`
+	BestAvgRttMs     float64  `json:"best_avg_rtt_ms"`
+	WorstAvgRttMs    float64  `json:"worst_avg_rtt_ms"`
+	WorstDestIP      string   `json:"worst_dest_ip"`
+}
+
+// snapshotServices 将各服务的汇总转为快照中的格式
+func snapshotServices(aggs []*serviceAggregate) []*SnapshotService {
+	services := make([]*SnapshotService, 0, len(aggs))
+	for _, a := range aggs {
+		s := &SnapshotService{
+			Name:             a.Name,
+			Source:           a.Source,
+			Proto:            a.Proto,
+			Sent:             a.totals.sent,
+			Recv:             a.totals.recv,
+			LossPercent:      a.Loss(),
+			AvgRttMs:         durationToMs(a.AvgRtt()),
+			BestLossPercent:  a.BestLoss,
+			WorstLossPercent: a.WorstLoss,
+			BestAvgRttMs:     durationToMs(a.BestRtt),
+			WorstAvgRttMs:    durationToMs(a.WorstRtt),
+			WorstDestIP:      a.Worst.DestIP,
+		}
+		seen := make(map[string]bool)
+		for _, m := range a.Members {
+			if !seen[m.DestIP] {
+				seen[m.DestIP] = true
+				s.Members = append(s.Members, m.DestIP)
+			}
+		}
+		services = append(services, s)
+	}
+	return services
+}
+
+// printAggregates 输出按服务汇总的表格，expand 时在每个服务之后列出其各目标
+func (r *TableRenderer) printAggregates(w io.Writer, aggs []*serviceAggregate, expand bool) {
+	header := []string{"服务", "目标数", "发", "收", "丢包%", "最优丢包%", "最差丢包%", "AvgRTT", "最优RTT", "最差RTT", "最差目标"}
+	// 多源探测时追加源IP列，有协议标签时追加协议列
+	sources := make(map[string]bool)
+	var withProto bool
+	for _, a := range aggs {
+		sources[a.Source] = true
+		withProto = withProto || a.Proto != ""
+	}
+	withSource := len(sources) > 1
+	if withSource {
+		header = append(header, "源IP")
+	}
+	if withProto {
+		header = append(header, "协议")
+	}
+	formatDuration := func(d time.Duration) string {
+		return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+	}
+	formatRtt := func(recv int, d time.Duration) string {
+		if recv == 0 {
+			return "-"
+		}
+		return r.colorAvgRtt(d, formatDuration(d))
+	}
+	formatLoss := func(loss float64) string {
+		return r.Theme.packetLoss(loss, r.Loss, fmt.Sprintf("%.1f%%", loss))
+	}
+	extra := func(row []string, source, proto string) []string {
+		if withSource {
+			row = append(row, source)
+		}
+		if withProto {
+			row = append(row, proto)
+		}
+		return row
+	}
+
+	total := newRowTotals()
+	var rows [][]string
+	for _, a := range aggs {
+		loss := "-"
+		if a.totals.sent > 0 {
+			loss = formatLoss(a.Loss())
+		}
+		members := make(map[string]bool)
+		for _, m := range a.Members {
+			members[m.DestIP] = true
+			total.add(m)
+		}
+		bestRtt, worstRtt := "-", "-"
+		if a.BestRtt > 0 {
+			bestRtt, worstRtt = r.colorAvgRtt(a.BestRtt, formatDuration(a.BestRtt)), r.colorAvgRtt(a.WorstRtt, formatDuration(a.WorstRtt))
+		}
+		rows = append(rows, extra([]string{
+			a.Name,
+			fmt.Sprintf("%d", len(members)),
+			fmt.Sprintf("%d", a.totals.sent),
+			fmt.Sprintf("%d", a.totals.recv),
+			loss,
+			formatLoss(a.BestLoss),
+			formatLoss(a.WorstLoss),
+			formatRtt(a.totals.recv, a.AvgRtt()),
+			bestRtt,
+			worstRtt,
+			a.Worst.DestIP,
+		}, a.Source, a.Proto))
+		if !expand {
+			continue
+		}
+		for _, m := range a.Members {
+			rows = append(rows, extra([]string{
+				"  └ " + m.DestIP,
+				"",
+				fmt.Sprintf("%d", m.TotalSent),
+				fmt.Sprintf("%d", m.TotalRecv),
+				formatLoss(m.PacketLoss),
+				"", "",
+				formatRtt(m.TotalRecv, m.AvgRtt),
+				"", "", "",
+			}, m.Source, m.Proto))
+		}
+	}
+
+	totals := total.footer(formatDuration)
+	footer := extra([]string{
+		"总计", fmt.Sprintf("%d", len(total.counted)), fmt.Sprintf("%d", total.sent), fmt.Sprintf("%d", total.recv),
+		totals[0], "", "", totals[1], "", "", "",
+	}, "", "")
+	r.renderFitted(w, header, rows, footer)
+}
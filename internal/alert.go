@@ -0,0 +1,321 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 告警事件状态
+const (
+	AlertFiring   = "firing"   // 目标劣化
+	AlertResolved = "resolved" // 目标恢复
+)
+
+// AlertOptions 持续探测时的告警参数，丢包和时延阈值都为 0 时不告警
+type AlertOptions struct {
+	LossPercent   float64       // 丢包率达到该百分比视为劣化
+	AvgRtt        time.Duration // 平均 RTT 达到该值视为劣化
+	For           time.Duration // 持续劣化该时长后才告警，恢复同样需要持续该时长，避免反复通知
+	Renotify      time.Duration // 告警未恢复时每隔该时长重复通知一次，0 为不重复
+	Webhook       string        // 非空时将事件和每日汇总以 JSON POST 到该地址
+	SNMPTrap      string        // 非空时将事件以 SNMPv2c Trap 发送到该地址（主机[:端口]，默认端口 162），每日汇总不发送
+	SNMPCommunity string        // SNMP Trap 的团体名，为空时为 public
+	SNMPOID       string        // 通知和变量的根 OID，为空时为 NET-SNMP 的实验分支 1.3.6.1.4.1.8072.9999.9999
+	LossRise      float64       // 丢包率在 RiseWindow 内上升达到该百分点数视为劣化，比固定阈值更早发现正在恶化的目标
+	RiseWindow    time.Duration // 计算丢包率上升的时间窗口
+	SloRtt        time.Duration // 运营商的时延目标：全部目标平均 RTT 的 p95 超过该值视为违反，按运营商整体告警而不是逐个目标
+	SloWindows    int           // 连续违反时延目标该轮数后告警，告警后连续达标同样轮数后恢复
+}
+
+// Enabled 是否设置了告警阈值
+func (o AlertOptions) Enabled() bool {
+	return o.LossPercent > 0 || o.AvgRtt > 0 || o.LossRise > 0 || o.SloRtt > 0
+}
+
+// validate 校验告警参数
+func (o AlertOptions) validate() error {
+	if o.LossPercent < 0 || o.LossPercent > 100 {
+		return fmt.Errorf("告警丢包率 -alert-loss 必须在 0 到 100 之间，当前为 %.1f%%", o.LossPercent)
+	}
+	if o.AvgRtt < 0 || o.For < 0 || o.Renotify < 0 {
+		return fmt.Errorf("-alert-rtt、-alert-for 和 -alert-renotify 不能为负数")
+	}
+	if o.LossRise < 0 || o.LossRise > 100 {
+		return fmt.Errorf("丢包率上升告警 -alert-loss-rise 必须在 0 到 100 个百分点之间，当前为 %.1f", o.LossRise)
+	}
+	if o.LossRise > 0 && o.RiseWindow <= 0 {
+		return fmt.Errorf("-alert-loss-rise 需要大于 0 的时间窗口 -alert-rise-window")
+	}
+	if o.SloRtt < 0 {
+		return fmt.Errorf("时延目标 -alert-slo-rtt 不能为负数")
+	}
+	if o.SloRtt > 0 && o.SloWindows < 1 {
+		return fmt.Errorf("-alert-slo-rtt 需要至少 1 轮的 -alert-slo-windows，当前为 %d", o.SloWindows)
+	}
+	if o.LossPercent == 0 && o.AvgRtt == 0 && o.LossRise == 0 && o.For > 0 {
+		// 时延目标按轮数而不是时长判断持续，不使用 -alert-for
+		return fmt.Errorf("-alert-for 需要同时指定 -alert-loss、-alert-rtt 或 -alert-loss-rise")
+	}
+	if o.Webhook != "" {
+		if u, err := url.Parse(o.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("告警地址 -alert-webhook 必须是 http(s) 地址，当前为 '%s'", o.Webhook)
+		}
+	}
+	return validateSNMP(o)
+}
+
+// AlertEvent 一个目标（或 Scope 为 AlertScopeIsp 时一个运营商整体）的劣化或恢复事件，时间以毫秒表示
+type AlertEvent struct {
+	Status      string    `json:"status"`           // firing 或 resolved
+	Repeat      bool      `json:"repeat,omitempty"` // 告警未恢复时的重复通知
+	Scope       string    `json:"scope,omitempty"`  // 为 isp 时是运营商的时延目标事件，DestIP 和 Region 为空
+	DestIP      string    `json:"dest_ip"`
+	Region      string    `json:"region"`
+	Isp         string    `json:"isp"`
+	Source      string    `json:"source,omitempty"`
+	LossPercent float64   `json:"loss_percent"`         // 本轮丢包率
+	AvgRttMs    float64   `json:"avg_rtt_ms"`           // 本轮平均 RTT
+	P95RttMs    float64   `json:"p95_rtt_ms,omitempty"` // 运营商全部目标平均 RTT 的 p95，仅运营商事件有值
+	Targets     int       `json:"targets,omitempty"`    // 计入 p95 的目标数，仅运营商事件有值
+	Reason      string    `json:"reason"`               // 劣化原因，恢复事件为最近一次劣化的原因
+	Since       time.Time `json:"since"`                // 开始劣化的时间
+	At          time.Time `json:"at"`                   // 事件产生的时间
+	RunID       string    `json:"run_id"`               // 产生事件的一轮探测的运行 ID
+}
+
+// AlertSink 接收告警事件
+type AlertSink interface {
+	Notify(event *AlertEvent) error
+}
+
+// alertState 单个目标的告警状态，目标健康且未告警时不保留
+type alertState struct {
+	degradedSince time.Time // 开始劣化的时间
+	healthySince  time.Time // 告警后开始恢复的时间，仍在劣化时为零值
+	firing        bool
+	notifiedAt    time.Time // 最近一次通知的时间
+	reason        string
+	riseFrom      *float64 // 因丢包率上升劣化时上升前的丢包率，之后一直与它比较，不随时间窗口滑动而自动恢复
+}
+
+// lossSample 一轮的丢包率，用于计算时间窗口内的上升
+type lossSample struct {
+	at   time.Time
+	loss float64
+}
+
+// AlertManager 按目标维护告警状态：持续劣化 For 后告警，未恢复时按 Renotify 重复通知，
+// 持续恢复 For 后发出恢复事件，同一状态不会每轮重复通知
+type AlertManager struct {
+	opts   AlertOptions
+	sinks  []AlertSink
+	states map[string]*alertState
+	losses map[string][]lossSample // 设置了 LossRise 时各目标 RiseWindow 内各轮的丢包率
+	slo    map[string]*sloState    // 设置了 SloRtt 时各运营商的时延目标状态
+}
+
+// NewAlertManager 创建告警管理器，事件依次发送给 sinks
+func NewAlertManager(opts AlertOptions, sinks ...AlertSink) *AlertManager {
+	return &AlertManager{opts: opts, sinks: sinks, states: make(map[string]*alertState), losses: make(map[string][]lossSample),
+		slo: make(map[string]*sloState)}
+}
+
+// newAlertManager 按参数创建告警管理器，未设置阈值时返回 nil
+func newAlertManager(opts AlertOptions) *AlertManager {
+	if !opts.Enabled() {
+		return nil
+	}
+	return NewAlertManager(opts, notifySinks(opts)...)
+}
+
+// notifySinks 告警和每日汇总的通知渠道：总是输出到日志，指定 Webhook 时同时推送，指定 SNMPTrap 时同时发送 Trap
+func notifySinks(opts AlertOptions) []AlertSink {
+	sinks := []AlertSink{logSink{}}
+	if opts.Webhook != "" {
+		sinks = append(sinks, &webhookSink{url: opts.Webhook, client: &http.Client{Timeout: 10 * time.Second}})
+	}
+	if opts.SNMPTrap != "" {
+		sinks = append(sinks, newSNMPSink(opts))
+	}
+	return sinks
+}
+
+// Evaluate 用一轮探测的结果更新各目标（及设置了时延目标时各运营商）的状态，返回本轮产生并已发送的事件；
+// 全部丢包的目标（snap.Unanswered）按 100% 丢包参与判断，本轮没有结果的目标保持原状态
+func (m *AlertManager) Evaluate(snap *Snapshot, now time.Time) []*AlertEvent {
+	if m == nil {
+		return nil
+	}
+	var events []*AlertEvent
+	for _, row := range slices.Concat(snap.Rows, snap.Unanswered) {
+		key := strings.Join([]string{row.DestIP, row.Isp, row.Region, row.Source, row.Proto}, "|")
+		st := m.states[key]
+		reason := m.degraded(row)
+		riseFrom, rise := m.lossRise(key, row, st, now)
+		if rise != "" {
+			reason = strings.Join(slices.DeleteFunc([]string{reason, rise}, func(s string) bool { return s == "" }), "，")
+		}
+		if reason != "" {
+			if st == nil {
+				st = &alertState{degradedSince: now}
+				m.states[key] = st
+			}
+			st.healthySince, st.reason = time.Time{}, reason
+			if rise != "" && st.riseFrom == nil {
+				st.riseFrom = &riseFrom
+			}
+			switch {
+			case !st.firing && now.Sub(st.degradedSince) >= m.opts.For:
+				st.firing, st.notifiedAt = true, now
+				events = append(events, newAlertEvent(AlertFiring, false, row, st, now))
+			case st.firing && m.opts.Renotify > 0 && now.Sub(st.notifiedAt) >= m.opts.Renotify:
+				st.notifiedAt = now
+				events = append(events, newAlertEvent(AlertFiring, true, row, st, now))
+			}
+			continue
+		}
+		if st == nil {
+			continue
+		}
+		if !st.firing {
+			// 未达到 For 就恢复，不告警
+			delete(m.states, key)
+			continue
+		}
+		if st.healthySince.IsZero() {
+			st.healthySince = now
+		}
+		if now.Sub(st.healthySince) >= m.opts.For {
+			delete(m.states, key)
+			events = append(events, newAlertEvent(AlertResolved, false, row, st, now))
+		}
+	}
+	events = append(events, m.evaluateSLO(snap.Rows, now)...)
+	for _, event := range events {
+		event.RunID = snap.RunID
+		for _, sink := range m.sinks {
+			if err := sink.Notify(event); err != nil {
+				log.Printf("⚠️  发送告警失败: %v\n", err)
+			}
+		}
+	}
+	return events
+}
+
+// degraded 返回目标劣化的原因，未劣化时为空
+func (m *AlertManager) degraded(row *SnapshotRow) string {
+	var reasons []string
+	if m.opts.LossPercent > 0 && row.LossPercent >= m.opts.LossPercent {
+		reasons = append(reasons, fmt.Sprintf("丢包率 %.1f%% ≥ %.1f%%", row.LossPercent, m.opts.LossPercent))
+	}
+	if m.opts.AvgRtt > 0 && row.Recv > 0 && msToDuration(row.AvgRttMs) >= m.opts.AvgRtt {
+		reasons = append(reasons, fmt.Sprintf("平均 RTT %.1fms ≥ %s", row.AvgRttMs, m.opts.AvgRtt))
+	}
+	return strings.Join(reasons, "，")
+}
+
+// lossRise 记录本轮丢包率（全部丢包的目标为 100%），返回 RiseWindow 内此前各轮的最低丢包率和上升达到 LossRise 时的劣化原因；
+// 已因上升劣化的目标与劣化前的丢包率比较，直到丢包率回落
+func (m *AlertManager) lossRise(key string, row *SnapshotRow, st *alertState, now time.Time) (float64, string) {
+	if m.opts.LossRise == 0 {
+		return 0, ""
+	}
+	samples := m.losses[key]
+	for len(samples) > 0 && now.Sub(samples[0].at) > m.opts.RiseWindow {
+		samples = samples[1:]
+	}
+	base, ok := 0.0, false
+	for _, s := range samples {
+		if !ok || s.loss < base {
+			base, ok = s.loss, true
+		}
+	}
+	m.losses[key] = append(samples, lossSample{at: now, loss: row.LossPercent})
+	if st != nil && st.riseFrom != nil {
+		base, ok = *st.riseFrom, true
+	}
+	if !ok || row.LossPercent-base < m.opts.LossRise {
+		return base, ""
+	}
+	return base, fmt.Sprintf("丢包率从 %.1f%% 升至 %.1f%%（%s 内上升 ≥ %.1f 个百分点）", base, row.LossPercent, m.opts.RiseWindow, m.opts.LossRise)
+}
+
+func newAlertEvent(status string, repeat bool, row *SnapshotRow, st *alertState, now time.Time) *AlertEvent {
+	return &AlertEvent{
+		Status:      status,
+		Repeat:      repeat,
+		DestIP:      row.DestIP,
+		Region:      row.Region,
+		Isp:         row.Isp,
+		Source:      row.Source,
+		LossPercent: row.LossPercent,
+		AvgRttMs:    row.AvgRttMs,
+		Reason:      st.reason,
+		Since:       st.degradedSince,
+		At:          now,
+	}
+}
+
+// logSink 将事件输出到标准错误
+type logSink struct{}
+
+func (logSink) Notify(e *AlertEvent) error {
+	target := fmt.Sprintf("%s%s %s", e.Region, e.Isp, e.DestIP)
+	if e.Scope == AlertScopeIsp {
+		target = fmt.Sprintf("%s全部 %d 个目标", e.Isp, e.Targets)
+	}
+	if e.Source != "" {
+		target += "（源 " + e.Source + "）"
+	}
+	duration := e.At.Sub(e.Since).Round(time.Second)
+	var run string
+	if e.RunID != "" {
+		run = "，运行 ID " + e.RunID
+	}
+	switch {
+	case e.Status == AlertResolved:
+		var p95 string
+		if e.Scope == AlertScopeIsp {
+			p95 = fmt.Sprintf("，p%d RTT %.1fms", sloPercentile, e.P95RttMs)
+		}
+		log.Printf("✅ 已恢复：%s，丢包率 %.1f%%，平均 RTT %.1fms%s，劣化持续 %s%s\n", target, e.LossPercent, e.AvgRttMs, p95, duration, run)
+	case e.Repeat:
+		log.Printf("🚨 仍未恢复：%s，%s，已持续 %s%s\n", target, e.Reason, duration, run)
+	default:
+		log.Printf("🚨 劣化：%s，%s，已持续 %s%s\n", target, e.Reason, duration, run)
+	}
+	return nil
+}
+
+// webhookSink 将事件和每日汇总以 JSON POST 到指定地址
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *webhookSink) Notify(e *AlertEvent) error {
+	return s.post(e)
+}
+
+func (s *webhookSink) post(v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("推送到 %s 失败: %v", s.url, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("推送到 %s 失败: %s", s.url, resp.Status)
+	}
+	return nil
+}
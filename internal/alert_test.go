@@ -0,0 +1,467 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"encoding/asn1"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingSink 记录收到的事件和每日汇总
+type recordingSink struct {
+	events  []*internal.AlertEvent
+	digests []*internal.Digest
+}
+
+func (s *recordingSink) Notify(e *internal.AlertEvent) error {
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *recordingSink) NotifyDigest(d *internal.Digest) error {
+	s.digests = append(s.digests, d)
+	return nil
+}
+
+func TestAlertManagerHysteresis(t *testing.T) {
+	sink := &recordingSink{}
+	m := internal.NewAlertManager(internal.AlertOptions{
+		LossPercent: 10,
+		For:         2 * time.Minute,
+		Renotify:    5 * time.Minute,
+	}, sink)
+	round := func(i int, loss float64) *internal.Snapshot {
+		return &internal.Snapshot{RunID: fmt.Sprintf("run-%d", i), Rows: []*internal.SnapshotRow{{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", LossPercent: loss}}}
+	}
+
+	start := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	// 每分钟一轮，各轮的丢包率和期望的事件
+	rounds := []struct {
+		loss float64
+		want string
+	}{
+		{50, ""},              // 0m 开始劣化
+		{0, ""},               // 1m 未满 For 即恢复，不告警
+		{50, ""},              // 2m 重新开始计时
+		{50, ""},              // 3m
+		{50, "firing"},        // 4m 持续 2 分钟，告警
+		{50, ""},              // 5m 同一状态不重复通知
+		{100, ""},             // 6m
+		{0, ""},               // 7m 开始恢复
+		{50, ""},              // 8m 恢复未满 For 又劣化，仍在告警中
+		{50, "firing repeat"}, // 9m 距上次通知 5 分钟，重复通知
+		{0, ""},               // 10m
+		{0, ""},               // 11m
+		{0, "resolved"},       // 12m 持续恢复 2 分钟
+		{0, ""},               // 13m
+	}
+	for i, r := range rounds {
+		now := start.Add(time.Duration(i) * time.Minute)
+		var got []string
+		for _, e := range m.Evaluate(round(i, r.loss), now) {
+			s := e.Status
+			if e.Repeat {
+				s += " repeat"
+			}
+			got = append(got, s)
+		}
+		if strings.Join(got, ",") != r.want {
+			t.Fatalf("第 %d 分钟: 事件为 %v，应为 %q", i, got, r.want)
+		}
+	}
+	if len(sink.events) != 3 {
+		t.Fatalf("sink 收到 %d 个事件，应为 3 个", len(sink.events))
+	}
+	resolved := sink.events[2]
+	if !resolved.Since.Equal(start.Add(2*time.Minute)) || resolved.Reason == "" {
+		t.Fatalf("恢复事件应带开始劣化的时间和原因: %+v", resolved)
+	}
+	if resolved.RunID != "run-12" {
+		t.Errorf("恢复事件应带产生它的一轮的运行 ID，实际为 %q", resolved.RunID)
+	}
+}
+
+func TestAlertManagerUnanswered(t *testing.T) {
+	m := internal.NewAlertManager(internal.AlertOptions{LossPercent: 10, Renotify: 2 * time.Minute})
+	// 全部丢包的目标不在 rows 中，只出现在 unanswered
+	round := func(loss float64) *internal.Snapshot {
+		row := &internal.SnapshotRow{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", Sent: 10, Recv: 10, LossPercent: loss}
+		if loss == 100 {
+			row.Recv = 0
+			return &internal.Snapshot{Unanswered: []*internal.SnapshotRow{row}}
+		}
+		return &internal.Snapshot{Rows: []*internal.SnapshotRow{row}}
+	}
+
+	start := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	rounds := []struct {
+		loss float64
+		want string
+	}{
+		{0, ""},                // 0m 健康
+		{100, "firing"},        // 1m 完全不通
+		{100, ""},              // 2m
+		{100, "firing repeat"}, // 3m 仍不通，按 Renotify 重复通知
+		{0, "resolved"},        // 4m 恢复
+	}
+	for i, r := range rounds {
+		var got []string
+		for _, e := range m.Evaluate(round(r.loss), start.Add(time.Duration(i)*time.Minute)) {
+			s := e.Status
+			if e.Repeat {
+				s += " repeat"
+			}
+			got = append(got, s)
+			if e.Status == internal.AlertFiring && (e.LossPercent != 100 || !strings.Contains(e.Reason, "丢包率 100.0%")) {
+				t.Errorf("第 %d 分钟: 全部丢包的告警应带 100%% 丢包率: %+v", i, e)
+			}
+		}
+		if strings.Join(got, ",") != r.want {
+			t.Fatalf("第 %d 分钟: 事件为 %v，应为 %q", i, got, r.want)
+		}
+	}
+}
+
+func TestAlertManagerLossRise(t *testing.T) {
+	m := internal.NewAlertManager(internal.AlertOptions{LossRise: 5, RiseWindow: 3 * time.Minute})
+	start := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	// 每分钟一轮：缓慢上升不告警；3 分钟内上升 5 个百分点即告警，远低于固定的 10% 阈值；
+	// 之后丢包率不再上升也保持告警，直到回落到上升前的水平附近
+	rounds := []struct {
+		loss float64
+		want string
+	}{
+		{0, ""},         // 0m
+		{1.5, ""},       // 1m
+		{3, ""},         // 2m
+		{4.5, ""},       // 3m 窗口内最低为 0m 的 0%，上升 4.5 个百分点
+		{6, ""},         // 4m
+		{7.5, ""},       // 5m
+		{14, "firing"},  // 6m 3 分钟内从 4.5% 升至 14%
+		{14, ""},        // 7m
+		{14, ""},        // 8m
+		{14, ""},        // 9m 窗口内各轮都是 14%，仍与上升前的 4.5% 比较
+		{7, "resolved"}, // 10m 回落到上升前的水平附近
+	}
+	for i, r := range rounds {
+		now := start.Add(time.Duration(i) * time.Minute)
+		var got []string
+		for _, e := range m.Evaluate(&internal.Snapshot{Rows: []*internal.SnapshotRow{{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", LossPercent: r.loss}}}, now) {
+			got = append(got, e.Status)
+			if e.Status == internal.AlertFiring && !strings.Contains(e.Reason, "从 4.5% 升至 14.0%") {
+				t.Errorf("告警原因应说明上升前后的丢包率: %s", e.Reason)
+			}
+		}
+		if strings.Join(got, ",") != r.want {
+			t.Fatalf("第 %d 分钟: 事件为 %v，应为 %q", i, got, r.want)
+		}
+	}
+}
+
+func TestAlertManagerLossRiseToUnanswered(t *testing.T) {
+	m := internal.NewAlertManager(internal.AlertOptions{LossRise: 5, RiseWindow: 3 * time.Minute})
+	start := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	healthy := &internal.Snapshot{Rows: []*internal.SnapshotRow{{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", Sent: 10, Recv: 10}}}
+	dark := &internal.Snapshot{Unanswered: []*internal.SnapshotRow{{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", Sent: 10, LossPercent: 100}}}
+	if events := m.Evaluate(healthy, start); len(events) != 0 {
+		t.Fatalf("健康的目标不应告警: %v", events)
+	}
+	events := m.Evaluate(dark, start.Add(time.Minute))
+	if len(events) != 1 || events[0].Status != internal.AlertFiring || !strings.Contains(events[0].Reason, "从 0.0% 升至 100.0%") {
+		t.Fatalf("从 0%% 升至 100%% 丢包应按上升告警，实际为 %+v", events)
+	}
+}
+
+func TestAlertManagerSLO(t *testing.T) {
+	sink := &recordingSink{}
+	m := internal.NewAlertManager(internal.AlertOptions{SloRtt: 50 * time.Millisecond, SloWindows: 2}, sink)
+	// 电信 20 个目标，slow 个为 100ms、其余为 10ms，第一个慢目标的权重为 weight；联通只有一个 20ms 的目标
+	round := func(slow int, weight float64) *internal.Snapshot {
+		snap := &internal.Snapshot{Rows: []*internal.SnapshotRow{{DestIP: "2.2.2.2", Region: "北京", Isp: "联通", Sent: 10, Recv: 10, AvgRttMs: 20}}}
+		for i := range 20 {
+			row := &internal.SnapshotRow{DestIP: fmt.Sprintf("1.1.1.%d", i+1), Region: "上海", Isp: "电信", Sent: 10, Recv: 10, AvgRttMs: 10}
+			if i < slow {
+				row.AvgRttMs = 100
+			}
+			if i == 0 {
+				row.Weight = weight
+			}
+			snap.Rows = append(snap.Rows, row)
+		}
+		return snap
+	}
+
+	start := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	rounds := []struct {
+		snap *internal.Snapshot
+		want string
+	}{
+		{round(1, 0), ""},         // 只有一个目标慢，p95 仍为 10ms，不按单个目标告警
+		{round(2, 0), ""},         // 两个目标慢，p95 为 100ms，第 1 轮违反
+		{round(2, 0), "firing"},   // 连续 2 轮
+		{round(0, 0), ""},         // 达标 1 轮
+		{round(2, 0), ""},         // 未连续达标 2 轮，仍在告警中
+		{round(0, 0), ""},         // 达标 1 轮
+		{round(0, 0), "resolved"}, // 连续达标 2 轮
+		{round(1, 2), ""},         // 慢的是权重为 2 的主用服务器，按权重 p95 为 100ms
+		{round(1, 2), "firing"},
+	}
+	for i, r := range rounds {
+		events := m.Evaluate(r.snap, start.Add(time.Duration(i)*time.Minute))
+		var got []string
+		for _, e := range events {
+			got = append(got, e.Status)
+			if e.Scope != internal.AlertScopeIsp || e.Isp != "电信" || e.DestIP != "" || e.Targets != 20 {
+				t.Errorf("第 %d 轮: 事件应为电信整体的时延目标事件，实际为 %+v", i, e)
+			}
+		}
+		if strings.Join(got, " ") != r.want {
+			t.Errorf("第 %d 轮: 事件为 %v，应为 %q", i, got, r.want)
+		}
+	}
+	if e := sink.events[0]; e.P95RttMs != 100 || e.Since != start.Add(time.Minute) || !strings.Contains(e.Reason, "p95 RTT 100.0ms") {
+		t.Errorf("告警事件不符: %+v", e)
+	}
+}
+
+func TestValidateWatch(t *testing.T) {
+	for _, c := range []struct {
+		opts internal.WatchOptions
+		ok   bool
+	}{
+		{internal.WatchOptions{}, true},
+		{internal.WatchOptions{Interval: time.Minute, Alert: internal.AlertOptions{LossPercent: 10, Renotify: time.Hour}}, true},
+		{internal.WatchOptions{Alert: internal.AlertOptions{LossPercent: 10}}, false},
+		{internal.WatchOptions{Interval: 100 * time.Millisecond}, false},
+		{internal.WatchOptions{Interval: time.Minute, Alert: internal.AlertOptions{For: time.Minute}}, false},
+		{internal.WatchOptions{Interval: time.Minute, Alert: internal.AlertOptions{LossRise: 5, RiseWindow: 5 * time.Minute}}, true},
+		{internal.WatchOptions{Interval: time.Minute, Alert: internal.AlertOptions{LossRise: 5}}, false},
+		{internal.WatchOptions{Interval: time.Minute, Alert: internal.AlertOptions{SloRtt: 50 * time.Millisecond, SloWindows: 3}}, true},
+		{internal.WatchOptions{Interval: time.Minute, Alert: internal.AlertOptions{SloRtt: 50 * time.Millisecond}}, false},
+		{internal.WatchOptions{Alert: internal.AlertOptions{LossRise: 5, RiseWindow: 5 * time.Minute}}, false},
+		{internal.WatchOptions{Interval: time.Minute, Alert: internal.AlertOptions{LossPercent: 10, Webhook: "ftp://x"}}, false},
+		{internal.WatchOptions{Interval: time.Minute, Digest: "09:00", Alert: internal.AlertOptions{Webhook: "http://x/"}}, true},
+		{internal.WatchOptions{Interval: time.Minute, Alert: internal.AlertOptions{Webhook: "http://x/"}}, false},
+		{internal.WatchOptions{Interval: time.Minute, Digest: "9点"}, false},
+		{internal.WatchOptions{Digest: "09:00"}, false},
+		{internal.WatchOptions{Interval: 10 * time.Minute, Spread: true}, true},
+		{internal.WatchOptions{Spread: true}, false},
+	} {
+		if err := internal.ValidateWatch(c.opts); (err == nil) != c.ok {
+			t.Errorf("%+v: 错误为 %v", c.opts, err)
+		}
+	}
+}
+
+func TestDigester(t *testing.T) {
+	sink := &recordingSink{}
+	start := time.Date(2026, 10, 15, 10, 0, 0, 0, time.Local)
+	digester := internal.NewDigester(9*time.Hour, start, internal.DefaultScoreWeights, sink)
+	rows := func(rtt1, rtt2 float64, recv2 int) *internal.Snapshot {
+		// 1.1.1.1 以两个地区出现，运营商汇总中只计一次
+		return &internal.Snapshot{Rows: []*internal.SnapshotRow{
+			{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", Sent: 10, Recv: 10, AvgRttMs: rtt1},
+			{DestIP: "1.1.1.1", Region: "天津", Isp: "电信", Sent: 10, Recv: 10, AvgRttMs: rtt1},
+			{DestIP: "2.2.2.2", Region: "北京", Isp: "联通", Sent: 10, Recv: recv2, AvgRttMs: rtt2},
+		}}
+	}
+
+	// 第一天：10:00、20:00 和次日 09:00 各一轮，09:00 发送第一份汇总，没有前一天的数据
+	if d := digester.Add(rows(10, 30, 5), start); d != nil {
+		t.Fatalf("未到发送时刻不应发送汇总: %+v", d)
+	}
+	digester.Add(rows(20, 30, 5), start.Add(10*time.Hour))
+	first := digester.Add(rows(30, 30, 5), start.Add(23*time.Hour))
+	if first == nil || first.Rounds != 3 || len(first.Isps) != 2 || len(first.Regressions) != 0 {
+		t.Fatalf("第一份汇总不符: %+v", first)
+	}
+	if isp := first.Isps[0]; isp.Isp != "电信" || isp.Sent != 30 || isp.AvgRttMs != 20 || isp.PrevAvgRttMs != nil {
+		t.Errorf("电信汇总不符: %+v", isp)
+	}
+
+	// 第二天：电信 RTT 上升，联通恢复，只有电信的目标列为劣化
+	digester.Add(rows(50, 30, 10), start.Add(30*time.Hour))
+	second := digester.Add(rows(50, 30, 10), start.Add(47*time.Hour))
+	if second == nil || second.Rounds != 2 || len(sink.digests) != 2 {
+		t.Fatalf("第二份汇总不符: %+v", second)
+	}
+	telecom := second.Isps[0]
+	if telecom.PrevAvgRttMs == nil || *telecom.PrevAvgRttMs != 20 || telecom.AvgRttMs != 50 {
+		t.Errorf("电信与前一天的对比不符: %+v", telecom)
+	}
+	if unicom := second.Isps[1]; unicom.LossPercent != 0 || *unicom.PrevLossPercent != 50 {
+		t.Errorf("联通与前一天的对比不符: %+v", unicom)
+	}
+	if len(second.Regressions) != 2 || second.Regressions[0].DestIP != "1.1.1.1" || second.Regressions[0].ScoreDrop != 6 {
+		t.Errorf("劣化目标不符: %+v", second.Regressions)
+	}
+}
+
+func TestDigesterUnanswered(t *testing.T) {
+	start := time.Date(2026, 10, 15, 10, 0, 0, 0, time.Local)
+	digester := internal.NewDigester(9*time.Hour, start, internal.DefaultScoreWeights)
+	healthy := &internal.Snapshot{Rows: []*internal.SnapshotRow{
+		{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", Sent: 10, Recv: 10, AvgRttMs: 20},
+		{DestIP: "3.3.3.3", Region: "上海", Isp: "电信", Sent: 10, Recv: 10, AvgRttMs: 20},
+	}}
+	// 第二天 3.3.3.3 完全不通，只出现在 unanswered
+	down := &internal.Snapshot{
+		Rows:       []*internal.SnapshotRow{{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", Sent: 10, Recv: 10, AvgRttMs: 20}},
+		Unanswered: []*internal.SnapshotRow{{DestIP: "3.3.3.3", Region: "上海", Isp: "电信", Sent: 10, LossPercent: 100}},
+	}
+	digester.Add(healthy, start)
+	if d := digester.Add(healthy, start.Add(23*time.Hour)); d == nil {
+		t.Fatal("应发送第一份汇总")
+	}
+	digester.Add(down, start.Add(30*time.Hour))
+	d := digester.Add(down, start.Add(47*time.Hour))
+	if d == nil || len(d.Isps) != 1 {
+		t.Fatalf("第二份汇总不符: %+v", d)
+	}
+	// 全部丢包的目标的发包数计入运营商丢包率：40 个包收到 20 个
+	if isp := d.Isps[0]; isp.Sent != 40 || isp.Recv != 20 || isp.LossPercent != 50 || isp.AvgRttMs != 20 {
+		t.Errorf("电信汇总应计入全部丢包的目标: %+v", isp)
+	}
+	if len(d.Regressions) != 1 || d.Regressions[0].DestIP != "3.3.3.3" || d.Regressions[0].LossPercent != 100 || d.Regressions[0].PrevLossPercent != 0 {
+		t.Errorf("完全不通的目标应列为劣化: %+v", d.Regressions)
+	}
+}
+
+func TestEventEmitterTransitions(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "events.jsonl")
+	e := internal.NewEventEmitter(internal.EventOptions{File: file, LossPercent: 10, AvgRtt: 100 * time.Millisecond})
+	row := func(ip string, sent, recv int, avgMs float64) *internal.SnapshotRow {
+		return &internal.SnapshotRow{DestIP: ip, Region: "北京", Isp: "电信", Sent: sent, Recv: recv,
+			LossPercent: float64(sent-recv) / float64(sent) * 100, AvgRttMs: avgMs}
+	}
+	start := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	rounds := [][]*internal.SnapshotRow{
+		{row("1.1.1.1", 10, 10, 20), row("2.2.2.2", 10, 0, 0)},  // 首轮健康的目标不产生事件，首轮即 down 的产生
+		{row("1.1.1.1", 10, 8, 20), row("2.2.2.2", 10, 0, 0)},   // 丢包 20% 变为 degraded
+		{row("1.1.1.1", 10, 9, 20), row("2.2.2.2", 10, 10, 30)}, // 状态不变不重复；2.2.2.2 恢复
+		{row("1.1.1.1", 10, 10, 150)},                           // 时延超过阈值仍为 degraded；本轮没有 2.2.2.2 时保持原状态
+		{row("1.1.1.1", 10, 0, 0), row("2.2.2.2", 10, 10, 30)},
+		{row("1.1.1.1", 10, 10, 20)},
+	}
+	want := []string{
+		"2.2.2.2 ->down",
+		"1.1.1.1 healthy->degraded",
+		"2.2.2.2 down->healthy",
+		"1.1.1.1 degraded->down",
+		"1.1.1.1 down->healthy",
+	}
+	var got []string
+	for i, rows := range rounds {
+		for _, ev := range e.Evaluate(&internal.Snapshot{RunID: fmt.Sprintf("run-%d", i), Rows: rows}, start.Add(time.Duration(i)*time.Minute)) {
+			got = append(got, ev.DestIP+" "+ev.From+"->"+ev.To)
+		}
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("状态变化事件应为 %q，实际为 %q", want, got)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("事件文件应有 %d 行，实际为 %d 行", len(want), len(lines))
+	}
+	// degraded->down 的事件带有变化前最后一轮（时延超标）的结果和 degraded 开始的时间
+	var ev internal.StateEvent
+	if err := json.Unmarshal([]byte(lines[3]), &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Previous == nil || ev.Previous.AvgRttMs != 150 || ev.Current.Recv != 0 || ev.RunID != "run-4" ||
+		ev.Since == nil || !ev.Since.Equal(start.Add(time.Minute)) {
+		t.Errorf("事件中变化前后的结果不正确: %s", lines[3])
+	}
+	if internal.NewEventEmitter(internal.EventOptions{}) != nil {
+		t.Error("未指定事件去向时不应产生事件")
+	}
+}
+
+func TestSNMPTrap(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sink, err := internal.NewSNMPSink(internal.AlertOptions{SNMPTrap: conn.LocalAddr().String(), SNMPCommunity: "noc", SNMPOID: "1.3.6.1.4.1.99999.7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	since := time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC)
+	event := &internal.AlertEvent{Status: internal.AlertFiring, DestIP: "1.1.1.1", Region: "北京", Isp: "电信", LossPercent: 25,
+		AvgRttMs: 31.25, Reason: strings.Repeat("丢包率 25.0% ≥ 20.0%，", 10), Since: since, At: since.Add(3 * time.Minute), RunID: "run-1"}
+	if err := sink.Notify(event); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 用 encoding/asn1 按 SNMPv2c 的结构解码：版本、团体名、Trap PDU（上下文标签 7）
+	var msg struct {
+		Version   int
+		Community []byte
+		PDU       asn1.RawValue
+	}
+	if rest, err := asn1.Unmarshal(buf[:n], &msg); err != nil || len(rest) > 0 {
+		t.Fatalf("Trap 报文无法解码: %v", err)
+	}
+	if msg.Version != 1 || string(msg.Community) != "noc" || msg.PDU.Class != asn1.ClassContextSpecific || msg.PDU.Tag != 7 {
+		t.Fatalf("Trap 报文头不正确: 版本 %d，团体名 %s，PDU 标签 %d", msg.Version, msg.Community, msg.PDU.Tag)
+	}
+	var pdu struct {
+		RequestID, ErrorStatus, ErrorIndex int
+		Varbinds                           []struct {
+			Name  asn1.ObjectIdentifier
+			Value asn1.RawValue
+		}
+	}
+	if _, err := asn1.UnmarshalWithParams(msg.PDU.FullBytes, &pdu, "tag:7"); err != nil {
+		t.Fatalf("Trap PDU 无法解码: %v", err)
+	}
+	got := make(map[string]string)
+	for _, vb := range pdu.Varbinds {
+		got[vb.Name.String()] = string(vb.Value.Bytes)
+	}
+	var trapOID asn1.ObjectIdentifier
+	if len(pdu.Varbinds) < 2 || pdu.Varbinds[0].Name.String() != "1.3.6.1.2.1.1.3.0" || pdu.Varbinds[1].Name.String() != "1.3.6.1.6.3.1.1.4.1.0" {
+		t.Fatalf("前两个变量应为 sysUpTime.0 和 snmpTrapOID.0，实际为 %v", pdu.Varbinds)
+	}
+	if _, err := asn1.Unmarshal(pdu.Varbinds[1].Value.FullBytes, &trapOID); err != nil || trapOID.String() != "1.3.6.1.4.1.99999.7.0.1" {
+		t.Errorf("劣化通知的 OID 应为 1.3.6.1.4.1.99999.7.0.1，实际为 %v", trapOID)
+	}
+	for oid, want := range map[string]string{
+		"1.3.6.1.4.1.99999.7.1.1": "firing",
+		"1.3.6.1.4.1.99999.7.1.2": "1.1.1.1",
+		"1.3.6.1.4.1.99999.7.1.3": "北京",
+		"1.3.6.1.4.1.99999.7.1.4": "电信",
+		"1.3.6.1.4.1.99999.7.1.6": "25.0",
+		"1.3.6.1.4.1.99999.7.1.7": "31.2",
+		"1.3.6.1.4.1.99999.7.1.8": event.Reason,
+		"1.3.6.1.4.1.99999.7.1.9": "2026-10-17T08:00:00Z",
+	} {
+		if got[oid] != want {
+			t.Errorf("变量 %s 应为 %q，实际为 %q", oid, want, got[oid])
+		}
+	}
+
+	for _, o := range []internal.AlertOptions{{SNMPTrap: "nms:70000"}, {SNMPTrap: "nms", SNMPOID: "3.1"}, {SNMPCommunity: "noc"}} {
+		if _, err := internal.NewSNMPSink(o); err == nil {
+			t.Errorf("参数 %+v 应返回错误", o)
+		}
+	}
+}
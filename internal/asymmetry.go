@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 同一目标的 ICMP 与 TCP 平均 RTT 相差超过该倍数且超过该绝对值时视为明显不一致，避免低延迟目标的抖动误报
+const (
+	mismatchRttRatio = 2
+	mismatchRttMin   = 10 * time.Millisecond
+)
+
+// ProtoMismatch 同一目标同时用 ICMP 和 TCP 探测时两者结果明显不一致，以及更可信的一方。
+// 路由器常对 ICMP 限速或降低优先级，此时 ICMP 丢包、延迟偏高而 TCP 正常；反过来 TCP 更差时多为端口被过滤、
+// 中间设备（代理、防火墙）或服务端处理慢，链路质量以 ICMP 为准
+type ProtoMismatch struct {
+	DestIP string `json:"dest_ip"`
+	Region string `json:"region"`
+	Isp    string `json:"isp"`
+	Source string `json:"source,omitempty"`
+	TCP    string `json:"tcp"`    // 参与对比的 TCP 探测方式，如 tcp:443
+	Reason string `json:"reason"` // 如 "ICMP 丢包 40.0%，tcp:443 丢包 0.0%"
+	Trust  string `json:"trust"`  // 更可信的探测方式：icmp 或 TCP 探测方式
+}
+
+// String 用于多协议对比表，如 "ICMP 丢包 40.0%，tcp:443 丢包 0.0%，以 tcp:443 为准"
+func (m *ProtoMismatch) String() string {
+	return m.Reason + "，以 " + m.Trust + " 为准"
+}
+
+// compareICMPTCP 对比同一目标的 ICMP 和 TCP 结果，没有结果（全部丢包或探测失败）的一方传 nil，视为 100% 丢包；
+// 不一致不明显、两者都没有结果或 TCP 端口拒绝连接（链路正常，由多协议对比表另行标出）时返回 nil
+func compareICMPTCP(icmpSum, tcpSum *SummaryStatistic, tcpProto string, loss LossThresholds) *ProtoMismatch {
+	if icmpSum == nil && tcpSum == nil {
+		return nil
+	}
+	if tcpSum != nil {
+		if o := tcpSum.TCPOutcomes; o != nil && o.Connected == 0 && o.Refused > 0 {
+			return nil
+		}
+	}
+	icmpLoss, tcpLoss := 100.0, 100.0
+	if icmpSum != nil {
+		icmpLoss = icmpSum.PacketLoss
+	}
+	if tcpSum != nil {
+		tcpLoss = tcpSum.PacketLoss
+	}
+
+	var reason, trust string
+	switch {
+	case icmpLoss >= loss.Crit && tcpLoss < loss.Warn:
+		reason, trust = fmt.Sprintf("ICMP 丢包 %.1f%%，%s 丢包 %.1f%%", icmpLoss, tcpProto, tcpLoss), tcpProto
+	case tcpLoss >= loss.Crit && icmpLoss < loss.Warn:
+		reason, trust = fmt.Sprintf("%s 丢包 %.1f%%，ICMP 丢包 %.1f%%", tcpProto, tcpLoss, icmpLoss), "icmp"
+	case icmpLoss < 100 && tcpLoss < 100:
+		icmpRtt, tcpRtt := icmpSum.AvgRtt, tcpSum.AvgRtt
+		rtts := fmt.Sprintf("ICMP AvgRTT %.1fms，%s AvgRTT %.1fms",
+			float64(icmpRtt)/float64(time.Millisecond), tcpProto, float64(tcpRtt)/float64(time.Millisecond))
+		switch {
+		case icmpRtt >= mismatchRttRatio*tcpRtt && icmpRtt-tcpRtt >= mismatchRttMin:
+			reason, trust = rtts, tcpProto
+		case tcpRtt >= mismatchRttRatio*icmpRtt && tcpRtt-icmpRtt >= mismatchRttMin:
+			reason, trust = rtts, "icmp"
+		}
+	}
+	if reason == "" {
+		return nil
+	}
+	first := icmpSum
+	if first == nil {
+		first = tcpSum
+	}
+	return &ProtoMismatch{DestIP: first.DestIP, Region: first.Region, Isp: first.Isp, Source: first.Source, TCP: tcpProto, Reason: reason, Trust: trust}
+}
+
+// tcpProtocols 同时探测了 ICMP 时参与对比的 TCP 探测方式，没有 ICMP 探测时返回 nil
+func tcpProtocols(protocols []string) []string {
+	if !slices.Contains(protocols, "icmp") {
+		return nil
+	}
+	var tcp []string
+	for _, proto := range protocols {
+		if proto == "tcp" || strings.HasPrefix(proto, "tcp:") {
+			tcp = append(tcp, proto)
+		}
+	}
+	return tcp
+}
+
+// protoMismatches 同一次运行中同时探测了 ICMP 和 TCP 时，找出两者结果明显不一致的目标；其他情况返回 nil
+func protoMismatches(rows []*SnapshotRow, protocols []string, loss LossThresholds) []*ProtoMismatch {
+	tcp := tcpProtocols(protocols)
+	if len(tcp) == 0 {
+		return nil
+	}
+	var order []string
+	groups := make(map[string]map[string]*SummaryStatistic)
+	for _, row := range rows {
+		key := row.DestIP + "|" + row.Isp + "|" + row.Region + "|" + row.Source
+		if groups[key] == nil {
+			groups[key] = make(map[string]*SummaryStatistic)
+			order = append(order, key)
+		}
+		groups[key][row.Proto] = row.Summary()
+	}
+	var mismatches []*ProtoMismatch
+	for _, key := range order {
+		byProto := groups[key]
+		for _, proto := range tcp {
+			if m := compareICMPTCP(byProto["icmp"], byProto[proto], proto, loss); m != nil {
+				mismatches = append(mismatches, m)
+			}
+		}
+	}
+	return mismatches
+}
@@ -0,0 +1,335 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// AuditOptions dping audit 的参数
+type AuditOptions struct {
+	Catalog     string // 要检查的目标配置文件（与内置配置格式相同），为空时检查内置配置
+	Overlay     string // 检查叠加该覆盖文件之后的配置
+	CityDB      string // MaxMind City 格式的离线库，用于核对省份
+	ASNDB       string // MaxMind ASN 格式的离线库，用于核对运营商
+	Probe       bool   // 逐个 ICMP 探测，全部丢包的条目视为失效
+	Count       int    // 探测时每个 IP 的发包数量
+	Concurrency int    // 探测并发数
+	OutPath     string // 非空时将修正后的配置写入该文件
+}
+
+// asnIsps 国内三家运营商的主要自治系统号
+var asnIsps = map[uint]string{
+	4134: "电信", 4809: "电信", 4811: "电信", 4812: "电信", 4813: "电信", 4816: "电信", 17633: "电信", 17638: "电信",
+	23724: "电信", 134420: "电信", 134772: "电信", 134773: "电信", 134774: "电信", 136188: "电信", 136190: "电信", 140292: "电信",
+	4837: "联通", 4808: "联通", 9800: "联通", 9929: "联通", 10099: "联通", 17621: "联通", 17622: "联通", 17623: "联通",
+	17816: "联通", 135061: "联通", 136958: "联通", 136959: "联通",
+	9808: "移动", 24400: "移动", 24444: "移动", 24445: "移动", 24547: "移动", 38019: "移动", 56040: "移动", 56041: "移动",
+	56042: "移动", 56044: "移动", 56046: "移动", 56047: "移动", 56048: "移动", 58453: "移动", 132525: "移动", 134810: "移动",
+}
+
+// provinceSuffixes MaxMind 中文名称中的行政区划后缀，去掉后与内置配置的地区名称一致
+var provinceSuffixes = []string{"壮族自治区", "回族自治区", "维吾尔自治区", "特别行政区", "自治区", "省", "市"}
+
+// geoRecord City 库和 ASN 库中用到的字段，两种库可以是同一个文件
+type geoRecord struct {
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	ASN   uint   `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// geoLookup 离线库查询结果：Isp/Region 为能与配置直接对应的名称，无法对应时为空，*Detail 为库中的原始信息
+type geoLookup struct {
+	Isp          string
+	IspDetail    string
+	Region       string
+	RegionDetail string
+}
+
+// geoDB 打开的 City 库和 ASN 库，未指定的为 nil
+type geoDB struct {
+	city *maxminddb.Reader
+	asn  *maxminddb.Reader
+}
+
+func openGeoDB(cityPath, asnPath string) (*geoDB, error) {
+	db := &geoDB{}
+	var err error
+	if cityPath != "" {
+		if db.city, err = maxminddb.Open(cityPath); err != nil {
+			return nil, fmt.Errorf("打开离线库 %s 失败: %v", cityPath, err)
+		}
+	}
+	if asnPath != "" {
+		if db.asn, err = maxminddb.Open(asnPath); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("打开离线库 %s 失败: %v", asnPath, err)
+		}
+	}
+	return db, nil
+}
+
+func (db *geoDB) Close() {
+	if db.city != nil {
+		db.city.Close()
+	}
+	if db.asn != nil {
+		db.asn.Close()
+	}
+}
+
+// lookup 查询 IP 的省份和运营商；省份只在国内（含香港）时给出，运营商只在属于三家运营商时给出
+func (db *geoDB) lookup(ip net.IP) (*geoLookup, error) {
+	result := &geoLookup{}
+	if db.city != nil {
+		rec := &geoRecord{}
+		if err := db.city.Lookup(ip, rec); err != nil {
+			return nil, err
+		}
+		switch {
+		case rec.Country.IsoCode == "HK":
+			result.Region = "香港"
+		case rec.Country.IsoCode == "CN" && len(rec.Subdivisions) > 0:
+			names := rec.Subdivisions[0].Names
+			result.Region = trimProvince(names["zh-CN"])
+			if !isProvince(result.Region) {
+				result.Region = matchProvince(normalizeWhois([]string{names["en"]}))
+			}
+		}
+		result.RegionDetail = "国家 " + rec.Country.IsoCode
+		if rec.Country.IsoCode == "" {
+			result.RegionDetail = "没有记录"
+		}
+	}
+	if db.asn != nil {
+		rec := &geoRecord{}
+		if err := db.asn.Lookup(ip, rec); err != nil {
+			return nil, err
+		}
+		result.IspDetail = "没有记录"
+		if rec.ASN != 0 {
+			result.Isp = asnIsps[rec.ASN]
+			if result.Isp == "" {
+				result.Isp = matchChinaIsp(normalizeWhois([]string{rec.ASOrg}))
+			}
+			result.IspDetail = fmt.Sprintf("AS%d %s", rec.ASN, rec.ASOrg)
+		}
+	}
+	return result, nil
+}
+
+func trimProvince(name string) string {
+	for _, suffix := range provinceSuffixes {
+		if trimmed := strings.TrimSuffix(name, suffix); trimmed != name {
+			return trimmed
+		}
+	}
+	return name
+}
+
+func isProvince(name string) bool {
+	for _, p := range whoisProvinces {
+		if p.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditIssue 配置检查发现的一个问题，Fix 为修正后配置中的处理方式
+type AuditIssue struct {
+	Kind   string
+	IP     string
+	Isp    string
+	Region string
+	Detail string
+	Fix    string
+}
+
+// auditEntry 配置中的一个条目
+type auditEntry struct {
+	ip, isp, region string
+	weight          float64 // 配置中的权重，0 为未指定；修正后的配置中随地址保留
+}
+
+// Audit 检查目标配置：无效地址、重复条目、与离线库不符的运营商/省份，以及（-probe 时）失效的地址，
+// 输出问题列表，并可将修正后的配置写入文件
+func Audit(opts AuditOptions) error {
+	catalog, notes, err := loadCatalog(opts.Catalog, opts.Overlay)
+	if err != nil {
+		return err
+	}
+	for _, note := range notes {
+		log.Printf("⚠️  %s\n", note)
+	}
+	source := "内置配置"
+	if opts.Catalog != "" {
+		source = opts.Catalog
+	}
+	if opts.Overlay != "" {
+		source += "（叠加 " + opts.Overlay + "）"
+	}
+	db, err := openGeoDB(opts.CityDB, opts.ASNDB)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// 按运营商、地区名称的固定顺序检查，输出稳定
+	var entries []auditEntry
+	all := ispRegions(catalog)
+	for _, isp := range []string{"电信", "联通", "移动"} {
+		var regions []string
+		for region := range all[isp] {
+			regions = append(regions, region)
+		}
+		sort.Strings(regions)
+		for _, region := range regions {
+			for _, ip := range all[isp][region].IPv4 {
+				entries = append(entries, auditEntry{ip: strings.TrimSpace(ip), isp: isp, region: region, weight: all[isp][region].Weights[ip]})
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("配置 %s 中没有条目，顶层应为 电信/联通/移动", source)
+	}
+	fmt.Fprintf(os.Stderr, "✅ 检查 %s：共 %d 个条目\n", source, len(entries))
+
+	var dead map[string]bool
+	if opts.Probe {
+		dead = probeDead(entries, opts.Count, opts.Concurrency)
+	}
+
+	var issues []*AuditIssue
+	report := func(e auditEntry, kind, detail, fix string) {
+		issues = append(issues, &AuditIssue{Kind: kind, IP: e.ip, Isp: e.isp, Region: e.region, Detail: detail, Fix: fix})
+	}
+	fixed := &DNSConfig{Dx: map[string]ProvinceConfig{}, Lt: map[string]ProvinceConfig{}, Yd: map[string]ProvinceConfig{}}
+	fixedRegions := ispRegions(fixed)
+	placed := make(map[string]auditEntry)
+	for _, e := range entries {
+		ip := net.ParseIP(e.ip)
+		if ip == nil || ip.To4() == nil {
+			report(e, "无效", "不是合法的 IPv4 地址", "删除")
+			continue
+		}
+		if dead[e.ip] {
+			report(e, "失效", fmt.Sprintf("%d 个包全部丢失", opts.Count), "删除")
+			continue
+		}
+		if prev, ok := placed[e.ip]; ok {
+			report(e, "重复", fmt.Sprintf("已出现在 %s/%s", prev.isp, prev.region), "删除")
+			continue
+		}
+
+		isp, region := e.isp, e.region
+		if db.city != nil || db.asn != nil {
+			geo, err := db.lookup(ip)
+			if err != nil {
+				return fmt.Errorf("查询离线库失败: %v", err)
+			}
+			if db.asn != nil && geo.Isp != e.isp {
+				if geo.Isp != "" {
+					isp = geo.Isp
+					report(e, "运营商不符", "离线库为 "+geo.IspDetail, "移到 "+geo.Isp)
+				} else {
+					report(e, "运营商不符", "离线库为 "+geo.IspDetail+"，不属于三家运营商", "保留")
+				}
+			}
+			if db.city != nil && geo.Region != e.region {
+				if geo.Region != "" {
+					region = geo.Region
+					report(e, "地区不符", "离线库为 "+geo.Region, "移到 "+geo.Region)
+				} else {
+					report(e, "地区不符", "离线库中没有省份信息（"+geo.RegionDetail+"）", "保留")
+				}
+			}
+		}
+
+		placed[e.ip] = e
+		list := fixedRegions[isp][region]
+		list.IPv4 = append(list.IPv4, e.ip)
+		if e.weight > 0 {
+			if list.Weights == nil {
+				list.Weights = make(map[string]float64)
+			}
+			list.Weights[e.ip] = e.weight
+		}
+		fixedRegions[isp][region] = list
+	}
+
+	printAuditIssues(issues)
+	fmt.Printf("共 %d 个条目，发现 %d 个问题，修正后保留 %d 个\n", len(entries), len(issues), len(placed))
+
+	if opts.OutPath != "" {
+		if err := saveCatalog(opts.OutPath, fixed); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "✅ 修正后的配置已保存到 %s\n", opts.OutPath)
+	}
+	return nil
+}
+
+// probeDead 并发探测全部地址，返回全部丢包的地址；探测出错的地址不视为失效
+func probeDead(entries []auditEntry, count int, concurrency int) map[string]bool {
+	dead := make(map[string]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		ip := net.ParseIP(e.ip)
+		if ip == nil || seen[e.ip] {
+			continue
+		}
+		seen[e.ip] = true
+		wg.Add(1)
+		go func(ip net.IP) {
+			sem <- struct{}{}
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			stats, err := icmpProber{}.Probe(ip, nil, count, AdaptiveOptions{})
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return
+			}
+			if stats.PacketsRecv == 0 {
+				mu.Lock()
+				dead[ip.String()] = true
+				mu.Unlock()
+			}
+		}(ip)
+	}
+	wg.Wait()
+	return dead
+}
+
+// printAuditIssues 输出问题列表
+func printAuditIssues(issues []*AuditIssue) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"问题", "IP", "运营商", "地区", "说明", "修正"})
+	table.SetAutoFormatHeaders(false)
+	table.SetAutoWrapText(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetBorder(false)
+	table.SetColumnSeparator(" ")
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	for _, issue := range issues {
+		table.Append([]string{issue.Kind, issue.IP, issue.Isp, issue.Region, issue.Detail, issue.Fix})
+	}
+	table.Render()
+}
@@ -0,0 +1,44 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	dir := t.TempDir()
+	catalog := filepath.Join(dir, "catalog.json")
+	content := `{
+		"电信": {"北京": {"IPv4": ["1.1.1.1", "bad", "1.1.1.1"]}, "上海": {"IPv4": ["2.2.2.2"]}},
+		"联通": {"北京": {"IPv4": ["2.2.2.2", "3.3.3.3"]}}
+	}`
+	if err := os.WriteFile(catalog, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "fixed.json")
+	if err := internal.Audit(internal.AuditOptions{Catalog: catalog, OutPath: out}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixed := &internal.DNSConfig{}
+	if err := json.Unmarshal(data, fixed); err != nil {
+		t.Fatal(err)
+	}
+	// 无效地址和重复地址被删除，跨运营商的重复保留先出现的一个
+	want := &internal.DNSConfig{
+		Dx: map[string]internal.ProvinceConfig{"北京": {IPv4: []string{"1.1.1.1"}}, "上海": {IPv4: []string{"2.2.2.2"}}},
+		Lt: map[string]internal.ProvinceConfig{"北京": {IPv4: []string{"3.3.3.3"}}},
+		Yd: map[string]internal.ProvinceConfig{},
+	}
+	if !reflect.DeepEqual(fixed, want) {
+		t.Errorf("修正后的配置不一致:\n实际 %+v\n期望 %+v", fixed, want)
+	}
+}
@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StoredResult 持久化后端保存的一条原始结果：一个目标的一个标签在一个源IP、一个探测方式下的一次探测
+type StoredResult struct {
+	RunID       string    `json:"run_id"`
+	Time        time.Time `json:"time"`
+	DestIP      string    `json:"dest_ip"`
+	Region      string    `json:"region"`
+	Isp         string    `json:"isp"`
+	Source      string    `json:"source,omitempty"`
+	Proto       string    `json:"proto,omitempty"`
+	Sent        int       `json:"sent"`
+	Recv        int       `json:"recv"`
+	LossPercent float64   `json:"loss_percent"`
+	MinRttMs    float64   `json:"min_rtt_ms,omitempty"`
+	AvgRttMs    float64   `json:"avg_rtt_ms,omitempty"`
+	MaxRttMs    float64   `json:"max_rtt_ms,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// StatsBackend 数据存储背后的持久化后端：PingStatsStore 在内存中汇总的同时把每条原始结果（包括全部丢包的）交给后端。
+// Save 只在汇总协程中调用，Flush 在每轮结果全部汇总后调用，此后才算持久化完成
+type StatsBackend interface {
+	Save(rec *StoredResult) error
+	Flush() error
+	Close() error
+}
+
+// storeSchemes -store 支持的后端，用于参数说明和错误提示
+const storeSchemes = "memory、file:目录、http(s)://地址"
+
+// OpenStatsBackend 按 -store 的值打开持久化后端：
+//   - memory（默认）：只在内存中汇总，不保存原始结果，占用最少
+//   - file:目录：每次运行一个 <运行ID>.jsonl 文件，每行一条结果，每轮结束时落盘，进程退出后可用于追溯
+//   - http(s)://地址：每轮结束时把本轮结果以 JSON 数组 POST 到该地址，由远端保存
+//
+// sqlite: 和 bolt: 需要额外的数据库驱动，当前构建未包含，返回错误；可用 file: 后端后再导入
+func OpenStatsBackend(spec string) (StatsBackend, error) {
+	scheme, rest, _ := strings.Cut(spec, ":")
+	switch scheme {
+	case "", "memory":
+		if rest != "" {
+			return nil, fmt.Errorf("-store memory 不需要参数，当前为 '%s'", spec)
+		}
+		return memoryBackend{}, nil
+	case "file":
+		if rest == "" {
+			return nil, fmt.Errorf("-store file: 需要指定目录，如 file:/var/lib/dping")
+		}
+		if err := os.MkdirAll(rest, 0o755); err != nil {
+			return nil, fmt.Errorf("创建结果目录 %s 失败: %v", rest, err)
+		}
+		return &fileBackend{dir: rest, runs: make(map[string]*fileRun)}, nil
+	case "http", "https":
+		if u, err := url.Parse(spec); err != nil || u.Host == "" {
+			return nil, fmt.Errorf("-store 远端地址无效: '%s'", spec)
+		}
+		return &remoteBackend{pusher: &pusher{urls: []string{spec}, retries: 2, client: &http.Client{Timeout: 10 * time.Second}}}, nil
+	case "sqlite", "bolt":
+		return nil, fmt.Errorf("-store %s: 当前构建未包含 %s 驱动，可使用 file: 后端", scheme, scheme)
+	}
+	return nil, fmt.Errorf("不支持的结果存储 -store '%s'，可选 %s", spec, storeSchemes)
+}
+
+// storedResult 由一条探测结果生成保存的记录，结果随后会被回收复用，记录不引用其中的字段
+func storedResult(runID string, stat *PingStatistic) *StoredResult {
+	rec := &StoredResult{RunID: runID, Time: time.Now(), DestIP: stat.DecIp, Region: stat.Region, Isp: stat.Isp,
+		Source: stat.SrcIp, Proto: stat.Proto, Error: stat.Err}
+	if s := stat.Statistic; s != nil {
+		rec.Sent, rec.Recv, rec.LossPercent = s.PacketsSent, s.PacketsRecv, s.PacketLoss
+		rec.MinRttMs = float64(s.MinRtt) / float64(time.Millisecond)
+		rec.AvgRttMs = float64(s.AvgRtt) / float64(time.Millisecond)
+		rec.MaxRttMs = float64(s.MaxRtt) / float64(time.Millisecond)
+	}
+	return rec
+}
+
+// memoryBackend 不保存原始结果，汇总数据只在进程内存中
+type memoryBackend struct{}
+
+func (memoryBackend) Save(*StoredResult) error { return nil }
+func (memoryBackend) Flush() error             { return nil }
+func (memoryBackend) Close() error             { return nil }
+
+// fileBackend 按运行ID追加写入 JSONL 文件，Flush 时写出缓冲区并 fsync
+type fileBackend struct {
+	dir  string
+	mu   sync.Mutex
+	runs map[string]*fileRun
+}
+
+// fileRun 一次运行的结果文件
+type fileRun struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+func (b *fileBackend) Save(rec *StoredResult) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	run := b.runs[rec.RunID]
+	if run == nil {
+		path := filepath.Join(b.dir, rec.RunID+".jsonl")
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("打开结果文件 %s 失败: %v", path, err)
+		}
+		run = &fileRun{f: f, w: bufio.NewWriter(f)}
+		b.runs[rec.RunID] = run
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = run.w.Write(append(data, '\n'))
+	return err
+}
+
+// Flush 写出并同步全部文件；每次运行的结果在该次运行结束时一次汇总完，同步后即关闭
+func (b *fileBackend) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for runID, run := range b.runs {
+		err := run.w.Flush()
+		if err == nil {
+			err = run.f.Sync()
+		}
+		run.f.Close()
+		delete(b.runs, runID)
+		if err != nil {
+			return fmt.Errorf("写入结果文件 %s 失败: %v", run.f.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (b *fileBackend) Close() error {
+	return b.Flush()
+}
+
+// remoteBackend 缓存本轮结果，Flush 时一次 POST 到远端，连接失败或 5xx 时重试
+type remoteBackend struct {
+	pusher  *pusher
+	mu      sync.Mutex
+	pending []*StoredResult
+}
+
+func (b *remoteBackend) Save(rec *StoredResult) error {
+	b.mu.Lock()
+	b.pending = append(b.pending, rec)
+	b.mu.Unlock()
+	return nil
+}
+
+// Flush 发送本轮缓存的结果，失败时丢弃，不影响后续各轮
+func (b *remoteBackend) Flush() error {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(pending)
+	if err != nil {
+		return err
+	}
+	return b.pusher.post(context.Background(), b.pusher.urls[0], body)
+}
+
+func (b *remoteBackend) Close() error {
+	return b.Flush()
+}
@@ -0,0 +1,265 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BatchFile 批量任务文件（YAML），parallel 为同时运行的任务数，0 或 1 时按顺序运行
+type BatchFile struct {
+	Parallel int         `yaml:"parallel"`
+	Jobs     []*BatchJob `yaml:"jobs"`
+}
+
+// BatchJob 单个任务的探测参数，字段名与命令行参数一致，未填写的字段使用命令行的默认值
+type BatchJob struct {
+	Name        string         `yaml:"name"`
+	Isp         string         `yaml:"isp"`
+	Region      string         `yaml:"dt"`
+	Count       int            `yaml:"p"`
+	Eth         string         `yaml:"eth"`
+	VRF         string         `yaml:"vrf"`
+	Netns       string         `yaml:"netns"`
+	Concurrency int            `yaml:"C"`
+	Jitter      *time.Duration `yaml:"jitter"`
+	Adaptive    bool           `yaml:"adaptive"`
+	MaxCount    int            `yaml:"pmax"`
+	CI          time.Duration  `yaml:"ci"`
+	Proto       string         `yaml:"proto"`
+	Port        int            `yaml:"port"`
+	Proxy       string         `yaml:"proxy"`
+	DNSQuery    string         `yaml:"dns-query"`
+	DNSECS      string         `yaml:"dns-ecs"`
+	DNSSEC      bool           `yaml:"dns-dnssec"`
+	PMTU        bool           `yaml:"pmtu"`
+	Pace        time.Duration  `yaml:"pace"`
+	File        string         `yaml:"f"`
+	Whois       bool           `yaml:"whois"`
+	Catalog     string         `yaml:"catalog"`
+	Overlay     string         `yaml:"overlay"`
+}
+
+// setDefaults 按命令行参数的默认值补全未填写的字段
+func (j *BatchJob) setDefaults(index int) {
+	if j.Name == "" {
+		j.Name = fmt.Sprintf("任务%d", index+1)
+	}
+	if j.Isp == "" {
+		j.Isp = "all"
+	}
+	if j.Region == "" {
+		j.Region = "全国"
+	}
+	if j.Count == 0 {
+		j.Count = 3
+	}
+	if j.Eth == "" {
+		j.Eth = "nil"
+	}
+	if j.Concurrency == 0 {
+		j.Concurrency = 50
+	}
+	if j.Jitter == nil {
+		jitter := 100 * time.Millisecond
+		j.Jitter = &jitter
+	}
+	if j.MaxCount == 0 {
+		j.MaxCount = 20
+	}
+	if j.CI == 0 {
+		j.CI = 2 * time.Millisecond
+	}
+	if j.Proto == "" {
+		j.Proto = "icmp"
+	}
+	if j.Port == 0 {
+		j.Port = 80
+		if port := DefaultPort(j.Proto); port > 0 {
+			j.Port = port
+		}
+	}
+}
+
+// options 任务的运行参数，sort、des 为命令行指定的排序方式
+func (j *BatchJob) options(sort string, des bool) Options {
+	return Options{Isp: j.Isp, Region: j.Region, MaxConcurrency: j.Concurrency, Count: j.Count, Eth: j.Eth, Sort: sort, Descending: des,
+		Jitter: *j.Jitter, Adaptive: j.adaptive(), Probe: j.probe(), Targets: j.targets()}
+}
+
+func (j *BatchJob) adaptive() AdaptiveOptions {
+	return AdaptiveOptions{Enabled: j.Adaptive, MaxCount: j.MaxCount, Threshold: j.CI}
+}
+
+func (j *BatchJob) probe() ProbeOptions {
+	return ProbeOptions{Proto: j.Proto, Port: j.Port, Proxy: j.Proxy, Pace: j.Pace, Query: j.DNSQuery, ECS: j.DNSECS, DNSSEC: j.DNSSEC, PMTU: j.PMTU, VRF: j.VRF, Netns: j.Netns}
+}
+
+func (j *BatchJob) targets() TargetOptions {
+	return TargetOptions{File: j.File, Whois: j.Whois, Catalog: j.Catalog, Overlay: j.Overlay}
+}
+
+// LoadBatch 读取批量任务文件，补全默认值并校验全部任务的参数；未知字段视为错误，避免拼错的参数被静默忽略
+func LoadBatch(path string) (*BatchFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取任务文件 %s 失败: %v", path, err)
+	}
+	batch := &BatchFile{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(batch); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("解析任务文件 %s 失败: %v", path, err)
+	}
+	if len(batch.Jobs) == 0 {
+		return nil, fmt.Errorf("任务文件 %s 中没有任务（jobs）", path)
+	}
+	if batch.Parallel < 0 {
+		return nil, fmt.Errorf("任务文件 %s 中 parallel 不能为负数，当前为 %d", path, batch.Parallel)
+	}
+	names := make(map[string]bool)
+	for i, job := range batch.Jobs {
+		if job == nil {
+			return nil, fmt.Errorf("任务文件 %s 中第 %d 个任务为空", path, i+1)
+		}
+		portSet := job.Port != 0
+		job.setDefaults(i)
+		if names[job.Name] {
+			return nil, fmt.Errorf("任务文件 %s 中任务名 '%s' 重复", path, job.Name)
+		}
+		names[job.Name] = true
+		if portSet && DefaultPort(job.Proto) == 0 {
+			return nil, fmt.Errorf("任务 %s：port 只在 proto 为 dns、tcp、http 或 https 时生效，多个探测方式时用 tcp:53 的形式指定", job.Name)
+		}
+		// 排序字段由命令行统一指定，这里只校验任务自身的探测参数
+		if err := ValidateParams(job.Isp, job.Region, job.Concurrency, job.Count, *job.Jitter, job.adaptive(), job.probe(), job.targets(), "loss"); err != nil {
+			return nil, fmt.Errorf("任务 %s：%v", job.Name, err)
+		}
+	}
+	return batch, nil
+}
+
+// BatchReport 批量任务的合并结果，-format json 和 -out 输出该格式
+type BatchReport struct {
+	SchemaVersion int               `json:"schema_version"`
+	CreatedAt     time.Time         `json:"created_at"`
+	Jobs          []*BatchJobResult `json:"jobs"`
+}
+
+// BatchJobResult 单个任务的结果，任务无法开始探测时只有 error
+type BatchJobResult struct {
+	Name   string     `json:"name"`
+	Proto  string     `json:"proto"`
+	Error  string     `json:"error,omitempty"`
+	Result *Snapshot  `json:"result,omitempty"`
+	run    *RunResult // 供 table、template 格式逐节输出
+}
+
+// RunBatch 运行任务文件中的全部任务，按任务顺序输出一份合并的报告；
+// 单个任务失败时记录错误并继续运行其余任务
+func RunBatch(path string, sort string, des bool, output OutputOptions) error {
+	if err := ValidateSort(sort); err != nil {
+		return err
+	}
+	if output.Format == "csv" || output.Format == "html" {
+		return fmt.Errorf("批量任务只支持 table|json|template 格式，当前为 %s", output.Format)
+	}
+	renderer, err := newRenderer(output)
+	if err != nil {
+		return err
+	}
+	batch, err := LoadBatch(path)
+	if err != nil {
+		return err
+	}
+	parallel := max(batch.Parallel, 1)
+	fmt.Fprintf(os.Stderr, "✅ 共 %d 个任务，同时运行 %d 个\n", len(batch.Jobs), parallel)
+
+	report := &BatchReport{SchemaVersion: SchemaVersion, CreatedAt: time.Now()}
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for _, job := range batch.Jobs {
+		result := &BatchJobResult{Name: job.Name, Proto: job.Proto}
+		report.Jobs = append(report.Jobs, result)
+		wg.Add(1)
+		go func(job *BatchJob) {
+			sem <- struct{}{}
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fmt.Fprintf(os.Stderr, "✅ 开始任务 %s\n", job.Name)
+			cfg, targets, prober, err := prepareRun(job.options(sort, des))
+			if err != nil {
+				log.Printf("⚠️  任务 %s 失败: %v\n", job.Name, err)
+				result.Error = err.Error()
+				return
+			}
+			cfg.output, cfg.renderer = output, renderer
+			result.run = collect(cfg, targets, prober)
+			result.Result = result.run.Snapshot
+		}(job)
+	}
+	wg.Wait()
+
+	var buf bytes.Buffer
+	if err := renderBatch(&buf, renderer, report); err != nil {
+		log.Printf("⚠️  输出结果失败: %v\n", err)
+	} else if err := writePaged(buf.Bytes(), output.NoPager); err != nil {
+		log.Printf("⚠️  输出结果失败: %v\n", err)
+	}
+	if output.OutPath != "" {
+		if err := saveBatchReport(output.OutPath, report); err != nil {
+			log.Printf("⚠️  %v\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "✅ 结果已保存到 %s\n", output.OutPath)
+		}
+	}
+	return nil
+}
+
+// renderBatch json 格式输出合并结果，其余格式按任务顺序逐节输出
+func renderBatch(w io.Writer, renderer Renderer, report *BatchReport) error {
+	if _, ok := renderer.(jsonRenderer); ok {
+		return writeBatchReport(w, report)
+	}
+	for _, job := range report.Jobs {
+		fmt.Fprintf(w, "###### 任务 %s（%s）######\n", job.Name, job.Proto)
+		if job.Error != "" {
+			fmt.Fprintf(w, "❌ 失败: %s\n\n", job.Error)
+			continue
+		}
+		if err := renderer.Render(w, job.run); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+func writeBatchReport(w io.Writer, report *BatchReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// saveBatchReport 将合并结果以 JSON 格式写入文件
+func saveBatchReport(path string, report *BatchReport) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建结果文件 %s 失败: %v", path, err)
+	}
+	defer f.Close()
+	if err := writeBatchReport(f, report); err != nil {
+		return fmt.Errorf("写入结果文件 %s 失败: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package internal_test
+
+import (
+	"crypto/ed25519"
+	"dping/internal"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadBatch(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	batch, err := internal.LoadBatch(write("jobs.yaml", `
+parallel: 2
+jobs:
+  - isp: 电信
+    dt: 北京
+  - name: https
+    proto: https
+    jitter: 0s
+    pace: 30s
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Parallel != 2 || len(batch.Jobs) != 2 {
+		t.Fatalf("任务文件解析不一致: parallel=%d jobs=%d", batch.Parallel, len(batch.Jobs))
+	}
+	// 未填写的字段与命令行参数的默认值一致
+	first := batch.Jobs[0]
+	if first.Name != "任务1" || first.Count != 3 || first.Concurrency != 50 || first.Eth != "nil" || *first.Jitter != 100*time.Millisecond || first.Proto != "icmp" {
+		t.Errorf("第1个任务默认值不一致: %+v", first)
+	}
+	second := batch.Jobs[1]
+	if second.Isp != "all" || second.Region != "全国" || second.Port != 443 || *second.Jitter != 0 || second.Pace != 30*time.Second {
+		t.Errorf("第2个任务默认值不一致: %+v", second)
+	}
+
+	for name, c := range map[string]struct{ content, want string }{
+		"unknown.yaml":   {"jobs:\n  - cnt: 3\n", "field cnt not found"},
+		"empty.yaml":     {"parallel: 1\n", "没有任务"},
+		"duplicate.yaml": {"jobs:\n  - name: a\n  - name: a\n", "重复"},
+		"port.yaml":      {"jobs:\n  - port: 8080\n", "port 只在"},
+		"isp.yaml":       {"jobs:\n  - isp: 广电\n", "不支持的运营商"},
+		"pace.yaml":      {"jobs:\n  - p: 10\n    pace: 50ms\n", "小于最小间隔"},
+	} {
+		_, err := internal.LoadBatch(write(name, c.content))
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s 应返回包含 '%s' 的错误，实际为 %v", name, c.want, err)
+		}
+	}
+}
+
+func TestLoadTenants(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	file, err := internal.LoadTenants(write("tenants.yaml", `
+listen: 127.0.0.1:0
+tenants:
+  - name: netops
+    token: a
+    isp: 电信
+    rate: 100
+    history: netops.jsonl
+    alert-loss: 20
+    alert-webhook: http://127.0.0.1:9/hook
+  - name: sre
+    token: b
+    watch: 5m
+    proto: tcp
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	netops, sre := file.Tenants[0], file.Tenants[1]
+	if netops.Watch != time.Minute || netops.Count != 3 || netops.Rate != 100 || netops.Region != "全国" {
+		t.Errorf("租户 netops 默认值不一致: %+v", netops)
+	}
+	if sre.Watch != 5*time.Minute || sre.Port != 80 || sre.Isp != "all" {
+		t.Errorf("租户 sre 默认值不一致: %+v", sre)
+	}
+
+	for name, c := range map[string]struct{ content, want string }{
+		"token.yaml":      {"listen: :8080\ntenants:\n  - name: a\n", "需要 token"},
+		"name.yaml":       {"tenants:\n  - isp: 电信\n", "name 为空"},
+		"path.yaml":       {"tenants:\n  - name: a/b\n", "name 为空或含有"},
+		"duplicate.yaml":  {"tenants:\n  - name: a\n  - name: a\n", "重复"},
+		"output.yaml":     {"tenants:\n  - name: a\n    out: r.json\n  - name: b\n    history: r.json\n", "结果文件都是"},
+		"rate.yaml":       {"tenants:\n  - name: a\n    rate: -1\n", "rate 不能为负数"},
+		"watch.yaml":      {"tenants:\n  - name: a\n    watch: 1ms\n", "不能小于"},
+		"unknown.yaml":    {"tenants:\n  - name: a\n    tokn: x\n", "field tokn not found"},
+		"tls-key.yaml":    {"listen: :8443\ntls-cert: c.pem\ntenants:\n  - name: a\n    token: x\n", "tls-cert 和 tls-key 需要同时指定"},
+		"client-ca.yaml":  {"listen: :8443\nclient-ca: ca.pem\ntenants:\n  - name: a\n    token: x\n", "client-ca 需要同时指定"},
+		"tls-listen.yaml": {"tls-cert: c.pem\ntls-key: k.pem\ntenants:\n  - name: a\n", "需要同时指定 listen"},
+	} {
+		_, err := internal.LoadTenants(write(name, c.content))
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s 应返回包含 '%s' 的错误，实际为 %v", name, c.want, err)
+		}
+	}
+}
+
+func TestAccept(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	criteria := write("criteria.yaml", `
+name: 测试线路
+circuit: TEST-001
+plan:
+  dt: testset
+  p: 2
+criteria:
+  - loss: 0
+    p95_rtt: 50ms
+    target_loss: 0
+  - name: 时延不可能达标
+    isp: 电信
+    avg_rtt: 1ns
+`)
+	out := filepath.Join(dir, "accept.json")
+	report, err := internal.Accept(internal.AcceptOptions{Criteria: criteria, SignKey: key, Out: out, HTML: filepath.Join(dir, "accept.html")})
+	if err == nil || report == nil || report.Passed {
+		t.Fatalf("有指标未达标时验收应不通过: %v", err)
+	}
+	var failed []string
+	for _, c := range report.Checks {
+		if !c.Passed {
+			failed = append(failed, c.Criterion+" "+c.Metric)
+		}
+	}
+	if len(report.Checks) != 4 || strings.Join(failed, ",") != "时延不可能达标 avg_rtt" || len(report.Rounds) != 1 {
+		t.Errorf("检查结果不一致: %d 项，未通过 %v，%d 轮", len(report.Checks), failed, len(report.Rounds))
+	}
+	html, _ := os.ReadFile(filepath.Join(dir, "accept.html"))
+	if !strings.Contains(string(html), "未通过（4 项指标中 1 项未达标）") || !strings.Contains(string(html), report.Signature.KeyID) {
+		t.Error("HTML 证书中没有结论或签名密钥")
+	}
+
+	if err := internal.Verify([]string{out}, key.Public().(ed25519.PublicKey)); err != nil {
+		t.Errorf("验收报告应签名有效: %v", err)
+	}
+	data, _ := os.ReadFile(out)
+	if err := os.WriteFile(out, []byte(strings.Replace(string(data), `"passed": false`, `"passed": true`, 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.Verify([]string{out}, nil); err == nil {
+		t.Error("修改过结论的验收报告应校验失败")
+	}
+
+	for name, c := range map[string]struct{ content, want string }{
+		"noname.yaml":   {"criteria:\n  - loss: 1\n", "没有验收名称"},
+		"nolimit.yaml":  {"name: a\ncriteria:\n  - isp: 电信\n", "没有任何上限"},
+		"unknown.yaml":  {"name: a\ncriteria:\n  - rtt: 10ms\n", "field rtt not found"},
+		"multi.yaml":    {"name: a\nplan:\n  proto: icmp,dns\ncriteria:\n  - loss: 1\n", "只支持一种探测方式"},
+		"loss.yaml":     {"name: a\ncriteria:\n  - target_loss: 120\n", "0 到 100"},
+		"nocheck.yaml":  {"name: a\n", "没有验收指标"},
+		"badplan.yaml":  {"name: a\nplan:\n  isp: 广电\ncriteria:\n  - loss: 1\n", "不支持的运营商"},
+		"negative.yaml": {"name: a\nrounds: -1\ncriteria:\n  - loss: 1\n", "不能为负数"},
+	} {
+		_, _, err := internal.LoadAcceptFile(write(name, c.content))
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s 应返回包含 '%s' 的错误，实际为 %v", name, c.want, err)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+// loadResults 负载测试的结果数，与全国目标 × 多轮持续监控的规模相当
+const loadResults = 100000
+
+// syntheticProber 不发包的探测器，按目标 IP 生成固定随机种子的统计结果，用于压测汇总流程
+type syntheticProber struct{}
+
+func (p syntheticProber) Probe(to net.IP, sourceIP net.IP, count int, adaptive internal.AdaptiveOptions) (*ping.Statistics, error) {
+	ip := to.To4()
+	r := rand.New(rand.NewPCG(uint64(ip[2])<<8|uint64(ip[3]), uint64(count)))
+	recv := count - r.IntN(2)
+	base := time.Duration(5+r.IntN(60)) * time.Millisecond
+	rtts := make([]time.Duration, recv)
+	for i := range rtts {
+		rtts[i] = base + time.Duration(r.IntN(5000))*time.Microsecond
+	}
+	stats := &ping.Statistics{
+		PacketsSent: count,
+		PacketsRecv: recv,
+		PacketLoss:  float64(count-recv) / float64(count) * 100,
+		Addr:        to.String(),
+		Rtts:        rtts,
+	}
+	if recv > 0 {
+		stats.MinRtt, stats.MaxRtt, stats.AvgRtt = base, base+5*time.Millisecond, base+2500*time.Microsecond
+	}
+	return stats, nil
+}
+
+// syntheticTargets 生成 n 个目标及其标签，运营商和地区轮流分配
+func syntheticTargets(n int) ([]net.IP, []internal.TargetLabel) {
+	isps := []string{"电信", "联通", "移动"}
+	ips := make([]net.IP, n)
+	labels := make([]internal.TargetLabel, n)
+	for i := range ips {
+		ips[i] = net.IPv4(10, byte(i>>16), byte(i>>8), byte(i))
+		labels[i] = internal.TargetLabel{Isp: isps[i%len(isps)], Region: fmt.Sprintf("地区%d", i%31)}
+	}
+	return ips, labels
+}
+
+// syntheticStats 生成 results 条分布在 targets 个目标上的探测结果
+func syntheticStats(results int, targets int) []*internal.PingStatistic {
+	ips, labels := syntheticTargets(targets)
+	prober := syntheticProber{}
+	stats := make([]*internal.PingStatistic, results)
+	for i := range stats {
+		t := i % targets
+		s, _ := prober.Probe(ips[t], nil, 3, internal.AdaptiveOptions{})
+		stats[i] = &internal.PingStatistic{DecIp: ips[t].String(), Region: labels[t].Region, Isp: labels[t].Isp, Statistic: s}
+	}
+	return stats
+}
+
+// silenceStderr 压测期间丢弃进度输出，避免终端输出成为瓶颈
+func silenceStderr(b *testing.B) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = devNull
+	b.Cleanup(func() {
+		os.Stderr = stderr
+		devNull.Close()
+	})
+}
+
+func BenchmarkStoreAdd(b *testing.B) {
+	stats := syntheticStats(loadResults, 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		store := internal.NewPingStatsStore(25)
+		for _, s := range stats {
+			store.Add(s)
+		}
+	}
+}
+
+// BenchmarkStoreAddParallel 多个生产者同时写入，衡量锁竞争
+func BenchmarkStoreAddParallel(b *testing.B) {
+	stats := syntheticStats(loadResults, 1000)
+	store := internal.NewPingStatsStore(25)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := rand.IntN(len(stats))
+		for pb.Next() {
+			store.Add(stats[i%len(stats)])
+			i++
+		}
+	})
+}
+
+func BenchmarkGetSummarySorted(b *testing.B) {
+	for _, targets := range []int{1000, 10000} {
+		store := internal.NewPingStatsStore(25)
+		for _, s := range syntheticStats(targets, targets) {
+			store.Add(s)
+		}
+		for _, field := range []string{"loss", "avgrtt"} {
+			b.Run(fmt.Sprintf("%s/%d", field, targets), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					store.GetSummarySorted(field, false)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkPipeline 与实际运行相同的流程：50 个并发探测经通道交给 HandleDPing 汇总，共 100k 条结果
+func BenchmarkPipeline(b *testing.B) {
+	silenceStderr(b)
+	const targets = 1000
+	ips, labels := syntheticTargets(targets)
+	prober := syntheticProber{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		store := internal.NewPingStatsStore(25)
+		ch := make(chan *internal.PingStatistic, 20)
+		var wg, wgHandle sync.WaitGroup
+		wgHandle.Add(1)
+		go internal.HandleDPing(ch, store, &wgHandle, "loss", false)
+
+		sem := make(chan struct{}, 50)
+		for n := 0; n < loadResults; n++ {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(t int) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				s, _ := prober.Probe(ips[t], nil, 3, internal.AdaptiveOptions{})
+				ch <- &internal.PingStatistic{DecIp: ips[t].String(), Region: labels[t].Region, Isp: labels[t].Isp, Statistic: s}
+			}(n % targets)
+		}
+		wg.Wait()
+		close(ch)
+		wgHandle.Wait()
+
+		// 每个目标都应收到 loadResults/targets 轮结果
+		list := store.GetSummarySorted("loss", false)
+		if len(list) != targets || list[0].TotalSent != 3*loadResults/targets {
+			b.Fatalf("汇总结果不一致: %d 个目标，首个目标发包 %d", len(list), list[0].TotalSent)
+		}
+	}
+}
+
+// BenchmarkStoreAddWithReader 多个生产者写入的同时，交互界面每毫秒读取一次排序结果
+func BenchmarkStoreAddWithReader(b *testing.B) {
+	stats := syntheticStats(loadResults, 1000)
+	store := internal.NewPingStatsStore(25)
+	for _, s := range stats[:1000] {
+		store.Add(s)
+	}
+	done := make(chan struct{})
+	var reads sync.WaitGroup
+	reads.Add(1)
+	go func() {
+		defer reads.Done()
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				store.GetSummarySorted("loss", false)
+			case <-done:
+				return
+			}
+		}
+	}()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := rand.IntN(len(stats))
+		for pb.Next() {
+			store.Add(stats[i%len(stats)])
+			i++
+		}
+	})
+	b.StopTimer()
+	close(done)
+	reads.Wait()
+}
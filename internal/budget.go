@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// Budget 应用类型的时延预算：平均 RTT、抖动（RTT 标准差）和丢包率都在预算内才算达标
+type Budget struct {
+	Name      string
+	MaxRtt    time.Duration
+	MaxJitter time.Duration
+	MaxLoss   float64 // 百分比
+}
+
+// budgets 内置的应用类型预算
+var budgets = map[string]Budget{
+	"voip":   {Name: "voip", MaxRtt: 150 * time.Millisecond, MaxJitter: 30 * time.Millisecond, MaxLoss: 1},
+	"gaming": {Name: "gaming", MaxRtt: 80 * time.Millisecond, MaxJitter: 20 * time.Millisecond, MaxLoss: 1},
+	"web":    {Name: "web", MaxRtt: 300 * time.Millisecond, MaxJitter: 100 * time.Millisecond, MaxLoss: 2},
+}
+
+// budgetNames 返回按名称排序的预算列表，用于提示
+func budgetNames() string {
+	var names []string
+	for name := range budgets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "|")
+}
+
+// lookupBudget 按名称查找预算，名称为空时返回 nil
+func lookupBudget(name string) (*Budget, error) {
+	if name == "" {
+		return nil, nil
+	}
+	b, ok := budgets[name]
+	if !ok {
+		return nil, fmt.Errorf("不支持的时延预算 -budget '%s'，可选 %s", name, budgetNames())
+	}
+	return &b, nil
+}
+
+// violations 返回超出预算的指标，全部达标时为空
+func (b *Budget) violations(sum *SummaryStatistic) []string {
+	var over []string
+	if sum.AvgRtt >= b.MaxRtt {
+		over = append(over, "RTT")
+	}
+	if sum.StdDevRtt >= b.MaxJitter {
+		over = append(over, "抖动")
+	}
+	if sum.PacketLoss >= b.MaxLoss {
+		over = append(over, "丢包")
+	}
+	return over
+}
+
+// BudgetResult 时延预算评估结果，写入快照
+type BudgetResult struct {
+	Name        string          `json:"name"`
+	MaxRttMs    float64         `json:"max_rtt_ms"`
+	MaxJitterMs float64         `json:"max_jitter_ms"`
+	MaxLoss     float64         `json:"max_loss_percent"`
+	Isps        []BudgetIspPass `json:"isps"`
+}
+
+// BudgetIspPass 单个运营商的达标情况，同一运营商下的同一 IP 只计一次，多源探测时每个源分别计数
+type BudgetIspPass struct {
+	Isp         string  `json:"isp"`
+	Targets     int     `json:"targets"`
+	Passed      int     `json:"passed"`
+	PassPercent float64 `json:"pass_percent"`
+}
+
+// evaluateBudget 评估全部结果：标记每行是否达标，并按运营商统计达标率
+func evaluateBudget(b *Budget, snap *Snapshot) *BudgetResult {
+	result := &BudgetResult{
+		Name:        b.Name,
+		MaxRttMs:    durationToMs(b.MaxRtt),
+		MaxJitterMs: durationToMs(b.MaxJitter),
+		MaxLoss:     b.MaxLoss,
+	}
+	perIsp := make(map[string]*BudgetIspPass)
+	seen := make(map[string]bool)
+	for _, row := range snap.Rows {
+		pass := len(b.violations(row.Summary())) == 0
+		row.BudgetPass = &pass
+
+		key := row.Isp + "|" + row.DestIP + "|" + row.Source
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		isp, ok := perIsp[row.Isp]
+		if !ok {
+			isp = &BudgetIspPass{Isp: row.Isp}
+			perIsp[row.Isp] = isp
+		}
+		isp.Targets++
+		if pass {
+			isp.Passed++
+		}
+	}
+	for _, isp := range perIsp {
+		isp.PassPercent = float64(isp.Passed) / float64(isp.Targets) * 100
+		result.Isps = append(result.Isps, *isp)
+	}
+	sort.Slice(result.Isps, func(i, j int) bool { return result.Isps[i].Isp < result.Isps[j].Isp })
+	return result
+}
+
+// printBudget 输出各运营商的达标率
+func (r *TableRenderer) printBudget(w io.Writer, result *BudgetResult) {
+	fmt.Fprintf(w, "====== 时延预算评估 %s（RTT<%.0fms 抖动<%.0fms 丢包<%.0f%%）======\n",
+		result.Name, result.MaxRttMs, result.MaxJitterMs, result.MaxLoss)
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"运营商", "目标数", "达标", "达标率"})
+	table.SetAutoFormatHeaders(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetBorder(false)
+	table.SetColumnSeparator(" ")
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	for _, isp := range result.Isps {
+		// 达标率按丢包的配色规则着色：未达标比例低于告警阈值为正常
+		percent := fmt.Sprintf("%.1f%%", isp.PassPercent)
+		table.Append([]string{
+			r.Theme.color(r.Theme.colorForISP(isp.Isp), isp.Isp),
+			fmt.Sprintf("%d", isp.Targets),
+			fmt.Sprintf("%d", isp.Passed),
+			r.Theme.packetLoss(100-isp.PassPercent, r.Loss, percent),
+		})
+	}
+	table.Render()
+}
@@ -0,0 +1,99 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLookupBudget(t *testing.T) {
+	if b, err := internal.LookupBudget(""); b != nil || err != nil {
+		t.Errorf("未指定时应为 nil，实际为 %v %v", b, err)
+	}
+	b, err := internal.LookupBudget("voip")
+	if err != nil || b.Name != "voip" || b.MaxRtt != 150*time.Millisecond || b.MaxJitter != 30*time.Millisecond || b.MaxLoss != 1 {
+		t.Errorf("voip 预算应为 150ms/30ms/1%%，实际为 %+v %v", b, err)
+	}
+	// 返回的是副本，修改不影响内置预算
+	b.MaxRtt = time.Hour
+	if again, _ := internal.LookupBudget("voip"); again.MaxRtt != 150*time.Millisecond {
+		t.Errorf("修改查到的预算不应影响内置预算，实际为 %v", again.MaxRtt)
+	}
+
+	_, err = internal.LookupBudget("video")
+	if err == nil || !strings.Contains(err.Error(), "'video'") || !strings.Contains(err.Error(), "gaming|voip|web") {
+		t.Errorf("不支持的预算应报错并列出可选项，实际为 %v", err)
+	}
+}
+
+func TestBudgetViolations(t *testing.T) {
+	b, _ := internal.LookupBudget("gaming") // RTT 80ms，抖动 20ms，丢包 1%
+	for _, c := range []struct {
+		name        string
+		rtt, jitter time.Duration
+		loss        float64
+		want        []string
+	}{
+		{"全部在预算内", 79 * time.Millisecond, 19 * time.Millisecond, 0.9, nil},
+		{"RTT 等于预算", 80 * time.Millisecond, 0, 0, []string{"RTT"}},
+		{"RTT 超出预算", 81 * time.Millisecond, 0, 0, []string{"RTT"}},
+		{"抖动等于预算", 10 * time.Millisecond, 20 * time.Millisecond, 0, []string{"抖动"}},
+		{"抖动超出预算", 10 * time.Millisecond, 35 * time.Millisecond, 0, []string{"抖动"}},
+		{"丢包等于预算", 10 * time.Millisecond, 0, 1, []string{"丢包"}},
+		{"丢包超出预算", 10 * time.Millisecond, 0, 25, []string{"丢包"}},
+		{"全部超出预算", 200 * time.Millisecond, 50 * time.Millisecond, 5, []string{"RTT", "抖动", "丢包"}},
+	} {
+		sum := &internal.SummaryStatistic{AvgRtt: c.rtt, StdDevRtt: c.jitter, PacketLoss: c.loss}
+		if got := internal.BudgetViolations(b, sum); !slices.Equal(got, c.want) {
+			t.Errorf("%s: 超出预算的指标应为 %v，实际为 %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestEvaluateBudget(t *testing.T) {
+	b, _ := internal.LookupBudget("voip")
+	snap := &internal.Snapshot{
+		Rows: []*internal.SnapshotRow{
+			{DestIP: "1.1.1.1", Isp: "电信", Region: "北京", Sent: 10, Recv: 10, AvgRttMs: 20, StdDevRttMs: 2},
+			// 同一 IP 出现在多个地区时只计一次
+			{DestIP: "1.1.1.1", Isp: "电信", Region: "天津", Sent: 10, Recv: 10, AvgRttMs: 20, StdDevRttMs: 2},
+			{DestIP: "2.2.2.2", Isp: "电信", Region: "上海", Sent: 10, Recv: 10, AvgRttMs: 150, StdDevRttMs: 2},
+			{DestIP: "3.3.3.3", Isp: "联通", Region: "北京", Sent: 10, Recv: 10, AvgRttMs: 30, StdDevRttMs: 30},
+			// 多源探测时每个源分别计数
+			{DestIP: "4.4.4.4", Isp: "移动", Region: "广东", Source: "10.0.0.1", Sent: 100, Recv: 99, LossPercent: 1, AvgRttMs: 30},
+			{DestIP: "4.4.4.4", Isp: "移动", Region: "广东", Source: "10.0.0.2", Sent: 100, Recv: 100, AvgRttMs: 30},
+		},
+		// 全部丢包的目标不计入达标率
+		Unanswered: []*internal.SnapshotRow{
+			{DestIP: "5.5.5.5", Isp: "联通", Region: "上海", Sent: 10, LossPercent: 100},
+		},
+	}
+	result := internal.EvaluateBudget(b, snap)
+	if result.Name != "voip" || result.MaxRttMs != 150 || result.MaxJitterMs != 30 || result.MaxLoss != 1 {
+		t.Errorf("预算参数有误: %+v", result)
+	}
+	want := []internal.BudgetIspPass{
+		{Isp: "电信", Targets: 2, Passed: 1, PassPercent: 50},
+		{Isp: "移动", Targets: 2, Passed: 1, PassPercent: 50},
+		{Isp: "联通", Targets: 1, Passed: 0, PassPercent: 0},
+	}
+	if !slices.Equal(result.Isps, want) {
+		t.Errorf("各运营商的达标情况应为 %+v，实际为 %+v", want, result.Isps)
+	}
+	for _, c := range []struct {
+		row  *internal.SnapshotRow
+		pass bool
+	}{
+		{snap.Rows[0], true}, {snap.Rows[1], true}, {snap.Rows[2], false}, {snap.Rows[3], false},
+		{snap.Rows[4], false}, {snap.Rows[5], true},
+	} {
+		if c.row.BudgetPass == nil || *c.row.BudgetPass != c.pass {
+			t.Errorf("%s（%s %s）是否达标应为 %v，实际为 %v", c.row.DestIP, c.row.Region, c.row.Source, c.pass, c.row.BudgetPass)
+		}
+	}
+	if snap.Unanswered[0].BudgetPass != nil {
+		t.Error("全部丢包的目标不应标记是否达标")
+	}
+}
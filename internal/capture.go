@@ -0,0 +1,255 @@
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-ping/ping"
+	"golang.org/x/net/bpf"
+)
+
+const (
+	defaultCaptureLoss = 20.0                   // 未指定 -capture-loss 时触发抓包的丢包率（%）
+	captureLinger      = 500 * time.Millisecond // 重新探测结束后继续抓包的时长，收下迟到的应答和 ICMP 差错
+	captureParallel    = 4                      // 同时抓包的目标数：每个抓包占用一个原始套接字和一个 pcap 文件
+)
+
+// captureSlots 限制同时进行的抓包，所有探测方式共用
+var captureSlots = make(chan struct{}, captureParallel)
+
+// captureProber 包装真实 Prober，丢包率达到 -capture-loss 的目标在抓包的同时重新探测一次（-capture-on-loss），
+// 把与目标相关的数据包写入 pcap 文件，便于向运营商报障；表格中仍为第一次探测的结果
+type captureProber struct {
+	Prober
+	dir   string
+	loss  float64
+	label string // 文件名中的探测方式
+}
+
+// withCapture 指定 -capture-on-loss 时为 Prober 加上丢包抓包
+func (o ProbeOptions) withCapture(prober Prober) Prober {
+	if o.CaptureDir == "" {
+		return prober
+	}
+	label := o.Proto
+	if label == "" {
+		label = "icmp"
+	}
+	if DefaultPort(label) != 0 && o.Port != DefaultPort(label) {
+		label = fmt.Sprintf("%s-%d", label, o.Port)
+	}
+	loss := o.CaptureLoss
+	if loss == 0 {
+		loss = defaultCaptureLoss
+	}
+	return &captureProber{Prober: prober, dir: o.CaptureDir, loss: loss, label: label}
+}
+
+func (p *captureProber) Probe(to net.IP, sourceIP net.IP, count int, adaptive AdaptiveOptions) (*ping.Statistics, error) {
+	stats, err := p.Prober.Probe(to, sourceIP, count, adaptive)
+	if err != nil || stats.PacketLoss < p.loss {
+		return stats, err
+	}
+	captureSlots <- struct{}{}
+	defer func() { <-captureSlots }()
+	path, packets, captureErr := p.capture(to, sourceIP, count, adaptive)
+	if captureErr != nil {
+		log.Printf("⚠️  目标 %s 丢包 %.0f%%，抓包失败: %v\n", to, stats.PacketLoss, captureErr)
+	} else {
+		fmt.Fprintf(os.Stderr, "✅ 目标 %s 丢包 %.0f%%，重新探测的数据包（%d 个）已保存到 %s\n", to, stats.PacketLoss, packets, path)
+	}
+	return stats, nil
+}
+
+// Details 透传被包装 Prober 的附加结果；抓包时重新探测过的目标为重新探测的附加结果
+func (p *captureProber) Details(to net.IP, sourceIP net.IP) *ProbeDetails {
+	if ds, ok := p.Prober.(detailSource); ok {
+		return ds.Details(to, sourceIP)
+	}
+	return nil
+}
+
+// capture 开始抓包后重新探测目标，返回 pcap 文件路径和写入的包数
+func (p *captureProber) capture(to net.IP, sourceIP net.IP, count int, adaptive AdaptiveOptions) (string, int, error) {
+	if err := os.MkdirAll(p.dir, 0o755); err != nil {
+		return "", 0, err
+	}
+	path := filepath.Join(p.dir, captureFileName(time.Now(), to, sourceIP, p.label))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	w, err := newPcapWriter(f)
+	if err != nil {
+		return "", 0, err
+	}
+	c, err := startCapture(to, w)
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", 0, err
+	}
+	p.Prober.Probe(to, sourceIP, count, adaptive)
+	time.Sleep(captureLinger)
+	packets, err := c.stop()
+	if err != nil {
+		return "", 0, err
+	}
+	return path, packets, f.Close()
+}
+
+// captureFileName 抓包文件名：时间-目标-探测方式[-端口][-from-源IP].pcap，IPv6 地址中的冒号替换为下划线
+func captureFileName(now time.Time, to net.IP, sourceIP net.IP, label string) string {
+	name := now.Format("20060102-150405") + "-" + to.String() + "-" + label
+	if sourceIP != nil {
+		name += "-from-" + sourceIP.String()
+	}
+	return strings.ReplaceAll(name, ":", "_") + ".pcap"
+}
+
+// capturedPacket 判断 IP 包是否与目标相关：源或目的地址为目标，或是途经路由器返回的、原始包发往目标的 ICMP 差错
+// （不可达、超时等），后者能说明包在哪一跳被丢弃
+func capturedPacket(pkt []byte, target net.IP) bool {
+	if len(pkt) == 0 {
+		return false
+	}
+	switch pkt[0] >> 4 {
+	case 4:
+		t4 := target.To4()
+		ihl := int(pkt[0]&0x0f) * 4
+		if t4 == nil || len(pkt) < 20 || ihl < 20 || len(pkt) < ihl {
+			return false
+		}
+		if net.IP(pkt[12:16]).Equal(t4) || net.IP(pkt[16:20]).Equal(t4) {
+			return true
+		}
+		// ICMP 差错：目的不可达、超时、参数问题，8 字节 ICMP 头之后是原始包的 IP 头
+		inner := pkt[ihl:]
+		return pkt[9] == 1 && len(inner) >= 8+20 && (inner[0] == 3 || inner[0] == 11 || inner[0] == 12) &&
+			net.IP(inner[8+16:8+20]).Equal(t4)
+	case 6:
+		if target.To4() != nil || len(pkt) < 40 {
+			return false
+		}
+		if net.IP(pkt[8:24]).Equal(target) || net.IP(pkt[24:40]).Equal(target) {
+			return true
+		}
+		// ICMPv6 差错：目的不可达、包过大、超时、参数问题
+		inner := pkt[40:]
+		return pkt[6] == 58 && len(inner) >= 8+40 && inner[0] >= 1 && inner[0] <= 4 &&
+			net.IP(inner[8+24:8+40]).Equal(target)
+	}
+	return false
+}
+
+// captureCheck 过滤程序中的一项比较：依次执行 loads 后累加器的值等于 val
+type captureCheck struct {
+	loads []bpf.Instruction
+	val   uint32
+}
+
+// captureFilter 生成挂在抓包套接字上的经典 BPF 过滤程序，在内核中只放行与 capturedPacket 相同的包，
+// 不把本机的全部流量复制到用户态；套接字为 SOCK_DGRAM，偏移量从 IP 头开始
+func captureFilter(target net.IP) ([]bpf.RawInstruction, error) {
+	byteAt := func(off uint32) []bpf.Instruction { return []bpf.Instruction{bpf.LoadAbsolute{Off: off, Size: 1}} }
+	// 地址 addr 与 IP 头偏移 off 处逐 4 字节相等
+	addrAt := func(off uint32, addr net.IP, load func(uint32) bpf.Instruction) []captureCheck {
+		var checks []captureCheck
+		for i := 0; i < len(addr); i += 4 {
+			checks = append(checks, captureCheck{[]bpf.Instruction{load(off + uint32(i))}, binary.BigEndian.Uint32(addr[i:])})
+		}
+		return checks
+	}
+	absolute := func(off uint32) bpf.Instruction { return bpf.LoadAbsolute{Off: off, Size: 4} }
+	version := func(v uint32) captureCheck {
+		return captureCheck{[]bpf.Instruction{bpf.LoadAbsolute{Off: 0, Size: 1}, bpf.ALUOpConstant{Op: bpf.ALUOpShiftRight, Val: 4}}, v}
+	}
+
+	// 每组比较全部相等时放行，任一组都不满足时丢弃
+	var groups [][]captureCheck
+	if t4 := target.To4(); t4 != nil {
+		groups = append(groups,
+			append([]captureCheck{version(4)}, addrAt(12, t4, absolute)...),
+			append([]captureCheck{version(4)}, addrAt(16, t4, absolute)...))
+		// ICMP 差错：X 为 IP 头长度，原始包的目的地址在 ICMP 头之后的 IP 头中
+		for _, typ := range []uint32{3, 11, 12} {
+			group := []captureCheck{version(4), {byteAt(9), 1},
+				{[]bpf.Instruction{bpf.LoadMemShift{Off: 0}, bpf.LoadIndirect{Off: 0, Size: 1}}, typ}}
+			groups = append(groups, append(group, addrAt(8+16, t4, func(off uint32) bpf.Instruction {
+				return bpf.LoadIndirect{Off: off, Size: 4}
+			})...))
+		}
+	} else {
+		groups = append(groups,
+			append([]captureCheck{version(6)}, addrAt(8, target, absolute)...),
+			append([]captureCheck{version(6)}, addrAt(24, target, absolute)...))
+		// ICMPv6 差错：目的不可达、包过大、超时、参数问题
+		for typ := uint32(1); typ <= 4; typ++ {
+			group := []captureCheck{version(6), {byteAt(6), 58}, {byteAt(40), typ}}
+			groups = append(groups, append(group, addrAt(40+8+24, target, absolute)...))
+		}
+	}
+
+	var prog []bpf.Instruction
+	for _, group := range groups {
+		// 组内任一比较不等时跳过本组余下的指令（含放行指令）
+		size := 1
+		for _, c := range group {
+			size += len(c.loads) + 1
+		}
+		for _, c := range group {
+			prog = append(prog, c.loads...)
+			size -= len(c.loads) + 1
+			prog = append(prog, bpf.JumpIf{Cond: bpf.JumpEqual, Val: c.val, SkipFalse: uint8(size)})
+		}
+		prog = append(prog, bpf.RetConstant{Val: pcapSnapLen})
+	}
+	prog = append(prog, bpf.RetConstant{Val: 0})
+	return bpf.Assemble(prog)
+}
+
+// pcap 文件格式：微秒时间戳，链路类型 LINKTYPE_RAW（数据包从 IP 头开始，IPv4 和 IPv6 均可），Wireshark 和 tcpdump -r 可以直接打开
+const (
+	pcapMagic   = 0xa1b2c3d4
+	pcapSnapLen = 65535
+	pcapLinkRaw = 101
+)
+
+// pcapWriter 写入 pcap 格式的抓包文件
+type pcapWriter struct {
+	w io.Writer
+}
+
+// newPcapWriter 写入文件头
+func newPcapWriter(w io.Writer) (*pcapWriter, error) {
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], pcapMagic)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], pcapSnapLen)
+	binary.LittleEndian.PutUint32(header[20:], pcapLinkRaw)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &pcapWriter{w: w}, nil
+}
+
+// write 写入一个数据包，超过 snaplen 的部分截断
+func (p *pcapWriter) write(ts time.Time, pkt []byte) error {
+	captured := pkt[:min(len(pkt), pcapSnapLen)]
+	record := make([]byte, 16, 16+len(captured))
+	binary.LittleEndian.PutUint32(record[0:], uint32(ts.Unix()))
+	binary.LittleEndian.PutUint32(record[4:], uint32(ts.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(record[8:], uint32(len(captured)))
+	binary.LittleEndian.PutUint32(record[12:], uint32(len(pkt)))
+	_, err := p.w.Write(append(record, captured...))
+	return err
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// captureReadTimeout 抓包套接字的读超时，决定停止抓包的最长等待
+const captureReadTimeout = 100 * time.Millisecond
+
+// packetCapture 在全部网卡上抓取与目标相关的 IP 包（AF_PACKET SOCK_DGRAM，内核去掉链路层头部），写入 pcap 文件；
+// 套接字上挂有 captureFilter 生成的 BPF 过滤程序，无关的包在内核中丢弃
+type packetCapture struct {
+	fd      int
+	stopped atomic.Bool
+	done    chan struct{}
+	packets int
+	err     error
+}
+
+// startCapture 开始抓包，需要 root 或 CAP_NET_RAW；在 -netns 指定的命名空间中探测时抓取该命名空间的网卡
+func startCapture(target net.IP, w *pcapWriter) (*packetCapture, error) {
+	filter, err := captureFilter(target)
+	if err != nil {
+		return nil, err
+	}
+	prog := make([]unix.SockFilter, len(filter))
+	for i, ins := range filter {
+		prog[i] = unix.SockFilter{Code: ins.Op, Jt: ins.Jt, Jf: ins.Jf, K: ins.K}
+	}
+	// 协议为 0 的套接字不接收任何包，挂上过滤程序后再绑定到全部协议，避免之前排队的包绕过过滤
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.SetsockoptSockFprog(fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &unix.SockFprog{Len: uint16(len(prog)), Filter: &prog[0]}); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: htons(syscall.ETH_P_ALL)}); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	tv := syscall.NsecToTimeval(int64(captureReadTimeout))
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	// 回环网卡上的包发出和收到时各出现一次，只保留收到的一份
+	loopbacks := make(map[int]bool)
+	if ifaces, err := net.Interfaces(); err == nil {
+		for _, ifi := range ifaces {
+			loopbacks[ifi.Index] = ifi.Flags&net.FlagLoopback != 0
+		}
+	}
+	c := &packetCapture{fd: fd, done: make(chan struct{})}
+	go func() {
+		defer close(c.done)
+		buf := make([]byte, pcapSnapLen)
+		for !c.stopped.Load() {
+			n, from, err := syscall.Recvfrom(fd, buf, 0)
+			if err != nil {
+				if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+					continue
+				}
+				c.err = err
+				return
+			}
+			if ll, ok := from.(*syscall.SockaddrLinklayer); ok && ll.Pkttype == syscall.PACKET_OUTGOING && loopbacks[ll.Ifindex] {
+				continue
+			}
+			pkt := buf[:n]
+			if !capturedPacket(pkt, target) {
+				continue
+			}
+			if err := w.write(time.Now(), pkt); err != nil {
+				c.err = err
+				return
+			}
+			c.packets++
+		}
+	}()
+	return c, nil
+}
+
+// stop 停止抓包，返回写入的包数
+func (c *packetCapture) stop() (int, error) {
+	c.stopped.Store(true)
+	<-c.done
+	syscall.Close(c.fd)
+	return c.packets, c.err
+}
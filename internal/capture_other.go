@@ -0,0 +1,19 @@
+//go:build !linux
+
+package internal
+
+import (
+	"errors"
+	"net"
+)
+
+// packetCapture 只有 Linux 支持抓包，其他系统上 -capture-on-loss 在参数校验时报错
+type packetCapture struct{}
+
+func startCapture(net.IP, *pcapWriter) (*packetCapture, error) {
+	return nil, errors.New("-capture-on-loss 只支持 Linux")
+}
+
+func (c *packetCapture) stop() (int, error) {
+	return 0, nil
+}
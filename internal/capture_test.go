@@ -0,0 +1,120 @@
+package internal_test
+
+import (
+	"bytes"
+	"dping/internal"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// ipv4 构造 IPv4 包，options 为 IP 选项的 4 字节字数
+func ipv4(proto byte, src, dst string, options int, payload []byte) []byte {
+	ihl := 20 + options*4
+	pkt := make([]byte, ihl, ihl+len(payload))
+	pkt[0] = 0x40 | byte(ihl/4)
+	binary.BigEndian.PutUint16(pkt[2:], uint16(ihl+len(payload)))
+	pkt[8], pkt[9] = 64, proto
+	copy(pkt[12:], net.ParseIP(src).To4())
+	copy(pkt[16:], net.ParseIP(dst).To4())
+	return append(pkt, payload...)
+}
+
+// ipv6 构造 IPv6 包
+func ipv6(next byte, src, dst string, payload []byte) []byte {
+	pkt := make([]byte, 40, 40+len(payload))
+	pkt[0] = 0x60
+	binary.BigEndian.PutUint16(pkt[4:], uint16(len(payload)))
+	pkt[6], pkt[7] = next, 64
+	copy(pkt[8:], net.ParseIP(src).To16())
+	copy(pkt[24:], net.ParseIP(dst).To16())
+	return append(pkt, payload...)
+}
+
+// icmp 构造 ICMP(v6) 报文，差错报文的 inner 为原始包
+func icmp(typ byte, inner []byte) []byte {
+	return append([]byte{typ, 0, 0, 0, 0, 0, 0, 0}, inner...)
+}
+
+func TestCapturedPacket(t *testing.T) {
+	udp := make([]byte, 8)
+	probe4 := ipv4(17, "10.0.0.1", "1.1.1.1", 0, udp)
+	other4 := ipv4(17, "10.0.0.1", "9.9.9.9", 0, udp)
+	probe6 := ipv6(17, "2001:db8::1", "2400:3200::1", udp)
+	other6 := ipv6(17, "2001:db8::1", "2001:db8::9", udp)
+	for _, c := range []struct {
+		name   string
+		target string
+		pkt    []byte
+		want   bool
+	}{
+		{"发往目标", "1.1.1.1", probe4, true},
+		{"来自目标", "1.1.1.1", ipv4(17, "1.1.1.1", "10.0.0.1", 0, udp), true},
+		{"无关的包", "1.1.1.1", other4, false},
+		{"路由器返回的超时", "1.1.1.1", ipv4(1, "192.168.0.1", "10.0.0.1", 0, icmp(11, probe4)), true},
+		{"路由器返回的不可达", "1.1.1.1", ipv4(1, "192.168.0.1", "10.0.0.1", 0, icmp(3, probe4)), true},
+		{"带 IP 选项的差错", "1.1.1.1", ipv4(1, "192.168.0.1", "10.0.0.1", 2, icmp(12, probe4)), true},
+		{"其他目标的差错", "1.1.1.1", ipv4(1, "192.168.0.1", "10.0.0.1", 0, icmp(11, other4)), false},
+		{"不是差错的 ICMP", "1.1.1.1", ipv4(1, "192.168.0.1", "10.0.0.1", 0, icmp(0, probe4)), false},
+		{"被截断的差错", "1.1.1.1", ipv4(1, "192.168.0.1", "10.0.0.1", 0, icmp(11, probe4[:16])), false},
+		{"IPv4 目标的 IPv6 包", "1.1.1.1", probe6, false},
+		{"IPv6 发往目标", "2400:3200::1", probe6, true},
+		{"IPv6 来自目标", "2400:3200::1", ipv6(17, "2400:3200::1", "2001:db8::1", udp), true},
+		{"IPv6 无关的包", "2400:3200::1", other6, false},
+		{"IPv6 超时", "2400:3200::1", ipv6(58, "2001:db8::ff", "2001:db8::1", icmp(3, probe6)), true},
+		{"IPv6 包过大", "2400:3200::1", ipv6(58, "2001:db8::ff", "2001:db8::1", icmp(2, probe6)), true},
+		{"IPv6 其他目标的差错", "2400:3200::1", ipv6(58, "2001:db8::ff", "2001:db8::1", icmp(1, other6)), false},
+		{"IPv6 回显应答", "2400:3200::1", ipv6(58, "2001:db8::ff", "2001:db8::1", icmp(129, probe6)), false},
+		{"IPv6 目标的 IPv4 包", "2400:3200::1", probe4, false},
+		{"空包", "1.1.1.1", nil, false},
+	} {
+		target := net.ParseIP(c.target)
+		if got := internal.CapturedPacket(c.pkt, target); got != c.want {
+			t.Errorf("%s: 是否与目标相关应为 %v，实际为 %v", c.name, c.want, got)
+		}
+		// 内核中的过滤程序与 capturedPacket 的判断一致
+		if got, err := internal.CaptureFilterAccepts(target, c.pkt); err != nil || got != c.want {
+			t.Errorf("%s: 过滤程序是否放行应为 %v，实际为 %v %v", c.name, c.want, got, err)
+		}
+	}
+}
+
+func TestPcapWriter(t *testing.T) {
+	var buf bytes.Buffer
+	ts := time.Date(2026, 10, 17, 8, 0, 0, 123456789, time.UTC)
+	small := ipv4(17, "10.0.0.1", "1.1.1.1", 0, make([]byte, 8))
+	large := make([]byte, 70000)
+	if err := internal.WritePcap(&buf, ts, small, large); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	le := binary.LittleEndian
+	// 文件头：魔数、版本 2.4、snaplen、LINKTYPE_RAW
+	if len(data) < 24 || le.Uint32(data) != 0xa1b2c3d4 || le.Uint16(data[4:]) != 2 || le.Uint16(data[6:]) != 4 ||
+		le.Uint32(data[16:]) != 65535 || le.Uint32(data[20:]) != 101 {
+		t.Fatalf("文件头无效: % x", data[:min(len(data), 24)])
+	}
+	rest := data[24:]
+	for i, c := range []struct {
+		sec, usec          uint32
+		captured, original int
+	}{
+		{uint32(ts.Unix()), 123456, len(small), len(small)},
+		{uint32(ts.Unix()) + 1, 123456, 65535, len(large)}, // 超过 snaplen 截断，记录原始长度
+	} {
+		if len(rest) < 16 {
+			t.Fatalf("第 %d 个包的记录头被截断", i+1)
+		}
+		if le.Uint32(rest) != c.sec || le.Uint32(rest[4:]) != c.usec || le.Uint32(rest[8:]) != uint32(c.captured) || le.Uint32(rest[12:]) != uint32(c.original) {
+			t.Errorf("第 %d 个包的记录头为 % x", i+1, rest[:16])
+		}
+		rest = rest[min(len(rest), 16+c.captured):]
+	}
+	if len(rest) != 0 {
+		t.Errorf("文件末尾多出 %d 字节", len(rest))
+	}
+	if !bytes.Equal(data[24+16:24+16+len(small)], small) {
+		t.Error("包的内容应原样写入")
+	}
+}
@@ -0,0 +1,245 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"slices"
+	"sort"
+)
+
+// TestsetRegion -dt 为该值时使用内置的测试目标代替目标配置，只探测本机回环地址，不依赖外部网络，
+// 用于功能测试和演示完整的探测、汇总和输出流程
+const TestsetRegion = "testset"
+
+// testsetData 测试目标，格式与内置配置相同；各运营商、地区都指向 127.0.0.1（部分系统的回环网卡只有这一个地址），
+// 同一地址只探测一次，结果归属到全部标签
+const testsetData = `{
+    "电信": {"北京": {"IPv4": ["127.0.0.1"]}, "上海": {"IPv4": ["127.0.0.1"]}},
+    "联通": {"北京": {"IPv4": ["127.0.0.1"]}, "广东": {"IPv4": ["127.0.0.1"]}},
+    "移动": {"上海": {"IPv4": ["127.0.0.1"]}, "广东": {"IPv4": ["127.0.0.1"]}}
+}`
+
+// targetCatalog 按 -dt 选择目标配置：为 TestsetRegion 时返回测试目标和实际使用的区域（全国），否则同 loadCatalog
+func targetCatalog(region string, o TargetOptions) (*DNSConfig, string, []string, error) {
+	if region != TestsetRegion {
+		dns, notes, err := loadCatalog(o.Catalog, o.Overlay)
+		return dns, region, notes, err
+	}
+	if o.Catalog != "" || o.Overlay != "" {
+		return nil, "", nil, fmt.Errorf("-dt %s 使用内置的测试目标，不能与 -catalog 或 -overlay 同时使用", TestsetRegion)
+	}
+	dns := &DNSConfig{}
+	if err := json.Unmarshal([]byte(testsetData), dns); err != nil {
+		return nil, "", nil, fmt.Errorf("Dns-Buffer-解析异常: %v", err)
+	}
+	return dns, "全国", nil, nil
+}
+
+// loadCatalog 读取目标配置，path 为空时使用内置配置，文件格式与内置配置相同；
+// overlay 非空时再叠加该覆盖文件，返回的提示为覆盖中已不生效的条目（如升级后内置配置已删除的地址）
+func loadCatalog(path string, overlay string) (*DNSConfig, []string, error) {
+	data := []byte(JsonData)
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, nil, fmt.Errorf("读取目标配置 %s 失败: %v", path, err)
+		}
+	}
+	dns := &DNSConfig{}
+	if err := json.Unmarshal(data, dns); err != nil {
+		if path == "" {
+			return nil, nil, fmt.Errorf("Dns-Buffer-解析异常: %v", err)
+		}
+		return nil, nil, fmt.Errorf("解析目标配置 %s 失败: %v", path, err)
+	}
+	if err := validateWeights(dns); err != nil {
+		return nil, nil, fmt.Errorf("目标配置 %s 中 %v", path, err)
+	}
+	if overlay == "" {
+		return dns, nil, nil
+	}
+	o, err := loadOverlay(overlay)
+	if err != nil {
+		return nil, nil, err
+	}
+	notes := o.apply(dns)
+	for i := range notes {
+		notes[i] = fmt.Sprintf("覆盖文件 %s：%s", overlay, notes[i])
+	}
+	return dns, notes, nil
+}
+
+// RegionOverlay 对一个运营商地区的修改，按 replace、add、remove 的顺序生效
+type RegionOverlay struct {
+	Replace []string `json:"replace,omitempty"` // 替换该地区的全部地址，地区不存在时新建
+	Add     []string `json:"add,omitempty"`     // 追加地址，已存在的忽略
+	Remove  []string `json:"remove,omitempty"`  // 删除地址
+	Delete  bool     `json:"delete,omitempty"`  // 删除整个地区
+
+	Weights map[string]float64 `json:"weights,omitempty"` // 设置地址的权重，在增删地址之后生效，为 1 时恢复默认
+}
+
+// CatalogOverlay 覆盖文件：运营商 -> 地区 -> 修改，只描述与基础配置的差异，基础配置升级后修改依然生效
+type CatalogOverlay map[string]map[string]*RegionOverlay
+
+// loadOverlay 读取覆盖文件，校验运营商名称和地址格式
+func loadOverlay(path string) (CatalogOverlay, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取覆盖文件 %s 失败: %v", path, err)
+	}
+	overlay := CatalogOverlay{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&overlay); err != nil {
+		return nil, fmt.Errorf("解析覆盖文件 %s 失败: %v", path, err)
+	}
+	for isp, regions := range overlay {
+		if isp != "电信" && isp != "联通" && isp != "移动" {
+			return nil, fmt.Errorf("覆盖文件 %s 中不支持的运营商 '%s'，可选 电信|联通|移动", path, isp)
+		}
+		for region, r := range regions {
+			if r == nil {
+				return nil, fmt.Errorf("覆盖文件 %s 中 %s/%s 为空", path, isp, region)
+			}
+			if r.Delete && (r.Replace != nil || len(r.Add) > 0 || len(r.Remove) > 0) {
+				return nil, fmt.Errorf("覆盖文件 %s 中 %s/%s 的 delete 不能与其他修改同时使用", path, isp, region)
+			}
+			if r.Delete && len(r.Weights) > 0 {
+				return nil, fmt.Errorf("覆盖文件 %s 中 %s/%s 的 delete 不能与其他修改同时使用", path, isp, region)
+			}
+			for _, list := range [][]string{r.Replace, r.Add, r.Remove, slices.Collect(maps.Keys(r.Weights))} {
+				for _, ip := range list {
+					if parsed := net.ParseIP(ip); parsed == nil || parsed.To4() == nil {
+						return nil, fmt.Errorf("覆盖文件 %s 中 %s/%s 的地址 '%s' 不是合法的 IPv4 地址", path, isp, region, ip)
+					}
+				}
+			}
+			for ip, w := range r.Weights {
+				if w <= 0 {
+					return nil, fmt.Errorf("覆盖文件 %s 中 %s/%s 的地址 %s 的权重 %g 无效，必须大于 0", path, isp, region, ip, w)
+				}
+			}
+		}
+	}
+	return overlay, nil
+}
+
+// apply 将修改叠加到配置上，返回未生效的修改说明
+func (o CatalogOverlay) apply(dns *DNSConfig) []string {
+	if dns.Dx == nil {
+		dns.Dx = map[string]ProvinceConfig{}
+	}
+	if dns.Lt == nil {
+		dns.Lt = map[string]ProvinceConfig{}
+	}
+	if dns.Yd == nil {
+		dns.Yd = map[string]ProvinceConfig{}
+	}
+	all := ispRegions(dns)
+
+	var notes []string
+	for _, isp := range []string{"电信", "联通", "移动"} {
+		var regions []string
+		for region := range o[isp] {
+			regions = append(regions, region)
+		}
+		sort.Strings(regions)
+		for _, region := range regions {
+			r := o[isp][region]
+			list, exists := all[isp][region]
+			if r.Delete {
+				if !exists {
+					notes = append(notes, fmt.Sprintf("要删除的地区 %s/%s 不存在", isp, region))
+				}
+				delete(all[isp], region)
+				continue
+			}
+			if r.Replace != nil {
+				list.IPv4 = append([]string(nil), r.Replace...)
+			}
+			for _, ip := range r.Add {
+				if !slices.Contains(list.IPv4, ip) {
+					list.IPv4 = append(list.IPv4, ip)
+				}
+			}
+			for _, ip := range r.Remove {
+				i := slices.Index(list.IPv4, ip)
+				if i < 0 {
+					notes = append(notes, fmt.Sprintf("要删除的地址 %s 不在 %s/%s 中", ip, isp, region))
+					continue
+				}
+				list.IPv4 = slices.Delete(list.IPv4, i, i+1)
+			}
+			if len(list.IPv4) == 0 {
+				delete(all[isp], region)
+				continue
+			}
+			// 已不在该地区的地址的权重一并删除
+			weights := make(map[string]float64)
+			for ip, w := range list.Weights {
+				if slices.Contains(list.IPv4, ip) {
+					weights[ip] = w
+				}
+			}
+			for _, ip := range slices.Sorted(maps.Keys(r.Weights)) {
+				if !slices.Contains(list.IPv4, ip) {
+					notes = append(notes, fmt.Sprintf("要设置权重的地址 %s 不在 %s/%s 中", ip, isp, region))
+					continue
+				}
+				weights[ip] = r.Weights[ip]
+				if r.Weights[ip] == 1 {
+					delete(weights, ip)
+				}
+			}
+			list.Weights = nil
+			if len(weights) > 0 {
+				list.Weights = weights
+			}
+			all[isp][region] = list
+		}
+	}
+	return notes
+}
+
+// validateWeights 检查配置中的权重：必须大于 0，且地址在该地区的列表中（避免地址写错时权重静默不生效）
+func validateWeights(dns *DNSConfig) error {
+	for isp, regions := range ispRegions(dns) {
+		for region, r := range regions {
+			for ip, w := range r.Weights {
+				if w <= 0 {
+					return fmt.Errorf("%s/%s 的地址 %s 的权重 %g 无效，必须大于 0", isp, region, ip, w)
+				}
+				if !slices.Contains(r.IPv4, ip) {
+					return fmt.Errorf("%s/%s 的权重中的地址 %s 不在该地区的地址列表中", isp, region, ip)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// saveCatalog 将配置以与内置配置相同的格式写入文件
+func saveCatalog(path string, catalog *DNSConfig) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建配置文件 %s 失败: %v", path, err)
+	}
+	defer f.Close()
+	if err := writeCatalog(f, catalog); err != nil {
+		return fmt.Errorf("写入配置文件 %s 失败: %v", path, err)
+	}
+	return nil
+}
+
+func writeCatalog(w io.Writer, catalog *DNSConfig) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	return enc.Encode(catalog)
+}
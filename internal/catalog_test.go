@@ -0,0 +1,108 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestCatalogOverlay(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	catalog := write("catalog.json", `{
+		"电信": {"北京": {"IPv4": ["1.1.1.1", "1.1.1.2"], "weights": {"1.1.1.1": 2, "1.1.1.2": 3}}, "上海": {"IPv4": ["2.2.2.2"]}},
+		"联通": {"北京": {"IPv4": ["3.3.3.3"]}}
+	}`)
+	overlay := write("overlay.json", `{
+		"电信": {
+			"北京": {"add": ["1.1.1.3", "1.1.1.1"], "remove": ["1.1.1.2", "9.9.9.9"], "weights": {"1.1.1.3": 5, "8.8.8.8": 2}},
+			"上海": {"delete": true}
+		},
+		"联通": {"北京": {"replace": ["4.4.4.4"]}, "广东": {"add": ["5.5.5.5"]}}
+	}`)
+	out := filepath.Join(dir, "merged.json")
+	if err := internal.Audit(internal.AuditOptions{Catalog: catalog, Overlay: overlay, OutPath: out}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := &internal.DNSConfig{}
+	if err := json.Unmarshal(data, merged); err != nil {
+		t.Fatal(err)
+	}
+	want := &internal.DNSConfig{
+		// 删除的地址的权重一并删除，覆盖文件中的权重在增删地址之后生效
+		Dx: map[string]internal.ProvinceConfig{"北京": {IPv4: []string{"1.1.1.1", "1.1.1.3"}, Weights: map[string]float64{"1.1.1.1": 2, "1.1.1.3": 5}}},
+		Lt: map[string]internal.ProvinceConfig{"北京": {IPv4: []string{"4.4.4.4"}}, "广东": {IPv4: []string{"5.5.5.5"}}},
+		Yd: map[string]internal.ProvinceConfig{},
+	}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("叠加后的配置不一致:\n实际 %+v\n期望 %+v", merged, want)
+	}
+
+	for name, c := range map[string]struct{ content, want string }{
+		"isp.json":    {`{"广电": {}}`, "不支持的运营商"},
+		"ip.json":     {`{"电信": {"北京": {"add": ["bad"]}}}`, "不是合法的 IPv4 地址"},
+		"delete.json": {`{"电信": {"北京": {"delete": true, "add": ["1.1.1.1"]}}}`, "delete 不能"},
+		"field.json":  {`{"电信": {"北京": {"append": ["1.1.1.1"]}}}`, "unknown field"},
+		"weight.json": {`{"电信": {"北京": {"weights": {"1.1.1.1": 0}}}}`, "必须大于 0"},
+	} {
+		err := internal.Audit(internal.AuditOptions{Catalog: catalog, Overlay: write(name, c.content)})
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s 应返回包含 '%s' 的错误，实际为 %v", name, c.want, err)
+		}
+	}
+	// 配置中权重的地址不在该地区时报错，地址写错时权重不会静默不生效
+	typo := write("typo.json", `{"电信": {"北京": {"IPv4": ["1.1.1.1"], "weights": {"1.1.1.9": 2}}}}`)
+	if err := internal.Audit(internal.AuditOptions{Catalog: typo}); err == nil || !strings.Contains(err.Error(), "不在该地区的地址列表中") {
+		t.Errorf("权重中的地址不在列表中时应报错，实际为 %v", err)
+	}
+}
+
+func TestOverseasTargets(t *testing.T) {
+	// -dt 海外 只取北京、上海、广东的国内目标作为基线，另加内置的海外目标（离线时海外目标全部丢包，不出现在表格中）
+	port := serveDNS(t, dnsmessage.RCodeSuccess)
+	catalog := filepath.Join(t.TempDir(), "catalog.json")
+	if err := os.WriteFile(catalog, []byte(`{
+		"电信": {"北京": {"IPv4": ["127.0.0.1"]}, "天津": {"IPv4": ["127.0.0.2"]}},
+		"联通": {"广东": {"IPv4": ["127.0.0.1"]}}
+	}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := internal.OutputOptions{Format: "json", NoPager: true, OutPath: filepath.Join(t.TempDir(), "result.json")}
+	result, err := internal.DPing(internal.Options{Region: internal.OverseasRegion, Count: 1,
+		Probe: internal.ProbeOptions{Proto: "dns", Port: port}, Targets: internal.TargetOptions{Catalog: catalog}, Output: output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var regions []string
+	for _, row := range result.Snapshot.Rows {
+		if row.Isp != internal.OverseasIsp {
+			regions = append(regions, row.Region)
+		}
+	}
+	slices.Sort(regions)
+	if !slices.Equal(regions, []string{"北京", "广东"}) {
+		t.Errorf("国内基线应只有北京、广东，实际 %v", regions)
+	}
+	// 1.1.1.1、8.8.8.8 等任播地址不需要解析，至少有 5 个海外目标
+	if n := result.Snapshot.Telemetry.Scheduled; n < 1+5 {
+		t.Errorf("应探测基线和海外目标，实际计划 %d 次", n)
+	}
+}
@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	chartRows       = 8   // 每张图的行数，每行 4 个点
+	chartLabelWidth = 9   // 纵轴刻度所占列数
+	chartMaxPoints  = 600 // 最多保留的轮数
+)
+
+// ChartRenderer 持续探测时以折线图显示一个目标或运营商每轮的丢包率和平均 RTT，代替结果表格；
+// 每个字符用盲文点阵表示 2×4 个点，横向每个点为一轮
+type ChartRenderer struct {
+	Selector string // 目标 IP 或运营商名称
+	Width    int    // 输出宽度，0 时为 80
+	Clear    bool   // 每轮清屏后重绘，标准输出为终端时使用
+
+	points []chartPoint
+}
+
+// chartPoint 一轮探测中所选目标的汇总
+type chartPoint struct {
+	at     time.Time
+	loss   float64
+	rtt    float64 // 没有收到回包时为 NaN，图中断开
+	probed bool    // 本轮有该目标的结果
+}
+
+// checkChartSelector 校验 -chart 指定的目标 IP 或运营商在探测目标中
+func checkChartSelector(selector string, targets []*Target) error {
+	ip := net.ParseIP(selector)
+	for _, t := range targets {
+		if ip != nil && ip.Equal(net.ParseIP(t.IP)) {
+			return nil
+		}
+		for _, label := range t.Labels {
+			if ip == nil && label.Isp == selector {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("-chart 指定的 '%s' 不是本次探测的目标 IP 或运营商", selector)
+}
+
+// Render 记录本轮结果并重绘折线图
+func (c *ChartRenderer) Render(w io.Writer, result *RunResult) error {
+	c.points = append(c.points, c.aggregate(result.Snapshot))
+	if len(c.points) > chartMaxPoints {
+		c.points = c.points[len(c.points)-chartMaxPoints:]
+	}
+	width := c.Width
+	if width <= 0 {
+		width = 80
+	}
+	cells := max(width-chartLabelWidth-1, 10)
+	points := c.points
+	if len(points) > cells*2 {
+		points = points[len(points)-cells*2:]
+	}
+
+	if c.Clear {
+		fmt.Fprint(w, "\x1b[H\x1b[2J")
+	}
+	last := points[len(points)-1]
+	fmt.Fprintf(w, "%s  %s", c.Selector, last.at.Format(time.DateTime))
+	if last.probed {
+		fmt.Fprintf(w, "  丢包率 %.1f%%  平均 RTT %s\n\n", last.loss, formatChartValue(last.rtt, "ms"))
+	} else {
+		fmt.Fprint(w, "  本轮没有结果\n\n")
+	}
+	losses, rtts := make([]float64, len(points)), make([]float64, len(points))
+	for i, p := range points {
+		losses[i], rtts[i] = math.NaN(), math.NaN()
+		if p.probed {
+			losses[i], rtts[i] = p.loss, p.rtt
+		}
+	}
+	writeChart(w, "丢包率 (%)", losses, points, cells)
+	fmt.Fprintln(w)
+	writeChart(w, "平均 RTT (ms)", rtts, points, cells)
+	return nil
+}
+
+// aggregate 汇总本轮所选目标的各行：同一 IP 和源的多个标签只计一次，丢包率按包数、RTT 按收包数加权
+func (c *ChartRenderer) aggregate(snap *Snapshot) chartPoint {
+	p := chartPoint{at: snap.CreatedAt, rtt: math.NaN()}
+	ip := net.ParseIP(c.Selector)
+	seen := make(map[string]bool)
+	var sent, recv int
+	var rttSum float64
+	for _, row := range snap.Rows {
+		if ip != nil && !ip.Equal(net.ParseIP(row.DestIP)) || ip == nil && row.Isp != c.Selector {
+			continue
+		}
+		key := row.DestIP + "|" + row.Source
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		sent += row.Sent
+		recv += row.Recv
+		rttSum += row.AvgRttMs * float64(row.Recv)
+	}
+	if sent == 0 {
+		return p
+	}
+	p.probed = true
+	p.loss = float64(sent-recv) / float64(sent) * 100
+	if recv > 0 {
+		p.rtt = rttSum / float64(recv)
+	}
+	return p
+}
+
+// writeChart 输出一张盲文折线图，values 中的 NaN 处断开；纵轴从 0 到不小于最大值的 1/2/5×10^n
+func writeChart(w io.Writer, title string, values []float64, points []chartPoint, cells int) {
+	top := 0.0
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			top = max(top, v)
+		}
+	}
+	top = niceCeil(top)
+
+	dots := chartRows * 4
+	grid := make([][]rune, chartRows)
+	for i := range grid {
+		grid[i] = make([]rune, cells)
+	}
+	set := func(x, y int) {
+		row, col := chartRows-1-y/4, x/2
+		// 盲文点位：左列自上而下 0x01 0x02 0x04 0x40，右列 0x08 0x10 0x20 0x80
+		bits := [2][4]rune{{0x40, 0x04, 0x02, 0x01}, {0x80, 0x20, 0x10, 0x08}}
+		grid[row][col] |= bits[x%2][y%4]
+	}
+	prev := -1
+	for x, v := range values {
+		if math.IsNaN(v) {
+			prev = -1
+			continue
+		}
+		y := min(int(math.Round(v/top*float64(dots-1))), dots-1)
+		from, to := y, y
+		if prev >= 0 {
+			// 与上一轮的点竖直相连
+			from, to = min(prev, y), max(prev, y)
+		}
+		for yy := from; yy <= to; yy++ {
+			set(x, yy)
+		}
+		prev = y
+	}
+
+	fmt.Fprintf(w, "%*s%s\n", chartLabelWidth, "", title)
+	for i, line := range grid {
+		label := strings.Repeat(" ", chartLabelWidth-1) + "│"
+		switch i {
+		case 0:
+			label = fmt.Sprintf("%*s┤", chartLabelWidth-1, formatChartValue(top, ""))
+		case chartRows - 1:
+			label = fmt.Sprintf("%*s┤", chartLabelWidth-1, "0")
+		}
+		var b strings.Builder
+		for _, r := range line {
+			if r == 0 {
+				b.WriteByte(' ')
+			} else {
+				b.WriteRune(0x2800 + r)
+			}
+		}
+		fmt.Fprintf(w, "%s%s\n", label, strings.TrimRight(b.String(), " "))
+	}
+	fmt.Fprintf(w, "%*s└%s\n", chartLabelWidth-1, "", strings.Repeat("─", cells))
+	first, last := points[0].at.Format(time.TimeOnly), points[len(points)-1].at.Format(time.TimeOnly)
+	if len(points) == 1 {
+		fmt.Fprintf(w, "%*s%s\n", chartLabelWidth, "", first)
+		return
+	}
+	// 起止时间分别对齐第一个点和最后一个点所在的列
+	gap := max((len(points)-1)/2+1-len(first)-len(last), 1)
+	fmt.Fprintf(w, "%*s%s%*s%s\n", chartLabelWidth, "", first, gap, "", last)
+}
+
+// niceCeil 返回不小于 v 的 1、2、5 乘 10 的整数次幂，v 为 0 时返回 1
+func niceCeil(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	base := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if base*m >= v {
+			return base * m
+		}
+	}
+	return base * 10
+}
+
+// formatChartValue 输出刻度和当前值，小于 10 时保留一位小数；NaN 为 -
+func formatChartValue(v float64, unit string) string {
+	switch {
+	case math.IsNaN(v):
+		return "-"
+	case v < 10:
+		return fmt.Sprintf("%.1f%s", v, unit)
+	default:
+		return fmt.Sprintf("%.0f%s", v, unit)
+	}
+}
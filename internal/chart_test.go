@@ -0,0 +1,56 @@
+package internal_test
+
+import (
+	"bytes"
+	"dping/internal"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChartRenderer(t *testing.T) {
+	chart := &internal.ChartRenderer{Selector: "电信", Width: 40}
+	start := time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC)
+	// 同一 IP 在两个地区各有一行，只计一次；联通的行不计入
+	round := func(i int, recv int, rtt float64) *internal.RunResult {
+		return &internal.RunResult{Snapshot: &internal.Snapshot{
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+			Rows: []*internal.SnapshotRow{
+				{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", Sent: 10, Recv: recv, AvgRttMs: rtt},
+				{DestIP: "1.1.1.1", Region: "天津", Isp: "电信", Sent: 10, Recv: recv, AvgRttMs: rtt},
+				{DestIP: "2.2.2.2", Region: "北京", Isp: "联通", Sent: 10, Recv: 0},
+			},
+		}}
+	}
+
+	var out bytes.Buffer
+	for i, r := range []struct {
+		recv int
+		rtt  float64
+	}{{10, 20}, {8, 40}, {0, 0}, {10, 30}} {
+		out.Reset()
+		if err := chart.Render(&out, round(i, r.recv, r.rtt)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := out.String()
+	for _, want := range []string{
+		"电信  2026-10-17 08:03:00  丢包率 0.0%  平均 RTT 30ms",
+		"     100┤", // 第 3 轮全部丢包，丢包率纵轴到 100
+		"      50┤", // RTT 最大 40ms，纵轴到 50
+		"08:00:00",
+		"08:03:00",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("输出中缺少 %q:\n%s", want, got)
+		}
+	}
+	if strings.IndexFunc(got, func(r rune) bool { return r > 0x2800 && r <= 0x28ff }) < 0 {
+		t.Errorf("输出中没有盲文点阵:\n%s", got)
+	}
+	for _, line := range strings.Split(got, "\n") {
+		if w := len([]rune(line)); strings.ContainsAny(line, "┤│└") && w > 40 {
+			t.Errorf("行宽 %d 超过 40: %q", w, line)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package internal
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// CompareRow 两次结果中同一目标的对比
+type CompareRow struct {
+	DestIP          string
+	Region          string
+	Isp             string
+	Source          string // 新快照为多源探测时的源IP
+	Proto           string // 多协议探测时的协议标签
+	OldAvgRtt       time.Duration
+	NewAvgRtt       time.Duration
+	RttDelta        time.Duration // 新 - 旧
+	RttMargin       time.Duration // 差值 95% 置信区间半宽
+	RttSignificant  bool
+	Insufficient    bool // 任一侧样本数不足 2，无法判断
+	OldLost         bool // 旧快照中全部丢包（在 unanswered 中），RTT 无法对比
+	NewLost         bool // 新快照中全部丢包（在 unanswered 中），RTT 无法对比
+	OldLoss         float64
+	NewLoss         float64
+	LossSignificant bool
+}
+
+// tCritical95 返回自由度为 df 的 t 分布双侧 95% 临界值
+func tCritical95(df float64) float64 {
+	table := []float64{
+		12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+		2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+		2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+	}
+	switch {
+	case df < 1:
+		return table[0]
+	case df <= 30:
+		return table[int(df)-1]
+	case df <= 60:
+		return 2.000
+	case df <= 120:
+		return 1.980
+	default:
+		return 1.960
+	}
+}
+
+// welchMargin 按 Welch t 检验计算两组 RTT 均值之差的 95% 置信区间半宽
+func welchMargin(s1, s2 time.Duration, n1, n2 int) (time.Duration, bool) {
+	if n1 < 2 || n2 < 2 {
+		return 0, false
+	}
+	// go-ping 给出的是总体标准差，换算为样本方差
+	v1 := float64(s1) * float64(s1) * float64(n1) / float64(n1-1)
+	v2 := float64(s2) * float64(s2) * float64(n2) / float64(n2-1)
+	a, b := v1/float64(n1), v2/float64(n2)
+	se := math.Sqrt(a + b)
+	if se == 0 {
+		return 0, true
+	}
+	df := (a + b) * (a + b) / (a*a/float64(n1-1) + b*b/float64(n2-1))
+	return time.Duration(tCritical95(df) * se), true
+}
+
+// lossSignificant 按两比例 z 检验判断丢包率差异是否显著
+func lossSignificant(prev, curr *SummaryStatistic) bool {
+	if prev.TotalSent == 0 || curr.TotalSent == 0 {
+		return false
+	}
+	lost1 := float64(prev.TotalSent - prev.TotalRecv)
+	lost2 := float64(curr.TotalSent - curr.TotalRecv)
+	n1, n2 := float64(prev.TotalSent), float64(curr.TotalSent)
+	p := (lost1 + lost2) / (n1 + n2)
+	se := math.Sqrt(p * (1 - p) * (1/n1 + 1/n2))
+	if se == 0 {
+		return false
+	}
+	return math.Abs(lost2/n2-lost1/n1) > 1.96*se
+}
+
+// CompareSnapshots 对比两份快照中共同目标的 RTT 与丢包，并标注差异是否显著；
+// 任一侧全部丢包的目标也参与对比，该侧丢包率为 100%，RTT 不作比较
+func CompareSnapshots(prev, curr *Snapshot) []*CompareRow {
+	// 两份快照都是多源探测时按源IP分别对比，否则忽略源IP；多协议探测的结果只与相同协议标签的结果对比
+	currMulti := snapshotMultiSource(curr)
+	bySource := currMulti && snapshotMultiSource(prev)
+	key := func(r *SnapshotRow) string {
+		k := r.DestIP + "|" + r.Isp + "|" + r.Region + "|" + r.Proto
+		if bySource {
+			k += "|" + r.Source
+		}
+		return k
+	}
+	oldRows := make(map[string]*SummaryStatistic)
+	oldLost := make(map[string]bool)
+	for _, r := range prev.Rows {
+		oldRows[key(r)] = r.Summary()
+	}
+	for _, r := range prev.Unanswered {
+		oldRows[key(r)], oldLost[key(r)] = r.Summary(), true
+	}
+	newLost := make(map[string]bool)
+	for _, r := range curr.Unanswered {
+		newLost[key(r)] = true
+	}
+
+	var rows []*CompareRow
+	for _, r := range slices.Concat(curr.Rows, curr.Unanswered) {
+		o, ok := oldRows[key(r)]
+		if !ok {
+			continue
+		}
+		n := r.Summary()
+		row := &CompareRow{
+			DestIP:          n.DestIP,
+			Region:          n.Region,
+			Isp:             n.Isp,
+			Proto:           n.Proto,
+			OldAvgRtt:       o.AvgRtt,
+			NewAvgRtt:       n.AvgRtt,
+			RttDelta:        n.AvgRtt - o.AvgRtt,
+			OldLoss:         o.PacketLoss,
+			NewLoss:         n.PacketLoss,
+			LossSignificant: lossSignificant(o, n),
+		}
+		if currMulti {
+			row.Source = n.Source
+		}
+		if row.OldLost, row.NewLost = oldLost[key(r)], newLost[key(r)]; row.OldLost || row.NewLost {
+			// unanswered 中的行丢包率为 100%，没有 RTT
+			row.RttDelta = 0
+			rows = append(rows, row)
+			continue
+		}
+		margin, ok := welchMargin(o.StdDevRtt, n.StdDevRtt, o.TotalRecv, n.TotalRecv)
+		row.RttMargin = margin
+		row.Insufficient = !ok
+		row.RttSignificant = ok && (row.RttDelta > margin || -row.RttDelta > margin)
+		rows = append(rows, row)
+	}
+
+	// 新变为全部丢包的排在最前，其次是显著差异，再按差值绝对值降序
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].NewLost != rows[j].NewLost {
+			return rows[i].NewLost
+		}
+		if rows[i].RttSignificant != rows[j].RttSignificant {
+			return rows[i].RttSignificant
+		}
+		di, dj := rows[i].RttDelta, rows[j].RttDelta
+		if di < 0 {
+			di = -di
+		}
+		if dj < 0 {
+			dj = -dj
+		}
+		return di > dj
+	})
+	return rows
+}
+
+// snapshotMultiSource 快照中是否有多个源IP的结果
+func snapshotMultiSource(snap *Snapshot) bool {
+	rows := slices.Concat(snap.Rows, snap.Unanswered)
+	for _, r := range rows {
+		if r.Source != rows[0].Source {
+			return true
+		}
+	}
+	return false
+}
+
+// Compare 读取两份快照并打印对比结果；带签名的快照读取时校验签名，trusted 非空时要求两份快照都由该公钥签名
+func Compare(oldPath, newPath string, trusted ed25519.PublicKey) error {
+	prev, err := loadTrustedSnapshot(oldPath, trusted)
+	if err != nil {
+		return err
+	}
+	curr, err := loadTrustedSnapshot(newPath, trusted)
+	if err != nil {
+		return err
+	}
+
+	printSnapshotHeader("旧", prev)
+	printSnapshotHeader("新", curr)
+	rows := CompareSnapshots(prev, curr)
+	printCompareList(rows)
+	fmt.Printf("共同目标 %d 个（旧 %d 个，新 %d 个）\n", len(rows), len(prev.Rows)+len(prev.Unanswered), len(curr.Rows)+len(curr.Unanswered))
+	return nil
+}
+
+// printSnapshotHeader 打印快照的时间、主机、源IP，有备注时一并打印
+func printSnapshotHeader(label string, snap *Snapshot) {
+	fmt.Printf("%s: %s %s 源IP=%s", label, snap.CreatedAt.Format("2006-01-02 15:04:05"), snap.Host, snap.Source)
+	if snap.Note != "" {
+		fmt.Printf(" 备注=%s", snap.Note)
+	}
+	if snap.Signature != nil {
+		fmt.Printf(" 签名有效（密钥 %s）", snap.Signature.KeyID)
+	}
+	fmt.Println()
+}
+
+// 打印对比结果
+func printCompareList(rows []*CompareRow) {
+	withSource, withProto := false, false
+	for _, row := range rows {
+		withSource = withSource || row.Source != ""
+		withProto = withProto || row.Proto != ""
+	}
+	header := []string{"目标IP", "地区", "运营商"}
+	if withSource {
+		header = append(header, "源IP")
+	}
+	if withProto {
+		header = append(header, "协议")
+	}
+	header = append(header, "旧AvgRTT", "新AvgRTT", "差值(95%CI)", "旧丢包%", "新丢包%", "结论")
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(header)
+	table.SetAutoFormatHeaders(false)
+	table.SetAutoWrapText(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetBorder(false)
+	table.SetRowLine(false)
+	table.SetColumnSeparator(" ")
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+
+	formatDuration := func(d time.Duration) string {
+		ms := float64(d) / float64(time.Millisecond)
+		return fmt.Sprintf("%.1fms", ms)
+	}
+
+	// ANSI 颜色码
+	green := "\x1b[32m"
+	red := "\x1b[31m"
+	reset := "\x1b[0m"
+
+	for _, row := range rows {
+		var verdict string
+		switch {
+		case row.OldLost && row.NewLost:
+			verdict = "两次都全部丢包"
+		case row.NewLost:
+			verdict = red + "✖ 变为全部丢包" + reset
+		case row.OldLost:
+			verdict = green + "✔ 不再全部丢包" + reset
+		case row.Insufficient:
+			verdict = "样本不足"
+		case row.RttSignificant && row.RttDelta > 0:
+			verdict = red + "▲ 显著变慢" + reset
+		case row.RttSignificant:
+			verdict = green + "▼ 显著变快" + reset
+		default:
+			verdict = "≈ 差异不显著"
+		}
+		if row.LossSignificant {
+			verdict += "，丢包变化显著"
+		}
+
+		cells := []string{row.DestIP, row.Region, row.Isp}
+		if withSource {
+			cells = append(cells, row.Source)
+		}
+		if withProto {
+			cells = append(cells, row.Proto)
+		}
+		oldRtt, newRtt := formatDuration(row.OldAvgRtt), formatDuration(row.NewAvgRtt)
+		delta := fmt.Sprintf("%+.1fms ±%.1fms", float64(row.RttDelta)/float64(time.Millisecond), float64(row.RttMargin)/float64(time.Millisecond))
+		if row.OldLost || row.NewLost {
+			delta = "-"
+			if row.OldLost {
+				oldRtt = "-"
+			}
+			if row.NewLost {
+				newRtt = "-"
+			}
+		}
+		table.Append(append(cells,
+			oldRtt,
+			newRtt,
+			delta,
+			fmt.Sprintf("%.1f%%", row.OldLoss),
+			fmt.Sprintf("%.1f%%", row.NewLoss),
+			verdict,
+		))
+	}
+	table.Render()
+}
@@ -0,0 +1,120 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTCritical95(t *testing.T) {
+	// 参考值为 t 分布的 97.5% 分位数，非整数自由度向下取整（偏保守），超过 30 后按 60、120、∞ 分段
+	for _, c := range []struct{ df, want float64 }{
+		{0.5, 12.706},
+		{1, 12.706},
+		{1.9, 12.706},
+		{2, 4.303},
+		{10, 2.228},
+		{13.2, 2.160},
+		{29.9, 2.045},
+		{30, 2.042},
+		{30.5, 2.000},
+		{60, 2.000},
+		{61, 1.980},
+		{120, 1.980},
+		{121, 1.960},
+		{1e6, 1.960},
+	} {
+		if got := internal.TCritical95(c.df); got != c.want {
+			t.Errorf("自由度 %g 的临界值应为 %.3f，实际为 %.3f", c.df, c.want, got)
+		}
+	}
+}
+
+func TestWelchMargin(t *testing.T) {
+	ms := time.Millisecond
+	for _, c := range []struct {
+		name   string
+		s1, s2 time.Duration
+		n1, n2 int
+		want   time.Duration
+		ok     bool
+	}{
+		// 样本方差 10 和 10：se=√2，df=18，t=2.101
+		{"方差相同", 3 * ms, 3 * ms, 10, 10, 2971 * time.Microsecond, true},
+		// 样本方差 10 和 40：se=√5，df=25/(17/9)≈13.2，t=2.160
+		{"方差不同", 3 * ms, 6 * ms, 10, 10, 4830 * time.Microsecond, true},
+		{"方差为 0", 0, 0, 5, 5, 0, true},
+		{"样本不足", 3 * ms, 3 * ms, 1, 10, 0, false},
+	} {
+		got, ok := internal.WelchMargin(c.s1, c.s2, c.n1, c.n2)
+		if ok != c.ok || math.Abs(float64(got-c.want)) > float64(time.Microsecond) {
+			t.Errorf("%s: 置信区间半宽应为 %s %v，实际为 %s %v", c.name, c.want, c.ok, got, ok)
+		}
+	}
+}
+
+func TestLossSignificant(t *testing.T) {
+	stat := func(sent, recv int) *internal.SummaryStatistic {
+		return &internal.SummaryStatistic{TotalSent: sent, TotalRecv: recv}
+	}
+	for _, c := range []struct {
+		name       string
+		prev, curr *internal.SummaryStatistic
+		want       bool
+	}{
+		// p=0.05，se≈0.0308，差 0.10 > 1.96×se
+		{"0% 到 10%", stat(100, 100), stat(100, 90), true},
+		// p=0.035，se≈0.0260，差 0.03 < 1.96×se
+		{"2% 到 5%", stat(100, 98), stat(100, 95), false},
+		{"都不丢包", stat(100, 100), stat(100, 100), false},
+		{"都全部丢包", stat(10, 0), stat(10, 0), false},
+		{"没有发包", stat(0, 0), stat(100, 50), false},
+	} {
+		if got := internal.LossSignificant(c.prev, c.curr); got != c.want {
+			t.Errorf("%s: 丢包差异显著应为 %v，实际为 %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestCompareSnapshotsUnanswered(t *testing.T) {
+	row := func(ip string, recv int, rtt float64) *internal.SnapshotRow {
+		return &internal.SnapshotRow{DestIP: ip, Region: "北京", Isp: "电信", Sent: 10, Recv: recv, LossPercent: float64(10-recv) * 10,
+			AvgRttMs: rtt, StdDevRttMs: 1}
+	}
+	lost := func(ip string) *internal.SnapshotRow {
+		return &internal.SnapshotRow{DestIP: ip, Region: "北京", Isp: "电信", Sent: 10, LossPercent: 100}
+	}
+	prev := &internal.Snapshot{
+		Rows:       []*internal.SnapshotRow{row("1.1.1.1", 10, 10), row("2.2.2.2", 10, 10)},
+		Unanswered: []*internal.SnapshotRow{lost("3.3.3.3"), lost("4.4.4.4")},
+	}
+	curr := &internal.Snapshot{
+		Rows:       []*internal.SnapshotRow{row("1.1.1.1", 10, 10), row("3.3.3.3", 10, 20)},
+		Unanswered: []*internal.SnapshotRow{lost("2.2.2.2"), lost("4.4.4.4")},
+	}
+	rows := internal.CompareSnapshots(prev, curr)
+	if len(rows) != 4 {
+		t.Fatalf("全部丢包的目标也应参与对比，共 4 行，实际为 %d 行", len(rows))
+	}
+	// 新变为全部丢包的排在最前
+	if r := rows[0]; r.DestIP != "2.2.2.2" || !r.NewLost || r.OldLost || r.NewLoss-r.OldLoss != 100 || r.RttDelta != 0 || r.RttSignificant || !r.LossSignificant {
+		t.Errorf("变为全部丢包的目标应丢包率上升 100 个百分点、RTT 不作比较: %+v", r)
+	}
+	for _, r := range rows[1:] {
+		switch r.DestIP {
+		case "3.3.3.3":
+			if !r.OldLost || r.NewLost || r.OldLoss != 100 || r.NewLoss != 0 || r.RttDelta != 0 || r.RttSignificant {
+				t.Errorf("不再全部丢包的目标对比不符: %+v", r)
+			}
+		case "4.4.4.4":
+			if !r.OldLost || !r.NewLost || r.LossSignificant {
+				t.Errorf("两次都全部丢包的目标对比不符: %+v", r)
+			}
+		case "1.1.1.1":
+			if r.OldLost || r.NewLost {
+				t.Errorf("有应答的目标不应标为全部丢包: %+v", r)
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 参数值的来源，优先级从低到高
+const (
+	SourceDefault = "默认值"
+	SourceFile    = "配置文件"
+	SourceEnv     = "环境变量"
+	SourceFlag    = "命令行"
+)
+
+// ConfigEnvPrefix 环境变量前缀，参数名转为大写、- 转为 _，如 DPING_LOSS_WARN 对应 -loss-warn
+const ConfigEnvPrefix = "DPING_"
+
+// Config 合并后的有效配置，各参数的值已设置到 FlagSet 上
+type Config struct {
+	Path    string            // 使用的配置文件，不存在时为空
+	Sources map[string]string // 参数名 -> 来源
+}
+
+// DefaultConfigPath 默认配置文件：$DPING_CONFIG，否则为用户配置目录下的 dping/config.yaml
+func DefaultConfigPath() string {
+	if path := os.Getenv(ConfigEnvPrefix + "CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "dping", "config.yaml")
+}
+
+// configEnvName 参数对应的环境变量名
+func configEnvName(name string) string {
+	return ConfigEnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// LoadConfig 在命令行解析之后，把配置文件和环境变量中的值补到命令行没有指定的参数上，
+// 优先级为 命令行 > 环境变量 > 配置文件 > 默认值；path 为空时不读配置文件，
+// explicit 为 true 时（-config 或 $DPING_CONFIG 指定）文件不存在视为错误。skip 中的参数不从文件和环境变量读取
+func LoadConfig(fs *flag.FlagSet, path string, explicit bool, skip ...string) (*Config, error) {
+	cfg := &Config{Sources: make(map[string]string)}
+	skipped := make(map[string]bool)
+	for _, name := range skip {
+		skipped[name] = true
+	}
+	fs.VisitAll(func(f *flag.Flag) { cfg.Sources[f.Name] = SourceDefault })
+	fs.Visit(func(f *flag.Flag) { cfg.Sources[f.Name] = SourceFlag })
+
+	var envErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(configEnvName(f.Name))
+		if !ok || skipped[f.Name] || cfg.Sources[f.Name] == SourceFlag || envErr != nil {
+			return
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			envErr = fmt.Errorf("环境变量 %s 的值 '%s' 无效: %v", configEnvName(f.Name), value, err)
+			return
+		}
+		cfg.Sources[f.Name] = SourceEnv
+	})
+	if envErr != nil {
+		return nil, envErr
+	}
+
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("读取配置文件 %s 失败: %v", path, err)
+	}
+	cfg.Path = path
+	values := make(map[string]interface{})
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&values); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("解析配置文件 %s 失败: %v", path, err)
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if fs.Lookup(name) == nil || skipped[name] {
+			return nil, fmt.Errorf("配置文件 %s 中不支持的参数 '%s'，参数名与命令行一致（不带 -）", path, name)
+		}
+		if cfg.Sources[name] != SourceDefault {
+			continue
+		}
+		var value string
+		switch v := values[name].(type) {
+		case nil:
+		case map[string]interface{}, []interface{}:
+			return nil, fmt.Errorf("配置文件 %s 中参数 %s 应为单个值，多个值请写成与命令行相同的格式（如逗号分隔）", path, name)
+		default:
+			value = fmt.Sprint(v)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return nil, fmt.Errorf("配置文件 %s 中参数 %s 的值 '%s' 无效: %v", path, name, value, err)
+		}
+		cfg.Sources[name] = SourceFile
+	}
+	return cfg, nil
+}
+
+// WriteConfig 以 YAML 输出全部参数的有效值，每行注释其来源，输出可直接作为配置文件使用
+func WriteConfig(w io.Writer, fs *flag.FlagSet, cfg *Config, skip ...string) error {
+	skipped := make(map[string]bool)
+	for _, name := range skip {
+		skipped[name] = true
+	}
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	if cfg.Path != "" {
+		doc.HeadComment = "配置文件: " + cfg.Path
+	} else {
+		doc.HeadComment = "未使用配置文件"
+	}
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if skipped[f.Name] || err != nil {
+			return
+		}
+		value := f.Value.(flag.Getter).Get()
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+		node := &yaml.Node{}
+		if err = node.Encode(value); err != nil {
+			return
+		}
+		node.LineComment = cfg.Sources[f.Name]
+		if cfg.Sources[f.Name] == SourceEnv {
+			node.LineComment += " " + configEnvName(f.Name)
+		}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: f.Name}, node)
+	})
+	if err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
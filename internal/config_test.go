@@ -0,0 +1,62 @@
+package internal_test
+
+import (
+	"bytes"
+	"dping/internal"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("isp: 联通\np: 5\njitter: 0s\nloss-warn: 2.5\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DPING_P", "7")
+	t.Setenv("DPING_LOSS_WARN", "1")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	isp := fs.String("isp", "all", "")
+	count := fs.Int("p", 3, "")
+	jitter := fs.Duration("jitter", 100*time.Millisecond, "")
+	lossWarn := fs.Float64("loss-warn", 5, "")
+	format := fs.String("format", "table", "")
+	if err := fs.Parse([]string{"-loss-warn", "3"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := internal.LoadConfig(fs, path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 命令行 > 环境变量 > 配置文件 > 默认值
+	if *isp != "联通" || *count != 7 || *jitter != 0 || *lossWarn != 3 || *format != "table" {
+		t.Errorf("合并结果不一致: isp=%s p=%d jitter=%s loss-warn=%g format=%s", *isp, *count, *jitter, *lossWarn, *format)
+	}
+	want := map[string]string{"isp": internal.SourceFile, "p": internal.SourceEnv, "jitter": internal.SourceFile, "loss-warn": internal.SourceFlag, "format": internal.SourceDefault}
+	for name, source := range want {
+		if cfg.Sources[name] != source {
+			t.Errorf("参数 %s 的来源为 %s，期望 %s", name, cfg.Sources[name], source)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := internal.WriteConfig(&buf, fs, cfg); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"isp: 联通 # 配置文件", "p: 7 # 环境变量 DPING_P", "jitter: 0s # 配置文件", "loss-warn: 3 # 命令行", "format: table # 默认值"} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("输出中缺少 '%s':\n%s", line, buf.String())
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("cnt: 3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := internal.LoadConfig(flag.NewFlagSet("test", flag.ContinueOnError), path, true); err == nil || !strings.Contains(err.Error(), "不支持的参数 'cnt'") {
+		t.Errorf("未知参数应返回错误，实际为 %v", err)
+	}
+}
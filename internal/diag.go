@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// debugInterval 调试模式下输出运行时统计的间隔
+const debugInterval = 10 * time.Second
+
+// DiagOptions 现场排查大规模运行性能问题（协程泄漏、通道阻塞、套接字耗尽）用的诊断参数
+type DiagOptions struct {
+	PprofAddr string // 非空时在该地址提供 /debug/pprof/
+	Debug     bool   // 周期输出协程数、堆内存、GC 次数和打开的文件/套接字数
+	Auth      HTTPAuth
+}
+
+// StartDiagnostics 按参数启动 pprof 服务和周期统计，返回的函数用于停止；地址无法监听时返回错误
+func StartDiagnostics(opts DiagOptions) (func(), error) {
+	var stops []func()
+	if opts.PprofAddr != "" {
+		ln, scheme, err := opts.Auth.listen("pprof", opts.PprofAddr)
+		if err != nil {
+			return nil, err
+		}
+		server := &http.Server{Handler: pprofHandler(opts.Auth)}
+		go server.Serve(ln)
+		fmt.Fprintf(os.Stderr, "✅ pprof 已启动: %s://%s/debug/pprof/\n", scheme, ln.Addr())
+		stops = append(stops, func() { server.Close() })
+	}
+	if opts.Debug {
+		done, finished := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(finished)
+			ticker := time.NewTicker(debugInterval)
+			defer ticker.Stop()
+			logRuntimeStats()
+			for {
+				select {
+				case <-ticker.C:
+					logRuntimeStats()
+				case <-done:
+					logRuntimeStats()
+					return
+				}
+			}
+		}()
+		stops = append(stops, func() {
+			close(done)
+			<-finished
+		})
+	}
+	return func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}, nil
+}
+
+// pprofHandler 只提供 /debug/pprof/ 下的诊断接口，按 auth 要求认证；不使用 net/http/pprof 注册的 DefaultServeMux
+func pprofHandler(auth HTTPAuth) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return auth.wrap(mux)
+}
+
+// logRuntimeStats 输出一次运行时统计
+func logRuntimeStats() {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	line := fmt.Sprintf("🔍 协程 %d，堆内存 %.1fMB（对象 %d），系统内存 %.1fMB，GC %d 次",
+		runtime.NumGoroutine(), float64(m.HeapAlloc)/(1<<20), m.HeapObjects, float64(m.Sys)/(1<<20), m.NumGC)
+	if files, sockets, ok := openFiles(); ok {
+		line += fmt.Sprintf("，打开文件 %d（套接字 %d）", files, sockets)
+	}
+	log.Println(line)
+}
+
+// openFiles 统计本进程打开的文件和其中的套接字数，只在有 /proc 的系统上可用
+func openFiles() (files int, sockets int, ok bool) {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0, 0, false
+	}
+	for _, e := range entries {
+		files++
+		if target, err := os.Readlink("/proc/self/fd/" + e.Name()); err == nil && strings.HasPrefix(target, "socket:") {
+			sockets++
+		}
+	}
+	return files, sockets, true
+}
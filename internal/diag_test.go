@@ -0,0 +1,102 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDiagnosticsAuth(t *testing.T) {
+	// 先取一个空闲端口
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	stop, err := internal.StartDiagnostics(internal.DiagOptions{PprofAddr: addr, Auth: internal.HTTPAuth{BasicAuth: "ops:pw", Token: "t0ken"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	for _, c := range []struct {
+		name string
+		set  func(*http.Request)
+		want int
+	}{
+		{"无认证", func(*http.Request) {}, http.StatusUnauthorized},
+		{"错误令牌", func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") }, http.StatusUnauthorized},
+		{"令牌", func(r *http.Request) { r.Header.Set("Authorization", "Bearer t0ken") }, http.StatusOK},
+		{"错误密码", func(r *http.Request) { r.SetBasicAuth("ops", "x") }, http.StatusUnauthorized},
+		{"Basic", func(r *http.Request) { r.SetBasicAuth("ops", "pw") }, http.StatusOK},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/debug/pprof/", nil)
+		c.set(req)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.want {
+			t.Errorf("%s: 状态码为 %d，应为 %d", c.name, resp.StatusCode, c.want)
+		}
+	}
+
+	for _, bad := range []internal.HTTPAuth{{BasicAuth: "nopass"}, {TLSCert: "cert.pem"}, {ClientCA: "ca.pem"}} {
+		if _, err := internal.StartDiagnostics(internal.DiagOptions{PprofAddr: "127.0.0.1:0", Auth: bad}); err == nil {
+			t.Errorf("%+v 应报错", bad)
+		}
+	}
+}
+
+func TestPprofHandler(t *testing.T) {
+	auth := internal.HTTPAuth{Token: "t0ken"}
+	server := httptest.NewServer(internal.PprofHandler(auth))
+	defer server.Close()
+	get := func(base, path, token string) int {
+		req, _ := http.NewRequest(http.MethodGet, base+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// pprof 的每个接口都要求认证
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/pprof/symbol", "/debug/pprof/heap", "/debug/pprof/goroutine"} {
+		if code := get(server.URL, path, ""); code != http.StatusUnauthorized {
+			t.Errorf("%s 未认证时应返回 401，实际为 %d", path, code)
+		}
+		if code := get(server.URL, path, "t0ken"); code != http.StatusOK {
+			t.Errorf("%s 认证后应返回 200，实际为 %d", path, code)
+		}
+	}
+	// 只提供 /debug/pprof/ 下的接口
+	if code := get(server.URL, "/", "t0ken"); code != http.StatusNotFound {
+		t.Errorf("/ 应返回 404，实际为 %d", code)
+	}
+
+	// 未指定 -pprof 时，-metrics 和 -ws 的服务不提供 pprof
+	metrics, err := internal.StartMetrics("127.0.0.1:0", auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer metrics.Close()
+	stream, err := internal.StartStream("127.0.0.1:0", auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	for name, addr := range map[string]net.Addr{"-metrics": metrics.Addr(), "-ws": stream.Addr()} {
+		if code := get("http://"+addr.String(), "/debug/pprof/", "t0ken"); code != http.StatusNotFound {
+			t.Errorf("%s 的服务不应提供 /debug/pprof/，实际返回 %d", name, code)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AlertDigest 每日汇总的状态，与告警事件共用推送地址，接收方按 status 区分
+const AlertDigest = "digest"
+
+// digestTopN 每日汇总中列出的劣化最多的目标数
+const digestTopN = 10
+
+// Digest 持续探测的每日汇总：各运营商的平均 RTT 和丢包率与前一天对比，以及评分下降最多的目标，时间以毫秒表示
+type Digest struct {
+	Status      string              `json:"status"` // 固定为 digest
+	From        time.Time           `json:"from"`
+	To          time.Time           `json:"to"`
+	Rounds      int                 `json:"rounds"`
+	Isps        []*DigestIsp        `json:"isps"`
+	Regressions []*DigestRegression `json:"regressions"`
+}
+
+// DigestIsp 一个运营商在汇总周期内按包数汇总的结果，前一天没有该运营商的数据时 Prev 字段省略
+type DigestIsp struct {
+	Isp             string   `json:"isp"`
+	Sent            int      `json:"sent"`
+	Recv            int      `json:"recv"`
+	LossPercent     float64  `json:"loss_percent"`
+	AvgRttMs        float64  `json:"avg_rtt_ms"`
+	PrevLossPercent *float64 `json:"prev_loss_percent,omitempty"`
+	PrevAvgRttMs    *float64 `json:"prev_avg_rtt_ms,omitempty"`
+}
+
+// DigestRegression 与前一天相比评分下降的目标，评分按 -score-weights 的丢包和 RTT 权重计算
+type DigestRegression struct {
+	DestIP          string  `json:"dest_ip"`
+	Region          string  `json:"region"`
+	Isp             string  `json:"isp"`
+	Source          string  `json:"source,omitempty"`
+	LossPercent     float64 `json:"loss_percent"`
+	PrevLossPercent float64 `json:"prev_loss_percent"`
+	AvgRttMs        float64 `json:"avg_rtt_ms"`
+	PrevAvgRttMs    float64 `json:"prev_avg_rtt_ms"`
+	ScoreDrop       float64 `json:"score_drop"`
+}
+
+// DigestSink 能接收每日汇总的 AlertSink
+type DigestSink interface {
+	NotifyDigest(d *Digest) error
+}
+
+// digestTotals 汇总周期内一个目标或运营商的累计包数，RTT 按收包数加权
+type digestTotals struct {
+	row       *SnapshotRow // 目标的标识，运营商汇总时只用到 Isp
+	sent      int
+	recv      int
+	rttWeight float64 // Σ AvgRttMs × Recv
+}
+
+func (t *digestTotals) add(row *SnapshotRow) {
+	t.sent += row.Sent
+	t.recv += row.Recv
+	t.rttWeight += row.AvgRttMs * float64(row.Recv)
+}
+
+func (t *digestTotals) loss() float64 {
+	if t.sent == 0 {
+		return 0
+	}
+	return float64(t.sent-t.recv) / float64(t.sent) * 100
+}
+
+func (t *digestTotals) avgRtt() float64 {
+	if t.recv == 0 {
+		return 0
+	}
+	return t.rttWeight / float64(t.recv)
+}
+
+// digestWindow 一个汇总周期内累计的结果
+type digestWindow struct {
+	start   time.Time
+	rounds  int
+	targets map[string]*digestTotals
+	isps    map[string]*digestTotals
+}
+
+func newDigestWindow(start time.Time) *digestWindow {
+	return &digestWindow{start: start, targets: make(map[string]*digestTotals), isps: make(map[string]*digestTotals)}
+}
+
+// Digester 累计持续探测每轮的结果，每天在固定时刻将过去一天与前一天对比后发送汇总，与实时告警互不影响
+type Digester struct {
+	at      time.Duration // 每天发送的时刻，距当地零点的时长
+	weights ScoreWeights
+	sinks   []AlertSink
+	next    time.Time
+	curr    *digestWindow
+	prev    *digestWindow
+}
+
+// NewDigester 创建每日汇总，start 为开始探测的时间，汇总发送给实现了 DigestSink 的 sinks
+func NewDigester(at time.Duration, start time.Time, weights ScoreWeights, sinks ...AlertSink) *Digester {
+	return &Digester{at: at, weights: weights, sinks: sinks, next: nextDigestTime(start, at), curr: newDigestWindow(start)}
+}
+
+// newDigester 按参数创建每日汇总：总是输出到日志，指定 Webhook 时同时推送；未指定 -digest 时返回 nil
+func newDigester(opts WatchOptions, weights ScoreWeights, start time.Time) *Digester {
+	at, err := parseDigestTime(opts.Digest)
+	if opts.Digest == "" || err != nil {
+		return nil
+	}
+	return NewDigester(at, start, weights, notifySinks(opts.Alert)...)
+}
+
+// parseDigestTime 解析 -digest 的发送时刻 HH:MM，返回距零点的时长
+func parseDigestTime(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("每日汇总时刻 -digest '%s' 无效，格式为 HH:MM，如 09:00", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// nextDigestTime 返回 now 之后下一个发送时刻
+func nextDigestTime(now time.Time, at time.Duration) time.Time {
+	y, m, d := now.Date()
+	next := time.Date(y, m, d, 0, 0, 0, 0, now.Location()).Add(at)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// Add 累计一轮探测的结果（全部丢包的目标按其发包数计入），到达发送时刻时发送并返回汇总，否则返回 nil
+func (d *Digester) Add(snap *Snapshot, now time.Time) *Digest {
+	if d == nil {
+		return nil
+	}
+	d.curr.rounds++
+	// 同一 IP 以多个地区出现时，运营商汇总中每轮只计一次
+	seen := make(map[string]bool)
+	for _, row := range slices.Concat(snap.Rows, snap.Unanswered) {
+		key := strings.Join([]string{row.DestIP, row.Isp, row.Region, row.Source, row.Proto}, "|")
+		if d.curr.targets[key] == nil {
+			d.curr.targets[key] = &digestTotals{row: row}
+		}
+		d.curr.targets[key].add(row)
+		if ipKey := row.Isp + "|" + row.DestIP + "|" + row.Source; !seen[ipKey] {
+			seen[ipKey] = true
+			if d.curr.isps[row.Isp] == nil {
+				d.curr.isps[row.Isp] = &digestTotals{row: row}
+			}
+			d.curr.isps[row.Isp].add(row)
+		}
+	}
+	if now.Before(d.next) {
+		return nil
+	}
+
+	digest := d.build(now)
+	for _, sink := range d.sinks {
+		if ds, ok := sink.(DigestSink); ok {
+			if err := ds.NotifyDigest(digest); err != nil {
+				log.Printf("⚠️  发送每日汇总失败: %v\n", err)
+			}
+		}
+	}
+	d.prev, d.curr = d.curr, newDigestWindow(now)
+	for !d.next.After(now) {
+		d.next = d.next.AddDate(0, 0, 1)
+	}
+	return digest
+}
+
+// build 生成当前周期与前一周期对比的汇总
+func (d *Digester) build(now time.Time) *Digest {
+	digest := &Digest{Status: AlertDigest, From: d.curr.start, To: now, Rounds: d.curr.rounds, Isps: []*DigestIsp{}, Regressions: []*DigestRegression{}}
+	for isp, t := range d.curr.isps {
+		item := &DigestIsp{Isp: isp, Sent: t.sent, Recv: t.recv, LossPercent: t.loss(), AvgRttMs: t.avgRtt()}
+		if d.prev != nil && d.prev.isps[isp] != nil {
+			prev := d.prev.isps[isp]
+			loss, avg := prev.loss(), prev.avgRtt()
+			item.PrevLossPercent, item.PrevAvgRttMs = &loss, &avg
+		}
+		digest.Isps = append(digest.Isps, item)
+	}
+	sort.Slice(digest.Isps, func(i, j int) bool { return digest.Isps[i].Isp < digest.Isps[j].Isp })
+
+	if d.prev == nil {
+		return digest
+	}
+	for key, t := range d.curr.targets {
+		prev := d.prev.targets[key]
+		if prev == nil {
+			continue
+		}
+		drop := d.score(prev) - d.score(t)
+		if drop <= 0 {
+			continue
+		}
+		digest.Regressions = append(digest.Regressions, &DigestRegression{
+			DestIP:          t.row.DestIP,
+			Region:          t.row.Region,
+			Isp:             t.row.Isp,
+			Source:          t.row.Source,
+			LossPercent:     t.loss(),
+			PrevLossPercent: prev.loss(),
+			AvgRttMs:        t.avgRtt(),
+			PrevAvgRttMs:    prev.avgRtt(),
+			ScoreDrop:       drop,
+		})
+	}
+	sort.Slice(digest.Regressions, func(i, j int) bool {
+		a, b := digest.Regressions[i], digest.Regressions[j]
+		if a.ScoreDrop != b.ScoreDrop {
+			return a.ScoreDrop > b.ScoreDrop
+		}
+		return a.DestIP+a.Region+a.Isp+a.Source < b.DestIP+b.Region+b.Isp+b.Source
+	})
+	if len(digest.Regressions) > digestTopN {
+		digest.Regressions = digest.Regressions[:digestTopN]
+	}
+	return digest
+}
+
+// score 按丢包和平均 RTT 计算汇总周期的评分，跨轮的抖动无法从每轮结果合并，不计入
+func (d *Digester) score(t *digestTotals) float64 {
+	return d.weights.score(&SummaryStatistic{PacketLoss: t.loss(), AvgRtt: msToDuration(t.avgRtt())})
+}
+
+func (logSink) NotifyDigest(d *Digest) error {
+	log.Printf("📊 每日汇总：%s ~ %s，共 %d 轮\n", d.From.Format("01-02 15:04"), d.To.Format("01-02 15:04"), d.Rounds)
+	for _, isp := range d.Isps {
+		line := fmt.Sprintf("  %s 平均 RTT %.1fms，丢包率 %.1f%%", isp.Isp, isp.AvgRttMs, isp.LossPercent)
+		if isp.PrevAvgRttMs != nil {
+			line += fmt.Sprintf("（前一天 %.1fms，%+.1fms；丢包率 %.1f%%）", *isp.PrevAvgRttMs, isp.AvgRttMs-*isp.PrevAvgRttMs, *isp.PrevLossPercent)
+		} else {
+			line += "（前一天无数据）"
+		}
+		log.Println(line)
+	}
+	for i, r := range d.Regressions {
+		target := fmt.Sprintf("%s%s %s", r.Region, r.Isp, r.DestIP)
+		if r.Source != "" {
+			target += "（源 " + r.Source + "）"
+		}
+		log.Printf("  劣化第 %d：%s 评分 -%.1f，平均 RTT %.1fms → %.1fms，丢包率 %.1f%% → %.1f%%\n",
+			i+1, target, r.ScoreDrop, r.PrevAvgRttMs, r.AvgRttMs, r.PrevLossPercent, r.LossPercent)
+	}
+	return nil
+}
+
+func (s *webhookSink) NotifyDigest(d *Digest) error {
+	return s.post(d)
+}
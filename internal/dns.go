@@ -0,0 +1,195 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-ping/ping"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// defaultDNSQuery DNS 探测默认查询的域名
+const defaultDNSQuery = "www.baidu.com"
+
+// dnssecFailedName 签名故意出错的域名，校验 DNSSEC 的解析服务器对它返回 SERVFAIL，不校验的照常返回 A 记录
+const dnssecFailedName = "dnssec-failed.org."
+
+// 应答中没有 A 记录时记录的解析结果：域名不存在，或域名存在但没有 A 记录
+const (
+	dnsNXDomain = "NXDOMAIN"
+	dnsNoData   = "NODATA"
+)
+
+// dnsProber 向目标发送 DNS 查询（UDP，A 记录，要求递归），以收到应答的耗时作为 RTT；
+// 应答为 NOERROR 或 NXDOMAIN 视为收到，SERVFAIL、REFUSED 等说明解析服务异常，按丢包计。
+// 各次应答中的 A 记录作为附加结果，用于比较各地解析服务器的结果是否一致；
+// 指定了客户端子网（ECS）或检查 DNSSEC 时，测量结束后再分别查询，结果不计入收发包统计
+type dnsProber struct {
+	detailResults
+	port   int
+	query  string
+	pace   time.Duration
+	ecs    []ecsSubnet
+	dnssec bool
+	vrf    string
+}
+
+func (p *dnsProber) Probe(to net.IP, sourceIP net.IP, count int, adaptive AdaptiveOptions) (*ping.Statistics, error) {
+	conn, err := dialUDP("udp", sourceIP, &net.UDPAddr{IP: to, Port: p.port}, p.vrf)
+	if err != nil {
+		return nil, fmt.Errorf("DNS Start Error: %w", err)
+	}
+	defer conn.Close()
+
+	name, err := dnsmessage.NewName(dnsFQDN(p.query))
+	if err != nil {
+		return nil, fmt.Errorf("DNS Query Error: %v", err)
+	}
+	answers := make(map[string]bool)
+	stats, err := probeLoop(to, count, adaptive, packetInterval(p.pace, adaptive.maxPackets(count)), func() (time.Duration, error) {
+		rtt, ips, err := dnsOnce(conn, name, nil)
+		for _, ip := range ips {
+			answers[ip] = true
+		}
+		return rtt, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("DNS Query Error: %w", err)
+	}
+	// 持续探测时同一个 Prober 探测多轮，本轮没有应答时也要覆盖上一轮的结果
+	details := &ProbeDetails{}
+	if stats.PacketsRecv > 0 {
+		details.DNSAnswers = slices.Sorted(maps.Keys(answers))
+	}
+	for _, e := range p.ecs {
+		// 查询失败的子网不记录，与没有应答的解析服务器一样不参与分组
+		if _, ips, err := dnsOnce(conn, name, &e); err == nil {
+			slices.Sort(ips)
+			details.ECSAnswers = append(details.ECSAnswers, &ECSAnswer{Label: e.label, Subnet: e.prefix.String(), Answers: slices.Compact(ips)})
+		}
+	}
+	// 正常查询都没有应答时 SERVFAIL 不能说明在校验签名
+	if p.dnssec && stats.PacketsRecv > 0 {
+		details.DNSSEC = dnssecValidating(conn)
+	}
+	p.set(to, sourceIP, details)
+	return stats, nil
+}
+
+// dnsOnce 发送一次查询并等待对应的应答，返回往返时间和应答中的 A 记录（没有时为 NXDOMAIN 或 NODATA）；
+// ecs 不为 nil 时查询携带该客户端子网
+func dnsOnce(conn *net.UDPConn, name dnsmessage.Name, ecs *ecsSubnet) (time.Duration, []string, error) {
+	id := uint16(rand.N(1 << 16))
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+	}
+	if ecs != nil {
+		var h dnsmessage.ResourceHeader
+		if err := h.SetEDNS0(ecsUDPSize, dnsmessage.RCodeSuccess, false); err != nil {
+			return 0, nil, err
+		}
+		msg.Additionals = []dnsmessage.Resource{{Header: h, Body: &dnsmessage.OPTResource{Options: []dnsmessage.Option{ecs.option()}}}}
+	}
+	req, err := msg.Pack()
+	if err != nil {
+		return 0, nil, err
+	}
+	start := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, nil, err
+	}
+
+	conn.SetReadDeadline(start.Add(probeTimeout))
+	bufp := packetPool.Get().(*[]byte)
+	defer packetPool.Put(bufp)
+	resp := *bufp
+	for {
+		n, err := conn.Read(resp)
+		if err != nil {
+			return 0, nil, err
+		}
+		rtt := time.Since(start)
+		var parser dnsmessage.Parser
+		header, err := parser.Start(resp[:n])
+		// 只接受对本次查询的应答，之前超时的查询迟到的应答丢弃
+		if err != nil || !header.Response || header.ID != id {
+			continue
+		}
+		switch header.RCode {
+		case dnsmessage.RCodeSuccess:
+			if ips := dnsARecords(&parser); len(ips) > 0 {
+				return rtt, ips, nil
+			}
+			return rtt, []string{dnsNoData}, nil
+		case dnsmessage.RCodeNameError:
+			return rtt, []string{dnsNXDomain}, nil
+		}
+		return 0, nil, &dnsRCodeError{rcode: header.RCode}
+	}
+}
+
+// dnsRCodeError 应答的 RCODE 表示解析服务异常（SERVFAIL、REFUSED 等）
+type dnsRCodeError struct {
+	rcode dnsmessage.RCode
+}
+
+func (e *dnsRCodeError) Error() string {
+	return fmt.Sprintf("DNS 应答 %s", strings.TrimPrefix(e.rcode.String(), "RCode"))
+}
+
+// dnssecValidating 查询签名出错的域名判断解析服务器是否校验 DNSSEC：SERVFAIL 为校验，正常应答为不校验，
+// 超时或其他应答无法判断，返回 nil
+func dnssecValidating(conn *net.UDPConn) *bool {
+	name := dnsmessage.MustNewName(dnssecFailedName)
+	_, _, err := dnsOnce(conn, name, nil)
+	var rcodeErr *dnsRCodeError
+	switch {
+	case err == nil:
+		validating := false
+		return &validating
+	case errors.As(err, &rcodeErr) && rcodeErr.rcode == dnsmessage.RCodeServerFailure:
+		validating := true
+		return &validating
+	}
+	return nil
+}
+
+// dnsARecords 返回应答中的 A 记录，CNAME 等其他记录跳过；应答格式有误时返回已解析的部分
+func dnsARecords(parser *dnsmessage.Parser) []string {
+	if parser.SkipAllQuestions() != nil {
+		return nil
+	}
+	var ips []string
+	for {
+		h, err := parser.AnswerHeader()
+		if err != nil {
+			return ips
+		}
+		if h.Type != dnsmessage.TypeA {
+			if parser.SkipAnswer() != nil {
+				return ips
+			}
+			continue
+		}
+		a, err := parser.AResource()
+		if err != nil {
+			return ips
+		}
+		ips = append(ips, net.IP(a.A[:]).String())
+	}
+}
+
+// dnsFQDN 补全域名末尾的点
+func dnsFQDN(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// DNSCluster DNS 探测中返回相同解析结果的一组解析服务器；各地结果不同时可能是 GSLB 或分区解析配置有误
+type DNSCluster struct {
+	Answers   []string          `json:"answers"` // A 记录（去重排序），没有 A 记录时为 NXDOMAIN（域名不存在）或 NODATA
+	Resolvers []*DNSClusterItem `json:"resolvers"`
+}
+
+// DNSClusterItem 一个解析服务器，与 rows[] 中的行对应
+type DNSClusterItem struct {
+	DestIP string `json:"dest_ip"`
+	Region string `json:"region"`
+	Isp    string `json:"isp"`
+	Source string `json:"source,omitempty"`
+}
+
+// label 表格中显示的解析服务器，如 "北京电信 202.96.199.133"
+func (i *DNSClusterItem) label() string {
+	s := i.Region + i.Isp + " " + i.DestIP
+	if i.Source != "" {
+		s += "（源 " + i.Source + "）"
+	}
+	return s
+}
+
+// dnsClusters 将有应答的 DNS 探测结果按解析结果分组，解析服务器多的组在前；没有 DNS 探测结果时返回 nil
+func dnsClusters(rows []*SnapshotRow) []*DNSCluster {
+	return clusterAnswers(rows, func(row *SnapshotRow) []string { return row.DNSAnswers })
+}
+
+// clusterAnswers 按 answers 取出的解析结果对各行分组，解析结果为 nil 的行跳过
+func clusterAnswers(rows []*SnapshotRow, answers func(*SnapshotRow) []string) []*DNSCluster {
+	byAnswers := make(map[string]*DNSCluster)
+	var clusters []*DNSCluster
+	for _, row := range rows {
+		list := answers(row)
+		if list == nil {
+			continue
+		}
+		key := strings.Join(list, ",")
+		c := byAnswers[key]
+		if c == nil {
+			c = &DNSCluster{Answers: list}
+			byAnswers[key] = c
+			clusters = append(clusters, c)
+		}
+		c.Resolvers = append(c.Resolvers, &DNSClusterItem{DestIP: row.DestIP, Region: row.Region, Isp: row.Isp, Source: row.Source})
+	}
+	sort.SliceStable(clusters, func(i, j int) bool {
+		if len(clusters[i].Resolvers) != len(clusters[j].Resolvers) {
+			return len(clusters[i].Resolvers) > len(clusters[j].Resolvers)
+		}
+		return strings.Join(clusters[i].Answers, ",") < strings.Join(clusters[j].Answers, ",")
+	})
+	return clusters
+}
+
+// printDNSClusters 输出各解析服务器的解析结果分组，只有一组时说明各地结果一致
+func (r *TableRenderer) printDNSClusters(w io.Writer, clusters []*DNSCluster) {
+	fmt.Fprintln(w, "====== DNS 解析一致性 ======")
+	if len(clusters) == 1 {
+		fmt.Fprintf(w, "%d 个解析服务器的结果一致: %s\n", len(clusters[0].Resolvers), strings.Join(clusters[0].Answers, ", "))
+		return
+	}
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"解析结果", "服务器数", "解析服务器"})
+	table.SetAutoFormatHeaders(false)
+	table.SetAutoWrapText(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetBorder(false)
+	table.SetColumnSeparator(" ")
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	for i, c := range clusters {
+		var resolvers []string
+		for _, item := range c.Resolvers {
+			resolvers = append(resolvers, item.label())
+		}
+		answers := strings.Join(c.Answers, ", ")
+		// 多数解析服务器的结果之外的组着色，便于找出配置不一致的地区
+		if i > 0 {
+			answers = r.Theme.color(r.Theme.Warn, answers)
+		}
+		table.Append([]string{answers, fmt.Sprintf("%d", len(c.Resolvers)), strings.Join(resolvers, "，")})
+	}
+	table.Render()
+}
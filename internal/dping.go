@@ -1,213 +1,806 @@
 package internal
 
 import (
-	"encoding/json"
+	"bytes"
+	"cmp"
+	"crypto/ed25519"
 	"fmt"
 	"log"
+	"math/rand/v2"
 	"net"
+	"os"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-ping/ping"
+	"github.com/google/uuid"
 )
 
-var (
-	statsStore    = NewPingStatsStore(25) // 初始化数据存储，最多保存25条最近记录
-	wgHandleDPing sync.WaitGroup
-)
+// OutputOptions 结果输出相关参数
+type OutputOptions struct {
+	Format        string         // 标准输出格式：table、json 或 template
+	Theme         string         // table 格式的配色方案：default、colorblind、mono 或 none
+	IspColors     string         // 覆盖配色方案中运营商的颜色，如 电信=#39ff14,联通=#00b4ff，为空时使用主题的颜色
+	Loss          LossThresholds // table 格式的丢包着色阈值
+	Wide          bool           // table 格式始终输出全部列，不按终端宽度隐藏低优先级列
+	NoPager       bool           // 结果超过一屏时也不使用分页程序
+	Quiet         bool           // 不在标准输出显示结果，只保存和推送（多租户时各租户的结果不混在一起）
+	TUI           bool           // 探测结束后进入交互界面查看结果
+	Template      string         // template 格式下每行汇总数据使用的模板
+	RunTemplate   string         // template 格式下整次运行使用的模板，在所有行之后输出一次
+	OutPath       string         // 非空时无论 Format 为何，都将结构化结果写入该文件
+	RecordPath    string         // 非空时将每个目标的探测结果录制到该文件，供 dping replay 回放
+	SavePath      string         // 非空时将汇总结果保存为快照文件，供 compare 对比
+	Budget        string         // 非空时按应用类型的时延预算评估结果：voip、gaming 或 web
+	GeoFrom       string         // 非空时为探测节点所在省份，按到各目标省份的地理距离估算预期 RTT，标出绕行的线路
+	ScoreWeights  string         // 综合评分的权重，如 loss=2,rtt=0.2,jitter=0.5，为空时使用默认权重
+	Note          string         // 本次运行的备注，保存在快照中并显示在对比、报告的标题处
+	LocalIsp      string         // 探测主机所在的运营商，保存在快照中，多观测点对比时用于汇总运营商间的互联时延
+	SignKey       string         // 非空时为 Ed25519 私钥文件，以其签名每轮的快照（保存、推送和 json 输出的结果），见 SignSnapshot
+	Progress      string         // 标准错误不是终端时的进度输出频率：时长（如 30s）、百分比（如 10%）或 off，为空时每 10 秒一行
+	RecommendPath string         // 非空时将多源探测的多线路推荐单独写入该 JSON 文件
+	GroupBy       string         // 非空时分组汇总按该模板（如 {{.Isp}}-{{.Region}}、{{.Tags.dc}}）的结果分组，代替按运营商分组
+	Aggregate     string         // 非空时同一模板结果（如 {{.Region}}{{.Isp}}）的多个目标视为一个服务，汇总为一行
+	CompareLast   bool           // 与用户缓存目录中上次运行的结果对比，标注丢包率和平均 RTT 的变化，并保存本次结果供下次对比
+}
 
-func DPing(isp string, detection string, maxConcurrency int, count int, eth string, sort string, des bool) {
+// runConfig 一次运行的有效参数，实时探测和回放共用
+type runConfig struct {
+	isp            string
+	region         string
+	localIPs       []net.IP // 各源IP，未指定网卡时只有一个 nil（系统默认）
+	localIPStr     string
+	src6           net.IP            // IPv6 目标使用的源地址（-src6），为 nil 时为系统默认
+	interfaces     map[string]string // 源IP -> 网卡名，用于多线路推荐的显示
+	maxConcurrency int
+	groupLimits    map[string]int // 按运营商或地区单独限制的并发数
+	priority       []string       // 先探测的地区、运营商或目标IP
+	count          int
+	sort           string
+	des            bool
+	jitter         time.Duration
+	resultBuffer   int           // 探测结果通道的缓冲区长度
+	resultSpill    bool          // 结果经不限长度的内存队列交给汇总，探测协程不等待
+	spread         time.Duration // 非 0 时每轮的各个探测按顺序均匀分布在该时长内开始（-spread），代替随机偏移
+	adaptive       AdaptiveOptions
+	protocols      []protocolProber               // 同时使用多个探测方式时的各 Prober，为空时只使用传入的 Prober
+	overrides      map[TargetProbe]protocolProber // 目标文件中单独指定了探测方式或端口的目标使用的 Prober，键中 Count 为 0
+	output         OutputOptions
+	renderer       Renderer
+	watch          WatchOptions              // Interval 非 0 时持续探测
+	streaks        *LossStreaks              // 持续探测时各轮共用的连续丢包记录
+	previous       *Snapshot                 // 开启 CompareLast 时上次运行（持续探测时为上一轮）的结果
+	interim        func([]*SummaryStatistic) // 优先目标探测完成后输出其结果（按运营商分组），为 nil 时不输出
+	cache          *probeCache               // 指定 -cache 时的探测结果缓存，为 nil 时不缓存
+	stream         *Stream                   // 实时推送，为 nil 时不推送
+	metrics        *Metrics                  // Prometheus 指标，为 nil 时不导出
+	backend        StatsBackend              // 保存原始结果的持久化后端（-store），为 nil 时不保存
+	signKey        ed25519.PrivateKey        // 签名快照的私钥（-sign-key），为 nil 时不签名
+	starts         *startLimiter             // 限制每秒开始的探测数，为 nil 时不限制
+	hooks          *probeHooks               // 探测前后执行的外部命令，为 nil 时不执行
+	gatewayCheck   func() []*GatewayCheck    // 指定 -check-gateway 时每轮探测前检查默认网关，为 nil 时不检查
+}
 
-	sem := make(chan struct{}, maxConcurrency) //限制并发数
-	// 获取指定网卡IP
-	localIP, _ := getPrimaryLocalIP(eth)
+// protocolProber 多个探测方式之一，label 写入该方式每条结果的 Proto
+type protocolProber struct {
+	label  string
+	prober Prober
+}
 
-	// 解析DNS配置
-	DnsBuffer := &DNSConfig{}
-	if err := json.Unmarshal([]byte(JsonData), DnsBuffer); err != nil {
-		fmt.Println("Dns-Buffer-解析异常:", err)
-		return
+// DPing 按参数探测全部目标并输出结果，指定 Watch.Interval 时持续探测，收到 Ctrl-C 或 SIGTERM 后返回；
+// 参数错误或无法开始探测时返回错误
+func DPing(opts Options) (*Result, error) {
+	opts = opts.withDefaults()
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	output, watchOpts := opts.Output, opts.Watch
+	if watchOpts.Interval > 0 {
+		// 每轮都输出结果，分页程序会阻塞后续探测
+		output.NoPager = true
 	}
 
-	// 验证并处理运营商参数
-	validIsps := map[string]bool{"电信": true, "联通": true, "移动": true, "all": true}
-	ispVal := isp
-	if !validIsps[ispVal] {
-		log.Printf("⚠️  不支持的运营商 '%s'，已使用默认值 'all'\n", ispVal)
-		ispVal = "all"
+	// 输出参数在探测前校验，避免跑完全部目标后才发现模板或主题写错
+	renderer, err := prepareOutput(&output)
+	if err != nil {
+		return nil, err
+	}
+	cfg, targets, prober, err := prepareRun(opts)
+	if err != nil {
+		return nil, err
+	}
+	cfg.output, cfg.renderer, cfg.watch, cfg.stream, cfg.metrics = output, renderer, watchOpts, opts.Stream, opts.Metrics
+	if watchOpts.Interval > 0 {
+		cfg.streaks = NewLossStreaks()
+	}
+	if watchOpts.Spread {
+		cfg.spread = watchOpts.Interval
+	}
+	if output.CompareLast {
+		if cfg.previous = loadLastRun(runStateDir()); cfg.previous != nil {
+			fmt.Fprintf(os.Stderr, "✅ 与上次运行（%s）的结果对比\n", cfg.previous.CreatedAt.Format(time.DateTime))
+		}
+	}
+	backend, err := OpenStatsBackend(opts.Store)
+	if err != nil {
+		return nil, err
+	}
+	defer backend.Close()
+	cfg.backend = backend
+	if output.SignKey != "" {
+		if cfg.signKey, err = LoadSigningKey(output.SignKey); err != nil {
+			return nil, err
+		}
+	}
+	if watchOpts.Chart != "" {
+		if err := checkChartSelector(watchOpts.Chart, targets); err != nil {
+			return nil, err
+		}
+		cfg.renderer = &ChartRenderer{Selector: watchOpts.Chart, Width: terminalWidth(), Clear: terminalWidth() > 0}
 	}
 
-	// 验证并处理区域参数
-	regionVal := detection
-	if regionVal != "全国" && !isRegionExist(ispVal, regionVal, DnsBuffer) {
-		log.Printf("⚠️  区域 '%s' 不存在于运营商 '%s' 中，已使用默认值 '全国'\n", regionVal, ispVal)
-		regionVal = "全国"
+	if output.RecordPath != "" {
+		if len(cfg.overrides) > 0 {
+			return nil, fmt.Errorf("目标文件中有单独指定 proto 或 port 的目标，不能同时使用 -record")
+		}
+		recorder, err := newSessionRecorder(output.RecordPath, cfg, targets, prober)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := recorder.Close(); err != nil {
+				log.Printf("⚠️  %v\n", err)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "✅ 探测过程已录制到 %s\n", output.RecordPath)
+		}()
+		prober = recorder
+	}
+	if watchOpts.Interval > 0 {
+		snap, rounds := watch(cfg, targets, prober)
+		return &Result{Snapshot: snap, Rounds: rounds}, nil
+	}
+	snap := execute(cfg, targets, prober)
+	newPusher(watchOpts.Push).Push(snap)
+	return &Result{Snapshot: snap, Rounds: 1}, nil
+}
+
+// prepareRun 校验探测参数，解析源IP并生成探测目标和 Prober；输出参数由调用方填入返回的 runConfig
+func prepareRun(opts Options) (*runConfig, []*Target, Prober, error) {
+	// 参数组合在探测前统一校验，不再静默回退到默认值
+	if err := ValidateParams(opts.Isp, opts.Region, opts.MaxConcurrency, opts.Count, opts.Jitter, opts.Adaptive, opts.Probe, opts.Targets, opts.Sort); err != nil {
+		return nil, nil, nil, err
+	}
+	ispVal, regionVal, eth, probe, targetOpts := opts.Isp, opts.Region, opts.Eth, opts.Probe, opts.Targets
+
+	// 获取指定网卡IP，未指定网卡（nil）时使用系统默认；指定了 -netns 时在该命名空间中查找网卡和地址
+	var localIPs []net.IP
+	var src6 net.IP
+	var interfaces map[string]string
+	if err := inNetns(probe.Netns, func() error {
+		var err error
+		localIPs, src6, interfaces, err = localSources(eth, probe)
+		return err
+	}); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// 解析DNS配置
+	DnsBuffer, catalogRegion, notes, err := targetCatalog(regionVal, targetOpts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, note := range notes {
+		log.Printf("⚠️  %s\n", note)
 	}
 
 	// 显示使用的本地IP
 	localIPStr := "系统默认"
-	if localIP != nil {
-		localIPStr = localIP.String()
+	if localIPs[0] != nil {
+		var ips []string
+		for _, ip := range localIPs {
+			ips = append(ips, ip.String())
+		}
+		localIPStr = strings.Join(ips, ",")
+	}
+	if src6 != nil {
+		localIPStr = fmt.Sprintf("%s（IPv4）、%s（IPv6）", localIPStr, src6)
+	}
+	if targetOpts.File != "" {
+		fmt.Fprintf(os.Stderr, "✅ 最终使用参数：目标文件=%s，源IP=%s\n", targetOpts.File, localIPStr)
+	} else if targetOpts.Catalog != "" {
+		fmt.Fprintf(os.Stderr, "✅ 最终使用参数：目标配置=%s，区域=%s，运营商=%s，源IP=%s\n",
+			targetOpts.Catalog, regionVal, ispVal, localIPStr)
+	} else {
+		fmt.Fprintf(os.Stderr, "✅ 最终使用参数：区域=%s，运营商=%s，源IP=%s\n",
+			regionVal, ispVal, localIPStr)
+	}
+	if targetOpts.Overlay != "" {
+		fmt.Fprintf(os.Stderr, "✅ 已叠加覆盖文件 %s\n", targetOpts.Overlay)
+	}
+	if probe.Netns != "" {
+		fmt.Fprintf(os.Stderr, "✅ 探测在网络命名空间 %s 中进行\n", probe.Netns)
+	}
+	if probe.VRF != "" {
+		fmt.Fprintf(os.Stderr, "✅ 探测从 VRF 设备 %s 发出\n", probe.VRF)
+	}
+	if probe.Multi() {
+		fmt.Fprintf(os.Stderr, "✅ 探测方式：%s，每个目标分别探测\n", strings.ReplaceAll(probe.Proto, ",", "、"))
+	} else if probe.Proto == "dns" {
+		fmt.Fprintf(os.Stderr, "✅ 探测方式：dns 端口 %d，查询 %s\n", probe.Port, probe.query())
+	} else if probe.Proto == "tcp" || probe.Proto == "http" || probe.Proto == "https" {
+		via := "直连"
+		if probe.Proxy != "" {
+			u, _ := parseProxyURL(probe.Proxy)
+			via = "经代理 " + u.Redacted()
+		}
+		fmt.Fprintf(os.Stderr, "✅ 探测方式：%s 端口 %d，%s\n", probe.Proto, probe.Port, via)
 	}
-	fmt.Printf("✅ 最终使用参数：区域=%s，运营商=%s，源IP=%s\n",
-		regionVal, ispVal, localIPStr)
 
-	// 初始化并发控制和统计通道
-	var wg sync.WaitGroup
-	ChStatistics := make(chan *PingStatistic, 20)
+	cfg := &runConfig{
+		isp:            ispVal,
+		region:         regionVal,
+		localIPs:       localIPs,
+		localIPStr:     localIPStr,
+		interfaces:     interfaces,
+		src6:           src6,
+		maxConcurrency: opts.MaxConcurrency,
+		groupLimits:    targetOpts.Concurrency,
+		priority:       targetOpts.priorityNames(),
+		count:          opts.Count,
+		sort:           opts.Sort,
+		des:            opts.Descending,
+		jitter:         opts.Jitter,
+		resultBuffer:   cmp.Or(opts.ResultBuffer, defaultResultBuffer),
+		resultSpill:    opts.ResultSpill,
+		adaptive:       opts.Adaptive,
+		starts:         newStartLimiter(opts.Rate),
+	}
+	if cfg.hooks, err = newProbeHooks(opts.Hooks); err != nil {
+		return nil, nil, nil, err
+	}
+	if probe.Cache > 0 {
+		cfg.cache = loadProbeCache(probeCachePath(), probe.Cache)
+	}
+	if probe.CheckGateway {
+		cfg.gatewayCheck = func() []*GatewayCheck { return checkGateways(probe.Netns) }
+	}
 
-	wgHandleDPing.Add(1) // 标记 HandleDPing 任务开始
-	go HandleDPing(ChStatistics, statsStore, &wgHandleDPing, sort, des)
+	// 汇总探测目标，同一IP出现在多个地区/运营商下时只探测一次，结果归属到所有标签
+	var targets []*Target
+	switch {
+	case targetOpts.File != "":
+		// 用户自定义目标，缺少的地区/运营商可通过 WHOIS 补全
+		var err error
+		if targets, err = loadTargetFile(targetOpts.File); err != nil {
+			return nil, nil, nil, err
+		}
+		// -eth 只选择网卡的 IPv4 地址，IPv6 目标若从系统默认的源发出，多源对比就失去了意义
+		if i := slices.IndexFunc(targets, func(t *Target) bool { return net.ParseIP(t.IP).To4() == nil }); eth != "nil" && i >= 0 {
+			return nil, nil, nil, fmt.Errorf("目标 %s 为 IPv6 地址，-eth 只选择网卡的 IPv4 地址，请改用 -src4/-src6 指定源地址", targets[i].IP)
+		}
+		if targetOpts.Whois {
+			enrichTargets(targets)
+		}
+	case probe.Proto == "ntp":
+		// NTP 探测使用内置的服务器分组，-isp 为分组名
+		var err error
+		if targets, err = buildNTPTargets(ispVal); err != nil {
+			return nil, nil, nil, err
+		}
+	case catalogRegion == OverseasRegion:
+		// 海外目标与国际出口所在地区的国内目标一起探测
+		var err error
+		if targets, err = buildOverseasTargets(DnsBuffer, ispVal); err != nil {
+			return nil, nil, nil, err
+		}
+	default:
+		targets = buildTargets(DnsBuffer, ispVal, catalogRegion)
+	}
 
-	// 确定目标运营商列表
-	targetIsps := []string{ispVal}
-	if ispVal == "all" {
-		targetIsps = []string{"电信", "联通", "移动"}
+	if targetOpts.Local {
+		targets = addLocalLink(targets, localIPs[0], probe)
 	}
 
-	// 定义获取IP列表的函数
-	getIPList := func(ispName, region string) []string {
-		switch ispName {
-		case "电信":
-			if regionData, ok := DnsBuffer.Dx[region]; ok {
-				return regionData.IPv4
-			}
-		case "联通":
-			if regionData, ok := DnsBuffer.Lt[region]; ok {
-				return regionData.IPv4
-			}
-		case "移动":
-			if regionData, ok := DnsBuffer.Yd[region]; ok {
-				return regionData.IPv4
+	// 本次运行的所有 ICMP 探测共用一个标识符分配器，互不重复
+	ids := newICMPIDs(probe.ICMPID)
+
+	// 目标文件中单独指定了探测方式或端口的目标，每种组合创建一个 Prober
+	overridden := 0
+	for _, target := range targets {
+		if target.Probe == (TargetProbe{}) {
+			continue
+		}
+		if target.Labels[0].Isp != LocalLinkIsp {
+			overridden++
+		}
+		key := TargetProbe{Proto: target.Probe.Proto, Port: target.Probe.Port}
+		if _, ok := cfg.overrides[key]; ok || key == (TargetProbe{}) {
+			continue
+		}
+		p, label, err := probe.forTarget(key)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("目标 %s：%v", target.IP, err)
+		}
+		prober, err := newProber(p, localIPs[0], ids)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		prober = cfg.cache.wrap(prober, p)
+		if cfg.overrides == nil {
+			cfg.overrides = make(map[TargetProbe]protocolProber)
+		}
+		cfg.overrides[key] = protocolProber{label: label, prober: prober}
+	}
+	if overridden > 0 {
+		fmt.Fprintf(os.Stderr, "✅ 目标文件中 %d 个目标单独指定了探测参数\n", overridden)
+	}
+
+	// 代理连通性用第一个源IP检查
+	if probe.Multi() {
+		list, labels, _ := probe.protocols()
+		for i, p := range list {
+			prober, err := newProber(p, localIPs[0], ids)
+			if err != nil {
+				return nil, nil, nil, err
 			}
+			prober = cfg.cache.wrap(prober, p)
+			cfg.protocols = append(cfg.protocols, protocolProber{label: labels[i], prober: prober})
 		}
-		return nil
+		return cfg, targets, cfg.protocols[0].prober, nil
+	}
+	prober, err := newProber(probe, localIPs[0], ids)
+	if err != nil {
+		return nil, nil, nil, err
 	}
+	return cfg, targets, cfg.cache.wrap(prober, probe), nil
+}
 
-	// 处理IP Ping任务的函数，使用本地IP作为源IP
-	processIPs := func(ipList []string, region, ispName string, srcIP net.IP) {
-		if len(ipList) == 0 {
-			log.Printf("⚠️ 区域 %s 下运营商 %s 无 IP", region, ispName)
-			return
+// addLocalLink 发现本地链路目标并加入 targets，沿第一个公网 IPv4 目标的路径查找上游第一跳；
+// 网关等设备通常只响应 ICMP，单个探测方式不是 icmp 时本地链路目标单独使用 icmp 探测
+func addLocalLink(targets []*Target, sourceIP net.IP, probe ProbeOptions) []*Target {
+	via := ""
+	if i := slices.IndexFunc(targets, func(t *Target) bool {
+		ip := net.ParseIP(t.IP).To4()
+		return ip != nil && ip.IsGlobalUnicast() && !ip.IsPrivate()
+	}); i >= 0 {
+		via = targets[i].IP
+	}
+	var local []*Target
+	var notes []string
+	inNetns(probe.Netns, func() error {
+		local, notes = discoverLocalLink(via, sourceIP, probe.VRF)
+		return nil
+	})
+	for _, note := range notes {
+		log.Printf("⚠️  %s\n", note)
+	}
+	var found []string
+	for _, t := range local {
+		if !probe.Multi() && probe.Proto != "" && probe.Proto != "icmp" {
+			t.Probe = TargetProbe{Proto: "icmp"}
 		}
-		for _, ip := range ipList {
-			wg.Add(1)
+		found = append(found, t.Labels[0].Region+" "+t.IP)
+	}
+	if len(found) > 0 {
+		fmt.Fprintf(os.Stderr, "✅ %s：%s\n", LocalLinkIsp, strings.Join(found, "、"))
+	}
+	return mergeTargets(targets, local)
+}
+
+// targetProtocols 目标使用的探测方式：目标文件中单独指定了探测方式或端口时只用该方式，否则为 protocols
+func (cfg *runConfig) targetProtocols(target *Target, protocols []protocolProber) []protocolProber {
+	if p, ok := cfg.overrides[TargetProbe{Proto: target.Probe.Proto, Port: target.Probe.Port}]; ok {
+		return []protocolProber{p}
+	}
+	return protocols
+}
 
-			go func(ip string) {
-				sem <- struct{}{} //通过管道限制并发次数，不然大量的并发ping，会消耗系统的socket资源，导致系统误判
-				defer func() {
-					<-sem
-					wg.Done()
-				}()
-				Ping(net.ParseIP(ip), region, ispName, srcIP, ChStatistics, count)
-			}(ip)
+// targetCount 目标的发包数：目标文件中单独指定时使用该值，否则为 -p
+func (cfg *runConfig) targetCount(target *Target) int {
+	if target.Probe.Count > 0 {
+		return target.Probe.Count
+	}
+	return cfg.count
+}
+
+// sources 返回各源IP的字符串形式，未指定网卡时为空
+func (cfg *runConfig) sources() []string {
+	var sources []string
+	for _, ip := range cfg.localIPs {
+		if ip != nil {
+			sources = append(sources, ip.String())
 		}
 	}
+	return sources
+}
+
+// parseSources 将录制文件中的源IP还原为 runConfig.localIPs，为空时使用系统默认
+func parseSources(sources []string) []net.IP {
+	if len(sources) == 0 {
+		return []net.IP{nil}
+	}
+	var ips []net.IP
+	for _, s := range sources {
+		ips = append(ips, net.ParseIP(s))
+	}
+	return ips
+}
+
+// ValidateOutput 在探测前校验输出参数（格式、主题、模板、丢包阈值）
+func ValidateOutput(output OutputOptions) error {
+	_, err := newRenderer(output)
+	return err
+}
+
+// prepareOutput 校验输出参数并返回 Renderer；交互界面条件不满足时退回直接输出
+func prepareOutput(output *OutputOptions) (Renderer, error) {
+	renderer, err := newRenderer(*output)
+	if err != nil {
+		return nil, err
+	}
+	if _, isTable := renderer.(*TableRenderer); output.TUI && (!isTable || !tuiAvailable()) {
+		log.Printf("⚠️  交互界面需要 table 格式且标准输入输出均为终端，已改为直接输出结果\n")
+		output.TUI = false
+	}
+	return renderer, nil
+}
 
-	// 根据区域参数执行不同的Ping逻辑
-	if regionVal != "全国" {
-		for _, ispName := range targetIsps {
-			ipList := getIPList(ispName, regionVal)
-			processIPs(ipList, regionVal, ispName, localIP)
+// execute 并发探测全部目标，汇总后按输出参数展示和保存结果，返回本轮的快照
+func execute(cfg *runConfig, targets []*Target, prober Prober) *Snapshot {
+	output := cfg.output
+	if table, ok := cfg.renderer.(*TableRenderer); ok && !output.TUI {
+		cfg.interim = func(grouped []*SummaryStatistic) {
+			var buf bytes.Buffer
+			fmt.Fprintln(&buf, "====== 优先目标结果（其余目标探测中） ======")
+			table.printSummaryList(&buf, grouped, sectionTotals(grouped))
+			os.Stdout.Write(buf.Bytes())
 		}
-		wg.Wait()
-		close(ChStatistics)
-	} else {
-		// 处理全国区域的情况
-		ispRegions := map[string]map[string]ProvinceConfig{
-			"电信": DnsBuffer.Dx,
-			"联通": DnsBuffer.Lt,
-			"移动": DnsBuffer.Yd,
+	}
+	result := collect(cfg, targets, prober)
+	snap := result.Snapshot
+	cfg.stream.roundEnd(snap)
+	cfg.cache.report()
+	if err := cfg.cache.save(); err != nil {
+		log.Printf("⚠️  %v\n", err)
+	}
+	presentResult(result, cfg.renderer, output, cfg.sort, cfg.des)
+	if output.CompareLast {
+		// 持续探测时下一轮与本轮对比
+		if err := saveRun(runStateDir(), snap); err != nil {
+			log.Printf("⚠️  %v\n", err)
 		}
+		cfg.previous = snap
+	}
+	return snap
+}
 
-		for ispName, regions := range ispRegions {
-			if ispVal != "all" && ispName != ispVal {
-				continue
-			}
-			for region, ipLists := range regions {
-				processIPs(ipLists.IPv4, region, ispName, localIP)
-			}
+// presentResult 按输出参数展示结果（交互界面或标准输出），并保存快照和多线路推荐
+func presentResult(result *RunResult, renderer Renderer, output OutputOptions, sort string, des bool) {
+	snap := result.Snapshot
+	if output.Quiet {
+		// 结果只保存和推送
+	} else if output.TUI {
+		if err := RunTUI(result, renderer.(*TableRenderer), sort, des); err != nil {
+			log.Printf("⚠️  %v\n", err)
 		}
+	} else if err := renderResult(renderer, result, output.NoPager); err != nil {
+		log.Printf("⚠️  输出结果失败: %v\n", err)
+	}
+
+	for _, path := range []string{output.OutPath, output.SavePath} {
+		if path == "" {
+			continue
+		}
+		if err := SaveSnapshot(path, snap); err != nil {
+			log.Printf("⚠️  %v\n", err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "✅ 结果已保存到 %s\n", path)
+	}
+	if output.RecommendPath != "" {
+		if err := SaveRecommendations(output.RecommendPath, snap); err != nil {
+			log.Printf("⚠️  %v\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "✅ 多线路推荐已保存到 %s\n", output.RecommendPath)
+		}
+	}
+}
+
+// collect 并发探测全部目标并汇总结果，不做任何输出
+func collect(cfg *runConfig, targets []*Target, prober Prober) *RunResult {
+	limiter := newProbeLimiter(cfg.maxConcurrency) //限制并发数，套接字资源耗尽时自动降低
+	groups := newGroupLimiters(cfg.groupLimits, targets)
+
+	// 初始化并发控制和统计通道
+	var wg, wgHandleDPing sync.WaitGroup
+	ChStatistics := make(chan *PingStatistic, cfg.resultBuffer)
+	// 每次运行使用独立的数据存储，最多保存25条最近记录；同一进程内多次运行（如回放）互不影响
+	statsStore := NewPingStatsStore(25)
+	weights, _ := ParseScoreWeights(cfg.output.ScoreWeights)
+	statsStore.SetScoreWeights(weights)
+	groupBy, _ := parseGroupBy(cfg.output.GroupBy)
+	statsStore.SetGroupBy(groupBy)
+	statsStore.SetLossStreaks(cfg.streaks)
+	statsStore.SetPrevious(cfg.previous)
+
+	// 先确认本地链路正常，否则全部目标丢包时无法区分是本地还是目标的问题
+	var gateways []*GatewayCheck
+	if cfg.gatewayCheck != nil {
+		gateways = cfg.gatewayCheck()
+	}
+
+	protocols := cfg.protocols
+	if len(protocols) == 0 {
+		protocols = []protocolProber{{prober: prober}}
+	}
+	// 每个目标的每个标签（地区、运营商）在每个源IP、每个探测方式下各产生一条结果
+	total, scheduled := 0, 0
+	for _, target := range targets {
+		probes := len(cfg.localIPs) * len(cfg.targetProtocols(target, protocols))
+		total += len(target.Labels) * probes
+		scheduled += probes
+	}
+	// 本次运行的 ID 写入结果、告警、推送和日志，用于关联同一次探测在各处的输出
+	runID := uuid.NewString()
+	fmt.Fprintf(os.Stderr, "✅ 运行 ID %s\n", runID)
+	statsStore.SetBackend(cfg.backend, runID)
+	cfg.hooks.beforeRun(runID, len(targets))
+	progressOpts, _ := parseProgress(cfg.output.Progress)
+	flushed := make(chan struct{})
+	wgHandleDPing.Add(1) // 标记 HandleDPing 任务开始
+	cfg.stream.roundStart(runID, total)
+	// 记录探测主机自身的调度延迟、通道阻塞和丢弃，区分网络问题和主机过载
+	telemetry := &telemetryRecorder{}
+	telemetry.schedule(scheduled)
+	var results <-chan *PingStatistic = ChStatistics
+	if cfg.resultSpill {
+		results = spillResults(ChStatistics, telemetry)
+	}
+	go handleStatistics(results, statsStore, &wgHandleDPing, newProgressPrinter(progressOpts, total), cfg.stream, cfg.metrics, flushed)
+	// 指定了 -priority 时先探测优先目标，全部完成后输出其结果，再探测其余目标
+	tiers := priorityTiers(targets, cfg.priority)
+	for i, tier := range tiers {
+		cfg.spawnTier(runID, tier, protocols, limiter, groups, telemetry, ChStatistics, &wg)
 		wg.Wait()
-		close(ChStatistics)
+		if i < len(tiers)-1 && cfg.interim != nil {
+			// 等待已发出的结果全部计入数据存储
+			ChStatistics <- nil
+			<-flushed
+			cfg.interim(statsStore.GetSummarySortedGroupedByIsp(cfg.sort, cfg.des))
+		}
 	}
+	close(ChStatistics)
+
 	// 等待 HandleDPing 完成
 	wgHandleDPing.Wait()
+	if err := statsStore.flush(); err != nil {
+		log.Printf("⚠️  %v\n", err)
+	}
+
+	summaryList := statsStore.GetSummarySorted(cfg.sort, cfg.des)
+	snap := NewSnapshot(summaryList, cfg.isp, cfg.region, cfg.localIPStr, cfg.count)
+	snap.RunID = runID
+	snap.Note = cfg.output.Note
+	snap.LocalIsp = cfg.output.LocalIsp
+	snap.Gateways = gateways
+	snap.Unanswered = statsStore.lostRows()
+	for _, protocol := range cfg.protocols {
+		snap.Protocols = append(snap.Protocols, protocol.label)
+	}
+	// 多源探测时按运营商推荐出口；-src6 时 IPv6 目标的源不同，但不是多源
+	if len(cfg.localIPs) > 1 {
+		snap.Recommendations = recommendSources(snap.Rows, cfg.interfaces)
+	}
+	annotateSnapshot(snap, summaryList, cfg.output)
+	snap.Telemetry = telemetry.result()
+	if initial, limit, retries := limiter.result(); retries > 0 {
+		snap.Telemetry.SocketRetries = retries
+		if limit < initial {
+			snap.Telemetry.ReducedConcurrency = limit
+		}
+	}
+	reportTelemetry(snap.Telemetry)
+	grouped := statsStore.GetSummarySortedGroupedByIsp(cfg.sort, cfg.des)
+	result := newRunResult(snap, summaryList, grouped, statsStore.GetLossOnlyGroupedByIspSorted(grouped, cfg.sort, cfg.des))
+	cfg.hooks.afterRun(runID, len(targets), result.Totals.Summary.Total, snap.Telemetry)
+	// 签名放在最后，快照此后不再修改
+	if cfg.signKey != nil {
+		if err := SignSnapshot(snap, cfg.signKey); err != nil {
+			log.Printf("⚠️  %v\n", err)
+		}
+	}
+	return result
 }
 
-func Ping(to net.IP, Region string, Isp string, sourceIP net.IP, ChStatistics chan<- *PingStatistic, count int) {
+// annotateSnapshot 按输出参数为快照补充时延预算评估、服务汇总，以及 DNS 探测时按解析结果的分组
+func annotateSnapshot(snap *Snapshot, summaryList []*SummaryStatistic, output OutputOptions) {
+	if budget, _ := lookupBudget(output.Budget); budget != nil {
+		snap.Budget = evaluateBudget(budget, snap)
+	}
+	if aggregate, _ := parseAggregate(output.Aggregate); aggregate != nil {
+		snap.Services = snapshotServices(aggregateServices(aggregate, summaryList))
+	}
+	snap.DNSClusters = dnsClusters(snap.Rows)
+	snap.ECSMappings = ecsMappings(snap.Rows)
+	snap.ProtoMismatches = protoMismatches(snap.Rows, snap.Protocols, output.Loss)
+	annotateExpectedRtt(snap.Rows, output.GeoFrom)
+}
+
+// spawnTier 为一批目标在各源IP、各探测方式下启动探测，每个探测在 wg 中计数
+func (cfg *runConfig) spawnTier(runID string, targets []*Target, protocols []protocolProber, limiter *probeLimiter, groups groupLimiters, telemetry *telemetryRecorder, ChStatistics chan<- *PingStatistic, wg *sync.WaitGroup) {
+	// -spread 时第 i 个探测在本轮开始后 i*slot 开始，每个目标每轮在相同的时刻被探测，负载和时间序列都均匀
+	var slot time.Duration
+	if cfg.spread > 0 {
+		n := 0
+		for _, target := range targets {
+			n += len(cfg.localIPs) * len(cfg.targetProtocols(target, protocols))
+		}
+		slot = cfg.spread / time.Duration(max(n, 1))
+	}
+	roundStart := time.Now()
+	i := 0
+	for _, sourceIP := range cfg.localIPs {
+		for _, target := range targets {
+			for _, protocol := range cfg.targetProtocols(target, protocols) {
+				wg.Add(1)
+				scheduled := roundStart.Add(time.Duration(i) * slot)
+				i++
+
+				go func(target *Target, sourceIP net.IP, protocol protocolProber) {
+					to := net.ParseIP(target.IP)
+					if to.To4() == nil {
+						sourceIP = cfg.src6
+					}
+					// 等到自己的时刻再占用并发名额，等待中的探测不占用名额；未指定 -spread 时随机错开各目标的启动时间，
+					// 避免大量 pinger 在同一毫秒发出首包造成突发丢包
+					if cfg.spread == 0 {
+						scheduled = scheduled.Add(startJitter(cfg.jitter))
+					}
+					time.Sleep(time.Until(scheduled))
+					spawned := time.Now()
+					cfg.starts.wait()
+					// 先占用运营商/地区的名额再占用总名额，等待拥塞方向的探测不占用总名额
+					releaseGroups := groups.acquire(target)
+					limiter.acquire() //限制并发次数，不然大量的并发ping，会消耗系统的socket资源，导致系统误判
+					defer func() {
+						limiter.release()
+						releaseGroups()
+						wg.Done()
+					}()
+					telemetry.started(time.Since(spawned), spawned.Sub(scheduled))
+					cfg.hooks.beforeProbe(runID, target, sourceString(sourceIP), protocol.label)
+					stats, err := probeTarget(protocol.prober, limiter, to, target.Labels, sourceIP, protocol.label, ChStatistics, cfg.targetCount(target), cfg.adaptive, telemetry)
+					cfg.hooks.afterProbe(runID, target, sourceString(sourceIP), protocol.label, stats, err)
+				}(target, sourceIP, protocol)
+			}
+		}
+	}
+}
+
+// Ping 使用 ICMP 对目标执行一次探测，并把同一份统计结果发送给目标的每个标签；
+// 结果交给 HandleDPing 汇总后会被回收复用，之后不能再访问
+func Ping(to net.IP, labels []TargetLabel, sourceIP net.IP, ChStatistics chan<- *PingStatistic, count int, adaptive AdaptiveOptions) {
+	probeTarget(icmpProber{}, nil, to, labels, sourceIP, "", ChStatistics, count, adaptive, nil)
+}
+
+// probeTarget 使用 prober 探测目标，并把同一份统计结果发送给目标的每个标签；proto 为同时使用多个探测方式时结果的协议标签，
+// limiter 非空时套接字资源耗尽会降低并发后重试，telemetry 非空时记录结果发送的阻塞和出错；返回探测结果或出错的原因
+func probeTarget(prober Prober, limiter *probeLimiter, to net.IP, labels []TargetLabel, sourceIP net.IP, proto string, ChStatistics chan<- *PingStatistic, count int, adaptive AdaptiveOptions, telemetry *telemetryRecorder) (stats *ping.Statistics, err error) {
+	// 出错或异常时同样给每个标签发送一条带原因的结果，出错的目标出现在表格和机器可读输出中而不是悄悄缺失
 	defer func() {
-		if err := recover(); err != nil {
-			fmt.Println(err)
+		if r := recover(); r != nil {
+			telemetry.fail()
+			stats, err = nil, fmt.Errorf("%v", r)
+			sendProbeError(to, labels, sourceIP, proto, ChStatistics, err, telemetry)
 		}
 	}()
 
-	pinger, err := ping.NewPinger(to.String())
+	stats, err = probeWithRetry(prober, limiter, to, sourceIP, count, adaptive)
 	if err != nil {
-		fmt.Printf("Ping Start Error: %v", err)
-		return
+		telemetry.fail()
+		sendProbeError(to, labels, sourceIP, proto, ChStatistics, err, telemetry)
+		return nil, err
 	}
-
-	// 如果获取到了本地IP，则设置为源IP
-	if sourceIP != nil {
-		pinger.Source = sourceIP.String()
+	telemetry.finished(stats.PacketLoss == 100)
+	// 部分探测方式额外返回时钟偏差、HTTP 阶段耗时等结果
+	var details *ProbeDetails
+	if ds, ok := prober.(detailSource); ok {
+		details = ds.Details(to, sourceIP)
 	}
-
-	pinger.SetPrivileged(true)
-	pinger.Count = count
-	pinger.Timeout = time.Duration(count+5) * time.Second
-	err = pinger.Run()
-	if err != nil {
-		fmt.Printf("Ping Run Error: %v", err)
-		return
+	srcIP := sourceString(sourceIP) // 显示实际使用的源IP
+	destIP := to.String()
+	for _, label := range labels {
+		stat := newPingStatistic()
+		stat.SrcIp, stat.DecIp = srcIP, destIP
+		stat.Region, stat.Isp, stat.Proto, stat.Tags, stat.Weight = label.Region, label.Isp, proto, label.Tags, label.Weight
+		stat.Statistic, stat.Details = stats, details
+		sendStart := time.Now()
+		ChStatistics <- stat
+		telemetry.sent(time.Since(sendStart))
 	}
-	stats := pinger.Statistics()
-	ChStatistics <- &PingStatistic{
-		SrcIp:     pinger.Source, // 显示实际使用的源IP
-		DecIp:     to.String(),
-		Region:    Region,
-		Isp:       Isp,
-		Statistic: stats,
+	return stats, nil
+}
+
+// sendProbeError 给目标的每个标签发送一条出错的结果
+func sendProbeError(to net.IP, labels []TargetLabel, sourceIP net.IP, proto string, ChStatistics chan<- *PingStatistic, err error, telemetry *telemetryRecorder) {
+	srcIP, destIP := sourceString(sourceIP), to.String()
+	for _, label := range labels {
+		stat := newPingStatistic()
+		stat.SrcIp, stat.DecIp = srcIP, destIP
+		stat.Region, stat.Isp, stat.Proto, stat.Tags, stat.Weight = label.Region, label.Isp, proto, label.Tags, label.Weight
+		stat.Statistic = &ping.Statistics{Addr: destIP, PacketLoss: 100}
+		stat.Err = err.Error()
+		sendStart := time.Now()
+		ChStatistics <- stat
+		telemetry.sent(time.Since(sendStart))
 	}
 }
 
-// HandleDPing 处理统计数据并以表格形式展示
+// HandleDPing 收集统计数据并显示进度；Ping 等探测函数发出的结果汇总后即被回收复用，发送后不能再访问，
+// 调用方自己构造的结果不会回收
 func HandleDPing(ChStatistics <-chan *PingStatistic, store *PingStatsStore, wg *sync.WaitGroup, sort string, des bool) {
-	defer wg.Done()
+	handleStatistics(ChStatistics, store, wg, newProgressPrinter(progressSetting{every: defaultProgressEvery}, 0), nil, nil, nil)
+}
 
-	processedCount := 0
-	// 进度条刷新函数
-	printProgress := func(processed int) {
-		fmt.Printf("\r进度:%d", processed)
-	}
+// handleStatistics 收集统计数据，按 progress 的设置显示进度，stream 非空时实时推送每条结果，metrics 非空时计入 Prometheus 指标；
+// 收到 nil 时说明之前发出的结果都已计入，向 flushed 发送通知
+func handleStatistics(ChStatistics <-chan *PingStatistic, store *PingStatsStore, wg *sync.WaitGroup, progress *progressPrinter, stream *Stream, metrics *Metrics, flushed chan<- struct{}) {
+	defer wg.Done()
 
+	tick, stop := progress.ticker()
+	defer stop()
 	for {
 		select {
+		case <-tick:
+			progress.tick()
 		case stats, ok := <-ChStatistics:
 			if !ok {
-				// 通道关闭，打印换行和最终结果
-				fmt.Println()
-				//		fmt.Println("====== 最终汇总统计结果 ======")
-				//		printSummaryList(store.GetSummarySorted(sort, des))
-				fmt.Println("====== 汇总统计结果 ======")
-				SummaryStatistic := store.GetSummarySortedGroupedByIsp(sort, des)
-				printSummaryList(SummaryStatistic)
-				fmt.Println("====== 丢包汇总统计结果 ======")
-				printSummaryList(store.GetLossOnlyGroupedByIspSorted(SummaryStatistic, sort, des))
-
+				// 通道关闭，结束进度输出，结果由调用方按输出格式打印
+				progress.finish()
 				return
 			}
+			if stats == nil {
+				flushed <- struct{}{}
+				continue
+			}
 			PacketLoss := stats.Statistic.PacketLoss
+			store.streaks.observe(stats)
+			store.save(stats)
 
-			if PacketLoss != 100 {
+			// 全部丢包的目标不计入，出错的目标带着原因计入
+			if PacketLoss != 100 || stats.Err != "" {
 				store.Add(stats)
+			} else {
+				store.addLost(stats)
 			}
-			processedCount++
-			printProgress(processedCount)
+			stream.result(stats)
+			metrics.observe(stats)
+			releasePingStatistic(stats)
+			progress.add()
 		}
 	}
 }
 
+// startJitter 返回 [0, max) 内的随机启动偏移，max<=0 时不偏移
+func startJitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return rand.N(max)
+}
+
+// renderResult 渲染结果并输出到标准输出，超过一屏时分页
+func renderResult(renderer Renderer, result *RunResult, noPager bool) error {
+	var buf bytes.Buffer
+	if err := renderer.Render(&buf, result); err != nil {
+		return err
+	}
+	return writePaged(buf.Bytes(), noPager)
+}
+
 func isRegionExist(isp string, region string, dns *DNSConfig) bool {
 	switch isp {
 	case "电信":
@@ -229,7 +822,66 @@ func isRegionExist(isp string, region string, dns *DNSConfig) bool {
 	}
 }
 
-// 获取指定网卡的主IPv4地址
+// localSources 解析源IP：未指定网卡（nil）时为系统默认；多个网卡用逗号分隔，每个目标从各网卡分别探测；
+// 返回各源IP、IPv6 目标的源地址（-src6）和源IP对应的网卡名
+func localSources(eth string, probe ProbeOptions) ([]net.IP, net.IP, map[string]string, error) {
+	localIPs := []net.IP{nil}
+	interfaces := make(map[string]string)
+	var src6 net.IP
+	// -src4/-src6 分别指定 IPv4 和 IPv6 目标的源地址，确认地址在本机网卡上，避免绑定失败后所有目标都显示为出错
+	if probe.Src4 != "" || probe.Src6 != "" {
+		if eth != "nil" {
+			return nil, nil, nil, fmt.Errorf("-src4/-src6 不能与 -eth 同时使用")
+		}
+		for _, s := range []string{probe.Src4, probe.Src6} {
+			if s == "" {
+				continue
+			}
+			if err := checkLocalAddr(net.ParseIP(s)); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		if probe.Src4 != "" {
+			localIPs = []net.IP{net.ParseIP(probe.Src4).To4()}
+		}
+		if probe.Src6 != "" {
+			src6 = net.ParseIP(probe.Src6)
+		}
+	}
+	if eth != "nil" {
+		localIPs = nil
+		seen := make(map[string]bool)
+		for _, name := range strings.Split(eth, ",") {
+			ip, err := getPrimaryLocalIP(strings.TrimSpace(name))
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			if seen[ip.String()] {
+				return nil, nil, nil, fmt.Errorf("网卡 %s 的地址 %s 与前面的网卡重复", name, ip)
+			}
+			seen[ip.String()] = true
+			localIPs = append(localIPs, ip)
+			interfaces[ip.String()] = strings.TrimSpace(name)
+		}
+	}
+	return localIPs, src6, interfaces, nil
+}
+
+// checkLocalAddr 确认源地址配置在本机的某个网卡上
+func checkLocalAddr(ip net.IP) error {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return fmt.Errorf("获取本机地址失败: %v", err)
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("源地址 %s 不在本机的任何网卡上", ip)
+}
+
+// 获取指定网卡的主IPv4地址，IPv6 目标的源地址用 -src6 指定
 func getPrimaryLocalIP(eth string) (net.IP, error) {
 	iface, err := net.InterfaceByName(eth)
 	if err != nil {
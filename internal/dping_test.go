@@ -1,15 +1,27 @@
 package internal_test
 
 import (
+	"crypto/ed25519"
 	"dping/internal"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"math"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/go-ping/ping"
+	"golang.org/x/net/dns/dnsmessage"
 )
 
 func TestDping(t *testing.T) {
@@ -20,20 +32,25 @@ func TestDping(t *testing.T) {
 		return
 	}
 	statsStore := internal.NewPingStatsStore(25)
-	var wg sync.WaitGroup
+	var wg, wgHandle sync.WaitGroup
 	var ChStatistics = make(chan *internal.PingStatistic, 20)
 
-	go internal.HandleDPing(ChStatistics, statsStore, 2*time.Second)
+	wgHandle.Add(1)
+	go internal.HandleDPing(ChStatistics, statsStore, &wgHandle, "loss", false)
 	var soureIP = &net.IP{100, 100, 20, 30}
 	for Region, IpLists := range DnsBuffer.Yd {
 		for _, Ip := range IpLists.IPv4 {
 			wg.Add(1)
-			go internal.Ping(net.ParseIP(Ip), Region, "移动", *soureIP, ChStatistics)
+			go func(ip, region string) {
+				defer wg.Done()
+				internal.Ping(net.ParseIP(ip), []internal.TargetLabel{{Region: region, Isp: "移动"}}, *soureIP, ChStatistics, 3, internal.AdaptiveOptions{})
+			}(Ip, Region)
 		}
 	}
 
 	wg.Wait()
 	close(ChStatistics)
+	wgHandle.Wait()
 }
 
 func TestPing(t *testing.T) {
@@ -52,3 +69,731 @@ func TestPing(t *testing.T) {
 	stats := pinger.Statistics()
 	fmt.Print(stats)
 }
+
+func TestCompareLast(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+	t.Setenv("HOME", cache)
+	dir := t.TempDir()
+	targetFile := filepath.Join(dir, "targets.txt")
+	if err := os.WriteFile(targetFile, []byte("127.0.0.1 北京 电信\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	probe := internal.ProbeOptions{Proto: "dns", Port: serveDNS(t, dnsmessage.RCodeSuccess)}
+	outPath := filepath.Join(dir, "result.json")
+	output := internal.OutputOptions{Format: "json", NoPager: true, OutPath: outPath, CompareLast: true}
+	run := func() *internal.Snapshot {
+		_, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1, Probe: probe, Targets: internal.TargetOptions{File: targetFile}, Output: output})
+		if err != nil {
+			t.Fatal(err)
+		}
+		snap, err := internal.LoadSnapshot(outPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return snap
+	}
+
+	// 第一次运行没有可对比的结果
+	prev := run().Rows[0]
+	if prev.PrevLoss != nil || prev.PrevAvgRtt != nil {
+		t.Errorf("第一次运行不应有上次的结果: %+v", prev)
+	}
+	row := run().Rows[0]
+	if row.PrevLoss == nil || row.PrevAvgRtt == nil || math.Abs(*row.PrevAvgRtt-prev.AvgRttMs) > 0.001 {
+		t.Errorf("第二次运行应带有第一次的结果（平均 RTT %.3fms）: %+v", prev.AvgRttMs, row)
+	}
+	// 不开启对比时既不读取也不保存
+	output.CompareLast = false
+	if row := run().Rows[0]; row.PrevLoss != nil {
+		t.Errorf("未开启对比时不应有上次的结果: %+v", row)
+	}
+	runs, _ := filepath.Glob(filepath.Join(cache, "*", "runs", "*.json"))
+	if len(runs) != 2 {
+		t.Errorf("状态目录中应保存 2 份结果，实际为 %v", runs)
+	}
+}
+
+func TestGroupConcurrency(t *testing.T) {
+	for _, c := range []struct {
+		in     string
+		total  int
+		limits map[string]int
+	}{
+		{"80", 80, nil},
+		{"电信=30,联通=30,移动=60", 120, map[string]int{"电信": 30, "联通": 30, "移动": 60}},
+		{"100,北京=10", 100, map[string]int{"北京": 10}},
+		{"电信=10", 50, map[string]int{"电信": 10}},
+	} {
+		total, limits, err := internal.ParseConcurrency(c.in, 50)
+		if err != nil || total != c.total || fmt.Sprint(limits) != fmt.Sprint(c.limits) {
+			t.Errorf("-C %s 解析为 %d %v %v，应为 %d %v", c.in, total, limits, err, c.total, c.limits)
+		}
+	}
+	for _, bad := range []string{"0", "电信=0", "电信=a", "10,20", "电信=1,电信=2", "=3"} {
+		if _, _, err := internal.ParseConcurrency(bad, 50); err == nil {
+			t.Errorf("-C %s 应报错", bad)
+		}
+	}
+
+	// 各解析服务器应答前等待一段时间，统计电信目标同时在进行的查询数
+	var inFlight, peak atomic.Int32
+	slow := func(*dnsmessage.Message) (dnsmessage.RCode, []string) {
+		n := inFlight.Add(1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(50 * time.Millisecond)
+		inFlight.Add(-1)
+		return dnsmessage.RCodeSuccess, nil
+	}
+	var content string
+	for range 4 {
+		content += fmt.Sprintf("127.0.0.1 北京 电信 port=%d\n", serveDNSFunc(t, slow))
+	}
+	content += fmt.Sprintf("127.0.0.1 广东 联通 port=%d\n", serveDNS(t, dnsmessage.RCodeSuccess))
+	targetFile := filepath.Join(t.TempDir(), "targets.txt")
+	if err := os.WriteFile(targetFile, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := internal.OutputOptions{Format: "json", NoPager: true, OutPath: filepath.Join(t.TempDir(), "result.json")}
+	_, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1, Probe: internal.ProbeOptions{Proto: "dns", Port: 53}, Targets: internal.TargetOptions{File: targetFile, Concurrency: map[string]int{"电信": 1}}, Output: output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peak.Load() != 1 {
+		t.Errorf("电信目标同时进行的查询最多为 %d，应受 -C 电信=1 限制为 1", peak.Load())
+	}
+}
+
+func TestResultSpill(t *testing.T) {
+	// 缓冲区只有 1 条时结果经内存队列交给汇总，全部结果都应计入且队列中确有暂存
+	port := serveDNS(t, dnsmessage.RCodeSuccess)
+	var content string
+	for i := range 30 {
+		content += fmt.Sprintf("127.0.0.1 地区%d 电信 port=%d\n", i, port)
+	}
+	targetFile := filepath.Join(t.TempDir(), "targets.txt")
+	if err := os.WriteFile(targetFile, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := internal.OutputOptions{Format: "json", NoPager: true, OutPath: filepath.Join(t.TempDir(), "result.json")}
+	result, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1, ResultBuffer: 1, ResultSpill: true,
+		Probe: internal.ProbeOptions{Proto: "dns", Port: 53}, Targets: internal.TargetOptions{File: targetFile}, Output: output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Snapshot.Rows) != 30 {
+		t.Errorf("应有 30 行结果，实际 %d", len(result.Snapshot.Rows))
+	}
+	if tel := result.Snapshot.Telemetry; tel.SpillPeak < 1 || tel.Completed != 1 {
+		t.Errorf("内存队列应有暂存、同一目标只探测一次: %+v", tel)
+	}
+}
+
+func TestStatsBackend(t *testing.T) {
+	port := serveDNS(t, dnsmessage.RCodeSuccess)
+	targetFile := filepath.Join(t.TempDir(), "targets.txt")
+	if err := os.WriteFile(targetFile, []byte(fmt.Sprintf("127.0.0.1 北京 电信 port=%d\n127.0.0.1 广东 联通 port=%d\n", port, port)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var posted []internal.StoredResult
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []internal.StoredResult
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		posted = append(posted, batch...)
+		mu.Unlock()
+	}))
+	defer remote.Close()
+
+	dir := t.TempDir()
+	for _, store := range []string{"file:" + dir, remote.URL} {
+		output := internal.OutputOptions{Format: "json", NoPager: true, OutPath: filepath.Join(t.TempDir(), "result.json")}
+		result, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1, Store: store,
+			Probe: internal.ProbeOptions{Proto: "dns", Port: 53}, Targets: internal.TargetOptions{File: targetFile}, Output: output})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var saved []internal.StoredResult
+		if store == remote.URL {
+			saved = posted
+		} else {
+			data, err := os.ReadFile(filepath.Join(dir, result.Snapshot.RunID+".jsonl"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+				var rec internal.StoredResult
+				if err := json.Unmarshal([]byte(line), &rec); err != nil {
+					t.Fatal(err)
+				}
+				saved = append(saved, rec)
+			}
+		}
+		if len(saved) != 2 {
+			t.Fatalf("%s 应保存 2 条结果，实际 %d", store, len(saved))
+		}
+		for _, rec := range saved {
+			if rec.RunID != result.Snapshot.RunID || rec.DestIP != "127.0.0.1" || rec.Sent != 1 || rec.Recv != 1 {
+				t.Errorf("%s 保存的结果不正确: %+v", store, rec)
+			}
+		}
+	}
+
+	for _, spec := range []string{"sqlite:/tmp/dping.db", "redis://127.0.0.1", "file:", "memory:x"} {
+		if _, err := internal.OpenStatsBackend(spec); err == nil {
+			t.Errorf("-store %s 应返回错误", spec)
+		}
+	}
+}
+
+func TestReportTotals(t *testing.T) {
+	// 同一IP以两个运营商出现：总计只计一次，每个运营商各有一行小计，写入的快照中合计与表格相同
+	port := serveDNS(t, dnsmessage.RCodeSuccess)
+	targetFile := filepath.Join(t.TempDir(), "targets.txt")
+	if err := os.WriteFile(targetFile, []byte(fmt.Sprintf("127.0.0.1 北京 电信 port=%d\n127.0.0.1 北京 联通 port=%d\n", port, port)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outPath := filepath.Join(t.TempDir(), "result.json")
+	output := internal.OutputOptions{Format: "json", NoPager: true, OutPath: outPath}
+	result, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 2,
+		Probe: internal.ProbeOptions{Proto: "dns", Port: 53}, Targets: internal.TargetOptions{File: targetFile}, Output: output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	totals := result.Snapshot.Totals
+	if totals == nil {
+		t.Fatal("快照中应有合计")
+	}
+	if total := totals.Summary.Total; total.Targets != 1 || total.Sent != 2 || total.Recv != 2 || total.LossPercent != 0 || total.AvgRttMs <= 0 {
+		t.Errorf("总计不正确: %+v", total)
+	}
+	if groups := totals.Summary.Groups; len(groups) != 2 || groups[0].Isp == groups[1].Isp || groups[0].Sent != 2 {
+		t.Errorf("应有两个运营商的小计: %+v", groups)
+	}
+	if total := totals.LossOnly.Total; total.Targets != 0 || total.Sent != 0 {
+		t.Errorf("没有丢包时丢包表的合计应为空: %+v", total)
+	}
+	loaded, err := internal.LoadSnapshot(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Totals == nil || loaded.Totals.Summary.Total.Sent != 2 {
+		t.Errorf("写入的快照中应有合计: %+v", loaded.Totals)
+	}
+}
+
+func TestStartJitter(t *testing.T) {
+	// 记录各目标建连到达的时刻：启动偏移应把各目标错开，且等待偏移时不占用并发名额
+	ln, err := net.Listen("tcp4", "0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var mu sync.Mutex
+	var arrived []time.Time
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			arrived = append(arrived, time.Now())
+			mu.Unlock()
+			conn.Close()
+		}
+	}()
+	const targets, jitter = 10, 300 * time.Millisecond
+	var content strings.Builder
+	for i := 1; i <= targets; i++ {
+		fmt.Fprintf(&content, "127.0.0.%d 北京 电信\n", i)
+	}
+	targetFile := filepath.Join(t.TempDir(), "targets.txt")
+	if err := os.WriteFile(targetFile, []byte(content.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = internal.DPing(internal.Options{MaxConcurrency: 1, Count: 1, Jitter: jitter,
+		Probe:   internal.ProbeOptions{Proto: "tcp", Port: ln.Addr().(*net.TCPAddr).Port},
+		Targets: internal.TargetOptions{File: targetFile}, Output: internal.OutputOptions{Format: "json", NoPager: true, Quiet: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(arrived) != targets {
+		t.Fatalf("应有 %d 次建连，实际为 %d 次", targets, len(arrived))
+	}
+	// 并发为 1 时若占着名额等待，总耗时约为各偏移之和（期望 1.5s）
+	if elapsed > 2*jitter {
+		t.Errorf("%d 个目标、最大偏移 %s 用时 %s，等待启动偏移时不应占用并发名额", targets, jitter, elapsed)
+	}
+	slices.SortFunc(arrived, time.Time.Compare)
+	if spread := arrived[targets-1].Sub(arrived[0]); spread < 10*time.Millisecond || spread > jitter+100*time.Millisecond {
+		t.Errorf("各目标的启动应在 %s 内随机错开，实际首尾相差 %s", jitter, spread)
+	}
+}
+
+func TestPriority(t *testing.T) {
+	// 记录各解析服务器收到第一个查询的时刻，优先目标的查询结束后才应开始探测其余目标
+	var mu sync.Mutex
+	arrived := make(map[string]time.Time)
+	slow := func(region string) func(*dnsmessage.Message) (dnsmessage.RCode, []string) {
+		return func(*dnsmessage.Message) (dnsmessage.RCode, []string) {
+			mu.Lock()
+			if _, ok := arrived[region]; !ok {
+				arrived[region] = time.Now()
+			}
+			mu.Unlock()
+			time.Sleep(50 * time.Millisecond)
+			return dnsmessage.RCodeSuccess, nil
+		}
+	}
+	content := fmt.Sprintf("127.0.0.1 北京 电信 port=%d\n127.0.0.1 广东 联通 port=%d\n", serveDNSFunc(t, slow("北京")), serveDNSFunc(t, slow("广东")))
+	targetFile := filepath.Join(t.TempDir(), "targets.txt")
+	if err := os.WriteFile(targetFile, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := internal.OutputOptions{Format: "json", NoPager: true, OutPath: filepath.Join(t.TempDir(), "result.json")}
+	_, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1, Probe: internal.ProbeOptions{Proto: "dns", Port: 53}, Targets: internal.TargetOptions{File: targetFile, Priority: "广东"}, Output: output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 超时的查询可能仍在处理，读取时同样加锁
+	mu.Lock()
+	gap := arrived["北京"].Sub(arrived["广东"])
+	mu.Unlock()
+	if gap < 50*time.Millisecond {
+		t.Errorf("北京的探测在优先目标广东之后 %s 开始，应在广东的探测结束之后", gap)
+	}
+}
+
+func TestSourceFamily(t *testing.T) {
+	ln6, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("本机不支持 IPv6: %v", err)
+	}
+	defer ln6.Close()
+	ln4, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln4.Close()
+	content := fmt.Sprintf("::1 北京 电信 port=%d\n127.0.0.1 上海 联通 port=%d\n", ln6.Addr().(*net.TCPAddr).Port, ln4.Addr().(*net.TCPAddr).Port)
+	targetFile := filepath.Join(t.TempDir(), "targets.txt")
+	if err := os.WriteFile(targetFile, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outPath := filepath.Join(t.TempDir(), "result.json")
+	output := internal.OutputOptions{Format: "json", NoPager: true, OutPath: outPath}
+	run := func(probe internal.ProbeOptions, eth string) error {
+		_, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1, Eth: eth, Probe: probe, Targets: internal.TargetOptions{File: targetFile}, Output: output})
+		return err
+	}
+	if err := run(internal.ProbeOptions{Proto: "tcp", Port: 80, Src6: "::1"}, "nil"); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := internal.LoadSnapshot(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// IPv6 目标从 -src6 发出，IPv4 目标使用系统默认；两者的源不同，但不是多源探测
+	sources := make(map[string]string)
+	for _, row := range snap.Rows {
+		sources[row.DestIP] = row.Source
+		if row.Recv != 1 {
+			t.Errorf("%s 应建连成功: %+v", row.DestIP, row)
+		}
+	}
+	if sources["::1"] != "::1" || sources["127.0.0.1"] != "" {
+		t.Errorf("各目标的源IP为 %v，IPv6 目标应使用 ::1，IPv4 目标应为系统默认", sources)
+	}
+	if len(snap.Recommendations) != 0 {
+		t.Errorf("按地址族指定源时不应推荐出口: %+v", snap.Recommendations)
+	}
+
+	for _, c := range []struct {
+		probe internal.ProbeOptions
+		eth   string
+	}{
+		{internal.ProbeOptions{Proto: "tcp", Port: 80, Src6: "127.0.0.1"}, "nil"},
+		{internal.ProbeOptions{Proto: "tcp", Port: 80, Src4: "::1"}, "nil"},
+		{internal.ProbeOptions{Proto: "tcp", Port: 80, Src4: "192.0.2.250"}, "nil"},
+		{internal.ProbeOptions{Proto: "tcp", Port: 80, Src6: "::1"}, "lo"},
+	} {
+		if err := run(c.probe, c.eth); err == nil {
+			t.Errorf("-src4 %q -src6 %q -eth %s 应报错", c.probe.Src4, c.probe.Src6, c.eth)
+		}
+	}
+}
+
+func TestProbeCache(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			conn.Close()
+		}
+	}()
+	targetFile := filepath.Join(t.TempDir(), "targets.txt")
+	if err := os.WriteFile(targetFile, []byte("127.0.0.1 北京 电信\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outPath := filepath.Join(t.TempDir(), "result.json")
+	probe := internal.ProbeOptions{Proto: "tcp", Port: ln.Addr().(*net.TCPAddr).Port, Cache: time.Minute}
+	run := func(count int, watch internal.WatchOptions) error {
+		_, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: count, Probe: probe, Targets: internal.TargetOptions{File: targetFile}, Output: internal.OutputOptions{Format: "json", NoPager: true, OutPath: outPath}, Watch: watch})
+		return err
+	}
+	probed := func(count int) int32 {
+		before := accepted.Load()
+		if err := run(count, internal.WatchOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		snap, err := internal.LoadSnapshot(outPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(snap.Rows) != 1 || snap.Rows[0].Recv != count {
+			t.Fatalf("应有 1 个目标收到 %d 个回应: %+v", count, snap.Rows)
+		}
+		time.Sleep(50 * time.Millisecond) // 等待服务端计入最后的连接
+		return accepted.Load() - before
+	}
+
+	if n := probed(2); n != 2 {
+		t.Errorf("第一次运行应建连 2 次，实际为 %d", n)
+	}
+	if n := probed(2); n != 0 {
+		t.Errorf("缓存有效期内参数相同，应复用结果而不探测，实际建连 %d 次", n)
+	}
+	if n := probed(1); n != 1 {
+		t.Errorf("探测次数不同时不应复用缓存，实际建连 %d 次", n)
+	}
+	if err := run(1, internal.WatchOptions{Interval: time.Minute}); err == nil {
+		t.Error("-cache 与 -watch 同时使用应报错")
+	}
+}
+
+func TestTestset(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	outPath := filepath.Join(t.TempDir(), "result.json")
+	run := func(isp string, targets internal.TargetOptions) error {
+		_, err := internal.DPing(internal.Options{Isp: isp, Region: internal.TestsetRegion, MaxConcurrency: 10, Count: 1, Probe: internal.ProbeOptions{Proto: "tcp", Port: ln.Addr().(*net.TCPAddr).Port}, Targets: targets, Output: internal.OutputOptions{Format: "json", NoPager: true, OutPath: outPath}})
+		return err
+	}
+	for isp, rows := range map[string]int{"all": 6, "电信": 2} {
+		if err := run(isp, internal.TargetOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		snap, err := internal.LoadSnapshot(outPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(snap.Rows) != rows || snap.Region != internal.TestsetRegion {
+			t.Errorf("-isp %s 的测试目标应有 %d 行，实际为 %d 行（区域 %s）", isp, rows, len(snap.Rows), snap.Region)
+		}
+		for _, row := range snap.Rows {
+			if row.DestIP != "127.0.0.1" || row.Recv != 1 {
+				t.Errorf("测试目标应为可达的 127.0.0.1: %+v", row)
+			}
+		}
+	}
+	if err := run("all", internal.TargetOptions{Catalog: "catalog.json"}); err == nil {
+		t.Error("-dt testset 与 -catalog 同时使用应报错")
+	}
+}
+
+func TestOptions(t *testing.T) {
+	// 零值参数按命令行默认值补全后应能通过校验
+	if err := (internal.Options{}).Validate(); err != nil {
+		t.Errorf("零值参数应通过校验: %v", err)
+	}
+	defaults := internal.DefaultOptions()
+	if defaults.Isp != "all" || defaults.Region != "全国" || defaults.Count != 3 || defaults.MaxConcurrency != 50 ||
+		defaults.Jitter != 100*time.Millisecond || !defaults.Output.CompareLast || defaults.Output.Format != "table" {
+		t.Errorf("默认参数与命令行不一致: %+v", defaults)
+	}
+	for _, bad := range []internal.Options{
+		{Count: -1},
+		{Isp: "铁通"},
+		{Output: internal.OutputOptions{Format: "xml"}},
+		{Probe: internal.ProbeOptions{Cache: time.Minute}, Watch: internal.WatchOptions{Interval: time.Minute}},
+		{Output: internal.OutputOptions{Format: "json"}, Watch: internal.WatchOptions{Interval: time.Minute, Chart: "电信"}},
+		{ResultBuffer: -1},
+		{Watch: internal.WatchOptions{Interval: time.Minute, Spread: true}, Targets: internal.TargetOptions{Priority: "广东"}},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("%+v 应校验失败", bad)
+		}
+		if _, err := internal.DPing(bad); err == nil {
+			t.Errorf("DPing(%+v) 应返回参数错误", bad)
+		}
+	}
+
+	// 结果直接返回，不需要读取输出文件；tcp 探测未指定端口时为 80
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	targetFile := filepath.Join(t.TempDir(), "targets.txt")
+	if err := os.WriteFile(targetFile, []byte(fmt.Sprintf("127.0.0.1 北京 电信 port=%d\n", ln.Addr().(*net.TCPAddr).Port)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := internal.DPing(internal.Options{Count: 1, Probe: internal.ProbeOptions{Proto: "tcp"},
+		Targets: internal.TargetOptions{File: targetFile}, Output: internal.OutputOptions{Format: "json", NoPager: true, OutPath: os.DevNull}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Rounds != 1 || len(result.Snapshot.Rows) != 1 || result.Snapshot.Rows[0].Recv != 1 {
+		t.Errorf("应返回 1 轮、1 个可达目标的结果: %+v", result)
+	}
+}
+
+func TestSaveSnapshotOut(t *testing.T) {
+	dir := t.TempDir()
+	targetFile := filepath.Join(dir, "targets.txt")
+	if err := os.WriteFile(targetFile, []byte("127.0.0.1 北京 电信\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// 上一轮留下的较长的结果文件被整体替换，不残留旧内容和临时文件
+	outPath := filepath.Join(dir, "result.json")
+	if err := os.WriteFile(outPath, []byte(strings.Repeat("x", 1<<16)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	probe := internal.ProbeOptions{Proto: "dns", Port: serveDNS(t, dnsmessage.RCodeSuccess)}
+	_, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1, Probe: probe, Targets: internal.TargetOptions{File: targetFile},
+		Output: internal.OutputOptions{Quiet: true, OutPath: outPath}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := internal.LoadSnapshot(outPath)
+	if err != nil || len(snap.Rows) != 1 {
+		t.Fatalf("-out 应写入完整的快照: %v", err)
+	}
+	if _, err := os.Stat(outPath + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("写入后不应留下临时文件: %v", err)
+	}
+
+	// 写入失败时报错，原文件保持不变
+	before, _ := os.ReadFile(outPath)
+	if err := os.Mkdir(outPath+".tmp", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.SaveSnapshot(outPath, snap); err == nil {
+		t.Error("无法写入临时文件时应返回错误")
+	}
+	if after, _ := os.ReadFile(outPath); string(after) != string(before) {
+		t.Error("写入失败时原文件应保持不变")
+	}
+	// 设备文件直接写入，不被替换
+	if err := internal.SaveSnapshot(os.DevNull, snap); err != nil {
+		t.Errorf("写入 %s 失败: %v", os.DevNull, err)
+	}
+	if info, err := os.Stat(os.DevNull); err != nil || info.Mode().IsRegular() {
+		t.Errorf("%s 不应被替换为普通文件", os.DevNull)
+	}
+}
+
+func TestSnapshotSignature(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, _ := ed25519.GenerateKey(nil)
+	snap := &internal.Snapshot{SchemaVersion: internal.SchemaVersion, CreatedAt: time.Now(), Host: "probe", Count: 10,
+		Rows: []*internal.SnapshotRow{{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", Sent: 10, Recv: 9, LossPercent: 10, AvgRttMs: 31.25}}}
+	if err := internal.SignSnapshot(snap, key); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "signed.json")
+	if err := internal.SaveSnapshot(path, snap); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := internal.LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("读取签名的快照失败: %v", err)
+	}
+	if signed, err := internal.VerifySnapshot(loaded, key.Public().(ed25519.PublicKey)); !signed || err != nil {
+		t.Errorf("保存后读取的快照应签名有效: %v", err)
+	}
+	if _, err := internal.VerifySnapshot(loaded, other); err == nil {
+		t.Error("要求其他公钥签名时应校验失败")
+	}
+
+	data, _ := os.ReadFile(path)
+	if err := os.WriteFile(path, []byte(strings.Replace(string(data), `"recv": 9`, `"recv": 10`, 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := internal.LoadSnapshot(path); err == nil || !strings.Contains(err.Error(), "签名校验失败") {
+		t.Errorf("修改过的快照应读取失败，实际为 %v", err)
+	}
+	if signed, err := internal.VerifySnapshot(&internal.Snapshot{SchemaVersion: 1}, nil); signed || err != nil {
+		t.Errorf("未签名的快照不要求签名时应通过: %v", err)
+	}
+}
+
+func TestLoadSnapshotVersion(t *testing.T) {
+	dir := t.TempDir()
+	snap := &internal.Snapshot{SchemaVersion: internal.SchemaVersion, CreatedAt: time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC), Host: "probe", Count: 10,
+		Rows:       []*internal.SnapshotRow{{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", Sent: 10, Recv: 9, LossPercent: 10, AvgRttMs: 31.25}},
+		Unanswered: []*internal.SnapshotRow{{DestIP: "2.2.2.2", Region: "上海", Isp: "联通", Sent: 10, LossPercent: 100}},
+		Telemetry:  &internal.Telemetry{Scheduled: 3, Completed: 2, Unanswered: 1, Failed: 1}}
+	path := filepath.Join(dir, "current.json")
+	if err := internal.SaveSnapshot(path, snap); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := internal.LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("读取当前版本的快照失败: %v", err)
+	}
+	// 当前版本的快照保存后读取，内容不变
+	want, _ := json.Marshal(snap)
+	got, _ := json.Marshal(loaded)
+	if string(got) != string(want) {
+		t.Errorf("读取的快照与保存的不同:\n%s\n%s", want, got)
+	}
+
+	for _, c := range []struct {
+		name    string
+		version int
+		ok      bool
+	}{
+		{"缺少版本号", 0, false},
+		{"旧版本", 1, true},
+		{"更新的版本", internal.SchemaVersion + 1, false},
+	} {
+		path := filepath.Join(dir, fmt.Sprintf("v%d.json", c.version))
+		if err := os.WriteFile(path, []byte(fmt.Sprintf(`{"schema_version": %d, "host": "probe", "rows": []}`, c.version)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := internal.LoadSnapshot(path)
+		if c.ok && err != nil {
+			t.Errorf("%s: 应能读取，实际为 %v", c.name, err)
+		}
+		if !c.ok && (err == nil || !strings.Contains(err.Error(), fmt.Sprintf("schema_version=%d 不受支持", c.version))) {
+			t.Errorf("%s: 应拒绝 schema_version=%d，实际为 %v", c.name, c.version, err)
+		}
+	}
+}
+
+func TestProbeHooks(t *testing.T) {
+	dir := t.TempDir()
+	targetFile := filepath.Join(dir, "targets.txt")
+	if err := os.WriteFile(targetFile, []byte("127.0.0.1 北京 电信\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	log := filepath.Join(dir, "hooks.log")
+	hooks := internal.HookOptions{
+		BeforeRun:   "echo before {{.Targets}} >> " + log,
+		AfterRun:    "echo after {{.Failed}} $DPING_SENT >> " + log,
+		BeforeProbe: "echo probe {{quote .DestIP}} $DPING_ISP >> " + log,
+		AfterProbe:  "{{if .Failed}}echo failed {{.DestIP}} {{.Recv}} $DPING_LOSS_PERCENT >> " + log + "{{end}}",
+	}
+	for _, c := range []struct {
+		rcode dnsmessage.RCode
+		want  string
+	}{
+		{dnsmessage.RCodeSuccess, "before 1\nprobe 127.0.0.1 电信\nafter false 2\n"},
+		{dnsmessage.RCodeServerFailure, "before 1\nprobe 127.0.0.1 电信\nfailed 127.0.0.1 0 100.0\nafter true 0\n"},
+	} {
+		os.Remove(log)
+		probe := internal.ProbeOptions{Proto: "dns", Port: serveDNS(t, c.rcode)}
+		result, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 2, Probe: probe, Hooks: hooks,
+			Targets: internal.TargetOptions{File: targetFile}, Output: internal.OutputOptions{Quiet: true}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 全部丢包的目标不在 rows 中，单独列在 unanswered
+		lost := 0
+		if c.rcode == dnsmessage.RCodeServerFailure {
+			lost = 1
+		}
+		if len(result.Snapshot.Unanswered) != lost || len(result.Snapshot.Rows) != 1-lost {
+			t.Errorf("应答 %v 时 rows 有 %d 行、unanswered 有 %d 行", c.rcode, len(result.Snapshot.Rows), len(result.Snapshot.Unanswered))
+		}
+		data, _ := os.ReadFile(log)
+		if string(data) != c.want {
+			t.Errorf("应答 %v 时钩子的输出应为 %q，实际为 %q", c.rcode, c.want, data)
+		}
+	}
+
+	if err := (internal.Options{Hooks: internal.HookOptions{AfterProbe: "{{if .Failed}"}}).Validate(); err == nil || !strings.Contains(err.Error(), "-hook-after-probe") {
+		t.Errorf("模板无效时应返回错误，实际为 %v", err)
+	}
+}
+
+func TestCaptureOnLoss(t *testing.T) {
+	if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+		t.Skip("-capture-on-loss 需要 Linux 和 root 权限")
+	}
+	dir := t.TempDir()
+	targetFile := filepath.Join(dir, "targets.txt")
+	if err := os.WriteFile(targetFile, []byte("127.0.0.1 北京 电信\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, rcode := range []dnsmessage.RCode{dnsmessage.RCodeSuccess, dnsmessage.RCodeServerFailure} {
+		captures := filepath.Join(dir, rcode.String())
+		probe := internal.ProbeOptions{Proto: "dns", Port: serveDNS(t, rcode), CaptureDir: captures}
+		_, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 2, Probe: probe,
+			Targets: internal.TargetOptions{File: targetFile}, Output: internal.OutputOptions{Quiet: true}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, _ := filepath.Glob(filepath.Join(captures, "*.pcap"))
+		if rcode == dnsmessage.RCodeSuccess {
+			if len(files) != 0 {
+				t.Errorf("没有丢包时不应抓包，实际为 %v", files)
+			}
+			continue
+		}
+		if len(files) != 1 || !strings.Contains(filepath.Base(files[0]), "-127.0.0.1-dns-") {
+			t.Fatalf("全部丢包时应生成一个抓包文件，实际为 %v", files)
+		}
+		data, err := os.ReadFile(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) < 24 || binary.LittleEndian.Uint32(data) != 0xa1b2c3d4 || binary.LittleEndian.Uint32(data[20:]) != 101 {
+			t.Fatalf("抓包文件头无效: % x", data[:min(len(data), 24)])
+		}
+		// 重新探测的 2 个查询和 2 个应答，每个都是 127.0.0.1 上的 UDP 包
+		packets := 0
+		for rest := data[24:]; len(rest) > 0; packets++ {
+			if len(rest) < 16 {
+				t.Fatalf("第 %d 个包的记录头被截断", packets+1)
+			}
+			n := int(binary.LittleEndian.Uint32(rest[8:]))
+			pkt := rest[16 : 16+n]
+			if pkt[0]>>4 != 4 || pkt[9] != 17 || !net.IP(pkt[16:20]).Equal(net.IPv4(127, 0, 0, 1)) {
+				t.Errorf("第 %d 个包不是发往 127.0.0.1 的 UDP 包: % x", packets+1, pkt[:20])
+			}
+			rest = rest[16+n:]
+		}
+		if packets < 4 {
+			t.Errorf("应至少抓到 4 个包，实际为 %d", packets)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ecsOptionCode EDNS Client Subnet 选项的编号（RFC 7871）
+const ecsOptionCode = 8
+
+// ecsUDPSize 携带 EDNS0 时声明的 UDP 应答大小
+const ecsUDPSize = 1232
+
+// ecsSubnet -dns-ecs 中的一个客户端子网，如 "北京=202.96.0.0/24"
+type ecsSubnet struct {
+	label  string // 名称（通常为省份），未命名时为子网
+	prefix netip.Prefix
+}
+
+// parseECS 解析 -dns-ecs：逗号分隔的 [名称=]子网，如 "北京=202.96.0.0/24,广东=113.108.0.0/24"
+func parseECS(s string) ([]ecsSubnet, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var subnets []ecsSubnet
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		label, cidr, named := strings.Cut(item, "=")
+		if !named {
+			label, cidr = "", item
+		}
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("-dns-ecs 中的 '%s' 无效，应为 [名称=]子网，如 北京=202.96.0.0/24", item)
+		}
+		prefix = prefix.Masked()
+		label = strings.TrimSpace(label)
+		if label == "" {
+			label = prefix.String()
+		}
+		if seen[label] {
+			return nil, fmt.Errorf("-dns-ecs 中的 '%s' 重复", label)
+		}
+		seen[label] = true
+		subnets = append(subnets, ecsSubnet{label: label, prefix: prefix})
+	}
+	return subnets, nil
+}
+
+// option 该子网的 ECS 选项：地址族、源前缀长度、作用域前缀长度（查询时为 0）和按前缀长度截断的地址
+func (e ecsSubnet) option() dnsmessage.Option {
+	family := byte(1)
+	if e.prefix.Addr().Is6() {
+		family = 2
+	}
+	bits := e.prefix.Bits()
+	addr := e.prefix.Addr().AsSlice()[:(bits+7)/8]
+	return dnsmessage.Option{Code: ecsOptionCode, Data: append([]byte{0, family, byte(bits), 0}, addr...)}
+}
+
+// ECSAnswer 携带一个客户端子网查询时解析服务器返回的结果
+type ECSAnswer struct {
+	Label   string   `json:"label"`
+	Subnet  string   `json:"subnet"`
+	Answers []string `json:"answers"` // 同 dns_answers，没有 A 记录时为 NXDOMAIN 或 NODATA
+}
+
+// ECSMapping 一个客户端子网在各解析服务器上的解析结果分组，用于比较 CDN 为各省份调度的节点
+type ECSMapping struct {
+	Label    string        `json:"label"`
+	Subnet   string        `json:"subnet"`
+	Clusters []*DNSCluster `json:"clusters"`
+}
+
+// ecsMappings 按 -dns-ecs 中的顺序（各行的记录顺序相同）汇总各客户端子网的解析结果，没有 ECS 结果时返回 nil
+func ecsMappings(rows []*SnapshotRow) []*ECSMapping {
+	var mappings []*ECSMapping
+	byLabel := make(map[string]*ECSMapping)
+	for _, row := range rows {
+		for _, a := range row.ECSAnswers {
+			if byLabel[a.Label] == nil {
+				byLabel[a.Label] = &ECSMapping{Label: a.Label, Subnet: a.Subnet}
+				mappings = append(mappings, byLabel[a.Label])
+			}
+		}
+	}
+	for _, m := range mappings {
+		m.Clusters = clusterAnswers(rows, func(row *SnapshotRow) []string {
+			for _, a := range row.ECSAnswers {
+				if a.Label == m.Label {
+					return a.Answers
+				}
+			}
+			return nil
+		})
+	}
+	return mappings
+}
+
+// printECSMappings 输出各客户端子网（省份）到解析结果（CDN 节点）的对应表，
+// 同一子网在不同解析服务器上结果不同时逐组列出，多数之外的组标出解析服务器
+func (r *TableRenderer) printECSMappings(w io.Writer, mappings []*ECSMapping) {
+	fmt.Fprintln(w, "====== ECS 解析结果 ======")
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"客户端子网", "解析结果", "服务器数", "解析服务器"})
+	table.SetAutoFormatHeaders(false)
+	table.SetAutoWrapText(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetBorder(false)
+	table.SetColumnSeparator(" ")
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	for _, m := range mappings {
+		name := m.Label
+		if name != m.Subnet {
+			name += "（" + m.Subnet + "）"
+		}
+		for i, c := range m.Clusters {
+			answers := strings.Join(c.Answers, ", ")
+			// 多数解析服务器的结果不逐个列出解析服务器
+			resolvers := ""
+			if i > 0 {
+				answers = r.Theme.color(r.Theme.Warn, answers)
+				var labels []string
+				for _, item := range c.Resolvers {
+					labels = append(labels, item.label())
+				}
+				resolvers = strings.Join(labels, "，")
+			}
+			table.Append([]string{name, answers, fmt.Sprintf("%d", len(c.Resolvers)), resolvers})
+			name = ""
+		}
+	}
+	table.Render()
+}
@@ -0,0 +1,190 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 目标状态：全部丢包或探测出错为 down，丢包率或平均 RTT 达到阈值为 degraded，其余为 healthy
+const (
+	StateHealthy  = "healthy"
+	StateDegraded = "degraded"
+	StateDown     = "down"
+)
+
+// defaultEventLoss 未指定 -events-loss 时视为 degraded 的丢包率（%），与表格的告警色阈值相同
+const defaultEventLoss = 5.0
+
+// EventOptions 持续探测时目标状态变化事件的去向和判定阈值，File 和 Webhook 都为空时不产生事件
+type EventOptions struct {
+	File        string        // 事件以 JSON Lines 追加写入该文件
+	Webhook     string        // 每个事件以 JSON POST 到该地址
+	LossPercent float64       // 丢包率达到该百分比视为 degraded，为 0 时为 5
+	AvgRtt      time.Duration // 平均 RTT 达到该值视为 degraded，0 为不按时延判定
+}
+
+// Enabled 是否指定了事件的去向
+func (o EventOptions) Enabled() bool {
+	return o.File != "" || o.Webhook != ""
+}
+
+// validate 校验事件参数
+func (o EventOptions) validate() error {
+	if o.LossPercent < 0 || o.LossPercent > 100 {
+		return fmt.Errorf("事件丢包率 -events-loss 必须在 0 到 100 之间，当前为 %.1f%%", o.LossPercent)
+	}
+	if o.AvgRtt < 0 {
+		return fmt.Errorf("事件时延 -events-rtt 不能为负数")
+	}
+	if o.Webhook != "" {
+		if u, err := url.Parse(o.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("事件地址 -events-webhook 必须是 http(s) 地址，当前为 '%s'", o.Webhook)
+		}
+	}
+	return nil
+}
+
+// StateEvent 目标在两轮之间的状态变化，供改路由等下游自动化使用，时间以毫秒表示
+type StateEvent struct {
+	Type     string        `json:"type"` // 固定为 state_change
+	DestIP   string        `json:"dest_ip"`
+	Region   string        `json:"region"`
+	Isp      string        `json:"isp"`
+	Source   string        `json:"source,omitempty"`
+	Proto    string        `json:"proto,omitempty"`
+	From     string        `json:"from,omitempty"`     // 之前的状态，首轮即不健康的目标为空
+	To       string        `json:"to"`                 // 本轮的状态
+	Previous *EventMetrics `json:"previous,omitempty"` // 之前最后一轮的结果，首轮即不健康的目标为空
+	Current  *EventMetrics `json:"current"`
+	Since    *time.Time    `json:"since,omitempty"` // 之前的状态开始的时间，首轮即不健康的目标为空
+	At       time.Time     `json:"at"`
+	RunID    string        `json:"run_id"`
+}
+
+// EventMetrics 目标一轮的探测结果
+type EventMetrics struct {
+	Sent        int     `json:"sent"`
+	Recv        int     `json:"recv"`
+	LossPercent float64 `json:"loss_percent"`
+	AvgRttMs    float64 `json:"avg_rtt_ms"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// targetState 单个目标最近一轮的状态
+type targetState struct {
+	state   string
+	since   time.Time
+	metrics *EventMetrics
+}
+
+// EventEmitter 按目标记录上一轮的状态，状态变化时写入事件文件并推送；本轮没有结果的目标保持原状态
+type EventEmitter struct {
+	opts    EventOptions
+	webhook *webhookSink
+	states  map[string]*targetState
+}
+
+// NewEventEmitter 按参数创建事件发送器，未指定去向时返回 nil
+func NewEventEmitter(opts EventOptions) *EventEmitter {
+	if !opts.Enabled() {
+		return nil
+	}
+	if opts.LossPercent == 0 {
+		opts.LossPercent = defaultEventLoss
+	}
+	e := &EventEmitter{opts: opts, states: make(map[string]*targetState)}
+	if opts.Webhook != "" {
+		e.webhook = &webhookSink{url: opts.Webhook, client: &http.Client{Timeout: 10 * time.Second}}
+	}
+	return e
+}
+
+// Evaluate 用一轮探测的结果更新各目标的状态，返回本轮产生并已发送的事件；首轮健康的目标只记录状态，不产生事件
+func (e *EventEmitter) Evaluate(snap *Snapshot, now time.Time) []*StateEvent {
+	if e == nil {
+		return nil
+	}
+	var events []*StateEvent
+	for _, row := range slices.Concat(snap.Rows, snap.Unanswered) {
+		key := strings.Join([]string{row.DestIP, row.Isp, row.Region, row.Source, row.Proto}, "|")
+		current := &EventMetrics{Sent: row.Sent, Recv: row.Recv, LossPercent: row.LossPercent, AvgRttMs: row.AvgRttMs, Error: row.Error}
+		state := e.state(row)
+		prev := e.states[key]
+		if prev != nil && prev.state == state {
+			prev.metrics = current
+			continue
+		}
+		e.states[key] = &targetState{state: state, since: now, metrics: current}
+		if prev == nil && state == StateHealthy {
+			continue
+		}
+		event := &StateEvent{Type: "state_change", DestIP: row.DestIP, Region: row.Region, Isp: row.Isp, Source: row.Source,
+			Proto: row.Proto, To: state, Current: current, At: now, RunID: snap.RunID}
+		if prev != nil {
+			event.From, event.Previous, event.Since = prev.state, prev.metrics, &prev.since
+		}
+		events = append(events, event)
+	}
+	for _, event := range events {
+		if err := e.emit(event); err != nil {
+			log.Printf("⚠️  发送状态变化事件失败: %v\n", err)
+		}
+	}
+	return events
+}
+
+// state 目标本轮的状态
+func (e *EventEmitter) state(row *SnapshotRow) string {
+	switch {
+	case row.Error != "" || (row.Sent > 0 && row.Recv == 0):
+		return StateDown
+	case row.LossPercent >= e.opts.LossPercent:
+		return StateDegraded
+	case e.opts.AvgRtt > 0 && msToDuration(row.AvgRttMs) >= e.opts.AvgRtt:
+		return StateDegraded
+	}
+	return StateHealthy
+}
+
+// emit 把事件追加写入事件文件并推送，两者互不影响
+func (e *EventEmitter) emit(event *StateEvent) error {
+	var errs []string
+	if e.opts.File != "" {
+		if err := appendEvent(e.opts.File, event); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if e.webhook != nil {
+		if err := e.webhook.post(event); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "；"))
+	}
+	return nil
+}
+
+// appendEvent 把一个事件作为一行 JSON 追加写入文件
+func appendEvent(path string, event *StateEvent) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("打开事件文件 %s 失败: %v", path, err)
+	}
+	defer f.Close()
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("写入事件文件 %s 失败: %v", path, err)
+	}
+	return nil
+}
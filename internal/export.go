@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strconv"
+	texttemplate "text/template"
+	"time"
+)
+
+// csvRenderer 以 CSV 格式输出全部结果，列名与 JSON 格式的字段名一致
+type csvRenderer struct{}
+
+func (csvRenderer) Render(w io.Writer, result *RunResult) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"dest_ip", "region", "isp", "sent", "recv", "loss_percent", "duplicates",
+		"min_rtt_ms", "max_rtt_ms", "avg_rtt_ms", "stddev_rtt_ms", "updated_at", "source", "proto", "error", "group", "run_id",
+	})
+	var runID string
+	if result.Snapshot != nil {
+		runID = result.Snapshot.RunID
+	}
+	formatMs := func(d time.Duration) string {
+		return strconv.FormatFloat(durationToMs(d), 'f', 3, 64)
+	}
+	for _, sum := range result.Rows {
+		cw.Write([]string{
+			sum.DestIP,
+			sum.Region,
+			sum.Isp,
+			strconv.Itoa(sum.TotalSent),
+			strconv.Itoa(sum.TotalRecv),
+			strconv.FormatFloat(sum.PacketLoss, 'f', 1, 64),
+			strconv.Itoa(sum.PacketsRecvDuplicates),
+			formatMs(sum.MinRtt),
+			formatMs(sum.MaxRtt),
+			formatMs(sum.AvgRtt),
+			formatMs(sum.StdDevRtt),
+			sum.LastUpdated.Format(time.RFC3339),
+			sum.Source,
+			sum.Proto,
+			sum.Error,
+			sum.Group,
+			runID,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// htmlRenderer 输出单文件 HTML 报告，内容与表格格式的两个分节一致
+type htmlRenderer struct {
+	Loss      LossThresholds
+	Aggregate *texttemplate.Template // 非空时按服务汇总，每个服务可展开查看其各目标
+}
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"ms": func(d time.Duration) string {
+		return fmt.Sprintf("%.1fms", durationToMs(d))
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>dping 报告 {{.Snapshot.CreatedAt.Format "2006-01-02 15:04:05"}}</title>
+<style>
+body { font-family: -apple-system, "PingFang SC", "Microsoft YaHei", sans-serif; margin: 24px; color: #222; }
+table { border-collapse: collapse; margin-bottom: 24px; }
+th, td { padding: 4px 10px; border-bottom: 1px solid #ddd; text-align: left; white-space: nowrap; }
+th { background: #f4f4f4; }
+tfoot td { font-weight: bold; }
+.good { color: #1a7f37; } .warn { color: #b08800; } .bad { color: #cf222e; font-weight: bold; }
+.meta { color: #666; }
+</style>
+</head>
+<body>
+<h1>dping 报告</h1>
+<p class="meta">生成时间 {{.Snapshot.CreatedAt.Format "2006-01-02 15:04:05"}} · 主机 {{.Snapshot.Host}} · 源IP {{.Snapshot.Source}} · 运营商 {{.Snapshot.Isp}} · 区域 {{.Snapshot.Region}} · 发包 {{.Snapshot.Count}}</p>
+{{with .Snapshot.RunID}}<p class="meta">运行 ID {{.}}</p>
+{{end}}{{with .Snapshot.Note}}<p class="meta">备注 {{.}}</p>
+{{end}}{{range .Snapshot.Gateways}}<p class="meta{{if not .Reachable}} bad{{end}}">{{.}}</p>
+{{end}}{{with .Services}}
+<h2>按服务汇总结果</h2>
+{{range .}}<details>
+<summary>{{.Agg.Name}}{{with .Agg.Source}} 源{{.}}{{end}}{{with .Agg.Proto}} {{.}}{{end}}：{{len .Rows}} 个目标，丢包 <span class="{{.LossClass}}">{{printf "%.1f%%" .Agg.Loss}}</span>（{{printf "%.1f%%" .Agg.BestLoss}} ~ {{printf "%.1f%%" .Agg.WorstLoss}}），AvgRTT {{ms .Agg.AvgRtt}}（{{ms .Agg.BestRtt}} ~ {{ms .Agg.WorstRtt}}），最差 {{.Agg.Worst.DestIP}}</summary>
+<table>
+<thead><tr><th>目标IP</th><th>地区</th><th>运营商</th><th>发</th><th>收</th><th>丢包%</th><th>AvgRTT</th>{{if $.WithError}}<th>错误</th>{{end}}</tr></thead>
+<tbody>
+{{range .Rows}}<tr><td>{{.Sum.DestIP}}</td><td>{{.Sum.Region}}</td><td>{{.Sum.Isp}}</td><td>{{.Sum.TotalSent}}</td><td>{{.Sum.TotalRecv}}</td><td class="{{.LossClass}}">{{printf "%.1f%%" .Sum.PacketLoss}}</td><td>{{ms .Sum.AvgRtt}}</td>{{if $.WithError}}<td class="bad">{{.Sum.Error}}</td>{{end}}</tr>
+{{end}}</tbody>
+</table>
+</details>
+{{end}}{{end}}{{range .Sections}}
+<h2>{{.Title}}</h2>
+<table>
+<thead><tr><th>目标IP</th><th>地区</th><th>运营商</th>{{if $.MultiSource}}<th>源IP</th>{{end}}{{if $.MultiProto}}<th>协议</th>{{end}}<th>发</th><th>收</th><th>丢包%</th><th>重传</th><th>MinRTT</th><th>MaxRTT</th><th>AvgRTT</th><th>更新时间</th>{{if $.WithError}}<th>错误</th>{{end}}</tr></thead>
+<tbody>
+{{range .Rows}}<tr><td>{{.Sum.DestIP}}</td><td>{{.Sum.Region}}</td><td>{{.Sum.Isp}}</td>{{if $.MultiSource}}<td>{{.Sum.Source}}</td>{{end}}{{if $.MultiProto}}<td>{{.Sum.Proto}}</td>{{end}}<td>{{.Sum.TotalSent}}</td><td>{{.Sum.TotalRecv}}</td><td class="{{.LossClass}}">{{printf "%.1f%%" .Sum.PacketLoss}}</td><td>{{.Sum.PacketsRecvDuplicates}}</td><td>{{ms .Sum.MinRtt}}</td><td>{{ms .Sum.MaxRtt}}</td><td>{{ms .Sum.AvgRtt}}</td><td>{{.Sum.LastUpdated.Format "15:04:05"}}</td>{{if $.WithError}}<td class="bad">{{.Sum.Error}}</td>{{end}}</tr>
+{{end}}</tbody>
+{{with .Totals}}<tfoot><tr><td>总计</td><td></td><td></td>{{if $.MultiSource}}<td></td>{{end}}{{if $.MultiProto}}<td></td>{{end}}<td>{{.Sent}}</td><td>{{.Recv}}</td><td>{{if .Sent}}{{printf "%.1f%%" .LossPercent}}{{else}}-{{end}}</td><td>{{.Duplicates}}</td>{{if .Recv}}<td>{{printf "%.1fms" .MinRttMs}}</td><td>{{printf "%.1fms" .MaxRttMs}}</td><td>{{printf "%.1fms" .AvgRttMs}}</td>{{else}}<td>-</td><td>-</td><td>-</td>{{end}}<td></td>{{if $.WithError}}<td></td>{{end}}</tr></tfoot>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+type htmlRow struct {
+	Sum       *SummaryStatistic
+	LossClass string
+}
+
+type htmlSection struct {
+	Title  string
+	Rows   []htmlRow
+	Totals *Totals // 表尾的总计行
+}
+
+// htmlService 按服务汇总的一个服务，展开后为其各目标
+type htmlService struct {
+	Agg       *serviceAggregate
+	LossClass string
+	Rows      []htmlRow
+}
+
+func (r htmlRenderer) Render(w io.Writer, result *RunResult) error {
+	lossClass := func(loss float64) string {
+		switch {
+		case loss < r.Loss.Warn:
+			return "good"
+		case loss < r.Loss.Crit:
+			return "warn"
+		}
+		return "bad"
+	}
+	htmlRows := func(list []*SummaryStatistic) []htmlRow {
+		var rows []htmlRow
+		for _, sum := range list {
+			rows = append(rows, htmlRow{Sum: sum, LossClass: lossClass(sum.PacketLoss)})
+		}
+		return rows
+	}
+	totals := result.totals()
+	sections := []htmlSection{
+		{Title: "汇总统计结果", Rows: htmlRows(result.Grouped), Totals: totals.Summary.Total},
+		{Title: "丢包汇总统计结果", Rows: htmlRows(result.LossOnly), Totals: totals.LossOnly.Total},
+	}
+	// 按服务汇总时以可展开的服务代替逐个目标的汇总表
+	var services []htmlService
+	if r.Aggregate != nil {
+		for _, agg := range aggregateServices(r.Aggregate, result.Rows) {
+			services = append(services, htmlService{Agg: agg, LossClass: lossClass(agg.Loss()), Rows: htmlRows(agg.Members)})
+		}
+		sections = sections[1:]
+	}
+	return htmlReport.Execute(w, map[string]interface{}{
+		"Snapshot":    result.Snapshot,
+		"MultiSource": multiSource(result.Rows),
+		"MultiProto":  summaryHasProto(result.Rows),
+		"WithError":   summaryHasError(result.Rows),
+		"Services":    services,
+		"Sections":    sections,
+	})
+}
+
+// exportFormats 交互界面导出支持的格式：按键 -> 格式名
+var exportFormats = map[byte]string{'c': "csv", 'j': "json", 'h': "html"}
+
+// exportView 将当前视图写入带时间戳的文件，返回文件名；aggregate 非空时 HTML 报告按服务汇总
+func exportView(view []*SummaryStatistic, meta *Snapshot, format string, loss LossThresholds, aggregate *texttemplate.Template) (string, error) {
+	var renderer Renderer
+	switch format {
+	case "csv":
+		renderer = csvRenderer{}
+	case "json":
+		renderer = jsonRenderer{}
+	case "html":
+		renderer = htmlRenderer{Loss: loss, Aggregate: aggregate}
+	default:
+		return "", fmt.Errorf("不支持的导出格式 '%s'", format)
+	}
+
+	snap := NewSnapshot(view, meta.Isp, meta.Region, meta.Source, meta.Count)
+	snap.RunID, snap.Note = meta.RunID, meta.Note
+	var lossOnly []*SummaryStatistic
+	for _, sum := range view {
+		if sum.PacketLoss > 0 {
+			lossOnly = append(lossOnly, sum)
+		}
+	}
+	result := newRunResult(snap, view, view, lossOnly)
+
+	name := fmt.Sprintf("dping-%s.%s", time.Now().Format("20060102-150405"), format)
+	f, err := os.Create(name)
+	if err != nil {
+		return "", fmt.Errorf("创建 %s 失败: %v", name, err)
+	}
+	defer f.Close()
+	if err := renderer.Render(f, result); err != nil {
+		return "", fmt.Errorf("写入 %s 失败: %v", name, err)
+	}
+	return name, nil
+}
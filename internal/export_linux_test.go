@@ -0,0 +1,14 @@
+package internal
+
+// DefaultRoute 从 path 的路由表中读取跃点数最小的默认路由，v6 为 true 时按 IPv6 路由表的格式解析
+func DefaultRoute(path string, v6 bool) (ip, iface string, err error) {
+	parse := parseDefaultRoute
+	if v6 {
+		parse = parseDefaultRoute6
+	}
+	route, err := readDefaultRoute(path, !v6, parse)
+	if err != nil {
+		return "", "", err
+	}
+	return route.ip.String(), route.iface, nil
+}
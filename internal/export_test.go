@@ -0,0 +1,225 @@
+package internal
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ping/ping"
+	"golang.org/x/net/bpf"
+	"golang.org/x/net/proxy"
+)
+
+// 供 internal_test 包中的测试直接检查未导出的计算函数
+
+// RTTHalfWidth 依次加入 rtts 后 RTT 均值 95% 置信区间的半宽
+func RTTHalfWidth(rtts ...time.Duration) time.Duration {
+	e := &rttEstimator{}
+	for _, rtt := range rtts {
+		e.add(rtt)
+	}
+	return e.halfWidth()
+}
+
+// 对比的显著性检验
+var (
+	TCritical95     = tCritical95
+	WelchMargin     = welchMargin
+	LossSignificant = lossSignificant
+)
+
+// 代理
+var ParseProxyURL = parseProxyURL
+
+// NewProxyDialer 按代理地址创建经代理建连的 Dialer
+func NewProxyDialer(raw string) (proxy.ContextDialer, error) {
+	u, err := parseProxyURL(raw)
+	if err != nil {
+		return nil, err
+	}
+	return newProxyDialer(u, &net.Dialer{})
+}
+
+// 抓包
+var CapturedPacket = capturedPacket
+
+// CaptureFilterAccepts 在 BPF 虚拟机中运行 captureFilter 为 target 生成的过滤程序，返回是否放行 pkt
+func CaptureFilterAccepts(target net.IP, pkt []byte) (bool, error) {
+	raw, err := captureFilter(target)
+	if err != nil {
+		return false, err
+	}
+	prog, _ := bpf.Disassemble(raw)
+	vm, err := bpf.NewVM(prog)
+	if err != nil {
+		return false, err
+	}
+	n, err := vm.Run(pkt)
+	return n > 0, err
+}
+
+// WritePcap 写入 pcap 文件头和 pkts，每个包的时间戳依次加 1 秒
+func WritePcap(w io.Writer, ts time.Time, pkts ...[]byte) error {
+	pw, err := newPcapWriter(w)
+	if err != nil {
+		return err
+	}
+	for i, pkt := range pkts {
+		if err := pw.write(ts.Add(time.Duration(i)*time.Second), pkt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 推送
+var NewPusher = newPusher
+
+// ProbeWithRetry 以并发上限 limit 执行一次带重试的探测，返回退避重试的次数和探测的错误
+func ProbeWithRetry(prober Prober, limit int) (int, error) {
+	limiter := newProbeLimiter(limit)
+	limiter.acquire()
+	defer limiter.release()
+	_, err := probeWithRetry(prober, limiter, net.IPv4(127, 0, 0, 1), nil, 1, AdaptiveOptions{})
+	_, _, retries := limiter.result()
+	return retries, err
+}
+
+// 探测自检
+var PercentileOf = percentileOf
+
+// TelemetryRecorder 以合成的调用驱动 telemetryRecorder
+type TelemetryRecorder struct{ r telemetryRecorder }
+
+func (t *TelemetryRecorder) Schedule(n int)                         { t.r.schedule(n) }
+func (t *TelemetryRecorder) Started(queueWait, delay time.Duration) { t.r.started(queueWait, delay) }
+func (t *TelemetryRecorder) Sent(wait time.Duration)                { t.r.sent(wait) }
+func (t *TelemetryRecorder) Queued(n int)                           { t.r.queued(n) }
+func (t *TelemetryRecorder) Finished(lost bool)                     { t.r.finished(lost) }
+func (t *TelemetryRecorder) Fail()                                  { t.r.fail() }
+func (t *TelemetryRecorder) Result() *Telemetry                     { return t.r.result() }
+
+// WHOIS
+var (
+	WhoisFields    = whoisFields
+	NormalizeWhois = normalizeWhois
+	MatchChinaIsp  = matchChinaIsp
+	MatchProvince  = matchProvince
+)
+
+// ParseWhois 返回由注册信息推断出的地区和运营商
+func ParseWhois(resp string) (region, isp string) {
+	info := parseWhois(resp)
+	return info.Region, info.Isp
+}
+
+// LookupWhois 通过 query 查询 ip 的注册信息，返回推断出的地区和运营商
+func LookupWhois(query func(server string, query string) (string, error), ip string) (region, isp string, err error) {
+	info, err := lookupWhois(query, ip)
+	if err != nil {
+		return "", "", err
+	}
+	return info.Region, info.Isp, nil
+}
+
+// WhoisCached 返回 queriedAt 时查询的缓存结果当前是否仍然有效
+func WhoisCached(queriedAt time.Time) bool {
+	c := &whoisCache{entries: map[string]*whoisInfo{"1.1.1.1": {QueriedAt: queriedAt}}}
+	return c.get("1.1.1.1") != nil
+}
+
+// 本地链路
+var (
+	ReadNameservers = readNameservers
+	QuotedEcho      = quotedEcho
+	MergeTargets    = mergeTargets
+)
+
+// ICMP 时间戳
+const MsPerDay = msPerDay
+
+var (
+	MsSinceMidnight = msSinceMidnight
+	MsDiff          = msDiff
+	TimestampOnce   = timestampOnce
+)
+
+// 时延预算
+var (
+	LookupBudget   = lookupBudget
+	EvaluateBudget = evaluateBudget
+)
+
+// BudgetViolations 返回 sum 超出预算 b 的指标
+func BudgetViolations(b *Budget, sum *SummaryStatistic) []string {
+	return b.violations(sum)
+}
+
+// TCP 建连结果分类
+
+// ProbeTCP 对 127.0.0.1 的 port 执行 count 次 TCP 建连探测，返回统计结果和建连结果分类
+func ProbeTCP(port, count int) (*ping.Statistics, *TCPOutcomes, error) {
+	p := &tcpProber{port: port}
+	to := net.IPv4(127, 0, 0, 1)
+	stats, err := p.Probe(to, nil, count, AdaptiveOptions{})
+	var outcomes *TCPOutcomes
+	if d := p.Details(to, nil); d != nil {
+		outcomes = d.TCP
+	}
+	return stats, outcomes, err
+}
+
+// RecordTCPOutcome 按建连错误 err 分类计数
+func RecordTCPOutcome(o *TCPOutcomes, err error) { o.record(err) }
+
+// 诊断
+var PprofHandler = pprofHandler
+
+// 表格输出
+var (
+	LookupTheme        = lookupTheme
+	LowPriorityColumns = lowPriorityColumns
+)
+
+// 按输出参数选择的 Renderer
+var NewRenderer = newRenderer
+
+// 分页
+var WritePaged = writePaged
+
+// TUI 不进入终端，以按键直接驱动交互界面的状态
+type TUI struct{ s *tuiState }
+
+func NewTUI(result *RunResult, renderer *TableRenderer, sortField string, des bool) *TUI {
+	return &TUI{newTUIState(result, renderer, sortField, des)}
+}
+
+// Keys 依次处理 keys 中的按键，返回是否仍在交互界面中
+func (t *TUI) Keys(keys string) bool {
+	reader := bufio.NewReader(strings.NewReader(keys))
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return true
+		}
+		if !t.s.handleKey(b, reader) {
+			return false
+		}
+	}
+}
+
+// View 当前视图中的结果
+func (t *TUI) View() []*SummaryStatistic { return t.s.view() }
+
+// Status 当前的状态栏
+func (t *TUI) Status() string { return t.s.statusLine(len(t.s.view())) }
+
+// NTP
+var (
+	ValidateNTPTarget = validateNTPTarget
+	ToNTPTime         = toNTPTime
+	FromNTPTime       = fromNTPTime
+	NTPOnce           = ntpOnce
+)
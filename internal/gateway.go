@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"time"
+)
+
+// 检查网关二层可达性时每次请求等待应答的时长和尝试次数
+const (
+	gatewayProbeTimeout  = time.Second
+	gatewayProbeAttempts = 3
+)
+
+var errNeighborTimeout = errors.New("没有应答")
+
+// gatewayRoute 默认路由的网关及其出口网卡
+type gatewayRoute struct {
+	ip    net.IP
+	iface string
+}
+
+// GatewayCheck 探测前对一个默认网关的二层可达性检查（IPv4 为 ARP，IPv6 为邻居发现）
+type GatewayCheck struct {
+	IP        string  `json:"ip"`
+	Iface     string  `json:"iface"`
+	Method    string  `json:"method"` // arp 或 ndp
+	Reachable bool    `json:"reachable"`
+	MAC       string  `json:"mac,omitempty"`
+	RttMs     float64 `json:"rtt_ms,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// String 用于运行信息和表格标题，如 "默认网关 192.168.1.1（eth0）ARP 可达，MAC aa:bb:cc:dd:ee:ff，0.3ms"
+func (c *GatewayCheck) String() string {
+	s := fmt.Sprintf("默认网关 %s（%s）%s ", c.IP, c.Iface, map[string]string{"arp": "ARP", "ndp": "NDP"}[c.Method])
+	if !c.Reachable {
+		return s + "不可达: " + c.Error
+	}
+	s += "可达"
+	if c.MAC != "" {
+		s += "，MAC " + c.MAC
+	}
+	return s + fmt.Sprintf("，%.1fms", c.RttMs)
+}
+
+// checkGateways 检查 IPv4 和 IPv6 默认网关（有默认路由时）的二层可达性，并在标准错误中输出结果；
+// 网关不可达时探测结果的丢包多半来自本地链路，而不是目标
+func checkGateways(netns string) []*GatewayCheck {
+	var checks []*GatewayCheck
+	inNetns(netns, func() error {
+		found := false
+		for _, family := range []struct {
+			method string
+			route  func() (gatewayRoute, error)
+			probe  func(gatewayRoute) (net.HardwareAddr, time.Duration, error)
+		}{{"arp", defaultGateway, arpProbe}, {"ndp", defaultGateway6, ndpProbe}} {
+			gw, err := family.route()
+			if err != nil {
+				continue
+			}
+			found = true
+			check := &GatewayCheck{IP: gw.ip.String(), Iface: gw.iface, Method: family.method}
+			mac, rtt, err := family.probe(gw)
+			if err != nil {
+				check.Error = err.Error()
+			} else {
+				check.Reachable, check.RttMs = true, durationToMs(rtt)
+				if mac != nil {
+					check.MAC = mac.String()
+				}
+			}
+			checks = append(checks, check)
+		}
+		if !found {
+			log.Printf("⚠️  未发现默认网关，不检查二层可达性\n")
+		}
+		return nil
+	})
+	for _, check := range checks {
+		if check.Reachable {
+			fmt.Fprintf(os.Stderr, "✅ %s\n", check)
+		} else {
+			log.Printf("⚠️  %s，本地链路可能中断，各目标的丢包多半来自本地\n", check)
+		}
+	}
+	return checks
+}
@@ -0,0 +1,250 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+)
+
+// 当前线程所在网络命名空间的路由表，-netns 时在切换命名空间的线程中读取
+const (
+	routeTable  = "/proc/thread-self/net/route"
+	routeTable6 = "/proc/thread-self/net/ipv6_route"
+)
+
+// defaultGateway 读取 IPv4 路由表中跃点数最小的默认路由
+func defaultGateway() (gatewayRoute, error) {
+	return readDefaultRoute(routeTable, true, parseDefaultRoute)
+}
+
+// defaultGateway6 读取 IPv6 路由表中跃点数最小的默认路由
+func defaultGateway6() (gatewayRoute, error) {
+	return readDefaultRoute(routeTable6, false, parseDefaultRoute6)
+}
+
+// parseDefaultRoute 解析 IPv4 路由表的一行，不是经网关的默认路由时 ok 为 false
+func parseDefaultRoute(fields []string) (route gatewayRoute, metric int, ok bool) {
+	// Iface Destination Gateway Flags RefCnt Use Metric Mask ...，地址为小端序十六进制
+	if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+		return gatewayRoute{}, 0, false
+	}
+	flags, err := strconv.ParseUint(fields[3], 16, 16)
+	if err != nil || flags&0x2 == 0 { // RTF_GATEWAY
+		return gatewayRoute{}, 0, false
+	}
+	metric, err = strconv.Atoi(fields[6])
+	raw, hexErr := hex.DecodeString(fields[2])
+	if err != nil || hexErr != nil || len(raw) != 4 {
+		return gatewayRoute{}, 0, false
+	}
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(raw))
+	return gatewayRoute{ip: ip, iface: fields[0]}, metric, true
+}
+
+// parseDefaultRoute6 解析 IPv6 路由表的一行，不是经网关的默认路由时 ok 为 false
+func parseDefaultRoute6(fields []string) (route gatewayRoute, metric int, ok bool) {
+	// 目的地址 前缀长度 源地址 源前缀长度 下一跳 跃点数 引用数 使用数 标志 网卡，地址为十六进制
+	if len(fields) < 10 || fields[1] != "00" || strings.Trim(fields[0], "0") != "" {
+		return gatewayRoute{}, 0, false
+	}
+	m, err := strconv.ParseInt(fields[5], 16, 64)
+	raw, hexErr := hex.DecodeString(fields[4])
+	if err != nil || hexErr != nil || len(raw) != net.IPv6len || net.IP(raw).IsUnspecified() {
+		return gatewayRoute{}, 0, false
+	}
+	return gatewayRoute{ip: net.IP(raw), iface: fields[9]}, int(m), true
+}
+
+// readDefaultRoute 逐行解析路由表，返回跃点数最小的默认路由；header 为 true 时跳过第一行表头
+func readDefaultRoute(path string, header bool, parse func(fields []string) (gatewayRoute, int, bool)) (gatewayRoute, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return gatewayRoute{}, err
+	}
+	defer f.Close()
+
+	var best gatewayRoute
+	bestMetric := -1
+	scanner := bufio.NewScanner(f)
+	if header {
+		scanner.Scan()
+	}
+	for scanner.Scan() {
+		route, metric, ok := parse(strings.Fields(scanner.Text()))
+		if ok && (bestMetric < 0 || metric < bestMetric) {
+			best, bestMetric = route, metric
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return gatewayRoute{}, fmt.Errorf("读取路由表失败: %v", err)
+	}
+	if best.ip == nil {
+		return gatewayRoute{}, errors.New("路由表中没有默认路由")
+	}
+	return best, nil
+}
+
+// arpProbe 在网卡上广播 ARP 请求，返回网关的 MAC 地址和应答耗时，需要 root 权限
+func arpProbe(gw gatewayRoute) (net.HardwareAddr, time.Duration, error) {
+	ifi, err := net.InterfaceByName(gw.iface)
+	if err != nil {
+		return nil, 0, err
+	}
+	src, err := interfaceIPv4(ifi)
+	if err != nil {
+		return nil, 0, err
+	}
+	proto := htons(syscall.ETH_P_ARP)
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_DGRAM, int(proto))
+	if err != nil {
+		return nil, 0, fmt.Errorf("创建 ARP 套接字失败: %w", err)
+	}
+	defer syscall.Close(fd)
+	if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: proto, Ifindex: ifi.Index}); err != nil {
+		return nil, 0, fmt.Errorf("绑定到 %s 失败: %w", gw.iface, err)
+	}
+	tv := syscall.NsecToTimeval(int64(gatewayProbeTimeout))
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		return nil, 0, err
+	}
+
+	// 以太网上的 IPv4 ARP 请求：硬件类型 1、协议类型 0x0800、地址长度 6 和 4、操作码 1
+	req := []byte{0, 1, 8, 0, 6, 4, 0, 1}
+	req = append(req, ifi.HardwareAddr...)
+	req = append(req, src.To4()...)
+	req = append(req, make([]byte, 6)...)
+	req = append(req, gw.ip.To4()...)
+	broadcast := &syscall.SockaddrLinklayer{Protocol: proto, Ifindex: ifi.Index, Halen: 6, Addr: [8]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}}
+
+	buf := make([]byte, 128)
+	for range gatewayProbeAttempts {
+		start := time.Now()
+		if err := syscall.Sendto(fd, req, 0, broadcast); err != nil {
+			return nil, 0, fmt.Errorf("发送 ARP 请求失败: %w", err)
+		}
+		for time.Since(start) < gatewayProbeTimeout {
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err != nil {
+				if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+					continue
+				}
+				return nil, 0, err
+			}
+			// 应答的操作码为 2，发送方协议地址为网关
+			if n >= 28 && buf[7] == 2 && bytes.Equal(buf[14:18], gw.ip.To4()) {
+				return net.HardwareAddr(bytes.Clone(buf[8:14])), time.Since(start), nil
+			}
+		}
+	}
+	return nil, 0, errNeighborTimeout
+}
+
+// ndpProbe 向网关的请求节点组播地址发送邻居请求，返回网关的 MAC 地址和应答耗时，需要 root 权限
+func ndpProbe(gw gatewayRoute) (net.HardwareAddr, time.Duration, error) {
+	ifi, err := net.InterfaceByName(gw.iface)
+	if err != nil {
+		return nil, 0, err
+	}
+	conn, err := listenICMP(gw.ip, nil, gw.iface)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	// 邻居发现报文的跳数限制必须为 255，接收方据此确认报文来自本链路
+	p := ipv6.NewPacketConn(conn)
+	if err := p.SetMulticastHopLimit(255); err != nil {
+		return nil, 0, err
+	}
+	if err := p.SetMulticastInterface(ifi); err != nil {
+		return nil, 0, err
+	}
+
+	// 保留字段、目标地址，以及携带本机 MAC 的源链路层地址选项（类型 1，长度 1 即 8 字节）
+	data := append(make([]byte, 4), gw.ip.To16()...)
+	if len(ifi.HardwareAddr) == 6 {
+		data = append(append(data, 1, 1), ifi.HardwareAddr...)
+	}
+	msg := icmp.Message{Type: ipv6.ICMPTypeNeighborSolicitation, Body: &icmp.RawBody{Data: data}}
+	wb, err := msg.Marshal(nil) // 校验和由内核计算
+	if err != nil {
+		return nil, 0, err
+	}
+	ip := gw.ip.To16()
+	group := &net.IPAddr{IP: net.IP{0xff, 0x02, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0xff, ip[13], ip[14], ip[15]}, Zone: gw.iface}
+
+	rb := make([]byte, 1500)
+	for range gatewayProbeAttempts {
+		start := time.Now()
+		if _, err := conn.WriteTo(wb, group); err != nil {
+			return nil, 0, fmt.Errorf("发送邻居请求失败: %w", err)
+		}
+		conn.SetReadDeadline(start.Add(gatewayProbeTimeout))
+		for {
+			n, _, err := conn.ReadFrom(rb)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				return nil, 0, err
+			}
+			reply, err := icmp.ParseMessage(58, rb[:n])
+			if err != nil || reply.Type != ipv6.ICMPTypeNeighborAdvertisement {
+				continue
+			}
+			body, ok := reply.Body.(*icmp.RawBody)
+			if !ok || len(body.Data) < 20 || !net.IP(body.Data[4:20]).Equal(gw.ip) {
+				continue
+			}
+			return targetLinkAddr(body.Data[20:]), time.Since(start), nil
+		}
+	}
+	return nil, 0, errNeighborTimeout
+}
+
+// targetLinkAddr 从邻居通告的选项中取出目标链路层地址（类型 2），没有时返回 nil
+func targetLinkAddr(opts []byte) net.HardwareAddr {
+	for len(opts) >= 8 && opts[1] > 0 {
+		size := int(opts[1]) * 8
+		if size > len(opts) {
+			break
+		}
+		if opts[0] == 2 {
+			return net.HardwareAddr(bytes.Clone(opts[2:size]))
+		}
+		opts = opts[size:]
+	}
+	return nil
+}
+
+// interfaceIPv4 网卡的第一个 IPv4 地址，作为 ARP 请求的发送方地址
+func interfaceIPv4(ifi *net.Interface) (net.IP, error) {
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return ipNet.IP, nil
+		}
+	}
+	return nil, fmt.Errorf("网卡 %s 没有 IPv4 地址", ifi.Name)
+}
+
+// htons 转换为网络字节序
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
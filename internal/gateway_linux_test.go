@@ -0,0 +1,53 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeRouteTable 把 content 写入临时的路由表文件
+func writeRouteTable(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "route")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDefaultRoute(t *testing.T) {
+	for _, c := range []struct {
+		name, table string
+		v6          bool
+		ip, iface   string
+	}{
+		{"取跃点数最小的默认路由", `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	00000000	0101A8C0	0003	0	0	600	00000000	0	0	0
+wlan0	00000000	FE01A8C0	0003	0	0	100	00000000	0	0	0
+tun0	00000000	00000000	0001	0	0	0	00000000	0	0	0
+eth0	0001A8C0	00000000	0001	0	0	600	00FFFFFF	0	0	0
+`, false, "192.168.1.254", "wlan0"},
+		{"IPv6 取跃点数最小的默认路由", `fe800000000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     eth0
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000400 00000001 00000000 00000003     eth0
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000002 00000064 00000001 00000000 00000003    wlan0
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 00000000000000000000000000000000 00000000 00000001 00000000 00200200       lo
+`, true, "fe80::2", "wlan0"},
+	} {
+		ip, iface, err := internal.DefaultRoute(writeRouteTable(t, c.table), c.v6)
+		if err != nil || ip != c.ip || iface != c.iface {
+			t.Errorf("%s: 应为 %s（%s），实际为 %s（%s） %v", c.name, c.ip, c.iface, ip, iface, err)
+		}
+	}
+
+	// 没有经网关的默认路由，或路由表无法读取时返回错误
+	noDefault := writeRouteTable(t, "Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT\n"+
+		"tun0	00000000	00000000	0001	0	0	0	00000000	0	0	0\n")
+	if _, _, err := internal.DefaultRoute(noDefault, false); err == nil {
+		t.Error("没有经网关的默认路由时应返回错误")
+	}
+	if _, _, err := internal.DefaultRoute(filepath.Join(t.TempDir(), "missing"), false); err == nil {
+		t.Error("路由表不存在时应返回错误")
+	}
+}
@@ -0,0 +1,28 @@
+//go:build !linux
+
+package internal
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+var errGatewayUnsupported = errors.New("只支持 Linux")
+
+// defaultGateway 只有 Linux 支持读取路由表，其他系统上不探测默认网关
+func defaultGateway() (gatewayRoute, error) {
+	return gatewayRoute{}, errGatewayUnsupported
+}
+
+func defaultGateway6() (gatewayRoute, error) {
+	return gatewayRoute{}, errGatewayUnsupported
+}
+
+func arpProbe(gatewayRoute) (net.HardwareAddr, time.Duration, error) {
+	return nil, 0, errGatewayUnsupported
+}
+
+func ndpProbe(gatewayRoute) (net.HardwareAddr, time.Duration, error) {
+	return nil, 0, errGatewayUnsupported
+}
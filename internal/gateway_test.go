@@ -0,0 +1,24 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"testing"
+)
+
+func TestGatewayCheckString(t *testing.T) {
+	for _, c := range []struct {
+		check internal.GatewayCheck
+		want  string
+	}{
+		{internal.GatewayCheck{IP: "192.168.1.1", Iface: "eth0", Method: "arp", Reachable: true, MAC: "aa:bb:cc:dd:ee:ff", RttMs: 0.34},
+			"默认网关 192.168.1.1（eth0）ARP 可达，MAC aa:bb:cc:dd:ee:ff，0.3ms"},
+		{internal.GatewayCheck{IP: "fe80::1", Iface: "eth0", Method: "ndp", Reachable: true, RttMs: 1.25},
+			"默认网关 fe80::1（eth0）NDP 可达，1.2ms"},
+		{internal.GatewayCheck{IP: "192.168.1.1", Iface: "wlan0", Method: "arp", Error: "没有应答"},
+			"默认网关 192.168.1.1（wlan0）ARP 不可达: 没有应答"},
+	} {
+		if got := c.check.String(); got != c.want {
+			t.Errorf("应为 %q，实际为 %q", c.want, got)
+		}
+	}
+}
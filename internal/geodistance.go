@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 按地理距离估算的 RTT：光在光纤中约 200km/ms，往返为两倍距离；实际线路比直线平均绕远约一半，另加接入和设备转发的固定开销。
+// 实测 RTT 超过预期的 2 倍且多出 20ms 以上时视为绕行（如 广东→广西 经北京）
+const (
+	fiberKmPerMs   = 200.0
+	routeInflation = 1.5
+	geoBaseRtt     = 2 * time.Millisecond
+	detourRatio    = 2
+	detourMin      = 20 * time.Millisecond
+)
+
+// geoPoint 经纬度（度）
+type geoPoint struct {
+	lat, lon float64
+}
+
+// provinceCapitals 各省级行政区省会（首府）的位置，地区名与内置目标配置一致
+var provinceCapitals = map[string]geoPoint{
+	"北京": {39.90, 116.41}, "天津": {39.13, 117.20}, "上海": {31.23, 121.47}, "重庆": {29.56, 106.55},
+	"河北": {38.04, 114.51}, "山西": {37.87, 112.55}, "内蒙古": {40.84, 111.75}, "辽宁": {41.80, 123.43},
+	"吉林": {43.82, 125.32}, "黑龙江": {45.80, 126.53}, "江苏": {32.06, 118.80}, "浙江": {30.27, 120.16},
+	"安徽": {31.82, 117.23}, "福建": {26.07, 119.30}, "江西": {28.68, 115.86}, "山东": {36.65, 117.12},
+	"河南": {34.75, 113.63}, "湖北": {30.59, 114.31}, "湖南": {28.23, 112.94}, "广东": {23.13, 113.26},
+	"广西": {22.82, 108.37}, "海南": {20.04, 110.34}, "四川": {30.57, 104.07}, "贵州": {26.65, 106.63},
+	"云南": {25.04, 102.71}, "西藏": {29.65, 91.14}, "陕西": {34.34, 108.94}, "甘肃": {36.06, 103.83},
+	"青海": {36.62, 101.78}, "宁夏": {38.49, 106.23}, "新疆": {43.83, 87.62}, "香港": {22.32, 114.17},
+	"澳门": {22.20, 113.54}, "台湾": {25.03, 121.57},
+}
+
+// provinceOf 地区对应的省级行政区，地区名可以带"省""市""自治区"等后缀（如 广西壮族自治区）；不是省级行政区时返回 false
+func provinceOf(region string) (string, bool) {
+	if _, ok := provinceCapitals[region]; ok {
+		return region, true
+	}
+	for name := range provinceCapitals {
+		if strings.HasPrefix(region, name) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// validateGeoFrom 校验 -geo-from 的源省份，为空时不估算
+func validateGeoFrom(from string) error {
+	if from == "" {
+		return nil
+	}
+	if _, ok := provinceOf(from); ok {
+		return nil
+	}
+	names := make([]string, 0, len(provinceCapitals))
+	for name := range provinceCapitals {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return fmt.Errorf("-geo-from 应为探测节点所在的省份，'%s' 无法识别，可选 %s", from, strings.Join(names, "|"))
+}
+
+// geoDistanceKm 两点间的大圆距离（公里）
+func geoDistanceKm(a, b geoPoint) float64 {
+	const earthRadiusKm = 6371.0
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat, dLon := rad(b.lat-a.lat), rad(b.lon-a.lon)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(rad(a.lat))*math.Cos(rad(b.lat))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// expectedRtt 从源省份 from 到地区 region 按地理距离估算的 RTT，同省时为固定开销；任一方不是省级行政区时返回 false
+func expectedRtt(from, region string) (time.Duration, bool) {
+	src, ok := provinceOf(from)
+	if !ok {
+		return 0, false
+	}
+	dst, ok := provinceOf(region)
+	if !ok {
+		return 0, false
+	}
+	km := geoDistanceKm(provinceCapitals[src], provinceCapitals[dst])
+	ms := 2 * km * routeInflation / fiberKmPerMs
+	return geoBaseRtt + time.Duration(ms*float64(time.Millisecond)), true
+}
+
+// annotateExpectedRtt 为省级地区的各行写入按地理距离的预期 RTT，有回包且明显超过预期时标记绕行；from 为空时不处理
+func annotateExpectedRtt(rows []*SnapshotRow, from string) {
+	if from == "" {
+		return
+	}
+	for _, row := range rows {
+		expected, ok := expectedRtt(from, row.Region)
+		if !ok {
+			continue
+		}
+		row.ExpectedRttMs = durationToMs(expected)
+		row.Detour = row.Recv > 0 && isDetour(time.Duration(row.AvgRttMs*float64(time.Millisecond)), expected)
+	}
+}
+
+// isDetour 实测平均 RTT 明显超过按距离的预期，线路可能绕行
+func isDetour(avg, expected time.Duration) bool {
+	return avg >= detourRatio*expected && avg-expected >= detourMin
+}
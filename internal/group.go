@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// ungrouped 分组模板的结果为空时（如目标没有引用的标签）使用的组名
+const ungrouped = "未分组"
+
+// parseGroupBy 解析 -group-by 分组模板，字段与 -template 的行模板相同，如 {{.Isp}}-{{.Region}}、{{.Tags.dc}}；
+// 为空时返回 nil，按运营商分组
+func parseGroupBy(s string) (*template.Template, error) {
+	return parseKeyTemplate("group-by", s)
+}
+
+// parseAggregate 解析 -aggregate 按服务汇总的模板，字段与 -group-by 相同；为空时返回 nil，不汇总
+func parseAggregate(s string) (*template.Template, error) {
+	return parseKeyTemplate("aggregate", s)
+}
+
+// parseKeyTemplate 解析按结果字段计算组名的模板，name 为参数名
+func parseKeyTemplate(name, s string) (*template.Template, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := template.New(name).Option("missingkey=zero").Funcs(templateFuncs).Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("分组模板 -%s 解析失败: %v", name, err)
+	}
+	// 用空的结果试执行一次，字段名写错时在探测前报错
+	if err := t.Execute(io.Discard, &SummaryStatistic{Tags: map[string]string{}}); err != nil {
+		return nil, fmt.Errorf("分组模板 -%s 执行失败: %v", name, err)
+	}
+	return t, nil
+}
+
+// groupOf 返回一条结果所属的分组
+func groupOf(t *template.Template, sum *SummaryStatistic) string {
+	var b strings.Builder
+	if err := t.Execute(&b, sum); err != nil {
+		return ungrouped
+	}
+	if group := strings.TrimSpace(b.String()); group != "" {
+		return group
+	}
+	return ungrouped
+}
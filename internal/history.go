@@ -0,0 +1,259 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 判断水平持续变化的阈值：前后两段的中位数相差达到阈值，且后一段每一轮都偏向新水平
+const (
+	changeMinRtt      = 10 * time.Millisecond // RTT 变化的最小绝对值
+	changeRttRatio    = 0.5                   // RTT 变化的最小比例（相对变化前的水平）
+	changeLossPercent = 10                    // 丢包率变化的最小百分点
+)
+
+// AppendHistory 将一轮结果以一行 JSON（与快照格式相同）追加到历史文件，持续探测时每轮调用一次
+func AppendHistory(path string, snap *Snapshot) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("打开历史文件 %s 失败: %v", path, err)
+	}
+	defer f.Close()
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("写入历史文件 %s 失败: %v", path, err)
+	}
+	return nil
+}
+
+// LoadHistory 读取历史文件的各轮结果，按时间先后排列；写入中途被中断的末行忽略
+func LoadHistory(path string) ([]*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取历史文件 %s 失败: %v", path, err)
+	}
+	defer f.Close()
+
+	var rounds []*Snapshot
+	r := bufio.NewReader(f)
+	for lineNo := 1; ; lineNo++ {
+		line, err := r.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("读取历史文件 %s 失败: %v", path, err)
+		}
+		if len(strings.TrimSpace(string(line))) > 0 {
+			snap := &Snapshot{}
+			if jsonErr := json.Unmarshal(line, snap); jsonErr != nil {
+				if errors.Is(err, io.EOF) {
+					log.Printf("⚠️  历史文件 %s 末行不完整，已忽略: %v\n", path, jsonErr)
+					break
+				}
+				return nil, fmt.Errorf("解析历史文件 %s 第 %d 行失败: %v", path, lineNo, jsonErr)
+			}
+			if snap.SchemaVersion > SchemaVersion {
+				return nil, fmt.Errorf("历史文件 %s 第 %d 行的格式版本 %d 高于当前程序支持的 %d，请升级 dping", path, lineNo, snap.SchemaVersion, SchemaVersion)
+			}
+			rounds = append(rounds, snap)
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+	sort.SliceStable(rounds, func(i, j int) bool { return rounds[i].CreatedAt.Before(rounds[j].CreatedAt) })
+	return rounds, nil
+}
+
+// ChangePoint 一个目标的丢包率或 RTT 水平持续变化的时刻，At 为处于新水平的第一轮
+type ChangePoint struct {
+	At     time.Time
+	DestIP string
+	Region string
+	Isp    string
+	Source string
+	Proto  string
+	Metric string  // rtt 或 loss
+	Before float64 // 变化前的水平，RTT 为毫秒，丢包率为百分比
+	After  float64
+}
+
+// historyPoint 一个目标在一轮中的结果，该轮全部丢包（不在结果中）时 hasRtt 为 false、loss 为 100
+type historyPoint struct {
+	at     time.Time
+	loss   float64
+	rtt    float64
+	hasRtt bool
+}
+
+// DetectChangePoints 逐个目标比较每一轮前后各 window 轮的中位数，找出丢包率或 RTT 持续变化的时刻，按时间排列；
+// 单轮的尖峰不会改变中位数，不计为变化。目标首次出现之后某轮没有结果（全部丢包）时按 100% 丢包计
+func DetectChangePoints(rounds []*Snapshot, window int) []*ChangePoint {
+	window = max(window, 1)
+	series := make(map[string][]historyPoint)
+	rows := make(map[string]*SnapshotRow)
+	var keys []string
+	for _, snap := range rounds {
+		seen := make(map[string]bool)
+		for _, row := range snap.Rows {
+			key := strings.Join([]string{row.DestIP, row.Isp, row.Region, row.Source, row.Proto}, "|")
+			if rows[key] == nil {
+				keys = append(keys, key)
+			}
+			rows[key], seen[key] = row, true
+			series[key] = append(series[key], historyPoint{at: snap.CreatedAt, loss: row.LossPercent, rtt: row.AvgRttMs, hasRtt: row.Recv > 0})
+		}
+		for _, key := range keys {
+			if !seen[key] {
+				series[key] = append(series[key], historyPoint{at: snap.CreatedAt, loss: 100})
+			}
+		}
+	}
+
+	var changes []*ChangePoint
+	for _, key := range keys {
+		points := series[key]
+		var rtt []historyPoint
+		for _, p := range points {
+			if p.hasRtt {
+				rtt = append(rtt, p)
+			}
+		}
+		for _, c := range shiftPoints(rtt, window, func(p historyPoint) float64 { return p.rtt }, func(before float64) float64 {
+			return max(durationToMs(changeMinRtt), before*changeRttRatio)
+		}) {
+			changes = append(changes, newChangePoint(rows[key], "rtt", c))
+		}
+		for _, c := range shiftPoints(points, window, func(p historyPoint) float64 { return p.loss }, func(float64) float64 {
+			return changeLossPercent
+		}) {
+			changes = append(changes, newChangePoint(rows[key], "loss", c))
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].At.Before(changes[j].At) })
+	return changes
+}
+
+// levelShift 序列中的一次水平变化
+type levelShift struct {
+	at            time.Time
+	before, after float64
+}
+
+// shiftPoints 找出序列中前后各 window 个点的中位数相差达到 threshold(变化前水平) 的位置，
+// 且变化后的 window 个点都越过前后水平的中点；相邻的多个位置只取变化最大的一个
+func shiftPoints(points []historyPoint, window int, value func(historyPoint) float64, threshold func(before float64) float64) []levelShift {
+	var shifts []levelShift
+	var best *levelShift
+	bestDelta := 0.0
+	for i := window; i+window <= len(points); i++ {
+		before, after := make([]float64, window), make([]float64, window)
+		for j := range window {
+			before[j], after[j] = value(points[i-window+j]), value(points[i+j])
+		}
+		b, a := median(before), median(after)
+		delta := math.Abs(a - b)
+		persistent := delta >= threshold(b)
+		mid := (a + b) / 2
+		for _, v := range after {
+			persistent = persistent && (v-mid)*(a-b) > 0
+		}
+		if !persistent {
+			if best != nil {
+				shifts = append(shifts, *best)
+				best = nil
+			}
+			continue
+		}
+		if best == nil || delta > bestDelta {
+			best, bestDelta = &levelShift{at: points[i].at, before: b, after: a}, delta
+		}
+	}
+	if best != nil {
+		shifts = append(shifts, *best)
+	}
+	return shifts
+}
+
+// median 返回中位数，会对 values 排序
+func median(values []float64) float64 {
+	slices.Sort(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
+
+func newChangePoint(row *SnapshotRow, metric string, s levelShift) *ChangePoint {
+	return &ChangePoint{
+		At:     s.at,
+		DestIP: row.DestIP,
+		Region: row.Region,
+		Isp:    row.Isp,
+		Source: row.Source,
+		Proto:  row.Proto,
+		Metric: metric,
+		Before: s.before,
+		After:  s.after,
+	}
+}
+
+// String 时间线中的一行，如 "02:13 广东电信 203.0.113.1 RTT 35ms→180ms"，时间格式由调用方决定
+func (c *ChangePoint) String() string {
+	target := fmt.Sprintf("%s%s %s", c.Region, c.Isp, c.DestIP)
+	if c.Proto != "" {
+		target += " " + c.Proto
+	}
+	if c.Source != "" {
+		target += "（源 " + c.Source + "）"
+	}
+	if c.Metric == "loss" {
+		return fmt.Sprintf("%s 丢包率 %.1f%%→%.1f%%", target, c.Before, c.After)
+	}
+	return fmt.Sprintf("%s RTT %.0fms→%.0fms", target, c.Before, c.After)
+}
+
+// History 读取持续探测的历史文件，输出概况和各目标丢包率、RTT 持续变化的时间线
+func History(path string, window int) error {
+	rounds, err := LoadHistory(path)
+	if err != nil {
+		return err
+	}
+	if len(rounds) == 0 {
+		return fmt.Errorf("历史文件 %s 中没有结果", path)
+	}
+	first, last := rounds[0].CreatedAt, rounds[len(rounds)-1].CreatedAt
+	fmt.Printf("====== 历史结果 %s ~ %s，共 %d 轮 ======\n", first.Format(time.DateTime), last.Format(time.DateTime), len(rounds))
+	if len(rounds) < 2*window {
+		fmt.Printf("轮数少于 %d，无法判断持续变化\n", 2*window)
+		return nil
+	}
+
+	changes := DetectChangePoints(rounds, window)
+	fmt.Println("====== 变化时间线 ======")
+	if len(changes) == 0 {
+		fmt.Println("没有持续的丢包率或 RTT 变化")
+		return nil
+	}
+	// 跨天时带上日期
+	layout := "15:04"
+	if first.Format(time.DateOnly) != last.Format(time.DateOnly) {
+		layout = "01-02 15:04"
+	}
+	for _, c := range changes {
+		fmt.Printf("%s %s\n", c.At.Format(layout), c)
+	}
+	return nil
+}
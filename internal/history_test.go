@@ -0,0 +1,184 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectChangePoints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	start := time.Date(2024, 5, 1, 2, 0, 0, 0, time.Local)
+	for i := range 14 {
+		// 1.1.1.1 第 3 轮有一次尖峰，第 7 轮起 RTT 持续升高；2.2.2.2 第 6~9 轮全部丢包（不在结果中）
+		rtt := 35.0
+		if i == 2 {
+			rtt = 200
+		}
+		if i >= 6 {
+			rtt = 180
+		}
+		snap := &internal.Snapshot{SchemaVersion: internal.SchemaVersion, CreatedAt: start.Add(time.Duration(i) * time.Minute), Rows: []*internal.SnapshotRow{
+			{DestIP: "1.1.1.1", Region: "广东", Isp: "电信", Sent: 10, Recv: 10, AvgRttMs: rtt},
+		}}
+		if i < 6 || i > 9 {
+			snap.Rows = append(snap.Rows, &internal.SnapshotRow{DestIP: "2.2.2.2", Region: "北京", Isp: "联通", Sent: 10, Recv: 10, AvgRttMs: 20})
+		}
+		if err := internal.AppendHistory(path, snap); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 写入中途被中断的末行忽略
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"schema_version": 1, "rows": [`)
+	f.Close()
+
+	rounds, err := internal.LoadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rounds) != 14 {
+		t.Fatalf("读取到 %d 轮，应为 14 轮", len(rounds))
+	}
+	var got []string
+	for _, c := range internal.DetectChangePoints(rounds, 3) {
+		got = append(got, c.At.Format("15:04")+" "+c.String())
+	}
+	want := []string{
+		"02:06 广东电信 1.1.1.1 RTT 35ms→180ms",
+		"02:06 北京联通 2.2.2.2 丢包率 0.0%→100.0%",
+		"02:10 北京联通 2.2.2.2 丢包率 100.0%→0.0%",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("变化时间线为:\n%s\n应为:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCompactHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	now := time.Date(2024, 5, 20, 12, 0, 0, 0, time.UTC)
+	round := func(at time.Time, rows ...*internal.SnapshotRow) {
+		snap := &internal.Snapshot{SchemaVersion: internal.SchemaVersion, CreatedAt: at, Count: 10, Rows: rows}
+		if err := internal.AppendHistory(path, snap); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 100 天前的一轮超过汇总保留时长，删除
+	round(now.Add(-100*24*time.Hour), &internal.SnapshotRow{DestIP: "1.1.1.1", Sent: 10, Recv: 10, AvgRttMs: 30})
+	// 8 天前同一小时内的三轮合并；2.2.2.2 第二轮没有记录，3.3.3.3 第二轮全部丢包且实际发了 20 个包，4.4.4.4 整个小时都全部丢包，5.5.5.5 每轮都探测出错
+	lost := func(at time.Time, rows ...*internal.SnapshotRow) {
+		snap := &internal.Snapshot{SchemaVersion: internal.SchemaVersion, CreatedAt: at, Count: 10, Unanswered: rows[1:], Rows: rows[:1]}
+		if err := internal.AppendHistory(path, snap); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hour := time.Date(2024, 5, 12, 10, 0, 0, 0, time.UTC)
+	lost(hour.Add(5*time.Minute),
+		&internal.SnapshotRow{DestIP: "1.1.1.1", Sent: 10, Recv: 10, MinRttMs: 20, MaxRttMs: 40, AvgRttMs: 30},
+		&internal.SnapshotRow{DestIP: "4.4.4.4", Sent: 10, LossPercent: 100})
+	round(hour.Add(6*time.Minute),
+		&internal.SnapshotRow{DestIP: "2.2.2.2", Sent: 10, Recv: 10, MinRttMs: 5, MaxRttMs: 5, AvgRttMs: 5},
+		&internal.SnapshotRow{DestIP: "3.3.3.3", Sent: 10, Recv: 10, MinRttMs: 8, MaxRttMs: 8, AvgRttMs: 8},
+		&internal.SnapshotRow{DestIP: "5.5.5.5", LossPercent: 100, Error: "connect: network is unreachable"})
+	lost(hour.Add(25*time.Minute),
+		&internal.SnapshotRow{DestIP: "1.1.1.1", Sent: 10, Recv: 5, LossPercent: 50, MinRttMs: 50, MaxRttMs: 70, AvgRttMs: 60},
+		&internal.SnapshotRow{DestIP: "3.3.3.3", Sent: 20, LossPercent: 100},
+		&internal.SnapshotRow{DestIP: "4.4.4.4", Sent: 10, LossPercent: 100})
+	round(hour.Add(45*time.Minute),
+		&internal.SnapshotRow{DestIP: "1.1.1.1", Sent: 10, Recv: 5, LossPercent: 50, MinRttMs: 50, MaxRttMs: 70, AvgRttMs: 60},
+		&internal.SnapshotRow{DestIP: "2.2.2.2", Sent: 10, Recv: 10, MinRttMs: 5, MaxRttMs: 5, AvgRttMs: 5},
+		&internal.SnapshotRow{DestIP: "5.5.5.5", LossPercent: 100, Error: "dial udp: no route to host"})
+	// 最近 7 天内的逐轮保留
+	round(now.Add(-time.Hour), &internal.SnapshotRow{DestIP: "1.1.1.1", Sent: 10, Recv: 10, AvgRttMs: 30})
+	round(now.Add(-time.Minute), &internal.SnapshotRow{DestIP: "1.1.1.1", Sent: 10, Recv: 10, AvgRttMs: 30})
+
+	retention := internal.HistoryRetention{Raw: 7 * 24 * time.Hour, Rollup: 90 * 24 * time.Hour}
+	before, after, err := internal.CompactHistory(path, retention, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before != 7 || after != 3 {
+		t.Fatalf("整理前后为 %d、%d 轮，应为 7、3 轮", before, after)
+	}
+	rounds, err := internal.LoadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rollup := rounds[0]
+	if !rollup.CreatedAt.Equal(hour) || rollup.Rounds != 4 || len(rollup.Rows) != 4 || len(rollup.Unanswered) != 1 {
+		t.Fatalf("小时汇总应为 %s 的 4 轮合并，4 个目标有结果或出错、1 个全部丢包: %+v", hour, rollup)
+	}
+	a, b, c := rollup.Rows[0], rollup.Rows[1], rollup.Rows[2]
+	if a.DestIP != "1.1.1.1" || a.Sent != 40 || a.Recv != 20 || a.MinRttMs != 20 || a.MaxRttMs != 70 || a.AvgRttMs != 45 {
+		t.Errorf("1.1.1.1 的合并结果有误: %+v", a)
+	}
+	// 缺少记录的两轮按 Count 个包全部丢失计入
+	if b.DestIP != "2.2.2.2" || b.Sent != 40 || b.Recv != 20 || b.LossPercent != 50 {
+		t.Errorf("2.2.2.2 的合并结果有误: %+v", b)
+	}
+	// 全部丢包的一轮按实际发包数计入，缺少记录的两轮按 Count 计入
+	if c.DestIP != "3.3.3.3" || c.Sent != 50 || c.Recv != 10 || c.LossPercent != 80 || c.AvgRttMs != 8 {
+		t.Errorf("3.3.3.3 的合并结果有误: %+v", c)
+	}
+	// 出错的目标留在 rows 中，保留最近一次的出错原因
+	if e := rollup.Rows[3]; e.DestIP != "5.5.5.5" || e.Recv != 0 || e.Error != "dial udp: no route to host" {
+		t.Errorf("5.5.5.5 的合并结果有误: %+v", e)
+	}
+	// 整个小时都全部丢包的目标保留在 unanswered 中
+	if d := rollup.Unanswered[0]; d.DestIP != "4.4.4.4" || d.Sent != 40 || d.Recv != 0 || d.LossPercent != 100 {
+		t.Errorf("4.4.4.4 的合并结果有误: %+v", d)
+	}
+
+	// 再次整理不变
+	if before, after, err := internal.CompactHistory(path, retention, now); err != nil || before != 3 || after != 3 {
+		t.Errorf("再次整理应不变，实际为 %d→%d，%v", before, after, err)
+	}
+	if _, _, err := internal.CompactHistory(path, internal.HistoryRetention{Raw: 7 * 24 * time.Hour, Rollup: time.Hour}, now); err == nil {
+		t.Error("汇总保留时长短于逐轮保留时长时应报错")
+	}
+}
+
+func TestLoadResults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.jsonl")
+	start := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	// -ws 事件流：第一轮完整结束，第二轮只收到一条结果；其后是 -out 写入的缩进快照和不完整的末行
+	lines := []string{
+		`{"type":"round_start","run_id":"a","round":1,"time":"2024-05-01T02:00:00Z","total":2}`,
+		`{"type":"result","run_id":"a","round":1,"time":"2024-05-01T02:00:01Z","result":{"dest_ip":"1.1.1.1","region":"广东","isp":"电信","sent":10,"recv":10}}`,
+		`{"type":"round_end","run_id":"a","round":1,"time":"2024-05-01T02:00:02Z","snapshot":{"schema_version":1,"created_at":"2024-05-01T02:00:00Z","run_id":"a","rows":[{"dest_ip":"1.1.1.1","region":"广东","isp":"电信","sent":10,"recv":10},{"dest_ip":"2.2.2.2","region":"北京","isp":"联通","sent":10,"recv":5}]}}`,
+		`{"type":"result","run_id":"b","round":2,"time":"2024-05-01T02:01:01Z","result":{"dest_ip":"1.1.1.1","region":"广东","isp":"电信","sent":10,"recv":9}}`,
+		"{\n  \"schema_version\": 1,\n  \"created_at\": \"2024-05-01T01:59:00Z\",\n  \"rows\": []\n}",
+		`{"type":"progress","run_id":"b","round":2,"time":"2024-05-01T02:01:02Z","done":1,"total":2}`,
+		`{"schema_version": 1, "rows": [`,
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rounds, err := internal.LoadResults(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rounds) != 3 {
+		t.Fatalf("应读取 3 轮，实际为 %d", len(rounds))
+	}
+	if !rounds[0].CreatedAt.Equal(start.Add(-time.Minute)) || len(rounds[0].Rows) != 0 {
+		t.Errorf("快照应按时间排在最前: %+v", rounds[0])
+	}
+	if rounds[1].RunID != "a" || len(rounds[1].Rows) != 2 {
+		t.Errorf("结束的轮次应使用 round_end 中的快照: %+v", rounds[1])
+	}
+	if r := rounds[2]; r.RunID != "b" || !r.CreatedAt.Equal(start.Add(61*time.Second)) || len(r.Rows) != 1 || r.Rows[0].Recv != 9 {
+		t.Errorf("未结束的轮次应使用已收到的结果: %+v", r)
+	}
+
+	os.WriteFile(path, []byte(`{"schema_version": 99, "rows": []}`), 0o644)
+	if _, err := internal.LoadResults(path); err == nil || !strings.Contains(err.Error(), "请升级") {
+		t.Errorf("格式版本过高时应报错，实际为 %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+)
+
+// 目标历史接口的时间窗口：默认最近 1 小时，最长与历史文件中小时汇总的常见保留时长相当
+const (
+	defaultHistoryWindow = time.Hour
+	maxHistoryWindow     = 90 * 24 * time.Hour
+)
+
+// TargetHistory GET /api/v1/targets/{ip}/history 的响应：一个目标在时间窗口内每轮的结果，
+// 同一 IP 的每个地区、运营商、源IP、探测方式各为一条序列
+type TargetHistory struct {
+	DestIP string          `json:"dest_ip"`
+	From   time.Time       `json:"from"`
+	To     time.Time       `json:"to"`
+	Series []*TargetSeries `json:"series"`
+}
+
+// TargetSeries 一个目标在一组标签下的时间序列
+type TargetSeries struct {
+	Region string         `json:"region"`
+	Isp    string         `json:"isp"`
+	Source string         `json:"source,omitempty"`
+	Proto  string         `json:"proto,omitempty"`
+	Points []*TargetPoint `json:"points"`
+}
+
+// TargetPoint 一轮（或按小时合并的一行）中该目标的结果；序列首次出现后某轮没有结果（全部丢包）时只有 time 和 100% 丢包
+type TargetPoint struct {
+	Time        time.Time `json:"time"`
+	Sent        int       `json:"sent"`
+	Recv        int       `json:"recv"`
+	LossPercent float64   `json:"loss_percent"`
+	AvgRttMs    float64   `json:"avg_rtt_ms,omitempty"`
+	MaxRttMs    float64   `json:"max_rtt_ms,omitempty"`
+	Rounds      int       `json:"rounds,omitempty"` // 按小时合并的行由多少轮合并而来，逐轮结果为 0
+}
+
+// targetHistory 从按时间排列的各轮结果中取出目标 ip 在 [from, to] 内的各条序列，没有结果时 Series 为空
+func targetHistory(rounds []*Snapshot, ip string, from, to time.Time) *TargetHistory {
+	history := &TargetHistory{DestIP: ip, From: from, To: to, Series: []*TargetSeries{}}
+	bySeries := make(map[string]*TargetSeries)
+	for _, snap := range rounds {
+		if snap.CreatedAt.Before(from) || snap.CreatedAt.After(to) {
+			continue
+		}
+		seen := make(map[*TargetSeries]bool)
+		for _, row := range snap.Rows {
+			if row.DestIP != ip {
+				continue
+			}
+			key := row.Isp + "|" + row.Region + "|" + row.Source + "|" + row.Proto
+			series := bySeries[key]
+			if series == nil {
+				series = &TargetSeries{Region: row.Region, Isp: row.Isp, Source: row.Source, Proto: row.Proto}
+				bySeries[key] = series
+				history.Series = append(history.Series, series)
+			}
+			seen[series] = true
+			series.Points = append(series.Points, &TargetPoint{
+				Time: snap.CreatedAt, Sent: row.Sent, Recv: row.Recv, LossPercent: row.LossPercent,
+				AvgRttMs: row.AvgRttMs, MaxRttMs: row.MaxRttMs, Rounds: snap.Rounds,
+			})
+		}
+		for _, series := range history.Series {
+			if !seen[series] {
+				series.Points = append(series.Points, &TargetPoint{Time: snap.CreatedAt, LossPercent: 100, Rounds: snap.Rounds})
+			}
+		}
+	}
+	return history
+}
+
+// historyHandler 提供 GET /api/v1/targets/{ip}/history?window=1h，每次请求重新读取历史文件，返回最近 window 内的结果
+func historyHandler(path string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := net.ParseIP(r.PathValue("ip"))
+		if ip == nil {
+			http.Error(w, "目标IP无效: "+r.PathValue("ip"), http.StatusBadRequest)
+			return
+		}
+		window := defaultHistoryWindow
+		if v := r.URL.Query().Get("window"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 || d > maxHistoryWindow {
+				http.Error(w, "window 应为不超过 2160h 的正时长，如 1h、24h: "+v, http.StatusBadRequest)
+				return
+			}
+			window = d
+		}
+		rounds, err := LoadHistory(path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		to := time.Now()
+		history := targetHistory(rounds, ip.String(), to.Add(-window), to)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if len(history.Series) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		json.NewEncoder(w).Encode(history)
+	})
+}
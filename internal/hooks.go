@@ -0,0 +1,214 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+// defaultHookTimeout 钩子命令的默认超时
+const defaultHookTimeout = 30 * time.Second
+
+// HookOptions 探测前后执行的外部命令，每项为 Go 模板，渲染结果交给 sh -c 执行；渲染结果为空时不执行，
+// 因此可以用 {{if .Failed}}...{{end}} 只对失败的目标执行。字段同时以 DPING_ 开头的环境变量传给命令，
+// 值中可能含有特殊字符时优先使用环境变量或 quote 函数
+type HookOptions struct {
+	BeforeRun   string        // 每轮（单次运行时为该次）探测开始前执行，如切换路由策略，字段见 HookRun
+	AfterRun    string        // 每轮探测全部结束后执行，字段见 HookRun
+	BeforeProbe string        // 每个目标（每个源IP、每个探测方式）探测前执行，字段见 HookProbe
+	AfterProbe  string        // 每个目标探测后执行，如保存失败目标的抓包，字段见 HookProbe
+	Timeout     time.Duration // 单个命令的超时，0 时为 30s，超时后结束命令并继续探测
+}
+
+// HookRun 轮次钩子的模板字段，探测结果相关字段只在 AfterRun 中有值
+type HookRun struct {
+	RunID       string
+	Targets     int     // 本轮的目标数
+	Sent        int     // 本轮的发包数，与表格的总计相同，不含全部丢包和出错的目标
+	Recv        int     // 本轮的收包数
+	LossPercent float64 // 本轮的总丢包率
+	Failed      bool    // 本轮有目标丢包（包括全部丢包）或探测出错
+}
+
+// HookProbe 目标钩子的模板字段，探测结果相关字段只在 AfterProbe 中有值
+type HookProbe struct {
+	RunID       string
+	DestIP      string
+	Source      string // 源IP，未指定网卡时为 系统默认
+	Proto       string // 同时使用多个探测方式时的协议标签，单一探测方式时为空
+	Region      string // 目标第一个标签的地区和运营商，同一目标有多个标签时见 DPING_LABELS
+	Isp         string
+	Sent        int
+	Recv        int
+	LossPercent float64
+	AvgRttMs    float64
+	Error       string
+	Failed      bool // 有丢包或探测出错
+}
+
+// probeHooks 解析后的钩子模板，为 nil 时不执行任何钩子
+type probeHooks struct {
+	beforeRunTmpl, afterRunTmpl, beforeProbeTmpl, afterProbeTmpl *template.Template
+	timeout                                                      time.Duration
+}
+
+// hookFuncs 钩子模板可用的函数：quote 把值转为 shell 单引号字符串
+var hookFuncs = template.FuncMap{
+	"quote": func(v any) string { return "'" + strings.ReplaceAll(fmt.Sprint(v), "'", `'\''`) + "'" },
+}
+
+// newProbeHooks 解析钩子模板，都未指定时返回 nil
+func newProbeHooks(o HookOptions) (*probeHooks, error) {
+	if o.BeforeRun == "" && o.AfterRun == "" && o.BeforeProbe == "" && o.AfterProbe == "" {
+		return nil, nil
+	}
+	if o.Timeout < 0 {
+		return nil, fmt.Errorf("钩子超时 -hook-timeout 不能为负数")
+	}
+	h := &probeHooks{timeout: o.Timeout}
+	if h.timeout == 0 {
+		h.timeout = defaultHookTimeout
+	}
+	for _, hook := range []struct {
+		flag string
+		text string
+		tmpl **template.Template
+	}{
+		{"-hook-before-run", o.BeforeRun, &h.beforeRunTmpl},
+		{"-hook-after-run", o.AfterRun, &h.afterRunTmpl},
+		{"-hook-before-probe", o.BeforeProbe, &h.beforeProbeTmpl},
+		{"-hook-after-probe", o.AfterProbe, &h.afterProbeTmpl},
+	} {
+		if hook.text == "" {
+			continue
+		}
+		tmpl, err := template.New(hook.flag).Funcs(hookFuncs).Parse(hook.text)
+		if err != nil {
+			return nil, fmt.Errorf("钩子 %s 模板无效: %v", hook.flag, err)
+		}
+		*hook.tmpl = tmpl
+	}
+	return h, nil
+}
+
+// beforeRun 本轮探测开始前执行 -hook-before-run，h 为 nil 时什么都不做
+func (h *probeHooks) beforeRun(runID string, targets int) {
+	if h != nil {
+		h.run(h.beforeRunTmpl, runID, targets, nil, nil)
+	}
+}
+
+// afterRun 本轮探测全部结束后执行 -hook-after-run
+func (h *probeHooks) afterRun(runID string, targets int, totals *Totals, telemetry *Telemetry) {
+	if h != nil {
+		h.run(h.afterRunTmpl, runID, targets, totals, telemetry)
+	}
+}
+
+// beforeProbe 目标探测前执行 -hook-before-probe
+func (h *probeHooks) beforeProbe(runID string, target *Target, sourceIP, proto string) {
+	if h != nil {
+		h.probe(h.beforeProbeTmpl, runID, target, sourceIP, proto, nil, nil)
+	}
+}
+
+// afterProbe 目标探测后执行 -hook-after-probe
+func (h *probeHooks) afterProbe(runID string, target *Target, sourceIP, proto string, stats *ping.Statistics, err error) {
+	if h != nil {
+		h.probe(h.afterProbeTmpl, runID, target, sourceIP, proto, stats, err)
+	}
+}
+
+// run 执行轮次钩子，totals 为 nil 时（探测开始前）结果字段为零值；全部丢包和出错的目标不计入 totals，由 telemetry 判断
+func (h *probeHooks) run(tmpl *template.Template, runID string, targets int, totals *Totals, telemetry *Telemetry) {
+	if tmpl == nil {
+		return
+	}
+	data := &HookRun{RunID: runID, Targets: targets}
+	if totals != nil {
+		data.Sent, data.Recv, data.LossPercent = totals.Sent, totals.Recv, totals.LossPercent
+		data.Failed = totals.Recv < totals.Sent
+	}
+	if telemetry != nil {
+		data.Failed = data.Failed || telemetry.Unanswered > 0 || telemetry.Failed > 0
+	}
+	h.exec(tmpl, data, []string{
+		"DPING_RUN_ID=" + data.RunID,
+		"DPING_TARGETS=" + strconv.Itoa(data.Targets),
+		"DPING_SENT=" + strconv.Itoa(data.Sent),
+		"DPING_RECV=" + strconv.Itoa(data.Recv),
+		"DPING_LOSS_PERCENT=" + strconv.FormatFloat(data.LossPercent, 'f', 1, 64),
+		"DPING_FAILED=" + strconv.FormatBool(data.Failed),
+	})
+}
+
+// probe 执行目标钩子，stats 和 err 都为 nil 时（探测开始前）结果字段为零值
+func (h *probeHooks) probe(tmpl *template.Template, runID string, target *Target, sourceIP string, proto string, stats *ping.Statistics, probeErr error) {
+	if tmpl == nil {
+		return
+	}
+	data := &HookProbe{RunID: runID, DestIP: target.IP, Source: sourceIP, Proto: proto}
+	labels := make([]string, 0, len(target.Labels))
+	for _, label := range target.Labels {
+		labels = append(labels, label.Region+label.Isp)
+	}
+	if len(target.Labels) > 0 {
+		data.Region, data.Isp = target.Labels[0].Region, target.Labels[0].Isp
+	}
+	if stats != nil {
+		data.Sent, data.Recv, data.LossPercent = stats.PacketsSent, stats.PacketsRecv, stats.PacketLoss
+		data.AvgRttMs = durationToMs(stats.AvgRtt)
+		data.Failed = stats.PacketLoss > 0
+	}
+	if probeErr != nil {
+		data.Error, data.Failed = probeErr.Error(), true
+	}
+	h.exec(tmpl, data, []string{
+		"DPING_RUN_ID=" + data.RunID,
+		"DPING_DEST_IP=" + data.DestIP,
+		"DPING_SOURCE=" + data.Source,
+		"DPING_PROTO=" + data.Proto,
+		"DPING_REGION=" + data.Region,
+		"DPING_ISP=" + data.Isp,
+		"DPING_LABELS=" + strings.Join(labels, ","),
+		"DPING_SENT=" + strconv.Itoa(data.Sent),
+		"DPING_RECV=" + strconv.Itoa(data.Recv),
+		"DPING_LOSS_PERCENT=" + strconv.FormatFloat(data.LossPercent, 'f', 1, 64),
+		"DPING_AVG_RTT_MS=" + strconv.FormatFloat(data.AvgRttMs, 'f', 3, 64),
+		"DPING_ERROR=" + data.Error,
+		"DPING_FAILED=" + strconv.FormatBool(data.Failed),
+	})
+}
+
+// exec 渲染模板并以 sh -c 执行，命令的输出写到标准错误；渲染失败、命令失败或超时只记录日志，不影响探测
+func (h *probeHooks) exec(tmpl *template.Template, data any, env []string) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		log.Printf("⚠️  钩子 %s 渲染失败: %v\n", tmpl.Name(), err)
+		return
+	}
+	command := strings.TrimSpace(buf.String())
+	if command == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("超过 %s 未结束", h.timeout)
+		}
+		log.Printf("⚠️  钩子 %s 执行失败: %s: %v\n", tmpl.Name(), command, err)
+	}
+}
@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// HTTPAuth dping 对外提供的 HTTP 接口（-pprof 和 -ws）的认证参数，暴露在共用管理网络上时使用：
+// 设置了 BasicAuth 或 Token 时请求须携带其一；设置了证书时改为 HTTPS，再指定 ClientCA 时要求客户端证书（mTLS）
+type HTTPAuth struct {
+	BasicAuth string // 用户名:密码
+	Token     string // Authorization: Bearer 令牌
+	TLSCert   string // 服务端证书文件（PEM）
+	TLSKey    string // 服务端私钥文件（PEM）
+	ClientCA  string // 校验客户端证书的 CA 文件（PEM），非空时只接受其签发的客户端证书
+}
+
+// validate 校验认证参数并读取证书，返回 HTTPS 使用的 TLS 配置，未设置证书时为 nil
+func (a HTTPAuth) validate() (*tls.Config, error) {
+	if a.BasicAuth != "" {
+		if user, _, ok := strings.Cut(a.BasicAuth, ":"); !ok || user == "" {
+			return nil, fmt.Errorf("-http-basic-auth 应为 用户名:密码")
+		}
+	}
+	if (a.TLSCert == "") != (a.TLSKey == "") {
+		return nil, fmt.Errorf("-http-tls-cert 和 -http-tls-key 需要同时指定")
+	}
+	if a.TLSCert == "" {
+		if a.ClientCA != "" {
+			return nil, fmt.Errorf("-http-client-ca 需要同时指定 -http-tls-cert 和 -http-tls-key")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(a.TLSCert, a.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("读取 HTTPS 证书失败: %v", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if a.ClientCA != "" {
+		data, err := os.ReadFile(a.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("读取客户端 CA 文件失败: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("客户端 CA 文件 %s 中没有有效的证书", a.ClientCA)
+		}
+		config.ClientCAs, config.ClientAuth = pool, tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// listen 按认证参数在 addr 上监听，返回监听器和访问地址的协议（http 或 https）；
+// 没有任何认证且监听的不是本机回环地址时给出提示
+func (a HTTPAuth) listen(name, addr string) (net.Listener, string, error) {
+	ln, scheme, err := a.listenTLS(name, addr)
+	if err != nil {
+		return nil, "", err
+	}
+	if a.BasicAuth == "" && a.Token == "" && a.ClientCA == "" && !loopbackListener(ln) {
+		log.Printf("⚠️  %s 监听在 %s 且未设置认证，同一网络中的任何人都可以访问；可用 -http-token、-http-basic-auth 或 -http-client-ca 限制\n", name, ln.Addr())
+	}
+	return ln, scheme, nil
+}
+
+// listenTLS 在 addr 上监听，设置了证书时为 HTTPS，不检查是否设置了认证；认证由调用方自行处理时使用（如多租户各自的令牌）
+func (a HTTPAuth) listenTLS(name, addr string) (net.Listener, string, error) {
+	config, err := a.validate()
+	if err != nil {
+		return nil, "", err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s 监听 %s 失败: %v", name, addr, err)
+	}
+	if config == nil {
+		return ln, "http", nil
+	}
+	return tls.NewListener(ln, config), "https", nil
+}
+
+// loopbackListener 是否只监听在本机回环地址上
+func loopbackListener(ln net.Listener) bool {
+	tcp, ok := ln.Addr().(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
+
+// wrap 为 handler 加上 Basic 或 Bearer 认证，两者都未设置时原样返回；比较使用常数时间，避免按耗时猜出口令
+func (a HTTPAuth) wrap(handler http.Handler) http.Handler {
+	if a.BasicAuth == "" && a.Token == "" {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.authorized(r) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		if a.BasicAuth != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="dping"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="dping"`)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// authorized 请求是否携带了有效的 Basic 用户名密码或 Bearer 令牌
+func (a HTTPAuth) authorized(r *http.Request) bool {
+	if a.Token != "" {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok &&
+			subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) == 1 {
+			return true
+		}
+	}
+	if a.BasicAuth != "" {
+		if user, pass, ok := r.BasicAuth(); ok &&
+			subtle.ConstantTimeCompare([]byte(user+":"+pass), []byte(a.BasicAuth)) == 1 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,234 @@
+package internal
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultImportSource public-dns.info 按国家导出的解析器列表，%s 为小写的国家代码
+const DefaultImportSource = "https://public-dns.info/nameserver/%s.csv"
+
+// ImportOptions dping import 的参数
+type ImportOptions struct {
+	Source         string  // 列表地址或本地文件，可含 %s 代替国家代码，便于使用镜像
+	Country        string  // 国家代码，如 cn
+	CityDB         string  // MaxMind City 格式的离线库，非空时用它判断省份，比列表中的城市名更准确
+	MinReliability float64 // 可靠性（0~1）低于该值的解析器不导入
+	Max            int     // 每个运营商、地区最多导入的解析器数，按可靠性从高到低选取，0 为不限
+	OutPath        string  // 配置写入的文件，为空时输出到标准输出
+}
+
+// importCities 列表中常见的非省名城市（拼音）对应的省份，省名和直辖市由 whoisProvinces 匹配
+var importCities = map[string]string{
+	"SHIJIAZHUANG": "河北", "TANGSHAN": "河北", "BAODING": "河北", "TAIYUAN": "山西", "HOHHOT": "内蒙古", "BAOTOU": "内蒙古",
+	"SHENYANG": "辽宁", "DALIAN": "辽宁", "CHANGCHUN": "吉林", "HARBIN": "黑龙江", "NANJING": "江苏", "SUZHOU": "江苏",
+	"WUXI": "江苏", "CHANGZHOU": "江苏", "NANTONG": "江苏", "XUZHOU": "江苏", "HANGZHOU": "浙江", "NINGBO": "浙江",
+	"WENZHOU": "浙江", "JINHUA": "浙江", "SHAOXING": "浙江", "JIAXING": "浙江", "TAIZHOU": "浙江", "HEFEI": "安徽",
+	"WUHU": "安徽", "FUZHOU": "福建", "XIAMEN": "福建", "QUANZHOU": "福建", "NANCHANG": "江西", "JINAN": "山东",
+	"QINGDAO": "山东", "YANTAI": "山东", "WEIFANG": "山东", "ZIBO": "山东", "LINYI": "山东", "ZHENGZHOU": "河南",
+	"LUOYANG": "河南", "WUHAN": "湖北", "YICHANG": "湖北", "CHANGSHA": "湖南", "GUANGZHOU": "广东", "SHENZHEN": "广东",
+	"DONGGUAN": "广东", "FOSHAN": "广东", "ZHUHAI": "广东", "SHANTOU": "广东", "HUIZHOU": "广东", "ZHONGSHAN": "广东",
+	"NANNING": "广西", "GUILIN": "广西", "LIUZHOU": "广西", "HAIKOU": "海南", "SANYA": "海南", "CHENGDU": "四川",
+	"MIANYANG": "四川", "GUIYANG": "贵州", "KUNMING": "云南", "LHASA": "西藏", "XI AN": "陕西", "XIAN": "陕西",
+	"LANZHOU": "甘肃", "XINING": "青海", "YINCHUAN": "宁夏", "URUMQI": "新疆",
+}
+
+// importedResolver 列表中的一个解析器
+type importedResolver struct {
+	ip          string
+	isp         string
+	region      string
+	reliability float64
+}
+
+// ImportResolvers 下载（或读取）解析器列表，按 AS 号/组织名识别三家运营商、按城市识别省份，
+// 转为与内置配置相同格式的目标配置；无法识别运营商或省份的解析器跳过
+func ImportResolvers(opts ImportOptions) error {
+	source := opts.Source
+	if strings.Contains(source, "%s") {
+		source = fmt.Sprintf(source, strings.ToLower(opts.Country))
+	}
+	data, err := readImportSource(source)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	var db *geoDB
+	if opts.CityDB != "" {
+		if db, err = openGeoDB(opts.CityDB, ""); err != nil {
+			return err
+		}
+		defer db.Close()
+	}
+
+	resolvers, skipped, err := parseResolverList(data, opts, db)
+	if err != nil {
+		return fmt.Errorf("解析列表 %s 失败: %v", source, err)
+	}
+	catalog, kept := buildImportedCatalog(resolvers, opts.Max)
+	fmt.Fprintf(os.Stderr, "✅ 从 %s 读取 %d 个解析器：导入 %d 个，超出 -max 未导入 %d 个，"+
+		"不可用或可靠性不足 %d 个，非三家运营商 %d 个，无法识别省份 %d 个\n",
+		source, len(resolvers)+skipped.total(), kept, len(resolvers)-kept, skipped.unreliable, skipped.isp, skipped.region)
+	if kept == 0 {
+		return fmt.Errorf("列表 %s 中没有可导入的解析器", source)
+	}
+
+	if opts.OutPath == "" {
+		return writeCatalog(os.Stdout, catalog)
+	}
+	if err := saveCatalog(opts.OutPath, catalog); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "✅ 目标配置已保存到 %s，可通过 -catalog 使用\n", opts.OutPath)
+	return nil
+}
+
+// readImportSource 打开列表：http(s) 地址下载，其余视为本地文件
+func readImportSource(source string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("读取列表 %s 失败: %v", source, err)
+		}
+		return f, nil
+	}
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Get(source)
+	if err != nil {
+		return nil, fmt.Errorf("下载列表 %s 失败: %v", source, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("下载列表 %s 失败: %s", source, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// importSkipped 各类未导入的解析器数
+type importSkipped struct {
+	unreliable, isp, region int
+}
+
+func (s importSkipped) total() int {
+	return s.unreliable + s.isp + s.region
+}
+
+// parseResolverList 解析 public-dns.info 格式的 CSV，按表头定位列：
+// ip_address,name,as_number,as_org,country_code,city,version,error,dnssec,reliability,checked_at,created_at
+func parseResolverList(r io.Reader, opts ImportOptions, db *geoDB) ([]*importedResolver, importSkipped, error) {
+	var skipped importSkipped
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, skipped, err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"ip_address", "as_number", "as_org", "country_code", "city", "reliability"} {
+		if _, ok := columns[name]; !ok {
+			return nil, skipped, fmt.Errorf("缺少列 %s", name)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var resolvers []*importedResolver
+	seen := make(map[string]bool)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, skipped, err
+		}
+		ip := net.ParseIP(field(record, "ip_address"))
+		if ip == nil || ip.To4() == nil || seen[ip.String()] {
+			continue
+		}
+		seen[ip.String()] = true
+
+		reliability, err := strconv.ParseFloat(field(record, "reliability"), 64)
+		if err != nil || reliability < opts.MinReliability || field(record, "error") != "" {
+			skipped.unreliable++
+			continue
+		}
+		asn, _ := strconv.ParseUint(field(record, "as_number"), 10, 32)
+		isp := asnIsps[uint(asn)]
+		if isp == "" {
+			isp = matchChinaIsp(normalizeWhois([]string{field(record, "as_org")}))
+		}
+		if isp == "" {
+			skipped.isp++
+			continue
+		}
+		region, err := resolverRegion(ip, field(record, "country_code"), field(record, "city"), db)
+		if err != nil {
+			return nil, skipped, err
+		}
+		if region == "" {
+			skipped.region++
+			continue
+		}
+		resolvers = append(resolvers, &importedResolver{ip: ip.String(), isp: isp, region: region, reliability: reliability})
+	}
+	return resolvers, skipped, nil
+}
+
+// resolverRegion 优先按离线库判断省份，没有离线库时按列表中的国家代码和城市名匹配
+func resolverRegion(ip net.IP, country string, city string, db *geoDB) (string, error) {
+	if db != nil {
+		geo, err := db.lookup(ip)
+		if err != nil {
+			return "", fmt.Errorf("查询离线库失败: %v", err)
+		}
+		return geo.Region, nil
+	}
+	if strings.EqualFold(country, "HK") {
+		return "香港", nil
+	}
+	normalized := normalizeWhois([]string{city})
+	if region := matchProvince(normalized); region != "" {
+		return region, nil
+	}
+	return importCities[strings.TrimSpace(normalized)], nil
+}
+
+// buildImportedCatalog 按运营商、地区分组，每组按可靠性从高到低保留 max 个，返回配置和保留的数量
+func buildImportedCatalog(resolvers []*importedResolver, max int) (*DNSConfig, int) {
+	sort.SliceStable(resolvers, func(i, j int) bool {
+		if resolvers[i].reliability != resolvers[j].reliability {
+			return resolvers[i].reliability > resolvers[j].reliability
+		}
+		return resolvers[i].ip < resolvers[j].ip
+	})
+	catalog := &DNSConfig{Dx: map[string]ProvinceConfig{}, Lt: map[string]ProvinceConfig{}, Yd: map[string]ProvinceConfig{}}
+	all := ispRegions(catalog)
+	kept := 0
+	for _, r := range resolvers {
+		list := all[r.isp][r.region]
+		if max > 0 && len(list.IPv4) >= max {
+			continue
+		}
+		list.IPv4 = append(list.IPv4, r.ip)
+		all[r.isp][r.region] = list
+		kept++
+	}
+	return catalog, kept
+}
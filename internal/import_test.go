@@ -0,0 +1,53 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestImportResolvers(t *testing.T) {
+	dir := t.TempDir()
+	list := filepath.Join(dir, "cn.csv")
+	content := `ip_address,name,as_number,as_org,country_code,city,version,error,dnssec,reliability,checked_at,created_at
+1.1.1.1,,4134,Chinanet,CN,Hangzhou,,,false,1.00,,
+1.1.1.2,,4134,Chinanet,CN,Hangzhou,,,false,0.95,,
+1.1.1.3,,23650,CHINANET jiangsu province backbone,CN,Nanjing,,,false,0.99,,
+2.2.2.2,,4837,CHINA UNICOM China169 Backbone,CN,Beijing,,,false,1.00,,
+3.3.3.3,,56046,China Mobile,CN,Xi'an,,,false,1.00,,
+4.4.4.4,,37963,Hangzhou Alibaba Advertising Co.,CN,Hangzhou,,,false,1.00,,
+5.5.5.5,,4134,Chinanet,CN,,,,false,1.00,,
+6.6.6.6,,4134,Chinanet,CN,Beijing,,timeout,false,1.00,,
+7.7.7.7,,4134,Chinanet,CN,Beijing,,,false,0.50,,
+2001:db8::1,,4134,Chinanet,CN,Beijing,,,false,1.00,,
+`
+	if err := os.WriteFile(list, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "catalog.json")
+	opts := internal.ImportOptions{Source: list, Country: "cn", MinReliability: 0.9, Max: 1, OutPath: out}
+	if err := internal.ImportResolvers(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog := &internal.DNSConfig{}
+	if err := json.Unmarshal(data, catalog); err != nil {
+		t.Fatal(err)
+	}
+	// 非三家运营商、无法识别省份、不可用和可靠性不足的跳过，每组按可靠性保留 -max 个
+	want := &internal.DNSConfig{
+		Dx: map[string]internal.ProvinceConfig{"浙江": {IPv4: []string{"1.1.1.1"}}, "江苏": {IPv4: []string{"1.1.1.3"}}},
+		Lt: map[string]internal.ProvinceConfig{"北京": {IPv4: []string{"2.2.2.2"}}},
+		Yd: map[string]internal.ProvinceConfig{"陕西": {IPv4: []string{"3.3.3.3"}}},
+	}
+	if !reflect.DeepEqual(catalog, want) {
+		t.Errorf("导入的配置不一致:\n实际 %+v\n期望 %+v", catalog, want)
+	}
+}
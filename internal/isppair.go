@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// 同一对运营商两个方向的平均 RTT 相差超过该倍数且超过该绝对值时视为不对称，多为其中一个方向的互联口拥塞
+const (
+	asymmetryRttRatio = 1.5
+	asymmetryRttMin   = 10 * time.Millisecond
+)
+
+// IspPair 观测点运营商到目标运营商一个方向的汇总：各观测点（-local-isp 相同）探测该运营商全部目标的收发包数和平均 RTT
+type IspPair struct {
+	From     string        // 观测点所在运营商
+	To       string        // 目标运营商
+	Vantages int           // 参与汇总的观测点数
+	Sent     int           // 发包数
+	Recv     int           // 收包数
+	Loss     float64       // 丢包率
+	AvgRtt   time.Duration // 按收包数加权的平均 RTT
+	Reverse  *IspPair      // 反方向（To→From），没有对应观测点或同一运营商时为 nil
+	Asym     bool          // 与反方向的平均 RTT 明显不对称
+
+	rtt float64 // 累加的 收包数×平均RTT
+}
+
+// compareIspPairs 按观测点运营商（快照的 local_isp）→ 目标运营商汇总各观测点的结果，并与反方向对比。
+// 没有 local_isp 的快照不参与；全部丢包的目标不在快照的 rows 中，不计入
+func compareIspPairs(snaps []*Snapshot) []*IspPair {
+	pairs := make(map[[2]string]*IspPair)
+	var keys [][2]string
+	for _, snap := range snaps {
+		if snap.LocalIsp == "" {
+			continue
+		}
+		seen := make(map[[2]string]bool)
+		for _, r := range snap.Rows {
+			key := [2]string{snap.LocalIsp, r.Isp}
+			p := pairs[key]
+			if p == nil {
+				p = &IspPair{From: snap.LocalIsp, To: r.Isp}
+				pairs[key] = p
+				keys = append(keys, key)
+			}
+			if !seen[key] {
+				seen[key] = true
+				p.Vantages++
+			}
+			p.Sent += r.Sent
+			p.Recv += r.Recv
+			p.rtt += float64(r.Recv) * r.AvgRttMs
+		}
+	}
+	result := make([]*IspPair, 0, len(keys))
+	for _, key := range keys {
+		p := pairs[key]
+		if p.Sent > 0 {
+			p.Loss = float64(p.Sent-p.Recv) / float64(p.Sent) * 100
+		}
+		if p.Recv > 0 {
+			p.AvgRtt = msToDuration(p.rtt / float64(p.Recv))
+		}
+		result = append(result, p)
+	}
+	for _, p := range result {
+		if p.From == p.To {
+			continue
+		}
+		p.Reverse = pairs[[2]string{p.To, p.From}]
+		if rev := p.Reverse; rev != nil && p.Recv > 0 && rev.Recv > 0 {
+			slow, fast := max(p.AvgRtt, rev.AvgRtt), min(p.AvgRtt, rev.AvgRtt)
+			p.Asym = float64(slow) >= asymmetryRttRatio*float64(fast) && slow-fast >= asymmetryRttMin
+		}
+	}
+	slices.SortStableFunc(result, func(a, b *IspPair) int {
+		if a.From != b.From {
+			return ispOrder(a.From) - ispOrder(b.From)
+		}
+		return ispOrder(a.To) - ispOrder(b.To)
+	})
+	return result
+}
+
+// validateLocalIsp 校验 -local-isp，为空时不标明
+func validateLocalIsp(isp string) error {
+	if isp == "" || (isp != "all" && slices.Contains(validIsps, isp)) {
+		return nil
+	}
+	return fmt.Errorf("-local-isp 应为探测主机所在的运营商，可选 电信|联通|移动，当前为 '%s'", isp)
+}
+
+// ispOrder 运营商的显示顺序：电信、联通、移动，其他排在最后
+func ispOrder(isp string) int {
+	if i := slices.Index(validIsps, isp); i >= 0 {
+		return i
+	}
+	return len(validIsps)
+}
+
+// printIspPairs 输出运营商对的互联时延，同一对运营商两个方向相邻，不对称的方向标红；少于两个运营商的观测点时只提示
+func printIspPairs(w io.Writer, pairs []*IspPair) {
+	red, reset := "\x1b[31m", "\x1b[0m"
+	fmt.Fprintln(w, "====== 运营商互联时延（观测点运营商→目标运营商） ======")
+	froms := make(map[string]bool)
+	for _, p := range pairs {
+		froms[p.From] = true
+	}
+	if len(froms) < 2 {
+		fmt.Fprintln(w, "需要至少两个不同运营商的观测点（探测时以 -local-isp 标明所在运营商）")
+		return
+	}
+	table := newPlainTable(w, []string{"方向", "观测点", "丢包%", "平均RTT", "反向平均RTT", "差值"})
+	for _, p := range pairs {
+		if p.From == p.To {
+			continue
+		}
+		cells := []string{p.From + "→" + p.To, fmt.Sprint(p.Vantages), fmt.Sprintf("%.1f%%", p.Loss), "-", "-", "-"}
+		if p.Recv > 0 {
+			cells[3] = fmt.Sprintf("%.1fms", durationToMs(p.AvgRtt))
+		}
+		if rev := p.Reverse; rev != nil && rev.Recv > 0 {
+			cells[4] = fmt.Sprintf("%.1fms", durationToMs(rev.AvgRtt))
+			if p.Recv > 0 {
+				cells[5] = fmt.Sprintf("%+.1fms", durationToMs(p.AvgRtt-rev.AvgRtt))
+			}
+		}
+		if p.Asym && p.AvgRtt > p.Reverse.AvgRtt {
+			cells[0], cells[5] = red+cells[0]+reset, red+cells[5]+reset
+		}
+		table.Append(cells)
+	}
+	table.Render()
+}
@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// keepRuns 状态目录中保留的最近运行结果数
+const keepRuns = 10
+
+// PreviousResult 上次运行中同一目标的结果，用于标注本次的变化
+type PreviousResult struct {
+	PacketLoss float64
+	AvgRtt     time.Duration // 上次没有收到回包时为 0
+}
+
+// runStateDir 保存最近运行结果的目录：用户缓存目录下的 dping/runs，不可用时为空
+func runStateDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "dping", "runs")
+}
+
+// loadLastRun 读取状态目录中最近一次运行的结果，没有或无法读取时返回 nil
+func loadLastRun(dir string) *Snapshot {
+	if dir == "" {
+		return nil
+	}
+	names := runFiles(dir)
+	// 最新的文件损坏时依次往前找
+	for i := len(names) - 1; i >= 0; i-- {
+		if snap, err := LoadSnapshot(filepath.Join(dir, names[i])); err == nil {
+			return snap
+		}
+	}
+	return nil
+}
+
+// saveRun 将本次结果保存到状态目录，只保留最近 keepRuns 份
+func saveRun(dir string, snap *Snapshot) error {
+	if dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("保存本次结果供下次对比失败: %v", err)
+	}
+	// 文件名按时间排序即为运行先后
+	name := snap.CreatedAt.Format("20060102-150405.000000") + ".json"
+	if err := SaveSnapshot(filepath.Join(dir, name), snap); err != nil {
+		return err
+	}
+	names := runFiles(dir)
+	for _, old := range names[:max(len(names)-keepRuns, 0)] {
+		os.Remove(filepath.Join(dir, old))
+	}
+	return nil
+}
+
+// runFiles 状态目录中的结果文件名，按运行先后排列
+func runFiles(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			names = append(names, e.Name())
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// previousResults 按目标索引上次的结果，探测出错的行没有测量值，不参与对比
+func previousResults(snap *Snapshot) map[summaryKey]*PreviousResult {
+	if snap == nil {
+		return nil
+	}
+	prev := make(map[summaryKey]*PreviousResult, len(snap.Rows))
+	for _, r := range snap.Rows {
+		if r.Error != "" {
+			continue
+		}
+		key := summaryKey{destIP: r.DestIP, isp: r.Isp, region: r.Region, source: r.Source, proto: r.Proto}
+		prev[key] = &PreviousResult{PacketLoss: r.LossPercent, AvgRtt: msToDuration(r.AvgRttMs)}
+	}
+	return prev
+}
@@ -0,0 +1,219 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+const (
+	socketRetries      = 3                      // 套接字资源耗尽时每个目标最多重试的次数
+	socketRetryBackoff = 500 * time.Millisecond // 第一次重试前的等待，之后每次加倍
+)
+
+// startLimiter 限制每秒开始的探测数（多租户时各租户的 rate），持续探测时各轮共用；为 nil 时不限制
+type startLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newStartLimiter 每秒最多开始 rate 个探测，rate 不大于 0 时返回 nil
+func newStartLimiter(rate int) *startLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &startLimiter{interval: time.Second / time.Duration(rate)}
+}
+
+// wait 等到下一个可以开始探测的时刻，各探测按调用顺序间隔 interval 开始
+func (l *startLimiter) wait() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	at := time.Now()
+	if l.next.After(at) {
+		at = l.next
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+	time.Sleep(time.Until(at))
+}
+
+// probeLimiter 限制同时进行的探测数（-C）；系统套接字资源耗尽时降低上限，已在进行的探测结束后才会按新上限放行
+type probeLimiter struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	initial int
+	limit   int
+	inUse   int
+	retries int
+}
+
+func newProbeLimiter(limit int) *probeLimiter {
+	l := &probeLimiter{initial: limit, limit: limit}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire 等待并占用一个并发名额
+func (l *probeLimiter) acquire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.inUse >= l.limit {
+		l.cond.Wait()
+	}
+	l.inUse++
+}
+
+// release 归还并发名额
+func (l *probeLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inUse--
+	l.cond.Broadcast()
+}
+
+// backoff 套接字资源耗尽时调用：上限减半（至少为 1），归还名额等待 delay 后重新占用
+func (l *probeLimiter) backoff(delay time.Duration) {
+	l.mu.Lock()
+	// 同一时刻多个探测同时失败时只按当时正在进行的数量减半一次，避免上限骤降到 1
+	l.limit = max(min(l.limit, l.inUse)/2, 1)
+	l.retries++
+	l.mu.Unlock()
+	l.release()
+	time.Sleep(delay)
+	l.acquire()
+}
+
+// result 返回初始上限、最终上限和退避重试的次数
+func (l *probeLimiter) result() (initial int, limit int, retries int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.initial, l.limit, l.retries
+}
+
+// ParseConcurrency 解析 -C：总并发数，或逗号分隔的 运营商/地区=并发数，两者可以同时写，如 "100,电信=30,移动=60"；
+// 只写了分组时总并发数取 def 与各分组之和中的较大者，使各分组能同时用满
+func ParseConcurrency(s string, def int) (int, map[string]int, error) {
+	total, sum := 0, 0
+	var limits map[string]int
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		name, value, grouped := strings.Cut(item, "=")
+		if !grouped {
+			value = item
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n <= 0 {
+			return 0, nil, fmt.Errorf("并发数 -C 中的 '%s' 无效，应为大于 0 的整数或 运营商/地区=并发数，如 电信=30", item)
+		}
+		if !grouped {
+			if total > 0 {
+				return 0, nil, fmt.Errorf("并发数 -C 中的总并发数重复")
+			}
+			total = n
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if limits == nil {
+			limits = make(map[string]int)
+		}
+		if _, ok := limits[name]; ok || name == "" {
+			return 0, nil, fmt.Errorf("并发数 -C 中的 '%s' 无效或重复", item)
+		}
+		limits[name] = n
+		sum += n
+	}
+	if total == 0 {
+		total = max(def, sum)
+	}
+	return total, limits, nil
+}
+
+// groupLimiters 按运营商或地区单独限制的并发（-C 电信=30），未列出的目标只受总并发数限制
+type groupLimiters map[string]*probeLimiter
+
+// newGroupLimiters 为各分组创建并发限制，分组名既不是任何目标的运营商也不是地区时提示
+func newGroupLimiters(limits map[string]int, targets []*Target) groupLimiters {
+	g := make(groupLimiters, len(limits))
+	for name, n := range limits {
+		g[name] = newProbeLimiter(n)
+	}
+	matched := make(map[string]bool)
+	for _, t := range targets {
+		for _, name := range g.names(t) {
+			matched[name] = true
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(limits)) {
+		if !matched[name] {
+			log.Printf("⚠️  -C 中的 '%s' 没有匹配的运营商或地区，不会生效\n", name)
+		}
+	}
+	return g
+}
+
+// names 目标匹配的分组名（按名称排序），同一IP属于多个运营商/地区时匹配其中每一个
+func (g groupLimiters) names(t *Target) []string {
+	var names []string
+	for _, l := range t.Labels {
+		for _, name := range []string{l.Isp, l.Region} {
+			if g[name] != nil && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// acquire 依次占用目标匹配的各分组名额，返回归还函数；所有探测按相同的名称顺序占用，不会互相等待成环
+func (g groupLimiters) acquire(t *Target) func() {
+	names := g.names(t)
+	for _, name := range names {
+		g[name].acquire()
+	}
+	return func() {
+		for _, name := range slices.Backward(names) {
+			g[name].release()
+		}
+	}
+}
+
+// isSocketExhausted 是否为系统文件描述符或缓冲区耗尽导致的错误，这类错误降低并发后重试通常可以恢复；
+// EADDRNOTAVAIL 不算：持续探测中源地址消失（DHCP 续租、网卡重启）时也是该错误，重试只会拖慢整轮探测
+func isSocketExhausted(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) || errors.Is(err, syscall.ENOBUFS) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "too many open files") || strings.Contains(msg, "no buffer space available")
+}
+
+// probeWithRetry 执行一次探测，套接字资源耗尽时降低并发、退避后重试；limiter 为 nil 时不重试
+func probeWithRetry(prober Prober, limiter *probeLimiter, to, sourceIP net.IP, count int, adaptive AdaptiveOptions) (*ping.Statistics, error) {
+	delay := socketRetryBackoff
+	for attempt := 0; ; attempt++ {
+		stats, err := prober.Probe(to, sourceIP, count, adaptive)
+		if limiter == nil || attempt == socketRetries || !isSocketExhausted(err) {
+			return stats, err
+		}
+		limiter.backoff(delay)
+		delay *= 2
+	}
+}
@@ -0,0 +1,294 @@
+package internal
+
+import (
+	"cmp"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 两条线路平均 RTT 的差不超过 linkRttTolerance，或不超过较低者的 linkRttRatio 时视为相当；丢包率的容差与多线路推荐相同（lossTolerance）
+const (
+	linkRttTolerance = 2.0 // 毫秒
+	linkRttRatio     = 0.05
+)
+
+// LinkOptions 两条专线的对比参数：Run 为探测参数（运营商、地区、目标、发包数等），其中的 Eth 被 Links 代替
+type LinkOptions struct {
+	Links []string // 两条线路各自的网卡名
+	Run   Options
+	HTML  string // 非空时把对比结果写入该单页 HTML 文件
+}
+
+// Link 参与对比的一条线路：网卡名和探测使用的源IP
+type Link struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+// LinkStat 一条线路到一组目标的结果，目标全部丢包或探测出错时按全部丢包计
+type LinkStat struct {
+	Sent        int     `json:"sent"`
+	Recv        int     `json:"recv"`
+	LossPercent float64 `json:"loss_percent"`
+	AvgRttMs    float64 `json:"avg_rtt_ms"` // 按收包数加权，没有收到回包时为 0
+	rttSum      float64
+}
+
+// LinkGroup 一个运营商在一个地区（Region 为 全部 时为该运营商全部地区，Isp 也为 全部 时为全部目标）的两条线路对比
+type LinkGroup struct {
+	Isp     string      `json:"isp"`
+	Region  string      `json:"region"`
+	Targets int         `json:"targets"`
+	Stats   []*LinkStat `json:"stats"`  // 与 LinkReport.Links 的顺序相同
+	Winner  int         `json:"winner"` // 更优线路的下标，相当时为 -1
+	Verdict string      `json:"verdict"`
+}
+
+// LinkReport 两条专线的对比结果
+type LinkReport struct {
+	CreatedAt time.Time    `json:"created_at"`
+	RunID     string       `json:"run_id,omitempty"`
+	Count     int          `json:"count"`
+	Links     []*Link      `json:"links"`
+	Groups    []*LinkGroup `json:"groups"`  // 按运营商、地区排列，每个运营商的各地区之后是该运营商的合计
+	Overall   *LinkGroup   `json:"overall"` // 全部目标的合计
+	Wins      []int        `json:"wins"`    // 各线路更优的地区数，不含合计
+	Ties      int          `json:"ties"`
+}
+
+// CompareLinks 从两条线路对同一批目标同时执行相同的探测，在标准输出显示各运营商、地区的结论，指定 HTML 时另外写入单页报告
+func CompareLinks(opts LinkOptions) (*LinkReport, error) {
+	if len(opts.Links) != 2 || opts.Links[0] == opts.Links[1] {
+		return nil, fmt.Errorf("需要用 -eth 指定两个不同的网卡，当前为 %v", opts.Links)
+	}
+	if opts.Run.Eth != "" && opts.Run.Eth != "nil" {
+		return nil, fmt.Errorf("线路对比的网卡由 Links 指定，不能同时指定 Eth")
+	}
+	links := make([]*Link, 0, len(opts.Links))
+	for _, name := range opts.Links {
+		ip, err := getPrimaryLocalIP(name)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, &Link{Name: name, Source: ip.String()})
+	}
+	run := opts.Run
+	run.Eth = strings.Join(opts.Links, ",")
+	// 结果表格由本命令代替，不与上次运行对比
+	run.Output.Quiet, run.Output.CompareLast = true, false
+	fmt.Fprintf(os.Stderr, "✅ 从 %s(%s) 和 %s(%s) 同时探测相同的目标\n", links[0].Name, links[0].Source, links[1].Name, links[1].Source)
+	result, err := DPing(run)
+	if err != nil {
+		return nil, err
+	}
+	report := NewLinkReport(result.Snapshot, links)
+	printLinkReport(os.Stdout, report)
+	if opts.HTML != "" {
+		f, err := os.Create(opts.HTML)
+		if err != nil {
+			return nil, fmt.Errorf("创建对比报告 %s 失败: %v", opts.HTML, err)
+		}
+		defer f.Close()
+		if err := report.WriteHTML(f); err != nil {
+			return nil, fmt.Errorf("写入对比报告 %s 失败: %v", opts.HTML, err)
+		}
+		fmt.Fprintf(os.Stderr, "✅ 对比报告已写入 %s\n", opts.HTML)
+	}
+	return report, nil
+}
+
+// NewLinkReport 按运营商和地区汇总快照中各线路的结果并给出结论；源IP不属于任何线路的结果忽略
+func NewLinkReport(snap *Snapshot, links []*Link) *LinkReport {
+	report := &LinkReport{CreatedAt: snap.CreatedAt, RunID: snap.RunID, Count: snap.Count, Links: links, Wins: make([]int, len(links))}
+	index := make(map[string]int)
+	for i, l := range links {
+		index[l.Source] = i
+	}
+	type groupKey struct{ isp, region string }
+	groups := make(map[groupKey]*LinkGroup)
+	targets := make(map[groupKey]map[string]bool)
+	add := func(key groupKey, link int, row *SnapshotRow) {
+		g := groups[key]
+		if g == nil {
+			g = &LinkGroup{Isp: key.isp, Region: key.region, Stats: make([]*LinkStat, len(links))}
+			for i := range g.Stats {
+				g.Stats[i] = &LinkStat{}
+			}
+			groups[key] = g
+			targets[key] = make(map[string]bool)
+		}
+		targets[key][row.DestIP] = true
+		st := g.Stats[link]
+		// 出错的目标没有收发包，按发出 -p 个包全部丢失计
+		sent := row.Sent
+		if sent == 0 {
+			sent = snap.Count
+		}
+		st.Sent += sent
+		st.Recv += row.Recv
+		st.rttSum += row.AvgRttMs * float64(row.Recv)
+	}
+	for _, row := range slices.Concat(snap.Rows, snap.Unanswered) {
+		link, ok := index[row.Source]
+		if !ok {
+			continue
+		}
+		add(groupKey{row.Isp, row.Region}, link, row)
+		add(groupKey{row.Isp, "全部"}, link, row)
+		add(groupKey{"全部", "全部"}, link, row)
+	}
+
+	for key, g := range groups {
+		g.Targets = len(targets[key])
+		for _, st := range g.Stats {
+			if st.Sent > 0 {
+				st.LossPercent = float64(st.Sent-st.Recv) / float64(st.Sent) * 100
+			}
+			if st.Recv > 0 {
+				st.AvgRttMs = st.rttSum / float64(st.Recv)
+			}
+		}
+		g.Winner, g.Verdict = linkVerdict(g.Stats, links)
+		switch {
+		case key.isp == "全部":
+			report.Overall = g
+			continue
+		case key.region == "全部":
+		case g.Winner < 0:
+			report.Ties++
+		default:
+			report.Wins[g.Winner]++
+		}
+		report.Groups = append(report.Groups, g)
+	}
+	// 运营商按固定顺序，同一运营商的各地区按名称排列，合计放在最后
+	slices.SortFunc(report.Groups, func(a, b *LinkGroup) int {
+		if c := cmp.Compare(ispOrder(a.Isp), ispOrder(b.Isp)); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Isp, b.Isp); c != 0 {
+			return c
+		}
+		return cmp.Or(cmp.Compare(isTotal(a), isTotal(b)), strings.Compare(a.Region, b.Region))
+	})
+	return report
+}
+
+// isTotal 合计行排在同一运营商的各地区之后
+func isTotal(g *LinkGroup) int {
+	if g.Region == "全部" {
+		return 1
+	}
+	return 0
+}
+
+// linkVerdict 比较两条线路：丢包率相差超过 lossTolerance 时丢包低者更优，否则平均 RTT 明显更低者更优，都不明显时为相当
+func linkVerdict(stats []*LinkStat, links []*Link) (int, string) {
+	a, b := stats[0], stats[1]
+	if d := a.LossPercent - b.LossPercent; math.Abs(d) > lossTolerance {
+		winner := 0
+		if d > 0 {
+			winner = 1
+		}
+		return winner, fmt.Sprintf("%s 更优（丢包低 %.1f 个百分点）", links[winner].Name, math.Abs(d))
+	}
+	switch {
+	case a.Recv == 0 && b.Recv == 0:
+		return -1, "相当（均无回包）"
+	case a.Recv == 0 || b.Recv == 0:
+		// 丢包率相近但一条线路完全没有回包（如发包很少），有回包的更优
+		winner := 0
+		if a.Recv == 0 {
+			winner = 1
+		}
+		return winner, fmt.Sprintf("%s 更优（另一条无回包）", links[winner].Name)
+	}
+	d := a.AvgRttMs - b.AvgRttMs
+	if math.Abs(d) <= max(linkRttTolerance, linkRttRatio*min(a.AvgRttMs, b.AvgRttMs)) {
+		return -1, "相当"
+	}
+	winner := 0
+	if d > 0 {
+		winner = 1
+	}
+	return winner, fmt.Sprintf("%s 更优（RTT 低 %.1fms）", links[winner].Name, math.Abs(d))
+}
+
+// label 线路的显示名称：网卡(源IP)
+func (l *Link) label() string {
+	return fmt.Sprintf("%s(%s)", l.Name, l.Source)
+}
+
+// String 丢包率和平均 RTT，没有回包时 RTT 为 -
+func (s *LinkStat) String() string {
+	if s.Recv == 0 {
+		return fmt.Sprintf("%.1f%% / -", s.LossPercent)
+	}
+	return fmt.Sprintf("%.1f%% / %.1fms", s.LossPercent, s.AvgRttMs)
+}
+
+// Summary 总体结论：各线路更优的地区数和全部目标的结论
+func (r *LinkReport) Summary() string {
+	if r.Overall == nil {
+		return "没有两条线路的探测结果"
+	}
+	return fmt.Sprintf("%s 在 %d 个地区更优，%s 在 %d 个地区更优，%d 个地区相当；全部目标：%s",
+		r.Links[0].Name, r.Wins[0], r.Links[1].Name, r.Wins[1], r.Ties, r.Overall.Verdict)
+}
+
+// printLinkReport 输出各运营商、地区两条线路的丢包率和平均 RTT 及结论
+func printLinkReport(w io.Writer, r *LinkReport) {
+	fmt.Fprintln(w, "====== 专线对比 ======")
+	table := newPlainTable(w, []string{"运营商", "地区", "目标数", r.Links[0].label() + " 丢包/RTT", r.Links[1].label() + " 丢包/RTT", "结论"})
+	for _, g := range slices.Concat(r.Groups, []*LinkGroup{r.Overall}) {
+		if g == nil {
+			continue
+		}
+		table.Append([]string{g.Isp, g.Region, fmt.Sprint(g.Targets), g.Stats[0].String(), g.Stats[1].String(), g.Verdict})
+	}
+	table.Render()
+	fmt.Fprintf(w, "结论：%s\n", r.Summary())
+}
+
+var linkReportHTML = template.Must(template.New("links").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>专线对比 {{.CreatedAt.Format "2006-01-02 15:04:05"}}</title>
+<style>
+body { font-family: -apple-system, "PingFang SC", "Microsoft YaHei", sans-serif; margin: 24px; color: #222; }
+table { border-collapse: collapse; margin-bottom: 24px; }
+th, td { padding: 4px 10px; border-bottom: 1px solid #ddd; text-align: left; white-space: nowrap; }
+th { background: #f4f4f4; }
+tr.total td { font-weight: bold; }
+.good { color: #1a7f37; font-weight: bold; }
+.meta { color: #666; }
+.summary { font-size: 1.2em; }
+</style>
+</head>
+<body>
+<h1>专线对比</h1>
+<p class="meta">生成时间 {{.CreatedAt.Format "2006-01-02 15:04:05"}} · 每个目标发包 {{.Count}}{{with .RunID}} · 运行 ID {{.}}{{end}}</p>
+<p class="meta">{{range $i, $l := .Links}}{{if $i}} 与 {{end}}{{$l.Name}}（源IP {{$l.Source}}）{{end}} 同时探测相同的目标；丢包率相差不超过 0.5 个百分点时比较平均 RTT，RTT 相差不超过 2ms 或 5% 视为相当</p>
+<p class="summary">结论：{{.Summary}}</p>
+<table>
+<thead><tr><th>运营商</th><th>地区</th><th>目标数</th>{{range .Links}}<th>{{.Name}} 丢包%</th><th>{{.Name}} AvgRTT</th>{{end}}<th>结论</th></tr></thead>
+<tbody>
+{{range .Groups}}<tr{{if eq .Region "全部"}} class="total"{{end}}><td>{{.Isp}}</td><td>{{.Region}}</td><td>{{.Targets}}</td>{{$w := .Winner}}{{range $i, $s := .Stats}}<td{{if eq $i $w}} class="good"{{end}}>{{printf "%.1f%%" $s.LossPercent}}</td><td{{if eq $i $w}} class="good"{{end}}>{{if $s.Recv}}{{printf "%.1fms" $s.AvgRttMs}}{{else}}-{{end}}</td>{{end}}<td>{{.Verdict}}</td></tr>
+{{end}}{{with .Overall}}<tr class="total"><td>全部</td><td>全部</td><td>{{.Targets}}</td>{{$w := .Winner}}{{range $i, $s := .Stats}}<td{{if eq $i $w}} class="good"{{end}}>{{printf "%.1f%%" $s.LossPercent}}</td><td{{if eq $i $w}} class="good"{{end}}>{{if $s.Recv}}{{printf "%.1fms" $s.AvgRttMs}}{{else}}-{{end}}</td>{{end}}<td>{{.Verdict}}</td></tr>
+{{end}}</tbody>
+</table>
+</body>
+</html>
+`))
+
+// WriteHTML 把对比结果写成单页 HTML 报告，内容与标准输出的表格一致
+func (r *LinkReport) WriteHTML(w io.Writer) error {
+	return linkReportHTML.Execute(w, r)
+}
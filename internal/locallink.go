@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// LocalLinkIsp -local 自动发现的本地链路目标（默认网关、DNS 服务器、上游第一跳）的运营商，汇总时单独成组
+const LocalLinkIsp = "本地链路"
+
+// 本地链路目标的地区，表示目标的角色
+const (
+	localGateway  = "默认网关"
+	localDNS      = "DNS服务器"
+	localUpstream = "上游第一跳"
+)
+
+// upstreamProbeTarget 没有可用的 IPv4 目标时，沿到该地址的路径查找上游第一跳
+const upstreamProbeTarget = "223.5.5.5"
+
+// resolvConfPaths 依次查找 DNS 服务器的文件：系统使用的 resolv.conf，只有本机的 systemd-resolved 时改用其上游服务器
+var resolvConfPaths = []string{"/etc/resolv.conf", "/run/systemd/resolve/resolv.conf"}
+
+// discoverLocalLink 发现本机的默认网关、DNS 服务器，以及沿 via（通常为第一个探测目标）的路径网关之后的第一跳，
+// 只发现 IPv4 地址；某一项无法发现时跳过并在 notes 中说明
+func discoverLocalLink(via string, sourceIP net.IP, device string) (targets []*Target, notes []string) {
+	set := newTargetSet()
+	gateway, err := defaultGateway()
+	if err != nil {
+		notes = append(notes, fmt.Sprintf("未发现默认网关: %v", err))
+	} else {
+		set.add(gateway.ip.String(), TargetLabel{Region: localGateway, Isp: LocalLinkIsp})
+	}
+
+	servers, err := nameservers()
+	if err != nil {
+		notes = append(notes, fmt.Sprintf("未发现 DNS 服务器: %v", err))
+	}
+	for _, ip := range servers {
+		set.add(ip.String(), TargetLabel{Region: localDNS, Isp: LocalLinkIsp})
+	}
+
+	to := net.ParseIP(via).To4()
+	if to == nil {
+		to = net.ParseIP(upstreamProbeTarget)
+	}
+	hop, err := upstreamHop(to, sourceIP, device)
+	switch {
+	case err != nil:
+		notes = append(notes, fmt.Sprintf("未发现上游第一跳: %v", err))
+	case hop == nil:
+		notes = append(notes, fmt.Sprintf("到 %s 两跳内即到达，没有单独的上游第一跳", to))
+	default:
+		set.add(hop.String(), TargetLabel{Region: localUpstream, Isp: LocalLinkIsp})
+	}
+	return set.targets, notes
+}
+
+// nameservers 读取 resolv.conf 中的 IPv4 DNS 服务器，DHCP 下发的服务器也写在这里；
+// 只有 127.0.0.53 等本机地址（systemd-resolved）时读取其上游服务器
+func nameservers() ([]net.IP, error) {
+	var lastErr error
+	for _, path := range resolvConfPaths {
+		servers, err := readNameservers(path)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(servers) > 0 {
+			return servers, nil
+		}
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, errors.New("resolv.conf 中没有本机以外的 IPv4 地址")
+}
+
+// readNameservers 读取 resolv.conf 中 nameserver 行的 IPv4 地址，跳过本机地址
+func readNameservers(path string) ([]net.IP, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var servers []net.IP
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		if ip := net.ParseIP(fields[1]).To4(); ip != nil && !ip.IsLoopback() {
+			servers = append(servers, ip)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取 %s 失败: %v", path, err)
+	}
+	return servers, nil
+}
+
+// upstreamHop 向 to 发送 TTL 为 2 的 Echo 请求，返回回复超时报文的路由器（网关之后的第一跳）；
+// 两跳内到达 to 时返回 nil，最多尝试 3 次
+func upstreamHop(to net.IP, sourceIP net.IP, device string) (net.IP, error) {
+	conn, err := listenICMP(to, sourceIP, device)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := ipv4.NewPacketConn(conn).SetTTL(2); err != nil {
+		return nil, err
+	}
+
+	id := rand.IntN(0xffff)
+	for seq := 1; seq <= 3; seq++ {
+		hop, reached, err := hopOnce(conn, to, id, seq)
+		if reached {
+			return nil, nil
+		}
+		if err == nil {
+			return hop, nil
+		}
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("到 %s 路径上的第二跳没有回复超时报文", to)
+}
+
+// hopOnce 发送一次 Echo 请求，等待对应的超时报文（返回其来源）或目标的应答（reached 为 true）
+func hopOnce(conn net.PacketConn, to net.IP, id, seq int) (hop net.IP, reached bool, err error) {
+	msg := icmp.Message{Type: ipv4.ICMPTypeEcho, Body: &icmp.Echo{ID: id, Seq: seq, Data: make([]byte, 24)}}
+	wb, err := msg.Marshal(nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := conn.WriteTo(wb, &net.IPAddr{IP: to}); err != nil {
+		return nil, false, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	bufp := packetPool.Get().(*[]byte)
+	defer packetPool.Put(bufp)
+	rb := *bufp
+	for {
+		n, peer, err := conn.ReadFrom(rb)
+		if err != nil {
+			return nil, false, err
+		}
+		addr, ok := peer.(*net.IPAddr)
+		if !ok {
+			continue
+		}
+		reply, err := icmp.ParseMessage(1, rb[:n])
+		if err != nil {
+			continue
+		}
+		switch body := reply.Body.(type) {
+		case *icmp.Echo:
+			if reply.Type == ipv4.ICMPTypeEchoReply && addr.IP.Equal(to) && body.ID == id && body.Seq == seq {
+				return nil, true, nil
+			}
+		case *icmp.TimeExceeded:
+			if quotedEcho(body.Data, id, seq) {
+				return addr.IP, false, nil
+			}
+		}
+	}
+}
+
+// quotedEcho 超时报文引用的原始报文（IPv4 头及其后至少 8 字节）是否为标识符和序号匹配的 Echo 请求
+func quotedEcho(data []byte, id, seq int) bool {
+	if len(data) < ipv4.HeaderLen {
+		return false
+	}
+	hl := int(data[0]&0x0f) * 4
+	if len(data) < hl+8 || data[hl] != byte(ipv4.ICMPTypeEcho) {
+		return false
+	}
+	echo := data[hl:]
+	return int(echo[4])<<8|int(echo[5]) == id && int(echo[6])<<8|int(echo[7]) == seq
+}
+
+// mergeTargets 将 extra 加入 targets：IP 和探测参数都相同的目标只追加标签，不重复探测
+func mergeTargets(targets []*Target, extra []*Target) []*Target {
+	for _, e := range extra {
+		merged := false
+		for _, t := range targets {
+			if t.IP == e.IP && t.Probe == e.Probe {
+				t.Labels = append(t.Labels, e.Labels...)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			targets = append(targets, e)
+		}
+	}
+	return targets
+}
@@ -0,0 +1,122 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReadNameservers(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "resolv.conf")
+	conf := `# Generated by NetworkManager
+search example.com
+nameserver 127.0.0.53
+nameserver 192.168.1.1
+; nameserver 8.8.8.8
+nameserver 2001:db8::1
+nameserver
+nameserver bogus
+options edns0 trust-ad
+nameserver	10.0.0.2	# 行尾注释
+`
+	if err := os.WriteFile(path, []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	servers, err := internal.ReadNameservers(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, ip := range servers {
+		got = append(got, ip.String())
+	}
+	// 只保留本机以外的 IPv4 地址，注释、IPv6 和无效地址都跳过
+	if want := []string{"192.168.1.1", "10.0.0.2"}; !slices.Equal(got, want) {
+		t.Errorf("DNS 服务器应为 %v，实际为 %v", want, got)
+	}
+
+	// 只有 systemd-resolved 的本机地址时没有结果，由调用方改读上游服务器
+	stub := filepath.Join(dir, "stub-resolv.conf")
+	if err := os.WriteFile(stub, []byte("nameserver 127.0.0.53\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if servers, err := internal.ReadNameservers(stub); err != nil || len(servers) != 0 {
+		t.Errorf("只有本机地址时应没有结果，实际为 %v %v", servers, err)
+	}
+	if _, err := internal.ReadNameservers(filepath.Join(dir, "missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("文件不存在时应返回 ErrNotExist，实际为 %v", err)
+	}
+}
+
+// timeExceeded 构造路由器对 id、seq 的 ICMP 报文（typ 为 8 时是 Echo 请求）回复的超时报文，返回其中引用的原始报文；
+// options 为原始 IPv4 头中 IP 选项的 4 字节字数，quote 为引用的 ICMP 字节数
+func timeExceeded(typ byte, id, seq, options, quote int) []byte {
+	echo := append([]byte{typ, 0, 0, 0, byte(id >> 8), byte(id), byte(seq >> 8), byte(seq)}, make([]byte, 24)...)
+	orig := ipv4(1, "10.0.0.1", "223.5.5.5", options, echo[:quote])
+	// 超时报文 ICMP 头的 8 字节之后即为引用的原始报文
+	return icmp(11, orig)[8:]
+}
+
+func TestQuotedEcho(t *testing.T) {
+	const id, seq = 0x1234, 2
+	for _, c := range []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"匹配的 Echo 请求", timeExceeded(8, id, seq, 0, 8), true},
+		{"引用了完整的报文", timeExceeded(8, id, seq, 0, 32), true},
+		{"原始报文带 IP 选项", timeExceeded(8, id, seq, 2, 8), true},
+		{"标识符不同", timeExceeded(8, id+1, seq, 0, 8), false},
+		{"序号不同", timeExceeded(8, id, seq+1, 0, 8), false},
+		{"引用的不是 Echo 请求", timeExceeded(0, id, seq, 0, 8), false},
+		{"引用的 ICMP 头被截断", timeExceeded(8, id, seq, 0, 4), false},
+		{"IP 选项之后被截断", timeExceeded(8, id, seq, 2, 0)[:24], false},
+		{"不足一个 IPv4 头", make([]byte, 12), false},
+	} {
+		if got := internal.QuotedEcho(c.data, id, seq); got != c.want {
+			t.Errorf("%s: 应为 %v，实际为 %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestMergeTargets(t *testing.T) {
+	tcp := internal.TargetProbe{Proto: "tcp", Port: 53}
+	targets := []*internal.Target{
+		{IP: "192.168.1.1", Labels: []internal.TargetLabel{{Region: "北京", Isp: "电信"}}},
+		{IP: "10.0.0.2", Labels: []internal.TargetLabel{{Region: "上海", Isp: "联通"}}, Probe: tcp},
+	}
+	extra := []*internal.Target{
+		{IP: "192.168.1.1", Labels: []internal.TargetLabel{{Region: "默认网关", Isp: internal.LocalLinkIsp}}},
+		{IP: "10.0.0.2", Labels: []internal.TargetLabel{{Region: "DNS服务器", Isp: internal.LocalLinkIsp}}},
+		{IP: "100.64.0.1", Labels: []internal.TargetLabel{{Region: "上游第一跳", Isp: internal.LocalLinkIsp}}},
+	}
+	merged := internal.MergeTargets(targets, extra)
+
+	var got []string
+	for _, target := range merged {
+		s := target.IP + " " + target.Probe.Proto
+		for _, l := range target.Labels {
+			s += " " + l.Region
+		}
+		got = append(got, s)
+	}
+	// IP 和探测参数都相同时只追加标签；探测参数不同的同一 IP 单独探测
+	want := []string{
+		"192.168.1.1  北京 默认网关",
+		"10.0.0.2 tcp 上海",
+		"10.0.0.2  DNS服务器",
+		"100.64.0.1  上游第一跳",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("合并后的目标应为\n%q\n实际为\n%q", want, got)
+	}
+	if merged[0] != targets[0] {
+		t.Error("已有的目标应原地追加标签")
+	}
+}
@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metricsBuckets RTT 直方图的桶上界（秒），覆盖同城的 1ms 到跨境、卫星链路的 2s
+var metricsBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.02, 0.03, 0.05, 0.075, 0.1, 0.15, 0.2, 0.3, 0.5, 1, 2}
+
+// metricsKey 一组指标的标签：按运营商、地区聚合而不按目标IP，避免内置目标的时间序列过多
+type metricsKey struct {
+	isp, region, proto, source string
+}
+
+// metricsSeries 一组标签下自启动以来的累计值
+type metricsSeries struct {
+	buckets []uint64 // 与 metricsBuckets 对应，每个桶只计落在该桶内的样本，输出时再累加
+	count   uint64
+	sum     float64
+	sent    uint64
+	recv    uint64
+}
+
+// Metrics 以 Prometheus 文本格式（/metrics）导出探测结果：RTT 为直方图（每个收到应答的包计一次），
+// 收发包数为计数器，均自启动起累计，Grafana 的热力图和 histogram_quantile 可以直接使用。方法在 m 为 nil 时什么都不做
+type Metrics struct {
+	server *http.Server
+	addr   net.Addr
+
+	mu     sync.Mutex
+	series map[metricsKey]*metricsSeries
+}
+
+// StartMetrics 在 addr 上提供 Prometheus 抓取接口 /metrics，认证参数与 -pprof 共用；地址无法监听时返回错误
+func StartMetrics(addr string, auth HTTPAuth) (*Metrics, error) {
+	ln, scheme, err := auth.listen("metrics", addr)
+	if err != nil {
+		return nil, err
+	}
+	m := &Metrics{addr: ln.Addr(), series: make(map[metricsKey]*metricsSeries)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.write(w)
+	})
+	m.server = &http.Server{Handler: auth.wrap(mux)}
+	go m.server.Serve(ln)
+	fmt.Fprintf(os.Stderr, "✅ Prometheus 指标已启动: %s://%s/metrics\n", scheme, ln.Addr())
+	return m, nil
+}
+
+// Addr 实际监听的地址，监听端口为 0 时用于获取分配的端口
+func (m *Metrics) Addr() net.Addr {
+	return m.addr
+}
+
+// Close 停止服务
+func (m *Metrics) Close() {
+	if m == nil {
+		return
+	}
+	m.server.Close()
+}
+
+// observe 计入一条探测结果的收发包数和每个应答的 RTT
+func (m *Metrics) observe(stat *PingStatistic) {
+	if m == nil || stat.Statistic == nil {
+		return
+	}
+	key := metricsKey{isp: stat.Isp, region: stat.Region, proto: stat.Proto, source: stat.SrcIp}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.series[key]
+	if s == nil {
+		s = &metricsSeries{buckets: make([]uint64, len(metricsBuckets))}
+		m.series[key] = s
+	}
+	s.sent += uint64(stat.Statistic.PacketsSent)
+	s.recv += uint64(stat.Statistic.PacketsRecv)
+	for _, rtt := range stat.Statistic.Rtts {
+		v := rtt.Seconds()
+		s.count++
+		s.sum += v
+		if i, _ := slices.BinarySearch(metricsBuckets, v); i < len(metricsBuckets) {
+			s.buckets[i]++
+		}
+	}
+}
+
+// write 按标签排序输出全部指标
+func (m *Metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]metricsKey, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b metricsKey) int {
+		return strings.Compare(a.isp+"\x00"+a.region+"\x00"+a.proto+"\x00"+a.source, b.isp+"\x00"+b.region+"\x00"+b.proto+"\x00"+b.source)
+	})
+
+	fmt.Fprintln(w, "# HELP dping_rtt_seconds 探测往返时延，每个收到应答的包计一次")
+	fmt.Fprintln(w, "# TYPE dping_rtt_seconds histogram")
+	for _, key := range keys {
+		s := m.series[key]
+		var cumulative uint64
+		for i, le := range metricsBuckets {
+			cumulative += s.buckets[i]
+			fmt.Fprintf(w, "dping_rtt_seconds_bucket{%s} %d\n", key.labels("le", strconv.FormatFloat(le, 'g', -1, 64)), cumulative)
+		}
+		fmt.Fprintf(w, "dping_rtt_seconds_bucket{%s} %d\n", key.labels("le", "+Inf"), s.count)
+		fmt.Fprintf(w, "dping_rtt_seconds_sum{%s} %s\n", key.labels(), strconv.FormatFloat(s.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "dping_rtt_seconds_count{%s} %d\n", key.labels(), s.count)
+	}
+	for _, counter := range []struct {
+		name, help string
+		value      func(*metricsSeries) uint64
+	}{
+		{"dping_packets_sent_total", "发出的探测包数", func(s *metricsSeries) uint64 { return s.sent }},
+		{"dping_packets_received_total", "收到应答的探测包数，与发包数之差为丢包", func(s *metricsSeries) uint64 { return s.recv }},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", counter.name, counter.help, counter.name)
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s{%s} %d\n", counter.name, key.labels(), counter.value(m.series[key]))
+		}
+	}
+}
+
+// labels 按 Prometheus 文本格式转义的标签，extra 为追加的标签名和值（如直方图的 le），值为空的标签不输出
+func (k metricsKey) labels(extra ...string) string {
+	pairs := [][2]string{{"isp", k.isp}, {"region", k.region}, {"proto", k.proto}, {"source", k.source}}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, [2]string{extra[i], extra[i+1]})
+	}
+	var parts []string
+	for _, l := range pairs {
+		if l[1] != "" {
+			parts = append(parts, l[0]+"=\""+metricsEscaper.Replace(l[1])+"\"")
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// metricsEscaper 标签值中需要转义的字符
+var metricsEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,90 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	dir := t.TempDir()
+	targetFile := filepath.Join(dir, "targets.txt")
+	if err := os.WriteFile(targetFile, []byte("127.0.0.1 北京 电信\n127.0.0.1 天津 电信\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, err := internal.StartMetrics("127.0.0.1:0", internal.HTTPAuth{Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer metrics.Close()
+	// 两轮的结果累计到同一组时间序列
+	for range 2 {
+		_, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 2,
+			Probe:   internal.ProbeOptions{Proto: "tcp", Port: ln.Addr().(*net.TCPAddr).Port},
+			Targets: internal.TargetOptions{File: targetFile},
+			Output:  internal.OutputOptions{Format: "json", NoPager: true, OutPath: filepath.Join(dir, "result.json")},
+			Metrics: metrics})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scrape := func(token string) (int, string) {
+		req, err := http.NewRequest("GET", "http://"+metrics.Addr().String()+"/metrics", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	if code, _ := scrape("wrong"); code != http.StatusUnauthorized {
+		t.Errorf("令牌错误时应返回 401，实际 %d", code)
+	}
+	code, body := scrape("secret")
+	if code != http.StatusOK {
+		t.Fatalf("抓取失败: %d %s", code, body)
+	}
+	for _, want := range []string{
+		"# TYPE dping_rtt_seconds histogram\n",
+		`dping_rtt_seconds_bucket{isp="电信",region="北京",le="+Inf"} 4` + "\n",
+		`dping_rtt_seconds_bucket{isp="电信",region="天津",le="2"} 4` + "\n",
+		`dping_rtt_seconds_count{isp="电信",region="北京"} 4` + "\n",
+		`dping_packets_sent_total{isp="电信",region="天津"} 4` + "\n",
+		`dping_packets_received_total{isp="电信",region="北京"} 4` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("指标中应有 %q:\n%s", want, body)
+		}
+	}
+	if strings.Index(body, `region="北京"`) > strings.Index(body, `region="天津"`) {
+		t.Errorf("时间序列应按标签排序:\n%s", body)
+	}
+}
@@ -1,12 +1,18 @@
 package internal
 
 import (
-	"fmt"
 	"github.com/go-ping/ping"
-	"github.com/olekukonko/tablewriter"
-	"os"
+	"hash/maphash"
+	"log"
+	"maps"
+	"math"
+	"net/netip"
+	"slices"
 	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 )
 
@@ -17,7 +23,8 @@ type DNSConfig struct {
 }
 
 type ProvinceConfig struct {
-	IPv4 []string `json:"IPv4"`
+	IPv4    []string           `json:"IPv4"`
+	Weights map[string]float64 `json:"weights,omitempty"` // 目标权重，IP -> 权重，未列出的为 1；汇总时主用的解析服务器可设为高于备用的
 }
 
 type PingStatistic struct {
@@ -25,7 +32,13 @@ type PingStatistic struct {
 	DecIp     string
 	Region    string
 	Isp       string
+	Proto     string // 同时使用多个探测方式时的协议标签，如 dns、tcp:53，否则为空
 	Statistic *ping.Statistics
+	Details   *ProbeDetails     // 探测方式特有的附加结果，没有时为 nil
+	Err       string            // 探测出错时的原因，此时 Statistic 只有 100% 的丢包率
+	Tags      map[string]string // 目标文件中的自定义标签，只读，多条结果共用
+	Weight    float64           // 目标权重，0 为未指定（按 1 计）
+	pooled    bool              // 由 newPingStatistic 从池中取出，汇总后可回收
 }
 
 // SummaryStatistic 存储汇总统计信息
@@ -33,65 +46,116 @@ type SummaryStatistic struct {
 	DestIP                string
 	Region                string
 	Isp                   string
+	Source                string // 源IP，未指定网卡时为空；多源探测时同一目标每个源各有一条
+	Proto                 string // 协议标签，只使用一个探测方式时为空；多个探测方式时同一目标每个方式各有一条
 	TotalSent             int
 	TotalRecv             int
 	MinRtt                time.Duration
 	MaxRtt                time.Duration
 	AvgRtt                time.Duration
+	StdDevRtt             time.Duration // RTT 标准差，用于对比时判断差异是否显著
 	MinRttAvg             time.Duration
 	MaxRttAvg             time.Duration
 	LastUpdated           time.Time
-	PacketLoss            float64 //丢包
-	PacketsRecvDuplicates int     //重传
-}
+	PacketLoss            float64           //丢包
+	PacketsRecvDuplicates int               //重传
+	Timestamps            *TimestampStats   // 时钟偏差与单向时延，仅时间戳探测（目标支持时）和 NTP 探测有值
+	HTTPTiming            *HTTPTiming       // HTTP 各阶段耗时，仅 HTTP 探测有值
+	TCPOutcomes           *TCPOutcomes      // 建连结果分类计数，仅 TCP 探测有值
+	Score                 float64           // 综合评分（0~100，越高越好），读取汇总数据时按评分权重计算
+	Error                 string            // 探测出错的原因，出错时没有收发包统计
+	Tags                  map[string]string // 目标文件中的自定义标签，只读
+	Group                 string            // 按 -group-by 模板得到的分组，未指定时为空，按运营商分组
+	Weight                float64           // 目标在汇总（小计、总计、按服务汇总、多线路推荐）中的权重，0 为未指定（按 1 计）
+	LossStreak            *LossStreak       // 连续丢包的轮数，仅持续探测时有值
+	Previous              *PreviousResult   // 上次运行中同一目标的结果，未开启对比或上次没有该目标时为 nil，只读
+	DNSAnswers            []string          // DNS 探测应答中的 A 记录，仅 DNS 探测且有应答时有值，只读
+	ECSAnswers            []*ECSAnswer      // 携带各客户端子网查询的结果，仅 DNS 探测指定 -dns-ecs 时有值，只读
+	DNSSEC                *bool             // 解析服务器是否校验 DNSSEC，仅 DNS 探测指定 -dns-dnssec 且能判断时有值
+	PathMTU               int               // 到目标的路径 MTU（字节），仅指定 -pmtu 且目标响应 ICMP 时有值
 
-type IspSummary struct {
-	Isp           string
-	RegionCount   int
-	TotalSent     int
-	TotalRecv     int
-	TotalLoss     float64
-	AvgPacketLoss float64
-	AvgRtt        time.Duration
+	// 数据存储中各次探测的原始累加值（纳秒），AvgRtt、StdDevRtt、MinRttAvg、MaxRttAvg 和 PacketLoss 在读取时由其计算（见 derive），
+	// 不做增量平均，合并多少次探测都不会累积舍入误差
+	rttSum    float64 // 收包数×平均 RTT 之和，即全部 RTT 之和
+	rttSumSq  float64 // 收包数×(方差+平均 RTT²) 之和，即全部 RTT 的平方和
+	minRttSum float64 // 收包数×最小 RTT 之和
+	maxRttSum float64 // 收包数×最大 RTT 之和
 }
 
-// PingStatsStore 线程安全的数据存储结构
+// storeShards 数据存储的分片数：按目标IP哈希分片，数百个并发生产者写入不同目标时互不阻塞
+const storeShards = 32
+
+// PingStatsStore 线程安全的数据存储结构，按目标IP分片加锁，读取时逐片复制后在锁外排序
 type PingStatsStore struct {
-	mu          sync.Mutex
-	summaryData map[string]*SummaryStatistic // 按目标IP汇总
-	recentStats []*PingStatistic             // 最近的记录
-	maxRecent   int                          // 最大最近记录数
+	shards    [storeShards]storeShard
+	seed      maphash.Seed
+	seq       atomic.Uint64                  // 结果的写入序号，用于合并各分片的最近记录
+	maxRecent int                            // 最大最近记录数
+	weights   ScoreWeights                   // 读取汇总数据时计算综合评分的权重
+	groupBy   *template.Template             // 读取汇总数据时计算分组，为 nil 时按运营商分组
+	streaks   *LossStreaks                   // 持续探测时跨轮累计的连续丢包，只探测一轮时为 nil
+	previous  map[summaryKey]*PreviousResult // 上次运行的结果，读取汇总数据时标注到同一目标上
+	backend   StatsBackend                   // 保存原始结果的持久化后端，为 nil 时不保存
+	runID     string                         // 保存到后端的结果所属的运行ID
+	saveErr   error                          // 后端第一次保存失败的原因，之后不再重复提示
+	lost      []*SnapshotRow                 // 全部丢包、不计入汇总的结果，只由汇总协程写入
+}
+
+// storeShard 一个分片：读写锁保护该分片的汇总数据和最近记录
+type storeShard struct {
+	mu          sync.RWMutex
+	summaryData map[summaryKey]*SummaryStatistic // 按目标IP汇总
+	recentStats []recentStat                     // 最近的记录，环形缓冲区，保存副本以便结果被回收复用
+	recentNext  int                              // 下一条记录写入的位置
+	recentLen   int                              // 已保存的记录数
+}
+
+// recentStat 最近记录及其写入序号
+type recentStat struct {
+	seq  uint64
+	stat PingStatistic
 }
 
 // NewPingStatsStore 创建新的数据存储
 func NewPingStatsStore(maxRecent int) *PingStatsStore {
-	return &PingStatsStore{
-		summaryData: make(map[string]*SummaryStatistic),
-		maxRecent:   maxRecent,
+	s := &PingStatsStore{seed: maphash.MakeSeed(), maxRecent: maxRecent, weights: DefaultScoreWeights}
+	for i := range s.shards {
+		s.shards[i].summaryData = make(map[summaryKey]*SummaryStatistic)
+		s.shards[i].recentStats = make([]recentStat, max(maxRecent, 0))
 	}
+	return s
 }
 
-// Add 添加新的Ping统计数据（补充最小/最大RTT平均计算）
+// Add 添加新的Ping统计数据
 func (s *PingStatsStore) Add(stat *PingStatistic) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	seq := s.seq.Add(1)
+	shard := &s.shards[maphash.String(s.seed, stat.DecIp)%storeShards]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 
-	// 更新最近记录（原有逻辑保留）
-	s.recentStats = append(s.recentStats, stat)
-	if len(s.recentStats) > s.maxRecent {
-		s.recentStats = s.recentStats[1:]
+	// 更新最近记录，写满后覆盖最早的一条；每个分片都保留 maxRecent 条，合并后仍是全局最近的记录
+	if s.maxRecent > 0 {
+		shard.recentStats[shard.recentNext] = recentStat{seq: seq, stat: *stat}
+		shard.recentNext = (shard.recentNext + 1) % s.maxRecent
+		shard.recentLen = min(shard.recentLen+1, s.maxRecent)
 	}
+	shard.add(stat)
+}
 
-	// 更新汇总数据
-	key := stat.DecIp
+// add 将结果合并到分片的汇总数据，调用方持有写锁
+func (s *storeShard) add(stat *PingStatistic) {
+	// 更新汇总数据（同一IP可能归属多个地区/运营商，按标签分别汇总）
+	key := statKey(stat)
 	if _, exists := s.summaryData[key]; !exists {
 		s.summaryData[key] = &SummaryStatistic{
 			DestIP:                stat.DecIp,
 			Region:                stat.Region,
 			Isp:                   stat.Isp,
+			Source:                stat.SrcIp,
+			Proto:                 stat.Proto,
+			Tags:                  stat.Tags,
+			Weight:                stat.Weight,
 			MinRtt:                time.Hour, // 初始化为较大值
-			MinRttAvg:             0,         // 初始化最小RTT平均
-			MaxRttAvg:             0,         // 初始化最大RTT平均
 			PacketLoss:            stat.Statistic.PacketLoss,
 			PacketsRecvDuplicates: stat.Statistic.PacketsRecvDuplicates,
 		}
@@ -100,176 +164,434 @@ func (s *PingStatsStore) Add(stat *PingStatistic) {
 	sum := s.summaryData[key]
 	statsData := stat.Statistic
 
-	// 基础统计更新（原有逻辑保留）
+	// 基础统计更新
 	sum.TotalSent += statsData.PacketsSent
 	sum.TotalRecv += statsData.PacketsRecv
 	sum.LastUpdated = time.Now()
+	if stat.Err != "" {
+		// 出错的探测没有收发包和 RTT，只记录原因
+		sum.Error = stat.Err
+		if sum.TotalRecv == 0 {
+			sum.MinRtt = 0
+		}
+		return
+	}
+	if d := stat.Details; d != nil {
+		if d.Timestamps != nil {
+			sum.Timestamps = d.Timestamps
+		}
+		if d.HTTP != nil {
+			sum.HTTPTiming = d.HTTP
+		}
+		if d.DNSAnswers != nil {
+			sum.DNSAnswers = d.DNSAnswers
+		}
+		if d.ECSAnswers != nil {
+			sum.ECSAnswers = d.ECSAnswers
+		}
+		if d.DNSSEC != nil {
+			sum.DNSSEC = d.DNSSEC
+		}
+		if d.PathMTU > 0 {
+			sum.PathMTU = d.PathMTU
+		}
+		if d.TCP != nil {
+			// 建连结果是计数，多次探测累加
+			if sum.TCPOutcomes == nil {
+				sum.TCPOutcomes = &TCPOutcomes{}
+			}
+			sum.TCPOutcomes.add(d.TCP)
+		}
+	}
 
-	// 更新RTT统计（补充最小/最大RTT平均计算）
-	// 1. 最小RTT及平均值
-	if statsData.MinRtt > 0 && statsData.MinRtt < sum.MinRtt {
+	// 最小、最大 RTT 取极值，其余只累加原始值，读取时再计算
+	if statsData.MinRtt > 0 && (sum.MinRtt == 0 || statsData.MinRtt < sum.MinRtt) {
 		sum.MinRtt = statsData.MinRtt
 	}
-	// 计算最小RTT平均：(当前累计平均 * 已统计次数 + 新值) / (已统计次数 + 1)
-	// 这里以"接收包数"作为统计次数（也可根据实际需求用其他维度）
-	if sum.TotalRecv > statsData.PacketsRecv { // 避免首次计算时分母为0
-		sum.MinRttAvg = (sum.MinRttAvg*time.Duration(sum.TotalRecv-statsData.PacketsRecv) + statsData.MinRtt*time.Duration(statsData.PacketsRecv)) / time.Duration(sum.TotalRecv)
-	} else {
-		sum.MinRttAvg = statsData.MinRtt // 首次统计直接赋值
-	}
-	// 2. 最大RTT及平均值
 	if statsData.MaxRtt > sum.MaxRtt {
 		sum.MaxRtt = statsData.MaxRtt
 	}
+	n := float64(statsData.PacketsRecv)
+	avg, stddev := float64(statsData.AvgRtt), float64(statsData.StdDevRtt)
+	sum.rttSum += n * avg
+	sum.rttSumSq += n * (stddev*stddev + avg*avg)
+	sum.minRttSum += n * float64(statsData.MinRtt)
+	sum.maxRttSum += n * float64(statsData.MaxRtt)
+}
+
+// derive 由原始累加值计算平均 RTT、标准差、最小/最大 RTT 的平均和丢包率；没有发包（探测出错）时保留探测给出的丢包率
+func (s *SummaryStatistic) derive() {
+	if s.TotalSent > 0 {
+		s.PacketLoss = float64(s.TotalSent-s.TotalRecv) / float64(s.TotalSent) * 100
+	}
+	if s.TotalRecv == 0 {
+		return
+	}
+	n := float64(s.TotalRecv)
+	mean := s.rttSum / n
+	s.AvgRtt = time.Duration(math.Round(mean))
+	s.StdDevRtt = time.Duration(math.Round(math.Sqrt(max(s.rttSumSq/n-mean*mean, 0))))
+	s.MinRttAvg = time.Duration(math.Round(s.minRttSum / n))
+	s.MaxRttAvg = time.Duration(math.Round(s.maxRttSum / n))
+}
+
+// summaryKey 汇总数据的键：目标IP + 运营商 + 地区 + 源IP + 协议标签，用结构体作键避免每条结果拼接一次字符串
+type summaryKey struct {
+	destIP, isp, region, source, proto string
+}
+
+func (k summaryKey) String() string {
+	s := k.destIP + "|" + k.isp + "|" + k.region + "|" + k.source
+	if k.proto != "" {
+		s += "|" + k.proto
+	}
+	return s
+}
+
+func statKey(stat *PingStatistic) summaryKey {
+	return summaryKey{destIP: stat.DecIp, isp: stat.Isp, region: stat.Region, source: stat.SrcIp, proto: stat.Proto}
+}
 
-	// 计算最大RTT平均（同最小RTT平均逻辑）
-	if sum.TotalRecv > statsData.PacketsRecv {
-		sum.MaxRttAvg = (sum.MaxRttAvg*time.Duration(sum.TotalRecv-statsData.PacketsRecv) + statsData.MaxRtt*time.Duration(statsData.PacketsRecv)) / time.Duration(sum.TotalRecv)
-	} else {
-		sum.MaxRttAvg = statsData.MaxRtt // 首次统计直接赋值
+// summarySources 按出现顺序返回结果中的源IP，是否为多源探测由 multiSource 判断
+func summarySources(list []*SummaryStatistic) []string {
+	var sources []string
+	seen := make(map[string]bool)
+	for _, sum := range list {
+		if !seen[sum.Source] {
+			seen[sum.Source] = true
+			sources = append(sources, sum.Source)
+		}
 	}
+	return sources
+}
+
+// multiSource 是否为多源探测（-eth eth0,eth1）：同一目标有多个源IP的结果；
+// -src4/-src6 时 IPv4 和 IPv6 目标的源IP不同，但每个目标只有一个源，不算多源
+func multiSource(list []*SummaryStatistic) bool {
+	first := make(map[string]string)
+	for _, sum := range list {
+		key := sum.DestIP + "|" + sum.Proto
+		src, ok := first[key]
+		if !ok {
+			first[key] = sum.Source
+		} else if src != sum.Source {
+			return true
+		}
+	}
+	return false
+}
 
-	// 3. 原有平均RTT计算（保留）
-	if sum.TotalRecv > 0 {
-		sum.AvgRtt = (sum.AvgRtt*time.Duration(sum.TotalRecv-statsData.PacketsRecv) +
-			statsData.AvgRtt*time.Duration(statsData.PacketsRecv)) /
-			time.Duration(sum.TotalRecv)
+// resultProtocols 返回多协议探测的各协议标签：优先使用运行参数中的顺序，某个协议全部无应答时也保留其列
+func resultProtocols(result *RunResult) []string {
+	if result.Snapshot != nil {
+		// 只有部分目标单独指定了探测方式时不是多协议探测，结果逐行显示
+		return result.Snapshot.Protocols
 	}
+	return summaryProtocols(result.Grouped)
+}
+
+// summaryProtocols 按出现顺序返回结果中的协议标签，多于一个时为多协议探测
+func summaryProtocols(list []*SummaryStatistic) []string {
+	var protocols []string
+	seen := make(map[string]bool)
+	for _, sum := range list {
+		if !seen[sum.Proto] {
+			seen[sum.Proto] = true
+			protocols = append(protocols, sum.Proto)
+		}
+	}
+	return protocols
+}
+
+// summaryHasProto 结果中是否有带协议标签的行，有时表格追加协议列
+func summaryHasProto(list []*SummaryStatistic) bool {
+	return slices.ContainsFunc(list, func(sum *SummaryStatistic) bool { return sum.Proto != "" })
+}
+
+// summaryHasGroup 结果中是否有按 -group-by 分组的行
+func summaryHasGroup(list []*SummaryStatistic) bool {
+	return slices.ContainsFunc(list, func(sum *SummaryStatistic) bool { return sum.Group != "" })
+}
+
+// summaryHasLossStreak 结果中是否有连续丢包的记录（持续探测）
+func summaryHasLossStreak(list []*SummaryStatistic) bool {
+	return slices.ContainsFunc(list, func(sum *SummaryStatistic) bool { return sum.LossStreak != nil })
+}
+
+// groupKey 分组汇总使用的组名：指定了 -group-by 时为模板结果，否则为运营商
+func (s *SummaryStatistic) groupKey() string {
+	if s.Group != "" {
+		return s.Group
+	}
+	return s.Isp
+}
+
+// summaryHasError 结果中是否有探测出错的行，有时表格追加错误列
+func summaryHasError(list []*SummaryStatistic) bool {
+	return slices.ContainsFunc(list, func(sum *SummaryStatistic) bool { return sum.Error != "" })
 }
 
 // GetRecent 获取最近的记录
 func (s *PingStatsStore) GetRecent() []*PingStatistic {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	var all []recentStat
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.RLock()
+		start := shard.recentNext - shard.recentLen + s.maxRecent
+		for j := 0; j < shard.recentLen; j++ {
+			all = append(all, shard.recentStats[(start+j)%s.maxRecent])
+		}
+		shard.mu.RUnlock()
+	}
 
-	// 返回副本避免外部修改
-	recent := make([]*PingStatistic, len(s.recentStats))
-	copy(recent, s.recentStats)
+	// 按写入先后合并各分片，保留最近的 maxRecent 条，返回副本避免外部修改
+	sort.Slice(all, func(i, j int) bool { return all[i].seq < all[j].seq })
+	all = all[max(len(all)-s.maxRecent, 0):]
+	recent := make([]*PingStatistic, len(all))
+	for i := range all {
+		recent[i] = &all[i].stat
+	}
 	return recent
 }
 
-// GetSummary 获取汇总数据（补充MinRttAvg和MaxRttAvg的复制）
-func (s *PingStatsStore) GetSummary() map[string]*SummaryStatistic {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// snapshot 逐个分片复制汇总数据：锁内只把各条汇总按值复制到锁外预先分配的缓冲区，派生值、评分、分组模板等
+// 耗时的计算和 visit 都在锁外进行；各分片分别加读锁，复制期间只阻塞该分片的写入，且不在锁内逐条分配内存
+func (s *PingStatsStore) snapshot(visit func(key summaryKey, sum *SummaryStatistic)) {
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.RLock()
+		n := len(shard.summaryData)
+		shard.mu.RUnlock()
+		if n == 0 {
+			continue
+		}
+		// 两次加锁之间可能有新目标写入，多留一些余量，超出时 append 扩容
+		copies := make([]SummaryStatistic, 0, n+n/8+1)
+		var outcomes []TCPOutcomes
 
-	summary := make(map[string]*SummaryStatistic)
-	for k, v := range s.summaryData {
-		summary[k] = &SummaryStatistic{
-			DestIP:                v.DestIP,
-			Region:                v.Region,
-			Isp:                   v.Isp,
-			TotalSent:             v.TotalSent,
-			TotalRecv:             v.TotalRecv,
-			MinRtt:                v.MinRtt,
-			MaxRtt:                v.MaxRtt,
-			AvgRtt:                v.AvgRtt,
-			MinRttAvg:             v.MinRttAvg, // 补充复制最小RTT平均
-			MaxRttAvg:             v.MaxRttAvg, // 补充复制最大RTT平均
-			LastUpdated:           v.LastUpdated,
-			PacketLoss:            v.PacketLoss,
-			PacketsRecvDuplicates: v.PacketsRecvDuplicates,
+		shard.mu.RLock()
+		for _, v := range shard.summaryData {
+			copies = append(copies, *v)
+			if v.TCPOutcomes != nil {
+				// 计数会在后续探测中累加，副本不能共享；只有 TCP 探测有该计数，用到时才分配
+				if outcomes == nil {
+					outcomes = make([]TCPOutcomes, 0, cap(copies))
+				}
+				outcomes = append(outcomes, *v.TCPOutcomes)
+			}
+		}
+		shard.mu.RUnlock()
+
+		o := 0
+		for j := range copies {
+			c := &copies[j]
+			if c.TCPOutcomes != nil {
+				c.TCPOutcomes = &outcomes[o]
+				o++
+			}
+			c.derive()
+			c.Score = s.weights.score(c)
+			if s.groupBy != nil {
+				c.Group = groupOf(s.groupBy, c)
+			}
+			key := summaryKey{destIP: c.DestIP, isp: c.Isp, region: c.Region, source: c.Source, proto: c.Proto}
+			c.LossStreak = s.streaks.get(key)
+			c.Previous = s.previous[key]
+			visit(key, c)
 		}
 	}
+}
+
+// SetScoreWeights 设置综合评分的权重，需在读取汇总数据之前调用
+func (s *PingStatsStore) SetScoreWeights(w ScoreWeights) {
+	s.weights = w
+}
+
+// SetGroupBy 设置分组模板，需在读取汇总数据之前调用
+func (s *PingStatsStore) SetGroupBy(t *template.Template) {
+	s.groupBy = t
+}
+
+// SetLossStreaks 设置跨轮累计连续丢包的记录，需在写入本轮结果之前调用
+func (s *PingStatsStore) SetLossStreaks(l *LossStreaks) {
+	s.streaks = l
+}
+
+// SetPrevious 设置上次运行的结果，读取汇总数据时每行附带同一目标上次的丢包率和平均 RTT；prev 为 nil 时不对比
+func (s *PingStatsStore) SetPrevious(prev *Snapshot) {
+	s.previous = previousResults(prev)
+}
+
+// SetBackend 设置保存原始结果的持久化后端，需在写入结果之前调用；b 为 nil 时不保存
+func (s *PingStatsStore) SetBackend(b StatsBackend, runID string) {
+	s.backend, s.runID = b, runID
+}
+
+// save 把一条原始结果交给持久化后端，只在汇总协程中调用；失败只提示一次，不影响内存中的汇总
+func (s *PingStatsStore) save(stat *PingStatistic) {
+	if s.backend == nil || s.saveErr != nil {
+		return
+	}
+	if s.saveErr = s.backend.Save(storedResult(s.runID, stat)); s.saveErr != nil {
+		log.Printf("⚠️  保存结果失败，本轮其余结果不再保存: %v\n", s.saveErr)
+	}
+}
+
+// addLost 记录一条全部丢包、不计入汇总的结果
+func (s *PingStatsStore) addLost(stat *PingStatistic) {
+	s.lost = append(s.lost, &SnapshotRow{DestIP: stat.DecIp, Region: stat.Region, Isp: stat.Isp, Source: stat.SrcIp,
+		Proto: stat.Proto, Tags: stat.Tags, Weight: stat.Weight, Sent: stat.Statistic.PacketsSent, LossPercent: 100,
+		UpdatedAt: time.Now()})
+}
+
+// lostRows 返回全部丢包的目标，按目标IP排序
+func (s *PingStatsStore) lostRows() []*SnapshotRow {
+	slices.SortStableFunc(s.lost, func(a, b *SnapshotRow) int { return strings.Compare(a.DestIP, b.DestIP) })
+	return s.lost
+}
+
+// flush 本轮结果全部汇总后让持久化后端落盘或发送
+func (s *PingStatsStore) flush() error {
+	if s.backend == nil {
+		return nil
+	}
+	return s.backend.Flush()
+}
+
+// size 汇总数据的条数
+func (s *PingStatsStore) size() int {
+	n := 0
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.RLock()
+		n += len(shard.summaryData)
+		shard.mu.RUnlock()
+	}
+	return n
+}
+
+// GetSummary 获取汇总数据（补充MinRttAvg和MaxRttAvg的复制）
+func (s *PingStatsStore) GetSummary() map[string]*SummaryStatistic {
+	summary := make(map[string]*SummaryStatistic, s.size())
+	s.snapshot(func(k summaryKey, v *SummaryStatistic) {
+		summary[k.String()] = v
+	})
 	return summary
 }
 
-// GetSummarySorted 返回按指定字段排序的列表
+// GetSummarySorted 返回按指定字段排序的列表，排序在锁外进行
 func (s *PingStatsStore) GetSummarySorted(field string, descending bool) []*SummaryStatistic {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	// 拍平成 slice，按目标数预分配
+	statsList := make([]*SummaryStatistic, 0, s.size())
+	s.snapshot(func(_ summaryKey, v *SummaryStatistic) {
+		statsList = append(statsList, v)
+	})
 
-	// 拍平成 slice
-	var statsList []*SummaryStatistic
-	for _, v := range s.summaryData {
-		statsList = append(statsList, &SummaryStatistic{
-			DestIP:                v.DestIP,
-			Region:                v.Region,
-			Isp:                   v.Isp,
-			TotalSent:             v.TotalSent,
-			TotalRecv:             v.TotalRecv,
-			MinRtt:                v.MinRtt,
-			MaxRtt:                v.MaxRtt,
-			AvgRtt:                v.AvgRtt,
-			MinRttAvg:             v.MinRttAvg,
-			MaxRttAvg:             v.MaxRttAvg,
-			LastUpdated:           v.LastUpdated,
-			PacketLoss:            v.PacketLoss,
-			PacketsRecvDuplicates: v.PacketsRecvDuplicates,
-		})
-	}
+	sortSummaries(statsList, field, descending)
+	return statsList
+}
 
-	// 排序逻辑
+// sortSummaries 按指定字段（见 SortFields）原地排序；字段相同的结果按 IP、地区、运营商、源排列，连续多次运行的顺序一致；
+// 探测出错的结果没有测量值，无论升序降序都排在最后
+func sortSummaries(statsList []*SummaryStatistic, field string, descending bool) {
+	less := summaryLess(field)
 	sort.Slice(statsList, func(i, j int) bool {
-		var less bool
-		switch field {
-		case "minrtt":
-			less = statsList[i].MinRtt < statsList[j].MinRtt
-		case "maxrtt":
-			less = statsList[i].MaxRtt < statsList[j].MaxRtt
-		case "avgrtt":
-			less = statsList[i].AvgRtt < statsList[j].AvgRtt
-		default:
-			less = statsList[i].PacketLoss < statsList[j].PacketLoss // 默认按丢包
+		a, b := statsList[i], statsList[j]
+		if (a.Error == "") != (b.Error == "") {
+			return a.Error == ""
 		}
 		if descending {
-			return !less
+			a, b = b, a
 		}
-		return less
+		switch {
+		case less(a, b):
+			return true
+		case less(b, a):
+			return false
+		}
+		return summaryTieLess(statsList[i], statsList[j])
 	})
+}
 
-	return statsList
+// summaryLess 返回按排序字段比较两条汇总结果的函数，明细、分组和丢包三种排序共用同一套字段
+func summaryLess(field string) func(a, b *SummaryStatistic) bool {
+	switch field {
+	case "minrtt":
+		return func(a, b *SummaryStatistic) bool { return a.MinRtt < b.MinRtt }
+	case "maxrtt":
+		return func(a, b *SummaryStatistic) bool { return a.MaxRtt < b.MaxRtt }
+	case "avgrtt", "rtt":
+		return func(a, b *SummaryStatistic) bool { return a.AvgRtt < b.AvgRtt }
+	case "sent":
+		return func(a, b *SummaryStatistic) bool { return a.TotalSent < b.TotalSent }
+	case "recv":
+		return func(a, b *SummaryStatistic) bool { return a.TotalRecv < b.TotalRecv }
+	case "score":
+		return func(a, b *SummaryStatistic) bool { return a.Score < b.Score }
+	case "region":
+		return func(a, b *SummaryStatistic) bool { return a.Region < b.Region }
+	case "ip":
+		return func(a, b *SummaryStatistic) bool { return ipLess(a.DestIP, b.DestIP) }
+	case "updated":
+		return func(a, b *SummaryStatistic) bool { return a.LastUpdated.Before(b.LastUpdated) }
+	default:
+		return func(a, b *SummaryStatistic) bool { return a.PacketLoss < b.PacketLoss } // 默认按丢包
+	}
+}
+
+// summaryTieLess 排序字段相同时的固定顺序
+func summaryTieLess(a, b *SummaryStatistic) bool {
+	if a.DestIP != b.DestIP {
+		return a.DestIP < b.DestIP
+	}
+	if a.Region != b.Region {
+		return a.Region < b.Region
+	}
+	if a.Isp != b.Isp {
+		return a.Isp < b.Isp
+	}
+	if a.Source != b.Source {
+		return a.Source < b.Source
+	}
+	return a.Proto < b.Proto
+}
+
+// ipLess 按数值比较 IP（10.0.0.9 在 10.0.0.10 之前），IPv4 在 IPv6 之前，无法解析的（域名）排在 IP 之后按字符串比较
+func ipLess(a, b string) bool {
+	ipA, errA := netip.ParseAddr(a)
+	ipB, errB := netip.ParseAddr(b)
+	switch {
+	case errA != nil && errB != nil:
+		return a < b
+	case errA != nil || errB != nil:
+		return errA == nil
+	}
+	return ipA.Unmap().Less(ipB.Unmap())
 }
 
-// GetSummarySortedGroupedByIsp  根据 ISP 分组聚合，并按指定字段排序（loss/rtt/sent/recv）
+// GetSummarySortedGroupedByIsp  根据 ISP（指定了 -group-by 时按模板得到的分组）分组聚合，各组按名称排列，组内按指定字段排序（见 SortFields）
 func (s *PingStatsStore) GetSummarySortedGroupedByIsp(field string, descending bool) []*SummaryStatistic {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	list := make([]*SummaryStatistic, 0, s.size())
+	s.snapshot(func(_ summaryKey, v *SummaryStatistic) {
+		list = append(list, v)
+	})
+	return groupSummaries(list, field, descending)
+}
 
+// groupSummaries 按 ISP（或 -group-by 的分组）分组，各组按名称排列，组内按指定字段排序
+func groupSummaries(list []*SummaryStatistic, field string, descending bool) []*SummaryStatistic {
 	// 先按 ISP 分组
 	grouped := make(map[string][]*SummaryStatistic)
-	for _, v := range s.summaryData {
-		// 直接引用原始对象，保持完整信息
-		grouped[v.Isp] = append(grouped[v.Isp], &SummaryStatistic{
-			DestIP:                v.DestIP,
-			Region:                v.Region,
-			Isp:                   v.Isp,
-			TotalSent:             v.TotalSent,
-			TotalRecv:             v.TotalRecv,
-			MinRtt:                v.MinRtt,
-			MaxRtt:                v.MaxRtt,
-			AvgRtt:                v.AvgRtt,
-			MinRttAvg:             v.MinRttAvg,
-			MaxRttAvg:             v.MaxRttAvg,
-			LastUpdated:           v.LastUpdated,
-			PacketLoss:            v.PacketLoss,
-			PacketsRecvDuplicates: v.PacketsRecvDuplicates,
-		})
+	for _, v := range list {
+		grouped[v.groupKey()] = append(grouped[v.groupKey()], v)
 	}
 
-	var result []*SummaryStatistic
+	result := make([]*SummaryStatistic, 0, len(list))
 
 	// 对每个 ISP 内部做排序
-	for _, list := range grouped {
-		sort.Slice(list, func(i, j int) bool {
-			var less bool
-			switch field {
-			case "loss":
-				less = list[i].PacketLoss < list[j].PacketLoss
-			case "rtt":
-				less = list[i].AvgRtt < list[j].AvgRtt
-			case "sent":
-				less = list[i].TotalSent < list[j].TotalSent
-			case "recv":
-				less = list[i].TotalRecv < list[j].TotalRecv
-			default:
-				less = list[i].PacketLoss < list[j].PacketLoss
-			}
-			if descending {
-				return !less
-			}
-			return less
-		})
+	for _, key := range slices.Sorted(maps.Keys(grouped)) {
+		list := grouped[key]
+		sortSummaries(list, field, descending)
 
 		// 按原样拼接回总结果
 		result = append(result, list...)
@@ -279,7 +601,11 @@ func (s *PingStatsStore) GetSummarySortedGroupedByIsp(field string, descending b
 
 // GetLossOnlyGroupedByIspSorted 返回按 ISP 分组并排序后的丢包率不为 0 的数据
 func (s *PingStatsStore) GetLossOnlyGroupedByIspSorted(sum []*SummaryStatistic, field string, descending bool) []*SummaryStatistic {
+	return lossOnlySummaries(sum, field, descending)
+}
 
+// lossOnlySummaries 返回丢包率不为 0 的结果，按指定字段排序
+func lossOnlySummaries(sum []*SummaryStatistic, field string, descending bool) []*SummaryStatistic {
 	var lossOnly []*SummaryStatistic
 	for _, v := range sum {
 		if v.PacketLoss > 0 {
@@ -287,146 +613,11 @@ func (s *PingStatsStore) GetLossOnlyGroupedByIspSorted(sum []*SummaryStatistic,
 		}
 	}
 
-	// 排序
-	sort.Slice(lossOnly, func(i, j int) bool {
-		var less bool
-		switch field {
-		case "rtt":
-			less = lossOnly[i].AvgRtt < lossOnly[j].AvgRtt
-		case "sent":
-			less = lossOnly[i].TotalSent < lossOnly[j].TotalSent
-		case "recv":
-			less = lossOnly[i].TotalRecv < lossOnly[j].TotalRecv
-		default:
-			less = lossOnly[i].PacketLoss < lossOnly[j].PacketLoss // 默认按丢包
-		}
-		if descending {
-			return !less
-		}
-		return less
-	})
+	sortSummaries(lossOnly, field, descending)
 
 	return lossOnly
 }
 
-// 打印排序后结果
-func printSummaryList(summaryList []*SummaryStatistic) {
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{
-		"目标IP", "地区", "运营商",
-		"发", "收", "丢包%", "重传",
-		"MinRTT", "MaxRTT", "AvgRTT", "更新时间",
-	})
-	table.SetAutoFormatHeaders(false)
-	table.SetAlignment(tablewriter.ALIGN_LEFT)
-	table.SetBorder(false)
-	table.SetRowLine(false)
-	table.SetColumnSeparator(" ")
-	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
-
-	formatDuration := func(d time.Duration) string {
-		ms := float64(d) / float64(time.Millisecond)
-		return fmt.Sprintf("%.1fms", ms)
-	}
-
-	// ANSI 颜色码
-	green := "\x1b[32m"
-	yellow := "\x1b[33m"
-	red := "\x1b[31m"
-	reset := "\x1b[0m"
-	blue := "\033[38;2;0;180;255m"
-	purple := "\033[38;2;144;86;255m"
-	green2 := "\033[38;2;57;255;20m"
-
-	colorForPacketLoss := func(loss float64) string {
-		switch {
-		case loss < 5.0:
-			return green
-		case loss < 10.0:
-			return yellow
-		default:
-			return red
-		}
-	}
-
-	colorForISP := func(isp string) string {
-		switch {
-		case isp == "联通":
-			return blue
-		case isp == "移动":
-			return purple
-		case isp == "电信":
-			return green2
-		default:
-			return blue
-		}
-	}
-	totalSent, totalRecv := 0, 0
-	totalLoss := 0.0
-	totalDuplicates := 0
-	rttCount := 0
-	globalMinRtt := time.Duration(0)
-	globalMaxRtt := time.Duration(0)
-	globalAvgRtt := time.Duration(0)
-
-	for _, sum := range summaryList {
-		totalSent += sum.TotalSent
-		totalRecv += sum.TotalRecv
-		totalLoss += sum.PacketLoss
-		totalDuplicates += sum.PacketsRecvDuplicates
-		rttCount += sum.TotalRecv
-
-		globalMinRtt += sum.MinRtt * time.Duration(sum.TotalRecv)
-		globalMaxRtt += sum.MaxRtt * time.Duration(sum.TotalRecv)
-		globalAvgRtt += sum.AvgRtt * time.Duration(sum.TotalRecv)
-
-		ispColor := colorForISP(sum.Isp)
-		coloredIsp := fmt.Sprintf("%s%s%s", ispColor, sum.Isp, reset)
-		lossColor := colorForPacketLoss(sum.PacketLoss)
-		lossStr := fmt.Sprintf("%.1f%%", sum.PacketLoss)
-		lossColored := fmt.Sprintf("%s%s%s", lossColor, lossStr, reset)
-
-		table.Append([]string{
-			sum.DestIP,
-			sum.Region,
-			coloredIsp,
-			fmt.Sprintf("%d", sum.TotalSent),
-			fmt.Sprintf("%d", sum.TotalRecv),
-			lossColored,
-			fmt.Sprintf("%d", sum.PacketsRecvDuplicates),
-			formatDuration(sum.MinRtt),
-			formatDuration(sum.MaxRtt),
-			formatDuration(sum.AvgRtt),
-			sum.LastUpdated.Format("15:04:05"),
-		})
-	}
-
-	var avgLoss float64
-	if len(summaryList) > 0 {
-		avgLoss = totalLoss / float64(len(summaryList))
-	}
-
-	if rttCount > 0 {
-		globalMinRtt /= time.Duration(rttCount)
-		globalMaxRtt /= time.Duration(rttCount)
-		globalAvgRtt /= time.Duration(rttCount)
-	}
-
-	table.SetFooter([]string{
-		"", "", "总计",
-		fmt.Sprintf("%d", totalSent),
-		fmt.Sprintf("%d", totalRecv),
-		fmt.Sprintf("%.1f%%", avgLoss),
-		fmt.Sprintf("%d", totalDuplicates),
-		formatDuration(globalMinRtt),
-		formatDuration(globalMaxRtt),
-		formatDuration(globalAvgRtt),
-		"",
-	})
-
-	table.Render()
-}
-
 var JsonData string = `{
     "电信": {
         "北京": {
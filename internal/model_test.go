@@ -0,0 +1,228 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+func TestPingStatsStoreConcurrent(t *testing.T) {
+	const producers, perProducer, targets = 50, 200, 100
+	store := internal.NewPingStatsStore(25)
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				ip := fmt.Sprintf("10.0.0.%d", (p*perProducer+i)%targets)
+				store.Add(&internal.PingStatistic{DecIp: ip, Isp: "电信", Region: "北京",
+					Statistic: &ping.Statistics{PacketsSent: 3, PacketsRecv: 3}})
+			}
+			// 生产者写入的同时读取，模拟交互界面刷新
+			store.GetSummarySorted("loss", false)
+		}(p)
+	}
+	wg.Wait()
+
+	list := store.GetSummarySorted("loss", false)
+	if len(list) != targets {
+		t.Fatalf("汇总目标数为 %d，期望 %d", len(list), targets)
+	}
+	for _, sum := range list {
+		if want := 3 * producers * perProducer / targets; sum.TotalSent != want {
+			t.Errorf("%s 发包 %d，期望 %d", sum.DestIP, sum.TotalSent, want)
+		}
+	}
+
+	// 最近记录按写入先后合并各分片
+	store = internal.NewPingStatsStore(5)
+	for i := 0; i < 20; i++ {
+		store.Add(&internal.PingStatistic{DecIp: fmt.Sprintf("10.0.1.%d", i), Statistic: &ping.Statistics{}})
+	}
+	var got []string
+	for _, stat := range store.GetRecent() {
+		got = append(got, stat.DecIp)
+	}
+	if want := "[10.0.1.15 10.0.1.16 10.0.1.17 10.0.1.18 10.0.1.19]"; fmt.Sprint(got) != want {
+		t.Errorf("最近记录为 %v，期望 %s", got, want)
+	}
+}
+
+func TestSortByRegionAndIP(t *testing.T) {
+	store := internal.NewPingStatsStore(25)
+	for _, target := range []struct{ ip, region string }{
+		{"10.0.0.10", "北京"}, {"10.0.0.9", "上海"}, {"9.9.9.9", "北京"}, {"dns.example", "上海"}, {"2001:db8::1", "广东"},
+	} {
+		store.Add(&internal.PingStatistic{DecIp: target.ip, Isp: "电信", Region: target.region, Statistic: &ping.Statistics{PacketsSent: 3, PacketsRecv: 3}})
+	}
+	order := func(field string, des bool) string {
+		var ips []string
+		for _, sum := range store.GetSummarySorted(field, des) {
+			ips = append(ips, sum.DestIP)
+		}
+		return fmt.Sprint(ips)
+	}
+	// IP 按数值排序，IPv4 在 IPv6 之前，域名最后
+	if got, want := order("ip", false), "[9.9.9.9 10.0.0.9 10.0.0.10 2001:db8::1 dns.example]"; got != want {
+		t.Errorf("按 IP 排序为 %s，应为 %s", got, want)
+	}
+	// 同一地区内按 IP 字符串固定顺序，降序不影响同地区内的顺序
+	if got, want := order("region", false), "[10.0.0.9 dns.example 10.0.0.10 9.9.9.9 2001:db8::1]"; got != want {
+		t.Errorf("按地区排序为 %s，应为 %s", got, want)
+	}
+	if got, want := order("region", true), "[2001:db8::1 10.0.0.10 9.9.9.9 10.0.0.9 dns.example]"; got != want {
+		t.Errorf("按地区降序为 %s，应为 %s", got, want)
+	}
+	// 丢包率全部相同时顺序固定
+	if first, second := order("loss", false), order("loss", false); first != second {
+		t.Errorf("相同丢包率的排序不固定: %s / %s", first, second)
+	}
+}
+
+func TestLossStreaks(t *testing.T) {
+	streaks := internal.NewLossStreaks()
+	// 各轮的丢包率：第 3 轮全部丢包，不进入汇总，但计入连续丢包
+	rounds := []float64{0, 50, 100, 50, 0}
+	want := []*internal.LossStreak{{}, {Current: 1, Longest: 1}, nil, {Current: 3, Longest: 3}, {Current: 0, Longest: 3}}
+	for i, loss := range rounds {
+		store := internal.NewPingStatsStore(25)
+		store.SetLossStreaks(streaks)
+		ch := make(chan *internal.PingStatistic)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go internal.HandleDPing(ch, store, &wg, "loss", false)
+		recv := int(float64(4) * (100 - loss) / 100)
+		ch <- &internal.PingStatistic{DecIp: "10.0.0.1", Isp: "电信", Region: "北京",
+			Statistic: &ping.Statistics{PacketsSent: 4, PacketsRecv: recv, PacketLoss: loss}}
+		close(ch)
+		wg.Wait()
+
+		list := store.GetSummarySorted("loss", false)
+		if want[i] == nil {
+			if len(list) != 0 {
+				t.Errorf("第 %d 轮全部丢包，不应有汇总结果: %+v", i+1, list[0])
+			}
+			continue
+		}
+		if len(list) != 1 {
+			t.Fatalf("第 %d 轮的汇总结果有 %d 条，期望 1 条", i+1, len(list))
+		}
+		if list[0].LossStreak == nil || *list[0].LossStreak != *want[i] {
+			t.Errorf("第 %d 轮的连续丢包为 %+v，期望 %+v", i+1, list[0].LossStreak, want[i])
+		}
+	}
+}
+
+func TestSummaryFromRawCounters(t *testing.T) {
+	// 多次探测合并后的平均值和标准差应与全部 RTT 直接计算的结果一致，与合并顺序、次数无关
+	rounds := [][]time.Duration{
+		{10 * time.Millisecond, 12 * time.Millisecond, 11 * time.Millisecond},
+		{30 * time.Millisecond},
+		{7 * time.Millisecond, 9 * time.Millisecond},
+	}
+	store := internal.NewPingStatsStore(0)
+	var all []float64
+	for i := 0; i < 100; i++ {
+		rtts := rounds[i%len(rounds)]
+		var sum, sumSq float64
+		minRtt, maxRtt := rtts[0], rtts[0]
+		for _, rtt := range rtts {
+			sum += float64(rtt)
+			sumSq += float64(rtt) * float64(rtt)
+			minRtt, maxRtt = min(minRtt, rtt), max(maxRtt, rtt)
+			all = append(all, float64(rtt))
+		}
+		n := float64(len(rtts))
+		avg := sum / n
+		store.Add(&internal.PingStatistic{DecIp: "10.0.0.1", Isp: "电信", Region: "北京", Statistic: &ping.Statistics{
+			PacketsSent: len(rtts) + 1, PacketsRecv: len(rtts), MinRtt: minRtt, MaxRtt: maxRtt,
+			AvgRtt: time.Duration(avg), StdDevRtt: time.Duration(math.Sqrt(sumSq/n - avg*avg)),
+		}})
+	}
+	var mean, variance float64
+	for _, rtt := range all {
+		mean += rtt / float64(len(all))
+	}
+	for _, rtt := range all {
+		variance += (rtt - mean) * (rtt - mean) / float64(len(all))
+	}
+
+	sum := store.GetSummarySorted("loss", false)[0]
+	if math.Abs(float64(sum.AvgRtt)-mean) > 1 || math.Abs(float64(sum.StdDevRtt)-math.Sqrt(variance)) > 1000 {
+		t.Errorf("平均 RTT %s、标准差 %s，应为 %s、%s", sum.AvgRtt, sum.StdDevRtt, time.Duration(mean), time.Duration(math.Sqrt(variance)))
+	}
+	if want := float64(sum.TotalSent-sum.TotalRecv) / float64(sum.TotalSent) * 100; sum.PacketLoss != want || sum.TotalRecv != len(all) {
+		t.Errorf("丢包率 %.2f%%，应为 %.2f%%（收包 %d，应为 %d）", sum.PacketLoss, want, sum.TotalRecv, len(all))
+	}
+	if sum.MinRtt != 7*time.Millisecond || sum.MaxRtt != 30*time.Millisecond {
+		t.Errorf("最小、最大 RTT 为 %s、%s，应为 7ms、30ms", sum.MinRtt, sum.MaxRtt)
+	}
+	// 多次读取结果相同，读取不改变存储中的累加值
+	if again := store.GetSummarySorted("loss", false)[0]; again.AvgRtt != sum.AvgRtt || again.StdDevRtt != sum.StdDevRtt {
+		t.Errorf("再次读取得到 %s/%s，第一次为 %s/%s", again.AvgRtt, again.StdDevRtt, sum.AvgRtt, sum.StdDevRtt)
+	}
+}
+
+func TestSummaryCopiesIndependent(t *testing.T) {
+	// 只有部分目标带 TCP 建连计数，读取的每一行应拿到自己的计数，且之后的写入不影响已读取的结果
+	store := internal.NewPingStatsStore(0)
+	add := func(i int) {
+		stat := &internal.PingStatistic{DecIp: fmt.Sprintf("10.0.0.%d", i), Isp: "电信", Region: "北京",
+			Statistic: &ping.Statistics{PacketsSent: 1, PacketsRecv: 1}}
+		if i%2 == 1 {
+			stat.Details = &internal.ProbeDetails{TCP: &internal.TCPOutcomes{Connected: i}}
+		}
+		store.Add(stat)
+	}
+	for i := range 200 {
+		add(i)
+	}
+	list := store.GetSummarySorted("loss", false)
+	for i := range 200 {
+		add(i)
+	}
+	for _, sum := range list {
+		var i int
+		fmt.Sscanf(sum.DestIP, "10.0.0.%d", &i)
+		switch {
+		case sum.TotalSent != 1:
+			t.Errorf("%s 已读取的发包数变为 %d", sum.DestIP, sum.TotalSent)
+		case i%2 == 0 && sum.TCPOutcomes != nil:
+			t.Errorf("%s 不应有建连计数: %+v", sum.DestIP, sum.TCPOutcomes)
+		case i%2 == 1 && (sum.TCPOutcomes == nil || sum.TCPOutcomes.Connected != i):
+			t.Errorf("%s 的建连计数应为 %d: %+v", sum.DestIP, i, sum.TCPOutcomes)
+		}
+	}
+	for _, sum := range store.GetSummarySorted("loss", false) {
+		if sum.TotalSent != 2 {
+			t.Errorf("%s 再次读取的发包数应为 2，实际 %d", sum.DestIP, sum.TotalSent)
+		}
+	}
+}
+
+func TestHandleDPingKeepsCallerStats(t *testing.T) {
+	store := internal.NewPingStatsStore(25)
+	ch := make(chan *internal.PingStatistic)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go internal.HandleDPing(ch, store, &wg, "loss", false)
+	stats := &ping.Statistics{PacketsSent: 4, PacketsRecv: 4, AvgRtt: 10 * time.Millisecond}
+	stat := &internal.PingStatistic{DecIp: "10.0.0.1", Isp: "电信", Region: "北京", Statistic: stats}
+	ch <- stat
+	close(ch)
+	wg.Wait()
+
+	// 调用方自己构造的结果汇总后仍归调用方所有，不会被清零回收
+	if stat.DecIp != "10.0.0.1" || stat.Isp != "电信" || stat.Region != "北京" || stat.Statistic != stats {
+		t.Errorf("汇总后调用方的结果被改动: %+v", stat)
+	}
+	if list := store.GetSummarySorted("loss", false); len(list) != 1 || list[0].DestIP != "10.0.0.1" {
+		t.Errorf("汇总结果应有一条 10.0.0.1，实际为 %+v", list)
+	}
+}
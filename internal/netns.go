@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-ping/ping"
+	"golang.org/x/net/proxy"
+)
+
+// netnsPath 网络命名空间的文件：名称为 ip netns 创建的命名空间，含 / 时为路径，如 /proc/1234/ns/net
+func netnsPath(name string) string {
+	if strings.Contains(name, "/") {
+		return name
+	}
+	return filepath.Join("/var/run/netns", name)
+}
+
+// netnsProber 在网络命名空间中执行被包装 Prober 的探测（-netns）
+type netnsProber struct {
+	Prober
+	netns string
+}
+
+func (p *netnsProber) Probe(to net.IP, sourceIP net.IP, count int, adaptive AdaptiveOptions) (*ping.Statistics, error) {
+	var stats *ping.Statistics
+	err := inNetns(p.netns, func() error {
+		var err error
+		stats, err = p.Prober.Probe(to, sourceIP, count, adaptive)
+		return err
+	})
+	return stats, err
+}
+
+// Details 透传被包装 Prober 的附加结果
+func (p *netnsProber) Details(to net.IP, sourceIP net.IP) *ProbeDetails {
+	if ds, ok := p.Prober.(detailSource); ok {
+		return ds.Details(to, sourceIP)
+	}
+	return nil
+}
+
+// netnsDialer 在网络命名空间中建立连接；http.Transport 在单独的 goroutine 中拨号，不在 netnsProber 切换的线程上
+type netnsDialer struct {
+	proxy.ContextDialer
+	netns string
+}
+
+func (d netnsDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var conn net.Conn
+	err := inNetns(d.netns, func() error {
+		var err error
+		conn, err = d.ContextDialer.DialContext(ctx, network, addr)
+		return err
+	})
+	return conn, err
+}
@@ -0,0 +1,35 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// inNetns 在网络命名空间 name 中执行 fn：fn 中创建的套接字属于该命名空间，之后在哪个线程上使用都不受影响；
+// name 为空时直接执行
+func inNetns(name string, fn func() error) error {
+	if name == "" {
+		return fn()
+	}
+	errc := make(chan error, 1)
+	go func() {
+		// 切换了命名空间的线程不再解锁，goroutine 结束时随之退出，不会被其他 goroutine 复用
+		runtime.LockOSThread()
+		f, err := os.Open(netnsPath(name))
+		if err != nil {
+			errc <- fmt.Errorf("打开网络命名空间 %s 失败: %v", name, err)
+			return
+		}
+		err = unix.Setns(int(f.Fd()), unix.CLONE_NEWNET)
+		f.Close()
+		if err != nil {
+			errc <- fmt.Errorf("切换到网络命名空间 %s 失败（需要 root 权限）: %v", name, err)
+			return
+		}
+		errc <- fn()
+	}()
+	return <-errc
+}
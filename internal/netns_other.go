@@ -0,0 +1,13 @@
+//go:build !linux
+
+package internal
+
+import "errors"
+
+// inNetns 只有 Linux 支持网络命名空间，name 非空时返回错误
+func inNetns(name string, fn func() error) error {
+	if name == "" {
+		return fn()
+	}
+	return errors.New("-netns 只支持 Linux")
+}
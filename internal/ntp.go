@@ -0,0 +1,164 @@
+package internal
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+// ntpServerGroup 一组 NTP 服务器：分组名显示在运营商列，服务器域名显示在地区列
+type ntpServerGroup struct {
+	Name    string
+	Servers []string
+}
+
+// ntpServerGroups 内置的国内常用 NTP 服务器分组
+var ntpServerGroups = []ntpServerGroup{
+	{Name: "阿里云", Servers: []string{"ntp.aliyun.com", "ntp1.aliyun.com", "ntp2.aliyun.com"}},
+	{Name: "腾讯云", Servers: []string{"ntp.tencent.com", "ntp1.tencent.com", "ntp2.tencent.com"}},
+	{Name: "国家授时中心", Servers: []string{"ntp.ntsc.ac.cn"}},
+	{Name: "NTP Pool", Servers: []string{"0.cn.pool.ntp.org", "1.cn.pool.ntp.org", "2.cn.pool.ntp.org", "3.cn.pool.ntp.org"}},
+}
+
+// ntpGroupNames 返回全部分组名
+func ntpGroupNames() []string {
+	var names []string
+	for _, g := range ntpServerGroups {
+		names = append(names, g.Name)
+	}
+	return names
+}
+
+// validateNTPTarget 校验 NTP 模式下的 -isp（分组名或 all）和 -dt（只能为全国）
+func validateNTPTarget(group string, region string) error {
+	if region != "全国" {
+		return fmt.Errorf("NTP 探测使用内置的服务器分组，不支持 -dt 指定区域")
+	}
+	if group == "all" {
+		return nil
+	}
+	for _, g := range ntpServerGroups {
+		if g.Name == group {
+			return nil
+		}
+	}
+	return fmt.Errorf("NTP 探测中 -isp 指定服务器分组，'%s' 不存在，可选 all|%s", group, strings.Join(ntpGroupNames(), "|"))
+}
+
+// buildNTPTargets 解析分组内的服务器域名生成探测目标，一个域名可能解析出多个服务器
+func buildNTPTargets(group string) ([]*Target, error) {
+	set := newTargetSet()
+	for _, g := range ntpServerGroups {
+		if group != "all" && group != g.Name {
+			continue
+		}
+		for _, host := range g.Servers {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+			cancel()
+			if err != nil {
+				log.Printf("⚠️  解析 NTP 服务器 %s 失败: %v\n", host, err)
+				continue
+			}
+			for _, ip := range ips {
+				set.add(ip.String(), TargetLabel{Region: host, Isp: g.Name})
+			}
+		}
+	}
+	if len(set.targets) == 0 {
+		return nil, fmt.Errorf("没有可探测的 NTP 服务器，请检查 DNS 解析")
+	}
+	return set.targets, nil
+}
+
+// ntpEpochOffset NTP 时间（1900 年起）与 Unix 时间（1970 年起）相差的秒数
+const ntpEpochOffset = 2208988800
+
+func toNTPTime(t time.Time) uint64 {
+	nsec := uint64(t.UnixNano()) + ntpEpochOffset*uint64(time.Second)
+	sec := nsec / uint64(time.Second)
+	frac := (nsec % uint64(time.Second)) << 32 / uint64(time.Second)
+	return sec<<32 | frac
+}
+
+func fromNTPTime(v uint64) time.Time {
+	sec := int64(v>>32) - ntpEpochOffset
+	nsec := int64((v & 0xffffffff) * uint64(time.Second) >> 32)
+	return time.Unix(sec, nsec)
+}
+
+// ntpProber 以 SNTP 请求测量到 NTP 服务器的网络时延（扣除服务器处理时间）和时钟偏差
+type ntpProber struct {
+	detailResults
+	pace time.Duration
+	vrf  string
+}
+
+func (p *ntpProber) Probe(to net.IP, sourceIP net.IP, count int, adaptive AdaptiveOptions) (*ping.Statistics, error) {
+	conn, err := dialUDP("udp4", sourceIP, &net.UDPAddr{IP: to, Port: 123}, p.vrf)
+	if err != nil {
+		return nil, fmt.Errorf("NTP Start Error: %w", err)
+	}
+	defer conn.Close()
+
+	tracker := &sampleTracker{}
+	stats, err := probeLoop(to, count, adaptive, packetInterval(p.pace, adaptive.maxPackets(count)), func() (time.Duration, error) {
+		sample, delay, err := ntpOnce(conn)
+		if err != nil {
+			return 0, err
+		}
+		tracker.add(sample, delay)
+		return delay, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("NTP Error: %w", err)
+	}
+	p.set(to, sourceIP, tracker.details())
+	return stats, nil
+}
+
+// ntpOnce 发送一次 SNTP 请求，返回时钟偏差等结果和网络时延 (T4-T1)-(T3-T2)
+func ntpOnce(conn *net.UDPConn) (*TimestampStats, time.Duration, error) {
+	req := make([]byte, 48)
+	req[0] = 0x23 // LI=0 VN=4 Mode=3(客户端)
+	t1 := time.Now()
+	binary.BigEndian.PutUint64(req[40:], toNTPTime(t1))
+	if _, err := conn.Write(req); err != nil {
+		return nil, 0, err
+	}
+
+	conn.SetReadDeadline(t1.Add(probeTimeout))
+	bufp := packetPool.Get().(*[]byte)
+	defer packetPool.Put(bufp)
+	resp := *bufp
+	for {
+		n, err := conn.Read(resp)
+		if err != nil {
+			return nil, 0, err
+		}
+		t4 := time.Now()
+		// 只接受对本次请求的服务器应答（原始时间戳等于请求的发送时间戳）
+		if n < 48 || resp[0]&0x07 != 4 || binary.BigEndian.Uint64(resp[24:]) != binary.BigEndian.Uint64(req[40:]) {
+			continue
+		}
+		if resp[1] == 0 {
+			return nil, 0, errors.New("NTP 服务器拒绝服务（Kiss-o'-Death）")
+		}
+		t2 := fromNTPTime(binary.BigEndian.Uint64(resp[32:]))
+		t3 := fromNTPTime(binary.BigEndian.Uint64(resp[40:]))
+		forward, back := t2.Sub(t1), t4.Sub(t3)
+		delay := max(forward+back, 0)
+		return &TimestampStats{
+			ClockOffset: (forward - back) / 2,
+			Forward:     forward,
+			Return:      back,
+		}, delay, nil
+	}
+}
@@ -0,0 +1,110 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateNTPTarget(t *testing.T) {
+	for _, c := range []struct {
+		group, region string
+		ok            bool
+	}{
+		{"all", "全国", true},
+		{"阿里云", "全国", true},
+		{"NTP Pool", "全国", true},
+		{"电信", "全国", false},  // -isp 为服务器分组名而非运营商
+		{"阿里云", "北京", false}, // 不支持指定区域
+	} {
+		err := internal.ValidateNTPTarget(c.group, c.region)
+		if (err == nil) != c.ok {
+			t.Errorf("%s/%s: 是否通过应为 %v，实际错误为 %v", c.group, c.region, c.ok, err)
+		}
+	}
+	if err := internal.ValidateNTPTarget("电信", "全国"); err == nil || !strings.Contains(err.Error(), "all|阿里云|腾讯云|国家授时中心|NTP Pool") {
+		t.Errorf("分组不存在时应列出可选分组，实际为 %v", err)
+	}
+}
+
+func TestNTPTime(t *testing.T) {
+	now := time.Date(2026, 10, 17, 8, 30, 15, 123456789, time.UTC)
+	v := internal.ToNTPTime(now)
+	if sec := v >> 32; sec != uint64(now.Unix())+2208988800 {
+		t.Errorf("NTP 秒数应从 1900 年起算，实际为 %d", sec)
+	}
+	// 小数部分为 2^-32 秒，往返误差不超过 1 纳秒
+	if d := internal.FromNTPTime(v).Sub(now); d < -time.Nanosecond || d > time.Nanosecond {
+		t.Errorf("往返后相差 %v", d)
+	}
+}
+
+// ntpServer 在本地模拟 NTP 服务器：时钟比本机快 offset，每个请求先回一个不相关的应答再回正确的应答；
+// stratum 为 0 时表示拒绝服务
+func ntpServer(t *testing.T, offset time.Duration, stratum byte) *net.UDPConn {
+	t.Helper()
+	server, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	go func() {
+		req := make([]byte, 48)
+		for {
+			n, addr, err := server.ReadFromUDP(req)
+			if err != nil {
+				return
+			}
+			if n < 48 {
+				continue
+			}
+			now := internal.ToNTPTime(time.Now().Add(offset))
+			resp := make([]byte, 48)
+			resp[0] = 0x24 // LI=0 VN=4 Mode=4(服务器)
+			resp[1] = stratum
+			binary.BigEndian.PutUint64(resp[32:], now)
+			binary.BigEndian.PutUint64(resp[40:], now)
+
+			// 原始时间戳不匹配的应答（如上一次请求迟到的应答）应被忽略
+			binary.BigEndian.PutUint64(resp[24:], binary.BigEndian.Uint64(req[40:])-1)
+			server.WriteToUDP(resp, addr)
+
+			binary.BigEndian.PutUint64(resp[24:], binary.BigEndian.Uint64(req[40:]))
+			server.WriteToUDP(resp, addr)
+		}
+	}()
+
+	conn, err := net.DialUDP("udp4", nil, server.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestNTPOnce(t *testing.T) {
+	conn := ntpServer(t, time.Second, 2)
+	for i := 0; i < 3; i++ {
+		sample, delay, err := internal.NTPOnce(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 本地往返时延很小，时钟偏差接近服务器的 1 秒，去程和回程分别约为 +1 秒和 -1 秒
+		if delay < 0 || delay > 100*time.Millisecond {
+			t.Errorf("本地时延应接近 0，实际为 %v", delay)
+		}
+		if d := sample.ClockOffset - time.Second; d < -50*time.Millisecond || d > 50*time.Millisecond {
+			t.Errorf("时钟偏差应约为 1s，实际为 %v", sample.ClockOffset)
+		}
+		if sample.Forward < 900*time.Millisecond || sample.Return > -900*time.Millisecond {
+			t.Errorf("单向时延应约为 +1s/-1s，实际为 %v/%v", sample.Forward, sample.Return)
+		}
+	}
+
+	if _, _, err := internal.NTPOnce(ntpServer(t, 0, 0)); err == nil || !strings.Contains(err.Error(), "Kiss-o'-Death") {
+		t.Errorf("stratum 为 0 时应返回拒绝服务的错误，实际为 %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+)
+
+// Options 一次运行的全部参数，对应主命令的命令行参数；字段为零值时使用与命令行相同的默认值（零值有意义的除外，见各字段），
+// 以后新增参数只增加字段，不影响已有的调用方
+type Options struct {
+	Isp            string        // 运营商：电信|联通|移动|all，为空时为 all
+	Region         string        // 区域（-dt），为空时为全国
+	MaxConcurrency int           // 总并发数（-C），为 0 时为 50；按运营商或地区的限制在 Targets.Concurrency 中
+	Count          int           // 每个目标的发包数量（-p），为 0 时为 3
+	Eth            string        // 发包网卡，多个用逗号分隔，为空时为系统默认
+	Sort           string        // 排序字段（-S），为空时按丢包率
+	Descending     bool          // 按降序排列
+	Jitter         time.Duration // 各目标启动的最大随机偏移，0 为不偏移；命令行的默认值见 DefaultOptions
+	ResultBuffer   int           // 探测结果通道的缓冲区长度，为 0 时为 20
+	ResultSpill    bool          // 汇总跟不上时结果暂存到不限长度的内存队列，探测协程从不等待汇总
+	Store          string        // 原始结果的持久化后端（-store），为空时为 memory，见 OpenStatsBackend
+	Rate           int           // 每秒最多开始的探测数，0 为不限制；多租户时各租户分别限制
+	Hooks          HookOptions   // 探测前后执行的外部命令
+	Adaptive       AdaptiveOptions
+	Probe          ProbeOptions // Port 为 0 时使用探测方式的默认端口
+	Targets        TargetOptions
+	Output         OutputOptions // Format、Theme、Loss 为零值时同命令行默认值；CompareLast 的默认值见 DefaultOptions
+	Watch          WatchOptions  // Interval 非 0 时持续探测
+	Stream         *Stream       // 实时推送各轮的探测结果和进度，为 nil 时不推送，见 StartStream
+	Metrics        *Metrics      // 以 Prometheus 格式导出累计的探测结果，为 nil 时不导出，见 StartMetrics
+}
+
+// Result 一次运行的结果
+type Result struct {
+	Snapshot *Snapshot // 汇总结果，与 -format json 的输出相同；持续探测时为最后一轮的结果
+	Rounds   int       // 探测的轮数，单次运行时为 1
+}
+
+// DefaultOptions 与命令行默认值相同的参数
+func DefaultOptions() Options {
+	return Options{Jitter: 100 * time.Millisecond, Output: OutputOptions{CompareLast: true}}.withDefaults()
+}
+
+// withDefaults 以默认值补全零值字段
+func (o Options) withDefaults() Options {
+	if o.Isp == "" {
+		o.Isp = "all"
+	}
+	if o.Region == "" {
+		o.Region = "全国"
+	}
+	if o.MaxConcurrency == 0 {
+		o.MaxConcurrency = 50
+	}
+	if o.Count == 0 {
+		o.Count = 3
+	}
+	if o.Eth == "" {
+		o.Eth = "nil"
+	}
+	if o.Sort == "" {
+		o.Sort = "loss"
+	}
+	if o.Adaptive.MaxCount == 0 {
+		o.Adaptive.MaxCount = 20
+	}
+	if o.Adaptive.Threshold == 0 {
+		o.Adaptive.Threshold = 2 * time.Millisecond
+	}
+	if o.Output.Format == "" {
+		o.Output.Format = "table"
+	}
+	if o.Output.Theme == "" {
+		o.Output.Theme = "default"
+	}
+	if o.Output.Loss == (LossThresholds{}) {
+		o.Output.Loss = LossThresholds{Warn: 5, Crit: 10}
+	}
+	if o.Probe.Port == 0 && !o.Probe.Multi() {
+		o.Probe.Port = DefaultPort(o.Probe.Proto)
+	}
+	return o
+}
+
+// Validate 在探测前校验全部参数及其组合，零值字段按默认值校验
+func (o Options) Validate() error {
+	o = o.withDefaults()
+	if err := ValidateParams(o.Isp, o.Region, o.MaxConcurrency, o.Count, o.Jitter, o.Adaptive, o.Probe, o.Targets, o.Sort); err != nil {
+		return err
+	}
+	if err := ValidateOutput(o.Output); err != nil {
+		return err
+	}
+	if err := ValidateWatch(o.Watch); err != nil {
+		return err
+	}
+	if o.ResultBuffer < 0 {
+		return fmt.Errorf("结果缓冲区长度 -result-buffer 不能为负数，当前为 %d", o.ResultBuffer)
+	}
+	if _, err := newProbeHooks(o.Hooks); err != nil {
+		return err
+	}
+	if o.Probe.Multi() && o.Output.RecordPath != "" {
+		return fmt.Errorf("-record 不支持同时使用多个探测方式")
+	}
+	if o.Watch.Interval > 0 {
+		if o.Output.TUI || o.Output.RecordPath != "" {
+			return fmt.Errorf("-tui 和 -record 不能与 -watch 同时使用")
+		}
+		if o.Probe.Cache > 0 {
+			return fmt.Errorf("-cache 用于短时间内重复运行，不能与 -watch 同时使用")
+		}
+	}
+	if o.Watch.Spread && o.Targets.Priority != "" {
+		return fmt.Errorf("-spread 已按固定顺序均匀探测全部目标，不能与 -priority 同时使用")
+	}
+	if o.Watch.Chart != "" && o.Output.Format != "table" {
+		return fmt.Errorf("-chart 只在 -format table 时生效，当前格式为 %s", o.Output.Format)
+	}
+	return nil
+}
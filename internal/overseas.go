@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"time"
+)
+
+// OverseasRegion -dt 为该值时探测内置的海外目标，并以国际出口所在地区的国内目标作为基线，一次运行即可对比跨境与国内的质量
+const OverseasRegion = "海外"
+
+// OverseasIsp 海外目标的运营商，汇总时与国内各运营商分开成组
+const OverseasIsp = "海外"
+
+// overseasBaselineRegions 海外探测时同时探测的国内地区：三大运营商的国际出口集中在这三地，跨境的时延和丢包可与之直接比较
+var overseasBaselineRegions = []string{"北京", "上海", "广东"}
+
+// overseasGroup 一组海外目标：Hosts 为 IP 或域名，域名在探测前解析，地址随服务商调整而变化时无需更新
+type overseasGroup struct {
+	Region   string // 目标所在地区，任播地址为"任播"（由就近的节点应答）
+	Provider string // 服务商，写入目标的 provider 标签
+	Hosts    []string
+}
+
+// overseasGroups 内置的海外目标：公共解析服务的任播地址，以及香港、新加坡、日本、美国的云服务区域端点
+var overseasGroups = []overseasGroup{
+	{Region: "任播", Provider: "Cloudflare", Hosts: []string{"1.1.1.1", "1.0.0.1"}},
+	{Region: "任播", Provider: "Google", Hosts: []string{"8.8.8.8", "8.8.4.4"}},
+	{Region: "任播", Provider: "Quad9", Hosts: []string{"9.9.9.9"}},
+	{Region: "香港", Provider: "AWS", Hosts: []string{"ec2.ap-east-1.amazonaws.com"}},
+	{Region: "香港", Provider: "阿里云", Hosts: []string{"oss-cn-hongkong.aliyuncs.com"}},
+	{Region: "新加坡", Provider: "AWS", Hosts: []string{"ec2.ap-southeast-1.amazonaws.com"}},
+	{Region: "新加坡", Provider: "阿里云", Hosts: []string{"oss-ap-southeast-1.aliyuncs.com"}},
+	{Region: "日本", Provider: "AWS", Hosts: []string{"ec2.ap-northeast-1.amazonaws.com"}},
+	{Region: "日本", Provider: "阿里云", Hosts: []string{"oss-ap-northeast-1.aliyuncs.com"}},
+	{Region: "美国", Provider: "AWS", Hosts: []string{"ec2.us-west-1.amazonaws.com"}},
+	{Region: "美国", Provider: "阿里云", Hosts: []string{"oss-us-west-1.aliyuncs.com"}},
+}
+
+// buildOverseasTargets 生成海外目标和国内基线目标：基线为指定运营商在 overseasBaselineRegions 中的目标，
+// 海外目标的运营商为 OverseasIsp、带 provider 标签；域名解析失败的只提示，全部海外目标都无法解析时返回错误
+func buildOverseasTargets(dns *DNSConfig, isp string) ([]*Target, error) {
+	set := newTargetSet()
+	for _, region := range overseasBaselineRegions {
+		for _, t := range buildTargets(dns, isp, region) {
+			for _, label := range t.Labels {
+				set.add(t.IP, label)
+			}
+		}
+	}
+	baseline := len(set.targets)
+	for _, g := range overseasGroups {
+		label := TargetLabel{Region: g.Region, Isp: OverseasIsp, Tags: map[string]string{"provider": g.Provider}}
+		for _, host := range g.Hosts {
+			if net.ParseIP(host) != nil {
+				set.add(host, label)
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+			cancel()
+			if err != nil {
+				log.Printf("⚠️  解析海外目标 %s 失败: %v\n", host, err)
+				continue
+			}
+			for _, ip := range ips {
+				set.add(ip.String(), label)
+			}
+		}
+	}
+	if len(set.targets) == baseline {
+		return nil, fmt.Errorf("没有可探测的海外目标，请检查 DNS 解析")
+	}
+	return set.targets, nil
+}
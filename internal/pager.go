@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+
+	"golang.org/x/term"
+)
+
+// pagerCommand 返回分页程序：优先使用 $PAGER，否则使用 less；都不可用时返回 nil
+func pagerCommand() *exec.Cmd {
+	if pager := os.Getenv("PAGER"); pager != "" {
+		return exec.Command("sh", "-c", pager)
+	}
+	if path, err := exec.LookPath("less"); err == nil {
+		cmd := exec.Command(path)
+		// 与 git 一致：保留颜色，不超过一屏时直接退出
+		if os.Getenv("LESS") == "" {
+			cmd.Env = append(os.Environ(), "LESS=FRX")
+		}
+		return cmd
+	}
+	return nil
+}
+
+// writePaged 将输出写到标准输出；标准输出是终端且内容超过一屏时通过分页程序显示，
+// 分页程序不可用或启动失败时直接输出
+func writePaged(content []byte, disabled bool) error {
+	fd := int(os.Stdout.Fd())
+	if disabled || !term.IsTerminal(fd) {
+		_, err := os.Stdout.Write(content)
+		return err
+	}
+	_, height, err := term.GetSize(fd)
+	if err != nil || bytes.Count(content, []byte("\n")) < height {
+		_, err := os.Stdout.Write(content)
+		return err
+	}
+
+	cmd := pagerCommand()
+	if cmd == nil {
+		_, err := os.Stdout.Write(content)
+		return err
+	}
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// 分页程序无法启动或命令不存在（sh 返回 127）时保证结果仍然输出，用户在分页中途退出不算错误
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && (!errors.As(err, &exitErr) || exitErr.ExitCode() == 127) {
+		_, err = os.Stdout.Write(content)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package internal_test
+
+import (
+	"bytes"
+	"dping/internal"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// openPty 打开一对伪终端，从端的窗口为 rows 行，返回主端和从端
+func openPty(t *testing.T, rows int) (*os.File, *os.File) {
+	t.Helper()
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("无法打开伪终端: %v", err)
+	}
+	t.Cleanup(func() { master.Close() })
+	fd := int(master.Fd())
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		t.Skipf("无法解锁伪终端: %v", err)
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		t.Skipf("无法获取伪终端编号: %v", err)
+	}
+	slave, err := os.OpenFile("/dev/pts/"+strconv.Itoa(n), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("无法打开伪终端从端: %v", err)
+	}
+	t.Cleanup(func() { slave.Close() })
+	if err := unix.IoctlSetWinsize(int(slave.Fd()), unix.TIOCSWINSZ, &unix.Winsize{Row: uint16(rows), Col: 80}); err != nil {
+		t.Fatal(err)
+	}
+	return master, slave
+}
+
+func TestWritePagedTTY(t *testing.T) {
+	dir := t.TempDir()
+	for _, c := range []struct {
+		name     string
+		lines    int
+		disabled bool
+		pager    string // 为空时使用能正常运行的分页程序
+		paged    bool
+	}{
+		{"超过一屏", 50, false, "", true},
+		{"超过一屏但指定了 -no-pager", 50, true, "", false},
+		{"不足一屏", 3, false, "", false},
+		{"分页程序不存在", 50, false, "dping-no-such-pager", false},
+	} {
+		master, slave := openPty(t, 10)
+		received := filepath.Join(dir, strings.ReplaceAll(c.name, " ", "_"))
+		pager := c.pager
+		if pager == "" {
+			// 分页程序把收到的内容存入文件，便于与终端上直接输出的内容区分
+			pager = "cat > " + received
+		}
+		t.Setenv("PAGER", pager)
+
+		content := strings.Repeat("一行结果\n", c.lines)
+		captureStdout(t, slave, func() {
+			if err := internal.WritePaged([]byte(content), c.disabled); err != nil {
+				t.Errorf("%s: %v", c.name, err)
+			}
+		})
+		slave.Close()
+		// 终端把换行转换为回车换行
+		direct, _ := io.ReadAll(master)
+		direct = bytes.ReplaceAll(direct, []byte("\r\n"), []byte("\n"))
+
+		paged, _ := os.ReadFile(received)
+		if c.paged {
+			if string(paged) != content || len(direct) != 0 {
+				t.Errorf("%s: 应只经分页程序输出，分页程序收到 %d 字节，终端直接输出 %d 字节", c.name, len(paged), len(direct))
+			}
+		} else if string(direct) != content || paged != nil {
+			t.Errorf("%s: 应直接输出到终端，终端收到 %d 字节，分页程序收到 %d 字节", c.name, len(direct), len(paged))
+		}
+	}
+}
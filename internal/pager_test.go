@@ -0,0 +1,46 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// captureStdout 在 fn 执行期间把标准输出重定向到 w
+func captureStdout(t *testing.T, w *os.File, fn func()) {
+	t.Helper()
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	fn()
+}
+
+func TestWritePagedNoTTY(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "paged")
+	// 分页程序一旦被调用就会留下标记文件
+	t.Setenv("PAGER", "cat > "+marker)
+	content := strings.Repeat("一行结果\n", 500)
+
+	for _, disabled := range []bool{false, true} {
+		out, err := os.Create(filepath.Join(dir, "out.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		captureStdout(t, out, func() {
+			if err := internal.WritePaged([]byte(content), disabled); err != nil {
+				t.Errorf("noPager=%v: %v", disabled, err)
+			}
+		})
+		out.Close()
+		// 标准输出不是终端（重定向到文件或管道）时直接输出，不经过分页程序
+		if data, _ := os.ReadFile(out.Name()); string(data) != content {
+			t.Errorf("noPager=%v: 应原样输出 %d 字节，实际为 %d 字节", disabled, len(content), len(data))
+		}
+		if _, err := os.Stat(marker); err == nil {
+			t.Errorf("noPager=%v: 标准输出不是终端时不应调用分页程序", disabled)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// pivotRow 对比表中的一行：同一目标（IP + 运营商 + 地区）在各源IP（或各协议）下的结果
+type pivotRow struct {
+	first    *SummaryStatistic
+	bySource map[string]*SummaryStatistic
+}
+
+// printSourcePivot 输出多源对比表：每个目标一行，每个源IP一组丢包率和平均 RTT 列，最后一列为最优的源；
+// 某个源下没有结果（全部丢包或探测失败）时显示为 -。lossOnly 时只输出至少一个源有丢包的目标
+func (r *TableRenderer) printSourcePivot(w io.Writer, summaryList []*SummaryStatistic, sources []string, lossOnly bool) {
+	formatDuration := func(d time.Duration) string {
+		return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+	}
+
+	var order []string
+	groups := make(map[string]*pivotRow)
+	for _, sum := range summaryList {
+		key := sum.DestIP + "|" + sum.Isp + "|" + sum.Region
+		g, ok := groups[key]
+		if !ok {
+			g = &pivotRow{first: sum, bySource: make(map[string]*SummaryStatistic)}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.bySource[sum.Source] = sum
+	}
+
+	header := []string{"目标IP", "地区", "运营商"}
+	for _, src := range sources {
+		header = append(header, src+" 丢包%", src+" AvgRTT")
+	}
+	header = append(header, "最优源")
+
+	// 总计按源分别统计，同一IP以多个标签出现时只统计一次
+	totals := make(map[string]*rowTotals)
+	for _, src := range sources {
+		totals[src] = newRowTotals()
+	}
+
+	var rows [][]string
+	for _, key := range order {
+		g := groups[key]
+		if lossOnly {
+			hasLoss := len(g.bySource) < len(sources)
+			for _, sum := range g.bySource {
+				hasLoss = hasLoss || sum.PacketLoss > 0
+			}
+			if !hasLoss {
+				continue
+			}
+		}
+
+		row := []string{g.first.DestIP, g.first.Region, r.Theme.color(r.Theme.colorForISP(g.first.Isp), g.first.Isp)}
+		var best *SummaryStatistic
+		for _, src := range sources {
+			sum, ok := g.bySource[src]
+			if !ok {
+				row = append(row, "-", "-")
+				continue
+			}
+			lossStr := fmt.Sprintf("%.1f%%", sum.PacketLoss)
+			row = append(row,
+				r.Theme.packetLoss(sum.PacketLoss, r.Loss, lossStr),
+				r.colorAvgRtt(sum.AvgRtt, formatDuration(sum.AvgRtt)),
+			)
+			// 丢包率低者优先，丢包率相同时比较平均 RTT
+			if best == nil || sum.PacketLoss < best.PacketLoss ||
+				(sum.PacketLoss == best.PacketLoss && sum.AvgRtt < best.AvgRtt) {
+				best = sum
+			}
+			totals[src].add(sum)
+		}
+		row = append(row, r.Theme.color(r.Theme.Good, best.Source))
+		rows = append(rows, row)
+	}
+
+	footer := []string{"", "", "总计"}
+	for _, src := range sources {
+		footer = append(footer, totals[src].footer(formatDuration)...)
+	}
+	footer = append(footer, "")
+
+	r.renderFitted(w, header, rows, footer)
+}
+
+// printProtoPivot 输出多协议对比表：每个目标一行，每个协议一组丢包率和平均 RTT 列，最后一列列出与其他协议不一致的协议，
+// 如 ICMP 正常而 DNS 无应答、TCP 某个端口被过滤（无回应）或拒绝连接；同时探测 ICMP 和 TCP 时，两者丢包或延迟明显不一致
+// 的目标还标出以哪一方为准。某个协议下没有结果（全部丢包或探测失败）时显示为 -。
+// lossOnly 时只输出至少一个协议有丢包的目标
+func (r *TableRenderer) printProtoPivot(w io.Writer, summaryList []*SummaryStatistic, protocols []string, lossOnly bool) {
+	formatDuration := func(d time.Duration) string {
+		return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+	}
+	withSource := multiSource(summaryList)
+	tcpProtos := tcpProtocols(protocols)
+
+	var order []string
+	groups := make(map[string]*pivotRow)
+	for _, sum := range summaryList {
+		key := sum.DestIP + "|" + sum.Isp + "|" + sum.Region + "|" + sum.Source
+		g, ok := groups[key]
+		if !ok {
+			g = &pivotRow{first: sum, bySource: make(map[string]*SummaryStatistic)}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.bySource[sum.Proto] = sum
+	}
+
+	header := []string{"目标IP", "地区", "运营商"}
+	if withSource {
+		header = append(header, "源IP")
+	}
+	for _, proto := range protocols {
+		header = append(header, proto+" 丢包%", proto+" AvgRTT")
+	}
+	header = append(header, "不一致")
+
+	totals := make(map[string]*rowTotals)
+	for _, proto := range protocols {
+		totals[proto] = newRowTotals()
+	}
+
+	var rows [][]string
+	for _, key := range order {
+		g := groups[key]
+		if lossOnly {
+			hasLoss := len(g.bySource) < len(protocols)
+			for _, sum := range g.bySource {
+				hasLoss = hasLoss || sum.PacketLoss > 0
+			}
+			if !hasLoss {
+				continue
+			}
+		}
+
+		row := []string{g.first.DestIP, g.first.Region, r.Theme.color(r.Theme.colorForISP(g.first.Isp), g.first.Isp)}
+		if withSource {
+			row = append(row, g.first.Source)
+		}
+		var healthy bool
+		var failing []string
+		for _, proto := range protocols {
+			sum, ok := g.bySource[proto]
+			if !ok {
+				row = append(row, "-", "-")
+				// TCP 端口没有任何回应多为防火墙丢弃了 SYN
+				if strings.HasPrefix(proto, "tcp") {
+					failing = append(failing, proto+" 被过滤")
+				} else {
+					failing = append(failing, proto+" 无应答")
+				}
+				continue
+			}
+			lossStr := fmt.Sprintf("%.1f%%", sum.PacketLoss)
+			row = append(row,
+				r.Theme.packetLoss(sum.PacketLoss, r.Loss, lossStr),
+				r.colorAvgRtt(sum.AvgRtt, formatDuration(sum.AvgRtt)),
+			)
+			switch o := sum.TCPOutcomes; {
+			case o != nil && o.Connected == 0 && o.Refused > 0:
+				// 对端回 RST 计为收到，链路正常但端口未监听
+				failing = append(failing, proto+" 拒绝连接")
+			case sum.PacketLoss < r.Loss.Warn:
+				healthy = true
+			case sum.PacketLoss >= r.Loss.Crit:
+				failing = append(failing, fmt.Sprintf("%s 丢包 %.1f%%", proto, sum.PacketLoss))
+			}
+			totals[proto].add(sum)
+		}
+		// ICMP 与 TCP 的对比给出更可信的一方，取代两者之间的简单不一致
+		var asymmetric []string
+		for _, proto := range tcpProtos {
+			if m := compareICMPTCP(g.bySource["icmp"], g.bySource[proto], proto, r.Loss); m != nil {
+				asymmetric = append(asymmetric, m.String())
+				failing = slices.DeleteFunc(failing, func(s string) bool {
+					return strings.HasPrefix(s, proto+" ") || strings.HasPrefix(s, "icmp ")
+				})
+			}
+		}
+		// 至少一个协议正常、另有协议严重丢包或无应答时，问题多在该协议的服务或中间设备的过滤，而不是链路
+		if healthy {
+			asymmetric = append(asymmetric, failing...)
+		}
+		mismatch := ""
+		if len(asymmetric) > 0 {
+			mismatch = r.Theme.color(r.Theme.Bad, strings.Join(asymmetric, "，"))
+		}
+		rows = append(rows, append(row, mismatch))
+	}
+
+	footer := []string{"", "", "总计"}
+	if withSource {
+		footer = append(footer, "")
+	}
+	for _, proto := range protocols {
+		footer = append(footer, totals[proto].footer(formatDuration)...)
+	}
+	footer = append(footer, "")
+
+	r.renderFitted(w, header, rows, footer)
+}
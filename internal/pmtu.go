@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-ping/ping"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// 路径 MTU 探测的范围：以太网的 1500 字节为上限，最小的探测包与普通 ping 相同（84 字节）
+const (
+	pmtuMax     = 1500
+	pmtuMin     = 84
+	pmtuTimeout = time.Second // 每个大小等待应答的时长
+)
+
+// PathMTU 低于这些值的路径需要关注：低于 1500 时 TLS 握手等大包可能在 PMTU 黑洞中丢失，低于 1400 多为隧道或配置错误
+const (
+	PathMTUWarn = 1500
+	PathMTUCrit = 1400
+)
+
+// pmtuProber 包装真实 Prober，探测完成后用设置了 DF 的 ICMP Echo 二分查找到目标的路径 MTU（-pmtu），仅支持 IPv4
+type pmtuProber struct {
+	Prober
+	ids  *icmpIDs
+	vrf  string
+	mu   sync.Mutex
+	mtus map[string]int
+}
+
+// withPMTU 指定 -pmtu 时为 Prober 加上路径 MTU 探测
+func (o ProbeOptions) withPMTU(prober Prober, ids *icmpIDs) Prober {
+	if !o.PMTU {
+		return prober
+	}
+	return &pmtuProber{Prober: prober, ids: ids, vrf: o.VRF, mtus: make(map[string]int)}
+}
+
+func (p *pmtuProber) Probe(to net.IP, sourceIP net.IP, count int, adaptive AdaptiveOptions) (*ping.Statistics, error) {
+	stats, err := p.Prober.Probe(to, sourceIP, count, adaptive)
+	if err != nil || to.To4() == nil {
+		return stats, err
+	}
+	if mtu := pathMTU(to, sourceIP, p.vrf, p.ids.take()); mtu > 0 {
+		p.mu.Lock()
+		p.mtus[probeKey(to, sourceIP)] = mtu
+		p.mu.Unlock()
+	}
+	return stats, nil
+}
+
+// Details 在被包装 Prober 的附加结果上加上路径 MTU
+func (p *pmtuProber) Details(to net.IP, sourceIP net.IP) *ProbeDetails {
+	var details *ProbeDetails
+	if ds, ok := p.Prober.(detailSource); ok {
+		details = ds.Details(to, sourceIP)
+	}
+	p.mu.Lock()
+	mtu := p.mtus[probeKey(to, sourceIP)]
+	p.mu.Unlock()
+	if mtu == 0 {
+		return details
+	}
+	merged := &ProbeDetails{}
+	if details != nil {
+		*merged = *details
+	}
+	merged.PathMTU = mtu
+	return merged
+}
+
+// pathMTU 二分查找能收到应答的最大 IP 包（设置 DF，不分片），路由器回复"需要分片"时直接尝试其给出的下一跳 MTU；
+// 目标不响应 ICMP（最小的探测包也没有应答）或无法发送时返回 0
+func pathMTU(to net.IP, sourceIP net.IP, device string, id int) int {
+	conn, err := listenICMP(to, sourceIP, device)
+	if err != nil {
+		return 0
+	}
+	defer conn.Close()
+	if err := setDontFragment(conn); err != nil {
+		return 0
+	}
+
+	seq := 0
+	try := func(size int) (ok bool, nextHop int) {
+		seq++
+		return echoSize(conn, to, id, seq, size)
+	}
+	if ok, _ := try(pmtuMax); ok {
+		return pmtuMax
+	}
+	if ok, _ := try(pmtuMin); !ok {
+		return 0
+	}
+	lo, hi := pmtuMin, pmtuMax // lo 能收到应答，hi 不能
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		ok, nextHop := try(mid)
+		switch {
+		case ok:
+			lo = mid
+		case nextHop > lo && nextHop < mid:
+			// 路由器给出的下一跳 MTU 通常就是结果，先确认它
+			hi = mid
+			if ok, _ := try(nextHop); ok {
+				lo = nextHop
+			} else {
+				hi = nextHop
+			}
+		default:
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// echoSize 发送一个总长为 size 字节的 Echo 请求，收到应答时 ok 为 true；
+// 收到对应的"需要分片"报文时返回其中的下一跳 MTU，超时或包超过本机网卡 MTU 时都为 0
+func echoSize(conn net.PacketConn, to net.IP, id, seq, size int) (ok bool, nextHop int) {
+	msg := icmp.Message{Type: ipv4.ICMPTypeEcho, Body: &icmp.Echo{ID: id, Seq: seq, Data: make([]byte, size-ipv4.HeaderLen-8)}}
+	wb, err := msg.Marshal(nil)
+	if err != nil {
+		return false, 0
+	}
+	if _, err := conn.WriteTo(wb, &net.IPAddr{IP: to}); err != nil {
+		// 超过出口网卡 MTU 的包无法发出（EMSGSIZE），按没有应答处理
+		return false, 0
+	}
+
+	conn.SetReadDeadline(time.Now().Add(pmtuTimeout))
+	rb := make([]byte, pmtuMax)
+	for {
+		n, peer, err := conn.ReadFrom(rb)
+		if err != nil {
+			return false, 0
+		}
+		reply, err := icmp.ParseMessage(1, rb[:n])
+		if err != nil {
+			continue
+		}
+		switch body := reply.Body.(type) {
+		case *icmp.Echo:
+			if addr, isIP := peer.(*net.IPAddr); isIP && reply.Type == ipv4.ICMPTypeEchoReply && addr.IP.Equal(to) && body.ID == id && body.Seq == seq {
+				return true, 0
+			}
+		case *icmp.DstUnreach:
+			// 代码 4 为需要分片但设置了 DF，报文头第 6、7 字节为下一跳 MTU
+			if reply.Code == 4 && n >= 8 && quotedEcho(rb[8:n], id, seq) {
+				return false, int(rb[6])<<8 | int(rb[7])
+			}
+		}
+	}
+}
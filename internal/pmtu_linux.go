@@ -0,0 +1,25 @@
+package internal
+
+import (
+	"net"
+	"syscall"
+)
+
+// setDontFragment 发出的包设置 DF 且不分片；使用 IP_PMTUDISC_PROBE 而不是 DO，忽略内核缓存的路径 MTU，每次都实际探测
+func setDontFragment(conn net.PacketConn) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return syscall.EINVAL
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_PROBE)
+	}); err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package internal
+
+import (
+	"errors"
+	"net"
+)
+
+// setDontFragment 只有 Linux 支持在 ICMP 原始套接字上设置 DF，其他系统上不探测路径 MTU
+func setDontFragment(net.PacketConn) error {
+	return errors.New("-pmtu 只支持 Linux")
+}
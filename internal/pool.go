@@ -0,0 +1,29 @@
+package internal
+
+import "sync"
+
+// statPool 复用探测结果：持续高频监控时每轮产生的结果数与目标数相当，结果汇总后即可回收
+var statPool = sync.Pool{New: func() any { return new(PingStatistic) }}
+
+// newPingStatistic 从池中取出一条已清零的探测结果，并标记为可回收
+func newPingStatistic() *PingStatistic {
+	stat := statPool.Get().(*PingStatistic)
+	stat.pooled = true
+	return stat
+}
+
+// releasePingStatistic 清零后放回池中，调用后不能再访问该结果；
+// 只回收 newPingStatistic 取出的结果，调用方自己构造的结果原样保留
+func releasePingStatistic(stat *PingStatistic) {
+	if !stat.pooled {
+		return
+	}
+	*stat = PingStatistic{}
+	statPool.Put(stat)
+}
+
+// packetPool 收包缓冲区，按以太网 MTU 分配，足够容纳一个 ICMP 或 NTP 应答
+var packetPool = sync.Pool{New: func() any {
+	buf := make([]byte, 1500)
+	return &buf
+}}
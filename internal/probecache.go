@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+// probeCachePath 探测结果缓存文件：用户缓存目录下的 dping/probe-cache.json，不可用时为空
+func probeCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "dping", "probe-cache.json")
+}
+
+// cachedProbe 缓存的一次探测结果
+type cachedProbe struct {
+	At      time.Time        `json:"at"`
+	Stats   *ping.Statistics `json:"stats"`
+	Details *ProbeDetails    `json:"details,omitempty"`
+}
+
+// probeCache -cache 指定时长内的探测结果，供短时间内重复运行时复用；
+// 只复用没有丢包的结果，出错、丢包的目标每次都重新探测
+type probeCache struct {
+	path    string
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]*cachedProbe
+	hits    atomic.Int64
+	misses  atomic.Int64
+}
+
+// loadProbeCache 读取缓存文件，丢弃已过期的结果；文件不存在或损坏时从空缓存开始
+func loadProbeCache(path string, ttl time.Duration) *probeCache {
+	c := &probeCache{path: path, ttl: ttl, entries: make(map[string]*cachedProbe)}
+	if path == "" {
+		return c
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c
+	}
+	var entries map[string]*cachedProbe
+	if json.Unmarshal(data, &entries) != nil {
+		return c
+	}
+	for key, e := range entries {
+		if e != nil && e.Stats != nil && time.Since(e.At) < ttl {
+			c.entries[key] = e
+		}
+	}
+	return c
+}
+
+// get 返回未过期的缓存结果
+func (c *probeCache) get(key string) *cachedProbe {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entries[key]
+	if e == nil || time.Since(e.At) >= c.ttl {
+		return nil
+	}
+	return e
+}
+
+// put 记录一次探测结果，有丢包时删除旧的缓存，下次重新探测
+func (c *probeCache) put(key string, stats *ping.Statistics, details *ProbeDetails) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if stats.PacketLoss > 0 {
+		delete(c.entries, key)
+		return
+	}
+	c.entries[key] = &cachedProbe{At: time.Now(), Stats: stats, Details: details}
+}
+
+// save 写回缓存文件；c 为 nil 时忽略
+func (c *probeCache) save() error {
+	if c == nil || c.path == "" {
+		return nil
+	}
+	c.mu.Lock()
+	data, err := json.Marshal(c.entries)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("保存探测结果缓存失败: %v", err)
+	}
+	if err := os.WriteFile(c.path, data, 0o644); err != nil {
+		return fmt.Errorf("保存探测结果缓存失败: %v", err)
+	}
+	return nil
+}
+
+// report 输出本次复用和重新探测的目标数，并清零计数；c 为 nil 时忽略
+func (c *probeCache) report() {
+	if c == nil {
+		return
+	}
+	hits, misses := c.hits.Swap(0), c.misses.Swap(0)
+	if hits > 0 {
+		fmt.Fprintf(os.Stderr, "✅ %d 次探测复用了 %s 内的缓存结果，%d 次重新探测\n", hits, c.ttl, misses)
+	}
+}
+
+// wrap 为 prober 加上缓存，o 为创建 prober 的参数，参数不同的探测不共用缓存；c 为 nil 时原样返回
+func (c *probeCache) wrap(prober Prober, o ProbeOptions) Prober {
+	if c == nil {
+		return prober
+	}
+	o.Cache = 0
+	return &cachingProber{Prober: prober, cache: c, signature: fmt.Sprintf("%+v", o)}
+}
+
+// cachingProber 包装真实 Prober，缓存中有未过期且没有丢包的结果时直接返回
+type cachingProber struct {
+	Prober
+	cache     *probeCache
+	signature string
+	hits      detailResults // 使用缓存结果的目标的附加结果
+	mu        sync.Mutex
+	cached    map[string]bool
+}
+
+func (p *cachingProber) key(to net.IP, sourceIP net.IP, count int, adaptive AdaptiveOptions) string {
+	return fmt.Sprintf("%s|%s|%d|%+v", p.signature, probeKey(to, sourceIP), count, adaptive)
+}
+
+func (p *cachingProber) Probe(to net.IP, sourceIP net.IP, count int, adaptive AdaptiveOptions) (*ping.Statistics, error) {
+	key := p.key(to, sourceIP, count, adaptive)
+	if e := p.cache.get(key); e != nil {
+		p.cache.hits.Add(1)
+		p.setCached(to, sourceIP, true)
+		p.hits.set(to, sourceIP, e.Details)
+		stats := *e.Stats
+		return &stats, nil
+	}
+	p.cache.misses.Add(1)
+	p.setCached(to, sourceIP, false)
+	stats, err := p.Prober.Probe(to, sourceIP, count, adaptive)
+	if err != nil {
+		return nil, err
+	}
+	var details *ProbeDetails
+	if ds, ok := p.Prober.(detailSource); ok {
+		details = ds.Details(to, sourceIP)
+	}
+	p.cache.put(key, stats, details)
+	return stats, nil
+}
+
+func (p *cachingProber) setCached(to net.IP, sourceIP net.IP, cached bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cached == nil {
+		p.cached = make(map[string]bool)
+	}
+	p.cached[probeKey(to, sourceIP)] = cached
+}
+
+// Details 使用缓存结果时返回缓存的附加结果，否则转发给真实 Prober
+func (p *cachingProber) Details(to net.IP, sourceIP net.IP) *ProbeDetails {
+	p.mu.Lock()
+	cached := p.cached[probeKey(to, sourceIP)]
+	p.mu.Unlock()
+	if cached {
+		return p.hits.Details(to, sourceIP)
+	}
+	if ds, ok := p.Prober.(detailSource); ok {
+		return ds.Details(to, sourceIP)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+// Prober 对单个目标执行一次探测并返回统计结果
+type Prober interface {
+	Probe(to net.IP, sourceIP net.IP, count int, adaptive AdaptiveOptions) (*ping.Statistics, error)
+}
+
+// ProbeDetails 部分探测方式额外提供的结果，不适用的部分为 nil
+type ProbeDetails struct {
+	Timestamps *TimestampStats // 时间戳探测和 NTP 探测的时钟偏差与单向时延
+	HTTP       *HTTPTiming     // HTTP 探测各阶段耗时
+	TCP        *TCPOutcomes    // TCP 探测建连结果分类
+	DNSAnswers []string        // DNS 探测各次应答中的 A 记录（去重排序），没有 A 记录时为 NXDOMAIN 或 NODATA，没有应答时为 nil
+	ECSAnswers []*ECSAnswer    // DNS 探测携带各客户端子网（-dns-ecs）查询的结果，按子网顺序排列，查询失败的子网缺省
+	DNSSEC     *bool           // DNS 探测（-dns-dnssec）时解析服务器是否校验 DNSSEC，无法判断时为 nil
+	PathMTU    int             // 指定 -pmtu 时到目标的路径 MTU（字节），无法探测时为 0
+}
+
+// detailSource 能提供附加结果的 Prober（时间戳、NTP、HTTP、TCP 探测及其录制、回放）
+type detailSource interface {
+	Details(to net.IP, sourceIP net.IP) *ProbeDetails
+}
+
+// detailResults 按目标IP和源IP保存附加结果，嵌入到需要提供附加结果的 Prober 中；
+// 多源探测时同一目标会从不同源IP并发探测，结果不能互相覆盖
+type detailResults struct {
+	mu      sync.Mutex
+	results map[string]*ProbeDetails
+}
+
+// Details 返回目标的附加结果，没有时为 nil
+func (r *detailResults) Details(to net.IP, sourceIP net.IP) *ProbeDetails {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.results[probeKey(to, sourceIP)]
+}
+
+func (r *detailResults) set(to net.IP, sourceIP net.IP, details *ProbeDetails) {
+	if details == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.results == nil {
+		r.results = make(map[string]*ProbeDetails)
+	}
+	r.results[probeKey(to, sourceIP)] = details
+}
+
+// probeKey 一次探测的键：目标IP + 源IP，未指定源IP时为空
+func probeKey(to net.IP, sourceIP net.IP) string {
+	return to.String() + "|" + sourceString(sourceIP)
+}
+
+// sourceString 返回源IP的字符串形式，未指定（系统默认）时为空
+func sourceString(sourceIP net.IP) string {
+	if sourceIP == nil {
+		return ""
+	}
+	return sourceIP.String()
+}
+
+// icmpIDs 一次运行内分配 ICMP 标识符：从随机起点（或 -icmp-id 指定的值）开始依次递增，同一运行中并发的探测互不相同；
+// 同一主机上并发运行的多个 dping 起点不同，原始套接字收到的对方应答会因标识符不符被丢弃，不会算作自己的
+type icmpIDs struct {
+	next atomic.Uint32
+}
+
+// newICMPIDs 创建标识符分配器，start 为 0 时使用随机起点
+func newICMPIDs(start int) *icmpIDs {
+	if start == 0 {
+		start = 1 + rand.N(1<<16-1)
+	}
+	ids := &icmpIDs{}
+	ids.next.Store(uint32(start))
+	return ids
+}
+
+// take 返回下一个标识符，超过 65535 后回绕，nil 时随机
+func (a *icmpIDs) take() int {
+	if a == nil {
+		return rand.N(1 << 16)
+	}
+	return int(uint16(a.next.Add(1) - 1))
+}
+
+// icmpProber 使用 go-ping 发送 ICMP Echo 探测
+type icmpProber struct {
+	pace time.Duration
+	ids  *icmpIDs // 为 nil 时由 go-ping 随机选择标识符
+	vrf  string   // 非空时绑定到该 VRF 设备，不经 go-ping 收发
+}
+
+func (p icmpProber) Probe(to net.IP, sourceIP net.IP, count int, adaptive AdaptiveOptions) (*ping.Statistics, error) {
+	if p.vrf != "" {
+		return p.probeDevice(to, sourceIP, count, adaptive)
+	}
+	pinger, err := ping.NewPinger(to.String())
+	if err != nil {
+		return nil, fmt.Errorf("Ping Start Error: %w", err)
+	}
+
+	// 如果获取到了本地IP，则设置为源IP
+	if sourceIP != nil {
+		pinger.Source = sourceIP.String()
+	}
+
+	pinger.SetPrivileged(true)
+	if p.ids != nil {
+		pinger.SetID(p.ids.take())
+	}
+	pinger.Count = count
+	pinger.Interval = packetInterval(p.pace, adaptive.maxPackets(count))
+	pinger.Timeout = time.Duration(count)*pinger.Interval + 5*time.Second
+	applyAdaptive(pinger, count, adaptive)
+	if err := pinger.Run(); err != nil {
+		return nil, fmt.Errorf("Ping Run Error: %w", err)
+	}
+	return pinger.Statistics(), nil
+}
@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// defaultProgressEvery 标准错误不是终端时默认输出进度的间隔
+const defaultProgressEvery = 10 * time.Second
+
+// progressSetting 非终端环境下输出进度的频率：每隔 every 或每完成 percent%，两者都为 0 时不输出
+type progressSetting struct {
+	every   time.Duration
+	percent float64
+}
+
+// parseProgress 解析 -progress：时长（如 30s）按时间间隔输出，百分比（如 10%）按完成比例输出，off 不输出，空字符串为默认间隔
+func parseProgress(s string) (progressSetting, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return progressSetting{every: defaultProgressEvery}, nil
+	case s == "off" || s == "0":
+		return progressSetting{}, nil
+	case strings.HasSuffix(s, "%"):
+		v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil || v <= 0 || v > 100 {
+			return progressSetting{}, fmt.Errorf("进度输出 -progress 中的百分比 '%s' 无效，应在 0%% 到 100%% 之间", s)
+		}
+		return progressSetting{percent: v}, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < time.Second {
+		return progressSetting{}, fmt.Errorf("进度输出 -progress '%s' 无效，可为不小于 1s 的时长（如 30s）、百分比（如 10%%）或 off", s)
+	}
+	return progressSetting{every: d}, nil
+}
+
+// progressPrinter 显示探测进度：标准错误为终端时在同一行刷新计数，否则按设置的频率逐行输出，避免日志文件中充满回车符
+type progressPrinter struct {
+	w       io.Writer
+	tty     bool
+	setting progressSetting
+	total   int // 预计的结果条数，未知时为 0
+	done    int
+	start   time.Time
+	printed int     // 上次逐行输出时的完成数
+	next    float64 // 按百分比输出时下一次输出的完成比例
+}
+
+// newProgressPrinter 创建输出到标准错误的进度显示，total 为预计的结果条数
+func newProgressPrinter(setting progressSetting, total int) *progressPrinter {
+	return &progressPrinter{
+		w:       os.Stderr,
+		tty:     term.IsTerminal(int(os.Stderr.Fd())),
+		setting: setting,
+		total:   total,
+		start:   time.Now(),
+		next:    setting.percent,
+	}
+}
+
+// ticker 按时间间隔逐行输出时返回定时器通道，其余情况返回 nil（select 中永不触发）和空的停止函数
+func (p *progressPrinter) ticker() (<-chan time.Time, func()) {
+	if p.tty || p.setting.every <= 0 {
+		return nil, func() {}
+	}
+	t := time.NewTicker(p.setting.every)
+	return t.C, t.Stop
+}
+
+// add 记录完成一条结果
+func (p *progressPrinter) add() {
+	p.done++
+	if p.tty {
+		fmt.Fprintf(p.w, "\r进度:%d", p.done)
+		return
+	}
+	if p.setting.percent > 0 && p.total > 0 && float64(p.done)*100/float64(p.total) >= p.next {
+		p.line()
+		p.next = (math.Floor(float64(p.done)*100/float64(p.total)/p.setting.percent) + 1) * p.setting.percent
+	}
+}
+
+// tick 定时输出一行进度，与上次输出相比没有变化时也输出，便于确认程序仍在运行
+func (p *progressPrinter) tick() {
+	p.line()
+}
+
+// finish 结束进度显示：终端下结束刷新的行，否则在最后一次输出之后仍有结果时补充一行
+func (p *progressPrinter) finish() {
+	if p.tty {
+		fmt.Fprintln(p.w)
+		return
+	}
+	if (p.setting.every > 0 || p.setting.percent > 0) && p.printed != p.done {
+		p.line()
+	}
+}
+
+func (p *progressPrinter) line() {
+	p.printed = p.done
+	elapsed := time.Since(p.start).Round(time.Second)
+	if p.total > 0 {
+		fmt.Fprintf(p.w, "✅ 进度 %d/%d（%.0f%%），已用时 %s\n", p.done, p.total, float64(p.done)*100/float64(p.total), elapsed)
+		return
+	}
+	fmt.Fprintf(p.w, "✅ 进度 %d，已用时 %s\n", p.done, elapsed)
+}
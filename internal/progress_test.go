@@ -0,0 +1,19 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"testing"
+)
+
+func TestValidateProgress(t *testing.T) {
+	for _, ok := range []string{"", "30s", "1m", "10%", "100%", "off", "0"} {
+		if err := internal.ValidateOutput(internal.OutputOptions{Format: "json", Progress: ok}); err != nil {
+			t.Errorf("-progress %q 应有效: %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"5", "500ms", "0%", "150%", "-1s", "fast"} {
+		if err := internal.ValidateOutput(internal.OutputOptions{Format: "json", Progress: bad}); err == nil {
+			t.Errorf("-progress %q 应报错", bad)
+		}
+	}
+}
@@ -0,0 +1,598 @@
+package internal_test
+
+import (
+	"bytes"
+	"dping/internal"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// serveDNS 在本机 UDP 端口以 rcode 应答 DNS 查询，应答中带有 answers 中的 A 记录，返回端口
+func serveDNS(t *testing.T, rcode dnsmessage.RCode, answers ...string) int {
+	return serveDNSFunc(t, func(*dnsmessage.Message) (dnsmessage.RCode, []string) { return rcode, answers })
+}
+
+// serveDNSFunc 同 serveDNS，应答的 RCODE 和 A 记录由 answer 按查询决定
+func serveDNSFunc(t *testing.T, answer func(query *dnsmessage.Message) (dnsmessage.RCode, []string)) int {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if query.Unpack(buf[:n]) != nil {
+				continue
+			}
+			rcode, ips := answer(&query)
+			query.Header.Response, query.Header.RCode = true, rcode
+			query.Answers, query.Additionals = nil, nil
+			for _, ip := range ips {
+				query.Answers = append(query.Answers, dnsmessage.Resource{
+					Header: dnsmessage.ResourceHeader{Name: query.Questions[0].Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+					Body:   &dnsmessage.AResource{A: [4]byte(net.ParseIP(ip).To4())},
+				})
+			}
+			resp, _ := query.Pack()
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestMultiProtocol(t *testing.T) {
+	dir := t.TempDir()
+	targetFile := filepath.Join(dir, "targets.txt")
+	if err := os.WriteFile(targetFile, []byte("127.0.0.1 北京 电信\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// 第二个端口的解析服务异常（SERVFAIL），该协议全部丢包
+	dnsLabel := "dns:" + strconv.Itoa(serveDNS(t, dnsmessage.RCodeSuccess))
+	failLabel := "dns:" + strconv.Itoa(serveDNS(t, dnsmessage.RCodeServerFailure))
+	probe := internal.ProbeOptions{Proto: dnsLabel + "," + failLabel}
+	outPath := filepath.Join(dir, "result.json")
+	output := internal.OutputOptions{Format: "json", NoPager: true, OutPath: outPath}
+	_, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1, Probe: probe, Targets: internal.TargetOptions{File: targetFile}, Output: output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := internal.LoadSnapshot(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(snap.Protocols, ",") != probe.Proto {
+		t.Errorf("协议标签为 %v，应为 %s", snap.Protocols, probe.Proto)
+	}
+	// 解析服务异常的协议全部丢包，不在表格中但计入核对
+	if tm := snap.Telemetry; tm == nil || tm.Scheduled != 2 || tm.Completed != 2 || tm.Unanswered != 1 || tm.Failed != 0 || tm.Skipped() != 0 {
+		t.Errorf("探测核对不符: %+v", snap.Telemetry)
+	}
+	var grouped []*internal.SummaryStatistic
+	for _, row := range snap.Rows {
+		if row.Proto == failLabel || row.Recv != 1 {
+			t.Errorf("%s 的结果不符: %+v", row.Proto, row)
+		}
+		grouped = append(grouped, row.Summary())
+	}
+
+	var out bytes.Buffer
+	renderer := &internal.TableRenderer{Theme: &internal.Theme{}, Loss: internal.LossThresholds{Warn: 5, Crit: 10}}
+	if err := renderer.Render(&out, &internal.RunResult{Snapshot: snap, Grouped: grouped}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), failLabel+" 无应答") {
+		t.Errorf("表格中应标出 %s 无应答:\n%s", failLabel, out.String())
+	}
+
+	for _, bad := range []string{"icmp,icmp", "icmp,ntp", "icmp:80,dns", "icmp,smtp"} {
+		if err := (internal.ValidateParams("all", "全国", 10, 1, 0, internal.AdaptiveOptions{}, internal.ProbeOptions{Proto: bad}, internal.TargetOptions{File: targetFile}, "loss")); err == nil {
+			t.Errorf("-proto %s 应报错", bad)
+		}
+	}
+}
+
+func TestTargetProbeOverrides(t *testing.T) {
+	dir := t.TempDir()
+	port, other := serveDNS(t, dnsmessage.RCodeSuccess), serveDNS(t, dnsmessage.RCodeSuccess)
+	writeTargets := func(content string) string {
+		path := filepath.Join(dir, "targets.txt")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	targetFile := writeTargets("127.0.0.1 北京 电信\n127.0.0.1 北京 电信 port=" + strconv.Itoa(other) + " count=2\n")
+	outPath := filepath.Join(dir, "result.json")
+	output := internal.OutputOptions{Format: "json", NoPager: true, OutPath: outPath}
+	_, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1, Probe: internal.ProbeOptions{Proto: "dns", Port: port}, Targets: internal.TargetOptions{File: targetFile}, Output: output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := internal.LoadSnapshot(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := make(map[string]int)
+	for _, row := range snap.Rows {
+		sent[row.Proto] = row.Sent
+	}
+	// 只指定端口的目标沿用 -proto，协议标签带端口；未指定的目标沿用命令行参数，协议标签为空
+	if label := "dns:" + strconv.Itoa(other); len(sent) != 2 || sent[""] != 1 || sent[label] != 2 {
+		t.Errorf("各行的协议和发包数为 %v，应为 {\"\": 1, %s: 2}", sent, label)
+	}
+
+	for _, c := range []struct {
+		proto, line string
+	}{
+		{"icmp", "127.0.0.1 proto=ntp"},
+		{"icmp", "127.0.0.1 port=53"},
+		{"icmp", "127.0.0.1 count=0"},
+		{"icmp", "127.0.0.1 北京 电信 联通 proto=dns"},
+		{"icmp,dns", "127.0.0.1 proto=tcp"},
+	} {
+		_, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1, Probe: internal.ProbeOptions{Proto: c.proto}, Targets: internal.TargetOptions{File: writeTargets(c.line + "\n")}, Output: output})
+		if err == nil {
+			t.Errorf("-proto %s 时目标 '%s' 应报错", c.proto, c.line)
+		}
+	}
+}
+
+func TestValidateICMPID(t *testing.T) {
+	for _, c := range []struct {
+		probe internal.ProbeOptions
+		ok    bool
+	}{
+		{internal.ProbeOptions{ICMPID: 4242}, true},
+		{internal.ProbeOptions{Proto: "icmp-ts", ICMPID: 65535}, true},
+		{internal.ProbeOptions{Proto: "dns,icmp", ICMPID: 1}, true},
+		{internal.ProbeOptions{ICMPID: 65536}, false},
+		{internal.ProbeOptions{Proto: "tcp", Port: 80, ICMPID: 4242}, false},
+	} {
+		err := internal.ValidateParams("all", "全国", 10, 1, 0, internal.AdaptiveOptions{}, c.probe, internal.TargetOptions{}, "loss")
+		if (err == nil) != c.ok {
+			t.Errorf("%+v: err=%v", c.probe, err)
+		}
+	}
+}
+
+func TestValidateParams(t *testing.T) {
+	type params struct {
+		isp, region string
+		concurrency int
+		count       int
+		jitter      time.Duration
+		adaptive    internal.AdaptiveOptions
+		probe       internal.ProbeOptions
+		targets     internal.TargetOptions
+		sort        string
+	}
+	valid := func(modify func(p *params)) params {
+		p := params{isp: "all", region: "全国", concurrency: 10, count: 3, sort: "loss"}
+		modify(&p)
+		return p
+	}
+	for _, c := range []struct {
+		name string
+		p    params
+		want string // 为空时应通过校验
+	}{
+		{"默认参数", valid(func(p *params) {}), ""},
+		{"排序字段的旧写法", valid(func(p *params) { p.sort = "rtt" }), ""},
+		{"运营商和地区", valid(func(p *params) { p.isp, p.region = "电信", "北京" }), ""},
+		{"自适应模式", valid(func(p *params) {
+			p.adaptive = internal.AdaptiveOptions{Enabled: true, MaxCount: 3, Threshold: time.Millisecond}
+		}), ""},
+		{"发包数量为 0", valid(func(p *params) { p.count = 0 }), "发包数量 -p 必须大于 0，当前为 0"},
+		{"并发数为 0", valid(func(p *params) { p.concurrency = 0 }), "并发数 -C 必须大于 0，当前为 0"},
+		{"分组并发数为负数", valid(func(p *params) { p.targets.Concurrency = map[string]int{"电信": -1} }), "并发数 -C 中 电信 的并发数必须大于 0，当前为 -1"},
+		{"启动偏移为负数", valid(func(p *params) { p.jitter = -time.Second }), "启动偏移 -jitter 不能为负数，当前为 -1s"},
+		{"最多发包数量小于最少发包数量", valid(func(p *params) {
+			p.adaptive = internal.AdaptiveOptions{Enabled: true, MaxCount: 2, Threshold: time.Millisecond}
+		}),
+			"自适应模式下最多发包数量 -pmax(2) 不能小于最少发包数量 -p(3)"},
+		{"置信区间阈值为 0", valid(func(p *params) { p.adaptive = internal.AdaptiveOptions{Enabled: true, MaxCount: 10} }), "置信区间阈值 -ci 必须大于 0，当前为 0s"},
+		{"发包时长为负数", valid(func(p *params) { p.probe.Pace = -time.Second }), "发包时长 -pace 不能为负数，当前为 -1s"},
+		{"发包间隔过小", valid(func(p *params) { p.count, p.probe.Pace = 20, 100*time.Millisecond }),
+			"-pace 100ms 内最多发送 20 个包，间隔 5ms 小于最小间隔 10ms"},
+		{"不支持的排序字段", valid(func(p *params) { p.sort = "false" }), "不支持的排序字段 -S 'false'"},
+		{"不支持的运营商", valid(func(p *params) { p.isp = "铁通" }), "不支持的运营商 -isp '铁通'，可选 电信|联通|移动|all"},
+		{"不存在的地区", valid(func(p *params) { p.isp, p.region = "电信", "火星" }), "区域 -dt '火星' 不存在于运营商 '电信' 中，可选 全国|"},
+		{"NTP 与测试集", valid(func(p *params) { p.probe.Proto, p.region = "ntp", internal.TestsetRegion }), "NTP 探测使用内置的服务器分组"},
+	} {
+		p := c.p
+		err := internal.ValidateParams(p.isp, p.region, p.concurrency, p.count, p.jitter, p.adaptive, p.probe, p.targets, p.sort)
+		switch {
+		case c.want == "" && err != nil:
+			t.Errorf("%s: 应通过校验，实际为 %v", c.name, err)
+		case c.want != "" && (err == nil || !strings.Contains(err.Error(), c.want)):
+			t.Errorf("%s: 错误应包含 %q，实际为 %v", c.name, c.want, err)
+		}
+	}
+}
+
+func TestGroupBy(t *testing.T) {
+	dir := t.TempDir()
+	targetFile := filepath.Join(dir, "targets.txt")
+	content := "127.0.0.1 北京 电信 dc=bj\n127.0.0.1 上海 联通 dc=sh\n127.0.0.1 天津 联通 dc=bj\n127.0.0.1 广州 移动\n"
+	if err := os.WriteFile(targetFile, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	probe := internal.ProbeOptions{Proto: "dns", Port: serveDNS(t, dnsmessage.RCodeSuccess)}
+	outPath := filepath.Join(dir, "result.json")
+	output := internal.OutputOptions{Format: "json", NoPager: true, OutPath: outPath, GroupBy: "{{.Tags.dc}}"}
+	_, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1, Probe: probe, Targets: internal.TargetOptions{File: targetFile}, Output: output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := internal.LoadSnapshot(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := make(map[string]string)
+	var grouped []*internal.SummaryStatistic
+	for _, row := range snap.Rows {
+		groups[row.Region] = row.Group
+		grouped = append(grouped, row.Summary())
+	}
+	// 没有 dc 标签的目标归入未分组
+	want := map[string]string{"北京": "bj", "上海": "sh", "天津": "bj", "广州": "未分组"}
+	for region, group := range want {
+		if groups[region] != group {
+			t.Errorf("%s 的分组为 '%s'，应为 '%s'", region, groups[region], group)
+		}
+	}
+
+	// 快照中的行按排序字段排列，与分组汇总一样按组排列后输出
+	slices.SortStableFunc(grouped, func(a, b *internal.SummaryStatistic) int { return strings.Compare(a.Group, b.Group) })
+	var out bytes.Buffer
+	renderer := &internal.TableRenderer{Theme: &internal.Theme{}, Loss: internal.LossThresholds{Warn: 5, Crit: 10}}
+	if err := renderer.Render(&out, &internal.RunResult{Snapshot: snap, Grouped: grouped}); err != nil {
+		t.Fatal(err)
+	}
+	for _, label := range []string{"bj小计", "sh小计", "未分组小计"} {
+		if !strings.Contains(out.String(), label) {
+			t.Errorf("表格中缺少 %s:\n%s", label, out.String())
+		}
+	}
+
+	for _, bad := range []string{"{{.Tags.dc", "{{.Datacenter}}"} {
+		output.GroupBy = bad
+		_, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1, Probe: probe, Targets: internal.TargetOptions{File: targetFile}, Output: output})
+		if err == nil {
+			t.Errorf("-group-by %s 应报错", bad)
+		}
+	}
+	if err := os.WriteFile(targetFile, []byte("127.0.0.1 北京 电信 1dc=bj\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output.GroupBy = ""
+	_, err = internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1, Probe: probe, Targets: internal.TargetOptions{File: targetFile}, Output: output})
+	if err == nil {
+		t.Error("标签名 1dc 应报错")
+	}
+}
+
+func TestDNSConsistency(t *testing.T) {
+	dir := t.TempDir()
+	// 广东的解析服务器返回与其他地区不同的地址
+	bj, sh, gd := serveDNS(t, dnsmessage.RCodeSuccess, "203.0.113.2", "203.0.113.1"), serveDNS(t, dnsmessage.RCodeSuccess, "203.0.113.1", "203.0.113.2"), serveDNS(t, dnsmessage.RCodeSuccess, "198.51.100.7")
+	targetFile := filepath.Join(dir, "targets.txt")
+	content := fmt.Sprintf("127.0.0.1 北京 电信 port=%d\n127.0.0.1 上海 电信 port=%d\n127.0.0.1 广东 电信 port=%d\n", bj, sh, gd)
+	if err := os.WriteFile(targetFile, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outPath := filepath.Join(dir, "result.json")
+	output := internal.OutputOptions{Format: "json", NoPager: true, OutPath: outPath}
+	_, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1, Probe: internal.ProbeOptions{Proto: "dns", Port: 53}, Targets: internal.TargetOptions{File: targetFile}, Output: output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := internal.LoadSnapshot(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range snap.DNSClusters {
+		var regions []string
+		for _, r := range c.Resolvers {
+			regions = append(regions, r.Region)
+		}
+		slices.Sort(regions)
+		got = append(got, strings.Join(c.Answers, ",")+" "+strings.Join(regions, ","))
+	}
+	// 应答中的记录顺序不同也视为相同结果
+	if want := "203.0.113.1,203.0.113.2 上海,北京|198.51.100.7 广东"; strings.Join(got, "|") != want {
+		t.Errorf("解析结果分组为 %v，应为 %s", got, want)
+	}
+
+	var out bytes.Buffer
+	renderer := &internal.TableRenderer{Theme: &internal.Theme{}, Loss: internal.LossThresholds{Warn: 5, Crit: 10}}
+	if err := renderer.Render(&out, &internal.RunResult{Snapshot: snap}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "DNS 解析一致性") || !strings.Contains(out.String(), "广东电信 127.0.0.1") {
+		t.Errorf("表格中应列出解析结果不同的解析服务器:\n%s", out.String())
+	}
+}
+
+func TestDNSECS(t *testing.T) {
+	dir := t.TempDir()
+	// 支持 ECS 的解析服务器按客户端子网的第一个字节返回不同节点，不支持的忽略 ECS
+	ecsAware := serveDNSFunc(t, func(query *dnsmessage.Message) (dnsmessage.RCode, []string) {
+		for _, r := range query.Additionals {
+			if opt, ok := r.Body.(*dnsmessage.OPTResource); ok {
+				for _, o := range opt.Options {
+					if o.Code == 8 && len(o.Data) > 4 {
+						return dnsmessage.RCodeSuccess, []string{fmt.Sprintf("198.51.100.%d", o.Data[4])}
+					}
+				}
+			}
+		}
+		return dnsmessage.RCodeSuccess, []string{"203.0.113.1"}
+	})
+	plain := serveDNS(t, dnsmessage.RCodeSuccess, "203.0.113.1")
+	targetFile := filepath.Join(dir, "targets.txt")
+	content := fmt.Sprintf("127.0.0.1 北京 电信 port=%d\n127.0.0.1 上海 电信 port=%d\n127.0.0.1 广东 联通 port=%d\n", ecsAware, ecsAware, plain)
+	if err := os.WriteFile(targetFile, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outPath := filepath.Join(dir, "result.json")
+	output := internal.OutputOptions{Format: "json", NoPager: true, OutPath: outPath}
+	probe := internal.ProbeOptions{Proto: "dns", Port: 53, ECS: "广东=113.108.0.0/24,202.96.1.1/16"}
+	_, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1, Probe: probe, Targets: internal.TargetOptions{File: targetFile}, Output: output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := internal.LoadSnapshot(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 未携带 ECS 的测量查询结果一致
+	if len(snap.DNSClusters) != 1 {
+		t.Errorf("不带 ECS 的解析结果应一致: %+v", snap.DNSClusters)
+	}
+	var got []string
+	for _, m := range snap.ECSMappings {
+		for _, c := range m.Clusters {
+			got = append(got, fmt.Sprintf("%s %s %s %d", m.Label, m.Subnet, strings.Join(c.Answers, ","), len(c.Resolvers)))
+		}
+	}
+	want := "广东 113.108.0.0/24 198.51.100.113 2|广东 113.108.0.0/24 203.0.113.1 1|202.96.0.0/16 202.96.0.0/16 198.51.100.202 2|202.96.0.0/16 202.96.0.0/16 203.0.113.1 1"
+	if strings.Join(got, "|") != want {
+		t.Errorf("ECS 解析结果为 %v，应为 %s", got, want)
+	}
+
+	var out bytes.Buffer
+	renderer := &internal.TableRenderer{Theme: &internal.Theme{}, Loss: internal.LossThresholds{Warn: 5, Crit: 10}}
+	if err := renderer.Render(&out, &internal.RunResult{Snapshot: snap}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "ECS 解析结果") || !strings.Contains(out.String(), "广东（113.108.0.0/24）") || !strings.Contains(out.String(), "广东联通 127.0.0.1") {
+		t.Errorf("表格中应列出各子网的解析结果:\n%s", out.String())
+	}
+
+	if err := internal.ValidateParams("all", "全国", 10, 1, 0, internal.AdaptiveOptions{}, internal.ProbeOptions{Proto: "icmp", ECS: "1.2.3.0/24"}, internal.TargetOptions{}, "loss"); err == nil {
+		t.Error("-proto 不含 dns 时 -dns-ecs 应报错")
+	}
+}
+
+func TestDNSSEC(t *testing.T) {
+	dir := t.TempDir()
+	// 校验签名的解析服务器对签名出错的域名返回 SERVFAIL
+	validating := serveDNSFunc(t, func(query *dnsmessage.Message) (dnsmessage.RCode, []string) {
+		if query.Questions[0].Name.String() == "dnssec-failed.org." {
+			return dnsmessage.RCodeServerFailure, nil
+		}
+		return dnsmessage.RCodeSuccess, []string{"203.0.113.1"}
+	})
+	plain := serveDNS(t, dnsmessage.RCodeSuccess, "203.0.113.1")
+	targetFile := filepath.Join(dir, "targets.txt")
+	content := fmt.Sprintf("127.0.0.1 北京 电信 port=%d\n127.0.0.1 广东 联通 port=%d\n", validating, plain)
+	if err := os.WriteFile(targetFile, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outPath := filepath.Join(dir, "result.json")
+	output := internal.OutputOptions{Format: "json", NoPager: true, OutPath: outPath}
+	_, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1, Probe: internal.ProbeOptions{Proto: "dns", Port: 53, DNSSEC: true}, Targets: internal.TargetOptions{File: targetFile}, Output: output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := internal.LoadSnapshot(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]bool)
+	var grouped []*internal.SummaryStatistic
+	for _, row := range snap.Rows {
+		if row.DNSSEC == nil {
+			t.Fatalf("%s 的解析服务器应能判断是否校验 DNSSEC", row.Region)
+		}
+		got[row.Region] = *row.DNSSEC
+		// 各目标端口不同，带协议标签时会按多协议对比表输出
+		sum := row.Summary()
+		sum.Proto = ""
+		grouped = append(grouped, sum)
+	}
+	if !got["北京"] || got["广东"] {
+		t.Errorf("DNSSEC 校验结果为 %v，应为北京校验、广东不校验", got)
+	}
+
+	var out bytes.Buffer
+	renderer := &internal.TableRenderer{Theme: &internal.Theme{}, Loss: internal.LossThresholds{Warn: 5, Crit: 10}}
+	if err := renderer.Render(&out, &internal.RunResult{Grouped: grouped}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "DNSSEC") || !strings.Contains(out.String(), "不校验") {
+		t.Errorf("表格中应有 DNSSEC 列:\n%s", out.String())
+	}
+}
+
+func TestPortSweep(t *testing.T) {
+	dir := t.TempDir()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	// 关闭监听得到一个拒绝连接的端口
+	closedLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := closedLn.Addr().(*net.TCPAddr).Port
+	closedLn.Close()
+	open := ln.Addr().(*net.TCPAddr).Port
+
+	targetFile := filepath.Join(dir, "targets.txt")
+	if err := os.WriteFile(targetFile, []byte("127.0.0.1 北京 电信\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outPath := filepath.Join(dir, "result.json")
+	output := internal.OutputOptions{Format: "json", NoPager: true, OutPath: outPath}
+	probe := internal.ProbeOptions{Proto: fmt.Sprintf("tcp:%d,tcp:%d", open, closed)}
+	_, err = internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1, Probe: probe, Targets: internal.TargetOptions{File: targetFile}, Output: output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := internal.LoadSnapshot(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var grouped []*internal.SummaryStatistic
+	for _, row := range snap.Rows {
+		grouped = append(grouped, row.Summary())
+	}
+	var out bytes.Buffer
+	renderer := &internal.TableRenderer{Theme: &internal.Theme{}, Loss: internal.LossThresholds{Warn: 5, Crit: 10}}
+	if err := renderer.Render(&out, &internal.RunResult{Snapshot: snap, Grouped: grouped}); err != nil {
+		t.Fatal(err)
+	}
+	// 拒绝连接计为收到回应，丢包率为 0，但端口不可用
+	if want := fmt.Sprintf("tcp:%d 拒绝连接", closed); !strings.Contains(out.String(), want) {
+		t.Errorf("表格中应标出 %s:\n%s", want, out.String())
+	}
+}
+
+func TestVRF(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("-vrf 只支持 Linux")
+	}
+	dir := t.TempDir()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	port := ln.Addr().(*net.TCPAddr).Port
+	dnsPort := serveDNS(t, dnsmessage.RCodeSuccess, "192.0.2.80")
+	// 绑定到 lo 后只能到达本机地址，192.0.2.1 没有经 lo 的路由
+	content := fmt.Sprintf("127.0.0.1 北京 电信 proto=tcp port=%d\n127.0.0.1 上海 联通 proto=dns port=%d\n192.0.2.1 广东 移动 proto=tcp port=%d\n", port, dnsPort, port)
+	targetFile := filepath.Join(dir, "targets.txt")
+	if err := os.WriteFile(targetFile, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outPath := filepath.Join(dir, "result.json")
+	output := internal.OutputOptions{Format: "json", NoPager: true, OutPath: outPath}
+	run := func(vrf string) error {
+		_, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1, Probe: internal.ProbeOptions{Proto: "tcp", Port: 80, VRF: vrf}, Targets: internal.TargetOptions{File: targetFile}, Output: output})
+		return err
+	}
+	if err := run("lo"); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := internal.LoadSnapshot(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recv := make(map[string]int)
+	for _, row := range snap.Rows {
+		recv[row.Region] = row.Recv
+	}
+	if recv["北京"] != 1 || recv["上海"] != 1 || recv["广东"] != 0 {
+		t.Errorf("绑定到 lo 时各目标收到的回应为 %v，应只有本机地址可达", recv)
+	}
+	if err := run("no-such-vrf"); err == nil || !strings.Contains(err.Error(), "no-such-vrf") {
+		t.Errorf("不存在的 VRF 设备应报错，实际为 %v", err)
+	}
+}
+
+func TestNetns(t *testing.T) {
+	if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+		t.Skip("-netns 需要 Linux 和 root 权限")
+	}
+	dir := t.TempDir()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.NotFoundHandler()}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	targetFile := filepath.Join(dir, "targets.txt")
+	if err := os.WriteFile(targetFile, []byte("127.0.0.1 北京 电信\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outPath := filepath.Join(dir, "result.json")
+	output := internal.OutputOptions{Format: "json", NoPager: true, OutPath: outPath}
+	run := func(netns string) error {
+		probe := internal.ProbeOptions{Proto: "http", Port: ln.Addr().(*net.TCPAddr).Port, Netns: netns}
+		_, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1, Probe: probe, Targets: internal.TargetOptions{File: targetFile}, Output: output})
+		return err
+	}
+	// 当前进程所在的命名空间：经过切换命名空间的流程，仍能访问本机的服务
+	if err := run("/proc/self/ns/net"); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := internal.LoadSnapshot(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Rows) != 1 || snap.Rows[0].Recv != 1 {
+		t.Errorf("在当前命名空间中探测应收到响应: %+v", snap.Rows)
+	}
+	if err := run("no-such-netns"); err == nil || !strings.Contains(err.Error(), "no-such-netns") {
+		t.Errorf("不存在的网络命名空间应报错，实际为 %v", err)
+	}
+}
+
+func TestPathMTU(t *testing.T) {
+	if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+		t.Skip("-pmtu 需要 Linux 和 root 权限")
+	}
+	dir := t.TempDir()
+	targetFile := filepath.Join(dir, "targets.txt")
+	if err := os.WriteFile(targetFile, []byte("127.0.0.1 北京 电信\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outPath := filepath.Join(dir, "result.json")
+	output := internal.OutputOptions{Format: "json", NoPager: true, OutPath: outPath}
+	_, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1, Probe: internal.ProbeOptions{PMTU: true}, Targets: internal.TargetOptions{File: targetFile}, Output: output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := internal.LoadSnapshot(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 回环网卡的 MTU 远大于 1500，探测上限为 1500
+	if len(snap.Rows) != 1 || snap.Rows[0].PathMTU != 1500 {
+		t.Errorf("到回环地址的路径 MTU 应为 1500: %+v", snap.Rows)
+	}
+}
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// parseProxyURL 解析代理地址，支持 socks5://、socks5h:// 和 http:// 三种形式，可带 user:pass@
+func parseProxyURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("代理地址 -proxy '%s' 无法解析: %v", raw, err)
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h", "http":
+	default:
+		return nil, fmt.Errorf("不支持的代理类型 '%s'，可选 socks5://host:port 或 http://host:port", u.Scheme)
+	}
+	if u.Hostname() == "" || u.Port() == "" {
+		return nil, fmt.Errorf("代理地址 -proxy '%s' 缺少主机或端口", raw)
+	}
+	return u, nil
+}
+
+// newProxyDialer 返回经代理建立 TCP 连接的 Dialer，forward 为到代理本身的连接方式（可指定源IP）
+func newProxyDialer(u *url.URL, forward *net.Dialer) (proxy.ContextDialer, error) {
+	if u.Scheme == "http" {
+		return &connectDialer{proxy: u, forward: forward}, nil
+	}
+	d, err := proxy.FromURL(u, forward)
+	if err != nil {
+		return nil, fmt.Errorf("创建代理 %s 失败: %v", u.Redacted(), err)
+	}
+	return d.(proxy.ContextDialer), nil
+}
+
+// connectDialer 通过 HTTP CONNECT 隧道建立 TCP 连接
+type connectDialer struct {
+	proxy   *url.URL
+	forward *net.Dialer
+}
+
+func (d *connectDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func (d *connectDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.forward.DialContext(ctx, "tcp", d.proxy.Host)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user := d.proxy.User; user != nil {
+		password, _ := user.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("代理 %s 的应答无效: %v", d.proxy.Host, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("代理拒绝连接 %s: %s", addr, resp.Status)
+	}
+	// 代理紧跟在应答头之后发来的数据已读入缓冲区，从缓冲区继续读
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn 先读出缓冲区中剩余数据的连接
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
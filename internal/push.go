@@ -0,0 +1,190 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pushBackoff 推送失败后第一次重试前的等待，之后每次加倍
+var pushBackoff = time.Second
+
+// errPushSuperseded 持续探测时上一轮的推送在下一轮结束时仍未完成
+var errPushSuperseded = errors.New("下一轮结果已产生，不再推送本轮结果")
+
+// PushOptions 每轮结束后将结果（与 -format json 相同的快照）推送到 HTTP 地址的参数
+type PushOptions struct {
+	URLs    string // 逗号分隔的 http(s) 地址，为空时不推送
+	Secret  string // 非空时以 HMAC-SHA256 签名，签名放在 X-Dping-Signature 请求头
+	Retries int    // 连接失败或返回 5xx、429 时的重试次数
+}
+
+// urls 拆分后的推送地址
+func (o PushOptions) urls() []string {
+	var list []string
+	for _, u := range strings.Split(o.URLs, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			list = append(list, u)
+		}
+	}
+	return list
+}
+
+// validate 校验推送参数
+func (o PushOptions) validate() error {
+	for _, s := range o.urls() {
+		if u, err := url.Parse(s); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("推送地址 -push 必须是 http(s) 地址，当前为 '%s'", s)
+		}
+	}
+	if o.Retries < 0 {
+		return fmt.Errorf("推送重试次数 -push-retries 不能为负数，当前为 %d", o.Retries)
+	}
+	if o.Secret != "" && len(o.urls()) == 0 {
+		return fmt.Errorf("-push-secret 需要同时指定 -push")
+	}
+	return nil
+}
+
+// pusher 将每轮结果 POST 到各推送地址
+type pusher struct {
+	urls    []string
+	secret  []byte
+	retries int
+	client  *http.Client
+
+	cancel context.CancelCauseFunc // PushAsync 正在进行的推送
+	done   chan struct{}
+}
+
+// newPusher 按参数创建推送，未指定推送地址时返回 nil
+func newPusher(o PushOptions) *pusher {
+	urls := o.urls()
+	if len(urls) == 0 {
+		return nil
+	}
+	return &pusher{urls: urls, secret: []byte(o.Secret), retries: o.Retries, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Push 并发推送到各地址，全部完成（成功或重试用尽）后返回；失败只记录日志，不影响探测；p 为 nil 时忽略
+func (p *pusher) Push(snap *Snapshot) {
+	if p == nil {
+		return
+	}
+	p.push(context.Background(), snap)
+}
+
+// PushAsync 在后台推送并立即返回，持续探测时使用：上一轮的推送仍未完成（如在重试）时先取消，只推送最新一轮的结果，
+// 因此每轮的推送最多持续到下一轮结束，不会推迟下一轮探测；p 为 nil 时忽略。只能在一个 goroutine 中调用
+func (p *pusher) PushAsync(snap *Snapshot) {
+	if p == nil {
+		return
+	}
+	if p.cancel != nil {
+		p.cancel(errPushSuperseded)
+		<-p.done
+	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	done := make(chan struct{})
+	p.cancel, p.done = cancel, done
+	go func() {
+		defer close(done)
+		p.push(ctx, snap)
+	}()
+}
+
+// Wait 等待 PushAsync 的推送完成，持续探测结束时使用，让最后一轮的结果也推送出去；p 为 nil 时忽略
+func (p *pusher) Wait() {
+	if p == nil || p.done == nil {
+		return
+	}
+	<-p.done
+}
+
+// push 并发推送到各地址，全部完成或 ctx 取消后返回
+func (p *pusher) push(ctx context.Context, snap *Snapshot) {
+	body, err := json.Marshal(snap)
+	if err != nil {
+		log.Printf("⚠️  推送结果失败: %v\n", err)
+		return
+	}
+	var wg sync.WaitGroup
+	for _, u := range p.urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.post(ctx, u, body); err != nil {
+				log.Printf("⚠️  %v\n", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// post 推送到一个地址，连接失败或服务端暂时不可用（5xx、429）时按 pushBackoff 加倍等待后重试，ctx 取消时放弃
+func (p *pusher) post(ctx context.Context, u string, body []byte) error {
+	backoff := pushBackoff
+	var err error
+	for attempt := 0; attempt <= p.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("推送到 %s 未完成: %v", u, context.Cause(ctx))
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		var retry bool
+		if retry, err = p.postOnce(ctx, u, body); err == nil || !retry {
+			return err
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("推送到 %s 未完成: %v", u, context.Cause(ctx))
+		}
+	}
+	return fmt.Errorf("%v（已重试 %d 次）", err, p.retries)
+}
+
+// postOnce 推送一次，retry 表示失败可以重试
+func (p *pusher) postOnce(ctx context.Context, u string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("推送到 %s 失败: %v", u, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(p.secret) > 0 {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Dping-Timestamp", ts)
+		req.Header.Set("X-Dping-Signature", "sha256="+PushSignature(p.secret, ts, body))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("推送到 %s 失败: %v", u, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests, fmt.Errorf("推送到 %s 失败: %s", u, resp.Status)
+	}
+	return false, nil
+}
+
+// PushSignature 推送请求的签名：以 secret 为密钥对 "时间戳.请求体" 计算 HMAC-SHA256，十六进制表示；
+// 接收方按同样方式计算并比较，同时检查 X-Dping-Timestamp 与当前时间相差不大，防止请求被重放
+func PushSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,117 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPush(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { target.Close() })
+
+	// 第一次返回 503，重试后成功
+	var mu sync.Mutex
+	var bodies [][]byte
+	var signatures []string
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		bodies = append(bodies, body)
+		if internal.PushSignature([]byte("s3cret"), r.Header.Get("X-Dping-Timestamp"), body) == r.Header.Get("X-Dping-Signature")[len("sha256="):] {
+			signatures = append(signatures, "ok")
+		}
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+
+	targetFile := filepath.Join(t.TempDir(), "targets.txt")
+	if err := os.WriteFile(targetFile, []byte("127.0.0.1 北京 电信\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	probe := internal.ProbeOptions{Proto: "tcp", Port: target.Addr().(*net.TCPAddr).Port}
+	push := internal.PushOptions{URLs: "http://" + ln.Addr().String() + "/dping", Secret: "s3cret", Retries: 1}
+	_, err = internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1, Probe: probe, Targets: internal.TargetOptions{File: targetFile}, Output: internal.OutputOptions{Format: "json", NoPager: true, OutPath: os.DevNull}, Watch: internal.WatchOptions{Push: push}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 2 || len(signatures) != 2 {
+		t.Fatalf("应推送 2 次（含 1 次重试）且签名有效，实际推送 %d 次，有效签名 %d 个", len(bodies), len(signatures))
+	}
+	var snap internal.Snapshot
+	if err := json.Unmarshal(bodies[1], &snap); err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Rows) != 1 || snap.Rows[0].DestIP != "127.0.0.1" {
+		t.Errorf("推送的结果不完整: %+v", snap.Rows)
+	}
+
+	for _, bad := range []internal.PushOptions{{URLs: "ftp://example.com"}, {URLs: "http://example.com", Retries: -1}, {Secret: "s3cret"}} {
+		if err := internal.ValidateWatch(internal.WatchOptions{Push: bad}); err == nil {
+			t.Errorf("%+v 应报错", bad)
+		}
+	}
+}
+
+func TestPushAsyncSuperseded(t *testing.T) {
+	// 第一轮的推送一直得不到应答，第二轮的推送立即成功
+	received := make(chan string, 4)
+	canceled := make(chan struct{})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var snap internal.Snapshot
+		json.NewDecoder(r.Body).Decode(&snap)
+		received <- snap.RunID
+		if snap.RunID == "run-1" {
+			<-r.Context().Done()
+			close(canceled)
+		}
+	})}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+
+	p := internal.NewPusher(internal.PushOptions{URLs: "http://" + ln.Addr().String() + "/dping", Retries: 3})
+	p.PushAsync(&internal.Snapshot{RunID: "run-1"})
+	if got := <-received; got != "run-1" {
+		t.Fatalf("应先推送第一轮，实际为 %s", got)
+	}
+	// 下一轮结束时取代仍未完成的推送，不等待其超时和重试
+	start := time.Now()
+	p.PushAsync(&internal.Snapshot{RunID: "run-2"})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("取代上一轮的推送用时 %s，不应等待其超时和重试", elapsed)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("上一轮的推送应被取消")
+	}
+	p.Wait()
+	if got := <-received; got != "run-2" {
+		t.Errorf("应推送第二轮，实际为 %s", got)
+	}
+	if len(received) != 0 {
+		t.Errorf("被取代的推送不应重试，多收到 %d 次推送", len(received))
+	}
+}
@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// lossTolerance 丢包率相差不超过该百分点时视为相同，改为比较平均 RTT
+const lossTolerance = 0.5
+
+// SourceRecommendation 多源探测时某个运营商的推荐出口：Sources 按优先顺序排列，第一个为推荐的源
+type SourceRecommendation struct {
+	Isp       string         `json:"isp"`
+	Preferred string         `json:"preferred"`
+	Sources   []*SourceScore `json:"sources"`
+}
+
+// SourceScore 某个源IP到一个运营商全部目标的综合结果，差值均相对推荐的源
+type SourceScore struct {
+	Source      string  `json:"source"`
+	Interface   string  `json:"interface,omitempty"`
+	Targets     int     `json:"targets"`
+	Reached     int     `json:"reached"`
+	LossPercent float64 `json:"loss_percent"`
+	AvgRttMs    float64 `json:"avg_rtt_ms"`
+	LossDelta   float64 `json:"loss_delta"`
+	RttDeltaMs  float64 `json:"rtt_delta_ms"`
+}
+
+// recommendSources 按运营商汇总各源IP的结果并给出推荐：丢包率低者优先，相差不超过 lossTolerance 时平均 RTT 低者优先。
+// 某个源下没有结果的目标（全部丢包或探测失败）按 100% 丢包计；目标有权重时丢包率和平均 RTT 按权重计算。
+// interfaces 为源IP到网卡名的映射
+func recommendSources(rows []*SnapshotRow, interfaces map[string]string) []*SourceRecommendation {
+	type acc struct {
+		reached int
+		weight  float64 // 有结果的目标的权重之和
+		loss    float64 // 丢包率按权重之和
+		recv    float64 // 收包数按权重之和
+		rtt     float64
+	}
+	sources := make(map[string]bool)
+	targets := make(map[string]map[string]float64) // 运营商 -> 目标IP -> 权重
+	perIsp := make(map[string]map[string]*acc)     // 运营商 -> 源IP -> 汇总
+	counted := make(map[string]bool)
+	for _, row := range rows {
+		sources[row.Source] = true
+		if targets[row.Isp] == nil {
+			targets[row.Isp] = make(map[string]float64)
+			perIsp[row.Isp] = make(map[string]*acc)
+		}
+		// 同一IP以多个地区标签出现时只统计一次，权重取第一个标签的
+		if _, ok := targets[row.Isp][row.DestIP]; !ok {
+			targets[row.Isp][row.DestIP] = targetWeight(row.Weight)
+		}
+		// 探测出错的行与没有结果相同，按全部丢包计
+		if row.Error != "" {
+			continue
+		}
+		key := row.Isp + "|" + row.DestIP + "|" + row.Source
+		if counted[key] {
+			continue
+		}
+		counted[key] = true
+		a, ok := perIsp[row.Isp][row.Source]
+		if !ok {
+			a = &acc{}
+			perIsp[row.Isp][row.Source] = a
+		}
+		w := targets[row.Isp][row.DestIP]
+		a.reached++
+		a.weight += w
+		a.loss += w * row.LossPercent
+		a.recv += w * float64(row.Recv)
+		a.rtt += w * row.AvgRttMs * float64(row.Recv)
+	}
+	if len(sources) < 2 {
+		return nil
+	}
+
+	var result []*SourceRecommendation
+	for isp, bySource := range perIsp {
+		total := len(targets[isp])
+		var totalWeight float64
+		for _, w := range targets[isp] {
+			totalWeight += w
+		}
+		rec := &SourceRecommendation{Isp: isp}
+		for src := range sources {
+			score := &SourceScore{Source: src, Interface: interfaces[src], Targets: total}
+			if a, ok := bySource[src]; ok {
+				score.Reached = a.reached
+				score.LossPercent = (a.loss + (totalWeight-a.weight)*100) / totalWeight
+				if a.recv > 0 {
+					score.AvgRttMs = a.rtt / a.recv
+				}
+			} else {
+				score.LossPercent = 100
+			}
+			rec.Sources = append(rec.Sources, score)
+		}
+		sort.Slice(rec.Sources, func(i, j int) bool {
+			a, b := rec.Sources[i], rec.Sources[j]
+			if d := a.LossPercent - b.LossPercent; d > lossTolerance || d < -lossTolerance {
+				return d < 0
+			}
+			if a.AvgRttMs != b.AvgRttMs {
+				// 没有收到回包的源排在后面
+				return b.AvgRttMs == 0 || (a.AvgRttMs != 0 && a.AvgRttMs < b.AvgRttMs)
+			}
+			return a.Source < b.Source
+		})
+		best := rec.Sources[0]
+		rec.Preferred = best.Source
+		for _, s := range rec.Sources {
+			s.LossDelta = s.LossPercent - best.LossPercent
+			s.RttDeltaMs = s.AvgRttMs - best.AvgRttMs
+		}
+		result = append(result, rec)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Isp < result[j].Isp })
+	return result
+}
+
+// label 显示用的源名称：有网卡名时为 网卡(IP)
+func (s *SourceScore) label() string {
+	if s.Interface == "" {
+		return s.Source
+	}
+	return fmt.Sprintf("%s(%s)", s.Interface, s.Source)
+}
+
+// printRecommendations 输出各运营商的推荐出口及与次优源的差值
+func (r *TableRenderer) printRecommendations(w io.Writer, recs []*SourceRecommendation) {
+	fmt.Fprintln(w, "====== 多线路推荐 ======")
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"运营商", "推荐源", "丢包%", "AvgRTT", "次优源", "丢包差", "RTT差"})
+	table.SetAutoFormatHeaders(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetBorder(false)
+	table.SetColumnSeparator(" ")
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	for _, rec := range recs {
+		best, next := rec.Sources[0], rec.Sources[1]
+		table.Append([]string{
+			r.Theme.color(r.Theme.colorForISP(rec.Isp), rec.Isp),
+			r.Theme.color(r.Theme.Good, best.label()),
+			fmt.Sprintf("%.1f%%", best.LossPercent),
+			fmt.Sprintf("%.1fms", best.AvgRttMs),
+			next.label(),
+			fmt.Sprintf("%+.1f%%", next.LossDelta),
+			fmt.Sprintf("%+.1fms", next.RttDeltaMs),
+		})
+	}
+	table.Render()
+}
+
+// recommendationFile -recommend-out 输出的文件格式，供自动化切换出口使用
+type recommendationFile struct {
+	SchemaVersion   int                     `json:"schema_version"`
+	CreatedAt       time.Time               `json:"created_at"`
+	RunID           string                  `json:"run_id,omitempty"`
+	Recommendations []*SourceRecommendation `json:"recommendations"`
+}
+
+// SaveRecommendations 将快照中的推荐结果单独写入 JSON 文件；单源探测时没有推荐，返回错误
+func SaveRecommendations(path string, snap *Snapshot) error {
+	if len(snap.Recommendations) == 0 {
+		return fmt.Errorf("只有一个源IP的结果，没有可输出的多线路推荐，请用 -eth 指定多个网卡")
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建推荐文件 %s 失败: %v", path, err)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(&recommendationFile{
+		SchemaVersion:   SchemaVersion,
+		CreatedAt:       snap.CreatedAt,
+		RunID:           snap.RunID,
+		Recommendations: snap.Recommendations,
+	}); err != nil {
+		return fmt.Errorf("写入推荐文件 %s 失败: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,901 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/olekukonko/tablewriter"
+	"golang.org/x/term"
+)
+
+// RunResult 一次运行的报告：运行元数据、各部分的结果以及各部分的合计，供各 Renderer 输出；
+// 合计由 newRunResult 计算一次，各 Renderer 直接使用，不再逐行重新累加
+type RunResult struct {
+	Snapshot *Snapshot           // 运行元数据与结构化结果
+	Rows     []*SummaryStatistic // 按 -S 排序的全部结果
+	Grouped  []*SummaryStatistic // 按运营商分组后排序的结果
+	LossOnly []*SummaryStatistic // 分组结果中丢包率不为 0 的部分
+	Totals   *ReportTotals       // 汇总表和丢包表的总计及按运营商的小计，为 nil 时由 totals 按需计算
+}
+
+// newRunResult 生成运行报告并计算各部分的合计，snap 非空时合计同时写入快照
+func newRunResult(snap *Snapshot, rows, grouped, lossOnly []*SummaryStatistic) *RunResult {
+	result := &RunResult{Snapshot: snap, Rows: rows, Grouped: grouped, LossOnly: lossOnly}
+	result.Totals = result.totals()
+	if snap != nil {
+		snap.Totals = result.Totals
+	}
+	return result
+}
+
+// totals 报告的合计；直接构造（未经 newRunResult）的报告在这里计算
+func (r *RunResult) totals() *ReportTotals {
+	if r.Totals != nil {
+		return r.Totals
+	}
+	return &ReportTotals{Summary: sectionTotals(r.Grouped), LossOnly: sectionTotals(r.LossOnly)}
+}
+
+// Renderer 将一次探测的结果输出到 w
+type Renderer interface {
+	Render(w io.Writer, result *RunResult) error
+}
+
+// newRenderer 根据输出参数选择 Renderer，模板等参数错误在探测开始前返回
+func newRenderer(output OutputOptions) (Renderer, error) {
+	budget, err := lookupBudget(output.Budget)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ParseScoreWeights(output.ScoreWeights); err != nil {
+		return nil, err
+	}
+	if _, err := parseProgress(output.Progress); err != nil {
+		return nil, err
+	}
+	if err := validateGeoFrom(output.GeoFrom); err != nil {
+		return nil, err
+	}
+	if err := validateLocalIsp(output.LocalIsp); err != nil {
+		return nil, err
+	}
+	if _, err := parseGroupBy(output.GroupBy); err != nil {
+		return nil, err
+	}
+	aggregate, err := parseAggregate(output.Aggregate)
+	if err != nil {
+		return nil, err
+	}
+	switch output.Format {
+	case "", "table":
+		theme, err := lookupTheme(output.Theme, output.IspColors)
+		if err != nil {
+			return nil, err
+		}
+		if err := output.Loss.validate(); err != nil {
+			return nil, err
+		}
+		renderer := &TableRenderer{Theme: theme, Loss: output.Loss, Budget: budget, Aggregate: aggregate, GeoFrom: output.GeoFrom}
+		if !output.Wide {
+			renderer.Width = terminalWidth()
+		}
+		return renderer, nil
+	case "json":
+		return jsonRenderer{}, nil
+	case "csv":
+		return csvRenderer{}, nil
+	case "html":
+		if err := output.Loss.validate(); err != nil {
+			return nil, err
+		}
+		return htmlRenderer{Loss: output.Loss, Aggregate: aggregate}, nil
+	case "template":
+		tmpl, err := parseTemplateOutput(output.Template, output.RunTemplate)
+		if err != nil {
+			return nil, err
+		}
+		return tmpl, nil
+	default:
+		return nil, fmt.Errorf("不支持的输出格式 '%s'，可选 table|json|csv|html|template", output.Format)
+	}
+}
+
+// jsonRenderer 以版本化 JSON 格式输出结果
+type jsonRenderer struct{}
+
+func (jsonRenderer) Render(w io.Writer, result *RunResult) error {
+	return writeSnapshot(w, result.Snapshot)
+}
+
+// Render 按模板输出结果
+func (t *templateOutput) Render(w io.Writer, result *RunResult) error {
+	snap := result.Snapshot
+	return t.execute(w, &TemplateData{
+		CreatedAt: snap.CreatedAt,
+		RunID:     snap.RunID,
+		Host:      snap.Host,
+		Source:    snap.Source,
+		Isp:       snap.Isp,
+		Region:    snap.Region,
+		Count:     snap.Count,
+		Note:      snap.Note,
+		Rows:      result.Rows,
+		Totals:    result.totals(),
+	})
+}
+
+// LossThresholds 丢包率着色阈值（百分比）：低于 Warn 为正常，低于 Crit 为告警，其余为严重
+type LossThresholds struct {
+	Warn float64
+	Crit float64
+}
+
+// level 丢包率所在的级别：0 正常，1 告警，2 严重
+func (l LossThresholds) level(loss float64) int {
+	switch {
+	case loss < l.Warn:
+		return 0
+	case loss < l.Crit:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func (l LossThresholds) validate() error {
+	if l.Warn <= 0 || l.Crit > 100 {
+		return fmt.Errorf("丢包阈值 -loss-warn/-loss-crit 必须在 0 到 100 之间（告警阈值大于 0），当前为 %.1f%%/%.1f%%", l.Warn, l.Crit)
+	}
+	if l.Warn >= l.Crit {
+		return fmt.Errorf("丢包告警阈值 -loss-warn(%.1f%%) 必须小于严重阈值 -loss-crit(%.1f%%)", l.Warn, l.Crit)
+	}
+	return nil
+}
+
+// Theme 表格配色方案
+type Theme struct {
+	Good  string            // 丢包正常
+	Warn  string            // 丢包告警
+	Bad   string            // 丢包严重
+	Isp   map[string]string // 运营商名称着色
+	Reset string
+	Marks [3]string // 丢包正常、告警、严重时加在丢包率前的符号，为空时只靠颜色区分
+}
+
+// themes 可选的配色方案
+var themes = map[string]*Theme{
+	"default": {
+		Good: "\x1b[32m",
+		Warn: "\x1b[33m",
+		Bad:  "\x1b[31m",
+		Isp: map[string]string{
+			"联通": "\033[38;2;0;180;255m",
+			"移动": "\033[38;2;144;86;255m",
+			"电信": "\033[38;2;57;255;20m",
+		},
+		Reset: "\x1b[0m",
+	},
+	// 色盲友好配色（Okabe-Ito 调色板），避免红绿对比
+	"colorblind": {
+		Good: "\033[38;2;86;180;233m",
+		Warn: "\033[38;2;230;159;0m",
+		Bad:  "\033[1;38;2;213;94;0m",
+		Isp: map[string]string{
+			"联通": "\033[38;2;0;114;178m",
+			"移动": "\033[38;2;204;121;167m",
+			"电信": "\033[38;2;0;158;115m",
+		},
+		Reset: "\x1b[0m",
+	},
+	// 高对比度单色：不靠颜色区分，丢包率前加符号，严重的加粗
+	"mono": {
+		Bad:   "\x1b[1m",
+		Isp:   map[string]string{},
+		Reset: "\x1b[0m",
+		Marks: [3]string{"✔", "△", "✖"},
+	},
+	// 不输出任何颜色码
+	"none": {
+		Isp: map[string]string{},
+	},
+}
+
+// lookupTheme 按名称选择配色方案，ispColors 非空时（如 电信=#39ff14,联通=#00b4ff）覆盖其中运营商的颜色
+func lookupTheme(name string, ispColors string) (*Theme, error) {
+	theme, ok := themes[name]
+	if !ok {
+		return nil, fmt.Errorf("不支持的主题 '%s'，可选 default|colorblind|mono|none", name)
+	}
+	if ispColors == "" {
+		return theme, nil
+	}
+	if len(theme.Isp) == 0 {
+		return nil, fmt.Errorf("-isp-colors 不能与不区分运营商颜色的主题 %s 同时使用", name)
+	}
+	custom := *theme
+	custom.Isp = maps.Clone(theme.Isp)
+	for _, part := range strings.Split(ispColors, ",") {
+		isp, hex, ok := strings.Cut(strings.TrimSpace(part), "=")
+		isp, hex = strings.TrimSpace(isp), strings.TrimSpace(hex)
+		if !ok || isp == "" || !hexColor.MatchString(hex) {
+			return nil, fmt.Errorf("运营商配色 -isp-colors 中 '%s' 无效，格式为 电信=#39ff14,联通=#00b4ff", part)
+		}
+		rgb, _ := strconv.ParseUint(hex[1:], 16, 32)
+		custom.Isp[isp] = fmt.Sprintf("\033[38;2;%d;%d;%dm", rgb>>16, rgb>>8&0xff, rgb&0xff)
+	}
+	return &custom, nil
+}
+
+// hexColor -isp-colors 中的颜色格式
+var hexColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// color 用颜色码包裹文本，颜色为空时原样返回
+func (t *Theme) color(code, text string) string {
+	if code == "" {
+		return text
+	}
+	return code + text + t.Reset
+}
+
+func (t *Theme) colorForISP(isp string) string {
+	if c, ok := t.Isp[isp]; ok {
+		return c
+	}
+	return t.Isp["联通"]
+}
+
+func (t *Theme) colorForPacketLoss(loss float64, thresholds LossThresholds) string {
+	return [3]string{t.Good, t.Warn, t.Bad}[thresholds.level(loss)]
+}
+
+// packetLoss 按阈值着色丢包率文本，主题有符号时加在文本前；不加空格，避免表格在空格处折行
+func (t *Theme) packetLoss(loss float64, thresholds LossThresholds, text string) string {
+	return t.color(t.colorForPacketLoss(loss, thresholds), t.Marks[thresholds.level(loss)]+text)
+}
+
+// TableRenderer 以 ANSI 着色表格输出汇总结果和丢包汇总结果
+type TableRenderer struct {
+	Theme  *Theme
+	Loss   LossThresholds
+	Budget *Budget // 非空时按时延预算着色 AvgRTT 并追加达标列
+	Width  int     // 最大输出宽度，0 表示不限制
+	// GeoFrom 非空时为探测节点所在省份，追加按地理距离估算的预期 RTT 和偏差列
+	GeoFrom string
+	// Aggregate 非空时同一模板结果的多个目标汇总为一行（按服务汇总），代替逐个目标的汇总表
+	Aggregate *template.Template
+}
+
+func (r *TableRenderer) Render(w io.Writer, result *RunResult) error {
+	if result.Snapshot != nil && result.Snapshot.Note != "" {
+		fmt.Fprintf(w, "备注: %s\n", result.Snapshot.Note)
+	}
+	if result.Snapshot != nil {
+		for _, gw := range result.Snapshot.Gateways {
+			text := gw.String()
+			if !gw.Reachable {
+				text = r.Theme.Bad + text + r.Theme.Reset
+			}
+			fmt.Fprintln(w, text)
+		}
+	}
+	totals := result.totals()
+	if r.Aggregate != nil {
+		// 按服务汇总时有丢包的目标仍逐个列出，便于定位服务中的哪个目标出了问题
+		fmt.Fprintln(w, "====== 按服务汇总结果 ======")
+		r.printAggregates(w, aggregateServices(r.Aggregate, result.Rows), false)
+		fmt.Fprintln(w, "====== 丢包汇总统计结果 ======")
+		r.printSummaryList(w, result.LossOnly, totals.LossOnly)
+	} else if protocols := resultProtocols(result); len(protocols) > 1 {
+		// 多协议或多源探测时每个目标一行、每个协议或源一组列，便于直接对比
+		fmt.Fprintln(w, "====== 多协议对比结果 ======")
+		r.printProtoPivot(w, result.Grouped, protocols, false)
+		fmt.Fprintln(w, "====== 丢包多协议对比结果 ======")
+		r.printProtoPivot(w, result.Grouped, protocols, true)
+	} else if multiSource(result.Grouped) {
+		sources := summarySources(result.Grouped)
+		fmt.Fprintln(w, "====== 多源对比结果 ======")
+		r.printSourcePivot(w, result.Grouped, sources, false)
+		fmt.Fprintln(w, "====== 丢包多源对比结果 ======")
+		r.printSourcePivot(w, result.Grouped, sources, true)
+	} else {
+		fmt.Fprintln(w, "====== 汇总统计结果 ======")
+		r.printSummaryList(w, result.Grouped, totals.Summary)
+		fmt.Fprintln(w, "====== 丢包汇总统计结果 ======")
+		r.printSummaryList(w, result.LossOnly, totals.LossOnly)
+	}
+	if result.Snapshot != nil && result.Snapshot.Budget != nil {
+		r.printBudget(w, result.Snapshot.Budget)
+	}
+	if result.Snapshot != nil && len(result.Snapshot.Recommendations) > 0 {
+		r.printRecommendations(w, result.Snapshot.Recommendations)
+	}
+	if result.Snapshot != nil && len(result.Snapshot.DNSClusters) > 0 {
+		r.printDNSClusters(w, result.Snapshot.DNSClusters)
+	}
+	if result.Snapshot != nil && len(result.Snapshot.ECSMappings) > 0 {
+		r.printECSMappings(w, result.Snapshot.ECSMappings)
+	}
+	return nil
+}
+
+// lowPriorityColumns 终端宽度不足时依次隐藏的列
+var lowPriorityColumns = []string{"更新时间", "重传", "评分", "MinRTT", "MaxRTT"}
+
+// 打印排序后结果，totals 为该列表的合计（见 sectionTotals），用于小计和总计行
+func (r *TableRenderer) printSummaryList(w io.Writer, summaryList []*SummaryStatistic, totals *SectionTotals) {
+	header := []string{
+		"目标IP", "地区", "运营商",
+		"发", "收", "丢包%", "重传",
+		"MinRTT", "MaxRTT", "AvgRTT", "评分", "更新时间",
+	}
+	// 交互界面中多源探测的结果逐行显示，追加源IP列区分
+	withSource := multiSource(summaryList)
+	if withSource {
+		header = append(header, "源IP")
+	}
+	// 目标文件中单独指定了探测方式的行追加协议列
+	withProto := summaryHasProto(summaryList)
+	if withProto {
+		header = append(header, "协议")
+	}
+	// 指定了 -group-by 时追加分组列
+	withGroup := summaryHasGroup(summaryList)
+	if withGroup {
+		header = append(header, "分组")
+	}
+	// 持续探测时追加连续丢包轮数列，间歇中断在平均丢包率中看不出来
+	withStreak := summaryHasLossStreak(summaryList)
+	if withStreak {
+		header = append(header, "连丢", "最长连丢")
+	}
+
+	formatDuration := func(d time.Duration) string {
+		ms := float64(d) / float64(time.Millisecond)
+		return fmt.Sprintf("%.1fms", ms)
+	}
+
+	// 时间戳/NTP 探测有结果时追加时钟偏差和单向时延列，HTTP 探测追加分阶段耗时列，TCP 探测追加建连失败分类列，
+	// DNS 探测检查了 DNSSEC 时追加是否校验列，探测了路径 MTU 时追加 PMTU 列
+	withTimestamps, withHTTP, withTCP, withDNSSEC, withPMTU := false, false, false, false, false
+	for _, sum := range summaryList {
+		withTimestamps = withTimestamps || sum.Timestamps != nil
+		withHTTP = withHTTP || sum.HTTPTiming != nil
+		withTCP = withTCP || sum.TCPOutcomes != nil
+		withDNSSEC = withDNSSEC || sum.DNSSEC != nil
+		withPMTU = withPMTU || sum.PathMTU > 0
+	}
+	if withTimestamps {
+		header = append(header, "时钟偏差", "去程", "回程")
+	}
+	if withHTTP {
+		header = append(header, "DNS", "建连", "TLS", "首字节")
+	}
+	if withTCP {
+		header = append(header, "拒绝", "重置", "超时", "不可达")
+	}
+	if withDNSSEC {
+		header = append(header, "DNSSEC")
+	}
+	if withPMTU {
+		header = append(header, "PMTU")
+	}
+	if r.Budget != nil {
+		header = append(header, "预算")
+	}
+	// 指定了 -geo-from 且有省级地区的目标时追加按地理距离的预期 RTT 和实测与预期之差，绕行的线路偏差明显偏大
+	withGeo := r.GeoFrom != "" && slices.ContainsFunc(summaryList, func(sum *SummaryStatistic) bool {
+		_, ok := expectedRtt(r.GeoFrom, sum.Region)
+		return ok
+	})
+	if withGeo {
+		header = append(header, "预期", "偏差")
+	}
+	withError := summaryHasError(summaryList)
+	if withError {
+		header = append(header, "错误")
+	}
+	// 未发生的阶段（目标为 IP 时的 DNS、http 的 TLS）显示为 -
+	formatPhase := func(d time.Duration) string {
+		if d <= 0 {
+			return "-"
+		}
+		return formatDuration(d)
+	}
+
+	// 按运营商（或 -group-by 的分组）分组输出（各组的行连续）时，每组之后追加该组的小计行
+	withSubtotals := len(totals.Groups) > 0
+	formatMs := func(ms float64) string {
+		return fmt.Sprintf("%.1fms", ms)
+	}
+	// totalRow 汇总行：同一IP可能以多个标签出现，只统计一次（多源探测时每个源各统计一次）
+	totalRow := func(label string, t *Totals) []string {
+		row := []string{
+			"", "", label,
+			fmt.Sprintf("%d", t.Sent),
+			fmt.Sprintf("%d", t.Recv),
+			fmt.Sprintf("%.1f%%", t.LossPercent),
+			fmt.Sprintf("%d", t.Duplicates),
+			formatMs(t.MinRttMs),
+			formatMs(t.MaxRttMs),
+			formatMs(t.AvgRttMs),
+			fmt.Sprintf("%.1f", t.Score),
+			"",
+		}
+		if t.Sent == 0 {
+			// 没有发出任何包（如全部探测出错），丢包率无意义
+			row[5] = "-"
+		}
+		if t.Recv == 0 {
+			row[7], row[8], row[9] = "-", "-", "-"
+		}
+		if t.Targets == 0 {
+			// 没有任何目标（如丢包汇总表为空）
+			row[10] = "-"
+		}
+		if withSource {
+			row = append(row, "")
+		}
+		if withProto {
+			row = append(row, "")
+		}
+		if withGroup {
+			row = append(row, "")
+		}
+		if withStreak {
+			row = append(row, "", "")
+		}
+		if withTimestamps {
+			row = append(row, "", "", "")
+		}
+		if withHTTP {
+			row = append(row, "", "", "", "")
+		}
+		if withTCP {
+			var o SnapshotTCPOutcomes
+			if t.TCPOutcomes != nil {
+				o = *t.TCPOutcomes
+			}
+			row = append(row, strconv.Itoa(o.Refused), strconv.Itoa(o.Reset), strconv.Itoa(o.Timeout), strconv.Itoa(o.Unreachable))
+		}
+		if withDNSSEC {
+			row = append(row, "")
+		}
+		if withPMTU {
+			row = append(row, "")
+		}
+		if r.Budget != nil {
+			row = append(row, "")
+		}
+		if withGeo {
+			row = append(row, "", "")
+		}
+		if withError {
+			row = append(row, "")
+		}
+		return row
+	}
+	var rows [][]string
+	group := 0
+	for i, sum := range summaryList {
+
+		coloredIsp := r.Theme.color(r.Theme.colorForISP(sum.Isp), sum.Isp)
+		lossStr := fmt.Sprintf("%.1f%%", sum.PacketLoss)
+		lossColored := r.Theme.packetLoss(sum.PacketLoss, r.Loss, lossStr)
+		avgRtt := r.colorAvgRtt(sum.AvgRtt, formatDuration(sum.AvgRtt))
+		// 开启与上次运行对比时标注变化：▲ 变差，▼ 变好
+		if p := sum.Previous; p != nil {
+			lossColored += r.formatDelta(sum.PacketLoss - p.PacketLoss)
+			if sum.TotalRecv > 0 && p.AvgRtt > 0 {
+				avgRtt += r.formatDelta(durationToMs(sum.AvgRtt) - durationToMs(p.AvgRtt))
+			}
+		}
+
+		row := []string{
+			sum.DestIP,
+			sum.Region,
+			coloredIsp,
+			fmt.Sprintf("%d", sum.TotalSent),
+			fmt.Sprintf("%d", sum.TotalRecv),
+			lossColored,
+			fmt.Sprintf("%d", sum.PacketsRecvDuplicates),
+			formatDuration(sum.MinRtt),
+			formatDuration(sum.MaxRtt),
+			avgRtt,
+			fmt.Sprintf("%.1f", sum.Score),
+			sum.LastUpdated.Format("15:04:05"),
+		}
+		if withSource {
+			row = append(row, sum.Source)
+		}
+		if withProto {
+			row = append(row, sum.Proto)
+		}
+		if withGroup {
+			row = append(row, sum.Group)
+		}
+		if withStreak {
+			row = append(row, r.formatStreak(sum.LossStreak)...)
+		}
+		if withTimestamps {
+			if ts := sum.Timestamps; ts != nil {
+				row = append(row, formatDuration(ts.ClockOffset), formatDuration(ts.Forward), formatDuration(ts.Return))
+			} else {
+				row = append(row, "-", "-", "-")
+			}
+		}
+		if withHTTP {
+			if t := sum.HTTPTiming; t != nil {
+				row = append(row, formatPhase(t.DNS), formatPhase(t.Connect), formatPhase(t.TLS), formatPhase(t.TTFB))
+			} else {
+				row = append(row, "-", "-", "-", "-")
+			}
+		}
+		if withTCP {
+			if o := sum.TCPOutcomes; o != nil {
+				row = append(row, strconv.Itoa(o.Refused), strconv.Itoa(o.Reset), strconv.Itoa(o.Timeout), strconv.Itoa(o.Unreachable))
+			} else {
+				row = append(row, "-", "-", "-", "-")
+			}
+		}
+		if withDNSSEC {
+			row = append(row, r.formatDNSSEC(sum.DNSSEC))
+		}
+		if withPMTU {
+			row = append(row, r.formatPathMTU(sum.PathMTU))
+		}
+		if r.Budget != nil {
+			// 达标显示 ✓，未达标列出超出预算的指标
+			verdict, verdictColor := "✓", r.Theme.Good
+			if over := r.Budget.violations(sum); len(over) > 0 {
+				verdict, verdictColor = "✗ "+strings.Join(over, "/"), r.Theme.Bad
+			}
+			row = append(row, r.Theme.color(verdictColor, verdict))
+		}
+		if withGeo {
+			row = append(row, r.formatExpectedRtt(sum)...)
+		}
+		if withError {
+			row = append(row, r.Theme.color(r.Theme.Bad, sum.Error))
+		}
+		rows = append(rows, row)
+
+		if withSubtotals && (i == len(summaryList)-1 || summaryList[i+1].groupKey() != sum.groupKey()) {
+			subtotal := totals.Groups[group]
+			group++
+			label := r.Theme.color(r.Theme.colorForISP(subtotal.Isp), subtotal.Isp+"小计")
+			if subtotal.Group != "" {
+				label = subtotal.Group + "小计"
+			}
+			rows = append(rows, totalRow(label, subtotal))
+		}
+	}
+	footer := totalRow("总计", totals.Total)
+
+	r.renderFitted(w, header, rows, footer)
+}
+
+// rowTotals 多行结果的汇总，按包数而非行数计算：丢包率为总丢包数/总发包数，MinRTT/MaxRTT 取极值，
+// AvgRTT 为全部回包 RTT 之和/总收包数；同一IP和源以多个标签出现时只计一次。
+// 目标有权重时其包数按权重计入丢包率和 AvgRTT（发、收两列仍为实际包数），评分为各目标评分按权重的平均
+type rowTotals struct {
+	sent, recv, duplicates int
+	minRtt, maxRtt         time.Duration
+	weightedSent           float64 // 按权重的发包数之和
+	weightedRecv           float64
+	rttSum                 float64 // 全部回包的 RTT 按权重之和（纳秒）
+	scoreSum, weightSum    float64
+	outcomes               TCPOutcomes
+	tcp                    bool // 有 TCP 探测的行，outcomes 有意义
+	counted                map[string]bool
+}
+
+func newRowTotals() *rowTotals {
+	return &rowTotals{counted: make(map[string]bool)}
+}
+
+func (t *rowTotals) add(sum *SummaryStatistic) {
+	key := sum.DestIP + "|" + sum.Source + "|" + sum.Proto
+	if t.counted[key] {
+		return
+	}
+	t.counted[key] = true
+	w := targetWeight(sum.Weight)
+	t.sent += sum.TotalSent
+	t.recv += sum.TotalRecv
+	t.weightedSent += w * float64(sum.TotalSent)
+	t.weightedRecv += w * float64(sum.TotalRecv)
+	t.scoreSum += w * sum.Score
+	t.weightSum += w
+	t.duplicates += sum.PacketsRecvDuplicates
+	if sum.TCPOutcomes != nil {
+		t.outcomes.add(sum.TCPOutcomes)
+		t.tcp = true
+	}
+	if sum.TotalRecv == 0 {
+		// 全部丢包的行没有 RTT
+		return
+	}
+	if t.minRtt == 0 || sum.MinRtt < t.minRtt {
+		t.minRtt = sum.MinRtt
+	}
+	t.maxRtt = max(t.maxRtt, sum.MaxRtt)
+	if sum.rttSum > 0 {
+		// 数据存储中的行有原始累加值，不受 AvgRtt 取整的影响
+		t.rttSum += w * sum.rttSum
+	} else {
+		t.rttSum += w * float64(sum.AvgRtt) * float64(sum.TotalRecv)
+	}
+}
+
+func (t *rowTotals) loss() float64 {
+	if t.weightedSent == 0 {
+		return 0
+	}
+	return (t.weightedSent - t.weightedRecv) / t.weightedSent * 100
+}
+
+func (t *rowTotals) avgRtt() time.Duration {
+	if t.weightedRecv == 0 {
+		return 0
+	}
+	return time.Duration(math.Round(t.rttSum / t.weightedRecv))
+}
+
+// score 各目标评分按权重的平均
+func (t *rowTotals) score() float64 {
+	if t.weightSum == 0 {
+		return 0
+	}
+	return t.scoreSum / t.weightSum
+}
+
+// footer 对比表总计行的丢包率和平均 RTT 两列，没有发包或没有收包时为 -
+func (t *rowTotals) footer(formatDuration func(time.Duration) string) []string {
+	loss, avg := "-", "-"
+	if t.sent > 0 {
+		loss = fmt.Sprintf("%.1f%%", t.loss())
+	}
+	if t.recv > 0 {
+		avg = formatDuration(t.avgRtt())
+	}
+	return []string{loss, avg}
+}
+
+// totals 导出的合计
+func (t *rowTotals) totals() *Totals {
+	out := &Totals{
+		Targets: len(t.counted), Sent: t.sent, Recv: t.recv, Duplicates: t.duplicates, LossPercent: t.loss(),
+		MinRttMs: durationToMs(t.minRtt), MaxRttMs: durationToMs(t.maxRtt), AvgRttMs: durationToMs(t.avgRtt()), Score: t.score(),
+	}
+	if t.tcp {
+		outcomes := SnapshotTCPOutcomes(t.outcomes)
+		out.TCPOutcomes = &outcomes
+	}
+	return out
+}
+
+// ReportTotals 运行报告中汇总表和丢包表各自的合计
+type ReportTotals struct {
+	Summary  *SectionTotals `json:"summary"`
+	LossOnly *SectionTotals `json:"loss_only"`
+}
+
+// SectionTotals 一个结果列表的总计，以及按运营商（或 -group-by 的分组）的小计
+type SectionTotals struct {
+	Total  *Totals   `json:"total"`
+	Groups []*Totals `json:"groups,omitempty"` // 列表按分组排列（至少两组且同一组的行连续）时各组的小计，按出现顺序
+}
+
+// Totals 多行结果的合计，算法同表格的小计、总计行（见 rowTotals），时间以毫秒表示；没有收包时 RTT 为 0
+type Totals struct {
+	Isp         string               `json:"isp,omitempty"`   // 小计所属的运营商，总计为空
+	Group       string               `json:"group,omitempty"` // 指定 -group-by 时小计所属的分组
+	Targets     int                  `json:"targets"`         // 计入的目标数，同一IP以多个标签出现时只计一次
+	Sent        int                  `json:"sent"`
+	Recv        int                  `json:"recv"`
+	Duplicates  int                  `json:"duplicates"`
+	LossPercent float64              `json:"loss_percent"`
+	MinRttMs    float64              `json:"min_rtt_ms"`
+	MaxRttMs    float64              `json:"max_rtt_ms"`
+	AvgRttMs    float64              `json:"avg_rtt_ms"`
+	Score       float64              `json:"score"`
+	TCPOutcomes *SnapshotTCPOutcomes `json:"tcp_outcomes,omitempty"`
+}
+
+// sectionTotals 计算一个结果列表的总计，列表按分组排列时同时计算各组的小计
+func sectionTotals(list []*SummaryStatistic) *SectionTotals {
+	section := &SectionTotals{}
+	grouped := ispGrouped(list)
+	total, subtotal := newRowTotals(), newRowTotals()
+	for i, sum := range list {
+		total.add(sum)
+		subtotal.add(sum)
+		if grouped && (i == len(list)-1 || list[i+1].groupKey() != sum.groupKey()) {
+			t := subtotal.totals()
+			t.Isp, t.Group = sum.Isp, sum.Group
+			section.Groups = append(section.Groups, t)
+			subtotal = newRowTotals()
+		}
+	}
+	section.Total = total.totals()
+	return section
+}
+
+// ispGrouped 结果是否按运营商（或 -group-by 的分组）分组（至少两组，且同一组的行连续）
+func ispGrouped(list []*SummaryStatistic) bool {
+	seen := make(map[string]bool)
+	for i, sum := range list {
+		if i > 0 && list[i-1].groupKey() == sum.groupKey() {
+			continue
+		}
+		if seen[sum.groupKey()] {
+			return false
+		}
+		seen[sum.groupKey()] = true
+	}
+	return len(seen) > 1
+}
+
+// formatExpectedRtt 预期和偏差两列：地区不是省级行政区时为 -，没有回包时只有预期；绕行时偏差标红
+func (r *TableRenderer) formatExpectedRtt(sum *SummaryStatistic) []string {
+	expected, ok := expectedRtt(r.GeoFrom, sum.Region)
+	if !ok {
+		return []string{"-", "-"}
+	}
+	if sum.TotalRecv == 0 {
+		return []string{fmt.Sprintf("%.1fms", durationToMs(expected)), "-"}
+	}
+	deviation := fmt.Sprintf("%+.1fms", durationToMs(sum.AvgRtt-expected))
+	if isDetour(sum.AvgRtt, expected) {
+		deviation = r.Theme.color(r.Theme.Bad, deviation)
+	}
+	return []string{fmt.Sprintf("%.1fms", durationToMs(expected)), deviation}
+}
+
+// formatDelta 与上次运行相比的变化，如 "▲1.2"，按一位小数为 0 时不标注；不加空格，避免表格在空格处折行
+func (r *TableRenderer) formatDelta(d float64) string {
+	switch text := fmt.Sprintf("%.1f", math.Abs(d)); {
+	case text == "0.0":
+		return ""
+	case d > 0:
+		return r.Theme.color(r.Theme.Bad, "▲"+text)
+	default:
+		return r.Theme.color(r.Theme.Good, "▼"+text)
+	}
+}
+
+// formatStreak 连续丢包轮数的两列，正在连续丢包时标为严重色
+func (r *TableRenderer) formatStreak(l *LossStreak) []string {
+	if l == nil {
+		return []string{"-", "-"}
+	}
+	current := strconv.Itoa(l.Current)
+	if l.Current > 0 {
+		current = r.Theme.color(r.Theme.Bad, current)
+	}
+	return []string{current, strconv.Itoa(l.Longest)}
+}
+
+// formatDNSSEC 解析服务器是否校验 DNSSEC，不校验的着色提示，无法判断时显示 -
+func (r *TableRenderer) formatDNSSEC(validating *bool) string {
+	switch {
+	case validating == nil:
+		return "-"
+	case *validating:
+		return r.Theme.color(r.Theme.Good, "校验")
+	}
+	return r.Theme.color(r.Theme.Warn, "不校验")
+}
+
+// formatPathMTU 路径 MTU 低于 1500 字节着告警色，低于 1400 着严重色，无法探测时显示 -
+func (r *TableRenderer) formatPathMTU(mtu int) string {
+	switch {
+	case mtu == 0:
+		return "-"
+	case mtu < PathMTUCrit:
+		return r.Theme.color(r.Theme.Bad, strconv.Itoa(mtu))
+	case mtu < PathMTUWarn:
+		return r.Theme.color(r.Theme.Warn, strconv.Itoa(mtu))
+	}
+	return strconv.Itoa(mtu)
+}
+
+// colorAvgRtt 有时延预算时 AvgRTT 按是否超出预算着色
+func (r *TableRenderer) colorAvgRtt(avg time.Duration, text string) string {
+	if r.Budget == nil {
+		return text
+	}
+	rttColor := r.Theme.Good
+	if avg >= r.Budget.MaxRtt {
+		rttColor = r.Theme.Bad
+	}
+	return r.Theme.color(rttColor, text)
+}
+
+// renderFitted 在 Width 限制内输出表格：超宽时按 lowPriorityColumns 顺序逐列隐藏，直到放得下为止
+func (r *TableRenderer) renderFitted(w io.Writer, header []string, rows [][]string, footer []string) {
+	keep := make([]bool, len(header))
+	for i := range keep {
+		keep[i] = true
+	}
+
+	var buf bytes.Buffer
+	renderTable(&buf, header, rows, footer, keep)
+	for _, name := range lowPriorityColumns {
+		if r.Width <= 0 || maxLineWidth(buf.String()) <= r.Width {
+			break
+		}
+		for i, h := range header {
+			if h == name {
+				keep[i] = false
+			}
+		}
+		buf.Reset()
+		renderTable(&buf, header, rows, footer, keep)
+	}
+	w.Write(buf.Bytes())
+}
+
+// renderTable 只输出 keep 为 true 的列
+func renderTable(w io.Writer, header []string, rows [][]string, footer []string, keep []bool) {
+	pick := func(cells []string) []string {
+		var picked []string
+		for i, c := range cells {
+			if keep[i] {
+				picked = append(picked, c)
+			}
+		}
+		return picked
+	}
+
+	table := tablewriter.NewWriter(w)
+	table.SetHeader(pick(header))
+	table.SetAutoFormatHeaders(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetBorder(false)
+	table.SetRowLine(false)
+	table.SetColumnSeparator(" ")
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	for _, row := range rows {
+		table.Append(pick(row))
+	}
+	table.SetFooter(pick(footer))
+	table.Render()
+}
+
+// maxLineWidth 返回文本中最宽一行的显示宽度（忽略 ANSI 颜色码，中文按双宽计算）
+func maxLineWidth(text string) int {
+	max := 0
+	for _, line := range strings.Split(text, "\n") {
+		if width := runewidth.StringWidth(ansiPattern.ReplaceAllString(line, "")); width > max {
+			max = width
+		}
+	}
+	return max
+}
+
+var ansiPattern = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// terminalWidth 返回标准输出所在终端的列数，非终端时返回 0（不限制宽度）
+func terminalWidth() int {
+	fd := int(os.Stdout.Fd())
+	if !term.IsTerminal(fd) {
+		return 0
+	}
+	width, _, err := term.GetSize(fd)
+	if err != nil {
+		return 0
+	}
+	return width
+}
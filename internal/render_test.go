@@ -0,0 +1,597 @@
+package internal_test
+
+import (
+	"bytes"
+	"dping/internal"
+	"slices"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/go-ping/ping"
+	"github.com/mattn/go-runewidth"
+)
+
+func TestTableSubtotals(t *testing.T) {
+	ms := func(v float64) time.Duration { return time.Duration(v * float64(time.Millisecond)) }
+	// 1.1.1.1 以两个地区出现，只统计一次；2.2.2.2 全部丢包，不参与 RTT 汇总
+	grouped := []*internal.SummaryStatistic{
+		{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", TotalSent: 10, TotalRecv: 10, MinRtt: ms(5), MaxRtt: ms(20), AvgRtt: ms(10)},
+		{DestIP: "1.1.1.1", Region: "天津", Isp: "电信", TotalSent: 10, TotalRecv: 10, MinRtt: ms(5), MaxRtt: ms(20), AvgRtt: ms(10)},
+		{DestIP: "2.2.2.2", Region: "上海", Isp: "电信", TotalSent: 10, PacketLoss: 100, MinRtt: time.Hour},
+		{DestIP: "3.3.3.3", Region: "北京", Isp: "联通", TotalSent: 30, TotalRecv: 27, PacketLoss: 10, MinRtt: ms(10), MaxRtt: ms(40), AvgRtt: ms(20)},
+	}
+	var out bytes.Buffer
+	renderer := &internal.TableRenderer{Theme: &internal.Theme{}, Loss: internal.LossThresholds{Warn: 5, Crit: 10}}
+	if err := renderer.Render(&out, &internal.RunResult{Grouped: grouped, LossOnly: grouped[2:3]}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 汇总行的 发、收、丢包%、重传、MinRTT、MaxRTT、AvgRTT
+	want := map[string]string{
+		"电信小计": "20 10 50.0% 0 5.0ms 20.0ms 10.0ms",
+		"联通小计": "30 27 10.0% 0 10.0ms 40.0ms 20.0ms",
+		"总计":   "50 37 26.0% 0 5.0ms 40.0ms 17.3ms", // 丢包率按包数而非各行平均，AvgRTT 按收包数加权
+	}
+	summary, lossOnly, _ := strings.Cut(out.String(), "丢包汇总")
+	found := make(map[string]int)
+	for _, line := range strings.Split(summary, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 8 {
+			continue
+		}
+		if expected, ok := want[fields[0]]; ok {
+			found[fields[0]]++
+			if got := strings.Join(fields[1:8], " "); got != expected {
+				t.Errorf("%s 为 %q，应为 %q", fields[0], got, expected)
+			}
+		}
+	}
+	if found["电信小计"] != 1 || found["联通小计"] != 1 || found["总计"] != 1 {
+		t.Errorf("汇总行数不符: %v\n%s", found, out.String())
+	}
+	// 丢包汇总表中只有一个运营商，不输出小计
+	if strings.Contains(lossOnly, "小计") {
+		t.Errorf("只有一个运营商时不应输出小计:\n%s", lossOnly)
+	}
+}
+
+// TestTableFooterColumns 总计行逐列按包数汇总，而不是各行的平均
+func TestTableFooterColumns(t *testing.T) {
+	ms := func(v float64) time.Duration { return time.Duration(v * float64(time.Millisecond)) }
+	footer := func(t *testing.T, rows []*internal.SummaryStatistic) map[string]string {
+		t.Helper()
+		var out bytes.Buffer
+		renderer := &internal.TableRenderer{Theme: &internal.Theme{}, Loss: internal.LossThresholds{Warn: 5, Crit: 10}}
+		if err := renderer.Render(&out, &internal.RunResult{Grouped: rows}); err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(out.String(), "\n") {
+			if fields := strings.Fields(line); len(fields) >= 8 && fields[0] == "总计" {
+				columns := []string{"发", "收", "丢包%", "重传", "MinRTT", "MaxRTT", "AvgRTT"}
+				got := make(map[string]string)
+				for i, column := range columns {
+					got[column] = fields[i+1]
+				}
+				return got
+			}
+		}
+		t.Fatalf("没有总计行:\n%s", out.String())
+		return nil
+	}
+
+	// 一个目标丢包 90%，一个目标没有丢包（以两个地区出现，只统计一次）：各行丢包率的平均为 45%，按包数为 9%；
+	// AvgRTT 各行平均为 55ms，按回包为 (1×100+90×10)/91 ≈ 11ms
+	lossy := []*internal.SummaryStatistic{
+		{DestIP: "1.1.1.1", Isp: "电信", TotalSent: 10, TotalRecv: 1, PacketLoss: 90, PacketsRecvDuplicates: 2, MinRtt: ms(100), MaxRtt: ms(100), AvgRtt: ms(100)},
+		{DestIP: "2.2.2.2", Isp: "电信", TotalSent: 90, TotalRecv: 90, PacketsRecvDuplicates: 1, MinRtt: ms(3), MaxRtt: ms(30), AvgRtt: ms(10)},
+		{DestIP: "2.2.2.2", Region: "天津", Isp: "电信", TotalSent: 90, TotalRecv: 90, PacketsRecvDuplicates: 1, MinRtt: ms(3), MaxRtt: ms(30), AvgRtt: ms(10)},
+	}
+	// 探测出错的目标没有发包，丢包率和 RTT 都无意义
+	failed := []*internal.SummaryStatistic{
+		{DestIP: "1.1.1.1", Isp: "电信", PacketLoss: 100, Error: "timeout"},
+	}
+	// 数据存储中同一目标的两次探测（3 个 10ms 和 1 个 30ms 的回包）与另一目标的 4 个 20ms：(30+30+80)/8 = 17.5ms
+	store := internal.NewPingStatsStore(25)
+	for _, probe := range []struct {
+		ip   string
+		recv int
+		avg  time.Duration
+		rtt  time.Duration
+	}{{"1.1.1.1", 3, ms(10), ms(10)}, {"1.1.1.1", 1, ms(30), ms(30)}, {"2.2.2.2", 4, ms(20), ms(20)}} {
+		store.Add(&internal.PingStatistic{DecIp: probe.ip, Isp: "电信", Statistic: &ping.Statistics{
+			PacketsSent: 4, PacketsRecv: probe.recv, PacketLoss: float64(4-probe.recv) / 4 * 100,
+			MinRtt: probe.rtt, MaxRtt: probe.rtt, AvgRtt: probe.avg,
+		}})
+	}
+	stored := store.GetSummarySortedGroupedByIsp("ip", false)
+
+	for _, tc := range []struct {
+		name   string
+		rows   []*internal.SummaryStatistic
+		column string
+		want   string
+	}{
+		{"发包数按目标去重后相加", lossy, "发", "100"},
+		{"收包数按目标去重后相加", lossy, "收", "91"},
+		{"丢包率为总丢包数/总发包数", lossy, "丢包%", "9.0%"},
+		{"重复包数相加", lossy, "重传", "3"},
+		{"MinRTT 取最小值", lossy, "MinRTT", "3.0ms"},
+		{"MaxRTT 取最大值", lossy, "MaxRTT", "100.0ms"},
+		{"AvgRTT 按回包平均", lossy, "AvgRTT", "11.0ms"},
+		{"没有发包时丢包率为 -", failed, "丢包%", "-"},
+		{"没有收包时 AvgRTT 为 -", failed, "AvgRTT", "-"},
+		{"数据存储的结果按原始累加值计算 AvgRTT", stored, "AvgRTT", "17.5ms"},
+		{"数据存储的结果按包数计算丢包率", stored, "丢包%", "33.3%"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := footer(t, tc.rows)[tc.column]; got != tc.want {
+				t.Errorf("总计行 %s 为 %q，应为 %q", tc.column, got, tc.want)
+			}
+		})
+	}
+}
+
+// TestTableWeightedTotals 有权重的目标在小计和总计的丢包率、AvgRTT 和评分中按权重计入
+func TestTableWeightedTotals(t *testing.T) {
+	ms := func(v float64) time.Duration { return time.Duration(v * float64(time.Millisecond)) }
+	// 主用的解析服务器权重为 3，没有丢包；备用的丢包 50%
+	grouped := []*internal.SummaryStatistic{
+		{DestIP: "1.1.1.1", Region: "上海", Isp: "电信", Weight: 3, TotalSent: 10, TotalRecv: 10, MinRtt: ms(10), MaxRtt: ms(10), AvgRtt: ms(10), Score: 80},
+		{DestIP: "1.1.1.2", Region: "上海", Isp: "电信", TotalSent: 10, TotalRecv: 5, PacketLoss: 50, MinRtt: ms(50), MaxRtt: ms(50), AvgRtt: ms(50), Score: 20},
+		{DestIP: "2.2.2.2", Region: "北京", Isp: "联通", TotalSent: 10, TotalRecv: 10, MinRtt: ms(20), MaxRtt: ms(20), AvgRtt: ms(20), Score: 90},
+	}
+	var out bytes.Buffer
+	renderer := &internal.TableRenderer{Theme: &internal.Theme{}, Loss: internal.LossThresholds{Warn: 5, Crit: 10}}
+	if err := renderer.Render(&out, &internal.RunResult{Grouped: grouped}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 发、收为实际包数；电信的丢包率为 (10×1-5×1)/(10×3+10×1)，AvgRTT 为 (3×10×10+5×50)/(3×10+5)，评分为 (3×80+20)/4；
+	// 总计同理，AvgRTT 为 (300+250+200)/(30+5+10)
+	want := map[string]string{
+		"电信小计": "20 15 12.5% 0 10.0ms 50.0ms 15.7ms 65.0",
+		"联通小计": "10 10 0.0% 0 20.0ms 20.0ms 20.0ms 90.0",
+		"总计":   "30 25 10.0% 0 10.0ms 50.0ms 16.7ms 70.0",
+	}
+	summary, _, _ := strings.Cut(out.String(), "丢包汇总")
+	found := 0
+	for _, line := range strings.Split(summary, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 9 {
+			continue
+		}
+		if expected, ok := want[fields[0]]; ok {
+			found++
+			if got := strings.Join(fields[1:9], " "); got != expected {
+				t.Errorf("%s 为 %q，应为 %q", fields[0], got, expected)
+			}
+		}
+	}
+	if found != len(want) {
+		t.Errorf("汇总行数不符:\n%s", out.String())
+	}
+}
+
+// TestTableThemeMarks 有符号的主题在丢包率前按阈值加符号，不只靠颜色区分
+func TestTableThemeMarks(t *testing.T) {
+	rows := []*internal.SummaryStatistic{
+		{DestIP: "1.1.1.1", Isp: "电信", TotalSent: 100, TotalRecv: 100},
+		{DestIP: "1.1.1.2", Isp: "电信", TotalSent: 100, TotalRecv: 97, PacketLoss: 3},
+		{DestIP: "1.1.1.3", Isp: "电信", TotalSent: 100, TotalRecv: 50, PacketLoss: 50},
+	}
+	var out bytes.Buffer
+	renderer := &internal.TableRenderer{Theme: &internal.Theme{Marks: [3]string{"✔", "△", "✖"}}, Loss: internal.LossThresholds{Warn: 2, Crit: 20}}
+	if err := renderer.Render(&out, &internal.RunResult{Grouped: rows}); err != nil {
+		t.Fatal(err)
+	}
+	for ip, want := range map[string]string{"1.1.1.1": "✔0.0%", "1.1.1.2": "△3.0%", "1.1.1.3": "✖50.0%"} {
+		found := false
+		for _, line := range strings.Split(out.String(), "\n") {
+			if fields := strings.Fields(line); len(fields) > 4 && fields[0] == ip {
+				found = true
+				if fields[4] != want {
+					t.Errorf("%s 的丢包率为 %q，应为 %q", ip, fields[4], want)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("没有 %s 的行:\n%s", ip, out.String())
+		}
+	}
+
+	for _, c := range []struct {
+		theme, ispColors string
+		ok               bool
+	}{
+		{"mono", "", true},
+		{"default", "电信=#39ff14, 联通=#00B4FF", true},
+		{"colorblind", "IDC=#ffffff", true},
+		{"none", "电信=#39ff14", false},
+		{"mono", "电信=#39ff14", false},
+		{"default", "电信=green", false},
+		{"default", "#39ff14", false},
+		{"grey", "", false},
+	} {
+		output := internal.OutputOptions{Format: "table", Theme: c.theme, IspColors: c.ispColors, Loss: internal.LossThresholds{Warn: 5, Crit: 10}}
+		if err := internal.ValidateOutput(output); (err == nil) != c.ok {
+			t.Errorf("主题 %s、运营商配色 %q: 错误为 %v", c.theme, c.ispColors, err)
+		}
+	}
+}
+
+func TestTableAggregate(t *testing.T) {
+	ms := func(v float64) time.Duration { return time.Duration(v * float64(time.Millisecond)) }
+	// 上海电信的三个解析服务器汇总为一行，北京联通只有一个
+	rows := []*internal.SummaryStatistic{
+		{DestIP: "1.1.1.1", Region: "上海", Isp: "电信", TotalSent: 10, TotalRecv: 10, AvgRtt: ms(10)},
+		{DestIP: "1.1.1.2", Region: "上海", Isp: "电信", TotalSent: 10, TotalRecv: 8, PacketLoss: 20, AvgRtt: ms(40)},
+		{DestIP: "1.1.1.3", Region: "上海", Isp: "电信", TotalSent: 10, TotalRecv: 10, AvgRtt: ms(20)},
+		{DestIP: "2.2.2.2", Region: "北京", Isp: "联通", TotalSent: 10, TotalRecv: 10, AvgRtt: ms(30)},
+	}
+	var out bytes.Buffer
+	renderer := &internal.TableRenderer{Theme: &internal.Theme{}, Loss: internal.LossThresholds{Warn: 5, Crit: 10},
+		Aggregate: template.Must(template.New("aggregate").Parse("{{.Region}}{{.Isp}}"))}
+	if err := renderer.Render(&out, &internal.RunResult{Rows: rows, Grouped: rows, LossOnly: rows[1:2]}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 目标数、发、收、丢包%、最优丢包%、最差丢包%、AvgRTT、最优RTT、最差RTT、最差目标
+	want := map[string]string{
+		"上海电信": "3 30 28 6.7% 0.0% 20.0% 22.1ms 10.0ms 40.0ms 1.1.1.2", // AvgRTT 为 (10×10+8×40+10×20)/28
+		"北京联通": "1 10 10 0.0% 0.0% 0.0% 30.0ms 30.0ms 30.0ms 2.2.2.2",
+		"总计":   "4 40 38 5.0% 24.2ms",
+	}
+	aggregated, lossOnly, _ := strings.Cut(out.String(), "丢包汇总")
+	found := make(map[string]bool)
+	for _, line := range strings.Split(aggregated, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if expected, ok := want[fields[0]]; ok {
+			found[fields[0]] = true
+			if got := strings.Join(fields[1:], " "); got != expected {
+				t.Errorf("%s 为 %q，应为 %q", fields[0], got, expected)
+			}
+		}
+	}
+	if len(found) != len(want) {
+		t.Errorf("按服务汇总的行不全: %v\n%s", found, out.String())
+	}
+	// 有丢包的目标仍逐个列出
+	if !strings.Contains(lossOnly, "1.1.1.2") {
+		t.Errorf("丢包汇总中应列出有丢包的目标:\n%s", lossOnly)
+	}
+}
+
+func TestSnapshotNote(t *testing.T) {
+	snap := internal.NewSnapshot(nil, "all", "全国", "", 3)
+	snap.Note = "CN2 割接后"
+	path := t.TempDir() + "/snap.json"
+	if err := internal.SaveSnapshot(path, snap); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := internal.LoadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Note != snap.Note {
+		t.Errorf("备注为 %q，应为 %q", loaded.Note, snap.Note)
+	}
+
+	var out bytes.Buffer
+	renderer := &internal.TableRenderer{Theme: &internal.Theme{}}
+	if err := renderer.Render(&out, &internal.RunResult{Snapshot: loaded}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "备注: CN2 割接后\n") {
+		t.Errorf("表格开头应为备注:\n%s", out.String())
+	}
+}
+
+func TestSnapshotGateways(t *testing.T) {
+	snap := internal.NewSnapshot(nil, "all", "全国", "", 3)
+	snap.Gateways = []*internal.GatewayCheck{
+		{IP: "192.168.1.1", Iface: "eth0", Method: "arp", Reachable: true, MAC: "aa:bb:cc:dd:ee:ff", RttMs: 0.3},
+		{IP: "fe80::1", Iface: "eth0", Method: "ndp", Error: "没有应答"},
+	}
+	var out bytes.Buffer
+	renderer := &internal.TableRenderer{Theme: &internal.Theme{}}
+	if err := renderer.Render(&out, &internal.RunResult{Snapshot: snap}); err != nil {
+		t.Fatal(err)
+	}
+	want := "默认网关 192.168.1.1（eth0）ARP 可达，MAC aa:bb:cc:dd:ee:ff，0.3ms\n默认网关 fe80::1（eth0）NDP 不可达: 没有应答\n"
+	if !strings.HasPrefix(out.String(), want) {
+		t.Errorf("表格开头应为网关检查结果:\n%s", out.String())
+	}
+}
+
+func TestTablePathMTU(t *testing.T) {
+	rows := []*internal.SummaryStatistic{
+		{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", TotalSent: 1, TotalRecv: 1, PathMTU: 1500},
+		{DestIP: "1.1.1.2", Region: "北京", Isp: "电信", TotalSent: 1, TotalRecv: 1, PathMTU: 1450},
+		{DestIP: "1.1.1.3", Region: "北京", Isp: "电信", TotalSent: 1, TotalRecv: 1, PathMTU: 1380},
+		{DestIP: "1.1.1.4", Region: "北京", Isp: "电信", TotalSent: 1, TotalRecv: 1},
+	}
+	var out bytes.Buffer
+	renderer := &internal.TableRenderer{Theme: &internal.Theme{Warn: "<w>", Bad: "<b>", Reset: "</>"}}
+	if err := renderer.Render(&out, &internal.RunResult{Grouped: rows}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"PMTU", " 1500 ", "<w>1450</>", "<b>1380</>"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("表格中应有 %q:\n%s", want, out.String())
+		}
+	}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.Contains(line, "1.1.1.4") && !strings.HasSuffix(strings.TrimSpace(line), " -") {
+			t.Errorf("没有路径 MTU 的目标应显示 -: %s", line)
+		}
+	}
+}
+
+func TestTableGeoExpectation(t *testing.T) {
+	ms := time.Millisecond
+	rows := []*internal.SummaryStatistic{
+		{DestIP: "1.1.1.1", Region: "广西", Isp: "电信", TotalSent: 10, TotalRecv: 10, AvgRtt: 60 * ms},
+		{DestIP: "1.1.1.2", Region: "北京", Isp: "电信", TotalSent: 10, TotalRecv: 10, AvgRtt: 32 * ms},
+		{DestIP: "1.1.1.3", Region: "机房", Isp: "电信", TotalSent: 10, TotalRecv: 10, AvgRtt: 1 * ms},
+	}
+	var out bytes.Buffer
+	renderer := &internal.TableRenderer{Theme: &internal.Theme{Bad: "<b>", Reset: "</>"}, GeoFrom: "广东"}
+	if err := renderer.Render(&out, &internal.RunResult{Grouped: rows}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"预期", "偏差", "9.5ms", "<b>+50.5ms</>", "30.3ms", "+1.7ms"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("表格中应有 %q:\n%s", want, out.String())
+		}
+	}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.Contains(line, "1.1.1.3") && !strings.Contains(line, " - ") {
+			t.Errorf("不是省级地区的目标应显示 -: %s", line)
+		}
+	}
+}
+
+func TestProtoPivotICMPTCPMismatch(t *testing.T) {
+	ms := time.Millisecond
+	rows := []*internal.SummaryStatistic{
+		{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", Proto: "icmp", TotalSent: 10, TotalRecv: 6, PacketLoss: 40, AvgRtt: 20 * ms},
+		{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", Proto: "tcp:443", TotalSent: 10, TotalRecv: 10, AvgRtt: 20 * ms},
+		{DestIP: "1.1.1.2", Region: "北京", Isp: "电信", Proto: "icmp", TotalSent: 10, TotalRecv: 10, AvgRtt: 80 * ms},
+		{DestIP: "1.1.1.2", Region: "北京", Isp: "电信", Proto: "tcp:443", TotalSent: 10, TotalRecv: 10, AvgRtt: 20 * ms},
+		{DestIP: "1.1.1.3", Region: "北京", Isp: "电信", Proto: "icmp", TotalSent: 10, TotalRecv: 10, AvgRtt: 10 * ms},
+		{DestIP: "1.1.1.3", Region: "北京", Isp: "电信", Proto: "tcp:443", TotalSent: 10, TotalRecv: 10, AvgRtt: 60 * ms},
+		{DestIP: "1.1.1.4", Region: "北京", Isp: "电信", Proto: "icmp", TotalSent: 10, TotalRecv: 10, AvgRtt: 3 * ms},
+		{DestIP: "1.1.1.4", Region: "北京", Isp: "电信", Proto: "tcp:443", TotalSent: 10, TotalRecv: 10, AvgRtt: 9 * ms},
+	}
+	var out bytes.Buffer
+	renderer := &internal.TableRenderer{Theme: &internal.Theme{}, Loss: internal.LossThresholds{Warn: 5, Crit: 10}}
+	if err := renderer.Render(&out, &internal.RunResult{Grouped: rows}); err != nil {
+		t.Fatal(err)
+	}
+	// 较长的说明在列内折行，去掉空白后按行拼接比较
+	compact := strings.Join(strings.Fields(out.String()), "")
+	for _, want := range []string{
+		"1.1.1.1北京电信40.0%20.0ms0.0%20.0msICMP丢包40.0%，tcp:443丢包0.0%，以tcp:443为准",
+		"1.1.1.2北京电信0.0%80.0ms0.0%20.0msICMPAvgRTT80.0ms，tcp:443AvgRTT20.0ms，以tcp:443为准",
+		"1.1.1.3北京电信0.0%10.0ms0.0%60.0msICMPAvgRTT10.0ms，tcp:443AvgRTT60.0ms，以icmp为准",
+		"1.1.1.4北京电信0.0%3.0ms0.0%9.0ms---",
+	} {
+		if !strings.Contains(compact, want) {
+			t.Errorf("对比表中应有 %q:\n%s", want, out.String())
+		}
+	}
+}
+
+// themeResult 三个丢包级别各一行的固定结果
+func themeResult() *internal.RunResult {
+	ms := func(v float64) time.Duration { return time.Duration(v * float64(time.Millisecond)) }
+	return &internal.RunResult{Grouped: []*internal.SummaryStatistic{
+		{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", TotalSent: 100, TotalRecv: 100, MinRtt: ms(5), MaxRtt: ms(9), AvgRtt: ms(7)},
+		{DestIP: "2.2.2.2", Region: "上海", Isp: "联通", TotalSent: 100, TotalRecv: 97, PacketLoss: 3, MinRtt: ms(5), MaxRtt: ms(9), AvgRtt: ms(7)},
+		{DestIP: "3.3.3.3", Region: "广东", Isp: "移动", TotalSent: 100, TotalRecv: 50, PacketLoss: 50, MinRtt: ms(5), MaxRtt: ms(9), AvgRtt: ms(7)},
+	}}
+}
+
+// TestTableThemes 每个主题按丢包阈值给丢包率着色，按运营商给运营商名着色；none 不输出任何颜色码
+func TestTableThemes(t *testing.T) {
+	loss := internal.LossThresholds{Warn: 2, Crit: 20}
+	for _, name := range []string{"default", "colorblind", "mono", "none"} {
+		theme, err := internal.LookupTheme(name, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		renderer := &internal.TableRenderer{Theme: theme, Loss: loss}
+		if err := renderer.Render(&out, themeResult()); err != nil {
+			t.Fatal(err)
+		}
+		text := out.String()
+		if name == "none" && strings.Contains(text, "\x1b") {
+			t.Errorf("none 主题不应输出颜色码:\n%q", text)
+		}
+		color := func(code, text string) string {
+			if code == "" {
+				return text
+			}
+			return code + text + theme.Reset
+		}
+		for _, c := range []struct {
+			isp, loss, code, mark string
+		}{
+			{"电信", "0.0%", theme.Good, theme.Marks[0]},
+			{"联通", "3.0%", theme.Warn, theme.Marks[1]},
+			{"移动", "50.0%", theme.Bad, theme.Marks[2]},
+		} {
+			if want := color(theme.Isp[c.isp], c.isp); !strings.Contains(text, want) {
+				t.Errorf("%s 主题中 %s 应为 %q:\n%q", name, c.isp, want, text)
+			}
+			if want := color(c.code, c.mark+c.loss); !strings.Contains(text, want) {
+				t.Errorf("%s 主题中丢包率 %s 应为 %q:\n%q", name, c.loss, want, text)
+			}
+		}
+	}
+
+	// 自定义的运营商颜色覆盖主题中的颜色，不影响内置主题
+	custom, err := internal.LookupTheme("default", "电信=#ff0000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if custom.Isp["电信"] != "\033[38;2;255;0;0m" || custom.Isp["联通"] == "" {
+		t.Errorf("自定义运营商颜色有误: %q", custom.Isp)
+	}
+	if theme, _ := internal.LookupTheme("default", ""); theme.Isp["电信"] == custom.Isp["电信"] {
+		t.Error("自定义运营商颜色不应修改内置主题")
+	}
+}
+
+// TestTableWidth 超出 Width 时按 lowPriorityColumns 的顺序逐列隐藏，直到放得下为止，主要的列始终保留
+func TestTableWidth(t *testing.T) {
+	// render 返回汇总表的表头和最宽一行的显示宽度
+	render := func(width int) ([]string, int) {
+		var out bytes.Buffer
+		renderer := &internal.TableRenderer{Theme: &internal.Theme{}, Loss: internal.LossThresholds{Warn: 2, Crit: 20}, Width: width}
+		if err := renderer.Render(&out, themeResult()); err != nil {
+			t.Fatal(err)
+		}
+		summary, _, _ := strings.Cut(out.String(), "丢包汇总")
+		var header []string
+		max := 0
+		for _, line := range strings.Split(summary, "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "目标IP") {
+				header = strings.Fields(line)
+			}
+			if w := runewidth.StringWidth(line); w > max && !strings.HasPrefix(line, "======") {
+				max = w
+			}
+		}
+		return header, max
+	}
+
+	full, width := render(0)
+	if len(full) != 12 {
+		t.Fatalf("不限制宽度时应输出全部 12 列，实际为 %v", full)
+	}
+	if same, _ := render(width); !slices.Equal(same, full) {
+		t.Errorf("宽度刚好放得下时不应隐藏列，实际为 %v", same)
+	}
+	// 每次比上一次的宽度少 1，依次多隐藏一列
+	for hidden := 1; hidden <= len(internal.LowPriorityColumns); hidden++ {
+		var header []string
+		header, width = render(width - 1)
+		want := slices.DeleteFunc(slices.Clone(full), func(h string) bool {
+			return slices.Contains(internal.LowPriorityColumns[:hidden], h)
+		})
+		if !slices.Equal(header, want) {
+			t.Errorf("宽度 %d 时应隐藏 %v，实际表头为 %v", width+1, internal.LowPriorityColumns[:hidden], header)
+		}
+	}
+	// 隐藏全部可隐藏的列仍然放不下时，照常输出剩余的列
+	if header, _ := render(10); !slices.Equal(header, []string{"目标IP", "地区", "运营商", "发", "收", "丢包%", "AvgRTT"}) {
+		t.Errorf("主要的列应始终保留，实际为 %v", header)
+	}
+}
+
+// TestTableHTTPTiming HTTP 探测的结果追加各阶段耗时列，未发生的阶段和没有分阶段耗时的目标显示 -
+func TestTableHTTPTiming(t *testing.T) {
+	ms := time.Millisecond
+	rows := []*internal.SummaryStatistic{
+		{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", Proto: "https", TotalSent: 10, TotalRecv: 10, AvgRtt: 40 * ms,
+			HTTPTiming: &internal.HTTPTiming{Samples: 10, DNS: 2 * ms, Connect: 10 * ms, TLS: 20 * ms, TTFB: 8 * ms}},
+		{DestIP: "1.1.1.2", Region: "北京", Isp: "电信", Proto: "https", TotalSent: 10, TotalRecv: 10, AvgRtt: 18 * ms,
+			HTTPTiming: &internal.HTTPTiming{Samples: 10, Connect: 10 * ms, TTFB: 8 * ms}},
+		{DestIP: "1.1.1.3", Region: "北京", Isp: "电信", Proto: "https", TotalSent: 10, TotalRecv: 0, PacketLoss: 100},
+	}
+	var out bytes.Buffer
+	renderer := &internal.TableRenderer{Theme: &internal.Theme{}}
+	if err := renderer.Render(&out, &internal.RunResult{Grouped: rows}); err != nil {
+		t.Fatal(err)
+	}
+	header := ""
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.Contains(line, "目标IP") {
+			header = strings.Join(strings.Fields(line), " ")
+			break
+		}
+	}
+	if !strings.Contains(header, "DNS 建连 TLS 首字节") {
+		t.Errorf("表头中应依次有 DNS、建连、TLS、首字节列:\n%s", out.String())
+	}
+	for _, c := range []struct{ ip, want string }{
+		{"1.1.1.1", "2.0ms 10.0ms 20.0ms 8.0ms"},
+		{"1.1.1.2", "- 10.0ms - 8.0ms"},
+		{"1.1.1.3", "- - - -"},
+	} {
+		for _, line := range strings.Split(out.String(), "\n") {
+			if strings.Contains(line, c.ip) && !strings.HasSuffix(strings.Join(strings.Fields(line), " "), c.want) {
+				t.Errorf("%s 的分阶段耗时应为 %q: %s", c.ip, c.want, line)
+			}
+		}
+	}
+
+	// 其他协议的结果没有这些列
+	out.Reset()
+	if err := renderer.Render(&out, themeResult()); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "首字节") {
+		t.Errorf("没有 HTTP 分阶段耗时时不应有这些列:\n%s", out.String())
+	}
+}
+
+// TestSourcePivot 同一目标有多个源IP的结果时输出多源对比表：每个源一组丢包率和平均 RTT 列，最后一列为最优的源
+func TestSourcePivot(t *testing.T) {
+	ms := time.Millisecond
+	rows := []*internal.SummaryStatistic{
+		{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", Source: "10.0.0.1", TotalSent: 10, TotalRecv: 10, AvgRtt: 30 * ms},
+		{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", Source: "10.0.0.2", TotalSent: 10, TotalRecv: 10, AvgRtt: 20 * ms},
+		{DestIP: "1.1.1.2", Region: "北京", Isp: "电信", Source: "10.0.0.1", TotalSent: 10, TotalRecv: 10, AvgRtt: 50 * ms},
+		{DestIP: "1.1.1.2", Region: "北京", Isp: "电信", Source: "10.0.0.2", TotalSent: 10, TotalRecv: 8, PacketLoss: 20, AvgRtt: 10 * ms},
+		{DestIP: "1.1.1.3", Region: "北京", Isp: "电信", Source: "10.0.0.1", TotalSent: 10, TotalRecv: 10, AvgRtt: 40 * ms},
+	}
+	var out bytes.Buffer
+	renderer := &internal.TableRenderer{Theme: &internal.Theme{}}
+	if err := renderer.Render(&out, &internal.RunResult{Grouped: rows}); err != nil {
+		t.Fatal(err)
+	}
+	sections := strings.Split(out.String(), "====== 丢包多源对比结果 ======")
+	if len(sections) != 2 || !strings.HasPrefix(sections[0], "====== 多源对比结果 ======") {
+		t.Fatalf("应输出多源对比表和丢包多源对比表:\n%s", out.String())
+	}
+
+	lines := func(section string) []string {
+		var list []string
+		for _, line := range strings.Split(section, "\n") {
+			list = append(list, strings.Join(strings.Fields(line), " "))
+		}
+		return list
+	}
+	all, lossOnly := lines(sections[0]), lines(sections[1])
+	want := "目标IP 地区 运营商 10.0.0.1 丢包% 10.0.0.1 AvgRTT 10.0.0.2 丢包% 10.0.0.2 AvgRTT 最优源"
+	if !slices.Contains(all, want) || !slices.Contains(lossOnly, want) {
+		t.Errorf("表头应按源依次有丢包率和平均 RTT 列:\n%s", out.String())
+	}
+	for _, row := range []string{
+		"1.1.1.1 北京 电信 0.0% 30.0ms 0.0% 20.0ms 10.0.0.2",  // 丢包相同时平均 RTT 低者最优
+		"1.1.1.2 北京 电信 0.0% 50.0ms 20.0% 10.0ms 10.0.0.1", // 丢包率低者优先
+		"1.1.1.3 北京 电信 0.0% 40.0ms - - 10.0.0.1",          // 某个源下没有结果
+	} {
+		if !slices.Contains(all, row) {
+			t.Errorf("对比表中应有 %q:\n%s", row, out.String())
+		}
+	}
+	// 丢包表只列出至少一个源有丢包或没有结果的目标
+	for _, line := range lossOnly {
+		if strings.HasPrefix(line, "1.1.1.1 ") {
+			t.Errorf("各源都没有丢包的目标不应出现在丢包表中: %s", line)
+		}
+	}
+	if !slices.ContainsFunc(lossOnly, func(l string) bool { return strings.HasPrefix(l, "1.1.1.2 ") }) ||
+		!slices.ContainsFunc(lossOnly, func(l string) bool { return strings.HasPrefix(l, "1.1.1.3 ") }) {
+		t.Errorf("丢包表中应有 1.1.1.2 和 1.1.1.3:\n%s", sections[1])
+	}
+}
@@ -0,0 +1,162 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	sessionPath := filepath.Join(dir, "session.bin")
+	outPath := filepath.Join(dir, "result.json")
+
+	header := &internal.SessionHeader{
+		CreatedAt:      time.Now(),
+		Isp:            "all",
+		Region:         "全国",
+		Source:         "192.0.2.1",
+		Count:          4,
+		MaxConcurrency: 2,
+		Targets: []*internal.Target{
+			{IP: "198.51.100.1", Labels: []internal.TargetLabel{{Region: "北京", Isp: "电信"}}},
+			{IP: "198.51.100.2", Labels: []internal.TargetLabel{{Region: "上海", Isp: "联通"}}},
+			{IP: "198.51.100.3", Labels: []internal.TargetLabel{{Region: "广东", Isp: "移动"}}},
+		},
+	}
+	entries := []*internal.SessionEntry{
+		{IP: "198.51.100.1", Duration: time.Second, Stats: &ping.Statistics{
+			PacketsSent: 4, PacketsRecv: 4, MinRtt: 10 * time.Millisecond, MaxRtt: 14 * time.Millisecond, AvgRtt: 12 * time.Millisecond,
+		}},
+		{IP: "198.51.100.2", Duration: time.Second, Stats: &ping.Statistics{
+			PacketsSent: 4, PacketsRecv: 3, PacketLoss: 25, MinRtt: 20 * time.Millisecond, MaxRtt: 30 * time.Millisecond, AvgRtt: 25 * time.Millisecond,
+		}},
+		{IP: "198.51.100.3", Duration: time.Second, Err: "Ping Run Error: timeout"},
+	}
+	if err := internal.WriteSession(sessionPath, header, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	output := internal.OutputOptions{Format: "json", NoPager: true, OutPath: outPath}
+	for run := 0; run < 2; run++ {
+		if err := internal.Replay(sessionPath, 0, "avgrtt", false, output); err != nil {
+			t.Fatal(err)
+		}
+		snap, err := internal.LoadSnapshot(outPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if snap.Source != "192.0.2.1" || snap.Count != 4 {
+			t.Fatalf("第%d次回放元数据不一致: source=%s count=%d", run+1, snap.Source, snap.Count)
+		}
+		// 按 avgrtt 升序，探测失败的目标带着原因排在最后，多次回放结果相同
+		if len(snap.Rows) != 3 {
+			t.Fatalf("第%d次回放应有3行结果，实际 %d 行", run+1, len(snap.Rows))
+		}
+		first, second, failed := snap.Rows[0], snap.Rows[1], snap.Rows[2]
+		if first.DestIP != "198.51.100.1" || first.Isp != "电信" || first.Sent != 4 || first.Recv != 4 || first.AvgRttMs != 12 {
+			t.Errorf("第%d次回放第1行不一致: %+v", run+1, first)
+		}
+		if second.DestIP != "198.51.100.2" || second.Isp != "联通" || second.LossPercent != 25 || second.AvgRttMs != 25 {
+			t.Errorf("第%d次回放第2行不一致: %+v", run+1, second)
+		}
+		if failed.DestIP != "198.51.100.3" || failed.Sent != 0 || failed.LossPercent != 100 || failed.Error != "Ping Run Error: timeout" {
+			t.Errorf("第%d次回放出错的行不一致: %+v", run+1, failed)
+		}
+	}
+}
+
+func TestReplayRecommendations(t *testing.T) {
+	dir := t.TempDir()
+	sessionPath := filepath.Join(dir, "session.bin")
+	outPath := filepath.Join(dir, "result.json")
+
+	header := &internal.SessionHeader{
+		CreatedAt:      time.Now(),
+		Isp:            "all",
+		Region:         "全国",
+		Source:         "192.0.2.1,192.0.2.2",
+		Sources:        []string{"192.0.2.1", "192.0.2.2"},
+		Interfaces:     map[string]string{"192.0.2.1": "eth0", "192.0.2.2": "eth1"},
+		Count:          4,
+		MaxConcurrency: 2,
+		Targets: []*internal.Target{
+			{IP: "198.51.100.1", Labels: []internal.TargetLabel{{Region: "北京", Isp: "电信"}}},
+			{IP: "198.51.100.2", Labels: []internal.TargetLabel{{Region: "上海", Isp: "移动"}}},
+		},
+	}
+	stats := func(recv int, avg time.Duration) *ping.Statistics {
+		return &ping.Statistics{PacketsSent: 4, PacketsRecv: recv, PacketLoss: float64(4-recv) * 25, MinRtt: avg, MaxRtt: avg, AvgRtt: avg}
+	}
+	entries := []*internal.SessionEntry{
+		// 电信：eth1 的 RTT 更低但有丢包，推荐 eth0
+		{IP: "198.51.100.1", Source: "192.0.2.1", Stats: stats(4, 10*time.Millisecond)},
+		{IP: "198.51.100.1", Source: "192.0.2.2", Stats: stats(3, 8*time.Millisecond)},
+		// 移动：都不丢包，推荐 RTT 更低的 eth1；eth0 探测失败按全部丢包计
+		{IP: "198.51.100.2", Source: "192.0.2.1", Err: "Ping Run Error: timeout"},
+		{IP: "198.51.100.2", Source: "192.0.2.2", Stats: stats(4, 9*time.Millisecond)},
+	}
+	if err := internal.WriteSession(sessionPath, header, entries); err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.Replay(sessionPath, 0, "loss", false, internal.OutputOptions{Format: "json", NoPager: true, OutPath: outPath}); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := internal.LoadSnapshot(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 探测失败的一行带着原因保留在结果中
+	if len(snap.Rows) != 4 || len(snap.Recommendations) != 2 {
+		t.Fatalf("应有4行结果和2条推荐，实际 %d 行 %d 条", len(snap.Rows), len(snap.Recommendations))
+	}
+	dx, yd := snap.Recommendations[0], snap.Recommendations[1]
+	if dx.Isp != "电信" || dx.Preferred != "192.0.2.1" || dx.Sources[0].Interface != "eth0" || dx.Sources[1].LossDelta != 25 {
+		t.Errorf("电信推荐不一致: %+v %+v", dx, dx.Sources[1])
+	}
+	if yd.Isp != "移动" || yd.Preferred != "192.0.2.2" || yd.Sources[1].LossPercent != 100 || yd.Sources[1].Reached != 0 {
+		t.Errorf("移动推荐不一致: %+v %+v", yd, yd.Sources[1])
+	}
+}
+
+func TestReplaySocketExhausted(t *testing.T) {
+	dir := t.TempDir()
+	sessionPath := filepath.Join(dir, "session.bin")
+	outPath := filepath.Join(dir, "result.json")
+
+	header := &internal.SessionHeader{
+		CreatedAt:      time.Now(),
+		Isp:            "all",
+		Region:         "全国",
+		Count:          4,
+		MaxConcurrency: 4,
+		Targets: []*internal.Target{
+			{IP: "198.51.100.1", Labels: []internal.TargetLabel{{Region: "北京", Isp: "电信"}}},
+			{IP: "198.51.100.2", Labels: []internal.TargetLabel{{Region: "上海", Isp: "联通"}}},
+		},
+	}
+	entries := []*internal.SessionEntry{
+		{IP: "198.51.100.1", Stats: &ping.Statistics{PacketsSent: 4, PacketsRecv: 4, AvgRtt: 10 * time.Millisecond}},
+		// 录制的结果每次回放都相同，重试用尽后带着原因保留在结果中
+		{IP: "198.51.100.2", Err: "Ping Run Error: listen ip4:icmp 0.0.0.0: socket: too many open files"},
+	}
+	if err := internal.WriteSession(sessionPath, header, entries); err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.Replay(sessionPath, 0, "loss", false, internal.OutputOptions{Format: "json", NoPager: true, OutPath: outPath}); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := internal.LoadSnapshot(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tm := snap.Telemetry; tm.SocketRetries != 3 || tm.ReducedConcurrency == 0 || tm.ReducedConcurrency >= 4 || tm.Failed != 1 {
+		t.Errorf("重试和降低并发的记录不符: %+v", tm)
+	}
+	if len(snap.Rows) != 2 || snap.Rows[1].Error == "" {
+		t.Errorf("重试用尽的目标应带着原因保留在结果中: %+v", snap.Rows)
+	}
+}
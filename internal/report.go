@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"sort"
+)
+
+// ReportOptions dping report 的输入和筛选参数
+type ReportOptions struct {
+	From    string   // 结果文件：-history 的 JSON Lines、保存的 -ws 事件流或 -out 快照
+	Last    bool     // 只使用最后一轮，默认合并文件中的全部轮次
+	Isps    []string // 只保留这些运营商的结果，为空时不筛选
+	Regions []string // 只保留这些地区的结果，为空时不筛选
+}
+
+// LoadResults 读取之前保存的结果，按时间先后返回各轮快照。文件中每个 JSON 值为一轮快照（-history、-out）
+// 或一条实时推送事件（-ws）；事件按运行 ID 组成一轮，以 round_end 中的快照为准，未结束的轮次用已收到的结果
+func LoadResults(path string) ([]*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取结果文件 %s 失败: %v", path, err)
+	}
+	defer f.Close()
+
+	var rounds []*Snapshot
+	partial := make(map[string]*Snapshot) // 运行 ID -> 尚未收到 round_end 的轮次
+	var pending []string
+	dec := json.NewDecoder(f)
+	for n := 1; ; n++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				log.Printf("⚠️  结果文件 %s 末尾不完整，已忽略\n", path)
+				break
+			}
+			return nil, fmt.Errorf("解析结果文件 %s 第 %d 条记录失败: %v", path, n, err)
+		}
+		var ev StreamEvent
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			return nil, fmt.Errorf("解析结果文件 %s 第 %d 条记录失败: %v", path, n, err)
+		}
+		var snap *Snapshot
+		switch ev.Type {
+		case "":
+			snap = &Snapshot{}
+			if err := json.Unmarshal(raw, snap); err != nil {
+				return nil, fmt.Errorf("解析结果文件 %s 第 %d 条记录失败: %v", path, n, err)
+			}
+		case StreamResult:
+			if ev.Result == nil {
+				continue
+			}
+			round := partial[ev.RunID]
+			if round == nil {
+				round = &Snapshot{SchemaVersion: SchemaVersion, CreatedAt: ev.Time, RunID: ev.RunID}
+				partial[ev.RunID] = round
+				pending = append(pending, ev.RunID)
+			}
+			round.Rows = append(round.Rows, ev.Result)
+			continue
+		case StreamRoundEnd:
+			if ev.Snapshot == nil {
+				continue
+			}
+			delete(partial, ev.RunID)
+			snap = ev.Snapshot
+		default:
+			// 轮次开始、进度等事件不含结果
+			continue
+		}
+		if snap.SchemaVersion > SchemaVersion {
+			return nil, fmt.Errorf("结果文件 %s 第 %d 条记录的格式版本 %d 高于当前程序支持的 %d，请升级 dping", path, n, snap.SchemaVersion, SchemaVersion)
+		}
+		rounds = append(rounds, snap)
+	}
+	for _, runID := range pending {
+		if round := partial[runID]; round != nil {
+			log.Printf("⚠️  结果文件 %s 中运行 %s 未结束，按已收到的 %d 条结果计入\n", path, runID, len(round.Rows))
+			rounds = append(rounds, round)
+		}
+	}
+	sort.SliceStable(rounds, func(i, j int) bool { return rounds[i].CreatedAt.Before(rounds[j].CreatedAt) })
+	return rounds, nil
+}
+
+// Report 读取之前保存的结果，按新的排序、筛选和输出参数重新生成报告，不做任何探测。
+// 多轮结果按目标合并（累加收发包数，RTT 按收包数加权），-last 时只用最后一轮
+func Report(opts ReportOptions, sort string, des bool, output OutputOptions) error {
+	if err := ValidateSort(sort); err != nil {
+		return err
+	}
+	weights, err := ParseScoreWeights(output.ScoreWeights)
+	if err != nil {
+		return err
+	}
+	renderer, err := prepareOutput(&output)
+	if err != nil {
+		return err
+	}
+	var signKey ed25519.PrivateKey
+	if output.SignKey != "" {
+		if signKey, err = LoadSigningKey(output.SignKey); err != nil {
+			return err
+		}
+	}
+	rounds, err := LoadResults(opts.From)
+	if err != nil {
+		return err
+	}
+	if len(rounds) == 0 {
+		return fmt.Errorf("结果文件 %s 中没有结果", opts.From)
+	}
+	merged := rounds[len(rounds)-1]
+	if !opts.Last && len(rounds) > 1 {
+		merged = rollupRounds(rounds)
+		merged.CreatedAt = rounds[0].CreatedAt
+		merged.Note = rounds[0].Note
+	}
+	fmt.Fprintf(os.Stderr, "✅ 读取 %s：%d 轮，使用 %s 起的 %d 轮\n", opts.From, len(rounds),
+		merged.CreatedAt.Format("2006-01-02 15:04:05"), max(merged.Rounds, 1))
+
+	groupBy, _ := parseGroupBy(output.GroupBy)
+	var summaryList []*SummaryStatistic
+	for _, row := range merged.Rows {
+		if len(opts.Isps) > 0 && !slices.Contains(opts.Isps, row.Isp) ||
+			len(opts.Regions) > 0 && !slices.Contains(opts.Regions, row.Region) {
+			continue
+		}
+		sum := row.Summary()
+		// 只在指定了 -score-weights 时重新评分，否则保留探测时的评分
+		if output.ScoreWeights != "" {
+			sum.Score = weights.score(sum)
+		}
+		sum.Group = ""
+		if groupBy != nil {
+			sum.Group = groupOf(groupBy, sum)
+		}
+		summaryList = append(summaryList, sum)
+	}
+	if len(summaryList) == 0 {
+		return fmt.Errorf("结果文件 %s 中没有符合筛选条件的结果", opts.From)
+	}
+	sortSummaries(summaryList, sort, des)
+
+	snap := NewSnapshot(summaryList, merged.Isp, merged.Region, merged.Source, merged.Count)
+	snap.CreatedAt, snap.Host, snap.RunID = merged.CreatedAt, merged.Host, merged.RunID
+	snap.Protocols, snap.Rounds, snap.Gateways = merged.Protocols, merged.Rounds, merged.Gateways
+	snap.Note = merged.Note
+	if output.Note != "" {
+		snap.Note = output.Note
+	}
+	if multiSource(summaryList) {
+		snap.Recommendations = recommendSources(snap.Rows, nil)
+	}
+	annotateSnapshot(snap, summaryList, output)
+
+	grouped := groupSummaries(summaryList, sort, des)
+	result := newRunResult(snap, summaryList, grouped, lossOnlySummaries(grouped, sort, des))
+	if signKey != nil {
+		if err := SignSnapshot(snap, signKey); err != nil {
+			return err
+		}
+	}
+	presentResult(result, renderer, output, sort, des)
+	return nil
+}
@@ -0,0 +1,253 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// historyCompactInterval 持续探测时整理历史文件的最小间隔
+const historyCompactInterval = time.Hour
+
+// HistoryRetention 历史文件的保留策略：最近 Raw 内保留每一轮，更早的按小时合并，早于 Rollup 的删除；
+// 为 0 表示不限：Raw 为 0 时不整理，Rollup 为 0 时小时汇总一直保留
+type HistoryRetention struct {
+	Raw    time.Duration
+	Rollup time.Duration
+}
+
+// Enabled 是否需要整理历史文件
+func (r HistoryRetention) Enabled() bool {
+	return r.Raw > 0
+}
+
+// validate 校验保留策略
+func (r HistoryRetention) validate() error {
+	if r.Raw < 0 || r.Rollup < 0 {
+		return fmt.Errorf("-history-raw 和 -history-rollup 不能为负数")
+	}
+	if r.Rollup > 0 && r.Raw == 0 {
+		return fmt.Errorf("-history-rollup 需要同时指定 -history-raw")
+	}
+	if r.Rollup > 0 && r.Rollup < r.Raw {
+		return fmt.Errorf("小时汇总的保留时长 -history-rollup（%s）不能短于逐轮保留的 -history-raw（%s）", r.Rollup, r.Raw)
+	}
+	return nil
+}
+
+// CompactHistory 按保留策略整理历史文件：now 之前 Raw 内的各轮原样保留，更早的按小时合并为一轮（已合并的可再次合并），
+// 早于 Rollup 的删除；先写入临时文件再替换，中途失败不会损坏原文件。返回整理前后的轮数
+func CompactHistory(path string, retention HistoryRetention, now time.Time) (before int, after int, err error) {
+	if err := retention.validate(); err != nil {
+		return 0, 0, err
+	}
+	rounds, err := LoadHistory(path)
+	if err != nil || !retention.Enabled() {
+		return len(rounds), len(rounds), err
+	}
+	rawSince := now.Add(-retention.Raw)
+	var kept []*Snapshot
+	var hour []*Snapshot
+	flush := func() {
+		if len(hour) > 0 {
+			kept = append(kept, rollupRounds(hour))
+			hour = nil
+		}
+	}
+	for _, snap := range rounds {
+		switch {
+		case retention.Rollup > 0 && snap.CreatedAt.Before(now.Add(-retention.Rollup)):
+			continue
+		case !snap.CreatedAt.Before(rawSince):
+			flush()
+			kept = append(kept, snap)
+		default:
+			if len(hour) > 0 && !hour[0].CreatedAt.Truncate(time.Hour).Equal(snap.CreatedAt.Truncate(time.Hour)) {
+				flush()
+			}
+			hour = append(hour, snap)
+		}
+	}
+	flush()
+	if len(kept) == len(rounds) {
+		return len(rounds), len(kept), nil
+	}
+	return len(rounds), len(kept), rewriteHistory(path, kept)
+}
+
+// rewriteHistory 以 rounds 替换历史文件的内容
+func rewriteHistory(path string, rounds []*Snapshot) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("整理历史文件 %s 失败: %v", path, err)
+	}
+	w := bufio.NewWriter(f)
+	for _, snap := range rounds {
+		data, err := json.Marshal(snap)
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+		w.Write(append(data, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("整理历史文件 %s 失败: %v", path, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("整理历史文件 %s 失败: %v", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("整理历史文件 %s 失败: %v", path, err)
+	}
+	return nil
+}
+
+// rollupRounds 将同一小时内的各轮合并为一轮，时间为该小时的起点：按目标累加收发包数并重新计算丢包率，
+// RTT 按收包数加权合并；某轮全部丢包（在 unanswered 中）的目标按其实际发包数计入丢包，
+// 某轮完全没有记录的目标按该轮的发包数计入丢包，整个小时都全部丢包的目标仍放在 unanswered 中；
+// 整个小时都没有应答且出过错的目标留在 rows 中并保留最近一次的出错原因。
+// 时钟偏差、HTTP 阶段耗时、DNS 解析结果等附加结果不保留
+func rollupRounds(rounds []*Snapshot) *Snapshot {
+	first := rounds[0]
+	snap := &Snapshot{
+		SchemaVersion: first.SchemaVersion,
+		CreatedAt:     first.CreatedAt.Truncate(time.Hour),
+		Host:          first.Host,
+		Source:        first.Source,
+		Isp:           first.Isp,
+		Region:        first.Region,
+		Count:         first.Count,
+		Protocols:     first.Protocols,
+	}
+	rows := make(map[string]*rollupRow)
+	var keys []string
+	for _, round := range rounds {
+		for _, row := range slices.Concat(round.Rows, round.Unanswered) {
+			key := strings.Join([]string{row.DestIP, row.Isp, row.Region, row.Source, row.Proto}, "|")
+			if rows[key] == nil {
+				rows[key] = &rollupRow{}
+				keys = append(keys, key)
+			}
+		}
+	}
+	for _, round := range rounds {
+		snap.Rounds += max(round.Rounds, 1)
+		seen := make(map[string]bool)
+		for _, row := range round.Rows {
+			key := strings.Join([]string{row.DestIP, row.Isp, row.Region, row.Source, row.Proto}, "|")
+			seen[key] = true
+			rows[key].add(row)
+		}
+		for _, row := range round.Unanswered {
+			key := strings.Join([]string{row.DestIP, row.Isp, row.Region, row.Source, row.Proto}, "|")
+			seen[key] = true
+			rows[key].addLost(row)
+		}
+		for _, key := range keys {
+			if !seen[key] {
+				rows[key].sent += round.Count * max(round.Rounds, 1)
+			}
+		}
+	}
+	for _, key := range keys {
+		// 探测出错的目标与逐轮结果一样留在 rows 中，保留出错原因
+		if row := rows[key].row(); row.Recv > 0 || row.Error != "" {
+			snap.Rows = append(snap.Rows, row)
+		} else {
+			snap.Unanswered = append(snap.Unanswered, row)
+		}
+	}
+	return snap
+}
+
+// rollupRow 合并中的一个目标
+type rollupRow struct {
+	last       *SnapshotRow
+	sent, recv int
+	duplicates int
+	hasRtt     bool
+	min, max   float64
+	sum, sumSq float64 // 各轮 收包数×平均 RTT 及 收包数×(方差+平均值²) 之和，用于合并平均值和标准差
+	score      float64
+	scored     int
+	err        string // 最近一次出错的原因，整个小时都没有收到应答时保留
+}
+
+func (r *rollupRow) add(row *SnapshotRow) {
+	r.last = row
+	r.sent += row.Sent
+	r.recv += row.Recv
+	r.duplicates += row.Duplicates
+	if row.Error == "" {
+		r.score += row.Score
+		r.scored++
+	} else {
+		r.err = row.Error
+	}
+	if row.Recv == 0 {
+		return
+	}
+	if !r.hasRtt || row.MinRttMs < r.min {
+		r.min, r.hasRtt = row.MinRttMs, true
+	}
+	r.max = max(r.max, row.MaxRttMs)
+	n := float64(row.Recv)
+	r.sum += n * row.AvgRttMs
+	r.sumSq += n * (row.StdDevRttMs*row.StdDevRttMs + row.AvgRttMs*row.AvgRttMs)
+}
+
+// addLost 计入一轮全部丢包的结果，只有发包数
+func (r *rollupRow) addLost(row *SnapshotRow) {
+	if r.last == nil {
+		r.last = row
+	}
+	r.sent += row.Sent
+}
+
+func (r *rollupRow) row() *SnapshotRow {
+	last := r.last
+	row := &SnapshotRow{
+		DestIP:     last.DestIP,
+		Region:     last.Region,
+		Isp:        last.Isp,
+		Source:     last.Source,
+		Proto:      last.Proto,
+		Tags:       last.Tags,
+		Group:      last.Group,
+		Weight:     last.Weight,
+		Sent:       r.sent,
+		Recv:       r.recv,
+		Duplicates: r.duplicates,
+		UpdatedAt:  last.UpdatedAt,
+		LossStreak: last.LossStreak,
+	}
+	if r.sent > 0 {
+		row.LossPercent = float64(r.sent-r.recv) / float64(r.sent) * 100
+	} else {
+		row.LossPercent = 100
+	}
+	if r.recv == 0 {
+		row.Error = r.err
+	}
+	if r.scored > 0 {
+		row.Score = r.score / float64(r.scored)
+	}
+	if r.recv > 0 {
+		n := float64(r.recv)
+		row.MinRttMs, row.MaxRttMs = r.min, r.max
+		row.AvgRttMs = r.sum / n
+		row.StdDevRttMs = math.Sqrt(max(r.sumSq/n-row.AvgRttMs*row.AvgRttMs, 0))
+	}
+	return row
+}
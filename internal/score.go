@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ScoreWeights 综合评分中各指标的扣分权重：评分 = 100 - 丢包率(%)×Loss - 平均RTT(ms)×Rtt - 抖动(ms)×Jitter，最低为 0
+type ScoreWeights struct {
+	Loss   float64
+	Rtt    float64
+	Jitter float64 // 抖动取 RTT 标准差
+}
+
+// DefaultScoreWeights 默认权重：丢包 1% 与平均 RTT 10ms、抖动 4ms 扣分相同，丢包 50% 即为 0 分
+var DefaultScoreWeights = ScoreWeights{Loss: 2, Rtt: 0.2, Jitter: 0.5}
+
+// ParseScoreWeights 解析 -score-weights，如 loss=2,rtt=0.2,jitter=0.5；未指定的指标使用默认权重，空字符串返回默认权重
+func ParseScoreWeights(s string) (ScoreWeights, error) {
+	w := DefaultScoreWeights
+	if strings.TrimSpace(s) == "" {
+		return w, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if !ok || err != nil || v < 0 {
+			return w, fmt.Errorf("评分权重 -score-weights 中 '%s' 无效，格式为 loss=2,rtt=0.2,jitter=0.5，权重不能为负数", part)
+		}
+		switch strings.TrimSpace(name) {
+		case "loss":
+			w.Loss = v
+		case "rtt":
+			w.Rtt = v
+		case "jitter":
+			w.Jitter = v
+		default:
+			return w, fmt.Errorf("评分权重 -score-weights 中不支持的指标 '%s'，可选 loss|rtt|jitter", name)
+		}
+	}
+	return w, nil
+}
+
+// score 计算目标的综合评分，0~100，越高越好
+func (w ScoreWeights) score(sum *SummaryStatistic) float64 {
+	penalty := sum.PacketLoss*w.Loss + durationToMs(sum.AvgRtt)*w.Rtt + durationToMs(sum.StdDevRtt)*w.Jitter
+	return max(100-penalty, 0)
+}
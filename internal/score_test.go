@@ -0,0 +1,44 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"testing"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+func TestScoreSort(t *testing.T) {
+	store := internal.NewPingStatsStore(25)
+	weights, err := internal.ParseScoreWeights("loss=1, rtt=0.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetScoreWeights(weights)
+	add := func(ip string, sent, recv int, rtt time.Duration) {
+		store.Add(&internal.PingStatistic{DecIp: ip, Isp: "电信", Region: "北京", Statistic: &ping.Statistics{
+			PacketsSent: sent, PacketsRecv: recv, PacketLoss: float64(sent-recv) / float64(sent) * 100,
+			MinRtt: rtt, MaxRtt: rtt, AvgRtt: rtt,
+		}})
+	}
+	add("1.1.1.1", 10, 10, 10*time.Millisecond) // 100 - 0 - 5 = 95
+	add("2.2.2.2", 10, 9, 20*time.Millisecond)  // 100 - 10 - 10 = 80
+	add("3.3.3.3", 10, 10, 60*time.Millisecond) // 100 - 0 - 30 = 70
+
+	list := store.GetSummarySorted("score", false)
+	want := []struct {
+		ip    string
+		score float64
+	}{{"3.3.3.3", 70}, {"2.2.2.2", 80}, {"1.1.1.1", 95}}
+	for i, w := range want {
+		if list[i].DestIP != w.ip || list[i].Score != w.score {
+			t.Errorf("第 %d 名为 %s（%.1f 分），应为 %s（%.1f 分）", i+1, list[i].DestIP, list[i].Score, w.ip, w.score)
+		}
+	}
+
+	for _, bad := range []string{"loss", "loss=-1", "latency=1"} {
+		if _, err := internal.ParseScoreWeights(bad); err == nil {
+			t.Errorf("权重 %q 应报错", bad)
+		}
+	}
+}
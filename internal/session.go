@@ -0,0 +1,235 @@
+package internal
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+// sessionVersion 录制文件格式版本，格式不兼容时加一
+const sessionVersion = 1
+
+// SessionHeader 录制文件头：运行参数与探测目标
+type SessionHeader struct {
+	Version        int
+	CreatedAt      time.Time
+	Isp            string
+	Region         string
+	Source         string
+	Sources        []string          // 各源IP，多源探测时有多个；未指定网卡时为空
+	Interfaces     map[string]string // 源IP -> 网卡名
+	Count          int
+	MaxConcurrency int
+	Targets        []*Target
+}
+
+// SessionEntry 一个目标的探测记录
+type SessionEntry struct {
+	IP       string
+	Source   string        // 源IP，未指定网卡时为空
+	Duration time.Duration // 探测耗时，回放时按此模拟
+	Stats    *ping.Statistics
+	Details  *ProbeDetails // 探测方式特有的附加结果
+	Err      string
+}
+
+// sessionRecorder 包装真实 Prober，把每次探测结果写入录制文件
+type sessionRecorder struct {
+	prober Prober
+	mu     sync.Mutex
+	file   *os.File
+	enc    *gob.Encoder
+	err    error
+}
+
+func newSessionRecorder(path string, cfg *runConfig, targets []*Target, prober Prober) (*sessionRecorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("创建录制文件 %s 失败: %v", path, err)
+	}
+	r := &sessionRecorder{prober: prober, file: f, enc: gob.NewEncoder(f)}
+	header := &SessionHeader{
+		Version:        sessionVersion,
+		CreatedAt:      time.Now(),
+		Isp:            cfg.isp,
+		Region:         cfg.region,
+		Source:         cfg.localIPStr,
+		Sources:        cfg.sources(),
+		Interfaces:     cfg.interfaces,
+		Count:          cfg.count,
+		MaxConcurrency: cfg.maxConcurrency,
+		Targets:        targets,
+	}
+	if err := r.enc.Encode(header); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("写入录制文件 %s 失败: %v", path, err)
+	}
+	return r, nil
+}
+
+func (r *sessionRecorder) Probe(to net.IP, sourceIP net.IP, count int, adaptive AdaptiveOptions) (*ping.Statistics, error) {
+	start := time.Now()
+	stats, err := r.prober.Probe(to, sourceIP, count, adaptive)
+	entry := &SessionEntry{IP: to.String(), Source: sourceString(sourceIP), Duration: time.Since(start), Stats: stats, Details: r.Details(to, sourceIP)}
+	if err != nil {
+		entry.Err = err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = r.enc.Encode(entry)
+	}
+	return stats, err
+}
+
+// Details 透传被包装 Prober 的附加结果
+func (r *sessionRecorder) Details(to net.IP, sourceIP net.IP) *ProbeDetails {
+	if ds, ok := r.prober.(detailSource); ok {
+		return ds.Details(to, sourceIP)
+	}
+	return nil
+}
+
+// Close 关闭录制文件，返回录制过程中遇到的第一个写入错误
+func (r *sessionRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	closeErr := r.file.Close()
+	if r.err != nil {
+		return fmt.Errorf("写入录制文件 %s 失败: %v", r.file.Name(), r.err)
+	}
+	return closeErr
+}
+
+// Session 已加载的录制文件
+type Session struct {
+	Header  *SessionHeader
+	Entries map[string]*SessionEntry // 按目标IP + 源IP索引
+}
+
+// WriteSession 将录制内容写入文件，供测试或工具直接生成回放数据
+func WriteSession(path string, header *SessionHeader, entries []*SessionEntry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建录制文件 %s 失败: %v", path, err)
+	}
+	defer f.Close()
+	enc := gob.NewEncoder(f)
+	header.Version = sessionVersion
+	if err := enc.Encode(header); err != nil {
+		return fmt.Errorf("写入录制文件 %s 失败: %v", path, err)
+	}
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return fmt.Errorf("写入录制文件 %s 失败: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// LoadSession 读取录制文件
+func LoadSession(path string) (*Session, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取录制文件 %s 失败: %v", path, err)
+	}
+	defer f.Close()
+
+	dec := gob.NewDecoder(f)
+	header := &SessionHeader{}
+	if err := dec.Decode(header); err != nil {
+		return nil, fmt.Errorf("解析录制文件 %s 失败: %v", path, err)
+	}
+	if header.Version != sessionVersion {
+		return nil, fmt.Errorf("录制文件 %s 的版本 %d 不受支持（当前版本 %d）", path, header.Version, sessionVersion)
+	}
+
+	session := &Session{Header: header, Entries: make(map[string]*SessionEntry)}
+	for {
+		entry := &SessionEntry{}
+		if err := dec.Decode(entry); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			// 录制中途被中断时文件末尾可能不完整，保留已读取的部分
+			log.Printf("⚠️  录制文件 %s 末尾不完整，已忽略: %v\n", path, err)
+			break
+		}
+		session.Entries[entry.IP+"|"+entry.Source] = entry
+	}
+	return session, nil
+}
+
+// replayProber 模拟探测：按录制的耗时等待后返回录制的结果，不需要网络和 root 权限
+type replayProber struct {
+	entries map[string]*SessionEntry
+	speed   float64 // 回放速度倍数，0 表示不等待
+}
+
+func (p *replayProber) Probe(to net.IP, sourceIP net.IP, count int, adaptive AdaptiveOptions) (*ping.Statistics, error) {
+	entry, ok := p.entries[probeKey(to, sourceIP)]
+	if !ok {
+		return nil, fmt.Errorf("录制文件中没有目标 %s 的结果", to)
+	}
+	if p.speed > 0 {
+		time.Sleep(time.Duration(float64(entry.Duration) / p.speed))
+	}
+	if entry.Err != "" {
+		return nil, errors.New(entry.Err)
+	}
+	return entry.Stats, nil
+}
+
+// Details 返回录制的附加结果
+func (p *replayProber) Details(to net.IP, sourceIP net.IP) *ProbeDetails {
+	if entry, ok := p.entries[probeKey(to, sourceIP)]; ok {
+		return entry.Details
+	}
+	return nil
+}
+
+// Replay 回放录制文件：使用录制时的参数和目标，经过与实时探测相同的汇总和输出流程
+func Replay(path string, speed float64, sort string, des bool, output OutputOptions) error {
+	if err := ValidateSort(sort); err != nil {
+		return err
+	}
+	renderer, err := prepareOutput(&output)
+	if err != nil {
+		return err
+	}
+	session, err := LoadSession(path)
+	if err != nil {
+		return err
+	}
+	header := session.Header
+	fmt.Fprintf(os.Stderr, "✅ 回放 %s（录制于 %s）：区域=%s，运营商=%s，源IP=%s\n",
+		path, header.CreatedAt.Format("2006-01-02 15:04:05"), header.Region, header.Isp, header.Source)
+
+	cfg := &runConfig{
+		isp:            header.Isp,
+		region:         header.Region,
+		localIPs:       parseSources(header.Sources),
+		localIPStr:     header.Source,
+		interfaces:     header.Interfaces,
+		maxConcurrency: header.MaxConcurrency,
+		count:          header.Count,
+		sort:           sort,
+		des:            des,
+		output:         output,
+		renderer:       renderer,
+	}
+	if cfg.maxConcurrency <= 0 {
+		cfg.maxConcurrency = 1
+	}
+	execute(cfg, header.Targets, &replayProber{entries: session.Entries, speed: speed})
+	return nil
+}
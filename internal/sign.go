@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// SnapshotSignature 快照的 Ed25519 签名（-sign-key），用于证明保存或推送的结果在生成后未被修改，
+// 如向运营商申诉 SLA 时作为证据。签名覆盖去掉 signature 字段后的整个快照，公钥随签名保存，
+// 出示证据时另行提供公钥（或其 key_id）供对方核对签名者
+type SnapshotSignature struct {
+	Alg       string `json:"alg"`        // 签名算法，当前为 ed25519
+	KeyID     string `json:"key_id"`     // 公钥 SHA-256 的前 8 字节，十六进制
+	PublicKey string `json:"public_key"` // 签名公钥，base64
+	Value     string `json:"value"`      // 签名，base64
+}
+
+// signatureAlg 当前的签名算法
+const signatureAlg = "ed25519"
+
+// signedContent 签名覆盖的内容：去掉签名后快照的紧凑 JSON，与保存时的缩进格式无关
+func signedContent(snap *Snapshot) ([]byte, error) {
+	unsigned := *snap
+	unsigned.Signature = nil
+	return json.Marshal(&unsigned)
+}
+
+// keyID 公钥的短标识，用于在输出中核对签名者
+func keyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// SignSnapshot 以私钥签名快照，签名写入 snap.Signature；之后再修改快照会使签名失效
+func SignSnapshot(snap *Snapshot, key ed25519.PrivateKey) error {
+	content, err := signedContent(snap)
+	if err != nil {
+		return fmt.Errorf("签名快照失败: %v", err)
+	}
+	snap.Signature = newSignature(content, key)
+	return nil
+}
+
+// newSignature 以私钥签名内容，快照和验收报告共用
+func newSignature(content []byte, key ed25519.PrivateKey) *SnapshotSignature {
+	pub := key.Public().(ed25519.PublicKey)
+	return &SnapshotSignature{
+		Alg:       signatureAlg,
+		KeyID:     keyID(pub),
+		PublicKey: base64.StdEncoding.EncodeToString(pub),
+		Value:     base64.StdEncoding.EncodeToString(ed25519.Sign(key, content)),
+	}
+}
+
+// VerifySnapshot 校验快照的签名：没有签名时返回 false；签名与内容不符时返回错误。
+// trusted 非空时还要求签名公钥与之相同，否则任何人都可以修改内容后用自己的密钥重新签名
+func VerifySnapshot(snap *Snapshot, trusted ed25519.PublicKey) (bool, error) {
+	if snap.Signature == nil {
+		if trusted != nil {
+			return false, fmt.Errorf("没有签名，要求由密钥 %s 签名", keyID(trusted))
+		}
+		return false, nil
+	}
+	content, err := signedContent(snap)
+	if err != nil {
+		return true, err
+	}
+	return true, checkSignature(snap.Signature, content, trusted)
+}
+
+// checkSignature 校验内容的签名，trusted 非空时还要求签名公钥与之相同
+func checkSignature(sig *SnapshotSignature, content []byte, trusted ed25519.PublicKey) error {
+	if sig.Alg != signatureAlg {
+		return fmt.Errorf("不支持的签名算法 '%s'", sig.Alg)
+	}
+	pub, err := base64.StdEncoding.DecodeString(sig.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return fmt.Errorf("签名公钥无效")
+	}
+	value, err := base64.StdEncoding.DecodeString(sig.Value)
+	if err != nil {
+		return fmt.Errorf("签名无效: %v", err)
+	}
+	if !ed25519.Verify(pub, content, value) {
+		return fmt.Errorf("签名校验失败，内容在签名后被修改过")
+	}
+	if trusted != nil && !bytes.Equal(pub, trusted) {
+		return fmt.Errorf("由密钥 %s 签名，不是要求的 %s", keyID(pub), keyID(trusted))
+	}
+	return nil
+}
+
+// LoadSigningKey 读取 PEM 格式（PKCS#8）的 Ed25519 私钥，如 openssl genpkey -algorithm ed25519 生成的
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析签名私钥 %s 失败: %v", path, err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("签名私钥 %s 不是 Ed25519 密钥", path)
+	}
+	return priv, nil
+}
+
+// LoadVerifyKey 读取 PEM 格式的 Ed25519 公钥（openssl pkey -pubout 导出的）；也接受私钥文件，取其公钥
+func LoadVerifyKey(path string) (ed25519.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "PRIVATE KEY" {
+		priv, err := LoadSigningKey(path)
+		if err != nil {
+			return nil, err
+		}
+		return priv.Public().(ed25519.PublicKey), nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析公钥 %s 失败: %v", path, err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("公钥 %s 不是 Ed25519 密钥", path)
+	}
+	return pub, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取密钥 %s 失败: %v", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("密钥 %s 不是 PEM 格式", path)
+	}
+	return block, nil
+}
+
+// loadTrustedSnapshot 读取快照，trusted 非空时要求由该公钥签名
+func loadTrustedSnapshot(path string, trusted ed25519.PublicKey) (*Snapshot, error) {
+	snap, err := LoadSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := VerifySnapshot(snap, trusted); err != nil {
+		return nil, fmt.Errorf("快照 %s %v", path, err)
+	}
+	return snap, nil
+}
+
+// Verify 校验快照文件（或 dping accept 的验收报告）的签名并逐个输出结果，trusted 非空时要求由该公钥签名；
+// 有文件未签名或校验失败时返回错误
+func Verify(paths []string, trusted ed25519.PublicKey) error {
+	failed := 0
+	for _, path := range paths {
+		if isAcceptReport(path) {
+			if err := verifyAcceptReport(path, trusted); err != nil {
+				failed++
+				fmt.Printf("❌ %s: %v\n", path, err)
+			}
+			continue
+		}
+		snap, err := LoadSnapshot(path)
+		if err == nil {
+			_, err = VerifySnapshot(snap, trusted)
+			if err == nil && snap.Signature == nil {
+				err = fmt.Errorf("没有签名")
+			}
+		}
+		if err != nil {
+			failed++
+			fmt.Printf("❌ %s: %v\n", path, err)
+			continue
+		}
+		fmt.Printf("✅ %s: 签名有效（密钥 %s，%s %s）\n", path, snap.Signature.KeyID, snap.CreatedAt.Format("2006-01-02 15:04:05"), snap.Host)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 个文件未通过签名校验", failed)
+	}
+	return nil
+}
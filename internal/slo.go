@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// AlertScopeIsp 按运营商整体（时延目标）产生的告警事件的范围，逐目标的事件范围为空
+const AlertScopeIsp = "isp"
+
+// sloPercentile 时延目标按全部目标平均 RTT 的该百分位计算
+const sloPercentile = 95
+
+// sloState 一个运营商（按源IP和探测方式区分）的时延目标状态，连续达标且未告警时不保留
+type sloState struct {
+	breaches   int       // 连续超出目标的轮数
+	passes     int       // 告警后连续达标的轮数
+	since      time.Time // 本次连续超出目标的第一轮
+	firing     bool
+	notifiedAt time.Time
+	reason     string
+}
+
+// sloGroup 一轮中一个运营商的全部目标
+type sloGroup struct {
+	isp, source, proto string
+	rtts               []weightedRtt
+	totals             *rowTotals
+}
+
+// weightedRtt 一个目标的平均 RTT 及其权重
+type weightedRtt struct {
+	ms, weight float64
+}
+
+// evaluateSLO 按运营商汇总本轮各目标的平均 RTT，p95 连续 SloWindows 轮超过 SloRtt 时告警，
+// 告警后连续 SloWindows 轮达标时恢复；本轮某运营商没有收到回包的目标时保持原状态
+func (m *AlertManager) evaluateSLO(rows []*SnapshotRow, now time.Time) []*AlertEvent {
+	if m.opts.SloRtt <= 0 {
+		return nil
+	}
+	var order []string
+	groups := make(map[string]*sloGroup)
+	counted := make(map[string]bool)
+	for _, row := range rows {
+		key := strings.Join([]string{row.Isp, row.Source, row.Proto}, "|")
+		g := groups[key]
+		if g == nil {
+			g = &sloGroup{isp: row.Isp, source: row.Source, proto: row.Proto, totals: newRowTotals()}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.totals.add(row.Summary())
+		// 同一IP以多个地区标签出现时只计一次，全部丢包的目标没有 RTT，由丢包告警负责
+		if ipKey := key + "|" + row.DestIP; row.Recv > 0 && row.Error == "" && !counted[ipKey] {
+			counted[ipKey] = true
+			g.rtts = append(g.rtts, weightedRtt{ms: row.AvgRttMs, weight: targetWeight(row.Weight)})
+		}
+	}
+
+	var events []*AlertEvent
+	for _, key := range order {
+		g := groups[key]
+		if len(g.rtts) == 0 {
+			continue
+		}
+		p95 := rttPercentile(g.rtts, sloPercentile)
+		st := m.slo[key]
+		if p95 > durationToMs(m.opts.SloRtt) {
+			if st == nil {
+				st = &sloState{since: now}
+				m.slo[key] = st
+			}
+			st.breaches++
+			st.passes = 0
+			st.reason = fmt.Sprintf("p%d RTT %.1fms > 目标 %s（%d 个目标，连续 %d 轮）", sloPercentile, p95, m.opts.SloRtt, len(g.rtts), st.breaches)
+			switch {
+			case !st.firing && st.breaches >= m.opts.SloWindows:
+				st.firing, st.notifiedAt = true, now
+				events = append(events, g.event(AlertFiring, false, p95, st, now))
+			case st.firing && m.opts.Renotify > 0 && now.Sub(st.notifiedAt) >= m.opts.Renotify:
+				st.notifiedAt = now
+				events = append(events, g.event(AlertFiring, true, p95, st, now))
+			}
+			continue
+		}
+		if st == nil {
+			continue
+		}
+		if !st.firing {
+			// 未连续超出 SloWindows 轮，重新计数
+			delete(m.slo, key)
+			continue
+		}
+		st.breaches = 0
+		st.passes++
+		if st.passes >= m.opts.SloWindows {
+			delete(m.slo, key)
+			events = append(events, g.event(AlertResolved, false, p95, st, now))
+		}
+	}
+	return events
+}
+
+func (g *sloGroup) event(status string, repeat bool, p95 float64, st *sloState, now time.Time) *AlertEvent {
+	return &AlertEvent{
+		Status:      status,
+		Repeat:      repeat,
+		Scope:       AlertScopeIsp,
+		Isp:         g.isp,
+		Source:      g.source,
+		LossPercent: g.totals.loss(),
+		AvgRttMs:    durationToMs(g.totals.avgRtt()),
+		P95RttMs:    p95,
+		Targets:     len(g.rtts),
+		Reason:      st.reason,
+		Since:       st.since,
+		At:          now,
+	}
+}
+
+// rttPercentile 按权重的百分位（最近秩）：升序累加权重，第一个达到总权重 p% 的值；权重都为 1 时即第 ⌈n×p%⌉ 个
+func rttPercentile(rtts []weightedRtt, p float64) float64 {
+	sorted := slices.Clone(rtts)
+	slices.SortFunc(sorted, func(a, b weightedRtt) int { return cmp.Compare(a.ms, b.ms) })
+	var total float64
+	for _, r := range sorted {
+		total += r.weight
+	}
+	// 容许浮点误差，如 20 个目标的 95% 应为第 19 个
+	rank := total*p/100 - 1e-9
+	var cum float64
+	for _, r := range sorted {
+		cum += r.weight
+		if cum >= rank {
+			return r.ms
+		}
+	}
+	return sorted[len(sorted)-1].ms
+}
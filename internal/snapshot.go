@@ -0,0 +1,314 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// SchemaVersion 机器可读输出（快照、JSON 结果）的格式版本。
+// 只新增字段时版本不变；删除、重命名字段或改变字段含义时必须加一，格式说明见 docs/schema.md
+const SchemaVersion = 2
+
+// Snapshot 一次探测的汇总结果，所有机器可读输出都使用该格式
+type Snapshot struct {
+	SchemaVersion   int                     `json:"schema_version"`
+	CreatedAt       time.Time               `json:"created_at"`
+	RunID           string                  `json:"run_id,omitempty"` // 本次运行（持续探测时为本轮）的 UUID，用于关联同一次探测的各种输出
+	Host            string                  `json:"host"`
+	Source          string                  `json:"source"`
+	Isp             string                  `json:"isp"`
+	Region          string                  `json:"region"`
+	Count           int                     `json:"count"`
+	Note            string                  `json:"note,omitempty"`
+	LocalIsp        string                  `json:"local_isp,omitempty"` // 探测主机所在的运营商（-local-isp），多观测点对比时按其汇总运营商间的互联时延
+	Protocols       []string                `json:"protocols,omitempty"`
+	Rows            []*SnapshotRow          `json:"rows"`
+	Unanswered      []*SnapshotRow          `json:"unanswered,omitempty"` // 全部丢包、不计入 rows 和总计的目标，只有收发包数
+	Budget          *BudgetResult           `json:"budget,omitempty"`
+	Recommendations []*SourceRecommendation `json:"recommendations,omitempty"`
+	Telemetry       *Telemetry              `json:"telemetry,omitempty"`
+	DNSClusters     []*DNSCluster           `json:"dns_clusters,omitempty"`
+	ECSMappings     []*ECSMapping           `json:"ecs,omitempty"`
+	Services        []*SnapshotService      `json:"services,omitempty"`
+	Gateways        []*GatewayCheck         `json:"gateways,omitempty"`         // 指定 -check-gateway 时探测前默认网关的二层可达性
+	ProtoMismatches []*ProtoMismatch        `json:"proto_mismatches,omitempty"` // 同时探测 ICMP 和 TCP 时两者明显不一致的目标
+	Rounds          int                     `json:"rounds,omitempty"`           // 历史文件中按小时合并的结果由多少轮合并而来，逐轮结果为 0
+	Totals          *ReportTotals           `json:"totals,omitempty"`           // 汇总表和丢包表的总计及按运营商的小计，与表格的小计、总计行相同
+	Signature       *SnapshotSignature      `json:"signature,omitempty"`        // 指定 -sign-key 时对其余全部字段的签名，见 SignSnapshot
+}
+
+// SnapshotRow 单个目标（IP + 运营商 + 地区）的汇总结果，时间统一以毫秒表示
+type SnapshotRow struct {
+	DestIP        string               `json:"dest_ip"`
+	Region        string               `json:"region"`
+	Isp           string               `json:"isp"`
+	Source        string               `json:"source,omitempty"`
+	Proto         string               `json:"proto,omitempty"`
+	Tags          map[string]string    `json:"tags,omitempty"`
+	Group         string               `json:"group,omitempty"`
+	Weight        float64              `json:"weight,omitempty"`
+	Sent          int                  `json:"sent"`
+	Recv          int                  `json:"recv"`
+	LossPercent   float64              `json:"loss_percent"`
+	Duplicates    int                  `json:"duplicates"`
+	MinRttMs      float64              `json:"min_rtt_ms"`
+	MaxRttMs      float64              `json:"max_rtt_ms"`
+	AvgRttMs      float64              `json:"avg_rtt_ms"`
+	StdDevRttMs   float64              `json:"stddev_rtt_ms"`
+	Score         float64              `json:"score"`
+	UpdatedAt     time.Time            `json:"updated_at"`
+	Timestamp     *SnapshotTimestamp   `json:"timestamp,omitempty"`
+	HTTPTiming    *SnapshotHTTPTiming  `json:"http_timing,omitempty"`
+	TCPOutcomes   *SnapshotTCPOutcomes `json:"tcp_outcomes,omitempty"`
+	BudgetPass    *bool                `json:"budget_pass,omitempty"`
+	LossStreak    *SnapshotLossStreak  `json:"loss_streak,omitempty"`
+	DNSAnswers    []string             `json:"dns_answers,omitempty"`
+	ECSAnswers    []*ECSAnswer         `json:"ecs_answers,omitempty"`
+	DNSSEC        *bool                `json:"dnssec_validating,omitempty"`
+	PathMTU       int                  `json:"path_mtu,omitempty"`
+	PrevLoss      *float64             `json:"prev_loss_percent,omitempty"`
+	PrevAvgRtt    *float64             `json:"prev_avg_rtt_ms,omitempty"`
+	ExpectedRttMs float64              `json:"expected_rtt_ms,omitempty"` // 指定 -geo-from 时按地理距离估算的 RTT
+	Detour        bool                 `json:"detour,omitempty"`          // 实测平均 RTT 明显超过预期，线路可能绕行
+	Error         string               `json:"error,omitempty"`
+}
+
+// SnapshotLossStreak 持续探测时该目标连续丢包的轮数（-watch 时输出）
+type SnapshotLossStreak struct {
+	Current int `json:"current"`
+	Longest int `json:"longest"`
+}
+
+// SnapshotTCPOutcomes TCP 探测建连结果分类计数（-proto tcp 时输出）
+type SnapshotTCPOutcomes struct {
+	Connected   int `json:"connected"`
+	Refused     int `json:"refused"`
+	Reset       int `json:"reset"`
+	Timeout     int `json:"timeout"`
+	Unreachable int `json:"unreachable"`
+	Other       int `json:"other"`
+}
+
+// SnapshotHTTPTiming HTTP 探测各阶段的平均耗时（-proto http/https 时输出）
+type SnapshotHTTPTiming struct {
+	Samples   int     `json:"samples"`
+	DNSMs     float64 `json:"dns_ms"`
+	ConnectMs float64 `json:"connect_ms"`
+	TLSMs     float64 `json:"tls_ms"`
+	TTFBMs    float64 `json:"ttfb_ms"`
+}
+
+// SnapshotTimestamp 时钟偏差与单向时延（-proto icmp-ts 且目标支持时，或 -proto ntp 时输出）
+type SnapshotTimestamp struct {
+	Samples       int     `json:"samples"`
+	ClockOffsetMs float64 `json:"clock_offset_ms"`
+	ForwardMs     float64 `json:"forward_ms"`
+	ReturnMs      float64 `json:"return_ms"`
+}
+
+func durationToMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func msToDuration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// newSnapshotRow 将汇总数据转换为输出格式
+func newSnapshotRow(sum *SummaryStatistic) *SnapshotRow {
+	row := &SnapshotRow{
+		DestIP:      sum.DestIP,
+		Region:      sum.Region,
+		Isp:         sum.Isp,
+		Source:      sum.Source,
+		Proto:       sum.Proto,
+		Tags:        sum.Tags,
+		Group:       sum.Group,
+		Weight:      sum.Weight,
+		Sent:        sum.TotalSent,
+		Recv:        sum.TotalRecv,
+		LossPercent: sum.PacketLoss,
+		Duplicates:  sum.PacketsRecvDuplicates,
+		MinRttMs:    durationToMs(sum.MinRtt),
+		MaxRttMs:    durationToMs(sum.MaxRtt),
+		AvgRttMs:    durationToMs(sum.AvgRtt),
+		StdDevRttMs: durationToMs(sum.StdDevRtt),
+		Score:       sum.Score,
+		UpdatedAt:   sum.LastUpdated,
+		Error:       sum.Error,
+		DNSAnswers:  sum.DNSAnswers,
+		ECSAnswers:  sum.ECSAnswers,
+		DNSSEC:      sum.DNSSEC,
+		PathMTU:     sum.PathMTU,
+	}
+	if ts := sum.Timestamps; ts != nil {
+		row.Timestamp = &SnapshotTimestamp{
+			Samples:       ts.Samples,
+			ClockOffsetMs: durationToMs(ts.ClockOffset),
+			ForwardMs:     durationToMs(ts.Forward),
+			ReturnMs:      durationToMs(ts.Return),
+		}
+	}
+	if t := sum.HTTPTiming; t != nil {
+		row.HTTPTiming = &SnapshotHTTPTiming{
+			Samples:   t.Samples,
+			DNSMs:     durationToMs(t.DNS),
+			ConnectMs: durationToMs(t.Connect),
+			TLSMs:     durationToMs(t.TLS),
+			TTFBMs:    durationToMs(t.TTFB),
+		}
+	}
+	if o := sum.TCPOutcomes; o != nil {
+		outcomes := SnapshotTCPOutcomes(*o)
+		row.TCPOutcomes = &outcomes
+	}
+	if l := sum.LossStreak; l != nil {
+		row.LossStreak = &SnapshotLossStreak{Current: l.Current, Longest: l.Longest}
+	}
+	if p := sum.Previous; p != nil {
+		loss, avg := p.PacketLoss, durationToMs(p.AvgRtt)
+		row.PrevLoss, row.PrevAvgRtt = &loss, &avg
+	}
+	return row
+}
+
+// Summary 将输出格式还原为汇总数据
+func (r *SnapshotRow) Summary() *SummaryStatistic {
+	sum := &SummaryStatistic{
+		DestIP:                r.DestIP,
+		Region:                r.Region,
+		Isp:                   r.Isp,
+		Source:                r.Source,
+		Proto:                 r.Proto,
+		Tags:                  r.Tags,
+		Group:                 r.Group,
+		Weight:                r.Weight,
+		TotalSent:             r.Sent,
+		TotalRecv:             r.Recv,
+		MinRtt:                msToDuration(r.MinRttMs),
+		MaxRtt:                msToDuration(r.MaxRttMs),
+		AvgRtt:                msToDuration(r.AvgRttMs),
+		StdDevRtt:             msToDuration(r.StdDevRttMs),
+		LastUpdated:           r.UpdatedAt,
+		PacketLoss:            r.LossPercent,
+		PacketsRecvDuplicates: r.Duplicates,
+		Score:                 r.Score,
+		Error:                 r.Error,
+		DNSAnswers:            r.DNSAnswers,
+		ECSAnswers:            r.ECSAnswers,
+		DNSSEC:                r.DNSSEC,
+		PathMTU:               r.PathMTU,
+	}
+	if ts := r.Timestamp; ts != nil {
+		sum.Timestamps = &TimestampStats{
+			Samples:     ts.Samples,
+			ClockOffset: msToDuration(ts.ClockOffsetMs),
+			Forward:     msToDuration(ts.ForwardMs),
+			Return:      msToDuration(ts.ReturnMs),
+		}
+	}
+	if t := r.HTTPTiming; t != nil {
+		sum.HTTPTiming = &HTTPTiming{
+			Samples: t.Samples,
+			DNS:     msToDuration(t.DNSMs),
+			Connect: msToDuration(t.ConnectMs),
+			TLS:     msToDuration(t.TLSMs),
+			TTFB:    msToDuration(t.TTFBMs),
+		}
+	}
+	if o := r.TCPOutcomes; o != nil {
+		outcomes := TCPOutcomes(*o)
+		sum.TCPOutcomes = &outcomes
+	}
+	if l := r.LossStreak; l != nil {
+		sum.LossStreak = &LossStreak{Current: l.Current, Longest: l.Longest}
+	}
+	if r.PrevLoss != nil && r.PrevAvgRtt != nil {
+		sum.Previous = &PreviousResult{PacketLoss: *r.PrevLoss, AvgRtt: msToDuration(*r.PrevAvgRtt)}
+	}
+	return sum
+}
+
+// NewSnapshot 根据汇总结果生成快照
+func NewSnapshot(rows []*SummaryStatistic, isp, region, source string, count int) *Snapshot {
+	host, _ := os.Hostname()
+	snap := &Snapshot{
+		SchemaVersion: SchemaVersion,
+		CreatedAt:     time.Now(),
+		Host:          host,
+		Source:        source,
+		Isp:           isp,
+		Region:        region,
+		Count:         count,
+		Rows:          make([]*SnapshotRow, 0, len(rows)),
+	}
+	for _, sum := range rows {
+		snap.Rows = append(snap.Rows, newSnapshotRow(sum))
+	}
+	return snap
+}
+
+// writeSnapshot 将快照以缩进的 JSON 格式写入 w
+func writeSnapshot(w io.Writer, snap *Snapshot) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(snap)
+}
+
+// SaveSnapshot 将快照以 JSON 格式写入文件：先写入 path.tmp 再改名替换，写入失败时原文件保持不变，
+// 读取方不会读到写了一半的文件；path 为设备文件（如 /dev/null、/dev/stdout）时直接写入
+func SaveSnapshot(path string, snap *Snapshot) error {
+	if info, err := os.Stat(path); err == nil && !info.Mode().IsRegular() {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return fmt.Errorf("创建快照 %s 失败: %v", path, err)
+		}
+		if err := writeSnapshot(f, snap); err != nil {
+			f.Close()
+			return fmt.Errorf("写入快照 %s 失败: %v", path, err)
+		}
+		return f.Close()
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("创建快照 %s 失败: %v", path, err)
+	}
+	if err := writeSnapshot(f, snap); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("写入快照 %s 失败: %v", path, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("写入快照 %s 失败: %v", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("写入快照 %s 失败: %v", path, err)
+	}
+	return nil
+}
+
+// LoadSnapshot 从文件读取快照，拒绝无版本号或版本号高于当前程序的文件，以及带有签名但校验不通过（被修改过）的文件
+func LoadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取快照 %s 失败: %v", path, err)
+	}
+	snap := &Snapshot{}
+	if err := json.Unmarshal(data, snap); err != nil {
+		return nil, fmt.Errorf("解析快照 %s 失败: %v", path, err)
+	}
+	if snap.SchemaVersion == 0 || snap.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("快照 %s 的 schema_version=%d 不受支持（当前版本 %d）", path, snap.SchemaVersion, SchemaVersion)
+	}
+	if _, err := VerifySnapshot(snap, nil); err != nil {
+		return nil, fmt.Errorf("快照 %s %v", path, err)
+	}
+	return snap, nil
+}
@@ -0,0 +1,222 @@
+package internal
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSNMPPort      = "162"
+	defaultSNMPCommunity = "public"
+	// defaultSNMPOID 未指定 -alert-snmp-oid 时 dping 通知和变量的根 OID：NET-SNMP 的实验分支 netSnmpPlaypen，
+	// 正式接入网管时应换成本单位企业号下的 OID
+	defaultSNMPOID = "1.3.6.1.4.1.8072.9999.9999"
+)
+
+// SNMPv2c 报文使用的 BER 标签
+const (
+	berInteger   = 0x02
+	berOctetStr  = 0x04
+	berOID       = 0x06
+	berSequence  = 0x30
+	berTimeTicks = 0x43
+	berTrapPDU   = 0xa7 // SNMPv2-Trap-PDU
+)
+
+// 标准 OID：sysUpTime.0 和 snmpTrapOID.0 是每个 SNMPv2 通知的前两个变量
+var (
+	oidSysUpTime   = []int{1, 3, 6, 1, 2, 1, 1, 3, 0}
+	oidSNMPTrapOID = []int{1, 3, 6, 1, 6, 3, 1, 1, 4, 1, 0}
+)
+
+// snmpSink 将告警事件以 SNMPv2c Trap 发送到网管系统：通知 OID 为 <根>.0.1（劣化）和 <根>.0.2（恢复），
+// 目标、地区、运营商、丢包率等变量在 <根>.1.N 下，均为字符串，网管的 Trap 控制台不需要 MIB 也能直接显示
+type snmpSink struct {
+	addr      string
+	community string
+	root      []int
+	start     time.Time // sysUpTime 的起点
+}
+
+// NewSNMPSink 按告警参数中的 SNMPTrap、SNMPCommunity 和 SNMPOID 创建以 SNMP Trap 发送事件的 AlertSink，供 NewAlertManager 使用
+func NewSNMPSink(o AlertOptions) (AlertSink, error) {
+	if o.SNMPTrap == "" {
+		return nil, fmt.Errorf("没有指定 SNMP Trap 地址")
+	}
+	if err := validateSNMP(o); err != nil {
+		return nil, err
+	}
+	return newSNMPSink(o), nil
+}
+
+// newSNMPSink 按告警参数创建 SNMP Trap 发送，参数已校验
+func newSNMPSink(o AlertOptions) *snmpSink {
+	root, _ := parseOID(cmp.Or(o.SNMPOID, defaultSNMPOID))
+	return &snmpSink{addr: snmpAddr(o.SNMPTrap), community: cmp.Or(o.SNMPCommunity, defaultSNMPCommunity), root: root, start: time.Now()}
+}
+
+// snmpAddr 补全 Trap 接收地址的默认端口 162
+func snmpAddr(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(strings.Trim(addr, "[]"), defaultSNMPPort)
+}
+
+// validateSNMP 校验 Trap 接收地址和根 OID
+func validateSNMP(o AlertOptions) error {
+	if o.SNMPTrap == "" {
+		if o.SNMPCommunity != "" || o.SNMPOID != "" {
+			return fmt.Errorf("-alert-snmp-community 和 -alert-snmp-oid 需要同时指定 -alert-snmp")
+		}
+		return nil
+	}
+	host, port, err := net.SplitHostPort(snmpAddr(o.SNMPTrap))
+	if n, perr := strconv.Atoi(port); err != nil || host == "" || perr != nil || n <= 0 || n > 65535 {
+		return fmt.Errorf("SNMP Trap 地址 -alert-snmp 必须是 主机[:端口]，当前为 '%s'", o.SNMPTrap)
+	}
+	if o.SNMPOID != "" {
+		if _, err := parseOID(o.SNMPOID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseOID 解析点分形式的 OID，前两段须为 0–2 和 0–39（第一段为 2 时不限）
+func parseOID(s string) ([]int, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "."), ".")
+	oid := make([]int, 0, len(parts))
+	for _, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("OID -alert-snmp-oid '%s' 无效", s)
+		}
+		oid = append(oid, n)
+	}
+	if len(oid) < 2 || oid[0] > 2 || (oid[0] < 2 && oid[1] > 39) {
+		return nil, fmt.Errorf("OID -alert-snmp-oid '%s' 无效", s)
+	}
+	return oid, nil
+}
+
+func (s *snmpSink) Notify(e *AlertEvent) error {
+	conn, err := net.Dial("udp", s.addr)
+	if err != nil {
+		return fmt.Errorf("发送 SNMP Trap 到 %s 失败: %v", s.addr, err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(s.trap(e, time.Since(s.start))); err != nil {
+		return fmt.Errorf("发送 SNMP Trap 到 %s 失败: %v", s.addr, err)
+	}
+	return nil
+}
+
+// trap 编码告警事件的 SNMPv2c Trap 报文，uptime 为 sysUpTime（以 0.01 秒计，约 497 天回绕）
+func (s *snmpSink) trap(e *AlertEvent, uptime time.Duration) []byte {
+	notification := 1
+	if e.Status == AlertResolved {
+		notification = 2
+	}
+	varbinds := [][]byte{
+		varbind(oidSysUpTime, berTLV(berTimeTicks, berUint(uint64(uint32(uptime/(10*time.Millisecond)))))),
+		varbind(oidSNMPTrapOID, berTLV(berOID, berOIDValue(s.oid(0, notification)))),
+	}
+	for i, value := range []string{
+		e.Status,
+		e.DestIP,
+		e.Region,
+		e.Isp,
+		e.Source,
+		strconv.FormatFloat(e.LossPercent, 'f', 1, 64),
+		strconv.FormatFloat(e.AvgRttMs, 'f', 1, 64),
+		e.Reason,
+		e.Since.Format(time.RFC3339),
+		e.RunID,
+		e.Scope,
+		strconv.FormatBool(e.Repeat),
+	} {
+		varbinds = append(varbinds, varbind(s.oid(1, i+1), berTLV(berOctetStr, []byte(value))))
+	}
+	pdu := berTLV(berTrapPDU, bytes.Join([][]byte{
+		berTLV(berInteger, berInt(int64(rand.Int32()))), // request-id
+		berTLV(berInteger, berInt(0)),                   // error-status
+		berTLV(berInteger, berInt(0)),                   // error-index
+		berTLV(berSequence, bytes.Join(varbinds, nil)),
+	}, nil))
+	return berTLV(berSequence, bytes.Join([][]byte{
+		berTLV(berInteger, berInt(1)), // version: 1 为 SNMPv2c
+		berTLV(berOctetStr, []byte(s.community)),
+		pdu,
+	}, nil))
+}
+
+// oid 返回 <根>.a.b
+func (s *snmpSink) oid(a, b int) []int {
+	return append(append([]int(nil), s.root...), a, b)
+}
+
+// varbind 编码一个变量绑定
+func varbind(oid []int, value []byte) []byte {
+	return berTLV(berSequence, append(berTLV(berOID, berOIDValue(oid)), value...))
+}
+
+// berTLV 编码标签、长度和值，长度超过 127 字节时使用长格式
+func berTLV(tag byte, value []byte) []byte {
+	out := []byte{tag}
+	if n := len(value); n < 0x80 {
+		out = append(out, byte(n))
+	} else {
+		var length []byte
+		for ; n > 0; n >>= 8 {
+			length = append([]byte{byte(n)}, length...)
+		}
+		out = append(append(out, 0x80|byte(len(length))), length...)
+	}
+	return append(out, value...)
+}
+
+// berInt 以最少的字节编码有符号整数（补码）
+func berInt(v int64) []byte {
+	out := []byte{byte(v)}
+	for v > 0x7f || v < -0x80 {
+		v >>= 8
+		out = append([]byte{byte(v)}, out...)
+	}
+	return out
+}
+
+// berUint 编码无符号整数（TimeTicks、Gauge32 等），最高位为 1 时补一个 0 字节
+func berUint(v uint64) []byte {
+	out := []byte{byte(v)}
+	for v >>= 8; v > 0; v >>= 8 {
+		out = append([]byte{byte(v)}, out...)
+	}
+	if out[0]&0x80 != 0 {
+		out = append([]byte{0}, out...)
+	}
+	return out
+}
+
+// berOIDValue 编码 OID 的值：前两段合并为 40*a+b，每段以 7 位一组、除最后一组外最高位为 1 的形式编码
+func berOIDValue(oid []int) []byte {
+	out := base128(oid[0]*40 + oid[1])
+	for _, n := range oid[2:] {
+		out = append(out, base128(n)...)
+	}
+	return out
+}
+
+func base128(n int) []byte {
+	out := []byte{byte(n & 0x7f)}
+	for n >>= 7; n > 0; n >>= 7 {
+		out = append([]byte{byte(n&0x7f) | 0x80}, out...)
+	}
+	return out
+}
@@ -0,0 +1,36 @@
+package internal
+
+// defaultResultBuffer 探测结果通道的默认缓冲区长度
+const defaultResultBuffer = 20
+
+// spillResults 在探测和汇总之间加一个不限长度的内存队列（-result-spill）：探测协程写入 in 时只等待队列协程取走，
+// 不等待汇总，汇总跟不上时结果按顺序暂存在内存中，代价是积压时占用更多内存。in 关闭且队列排空后关闭返回的通道；
+// nil（已发出的结果都已计入的通知）与结果一样按顺序转发
+func spillResults(in <-chan *PingStatistic, telemetry *telemetryRecorder) <-chan *PingStatistic {
+	out := make(chan *PingStatistic)
+	go func() {
+		defer close(out)
+		var queue []*PingStatistic
+		for in != nil || len(queue) > 0 {
+			// 队列为空时 send 为 nil，select 只等待新结果
+			var send chan<- *PingStatistic
+			var next *PingStatistic
+			if len(queue) > 0 {
+				send, next = out, queue[0]
+			}
+			select {
+			case stat, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				queue = append(queue, stat)
+				telemetry.queued(len(queue))
+			case send <- next:
+				queue[0] = nil
+				queue = queue[1:]
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,57 @@
+package internal
+
+import "sync"
+
+// LossStreak 持续探测时一个目标连续丢包的轮数：本轮有丢包（含全部丢包和探测出错）计为丢包轮，
+// 平均丢包率看不出的间歇中断（如每隔几分钟断 30 秒）会体现为连续的丢包轮
+type LossStreak struct {
+	Current int // 截至本轮连续丢包的轮数，本轮无丢包时为 0
+	Longest int // 开始探测以来最长的连续丢包轮数
+}
+
+// LossStreaks 按目标跨轮累计连续丢包，由持续探测的各轮共用
+type LossStreaks struct {
+	mu      sync.Mutex
+	streaks map[summaryKey]*LossStreak
+}
+
+// NewLossStreaks 创建连续丢包记录，持续探测的各轮共用，每轮通过 PingStatsStore.SetLossStreaks 交给该轮的数据存储
+func NewLossStreaks() *LossStreaks {
+	return &LossStreaks{streaks: make(map[summaryKey]*LossStreak)}
+}
+
+// observe 记录目标本轮是否丢包；全部丢包的结果不进入汇总，也要在这里计入；l 为 nil（只探测一轮）时忽略
+func (l *LossStreaks) observe(stat *PingStatistic) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := statKey(stat)
+	st := l.streaks[key]
+	if st == nil {
+		st = &LossStreak{}
+		l.streaks[key] = st
+	}
+	if stat.Statistic.PacketLoss == 0 && stat.Err == "" {
+		st.Current = 0
+		return
+	}
+	st.Current++
+	st.Longest = max(st.Longest, st.Current)
+}
+
+// get 返回目标的连续丢包轮数的副本，没有记录时为 nil
+func (l *LossStreaks) get(key summaryKey) *LossStreak {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st := l.streaks[key]
+	if st == nil {
+		return nil
+	}
+	c := *st
+	return &c
+}
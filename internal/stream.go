@@ -0,0 +1,226 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// 实时推送的事件类型
+const (
+	StreamRoundStart = "round_start" // 一轮探测开始，Total 为预计的结果条数
+	StreamResult     = "result"      // 一个目标（一个标签、源IP、探测方式）的探测结果
+	StreamProgress   = "progress"    // 探测进度，每秒最多一次
+	StreamRoundEnd   = "round_end"   // 一轮探测结束，Snapshot 为本轮的汇总结果
+)
+
+// streamProgressEvery 进度事件的最小间隔，结果事件中也带有进度，界面不必等待进度事件
+const streamProgressEvery = time.Second
+
+// streamClientBuffer 每个连接待发送的事件数，写满（客户端读得太慢）时断开该连接，由客户端重连
+const streamClientBuffer = 1024
+
+// StreamEvent WebSocket 接口推送的一条事件，每条为一个 JSON 文本消息
+type StreamEvent struct {
+	Type     string       `json:"type"`
+	RunID    string       `json:"run_id"` // 本轮的运行 ID，与本轮快照的 run_id 相同
+	Round    int          `json:"round"`  // 轮次，从 1 开始；单次运行时为 1
+	Time     time.Time    `json:"time"`
+	Done     int          `json:"done"`  // 本轮已完成的结果条数
+	Total    int          `json:"total"` // 本轮预计的结果条数
+	Result   *SnapshotRow `json:"result,omitempty"`
+	Snapshot *Snapshot    `json:"snapshot,omitempty"`
+}
+
+// Stream 通过 WebSocket（/ws）向 Web 看板等界面实时推送当前轮次的每条探测结果和进度，界面不必轮询；
+// 新连接先收到本轮已有的事件，再接收后续事件。方法在 s 为 nil 时什么都不做
+type Stream struct {
+	server *http.Server
+	mux    *http.ServeMux
+	addr   net.Addr
+	scheme string
+
+	mu       sync.Mutex
+	clients  map[chan []byte]bool
+	backlog  [][]byte // 本轮已推送的事件，供中途连接的客户端补齐
+	runID    string
+	round    int
+	done     int
+	total    int
+	progress time.Time // 上次推送进度事件的时间
+}
+
+// StartStream 在 addr 上提供 WebSocket 接口 /ws，认证参数与 -pprof 共用；地址无法监听时返回错误
+func StartStream(addr string, auth HTTPAuth) (*Stream, error) {
+	ln, scheme, err := auth.listen("ws", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := newStream()
+	s.addr, s.scheme = ln.Addr(), scheme
+	s.server = &http.Server{Handler: auth.wrap(s.mux)}
+	go s.server.Serve(ln)
+	wsScheme := "ws"
+	if scheme == "https" {
+		wsScheme = "wss"
+	}
+	fmt.Fprintf(os.Stderr, "✅ 实时结果推送已启动: %s://%s/ws\n", wsScheme, ln.Addr())
+	return s, nil
+}
+
+// newStream 创建提供 /ws 的推送但不监听，由调用方把 mux 挂载到自己的服务上（如多租户时各租户一个路径前缀）
+func newStream() *Stream {
+	s := &Stream{mux: http.NewServeMux(), clients: make(map[chan []byte]bool)}
+	// 不校验 Origin：非浏览器客户端通常不带 Origin，访问控制由认证参数负责
+	s.mux.Handle("/ws", websocket.Server{Handler: s.serve})
+	return s
+}
+
+// ServeHistory 在同一地址提供 GET /api/v1/targets/{ip}/history?window=1h，返回历史文件 path 中该目标最近一段时间
+// 每轮的丢包率和 RTT，供 Web 看板等界面查看单个目标的变化
+func (s *Stream) ServeHistory(path string) {
+	s.mux.Handle("GET /api/v1/targets/{ip}/history", historyHandler(path))
+	fmt.Fprintf(os.Stderr, "✅ 目标历史接口已启动: %s://%s/api/v1/targets/{ip}/history\n", s.scheme, s.addr)
+}
+
+// Addr 实际监听的地址，监听端口为 0 时用于获取分配的端口
+func (s *Stream) Addr() net.Addr {
+	return s.addr
+}
+
+// Close 停止服务并断开全部连接
+func (s *Stream) Close() {
+	if s == nil {
+		return
+	}
+	if s.server != nil {
+		s.server.Close()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.clients {
+		close(ch)
+		delete(s.clients, ch)
+	}
+}
+
+// serve 处理一个 WebSocket 连接：先发送本轮已有的事件，再转发后续事件，直到客户端断开或读得太慢
+func (s *Stream) serve(ws *websocket.Conn) {
+	defer ws.Close()
+	ch := make(chan []byte, streamClientBuffer)
+	s.mu.Lock()
+	backlog := s.backlog
+	s.clients[ch] = true
+	s.mu.Unlock()
+	defer s.remove(ch)
+
+	// 客户端不发送数据，读取只用于发现连接断开
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var discard string
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+	}()
+	send := func(msg []byte) bool {
+		return websocket.Message.Send(ws, string(msg)) == nil
+	}
+	for _, msg := range backlog {
+		if !send(msg) {
+			return
+		}
+	}
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok || !send(msg) {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func (s *Stream) remove(ch chan []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clients[ch] {
+		delete(s.clients, ch)
+		close(ch)
+	}
+}
+
+// publish 推送一条事件，调用时须持有 s.mu；读得太慢的连接被断开，不阻塞探测
+func (s *Stream) publish(event *StreamEvent) {
+	event.RunID, event.Round, event.Done, event.Total, event.Time = s.runID, s.round, s.done, s.total, time.Now()
+	msg, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("⚠️  实时推送的事件编码失败: %v\n", err)
+		return
+	}
+	s.backlog = append(s.backlog, msg)
+	for ch := range s.clients {
+		select {
+		case ch <- msg:
+		default:
+			delete(s.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+// roundStart 开始新的一轮，total 为预计的结果条数
+func (s *Stream) roundStart(runID string, total int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.round++
+	s.runID, s.done, s.total, s.backlog = runID, 0, total, nil
+	s.publish(&StreamEvent{Type: StreamRoundStart})
+}
+
+// result 推送一条探测结果，在结果被回收前调用
+func (s *Stream) result(stat *PingStatistic) {
+	if s == nil {
+		return
+	}
+	row := &SnapshotRow{
+		DestIP: stat.DecIp, Region: stat.Region, Isp: stat.Isp, Source: stat.SrcIp, Proto: stat.Proto, Tags: stat.Tags,
+		Weight: stat.Weight, UpdatedAt: time.Now(), Error: stat.Err,
+	}
+	if st := stat.Statistic; st != nil {
+		row.Sent, row.Recv, row.LossPercent, row.Duplicates = st.PacketsSent, st.PacketsRecv, st.PacketLoss, st.PacketsRecvDuplicates
+		if st.PacketsRecv > 0 {
+			row.MinRttMs, row.MaxRttMs = durationToMs(st.MinRtt), durationToMs(st.MaxRtt)
+			row.AvgRttMs, row.StdDevRttMs = durationToMs(st.AvgRtt), durationToMs(st.StdDevRtt)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done++
+	s.publish(&StreamEvent{Type: StreamResult, Result: row})
+	if time.Since(s.progress) >= streamProgressEvery || s.done == s.total {
+		s.progress = time.Now()
+		s.publish(&StreamEvent{Type: StreamProgress})
+	}
+}
+
+// roundEnd 推送本轮的汇总结果
+func (s *Stream) roundEnd(snap *Snapshot) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.publish(&StreamEvent{Type: StreamRoundEnd, Snapshot: snap})
+}
@@ -0,0 +1,192 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestStream(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	dir := t.TempDir()
+	targetFile := filepath.Join(dir, "targets.txt")
+	if err := os.WriteFile(targetFile, []byte("127.0.0.1 北京 电信\n127.0.0.1 天津 电信\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := internal.StartStream("127.0.0.1:0", internal.HTTPAuth{Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	run := func() string {
+		result, err := internal.DPing(internal.Options{MaxConcurrency: 10, Count: 1,
+			Probe:   internal.ProbeOptions{Proto: "tcp", Port: ln.Addr().(*net.TCPAddr).Port},
+			Targets: internal.TargetOptions{File: targetFile},
+			Output:  internal.OutputOptions{Format: "json", NoPager: true, OutPath: filepath.Join(dir, "result.json")},
+			Stream:  stream})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.Snapshot.RunID
+	}
+	url := "ws://" + stream.Addr().String() + "/ws"
+	dial := func(token string) (*websocket.Conn, error) {
+		config, err := websocket.NewConfig(url, "http://localhost/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.Header.Set("Authorization", "Bearer "+token)
+		return websocket.DialConfig(config)
+	}
+	if _, err := dial("wrong"); err == nil {
+		t.Fatal("令牌错误时不应能连接")
+	}
+
+	// 第一轮结束后才连接，先收到本轮已有的事件
+	runID := run()
+	ws, err := dial("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	receive := func() *internal.StreamEvent {
+		t.Helper()
+		ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+		var event internal.StreamEvent
+		if err := websocket.JSON.Receive(ws, &event); err != nil {
+			t.Fatal(err)
+		}
+		return &event
+	}
+	// 一轮的事件：开始、两条结果（同一目标的两个标签）和其间的进度、结束，都带有本轮快照的运行 ID
+	checkRound := func(round int, runID string) {
+		t.Helper()
+		if runID == "" {
+			t.Fatal("快照应带有运行 ID")
+		}
+		if e := receive(); e.Type != internal.StreamRoundStart || e.Round != round || e.Total != 2 {
+			t.Fatalf("第 %d 轮应先收到 round_start，实际为 %+v", round, e)
+		}
+		regions := make(map[string]bool)
+		var progress *internal.StreamEvent
+		for {
+			e := receive()
+			if e.Round != round || e.RunID != runID {
+				t.Fatalf("第 %d 轮（%s）收到了第 %d 轮（%s）的事件", round, runID, e.Round, e.RunID)
+			}
+			switch e.Type {
+			case internal.StreamResult:
+				if e.Done != len(regions)+1 || e.Result.DestIP != "127.0.0.1" || e.Result.Sent != 1 || e.Result.Recv != 1 {
+					t.Fatalf("结果不符: %+v %+v", e, e.Result)
+				}
+				regions[e.Result.Region] = true
+			case internal.StreamProgress:
+				progress = e
+			case internal.StreamRoundEnd:
+				if !regions["北京"] || !regions["天津"] {
+					t.Errorf("结果应包含两个地区，实际为 %v", regions)
+				}
+				// 完成时一定推送一次进度
+				if progress == nil || progress.Done != 2 {
+					t.Errorf("完成时应推送进度，实际为 %+v", progress)
+				}
+				if e.Snapshot == nil || len(e.Snapshot.Rows) != 2 {
+					t.Errorf("round_end 应带有本轮的汇总结果，实际为 %+v", e.Snapshot)
+				}
+				return
+			default:
+				t.Fatalf("未知的事件 %+v", e)
+			}
+		}
+	}
+	checkRound(1, runID)
+
+	// 已连接时下一轮的事件实时推送，每轮的运行 ID 不同
+	if second := run(); second == runID {
+		t.Errorf("两轮的运行 ID 应不同，都为 %s", runID)
+	} else {
+		checkRound(2, second)
+	}
+}
+
+func TestTargetHistoryAPI(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	now := time.Now()
+	// 第 1 轮在窗口之外；第 3 轮 1.1.1.1 全部丢包，不在结果中
+	for i, at := range []time.Time{now.Add(-3 * time.Hour), now.Add(-40 * time.Minute), now.Add(-20 * time.Minute), now.Add(-time.Minute)} {
+		snap := &internal.Snapshot{SchemaVersion: internal.SchemaVersion, CreatedAt: at, Count: 10, Rows: []*internal.SnapshotRow{
+			{DestIP: "2.2.2.2", Region: "上海", Isp: "联通", Sent: 10, Recv: 10, AvgRttMs: 30},
+		}}
+		if i != 2 {
+			snap.Rows = append(snap.Rows, &internal.SnapshotRow{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", Sent: 10, Recv: 9, LossPercent: 10, AvgRttMs: float64(10 * (i + 1))})
+		}
+		if err := internal.AppendHistory(path, snap); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stream, err := internal.StartStream("127.0.0.1:0", internal.HTTPAuth{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	stream.ServeHistory(path)
+	get := func(target string) (int, *internal.TargetHistory) {
+		resp, err := http.Get("http://" + stream.Addr().String() + "/api/v1/targets/" + target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		history := &internal.TargetHistory{}
+		json.NewDecoder(resp.Body).Decode(history)
+		return resp.StatusCode, history
+	}
+
+	code, history := get("1.1.1.1/history")
+	if code != http.StatusOK || len(history.Series) != 1 {
+		t.Fatalf("应返回 1.1.1.1 的一条序列: %d %+v", code, history)
+	}
+	series := history.Series[0]
+	var rtts, losses []float64
+	for _, p := range series.Points {
+		rtts, losses = append(rtts, p.AvgRttMs), append(losses, p.LossPercent)
+	}
+	if series.Region != "北京" || series.Isp != "电信" || !slices.Equal(rtts, []float64{20, 0, 40}) || !slices.Equal(losses, []float64{10, 100, 10}) {
+		t.Errorf("默认窗口 1h 内的结果不对: %+v rtt=%v loss=%v", series, rtts, losses)
+	}
+	if _, history := get("1.1.1.1/history?window=4h"); len(history.Series) != 1 || len(history.Series[0].Points) != 4 {
+		t.Errorf("window=4h 应包含全部 4 轮: %+v", history)
+	}
+	if code, _ := get("3.3.3.3/history"); code != http.StatusNotFound {
+		t.Errorf("没有结果的目标应返回 404，实际 %d", code)
+	}
+	for _, bad := range []string{"abc/history", "1.1.1.1/history?window=-1h", "1.1.1.1/history?window=1年"} {
+		if code, _ := get(bad); code != http.StatusBadRequest {
+			t.Errorf("%s 应返回 400，实际 %d", bad, code)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+)
+
+// TargetLabel 目标IP在配置中所属的地区和运营商，以及目标文件中填写的自定义标签（如 dc=bj1），可用于 -group-by 分组
+type TargetLabel struct {
+	Region string
+	Isp    string
+	Tags   map[string]string
+	Weight float64 // 配置或目标文件中指定的权重，0 为未指定
+}
+
+// targetWeight 汇总时使用的权重，未指定时为 1
+func targetWeight(w float64) float64 {
+	if w <= 0 {
+		return 1
+	}
+	return w
+}
+
+// TargetProbe 目标文件中为单个目标指定的探测方式、端口和发包数，零值表示沿用命令行参数
+type TargetProbe struct {
+	Proto string
+	Port  int
+	Count int
+}
+
+// Target 去重后的探测目标，同一IP出现在多个地区/运营商下时只探测一次；
+// 同一IP以不同的探测方式、端口或发包数出现时各为一个目标
+type Target struct {
+	IP     string
+	Labels []TargetLabel
+	Probe  TargetProbe
+}
+
+// targetSet 按IP（及单独指定的探测参数）去重并保持加入顺序的目标集合
+type targetSet struct {
+	index   map[string]*Target
+	targets []*Target
+}
+
+func newTargetSet() *targetSet {
+	return &targetSet{index: make(map[string]*Target)}
+}
+
+// add 加入一个使用命令行探测参数的目标，IP已存在时只追加标签（地区和运营商相同的标签不重复追加，自定义标签合并，后指定的权重生效）
+func (s *targetSet) add(ip string, label TargetLabel) {
+	s.addProbe(ip, label, TargetProbe{})
+}
+
+// addProbe 加入一个单独指定了探测参数的目标
+func (s *targetSet) addProbe(ip string, label TargetLabel, probe TargetProbe) {
+	key := ip
+	if probe != (TargetProbe{}) {
+		key = fmt.Sprintf("%s|%s|%d|%d", ip, probe.Proto, probe.Port, probe.Count)
+	}
+	if t, ok := s.index[key]; ok {
+		for i, l := range t.Labels {
+			if l.Region == label.Region && l.Isp == label.Isp {
+				if len(label.Tags) > 0 {
+					// 标签可能与其他目标共用（同一域名解析出的多个IP），合并时复制
+					merged := maps.Clone(l.Tags)
+					if merged == nil {
+						merged = make(map[string]string)
+					}
+					maps.Copy(merged, label.Tags)
+					t.Labels[i].Tags = merged
+				}
+				if label.Weight > 0 {
+					t.Labels[i].Weight = label.Weight
+				}
+				return
+			}
+		}
+		t.Labels = append(t.Labels, label)
+		return
+	}
+	t := &Target{IP: ip, Labels: []TargetLabel{label}, Probe: probe}
+	s.index[key] = t
+	s.targets = append(s.targets, t)
+}
+
+// ispRegions 返回运营商名称到其地区配置的映射
+func ispRegions(dns *DNSConfig) map[string]map[string]ProvinceConfig {
+	return map[string]map[string]ProvinceConfig{
+		"电信": dns.Dx,
+		"联通": dns.Lt,
+		"移动": dns.Yd,
+	}
+}
+
+// buildTargets 根据运营商和区域参数生成去重后的探测目标列表
+func buildTargets(dns *DNSConfig, isp string, region string) []*Target {
+	set := newTargetSet()
+	all := ispRegions(dns)
+
+	targetIsps := []string{isp}
+	if isp == "all" {
+		targetIsps = []string{"电信", "联通", "移动"}
+	}
+
+	for _, ispName := range targetIsps {
+		regions := all[ispName]
+		if region != "全国" {
+			regionData, ok := regions[region]
+			if !ok || len(regionData.IPv4) == 0 {
+				log.Printf("⚠️ 区域 %s 下运营商 %s 无 IP", region, ispName)
+				continue
+			}
+			for _, ip := range regionData.IPv4 {
+				set.add(ip, TargetLabel{Region: region, Isp: ispName, Weight: regionData.Weights[ip]})
+			}
+			continue
+		}
+		for regionName, regionData := range regions {
+			for _, ip := range regionData.IPv4 {
+				set.add(ip, TargetLabel{Region: regionName, Isp: ispName, Weight: regionData.Weights[ip]})
+			}
+		}
+	}
+	return set.targets
+}
+
+// priorityTiers 将目标分为优先目标（地区、运营商或IP在 names 中）和其余目标两批，各批保持原有顺序；
+// 没有指定或只有一批时返回全部目标一批。names 中没有匹配任何目标的名称时提示
+func priorityTiers(targets []*Target, names []string) [][]*Target {
+	if len(names) == 0 {
+		return [][]*Target{targets}
+	}
+	matched := make(map[string]bool)
+	var first, rest []*Target
+	for _, t := range targets {
+		hit := false
+		for _, name := range names {
+			match := t.IP == name || slices.ContainsFunc(t.Labels, func(l TargetLabel) bool { return l.Region == name || l.Isp == name })
+			matched[name] = matched[name] || match
+			hit = hit || match
+		}
+		if hit {
+			first = append(first, t)
+		} else {
+			rest = append(rest, t)
+		}
+	}
+	for _, name := range names {
+		if !matched[name] {
+			log.Printf("⚠️  -priority 中的 '%s' 没有匹配的地区、运营商或目标IP\n", name)
+		}
+	}
+	if len(first) == 0 || len(rest) == 0 {
+		return [][]*Target{targets}
+	}
+	return [][]*Target{first, rest}
+}
@@ -0,0 +1,178 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TargetOptions 用户自定义目标：File 非空时不再使用内置的运营商目标，Catalog 非空时以该配置代替内置配置
+type TargetOptions struct {
+	File    string // 目标文件，每行一个 IP 或域名，可选跟地区和运营商
+	Whois   bool   // 通过 WHOIS 补全目标文件中缺少的地区/运营商
+	Catalog string // 与内置配置格式相同的目标配置文件，如 dping import 的输出
+	Overlay string // 覆盖文件，在内置配置（或 Catalog）上增删地址和地区
+	Local   bool   // 同时探测自动发现的默认网关、DNS 服务器和上游第一跳，汇总为"本地链路"一组
+
+	// Concurrency 按运营商或地区单独限制的并发数（-C 电信=30），未列出的目标只受总并发数限制
+	Concurrency map[string]int
+	// Priority 逗号分隔的地区、运营商或目标IP（如本省的解析服务器所在地区），匹配的目标先于其余目标探测并先输出结果
+	Priority string
+}
+
+// priorityNames 拆分 Priority，未指定时为 nil
+func (o TargetOptions) priorityNames() []string {
+	var names []string
+	for _, name := range strings.Split(o.Priority, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// validate 校验目标参数与运营商、区域和探测方式的组合
+func (o TargetOptions) validate(isp string, region string, probe ProbeOptions) error {
+	for _, c := range []struct{ flag, value string }{{"catalog", o.Catalog}, {"overlay", o.Overlay}} {
+		if c.value == "" {
+			continue
+		}
+		if o.File != "" {
+			return fmt.Errorf("-%s 与 -f 不能同时使用", c.flag)
+		}
+		if probe.Proto == "ntp" {
+			return fmt.Errorf("NTP 探测使用内置的服务器分组，不能与 -%s 同时使用", c.flag)
+		}
+	}
+	if o.File == "" {
+		if o.Whois {
+			return fmt.Errorf("-whois 只对 -f 目标文件中缺少地区/运营商的目标生效，请同时指定 -f")
+		}
+		return nil
+	}
+	if isp != "all" || region != "全国" {
+		return fmt.Errorf("-f 指定目标文件时不能同时使用 -isp 或 -dt")
+	}
+	if probe.Proto == "ntp" {
+		return fmt.Errorf("NTP 探测使用内置的服务器分组，不能与 -f 同时使用")
+	}
+	return nil
+}
+
+// loadTargetFile 读取目标文件：每行为 "IP或域名 [地区 [运营商]] [proto=… port=… count=…] [weight=…] [标签=值…]"，# 开头为注释；
+// IP 可以是 IPv4 或 IPv6 地址，域名解析出的每个 IPv4 地址都作为目标，未填写的地区和运营商为空，未填写的探测参数沿用命令行参数，
+// weight 为目标在汇总中的权重（默认 1），其他 key=value 为自定义标签
+func loadTargetFile(path string) ([]*Target, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取目标文件 %s 失败: %v", path, err)
+	}
+	defer f.Close()
+
+	set := newTargetSet()
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var fields []string
+		var probe TargetProbe
+		var tags map[string]string
+		var weight float64
+		for _, field := range strings.Fields(line) {
+			key, value, ok := strings.Cut(field, "=")
+			switch {
+			case !ok:
+				fields = append(fields, field)
+			case key == "proto" || key == "port" || key == "count":
+				if err := probe.set(key, value); err != nil {
+					return nil, fmt.Errorf("目标文件 %s 第 %d 行：%v", path, lineNo, err)
+				}
+			case key == "weight":
+				w, err := strconv.ParseFloat(value, 64)
+				if err != nil || !(w > 0) || math.IsInf(w, 0) {
+					return nil, fmt.Errorf("目标文件 %s 第 %d 行：权重 weight=%s 必须是大于 0 的数", path, lineNo, value)
+				}
+				weight = w
+			case !tagName.MatchString(key):
+				return nil, fmt.Errorf("目标文件 %s 第 %d 行：标签名 '%s' 无效，只能由字母、数字和下划线组成且不以数字开头", path, lineNo, key)
+			default:
+				if tags == nil {
+					tags = make(map[string]string)
+				}
+				tags[key] = value
+			}
+		}
+		if len(fields) == 0 || len(fields) > 3 {
+			return nil, fmt.Errorf("目标文件 %s 第 %d 行格式错误，应为 \"IP或域名 [地区 [运营商]] [proto=… port=… count=…] [weight=…] [标签=值…]\"", path, lineNo)
+		}
+		label := TargetLabel{Tags: tags, Weight: weight}
+		if len(fields) > 1 {
+			label.Region = fields[1]
+		}
+		if len(fields) > 2 {
+			label.Isp = fields[2]
+		}
+
+		host := fields[0]
+		if ip := net.ParseIP(host); ip != nil {
+			set.addProbe(ip.String(), label, probe)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+		cancel()
+		if err != nil {
+			log.Printf("⚠️  目标文件第 %d 行：解析 %s 失败: %v\n", lineNo, host, err)
+			continue
+		}
+		for _, ip := range ips {
+			set.addProbe(ip.String(), label, probe)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取目标文件 %s 失败: %v", path, err)
+	}
+	if len(set.targets) == 0 {
+		return nil, fmt.Errorf("目标文件 %s 中没有可探测的目标", path)
+	}
+	return set.targets, nil
+}
+
+// tagName 目标文件中自定义标签名的格式，可在 -group-by 模板中以 {{.Tags.标签名}} 引用
+var tagName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// set 设置目标文件中的一项探测参数；端口能否用于该探测方式在与命令行参数合并后校验
+func (p *TargetProbe) set(key, value string) error {
+	switch key {
+	case "proto":
+		switch value {
+		case "icmp", "icmp-ts", "dns", "tcp", "http", "https":
+		default:
+			return fmt.Errorf("不支持的探测方式 proto=%s，可选 icmp|icmp-ts|dns|tcp|http|https", value)
+		}
+		p.Proto = value
+	case "port":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > 65535 {
+			return fmt.Errorf("端口 port=%s 必须在 1 到 65535 之间", value)
+		}
+		p.Port = n
+	case "count":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("发包数 count=%s 必须大于 0", value)
+		}
+		p.Count = n
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package internal_test
+
+import (
+	"context"
+	"dping/internal"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+func TestTCPSocketExhaustedRetry(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if err == nil {
+				conn.Close()
+			}
+		}
+	}()
+
+	// 把文件描述符上限压到当前最小的空闲描述符，建连时必然 EMFILE；200ms 后恢复，早于第一次重试前的退避
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		t.Fatal(err)
+	}
+	restore := func() { syscall.Setrlimit(syscall.RLIMIT_NOFILE, &limit) }
+	defer restore()
+	low := limit
+	low.Cur = lowestFreeFD(t)
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &low); err != nil {
+		t.Skipf("无法降低文件描述符上限: %v", err)
+	}
+	time.AfterFunc(200*time.Millisecond, restore)
+
+	result, err := internal.DPing(internal.Options{Isp: "电信", Region: internal.TestsetRegion, MaxConcurrency: 1, Count: 1,
+		Probe:  internal.ProbeOptions{Proto: "tcp", Port: ln.Addr().(*net.TCPAddr).Port},
+		Output: internal.OutputOptions{Format: "json", NoPager: true, Quiet: true}})
+	restore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap := result.Snapshot
+	// 套接字耗尽时若计为丢包，目标会全部丢包而不在 rows 中
+	if len(snap.Rows) != 2 || len(snap.Unanswered) != 0 {
+		t.Fatalf("套接字耗尽后应降低并发重试成功，实际 %d 行有结果，%d 行全部丢包", len(snap.Rows), len(snap.Unanswered))
+	}
+	for _, row := range snap.Rows {
+		if row.Recv != 1 || row.Error != "" {
+			t.Errorf("重试后应收到应答: %+v", row)
+		}
+	}
+}
+
+// lowestFreeFD 当前进程最小的未使用的文件描述符：dup 总是返回最小的空闲描述符
+func lowestFreeFD(t *testing.T) uint64 {
+	fd, err := syscall.Dup(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syscall.Close(fd)
+	return uint64(fd)
+}
+
+// failingProber 前 fails 次探测返回 err，之后成功
+type failingProber struct {
+	err   error
+	fails int
+	calls int
+}
+
+func (p *failingProber) Probe(to net.IP, _ net.IP, count int, _ internal.AdaptiveOptions) (*ping.Statistics, error) {
+	p.calls++
+	if p.calls <= p.fails {
+		return nil, p.err
+	}
+	return &ping.Statistics{PacketsSent: count, PacketsRecv: count}, nil
+}
+
+func TestProbeWithRetry(t *testing.T) {
+	dialErr := func(errno syscall.Errno) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: errno}}
+	}
+	// 源地址不存在时立即失败，不降低并发、不退避
+	missing := &failingProber{err: dialErr(syscall.EADDRNOTAVAIL), fails: 10}
+	start := time.Now()
+	retries, err := internal.ProbeWithRetry(missing, 8)
+	if !errors.Is(err, syscall.EADDRNOTAVAIL) || missing.calls != 1 || retries != 0 {
+		t.Errorf("源地址不存在时应只探测 1 次且不重试，实际探测 %d 次、重试 %d 次，%v", missing.calls, retries, err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("源地址不存在时应立即失败，实际用时 %s", elapsed)
+	}
+
+	// 文件描述符耗尽时退避后重试
+	exhausted := &failingProber{err: dialErr(syscall.EMFILE), fails: 1}
+	if retries, err := internal.ProbeWithRetry(exhausted, 8); err != nil || exhausted.calls != 2 || retries != 1 {
+		t.Errorf("文件描述符耗尽时应重试 1 次后成功，实际探测 %d 次、重试 %d 次，%v", exhausted.calls, retries, err)
+	}
+}
+
+// blackholeListener 返回 127.0.0.1 上积压队列为 0 的监听端口：第一个连接占满队列后，Linux 丢弃之后的 SYN，
+// 建连无任何回应直到超时，与被过滤的目标相同
+func blackholeListener(t *testing.T) int {
+	t.Helper()
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { syscall.Close(fd) })
+	if err := syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Listen(fd, 0); err != nil {
+		t.Fatal(err)
+	}
+	sa, err := syscall.Getsockname(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := sa.(*syscall.SockaddrInet4).Port
+	conn, err := net.DialTimeout("tcp4", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return port
+}
+
+func TestTCPOutcomes(t *testing.T) {
+	// 端口未监听：对端回 RST，计为拒绝，同时算作收到回应
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	stats, outcomes, err := internal.ProbeTCP(closed, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outcomes == nil || *outcomes != (internal.TCPOutcomes{Refused: 2}) {
+		t.Errorf("未监听的端口应计为 2 次拒绝，实际为 %+v", outcomes)
+	}
+	if stats.PacketsRecv != 2 || stats.PacketLoss != 0 {
+		t.Errorf("被拒绝的建连不算丢包，实际收到 %d 个，丢包率 %.0f%%", stats.PacketsRecv, stats.PacketLoss)
+	}
+
+	if runtime.GOOS != "linux" {
+		t.Log("积压队列满时丢弃 SYN 只在 Linux 上可靠，跳过超时的检查")
+	} else {
+		// SYN 被丢弃：无任何回应直到超时，计为超时和丢包
+		stats, outcomes, err = internal.ProbeTCP(blackholeListener(t), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if outcomes == nil || *outcomes != (internal.TCPOutcomes{Timeout: 1}) {
+			t.Errorf("没有回应的建连应计为 1 次超时，实际为 %+v", outcomes)
+		}
+		if stats.PacketsRecv != 0 || stats.PacketLoss != 100 {
+			t.Errorf("超时的建连应算作丢包，实际收到 %d 个，丢包率 %.0f%%", stats.PacketsRecv, stats.PacketLoss)
+		}
+	}
+
+	// 其余分类按错误类型和代理返回的错误信息区分
+	var o internal.TCPOutcomes
+	for _, err := range []error{
+		nil,
+		&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)},
+		errors.New("socks connect tcp 127.0.0.1:1080->1.1.1.1:80: unknown error connection refused"),
+		&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)},
+		io.EOF,
+		context.DeadlineExceeded,
+		&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ETIMEDOUT)},
+		errors.New("socks connect tcp 127.0.0.1:1080->1.1.1.1:80: unknown error TTL expired"),
+		&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.EHOSTUNREACH)},
+		&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ENETUNREACH)},
+		errors.New("socks connect tcp 127.0.0.1:1080->1.1.1.1:80: unknown error host unreachable"),
+		errors.New("proxy: SOCKS5 proxy at 127.0.0.1:1080 requires authentication"),
+	} {
+		internal.RecordTCPOutcome(&o, err)
+	}
+	if want := (internal.TCPOutcomes{Connected: 1, Refused: 2, Reset: 2, Timeout: 3, Unreachable: 3, Other: 1}); o != want {
+		t.Errorf("分类计数应为 %+v，实际为 %+v", want, o)
+	}
+}
@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	blockedSendThreshold = time.Millisecond      // 发送结果等待超过该时长视为通道阻塞
+	overloadSchedDelay   = 10 * time.Millisecond // 启动延迟 p95 超过该值时提示探测主机过载
+)
+
+// Telemetry 探测主机自身的开销，用于判断结果偏差来自网络还是过载的探测主机，时间以毫秒表示
+type Telemetry struct {
+	Scheduled          int     `json:"scheduled"`                     // 计划的探测数（目标 × 源 × 探测方式）
+	Probes             int     `json:"probes"`                        // 启动的探测数
+	Completed          int     `json:"completed"`                     // 返回了统计结果的探测数
+	Unanswered         int     `json:"unanswered"`                    // 返回了结果但全部丢包、未计入表格的探测数
+	QueueWaitP95Ms     float64 `json:"queue_wait_p95_ms"`             // 等待并发名额（-C）的时长，属于正常排队
+	QueueWaitMaxMs     float64 `json:"queue_wait_max_ms"`             // 等待并发名额的最长时长
+	SchedDelayP50Ms    float64 `json:"sched_delay_p50_ms"`            // 计划启动时刻（含 -jitter 偏移）到实际开始探测的延迟
+	SchedDelayP95Ms    float64 `json:"sched_delay_p95_ms"`            // 超过 10ms 时提示探测主机过载
+	SchedDelayMaxMs    float64 `json:"sched_delay_max_ms"`            // 最大启动延迟
+	BlockedSends       int     `json:"blocked_sends"`                 // 发送结果时等待超过 1ms 的次数，说明汇总跟不上
+	BlockedTotalMs     float64 `json:"blocked_total_ms"`              // 阻塞发送的累计等待时长
+	BlockedMaxMs       float64 `json:"blocked_max_ms"`                // 单次发送的最长等待
+	Failed             int     `json:"failed"`                        // 探测出错或异常的次数，这些目标的结果仍在表格中并带有出错原因
+	SocketRetries      int     `json:"socket_retries"`                // 套接字资源耗尽后退避重试的次数
+	ReducedConcurrency int     `json:"reduced_concurrency,omitempty"` // 套接字资源耗尽后降低到的并发数，未降低时省略
+	SpillPeak          int     `json:"spill_peak,omitempty"`          // -result-spill 时内存队列中最多暂存的结果数，未使用时省略
+}
+
+// telemetryRecorder 探测过程中收集开销数据，nil 时不记录
+type telemetryRecorder struct {
+	mu           sync.Mutex
+	queueWaits   []time.Duration
+	schedDelays  []time.Duration
+	blockedSends int
+	blockedTotal time.Duration
+	blockedMax   time.Duration
+	failed       int // 出错或异常的探测数
+	scheduled    int
+	completed    int
+	unanswered   int
+	spillPeak    int
+}
+
+// schedule 记录计划的探测数，在启动探测之前调用
+func (r *telemetryRecorder) schedule(n int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scheduled += n
+}
+
+// started 记录一次探测的排队时长和启动延迟
+func (r *telemetryRecorder) started(queueWait time.Duration, schedDelay time.Duration) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queueWaits = append(r.queueWaits, queueWait)
+	r.schedDelays = append(r.schedDelays, max(schedDelay, 0))
+}
+
+// sent 记录一次结果发送的等待时长
+func (r *telemetryRecorder) sent(wait time.Duration) {
+	if r == nil || wait < blockedSendThreshold {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.blockedSends++
+	r.blockedTotal += wait
+	r.blockedMax = max(r.blockedMax, wait)
+}
+
+// queued 记录内存队列当前暂存的结果数
+func (r *telemetryRecorder) queued(n int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spillPeak = max(r.spillPeak, n)
+}
+
+// finished 记录一次返回了结果的探测，lost 为全部丢包
+func (r *telemetryRecorder) finished(lost bool) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.completed++
+	if lost {
+		r.unanswered++
+	}
+}
+
+// fail 记录一次出错或异常的探测，其结果带有出错原因
+func (r *telemetryRecorder) fail() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed++
+}
+
+// result 汇总收集到的数据
+func (r *telemetryRecorder) result() *Telemetry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	queue := slices.Clone(r.queueWaits)
+	sched := slices.Clone(r.schedDelays)
+	slices.Sort(queue)
+	slices.Sort(sched)
+	return &Telemetry{
+		Scheduled:       r.scheduled,
+		Probes:          len(sched),
+		Completed:       r.completed,
+		Unanswered:      r.unanswered,
+		QueueWaitP95Ms:  durationToMs(percentileOf(queue, 0.95)),
+		QueueWaitMaxMs:  durationToMs(percentileOf(queue, 1)),
+		SchedDelayP50Ms: durationToMs(percentileOf(sched, 0.5)),
+		SchedDelayP95Ms: durationToMs(percentileOf(sched, 0.95)),
+		SchedDelayMaxMs: durationToMs(percentileOf(sched, 1)),
+		BlockedSends:    r.blockedSends,
+		BlockedTotalMs:  durationToMs(r.blockedTotal),
+		BlockedMaxMs:    durationToMs(r.blockedMax),
+		Failed:          r.failed,
+		SpillPeak:       r.spillPeak,
+	}
+}
+
+// percentileOf 返回已排序数据的 p 分位数（最近秩法），没有数据时为 0
+func percentileOf(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p+0.5) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+// Skipped 计划了但既没有结果也没有出错的探测数，正常为 0
+func (t *Telemetry) Skipped() int {
+	return max(t.Scheduled-t.Completed-t.Failed, 0)
+}
+
+// reportTelemetry 在标准错误输出自检结果和探测数核对，启动延迟过大或通道阻塞时提示结果可能受探测主机影响，有出错时提示查看原因
+func reportTelemetry(t *Telemetry) {
+	fmt.Fprintf(os.Stderr, "✅ 探测自检：%d 次探测，启动延迟 p50 %.1fms/p95 %.1fms/最大 %.1fms，排队 p95 %.1fms，结果通道阻塞 %d 次\n",
+		t.Probes, t.SchedDelayP50Ms, t.SchedDelayP95Ms, t.SchedDelayMaxMs, t.QueueWaitP95Ms, t.BlockedSends)
+	if msToDuration(t.SchedDelayP95Ms) > overloadSchedDelay {
+		log.Printf("⚠️  探测启动延迟 p95 为 %.1fms，探测主机可能过载，时延结果可能偏大，可降低 -C 或减少其他负载\n", t.SchedDelayP95Ms)
+	}
+	if t.SocketRetries > 0 {
+		msg := fmt.Sprintf("系统套接字资源不足，%d 次探测退避后重试", t.SocketRetries)
+		if t.ReducedConcurrency > 0 {
+			msg += fmt.Sprintf("，并发数已降到 %d，可调大 ulimit -n 或降低 -C", t.ReducedConcurrency)
+		}
+		log.Printf("⚠️  %s\n", msg)
+	}
+	if t.BlockedSends > 0 {
+		log.Printf("⚠️  结果汇总跟不上探测速度，共阻塞 %.1fms（最长 %.1fms），可用 -result-buffer 调大缓冲区或 -result-spill 暂存到内存队列\n", t.BlockedTotalMs, t.BlockedMaxMs)
+	}
+	// 核对计划与实际的探测数，出错和全部丢包的探测不在表格中，避免结果悄悄缺失
+	fmt.Fprintf(os.Stderr, "✅ 探测核对：计划 %d 次，有结果 %d 次（其中全部丢包 %d 次未计入表格），出错 %d 次，未执行 %d 次\n",
+		t.Scheduled, t.Completed, t.Unanswered, t.Failed, t.Skipped())
+	if t.Failed > 0 {
+		log.Printf("⚠️  %d 次探测出错，原因见结果中的错误列\n", t.Failed)
+	}
+	if t.Skipped() > 0 {
+		log.Printf("⚠️  %d 次探测没有执行完成，未计入统计\n", t.Skipped())
+	}
+}
@@ -0,0 +1,75 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"testing"
+	"time"
+)
+
+func TestPercentileOf(t *testing.T) {
+	ms := func(v ...int) []time.Duration {
+		var list []time.Duration
+		for _, n := range v {
+			list = append(list, time.Duration(n)*time.Millisecond)
+		}
+		return list
+	}
+	ten := ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+	for _, c := range []struct {
+		name   string
+		sorted []time.Duration
+		p      float64
+		want   time.Duration
+	}{
+		{"没有数据", nil, 0.95, 0},
+		{"只有一个", ms(7), 0.5, 7 * time.Millisecond},
+		{"中位数", ten, 0.5, 5 * time.Millisecond},
+		{"p95 取第 10 个", ten, 0.95, 10 * time.Millisecond},
+		{"p90", ten, 0.9, 9 * time.Millisecond},
+		{"最大值", ten, 1, 10 * time.Millisecond},
+		{"p0 取最小值", ten, 0, 1 * time.Millisecond},
+	} {
+		if got := internal.PercentileOf(c.sorted, c.p); got != c.want {
+			t.Errorf("%s: p%g 应为 %s，实际为 %s", c.name, c.p*100, c.want, got)
+		}
+	}
+}
+
+func TestTelemetryRecorder(t *testing.T) {
+	r := &internal.TelemetryRecorder{}
+	r.Schedule(4)
+	r.Schedule(2)
+	// 5 次启动：排队 0~40ms，启动延迟 1~5ms，负的启动延迟按 0 计
+	for i := range 5 {
+		r.Started(time.Duration(i)*10*time.Millisecond, time.Duration(i+1)*time.Millisecond)
+	}
+	r.Started(0, -time.Millisecond)
+	// 不到 1ms 的等待不算阻塞
+	r.Sent(500 * time.Microsecond)
+	r.Sent(2 * time.Millisecond)
+	r.Sent(5 * time.Millisecond)
+	r.Queued(3)
+	r.Queued(1)
+	r.Finished(false)
+	r.Finished(true)
+	r.Finished(false)
+	r.Fail()
+
+	tm := r.Result()
+	if tm.Scheduled != 6 || tm.Probes != 6 || tm.Completed != 3 || tm.Unanswered != 1 || tm.Failed != 1 {
+		t.Errorf("探测数不符: %+v", tm)
+	}
+	if tm.SchedDelayP50Ms != 2 || tm.SchedDelayMaxMs != 5 || tm.QueueWaitMaxMs != 40 {
+		t.Errorf("启动延迟或排队时长不符: %+v", tm)
+	}
+	if tm.BlockedSends != 2 || tm.BlockedTotalMs != 7 || tm.BlockedMaxMs != 5 || tm.SpillPeak != 3 {
+		t.Errorf("阻塞发送或暂存峰值不符: %+v", tm)
+	}
+	// 6 次计划中 3 次有结果、1 次出错，2 次未执行
+	if tm.Skipped() != 2 {
+		t.Errorf("未执行的探测应为 2 次，实际为 %d", tm.Skipped())
+	}
+	if skipped := (&internal.Telemetry{Scheduled: 1, Completed: 1, Failed: 1}).Skipped(); skipped != 0 {
+		t.Errorf("结果多于计划时未执行数应为 0，实际为 %d", skipped)
+	}
+}
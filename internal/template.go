@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateData 运行级模板的数据
+type TemplateData struct {
+	CreatedAt time.Time
+	RunID     string
+	Host      string
+	Source    string
+	Isp       string
+	Region    string
+	Count     int
+	Note      string
+	Rows      []*SummaryStatistic
+	Totals    *ReportTotals // 汇总表和丢包表的总计及按运营商的小计，如 {{.Totals.Summary.Total.LossPercent}}
+}
+
+// templateFuncs 模板中可用的辅助函数
+var templateFuncs = template.FuncMap{
+	// ms 将时长格式化为毫秒数，如 {{ms .AvgRtt}} 输出 27.7
+	"ms": func(d time.Duration) string {
+		return fmt.Sprintf("%.1f", float64(d)/float64(time.Millisecond))
+	},
+}
+
+// templateOutput 按用户模板输出结果：每行汇总数据执行一次行模板，最后执行一次运行级模板
+type templateOutput struct {
+	row *template.Template
+	run *template.Template
+}
+
+// parseTemplateOutput 解析行模板和运行级模板，两者至少提供一个
+func parseTemplateOutput(rowText, runText string) (*templateOutput, error) {
+	if rowText == "" && runText == "" {
+		return nil, fmt.Errorf("-format template 需要通过 -template 或 -run-template 指定模板")
+	}
+	out := &templateOutput{}
+	var err error
+	if rowText != "" {
+		if out.row, err = template.New("row").Funcs(templateFuncs).Parse(withNewline(rowText)); err != nil {
+			return nil, fmt.Errorf("解析 -template 失败: %v", err)
+		}
+	}
+	if runText != "" {
+		if out.run, err = template.New("run").Funcs(templateFuncs).Parse(withNewline(runText)); err != nil {
+			return nil, fmt.Errorf("解析 -run-template 失败: %v", err)
+		}
+	}
+	return out, nil
+}
+
+// withNewline 保证模板以换行结尾，使每行结果独占一行
+func withNewline(text string) string {
+	if strings.HasSuffix(text, "\n") {
+		return text
+	}
+	return text + "\n"
+}
+
+// execute 依次输出每行结果和运行级模板
+func (t *templateOutput) execute(w io.Writer, data *TemplateData) error {
+	if t.row != nil {
+		for _, row := range data.Rows {
+			if err := t.row.Execute(w, row); err != nil {
+				return fmt.Errorf("执行 -template 失败: %v", err)
+			}
+		}
+	}
+	if t.run != nil {
+		if err := t.run.Execute(w, data); err != nil {
+			return fmt.Errorf("执行 -run-template 失败: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package internal_test
+
+import (
+	"bytes"
+	"dping/internal"
+	"strings"
+	"testing"
+	"time"
+)
+
+func templateResult() *internal.RunResult {
+	return &internal.RunResult{
+		Snapshot: &internal.Snapshot{Host: "probe-1", Count: 10},
+		Rows: []*internal.SummaryStatistic{
+			{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", TotalSent: 10, TotalRecv: 10, AvgRtt: 27660 * time.Microsecond},
+			{DestIP: "2.2.2.2", Region: "上海", Isp: "联通", TotalSent: 10, TotalRecv: 5, PacketLoss: 50, AvgRtt: 31 * time.Millisecond},
+		},
+	}
+}
+
+func TestTemplateOutput(t *testing.T) {
+	renderer, err := internal.NewRenderer(internal.OutputOptions{Format: "template",
+		Template:    "{{.DestIP}} {{.Isp}} {{ms .AvgRtt}}",
+		RunTemplate: "{{.Host}} {{len .Rows}} 个目标"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := renderer.Render(&out, templateResult()); err != nil {
+		t.Fatal(err)
+	}
+	// 每行结果独占一行，运行级模板在最后
+	if want := "1.1.1.1 电信 27.7\n2.2.2.2 联通 31.0\nprobe-1 2 个目标\n"; out.String() != want {
+		t.Errorf("输出应为 %q，实际为 %q", want, out.String())
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	// 模板缺失或语法错误在探测开始前报错
+	for _, c := range []struct {
+		row, run, want string
+	}{
+		{"", "", "需要通过 -template 或 -run-template 指定模板"},
+		{"{{.DestIP", "", "解析 -template 失败"},
+		{"", "{{range .Rows}}", "解析 -run-template 失败"},
+		{"{{nosuchfunc .DestIP}}", "", "解析 -template 失败"},
+	} {
+		_, err := internal.NewRenderer(internal.OutputOptions{Format: "template", Template: c.row, RunTemplate: c.run})
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("模板 %q/%q: 错误应包含 %q，实际为 %v", c.row, c.run, c.want, err)
+		}
+	}
+
+	// 字段不存在、函数参数类型不符等只在执行时发现，输出时返回错误
+	for _, c := range []struct {
+		row, run, want string
+	}{
+		{"{{.Nope}}", "", "执行 -template 失败"},
+		{"{{ms .DestIP}}", "", "执行 -template 失败"},
+		{"{{.DestIP}}", "{{.Totals.Nope}}", "执行 -run-template 失败"},
+		{"", "{{index .Rows 5}}", "执行 -run-template 失败"},
+	} {
+		renderer, err := internal.NewRenderer(internal.OutputOptions{Format: "template", Template: c.row, RunTemplate: c.run})
+		if err != nil {
+			t.Fatalf("模板 %q/%q 应能解析: %v", c.row, c.run, err)
+		}
+		var out bytes.Buffer
+		err = renderer.Render(&out, templateResult())
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("模板 %q/%q: 错误应包含 %q，实际为 %v", c.row, c.run, c.want, err)
+		}
+	}
+}
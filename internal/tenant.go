@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultTenantWatch 租户未指定 watch 时的探测间隔
+const defaultTenantWatch = time.Minute
+
+// TenantFile 多租户配置文件（YAML）：一个进程内为多个团队各自持续探测，目标、结果去向、告警和接口令牌互相隔离
+type TenantFile struct {
+	Listen   string    `yaml:"listen"`    // 非空时在该地址为各租户提供 /tenants/<名称>/ws 和目标历史接口，以各自的 token 认证
+	TLSCert  string    `yaml:"tls-cert"`  // 租户接口的服务端证书（PEM），与 tls-key 同时指定时改为 HTTPS，令牌不再明文传输
+	TLSKey   string    `yaml:"tls-key"`   // 租户接口的服务端私钥（PEM）
+	ClientCA string    `yaml:"client-ca"` // 非空时租户接口只接受该 CA 签发的客户端证书（mTLS），在令牌之外再校验
+	Tenants  []*Tenant `yaml:"tenants"`
+}
+
+// auth 租户接口监听使用的 TLS 参数，令牌由各租户的路径分别校验
+func (f *TenantFile) auth() HTTPAuth {
+	return HTTPAuth{TLSCert: f.TLSCert, TLSKey: f.TLSKey, ClientCA: f.ClientCA}
+}
+
+// Tenant 一个租户：探测参数与批量任务相同（name 必填），另有持续探测间隔、探测速率上限、结果去向和告警参数
+type Tenant struct {
+	BatchJob `yaml:",inline"`
+
+	Token string        `yaml:"token"` // 该租户接口的 Authorization: Bearer 令牌，指定 listen 时必填
+	Watch time.Duration `yaml:"watch"` // 两轮探测的间隔，为 0 时为 1m
+	Rate  int           `yaml:"rate"`  // 每秒最多开始的探测数，0 为不限制，避免一个租户的大目标集挤占其他租户
+
+	Out        string `yaml:"out"`          // 每轮结果写入该文件（与 -out 相同）
+	History    string `yaml:"history"`      // 每轮结果追加写入该 JSON Lines 文件（与 -history 相同）
+	Push       string `yaml:"push"`         // 每轮结果推送到这些地址，逗号分隔（与 -push 相同）
+	PushSecret string `yaml:"push-secret"`  // 推送签名的密钥（与 -push-secret 相同）
+	PushRetry  *int   `yaml:"push-retries"` // 推送的重试次数，未填写时为 3
+
+	AlertLoss     float64       `yaml:"alert-loss"`
+	AlertRtt      time.Duration `yaml:"alert-rtt"`
+	AlertFor      time.Duration `yaml:"alert-for"`
+	AlertRenotify time.Duration `yaml:"alert-renotify"`
+	AlertWebhook  string        `yaml:"alert-webhook"` // 该租户的告警通道
+}
+
+// watchOptions 租户的持续探测、告警和推送参数
+func (t *Tenant) watchOptions() WatchOptions {
+	retries := 3
+	if t.PushRetry != nil {
+		retries = *t.PushRetry
+	}
+	return WatchOptions{
+		Interval: t.Watch,
+		History:  t.History,
+		Push:     PushOptions{URLs: t.Push, Secret: t.PushSecret, Retries: retries},
+		Alert: AlertOptions{LossPercent: t.AlertLoss, AvgRtt: t.AlertRtt, For: t.AlertFor, Renotify: t.AlertRenotify,
+			Webhook: t.AlertWebhook},
+	}
+}
+
+// options 租户的运行参数：不在标准输出显示结果，也不与上次运行对比（用户缓存目录中的上次结果各租户共用）
+func (t *Tenant) options() Options {
+	opts := t.BatchJob.options("loss", false)
+	opts.Rate = t.Rate
+	opts.Watch = t.watchOptions()
+	opts.Output = OutputOptions{Quiet: true, OutPath: t.Out, Progress: "off"}
+	return opts
+}
+
+// LoadTenants 读取多租户配置文件，补全默认值并校验全部租户的参数；未知字段视为错误
+func LoadTenants(path string) (*TenantFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取租户配置 %s 失败: %v", path, err)
+	}
+	file := &TenantFile{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(file); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("解析租户配置 %s 失败: %v", path, err)
+	}
+	if len(file.Tenants) == 0 {
+		return nil, fmt.Errorf("租户配置 %s 中没有租户（tenants）", path)
+	}
+	switch {
+	case (file.TLSCert != "" || file.TLSKey != "" || file.ClientCA != "") && file.Listen == "":
+		return nil, fmt.Errorf("租户配置 %s：tls-cert、tls-key 和 client-ca 需要同时指定 listen", path)
+	case (file.TLSCert == "") != (file.TLSKey == ""):
+		return nil, fmt.Errorf("租户配置 %s：tls-cert 和 tls-key 需要同时指定", path)
+	case file.ClientCA != "" && file.TLSCert == "":
+		return nil, fmt.Errorf("租户配置 %s：client-ca 需要同时指定 tls-cert 和 tls-key", path)
+	}
+	names := make(map[string]bool)
+	outputs := make(map[string]string) // 结果文件 → 租户，不同租户写同一个文件会互相覆盖
+	for i, t := range file.Tenants {
+		if t == nil {
+			return nil, fmt.Errorf("租户配置 %s 中第 %d 个租户为空", path, i+1)
+		}
+		if t.Name == "" || strings.ContainsAny(t.Name, "/?#% ") {
+			return nil, fmt.Errorf("租户配置 %s 中第 %d 个租户的 name 为空或含有 / ? # %% 空格，名称用于接口路径", path, i+1)
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("租户配置 %s 中租户名 '%s' 重复", path, t.Name)
+		}
+		names[t.Name] = true
+		portSet := t.Port != 0
+		t.setDefaults(i)
+		if t.Watch == 0 {
+			t.Watch = defaultTenantWatch
+		}
+		if portSet && DefaultPort(t.Proto) == 0 {
+			return nil, fmt.Errorf("租户 %s：port 只在 proto 为 dns、tcp、http 或 https 时生效，多个探测方式时用 tcp:53 的形式指定", t.Name)
+		}
+		if err := ValidateParams(t.Isp, t.Region, t.Concurrency, t.Count, *t.Jitter, t.adaptive(), t.probe(), t.targets(), "loss"); err != nil {
+			return nil, fmt.Errorf("租户 %s：%v", t.Name, err)
+		}
+		if err := ValidateWatch(t.watchOptions()); err != nil {
+			return nil, fmt.Errorf("租户 %s：%v", t.Name, err)
+		}
+		if t.Rate < 0 {
+			return nil, fmt.Errorf("租户 %s：rate 不能为负数，当前为 %d", t.Name, t.Rate)
+		}
+		if file.Listen != "" && t.Token == "" {
+			return nil, fmt.Errorf("租户 %s：指定了 listen 时每个租户都需要 token，否则其结果对其他租户可见", t.Name)
+		}
+		for _, out := range []string{t.Out, t.History} {
+			if out == "" {
+				continue
+			}
+			if other, ok := outputs[out]; ok {
+				return nil, fmt.Errorf("租户 %s 与 %s 的结果文件都是 %s", t.Name, other, out)
+			}
+			outputs[out] = t.Name
+		}
+	}
+	return file, nil
+}
+
+// RunTenants 按多租户配置在一个进程内为每个租户持续探测，直到收到 Ctrl-C 或 SIGTERM 后各租户在本轮结束时退出；
+// 单个租户无法开始探测时记录错误，不影响其他租户
+func RunTenants(path string) error {
+	file, err := LoadTenants(path)
+	if err != nil {
+		return err
+	}
+	streams := make([]*Stream, len(file.Tenants))
+	if file.Listen != "" {
+		ln, scheme, err := file.auth().listenTLS("租户接口", file.Listen)
+		if err != nil {
+			return err
+		}
+		if scheme == "http" && !loopbackListener(ln) {
+			log.Printf("⚠️  租户接口监听在 %s 且未启用 HTTPS，各租户的令牌和结果以明文传输；可在租户配置中指定 tls-cert 和 tls-key\n", ln.Addr())
+		}
+		server := &http.Server{Handler: tenantMux(file.Tenants, streams)}
+		go server.Serve(ln)
+		defer server.Close()
+		wsScheme := "ws"
+		if scheme == "https" {
+			wsScheme = "wss"
+		}
+		fmt.Fprintf(os.Stderr, "✅ 租户接口已启动: %s://%s/tenants/<名称>/ws\n", wsScheme, ln.Addr())
+	}
+
+	fmt.Fprintf(os.Stderr, "✅ 共 %d 个租户\n", len(file.Tenants))
+	var wg sync.WaitGroup
+	for i, t := range file.Tenants {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			opts := t.options()
+			opts.Stream = streams[i]
+			fmt.Fprintf(os.Stderr, "✅ 租户 %s 开始持续探测，间隔 %s\n", t.Name, t.Watch)
+			if _, err := DPing(opts); err != nil {
+				log.Printf("⚠️  租户 %s 失败: %v\n", t.Name, err)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "✅ 租户 %s 已停止\n", t.Name)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// tenantMux 为每个租户创建实时推送（有 history 时同时提供目标历史接口），挂载在 /tenants/<名称>/ 下，以租户的令牌认证
+func tenantMux(tenants []*Tenant, streams []*Stream) *http.ServeMux {
+	mux := http.NewServeMux()
+	for i, t := range tenants {
+		streams[i] = newStream()
+		if t.History != "" {
+			streams[i].mux.Handle("GET /api/v1/targets/{ip}/history", historyHandler(t.History))
+		}
+		prefix := "/tenants/" + t.Name
+		mux.Handle(prefix+"/", http.StripPrefix(prefix, HTTPAuth{Token: t.Token}.wrap(streams[i].mux)))
+	}
+	return mux
+}
@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/go-ping/ping"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// msPerDay ICMP 时间戳为 UTC 零点起的毫秒数，按天回绕
+const msPerDay = 24 * 60 * 60 * 1000
+
+// TimestampStats ICMP 时间戳探测得到的单向时延提示，精度为毫秒，仅供参考：
+// 去程和回程都包含了两端时钟的偏差，偏差按往返对称的假设估算
+type TimestampStats struct {
+	Samples     int           // 带有效时间戳的回包数
+	ClockOffset time.Duration // 目标时钟减本机时钟的估计值
+	Forward     time.Duration // 去程：目标接收时间 - 本机发送时间
+	Return      time.Duration // 回程：本机接收时间 - 目标发送时间
+}
+
+// sampleTracker 在一个目标的多次探测中选出往返时间最短的一次：
+// 与 NTP 相同，排队时延对这一次的偏差估计影响最小
+type sampleTracker struct {
+	best    *TimestampStats
+	bestRtt time.Duration
+	samples int
+}
+
+func (t *sampleTracker) add(sample *TimestampStats, rtt time.Duration) {
+	if sample == nil {
+		return
+	}
+	t.samples++
+	if t.best == nil || rtt < t.bestRtt {
+		t.best, t.bestRtt = sample, rtt
+	}
+}
+
+// details 返回选出的样本，没有有效样本时为 nil
+func (t *sampleTracker) details() *ProbeDetails {
+	if t.best == nil {
+		return nil
+	}
+	t.best.Samples = t.samples
+	return &ProbeDetails{Timestamps: t.best}
+}
+
+// timestampProber 发送 ICMP Timestamp 请求（类型 13），以应答的往返时间作为 RTT，
+// 同时记录目标填写的接收/发送时间戳，不支持时间戳的目标只统计 RTT
+type timestampProber struct {
+	detailResults
+	pace time.Duration
+	ids  *icmpIDs
+	vrf  string
+}
+
+func (p *timestampProber) Probe(to net.IP, sourceIP net.IP, count int, adaptive AdaptiveOptions) (*ping.Statistics, error) {
+	conn, err := listenICMP(to, sourceIP, p.vrf)
+	if err != nil {
+		return nil, fmt.Errorf("Timestamp Start Error: %w", err)
+	}
+	defer conn.Close()
+
+	id := p.ids.take()
+	seq := 0
+	tracker := &sampleTracker{}
+	stats, err := probeLoop(to, count, adaptive, packetInterval(p.pace, adaptive.maxPackets(count)), func() (time.Duration, error) {
+		seq++
+		sample, rtt, err := timestampOnce(conn, to, id, seq)
+		if err != nil {
+			return 0, err
+		}
+		tracker.add(sample, rtt)
+		return rtt, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Timestamp Error: %w", err)
+	}
+	p.set(to, sourceIP, tracker.details())
+	return stats, nil
+}
+
+// timestampOnce 发送一次时间戳请求并等待匹配的应答；应答中的时间戳无效（为 0 或最高位置位表示非标准时间）时 sample 为 nil
+func timestampOnce(conn net.PacketConn, to net.IP, id, seq int) (*TimestampStats, time.Duration, error) {
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint16(data[0:], uint16(id))
+	binary.BigEndian.PutUint16(data[2:], uint16(seq))
+	start := time.Now()
+	binary.BigEndian.PutUint32(data[4:], msSinceMidnight(start))
+	msg := icmp.Message{Type: ipv4.ICMPTypeTimestamp, Body: &icmp.RawBody{Data: data}}
+	wb, err := msg.Marshal(nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := conn.WriteTo(wb, &net.IPAddr{IP: to}); err != nil {
+		return nil, 0, err
+	}
+
+	conn.SetReadDeadline(start.Add(probeTimeout))
+	bufp := packetPool.Get().(*[]byte)
+	defer packetPool.Put(bufp)
+	rb := *bufp
+	for {
+		n, peer, err := conn.ReadFrom(rb)
+		if err != nil {
+			return nil, 0, err
+		}
+		now := time.Now()
+		if addr, ok := peer.(*net.IPAddr); !ok || !addr.IP.Equal(to) {
+			continue
+		}
+		reply, err := icmp.ParseMessage(1, rb[:n])
+		if err != nil || reply.Type != ipv4.ICMPTypeTimestampReply {
+			continue
+		}
+		body, ok := reply.Body.(*icmp.RawBody)
+		if !ok || len(body.Data) < 16 ||
+			binary.BigEndian.Uint16(body.Data[0:]) != uint16(id) || binary.BigEndian.Uint16(body.Data[2:]) != uint16(seq) {
+			continue
+		}
+
+		rtt := now.Sub(start)
+		originate := binary.BigEndian.Uint32(body.Data[4:])
+		receive := binary.BigEndian.Uint32(body.Data[8:])
+		transmit := binary.BigEndian.Uint32(body.Data[12:])
+		if receive == 0 || transmit == 0 || receive&0x80000000 != 0 || transmit&0x80000000 != 0 {
+			return nil, rtt, nil
+		}
+		forward := msDiff(receive, originate)
+		back := msDiff(msSinceMidnight(now), transmit)
+		return &TimestampStats{
+			ClockOffset: (forward - back) / 2,
+			Forward:     forward,
+			Return:      back,
+		}, rtt, nil
+	}
+}
+
+// msSinceMidnight 返回 UTC 零点起的毫秒数
+func msSinceMidnight(t time.Time) uint32 {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return uint32(t.Sub(midnight) / time.Millisecond)
+}
+
+// msDiff 计算两个时间戳之差 a-b，处理跨零点回绕，结果在 ±12 小时之内
+func msDiff(a, b uint32) time.Duration {
+	d := (int64(a) - int64(b)) % msPerDay
+	if d > msPerDay/2 {
+		d -= msPerDay
+	} else if d < -msPerDay/2 {
+		d += msPerDay
+	}
+	return time.Duration(d) * time.Millisecond
+}
@@ -0,0 +1,161 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"encoding/binary"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMsSinceMidnight(t *testing.T) {
+	cst := time.FixedZone("CST", 8*3600)
+	for _, c := range []struct {
+		t    time.Time
+		want uint32
+	}{
+		{time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC), 0},
+		{time.Date(2026, 10, 17, 0, 0, 0, 999999, time.UTC), 0}, // 不足 1 毫秒的部分舍去
+		{time.Date(2026, 10, 17, 0, 0, 1, 500000000, time.UTC), 1500},
+		{time.Date(2026, 10, 17, 23, 59, 59, 999000000, time.UTC), internal.MsPerDay - 1},
+		{time.Date(2026, 10, 17, 8, 0, 0, 0, cst), 0}, // 按 UTC 零点计算
+		{time.Date(2026, 10, 17, 7, 59, 59, 0, cst), internal.MsPerDay - 1000},
+	} {
+		if got := internal.MsSinceMidnight(c.t); got != c.want {
+			t.Errorf("%v: 应为 %d，实际为 %d", c.t, c.want, got)
+		}
+	}
+}
+
+func TestMsDiff(t *testing.T) {
+	const day = internal.MsPerDay
+	for _, c := range []struct {
+		a, b uint32
+		want time.Duration
+	}{
+		{5, 5, 0},
+		{1500, 1000, 500 * time.Millisecond},
+		{1000, 1500, -500 * time.Millisecond},
+		{1, day - 1, 2 * time.Millisecond},  // 跨零点：a 在零点之后
+		{day - 1, 1, -2 * time.Millisecond}, // 跨零点：b 在零点之后
+		{0, day - 1, time.Millisecond},
+		{day / 2, 0, 12 * time.Hour},
+		{0, day / 2, -12 * time.Hour},
+		{day/2 + 1, 0, -12*time.Hour + time.Millisecond},
+		{0, day/2 + 1, 12*time.Hour - time.Millisecond},
+	} {
+		if got := internal.MsDiff(c.a, c.b); got != c.want {
+			t.Errorf("msDiff(%d, %d) 应为 %v，实际为 %v", c.a, c.b, c.want, got)
+		}
+	}
+}
+
+// tsReply 目标返回的一个报文
+type tsReply struct {
+	from net.IP
+	pkt  []byte
+}
+
+// tsConn 模拟 ICMP 套接字：每次发送请求后按 reply 生成的报文依次应答，应答读完后读取超时
+type tsConn struct {
+	net.PacketConn
+	reply func(id, seq uint16, originate uint32) []tsReply
+	queue []tsReply
+}
+
+func (c *tsConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	// ICMP 头 4 字节之后依次为标识符、序号和发起时间戳
+	c.queue = c.reply(binary.BigEndian.Uint16(b[4:]), binary.BigEndian.Uint16(b[6:]), binary.BigEndian.Uint32(b[8:]))
+	return len(b), nil
+}
+
+func (c *tsConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	if len(c.queue) == 0 {
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+	r := c.queue[0]
+	c.queue = c.queue[1:]
+	return copy(b, r.pkt), &net.IPAddr{IP: r.from}, nil
+}
+
+func (c *tsConn) SetReadDeadline(time.Time) error { return nil }
+
+// timestampReply 构造类型为 typ 的时间戳应答
+func timestampReply(typ byte, id, seq uint16, originate, receive, transmit uint32) []byte {
+	pkt := make([]byte, 20)
+	pkt[0] = typ
+	binary.BigEndian.PutUint16(pkt[4:], id)
+	binary.BigEndian.PutUint16(pkt[6:], seq)
+	binary.BigEndian.PutUint32(pkt[8:], originate)
+	binary.BigEndian.PutUint32(pkt[12:], receive)
+	binary.BigEndian.PutUint32(pkt[16:], transmit)
+	return pkt
+}
+
+func TestTimestampOnce(t *testing.T) {
+	target, other := net.ParseIP("10.0.0.1").To4(), net.ParseIP("10.0.0.2").To4()
+	const id, seq = 0x4242, 7
+	// ahead 目标时钟比本机快 1 秒，收到请求后立即应答
+	ahead := func(id, seq uint16, originate uint32) tsReply {
+		ts := (originate + 1000) % internal.MsPerDay
+		return tsReply{target, timestampReply(14, id, seq, originate, ts, ts)}
+	}
+
+	// 不匹配或格式错误的报文都被跳过，直到收到匹配的应答
+	conn := &tsConn{reply: func(id, seq uint16, originate uint32) []tsReply {
+		valid := ahead(id, seq, originate)
+		return []tsReply{
+			{other, valid.pkt}, // 来自其他地址
+			{target, timestampReply(0, id, seq, originate, 1, 1)},       // 不是时间戳应答
+			{target, timestampReply(14, id, seq+1, originate, 1, 1)},    // 序号不同
+			{target, timestampReply(14, id+1, seq, originate, 1, 1)},    // 标识符不同
+			{target, timestampReply(14, id, seq, originate, 1, 1)[:16]}, // 时间戳被截断
+			{target, []byte{14}}, // 无法解析
+			valid,
+		}
+	}}
+	sample, rtt, err := internal.TimestampOnce(conn, target, id, seq)
+	if err != nil || sample == nil {
+		t.Fatalf("应得到样本，实际为 %v %v", sample, err)
+	}
+	if rtt < 0 || rtt > time.Second {
+		t.Errorf("RTT 应为本机发送到收到应答的时长，实际为 %v", rtt)
+	}
+	if sample.Forward != time.Second {
+		t.Errorf("去程应为 1s（含时钟偏差），实际为 %v", sample.Forward)
+	}
+	// 回程和偏差包含测试本身的耗时，允许几毫秒的误差
+	if sample.Return > -990*time.Millisecond || sample.Return < -time.Second {
+		t.Errorf("回程应约为 -1s，实际为 %v", sample.Return)
+	}
+	if sample.ClockOffset > time.Second || sample.ClockOffset < 995*time.Millisecond {
+		t.Errorf("时钟偏差应约为 1s，实际为 %v", sample.ClockOffset)
+	}
+
+	// 时间戳无效时只统计 RTT
+	for _, c := range []struct {
+		name              string
+		receive, transmit uint32
+	}{
+		{"接收时间戳为 0", 0, 1000},
+		{"发送时间戳为 0", 1000, 0},
+		{"非标准时间", 0x80000001, 0x80000001},
+	} {
+		conn := &tsConn{reply: func(id, seq uint16, originate uint32) []tsReply {
+			return []tsReply{{target, timestampReply(14, id, seq, originate, c.receive, c.transmit)}}
+		}}
+		sample, _, err := internal.TimestampOnce(conn, target, id, seq)
+		if err != nil || sample != nil {
+			t.Errorf("%s: 应只统计 RTT，实际为 %v %v", c.name, sample, err)
+		}
+	}
+
+	// 没有匹配的应答时返回读取超时
+	conn = &tsConn{reply: func(id, seq uint16, originate uint32) []tsReply {
+		return []tsReply{{target, timestampReply(14, id, seq+1, originate, 1, 1)}}
+	}}
+	if _, _, err := internal.TimestampOnce(conn, target, id, seq); !os.IsTimeout(err) {
+		t.Errorf("没有匹配的应答时应超时，实际为 %v", err)
+	}
+}
@@ -0,0 +1,279 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"golang.org/x/term"
+)
+
+// tuiSortFields 交互界面中 s 键依次切换的排序字段
+var tuiSortFields = SortFields
+
+// tuiState 交互界面的当前视图状态
+type tuiState struct {
+	rows      []*SummaryStatistic // 全部结果
+	meta      *Snapshot           // 运行元数据，导出时使用
+	renderer  TableRenderer
+	sortIdx   int
+	des       bool
+	lossOnly  bool
+	aggregate bool   // 按服务汇总（-aggregate，未指定时按地区 + 运营商）
+	expand    bool   // 按服务汇总时在每个服务之后列出其各目标
+	filter    string // 按运营商或地区子串过滤
+	offset    int    // 表格滚动偏移（行）
+	editing   bool   // 正在输入过滤条件
+	editBuf   []byte
+	exporting bool   // 等待选择导出格式
+	message   string // 状态栏提示，下一次按键后清除
+}
+
+// tuiAvailable 标准输入和标准输出都是终端时才能进入交互界面
+func tuiAvailable() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// RunTUI 在终端中交互式查看结果：实时切换排序、升降序、过滤条件、仅丢包视图和按服务汇总
+func RunTUI(result *RunResult, renderer *TableRenderer, sortField string, des bool) error {
+	state := newTUIState(result, renderer, sortField, des)
+
+	fd := int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("进入交互模式失败: %v", err)
+	}
+	defer term.Restore(fd, oldState)
+
+	// 使用备用屏幕并隐藏光标，退出时恢复
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		state.draw()
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil
+		}
+		if !state.handleKey(b, reader) {
+			return nil
+		}
+	}
+}
+
+// newTUIState 按输出参数创建交互界面的初始状态，未指定 -aggregate 时按服务汇总使用默认模板
+func newTUIState(result *RunResult, renderer *TableRenderer, sortField string, des bool) *tuiState {
+	state := &tuiState{
+		rows:      result.Rows,
+		meta:      result.Snapshot,
+		renderer:  *renderer,
+		des:       des,
+		aggregate: renderer.Aggregate != nil,
+	}
+	if state.renderer.Aggregate == nil {
+		state.renderer.Aggregate = template.Must(parseAggregate(defaultAggregate))
+	}
+	if sortField == "rtt" {
+		sortField = "avgrtt"
+	}
+	for i, f := range tuiSortFields {
+		if f == sortField {
+			state.sortIdx = i
+		}
+	}
+	return state
+}
+
+// view 返回过滤并排序后的当前视图
+func (s *tuiState) view() []*SummaryStatistic {
+	var list []*SummaryStatistic
+	for _, r := range s.rows {
+		if s.lossOnly && r.PacketLoss <= 0 {
+			continue
+		}
+		if s.filter != "" && !strings.Contains(r.Isp, s.filter) && !strings.Contains(r.Region, s.filter) {
+			continue
+		}
+		list = append(list, r)
+	}
+	sortSummaries(list, tuiSortFields[s.sortIdx], s.des)
+	return list
+}
+
+// handleKey 处理一次按键，返回 false 表示退出
+func (s *tuiState) handleKey(b byte, reader *bufio.Reader) bool {
+	s.message = ""
+	if s.exporting {
+		s.exporting = false
+		format, ok := exportFormats[b]
+		if !ok {
+			s.message = "已取消导出"
+			return true
+		}
+		var aggregate *template.Template
+		if s.aggregate {
+			aggregate = s.renderer.Aggregate
+		}
+		name, err := exportView(s.view(), s.meta, format, s.renderer.Loss, aggregate)
+		if err != nil {
+			s.message = err.Error()
+		} else {
+			s.message = "已导出到 " + name
+		}
+		return true
+	}
+	if s.editing {
+		switch b {
+		case '\r', '\n':
+			s.filter = strings.TrimSpace(string(s.editBuf))
+			s.editing = false
+			s.offset = 0
+		case 0x1b, 3: // Esc / Ctrl-C 取消输入
+			s.editing = false
+		case 0x7f, 0x08: // 退格删除一个字符
+			runes := []rune(string(s.editBuf))
+			if len(runes) > 0 {
+				s.editBuf = []byte(string(runes[:len(runes)-1]))
+			}
+		default:
+			if b >= 0x20 {
+				s.editBuf = append(s.editBuf, b)
+			}
+		}
+		return true
+	}
+
+	switch b {
+	case 'q', 3: // q / Ctrl-C
+		return false
+	case 's':
+		s.sortIdx = (s.sortIdx + 1) % len(tuiSortFields)
+	case 'r':
+		s.des = !s.des
+	case 'l':
+		s.lossOnly = !s.lossOnly
+		s.offset = 0
+	case 'a':
+		s.aggregate = !s.aggregate
+		s.offset = 0
+	case 'x':
+		s.expand = !s.expand
+	case '/':
+		s.editing = true
+		s.editBuf = []byte(s.filter)
+	case 'c':
+		s.filter = ""
+		s.offset = 0
+	case 'e':
+		s.exporting = true
+	case 'j':
+		s.offset++
+	case 'k':
+		s.offset--
+	case ' ':
+		s.offset += s.pageSize()
+	case 'b':
+		s.offset -= s.pageSize()
+	case 0x1b: // 方向键：ESC [ A / ESC [ B
+		if reader.Buffered() >= 2 {
+			seq := make([]byte, 2)
+			reader.Read(seq)
+			switch seq[1] {
+			case 'A':
+				s.offset--
+			case 'B':
+				s.offset++
+			}
+		}
+	}
+	if s.offset < 0 {
+		s.offset = 0
+	}
+	return true
+}
+
+// pageSize 返回一屏可显示的表格行数：除去表头两行和状态栏
+func (s *tuiState) pageSize() int {
+	_, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || height < 4 {
+		return 1
+	}
+	return height - 3
+}
+
+// draw 重绘整个屏幕：固定表头、可滚动的表格内容和底部状态栏
+func (s *tuiState) draw() {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err == nil {
+		s.renderer.Width = width
+	}
+
+	list := s.view()
+	var buf bytes.Buffer
+	if s.aggregate {
+		s.renderer.printAggregates(&buf, aggregateServices(s.renderer.Aggregate, list), s.expand)
+	} else {
+		s.renderer.printSummaryList(&buf, list, sectionTotals(list))
+	}
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+
+	header, body := lines, []string(nil)
+	if len(lines) > 2 {
+		header, body = lines[:2], lines[2:]
+	}
+	page := s.pageSize()
+	if s.offset > len(body)-page {
+		s.offset = max(len(body)-page, 0)
+	}
+	end := min(s.offset+page, len(body))
+
+	var screen strings.Builder
+	screen.WriteString("\x1b[H\x1b[2J")
+	for _, line := range header {
+		screen.WriteString(line + "\r\n")
+	}
+	for _, line := range body[s.offset:end] {
+		screen.WriteString(line + "\r\n")
+	}
+	for i := end - s.offset; i < page; i++ {
+		screen.WriteString("\r\n")
+	}
+	screen.WriteString(s.statusLine(len(list)))
+	fmt.Print(screen.String())
+}
+
+// statusLine 底部状态栏：当前视图参数与按键说明
+func (s *tuiState) statusLine(count int) string {
+	if s.editing {
+		return "过滤(运营商/地区，回车确认，Esc取消): " + string(s.editBuf)
+	}
+	if s.exporting {
+		return "导出当前视图: c=CSV j=JSON h=HTML，其他键取消"
+	}
+	direction := "↑"
+	if s.des {
+		direction = "↓"
+	}
+	status := fmt.Sprintf("排序:%s%s", tuiSortFields[s.sortIdx], direction)
+	if s.filter != "" {
+		status += " 过滤:" + s.filter
+	}
+	if s.lossOnly {
+		status += " 仅丢包"
+	}
+	if s.aggregate {
+		status += " 按服务"
+		if s.expand {
+			status += "(展开)"
+		}
+	}
+	status += fmt.Sprintf(" 共%d条", count)
+	if s.message != "" {
+		return status + " | " + s.message
+	}
+	return status + " | s排序 r升降序 l仅丢包 a按服务 x展开 /过滤 c清除 e导出 j/k滚动 q退出"
+}
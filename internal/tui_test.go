@@ -0,0 +1,145 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tuiResult 各排序字段下顺序不同的固定结果
+func tuiResult() *internal.RunResult {
+	ms := func(v float64) time.Duration { return time.Duration(v * float64(time.Millisecond)) }
+	rows := []*internal.SummaryStatistic{
+		{DestIP: "1.1.1.1", Region: "北京", Isp: "电信", TotalSent: 10, TotalRecv: 10, MinRtt: ms(30), MaxRtt: ms(40), AvgRtt: ms(35)},
+		{DestIP: "2.2.2.2", Region: "上海", Isp: "联通", TotalSent: 10, TotalRecv: 8, PacketLoss: 20, MinRtt: ms(10), MaxRtt: ms(90), AvgRtt: ms(50)},
+		{DestIP: "3.3.3.3", Region: "广东", Isp: "电信", TotalSent: 10, TotalRecv: 9, PacketLoss: 10, MinRtt: ms(20), MaxRtt: ms(25), AvgRtt: ms(22)},
+	}
+	return &internal.RunResult{Snapshot: &internal.Snapshot{Host: "probe-1", Count: 10}, Rows: rows, Grouped: rows}
+}
+
+// viewIPs 当前视图中各行的目标IP
+func viewIPs(tui *internal.TUI) string {
+	var ips []string
+	for _, sum := range tui.View() {
+		ips = append(ips, sum.DestIP)
+	}
+	return strings.Join(ips, " ")
+}
+
+func TestTUISortKeys(t *testing.T) {
+	tui := internal.NewTUI(tuiResult(), &internal.TableRenderer{Theme: &internal.Theme{}}, "loss", false)
+	for _, c := range []struct {
+		keys, sort, ips string
+	}{
+		{"", "loss↑", "1.1.1.1 3.3.3.3 2.2.2.2"},
+		{"s", "minrtt↑", "2.2.2.2 3.3.3.3 1.1.1.1"},
+		{"s", "maxrtt↑", "3.3.3.3 1.1.1.1 2.2.2.2"},
+		{"r", "maxrtt↓", "2.2.2.2 1.1.1.1 3.3.3.3"},
+		{"s", "avgrtt↓", "2.2.2.2 1.1.1.1 3.3.3.3"},
+		{"r", "avgrtt↑", "3.3.3.3 1.1.1.1 2.2.2.2"},
+	} {
+		if !tui.Keys(c.keys) {
+			t.Fatalf("按 %q 不应退出", c.keys)
+		}
+		if status := tui.Status(); !strings.HasPrefix(status, "排序:"+c.sort+" ") {
+			t.Errorf("按 %q 后状态栏应为 排序:%s，实际为 %q", c.keys, c.sort, status)
+		}
+		if got := viewIPs(tui); got != c.ips {
+			t.Errorf("按 %q 后（%s）顺序应为 %s，实际为 %s", c.keys, c.sort, c.ips, got)
+		}
+	}
+
+	// s 依次切换全部排序字段后回到第一个
+	for range len(internal.SortFields) - 3 {
+		tui.Keys("s")
+	}
+	if status := tui.Status(); !strings.HasPrefix(status, "排序:loss↑ ") {
+		t.Errorf("切换一圈后应回到 loss，实际为 %q", status)
+	}
+
+	// -S rtt 是 avgrtt 的旧写法，初始排序为 avgrtt
+	if status := internal.NewTUI(tuiResult(), &internal.TableRenderer{Theme: &internal.Theme{}}, "rtt", true).Status(); !strings.HasPrefix(status, "排序:avgrtt↓ ") {
+		t.Errorf("-S rtt -des 的初始排序应为 avgrtt↓，实际为 %q", status)
+	}
+}
+
+func TestTUIFilterKeys(t *testing.T) {
+	tui := internal.NewTUI(tuiResult(), &internal.TableRenderer{Theme: &internal.Theme{}}, "ip", false)
+	for _, c := range []struct {
+		keys, ips, status string
+	}{
+		{"l", "2.2.2.2 3.3.3.3", "仅丢包 共2条"},
+		{"l", "1.1.1.1 2.2.2.2 3.3.3.3", "共3条"},
+		{"/电信\r", "1.1.1.1 3.3.3.3", "过滤:电信 共2条"},
+		{"l", "3.3.3.3", "过滤:电信 仅丢包 共1条"},
+		{"/广州\x1b", "3.3.3.3", "过滤:电信 仅丢包 共1条"}, // Esc 取消输入，过滤条件不变
+		{"c", "2.2.2.2 3.3.3.3", "仅丢包 共2条"},
+	} {
+		tui.Keys(c.keys)
+		if got := viewIPs(tui); got != c.ips {
+			t.Errorf("按 %q 后视图应为 %s，实际为 %s", c.keys, c.ips, got)
+		}
+		if status := tui.Status(); !strings.Contains(status, c.status+" |") {
+			t.Errorf("按 %q 后状态栏应包含 %q，实际为 %q", c.keys, c.status, status)
+		}
+	}
+	if tui.Keys("q") {
+		t.Error("按 q 应退出")
+	}
+}
+
+// TestTUIExport e 键将当前视图（过滤、排序后）导出为文件，文件名显示在状态栏
+func TestTUIExport(t *testing.T) {
+	t.Chdir(t.TempDir())
+	tui := internal.NewTUI(tuiResult(), &internal.TableRenderer{Theme: &internal.Theme{}}, "loss", true)
+	tui.Keys("/电信\r")
+
+	export := func(key string) string {
+		tui.Keys("e" + key)
+		_, name, ok := strings.Cut(tui.Status(), "| 已导出到 ")
+		if !ok {
+			t.Fatalf("按 e%s 后应导出，状态栏为 %q", key, tui.Status())
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// CSV 按当前视图的顺序只包含过滤后的行
+	records, err := csv.NewReader(strings.NewReader(export("c"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ips []string
+	for _, r := range records[1:] {
+		ips = append(ips, r[0])
+	}
+	if got := strings.Join(ips, " "); got != "3.3.3.3 1.1.1.1" {
+		t.Errorf("导出的 CSV 应为当前视图的 3.3.3.3 1.1.1.1，实际为 %s", got)
+	}
+
+	// JSON 为带运行元数据的快照
+	snap := &internal.Snapshot{}
+	if err := json.Unmarshal([]byte(export("j")), snap); err != nil {
+		t.Fatal(err)
+	}
+	if snap.Host == "" || snap.Count != 10 || len(snap.Rows) != 2 || snap.Rows[0].DestIP != "3.3.3.3" {
+		t.Errorf("导出的 JSON 应为当前视图的快照，实际为 %+v", snap)
+	}
+
+	if html := export("h"); !strings.Contains(html, "1.1.1.1") || strings.Contains(html, "2.2.2.2") {
+		t.Error("导出的 HTML 应只包含当前视图中的目标")
+	}
+
+	// 其他键取消导出
+	tui.Keys("ez")
+	if status := tui.Status(); !strings.HasSuffix(status, "| 已取消导出") {
+		t.Errorf("按其他键应取消导出，状态栏为 %q", status)
+	}
+}
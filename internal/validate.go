@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SortFields 支持的排序字段，明细、分组和丢包结果使用同一套字段；rtt 为 avgrtt 的旧写法，score 升序时最差的在前，
+// region、ip 便于按固定的地理顺序对比连续两次运行，updated 为最近更新时间
+var SortFields = []string{"loss", "minrtt", "maxrtt", "avgrtt", "sent", "recv", "score", "region", "ip", "updated"}
+
+// validIsps 支持的运营商参数
+var validIsps = []string{"电信", "联通", "移动", "all"}
+
+// ValidateSort 校验排序字段
+func ValidateSort(field string) error {
+	if field == "rtt" {
+		return nil
+	}
+	for _, f := range SortFields {
+		if f == field {
+			return nil
+		}
+	}
+	return fmt.Errorf("不支持的排序字段 -S '%s'，可选 %s", field, strings.Join(SortFields, "|"))
+}
+
+// ValidateParams 在探测前校验运行参数，返回可直接提示给用户的错误
+func ValidateParams(isp string, region string, maxConcurrency int, count int, jitter time.Duration, adaptive AdaptiveOptions, probe ProbeOptions, targets TargetOptions, sortField string) error {
+	if count <= 0 {
+		return fmt.Errorf("发包数量 -p 必须大于 0，当前为 %d", count)
+	}
+	if maxConcurrency <= 0 {
+		return fmt.Errorf("并发数 -C 必须大于 0，当前为 %d", maxConcurrency)
+	}
+	for name, n := range targets.Concurrency {
+		if n <= 0 {
+			return fmt.Errorf("并发数 -C 中 %s 的并发数必须大于 0，当前为 %d", name, n)
+		}
+	}
+	if jitter < 0 {
+		return fmt.Errorf("启动偏移 -jitter 不能为负数，当前为 %s", jitter)
+	}
+	if adaptive.Enabled {
+		if adaptive.MaxCount < count {
+			return fmt.Errorf("自适应模式下最多发包数量 -pmax(%d) 不能小于最少发包数量 -p(%d)", adaptive.MaxCount, count)
+		}
+		if adaptive.Threshold <= 0 {
+			return fmt.Errorf("置信区间阈值 -ci 必须大于 0，当前为 %s", adaptive.Threshold)
+		}
+	}
+	if err := probe.validate(); err != nil {
+		return err
+	}
+	if probe.Pace < 0 {
+		return fmt.Errorf("发包时长 -pace 不能为负数，当前为 %s", probe.Pace)
+	}
+	if n := adaptive.maxPackets(count); probe.Pace > 0 && packetInterval(probe.Pace, n) < minPaceInterval {
+		return fmt.Errorf("-pace %s 内最多发送 %d 个包，间隔 %s 小于最小间隔 %s，请增大 -pace 或减少 -p（自适应模式下为 -pmax）",
+			probe.Pace, n, packetInterval(probe.Pace, n), minPaceInterval)
+	}
+	if err := ValidateSort(sortField); err != nil {
+		return err
+	}
+	if err := targets.validate(isp, region, probe); err != nil {
+		return err
+	}
+
+	if probe.Proto == "ntp" {
+		if region == TestsetRegion {
+			return fmt.Errorf("NTP 探测使用内置的服务器分组，不能与 -dt %s 同时使用", TestsetRegion)
+		}
+		return validateNTPTarget(isp, region)
+	}
+
+	dns, region, _, err := targetCatalog(region, targets)
+	if err != nil {
+		return err
+	}
+	return validateTarget(isp, region, dns)
+}
+
+// validateTarget 校验运营商和区域参数，区域不存在时列出该运营商可选的区域
+func validateTarget(isp string, region string, dns *DNSConfig) error {
+	ispOk := false
+	for _, v := range validIsps {
+		if v == isp {
+			ispOk = true
+		}
+	}
+	if !ispOk {
+		return fmt.Errorf("不支持的运营商 -isp '%s'，可选 %s", isp, strings.Join(validIsps, "|"))
+	}
+	if region == "全国" || region == OverseasRegion || isRegionExist(isp, region, dns) {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var regions []string
+	for name, list := range ispRegions(dns) {
+		if isp != "all" && isp != name {
+			continue
+		}
+		for r := range list {
+			if !seen[r] {
+				seen[r] = true
+				regions = append(regions, r)
+			}
+		}
+	}
+	sort.Strings(regions)
+	return fmt.Errorf("区域 -dt '%s' 不存在于运营商 '%s' 中，可选 全国|%s|%s", region, isp, OverseasRegion, strings.Join(regions, "|"))
+}
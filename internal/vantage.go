@@ -0,0 +1,309 @@
+package internal
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// 目标问题的定位
+const (
+	VantageTargetSide = "target" // 各观测点都差，问题在目标侧
+	VantageLocal      = "local"  // 只有一个观测点差，问题在该观测点本地
+	VantagePartial    = "partial"
+)
+
+// VantageOptions 判断目标在某个观测点看来是否异常的阈值
+type VantageOptions struct {
+	LossPercent float64           // 丢包率达到该百分比为异常
+	AvgRtt      time.Duration     // 平均 RTT 达到该值为异常，0 为不按 RTT 判断
+	VerifyKey   ed25519.PublicKey // 非空时要求各快照都由该公钥签名（-verify-key）
+}
+
+// VantageCell 一个观测点看到的一组目标或一个目标，Present 为 false 表示该观测点没有探测
+type VantageCell struct {
+	Present bool
+	Sent    int
+	Recv    int
+	Loss    float64
+	AvgRtt  time.Duration
+	Error   string
+	Bad     bool
+
+	// 地区 + 运营商的单元格按目标权重累加的发包数、收包数和 RTT，目标有权重时丢包率和平均 RTT 由其计算
+	weighted                   bool
+	weightedSent, weightedRecv float64
+	weightedRtt                float64
+}
+
+// VantageGroup 各观测点看到的一个地区 + 运营商（按包数汇总其全部目标，目标有权重时按权重）
+type VantageGroup struct {
+	Region string
+	Isp    string
+	Cells  []*VantageCell // 与 VantageReport.Vantages 一一对应
+}
+
+// VantageTarget 至少在一个观测点异常的目标
+type VantageTarget struct {
+	DestIP  string
+	Region  string
+	Isp     string
+	Proto   string
+	Cells   []*VantageCell
+	Verdict string   // VantageTargetSide、VantageLocal 或 VantagePartial
+	Bad     []string // 看到异常的观测点
+	weight  float64  // 汇总到地区 + 运营商时的权重，取第一个有结果的观测点中的
+}
+
+// VantageReport 多个观测点（不同办公室的探测主机）对同一批目标的结果对比
+type VantageReport struct {
+	Vantages []string
+	Groups   []*VantageGroup
+	Targets  []*VantageTarget
+	IspPairs []*IspPair // 按观测点运营商→目标运营商的汇总，观测点带有 local_isp 时才有
+}
+
+// vantageLabels 各快照的观测点名称：备注（-note），没有备注时为主机名，重名时改用文件名
+func vantageLabels(snaps []*Snapshot, paths []string) []string {
+	labels := make([]string, len(snaps))
+	count := make(map[string]int)
+	for i, snap := range snaps {
+		labels[i] = snap.Note
+		if labels[i] == "" {
+			labels[i] = snap.Host
+		}
+		count[labels[i]]++
+	}
+	for i := range labels {
+		if labels[i] == "" || count[labels[i]] > 1 {
+			labels[i] = strings.TrimSuffix(filepath.Base(paths[i]), filepath.Ext(paths[i]))
+		}
+	}
+	return labels
+}
+
+// CompareVantages 按地区 + 运营商和按目标对比各观测点的结果。目标不在某个观测点的结果中、
+// 但该观测点探测了同一地区和运营商时按全部丢包计（全部丢包的目标不在快照的 rows 中）；
+// 没有探测该地区和运营商的观测点不参与该目标的判断
+func CompareVantages(snaps []*Snapshot, labels []string, opts VantageOptions) *VantageReport {
+	report := &VantageReport{Vantages: labels, IspPairs: compareIspPairs(snaps)}
+	groupKey := func(r *SnapshotRow) string { return r.Region + "|" + r.Isp }
+	targetKey := func(r *SnapshotRow) string { return strings.Join([]string{r.DestIP, r.Isp, r.Region, r.Proto}, "|") }
+
+	groups := make(map[string]*VantageGroup)
+	targets := make(map[string]*VantageTarget)
+	var targetKeys []string
+	probed := make([]map[string]bool, len(snaps)) // 各观测点探测了的地区 + 运营商
+	for i, snap := range snaps {
+		probed[i] = make(map[string]bool)
+		for _, r := range snap.Rows {
+			gk, tk := groupKey(r), targetKey(r)
+			probed[i][gk] = true
+			if groups[gk] == nil {
+				groups[gk] = &VantageGroup{Region: r.Region, Isp: r.Isp, Cells: newVantageCells(len(snaps))}
+				report.Groups = append(report.Groups, groups[gk])
+			}
+			if targets[tk] == nil {
+				targets[tk] = &VantageTarget{DestIP: r.DestIP, Region: r.Region, Isp: r.Isp, Proto: r.Proto, Cells: newVantageCells(len(snaps)),
+					weight: targetWeight(r.Weight)}
+				targetKeys = append(targetKeys, tk)
+			}
+			cell := targets[tk].Cells[i]
+			cell.Present = true
+			cell.Sent += r.Sent
+			cell.Recv += r.Recv
+			cell.AvgRtt += time.Duration(r.Recv) * msToDuration(r.AvgRttMs) // 先累加，最后除以收包数
+			if r.Error != "" {
+				cell.Error = r.Error
+			}
+		}
+	}
+
+	for _, tk := range targetKeys {
+		t := targets[tk]
+		gk := t.Region + "|" + t.Isp
+		present := 0
+		for i, cell := range t.Cells {
+			if !cell.Present && probed[i][gk] {
+				// 该观测点探测了同组目标而没有这个目标的结果：全部丢包
+				cell.Present, cell.Sent = true, snaps[i].Count*max(snaps[i].Rounds, 1)
+			}
+			if !cell.Present {
+				continue
+			}
+			present++
+			g := groups[gk].Cells[i]
+			g.Present, g.weighted = true, true
+			g.Sent += cell.Sent
+			g.Recv += cell.Recv
+			g.weightedSent += t.weight * float64(cell.Sent)
+			g.weightedRecv += t.weight * float64(cell.Recv)
+			g.weightedRtt += t.weight * float64(cell.AvgRtt)
+			cell.finish(opts)
+			if cell.Bad {
+				t.Bad = append(t.Bad, labels[i])
+			}
+		}
+		switch {
+		case len(t.Bad) == 0:
+			continue
+		case present >= 2 && len(t.Bad) == present:
+			t.Verdict = VantageTargetSide
+		case present >= 2 && len(t.Bad) == 1:
+			t.Verdict = VantageLocal
+		default:
+			t.Verdict = VantagePartial
+		}
+		report.Targets = append(report.Targets, t)
+	}
+	for _, g := range report.Groups {
+		for _, cell := range g.Cells {
+			cell.finish(opts)
+		}
+	}
+
+	sort.SliceStable(report.Groups, func(i, j int) bool {
+		if report.Groups[i].Region != report.Groups[j].Region {
+			return report.Groups[i].Region < report.Groups[j].Region
+		}
+		return report.Groups[i].Isp < report.Groups[j].Isp
+	})
+	// 目标侧问题在前，其次是本地问题
+	order := map[string]int{VantageTargetSide: 0, VantageLocal: 1, VantagePartial: 2}
+	sort.SliceStable(report.Targets, func(i, j int) bool {
+		return order[report.Targets[i].Verdict] < order[report.Targets[j].Verdict]
+	})
+	return report
+}
+
+func newVantageCells(n int) []*VantageCell {
+	cells := make([]*VantageCell, n)
+	for i := range cells {
+		cells[i] = &VantageCell{}
+	}
+	return cells
+}
+
+// finish 由累加的收发包数和 RTT 计算丢包率、平均 RTT 并判断是否异常
+func (c *VantageCell) finish(opts VantageOptions) {
+	if !c.Present {
+		return
+	}
+	sent, recv, rtt := float64(c.Sent), float64(c.Recv), float64(c.AvgRtt)
+	if c.weighted {
+		sent, recv, rtt = c.weightedSent, c.weightedRecv, c.weightedRtt
+	}
+	c.Loss = 100
+	if sent > 0 {
+		c.Loss = (sent - recv) / sent * 100
+	}
+	if recv > 0 {
+		c.AvgRtt = time.Duration(rtt / recv)
+	}
+	c.Bad = c.Error != "" || c.Loss >= opts.LossPercent || (opts.AvgRtt > 0 && c.Recv > 0 && c.AvgRtt >= opts.AvgRtt)
+}
+
+// String 表格中的单元格，如 "0.5% 35.2ms"，没有探测时为 "-"
+func (c *VantageCell) String() string {
+	switch {
+	case !c.Present:
+		return "-"
+	case c.Error != "":
+		return "出错"
+	case c.Recv == 0:
+		return fmt.Sprintf("%.1f%%", c.Loss)
+	}
+	return fmt.Sprintf("%.1f%% %.1fms", c.Loss, durationToMs(c.AvgRtt))
+}
+
+// Vantage 读取多个观测点的快照，输出按地区 + 运营商的对比矩阵和异常目标的定位
+func Vantage(paths []string, opts VantageOptions) error {
+	var snaps []*Snapshot
+	for _, path := range paths {
+		snap, err := loadTrustedSnapshot(path, opts.VerifyKey)
+		if err != nil {
+			return err
+		}
+		snaps = append(snaps, snap)
+	}
+	labels := vantageLabels(snaps, paths)
+	for i, snap := range snaps {
+		printSnapshotHeader(labels[i], snap)
+	}
+	report := CompareVantages(snaps, labels, opts)
+	printVantageReport(os.Stdout, report)
+	if len(report.IspPairs) > 0 {
+		printIspPairs(os.Stdout, report.IspPairs)
+	}
+	return nil
+}
+
+// newPlainTable 左对齐、无边框、以空格分隔列的表格，用于多观测点对比等辅助输出
+func newPlainTable(w io.Writer, header []string) *tablewriter.Table {
+	table := tablewriter.NewWriter(w)
+	table.SetHeader(header)
+	table.SetAutoFormatHeaders(false)
+	table.SetAutoWrapText(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetBorder(false)
+	table.SetColumnSeparator(" ")
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	return table
+}
+
+// printVantageReport 输出对比矩阵（异常的单元格标红）和异常目标列表
+func printVantageReport(w io.Writer, report *VantageReport) {
+	red, reset := "\x1b[31m", "\x1b[0m"
+	cellText := func(c *VantageCell) string {
+		if c.Bad {
+			return red + c.String() + reset
+		}
+		return c.String()
+	}
+
+	fmt.Fprintln(w, "====== 各观测点对比（丢包率 平均RTT） ======")
+	table := newPlainTable(w, append([]string{"地区", "运营商"}, report.Vantages...))
+	for _, g := range report.Groups {
+		cells := []string{g.Region, g.Isp}
+		for _, c := range g.Cells {
+			cells = append(cells, cellText(c))
+		}
+		table.Append(cells)
+	}
+	table.Render()
+
+	fmt.Fprintln(w, "====== 异常目标定位 ======")
+	if len(report.Targets) == 0 {
+		fmt.Fprintln(w, "各观测点都没有异常目标")
+		return
+	}
+	table = newPlainTable(w, append(append([]string{"目标IP", "地区", "运营商"}, report.Vantages...), "定位"))
+	for _, t := range report.Targets {
+		dest := t.DestIP
+		if t.Proto != "" {
+			dest += " " + t.Proto
+		}
+		cells := []string{dest, t.Region, t.Isp}
+		for _, c := range t.Cells {
+			cells = append(cells, cellText(c))
+		}
+		var verdict string
+		switch t.Verdict {
+		case VantageTargetSide:
+			verdict = "目标侧：各观测点均异常"
+		case VantageLocal:
+			verdict = "本地：仅 " + t.Bad[0] + " 异常"
+		default:
+			verdict = "部分观测点：" + strings.Join(t.Bad, "、")
+		}
+		table.Append(append(cells, verdict))
+	}
+	table.Render()
+}
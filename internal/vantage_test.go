@@ -0,0 +1,152 @@
+package internal_test
+
+import (
+	"bytes"
+	"dping/internal"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompareVantages(t *testing.T) {
+	row := func(ip, region, isp string, recv int, rtt float64) *internal.SnapshotRow {
+		return &internal.SnapshotRow{DestIP: ip, Region: region, Isp: isp, Sent: 10, Recv: recv, AvgRttMs: rtt}
+	}
+	// 1.1.1.1 各地都丢包（目标侧）；2.2.2.2 只有北京丢包（本地）；3.3.3.3 在上海的结果中没有（全部丢包）；
+	// 4.4.4.4 只有广州探测了广东移动，广州 RTT 高
+	bj := &internal.Snapshot{Count: 10, Rows: []*internal.SnapshotRow{
+		row("1.1.1.1", "广东", "电信", 5, 30), row("2.2.2.2", "北京", "联通", 6, 20), row("3.3.3.3", "北京", "联通", 10, 20),
+	}}
+	sh := &internal.Snapshot{Count: 10, Rows: []*internal.SnapshotRow{
+		row("1.1.1.1", "广东", "电信", 4, 30), row("2.2.2.2", "北京", "联通", 10, 30),
+	}}
+	gz := &internal.Snapshot{Count: 10, Rows: []*internal.SnapshotRow{
+		row("1.1.1.1", "广东", "电信", 0, 0), row("2.2.2.2", "北京", "联通", 10, 40), row("3.3.3.3", "北京", "联通", 10, 40),
+		row("4.4.4.4", "广东", "移动", 10, 200),
+	}}
+	report := internal.CompareVantages([]*internal.Snapshot{bj, sh, gz}, []string{"北京", "上海", "广州"},
+		internal.VantageOptions{LossPercent: 5, AvgRtt: 100 * time.Millisecond})
+
+	verdicts := make(map[string]*internal.VantageTarget)
+	for _, target := range report.Targets {
+		verdicts[target.DestIP] = target
+	}
+	if len(report.Targets) != 4 {
+		t.Fatalf("异常目标应有 4 个，实际为 %d", len(report.Targets))
+	}
+	if report.Targets[0].DestIP != "1.1.1.1" || report.Targets[0].Verdict != internal.VantageTargetSide {
+		t.Errorf("目标侧问题应排在最前，实际为 %s %s", report.Targets[0].DestIP, report.Targets[0].Verdict)
+	}
+	if v := verdicts["2.2.2.2"]; v.Verdict != internal.VantageLocal || v.Bad[0] != "北京" {
+		t.Errorf("2.2.2.2 应为北京本地问题，实际为 %s %v", v.Verdict, v.Bad)
+	}
+	if v := verdicts["3.3.3.3"]; v.Verdict != internal.VantageLocal || v.Bad[0] != "上海" || v.Cells[1].Loss != 100 {
+		t.Errorf("3.3.3.3 应为上海本地问题（全部丢包），实际为 %s %v", v.Verdict, v.Bad)
+	}
+	if v := verdicts["4.4.4.4"]; v.Verdict != internal.VantagePartial || v.Cells[0].Present || v.Cells[1].Present {
+		t.Errorf("只有广州探测的 4.4.4.4 应为部分观测点，其他观测点未探测，实际为 %s", v.Verdict)
+	}
+
+	// 北京联通：北京 16/20 收包，上海 10/20（3.3.3.3 全部丢包），广州 20/20
+	for _, g := range report.Groups {
+		if g.Region != "北京" {
+			continue
+		}
+		if g.Cells[0].Loss != 20 || g.Cells[1].Loss != 50 || g.Cells[2].Loss != 0 {
+			t.Errorf("北京联通各观测点丢包率应为 20%%、50%%、0%%，实际为 %.1f%%、%.1f%%、%.1f%%", g.Cells[0].Loss, g.Cells[1].Loss, g.Cells[2].Loss)
+		}
+		if g.Cells[2].AvgRtt != 40*time.Millisecond || g.Cells[2].Bad {
+			t.Errorf("广州看北京联通平均 RTT 应为 40ms 且正常，实际为 %s", g.Cells[2].AvgRtt)
+		}
+	}
+	if len(report.Groups) != 3 {
+		t.Errorf("应有 3 个地区 + 运营商，实际为 %d", len(report.Groups))
+	}
+}
+
+func TestCompareVantagesIspPairs(t *testing.T) {
+	row := func(ip, isp string, recv int, rtt float64) *internal.SnapshotRow {
+		return &internal.SnapshotRow{DestIP: ip, Region: "北京", Isp: isp, Sent: 10, Recv: recv, AvgRttMs: rtt}
+	}
+	// 电信的两个观测点到联通平均 60ms，联通观测点到电信只有 20ms：电信→联通方向拥塞
+	ct1 := &internal.Snapshot{Count: 10, LocalIsp: "电信", Rows: []*internal.SnapshotRow{row("1.1.1.1", "电信", 10, 5), row("2.2.2.2", "联通", 10, 50)}}
+	ct2 := &internal.Snapshot{Count: 10, LocalIsp: "电信", Rows: []*internal.SnapshotRow{row("2.2.2.2", "联通", 5, 80)}}
+	cu := &internal.Snapshot{Count: 10, LocalIsp: "联通", Rows: []*internal.SnapshotRow{row("1.1.1.1", "电信", 10, 20), row("2.2.2.2", "联通", 10, 5)}}
+	anon := &internal.Snapshot{Count: 10, Rows: []*internal.SnapshotRow{row("1.1.1.1", "电信", 10, 200)}}
+	report := internal.CompareVantages([]*internal.Snapshot{ct1, ct2, cu, anon}, []string{"a", "b", "c", "d"},
+		internal.VantageOptions{LossPercent: 5})
+
+	pairs := make(map[string]*internal.IspPair)
+	for _, p := range report.IspPairs {
+		pairs[p.From+"→"+p.To] = p
+	}
+	if len(report.IspPairs) != 4 {
+		t.Fatalf("应有 4 个运营商方向（没有 local_isp 的快照不参与），实际为 %d", len(report.IspPairs))
+	}
+	p := pairs["电信→联通"]
+	if p.Vantages != 2 || p.Sent != 20 || p.Recv != 15 || p.AvgRtt != 60*time.Millisecond {
+		t.Errorf("电信→联通 应为 2 个观测点、20 发 15 收、平均 60ms，实际为 %d、%d、%d、%s", p.Vantages, p.Sent, p.Recv, p.AvgRtt)
+	}
+	if !p.Asym || p.Reverse != pairs["联通→电信"] || !pairs["联通→电信"].Asym {
+		t.Errorf("电信→联通 与 联通→电信 应互为反方向且不对称")
+	}
+	if same := pairs["电信→电信"]; same.Reverse != nil || same.Asym {
+		t.Errorf("同一运营商内不应有反方向")
+	}
+}
+
+func TestLinkReport(t *testing.T) {
+	row := func(ip, region, isp, src string, sent, recv int, avg float64) *internal.SnapshotRow {
+		return &internal.SnapshotRow{DestIP: ip, Region: region, Isp: isp, Source: src, Sent: sent, Recv: recv, AvgRttMs: avg}
+	}
+	const a, b = "10.0.0.1", "10.0.1.1"
+	snap := &internal.Snapshot{Count: 10, RunID: "run-1", Rows: []*internal.SnapshotRow{
+		// 北京电信：丢包相同，eth1 的 RTT 低 10ms
+		row("1.1.1.1", "北京", "电信", a, 10, 10, 30), row("1.1.1.1", "北京", "电信", b, 10, 10, 20),
+		// 上海电信：eth0 丢包低
+		row("2.2.2.2", "上海", "电信", a, 10, 10, 40), row("2.2.2.2", "上海", "电信", b, 10, 7, 30),
+		// 北京联通：RTT 相差 1ms，相当
+		row("3.3.3.3", "北京", "联通", a, 10, 10, 21), row("3.3.3.3", "北京", "联通", b, 10, 10, 20),
+		// 其他源的结果不计入
+		row("3.3.3.3", "北京", "联通", "10.0.9.9", 10, 0, 0),
+	}, Unanswered: []*internal.SnapshotRow{
+		// 广州移动：eth1 全部丢包
+		row("4.4.4.4", "广州", "移动", b, 10, 0, 0),
+	}}
+	snap.Rows = append(snap.Rows, row("4.4.4.4", "广州", "移动", a, 10, 10, 50))
+	links := []*internal.Link{{Name: "eth0", Source: a}, {Name: "eth1", Source: b}}
+	report := internal.NewLinkReport(snap, links)
+
+	var got []string
+	for _, g := range report.Groups {
+		got = append(got, g.Isp+g.Region+" "+g.Verdict)
+	}
+	want := []string{
+		"电信上海 eth0 更优（丢包低 30.0 个百分点）",
+		"电信北京 eth1 更优（RTT 低 10.0ms）",
+		"电信全部 eth0 更优（丢包低 15.0 个百分点）",
+		"联通北京 相当",
+		"联通全部 相当",
+		"移动广州 eth0 更优（丢包低 100.0 个百分点）",
+		"移动全部 eth0 更优（丢包低 100.0 个百分点）",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("各地区的结论应为\n%s\n实际为\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+	if report.Wins[0] != 2 || report.Wins[1] != 1 || report.Ties != 1 || report.Overall.Targets != 4 {
+		t.Errorf("胜出地区数为 %v，相当 %d，全部目标 %d", report.Wins, report.Ties, report.Overall.Targets)
+	}
+	if s := report.Overall.Stats[1]; s.Sent != 40 || s.Recv != 27 {
+		t.Errorf("eth1 合计应发 40 收 27，实际为发 %d 收 %d", s.Sent, s.Recv)
+	}
+
+	var html bytes.Buffer
+	if err := report.WriteHTML(&html); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"eth0 在 2 个地区更优，eth1 在 1 个地区更优，1 个地区相当", "10.0.1.1", "eth1 更优（RTT 低 10.0ms）"} {
+		if !strings.Contains(html.String(), want) {
+			t.Errorf("HTML 报告中没有 %q", want)
+		}
+	}
+}
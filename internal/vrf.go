@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/go-ping/ping"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// listenICMP 打开与目标地址族相同的 ICMP 原始套接字，指定了源IP时绑定该地址，指定了 device 时绑定到该设备（-vrf）
+func listenICMP(to net.IP, sourceIP net.IP, device string) (net.PacketConn, error) {
+	network, addr := "ip4:icmp", "0.0.0.0"
+	if to.To4() == nil {
+		network, addr = "ip6:ipv6-icmp", "::"
+	}
+	if sourceIP != nil {
+		addr = sourceIP.String()
+	}
+	lc := net.ListenConfig{Control: bindDevice(device)}
+	return lc.ListenPacket(context.Background(), network, addr)
+}
+
+// dialUDP 建立到 raddr 的 UDP 套接字，指定了源IP时从该地址发出，指定了 device 时绑定到该设备（-vrf）
+func dialUDP(network string, sourceIP net.IP, raddr *net.UDPAddr, device string) (*net.UDPConn, error) {
+	d := net.Dialer{Control: bindDevice(device)}
+	if sourceIP != nil {
+		d.LocalAddr = &net.UDPAddr{IP: sourceIP}
+	}
+	conn, err := d.Dial(network, raddr.String())
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.UDPConn), nil
+}
+
+// probeDevice 绑定到 VRF 设备时的 ICMP Echo 探测：go-ping 无法设置套接字选项，由 dping 自己收发
+func (p icmpProber) probeDevice(to net.IP, sourceIP net.IP, count int, adaptive AdaptiveOptions) (*ping.Statistics, error) {
+	conn, err := listenICMP(to, sourceIP, p.vrf)
+	if err != nil {
+		return nil, fmt.Errorf("Ping Start Error: %w", err)
+	}
+	defer conn.Close()
+
+	id := p.ids.take()
+	seq := 0
+	return probeLoop(to, count, adaptive, packetInterval(p.pace, adaptive.maxPackets(count)), func() (time.Duration, error) {
+		seq++
+		return echoOnce(conn, to, id, seq)
+	})
+}
+
+// echoOnce 发送一次 Echo 请求并等待标识符和序号匹配的应答
+func echoOnce(conn net.PacketConn, to net.IP, id, seq int) (time.Duration, error) {
+	var typ, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	proto := 1
+	if to.To4() == nil {
+		typ, replyType, proto = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply, 58
+	}
+	msg := icmp.Message{Type: typ, Body: &icmp.Echo{ID: id, Seq: seq, Data: make([]byte, 24)}}
+	wb, err := msg.Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	if _, err := conn.WriteTo(wb, &net.IPAddr{IP: to}); err != nil {
+		return 0, err
+	}
+
+	conn.SetReadDeadline(start.Add(probeTimeout))
+	bufp := packetPool.Get().(*[]byte)
+	defer packetPool.Put(bufp)
+	rb := *bufp
+	for {
+		n, peer, err := conn.ReadFrom(rb)
+		if err != nil {
+			return 0, err
+		}
+		rtt := time.Since(start)
+		if addr, ok := peer.(*net.IPAddr); !ok || !addr.IP.Equal(to) {
+			continue
+		}
+		reply, err := icmp.ParseMessage(proto, rb[:n])
+		if err != nil || reply.Type != replyType {
+			continue
+		}
+		if echo, ok := reply.Body.(*icmp.Echo); ok && echo.ID == id && echo.Seq == seq {
+			return rtt, nil
+		}
+	}
+}
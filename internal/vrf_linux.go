@@ -0,0 +1,26 @@
+package internal
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// bindDevice 返回将套接字绑定到网卡或 VRF 设备（SO_BINDTODEVICE）的 Control 函数，device 为空时返回 nil；
+// 绑定到 VRF 设备后，路由查找使用该 VRF 关联的路由表
+func bindDevice(device string) func(network, address string, c syscall.RawConn) error {
+	if device == "" {
+		return nil
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		var err error
+		if ctrlErr := c.Control(func(fd uintptr) {
+			err = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, device)
+		}); ctrlErr != nil {
+			return ctrlErr
+		}
+		if err != nil {
+			return fmt.Errorf("绑定到 %s 失败: %w", device, err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package internal
+
+import (
+	"errors"
+	"syscall"
+)
+
+// bindDevice 只有 Linux 支持将套接字绑定到 VRF 设备，其他系统上 device 非空时建立连接失败
+func bindDevice(device string) func(network, address string, c syscall.RawConn) error {
+	if device == "" {
+		return nil
+	}
+	return func(string, string, syscall.RawConn) error {
+		return errors.New("-vrf 只支持 Linux")
+	}
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// minWatchInterval 持续探测的最小间隔
+const minWatchInterval = time.Second
+
+// WatchOptions 持续探测参数，Interval 为 0 时只探测一轮
+type WatchOptions struct {
+	Interval time.Duration // 两轮探测开始时间的间隔，一轮耗时超过间隔时下一轮立即开始
+	Spread   bool          // 将每轮的全部探测按固定顺序均匀分布在 Interval 内依次开始，而不是每轮开始时同时发起
+	Alert    AlertOptions
+	Chart    string // 非空时每轮以折线图显示该目标 IP 或运营商的丢包率和平均 RTT，代替结果表格
+	Digest   string // 非空时每天该时刻（HH:MM）发送一次汇总，与前一天对比
+	History  string // 非空时每轮结果追加写入该 JSON Lines 文件，供 dping history 分析
+	Retain   HistoryRetention
+	Push     PushOptions
+	Events   EventOptions // 目标在 healthy、degraded、down 之间变化时产生事件
+}
+
+// ValidateWatch 校验持续探测和告警参数，告警只在持续探测时生效
+func ValidateWatch(watch WatchOptions) error {
+	if watch.Interval < 0 || (watch.Interval > 0 && watch.Interval < minWatchInterval) {
+		return fmt.Errorf("持续探测间隔 -watch 不能小于 %s，当前为 %s", minWatchInterval, watch.Interval)
+	}
+	if err := watch.Alert.validate(); err != nil {
+		return err
+	}
+	if err := watch.Push.validate(); err != nil {
+		return err
+	}
+	if err := watch.Events.validate(); err != nil {
+		return err
+	}
+	if watch.Interval == 0 && watch.Events.Enabled() {
+		return fmt.Errorf("-events 和 -events-webhook 需要同时指定 -watch 持续探测")
+	}
+	if watch.Interval == 0 && watch.Alert.Enabled() {
+		return fmt.Errorf("告警参数需要同时指定 -watch 持续探测")
+	}
+	if watch.Interval == 0 && watch.Spread {
+		return fmt.Errorf("-spread 需要同时指定 -watch 持续探测")
+	}
+	if watch.Interval == 0 && watch.Chart != "" {
+		return fmt.Errorf("-chart 需要同时指定 -watch 持续探测")
+	}
+	if watch.Digest != "" {
+		if _, err := parseDigestTime(watch.Digest); err != nil {
+			return err
+		}
+		if watch.Interval == 0 {
+			return fmt.Errorf("-digest 需要同时指定 -watch 持续探测")
+		}
+	}
+	if watch.Interval == 0 && watch.History != "" {
+		return fmt.Errorf("-history 需要同时指定 -watch 持续探测")
+	}
+	if err := watch.Retain.validate(); err != nil {
+		return err
+	}
+	if watch.History == "" && (watch.Retain.Raw > 0 || watch.Retain.Rollup > 0) {
+		return fmt.Errorf("-history-raw 和 -history-rollup 需要同时指定 -history")
+	}
+	if watch.Alert.SNMPTrap != "" && !watch.Alert.Enabled() {
+		return fmt.Errorf("-alert-snmp 需要同时指定 -alert-loss、-alert-rtt、-alert-loss-rise 或 -alert-slo-rtt")
+	}
+	if watch.Alert.Webhook != "" && !watch.Alert.Enabled() && watch.Digest == "" {
+		return fmt.Errorf("-alert-webhook 需要同时指定 -alert-loss、-alert-rtt、-alert-loss-rise、-alert-slo-rtt 或 -digest")
+	}
+	return nil
+}
+
+// watch 每隔 Interval 探测一轮并输出结果，每轮结果交给告警管理器、状态变化事件和每日汇总，追加到历史文件并推送；收到 Ctrl-C 或 SIGTERM 后在本轮结束时退出，
+// 返回最后一轮的结果和轮数
+func watch(cfg *runConfig, targets []*Target, prober Prober) (*Snapshot, int) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	alerts := newAlertManager(cfg.watch.Alert)
+	events := NewEventEmitter(cfg.watch.Events)
+	weights, _ := ParseScoreWeights(cfg.output.ScoreWeights)
+	digest := newDigester(cfg.watch, weights, time.Now())
+	push := newPusher(cfg.watch.Push)
+	var compactedAt time.Time
+	for round := 1; ; round++ {
+		start := time.Now()
+		fmt.Fprintf(os.Stderr, "✅ 第 %d 轮探测开始于 %s\n", round, start.Format(time.DateTime))
+		snap := execute(cfg, targets, prober)
+		alerts.Evaluate(snap, time.Now())
+		events.Evaluate(snap, time.Now())
+		digest.Add(snap, time.Now())
+		if cfg.watch.History != "" {
+			if err := AppendHistory(cfg.watch.History, snap); err != nil {
+				log.Printf("⚠️  %v\n", err)
+			}
+			// 按保留策略整理历史文件，每小时最多一次
+			if cfg.watch.Retain.Enabled() && time.Since(compactedAt) >= historyCompactInterval {
+				compactedAt = time.Now()
+				if before, after, err := CompactHistory(cfg.watch.History, cfg.watch.Retain, compactedAt); err != nil {
+					log.Printf("⚠️  %v\n", err)
+				} else if after < before {
+					fmt.Fprintf(os.Stderr, "✅ 已整理历史文件 %s：%d 轮合并、删除后为 %d 轮\n", cfg.watch.History, before, after)
+				}
+			}
+		}
+		// 推送在后台进行，重试中的推送在下一轮结束时被取代，不推迟下一轮的开始
+		push.PushAsync(snap)
+
+		wait := time.Until(start.Add(cfg.watch.Interval))
+		if wait <= 0 {
+			log.Printf("⚠️  第 %d 轮耗时 %s，超过间隔 %s，下一轮立即开始\n", round, time.Since(start).Round(time.Second), cfg.watch.Interval)
+		}
+		select {
+		case <-ctx.Done():
+			push.Wait()
+			fmt.Fprintf(os.Stderr, "✅ 已停止持续探测，共 %d 轮\n", round)
+			return snap, round
+		case <-time.After(wait):
+		}
+	}
+}
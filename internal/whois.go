@@ -0,0 +1,273 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// whoisServer 先向 IANA 查询，再按其返回的 refer 转到负责该地址的 RIR（如 APNIC）
+var whoisServer = "whois.iana.org"
+
+const (
+	whoisInterval = time.Second         // 两次 WHOIS 网络查询的最小间隔，避免被服务器限流
+	whoisTimeout  = 10 * time.Second    // 单次查询的超时
+	whoisCacheTTL = 30 * 24 * time.Hour // 缓存有效期，地址注册信息很少变化
+)
+
+// whoisInfo 由 WHOIS 注册信息推断出的地区和运营商，推断不出时为空
+type whoisInfo struct {
+	Region    string    `json:"region"`
+	Isp       string    `json:"isp"`
+	QueriedAt time.Time `json:"queried_at"`
+}
+
+// whoisCache WHOIS 结果的本地缓存，保存在用户缓存目录下，按 IP 索引
+type whoisCache struct {
+	path    string
+	entries map[string]*whoisInfo
+}
+
+// loadWhoisCache 读取缓存文件；缓存目录不可用或文件损坏时使用空缓存
+func loadWhoisCache() *whoisCache {
+	c := &whoisCache{entries: make(map[string]*whoisInfo)}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return c
+	}
+	c.path = filepath.Join(dir, "dping", "whois.json")
+	if data, err := os.ReadFile(c.path); err == nil {
+		if err := json.Unmarshal(data, &c.entries); err != nil {
+			log.Printf("⚠️  WHOIS 缓存 %s 损坏，已忽略: %v\n", c.path, err)
+			c.entries = make(map[string]*whoisInfo)
+		}
+	}
+	return c
+}
+
+// get 返回未过期的缓存结果
+func (c *whoisCache) get(ip string) *whoisInfo {
+	info, ok := c.entries[ip]
+	if !ok || time.Since(info.QueriedAt) > whoisCacheTTL {
+		return nil
+	}
+	return info
+}
+
+func (c *whoisCache) save() error {
+	if c.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("保存 WHOIS 缓存失败: %v", err)
+	}
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("保存 WHOIS 缓存失败: %v", err)
+	}
+	if err := os.WriteFile(c.path, data, 0o644); err != nil {
+		return fmt.Errorf("保存 WHOIS 缓存失败: %v", err)
+	}
+	return nil
+}
+
+// enrichTargets 对缺少地区或运营商的目标查询 WHOIS 并补全，只填写空缺的部分；
+// 查询按 whoisInterval 依次进行，结果写入本地缓存供下次使用
+func enrichTargets(targets []*Target) {
+	cache := loadWhoisCache()
+	var lastQuery time.Time
+	queried, cached, failed := 0, 0, 0
+	for _, t := range targets {
+		missing := false
+		for _, l := range t.Labels {
+			missing = missing || l.Region == "" || l.Isp == ""
+		}
+		if !missing {
+			continue
+		}
+
+		info := cache.get(t.IP)
+		if info != nil {
+			cached++
+		} else {
+			if wait := whoisInterval - time.Since(lastQuery); wait > 0 {
+				time.Sleep(wait)
+			}
+			lastQuery = time.Now()
+			var err error
+			if info, err = lookupWhois(whoisQuery, t.IP); err != nil {
+				log.Printf("⚠️  WHOIS 查询 %s 失败: %v\n", t.IP, err)
+				failed++
+				continue
+			}
+			cache.entries[t.IP] = info
+			queried++
+		}
+		for i := range t.Labels {
+			if t.Labels[i].Region == "" {
+				t.Labels[i].Region = info.Region
+			}
+			if t.Labels[i].Isp == "" {
+				t.Labels[i].Isp = info.Isp
+			}
+		}
+	}
+	if queried > 0 {
+		if err := cache.save(); err != nil {
+			log.Printf("⚠️  %v\n", err)
+		}
+	}
+	if queried+cached+failed > 0 {
+		fmt.Fprintf(os.Stderr, "✅ WHOIS 补全：查询 %d 个，缓存 %d 个，失败 %d 个\n", queried, cached, failed)
+	}
+}
+
+// lookupWhois 通过 query 查询 IP 的注册信息，ARIN 需要以 "n + IP" 的形式查询网段
+func lookupWhois(query func(server string, query string) (string, error), ip string) (*whoisInfo, error) {
+	resp, err := query(whoisServer, ip)
+	if err != nil {
+		return nil, err
+	}
+	if refer := whoisFields(resp)["refer"]; len(refer) > 0 {
+		q := ip
+		if refer[0] == "whois.arin.net" {
+			q = "n + " + ip
+		}
+		if resp, err = query(refer[0], q); err != nil {
+			return nil, err
+		}
+	}
+	info := parseWhois(resp)
+	info.QueriedAt = time.Now()
+	return info, nil
+}
+
+// whoisQuery 向 WHOIS 服务器（TCP 43 端口）发送一次查询并读取全部应答
+func whoisQuery(server string, query string) (string, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(server, "43"), whoisTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(whoisTimeout))
+	if _, err := io.WriteString(conn, query+"\r\n"); err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(io.LimitReader(conn, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// whoisFields 解析 "key: value" 格式的应答，键统一为小写，同名字段按出现顺序保留
+func whoisFields(resp string) map[string][]string {
+	fields := make(map[string][]string)
+	for _, line := range strings.Split(resp, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "%") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		if value = strings.TrimSpace(value); value != "" {
+			key = strings.ToLower(strings.TrimSpace(key))
+			fields[key] = append(fields[key], value)
+		}
+	}
+	return fields
+}
+
+// whoisIspKeywords 国内三家运营商在注册信息中常见的名称
+var whoisIspKeywords = []struct {
+	isp      string
+	keywords []string
+}{
+	{"电信", []string{"CHINANET", "CHINA TELECOM", "CHINATELECOM"}},
+	{"联通", []string{"UNICOM", "CNCGROUP", "CHINA169"}},
+	{"移动", []string{"CMNET", "CHINA MOBILE", "CHINAMOBILE"}},
+}
+
+// whoisProvinces 注册地址中的省份拼音，与内置目标的地区名称一致
+var whoisProvinces = []struct{ pinyin, name string }{
+	{"BEIJING", "北京"}, {"SHANGHAI", "上海"}, {"TIANJIN", "天津"}, {"CHONGQING", "重庆"},
+	{"HEBEI", "河北"}, {"SHAANXI", "陕西"}, {"SHANXI", "山西"}, {"LIAONING", "辽宁"},
+	{"JILIN", "吉林"}, {"HEILONGJIANG", "黑龙江"}, {"JIANGSU", "江苏"}, {"ZHEJIANG", "浙江"},
+	{"ANHUI", "安徽"}, {"FUJIAN", "福建"}, {"JIANGXI", "江西"}, {"SHANDONG", "山东"},
+	{"HENAN", "河南"}, {"HUBEI", "湖北"}, {"HUNAN", "湖南"}, {"GUANGDONG", "广东"},
+	{"GUANGXI", "广西"}, {"HAINAN", "海南"}, {"SICHUAN", "四川"}, {"GUIZHOU", "贵州"},
+	{"YUNNAN", "云南"}, {"XIZANG", "西藏"}, {"TIBET", "西藏"}, {"GANSU", "甘肃"},
+	{"QINGHAI", "青海"}, {"NINGXIA", "宁夏"}, {"XINJIANG", "新疆"}, {"INNER MONGOLIA", "内蒙古"},
+	{"NEIMENGGU", "内蒙古"}, {"HONG KONG", "香港"}, {"HONGKONG", "香港"},
+}
+
+// normalizeWhois 将字段值转为大写，字母和数字以外的字符统一为空格，便于按整词匹配（如 CHINA169）
+func normalizeWhois(values []string) string {
+	words := strings.FieldsFunc(strings.ToUpper(strings.Join(values, " ")), func(r rune) bool {
+		return (r < 'A' || r > 'Z') && (r < '0' || r > '9')
+	})
+	return " " + strings.Join(words, " ") + " "
+}
+
+// matchChinaIsp 在 normalizeWhois 处理过的文本中匹配国内三家运营商，匹配不到时为空
+func matchChinaIsp(normalized string) string {
+	for _, k := range whoisIspKeywords {
+		for _, kw := range k.keywords {
+			if strings.Contains(normalized, " "+kw+" ") || (kw == "UNICOM" && strings.Contains(normalized, kw)) {
+				return k.isp
+			}
+		}
+	}
+	return ""
+}
+
+// matchProvince 在 normalizeWhois 处理过的文本中匹配省份拼音，匹配不到时为空
+func matchProvince(normalized string) string {
+	for _, p := range whoisProvinces {
+		if strings.Contains(normalized, " "+p.pinyin+" ") {
+			return p.name
+		}
+	}
+	return ""
+}
+
+// parseWhois 从注册信息推断运营商和地区：国内三家运营商映射为 电信/联通/移动，其余使用注册的组织名；
+// 地区优先取描述中的省份（国内运营商各省网段的地址常为总部地址），其次为地址中的省份，最后为国家代码
+func parseWhois(resp string) *whoisInfo {
+	fields := whoisFields(resp)
+	var all []string
+	for _, key := range []string{"netname", "descr", "org-name", "orgname", "owner", "mnt-by"} {
+		all = append(all, fields[key]...)
+	}
+	normalized := normalizeWhois(all)
+
+	info := &whoisInfo{Isp: matchChinaIsp(normalized)}
+	if info.Isp == "" {
+		for _, key := range []string{"org-name", "orgname", "owner", "descr", "netname"} {
+			if v := fields[key]; len(v) > 0 {
+				info.Isp = v[0]
+				break
+			}
+		}
+	}
+
+	for _, key := range []string{"descr", "address", "city", "stateprov"} {
+		if info.Region = matchProvince(normalizeWhois(fields[key])); info.Region != "" {
+			break
+		}
+	}
+	if info.Region == "" {
+		if v := fields["country"]; len(v) > 0 {
+			info.Region = strings.ToUpper(v[0])
+		}
+	}
+	return info
+}
@@ -0,0 +1,225 @@
+package internal_test
+
+import (
+	"dping/internal"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// 以下应答按各服务器的真实格式裁剪，只保留解析用到的字段和干扰项
+
+const ianaApnic = `% IANA WHOIS server
+% for more information on IANA, visit http://www.iana.org
+% This query returned 1 object
+
+refer:        whois.apnic.net
+
+inetnum:      113.0.0.0 - 113.255.255.255
+organisation: APNIC
+status:       ALLOCATED
+`
+
+const ianaArin = `% IANA WHOIS server
+
+refer:        whois.arin.net
+
+inetnum:      8.0.0.0 - 8.255.255.255
+organisation: Administered by ARIN
+status:       LEGACY
+`
+
+// ianaReserved IANA 自己保留的地址没有 refer，直接由应答推断
+const ianaReserved = `% IANA WHOIS server
+
+inetnum:      192.0.2.0 - 192.0.2.255
+organisation: IANA - Special-Purpose Address Registry
+status:       RESERVED
+`
+
+// apnicChinanetGd 电信广东的网段：描述中有省份，地址是北京总部
+const apnicChinanetGd = `% [whois.apnic.net]
+% Whois data copyright terms    http://www.apnic.net/db/dbcopyright.html
+
+inetnum:        113.64.0.0 - 113.111.255.255
+netname:        CHINANET-GD
+descr:          CHINANET Guangdong province network
+descr:          Data Communication Division
+descr:          China Telecom
+country:        CN
+admin-c:        IC83-AP
+mnt-by:         APNIC-HM
+address:        No.31,jingrong street,beijing
+source:         APNIC
+`
+
+// apnicCmnet 移动的网段：描述中没有省份，地区取自地址
+const apnicCmnet = `inetnum:        120.192.0.0 - 120.223.255.255
+netname:        CMNET
+descr:          China Mobile Communications Corporation
+descr:          Mobile Communications Network Operator in China
+country:        CN
+address:        29, Jinrong Ave., Xicheng district
+address:        Beijing
+mnt-by:         MAINT-CN-CMCC
+`
+
+// arinGoogle 国外组织：运营商为注册的组织名，地区为国家代码
+const arinGoogle = `#
+# ARIN WHOIS data and services are subject to the Terms of Use
+#
+
+NetRange:       8.8.8.0 - 8.8.8.255
+CIDR:           8.8.8.0/24
+NetName:        GOGL
+Organization:   Google LLC (GOGL)
+Ref:            https://rdap.arin.net/registry/ip/8.8.8.0
+
+OrgName:        Google LLC
+City:           Mountain View
+StateProv:      CA
+Country:        US
+`
+
+func TestWhoisFields(t *testing.T) {
+	fields := internal.WhoisFields(arinGoogle + "descr:\r\nNo colon here\r\nNetName:  SECOND\r\n")
+	for key, want := range map[string][]string{
+		"netname": {"GOGL", "SECOND"}, // 键转为小写，同名字段按出现顺序保留，行尾的 \r 被去掉
+		"ref":     {"https://rdap.arin.net/registry/ip/8.8.8.0"},
+		"orgname": {"Google LLC"},
+		"country": {"US"},
+		"descr":   nil, // 空值不保留
+	} {
+		if got := fields[key]; !slices.Equal(got, want) {
+			t.Errorf("%s 应为 %q，实际为 %q", key, want, got)
+		}
+	}
+	if refer := internal.WhoisFields(ianaApnic)["refer"]; !slices.Equal(refer, []string{"whois.apnic.net"}) {
+		t.Errorf("IANA 应答的 refer 应为 whois.apnic.net，实际为 %q", refer)
+	}
+}
+
+func TestMatchChinaIsp(t *testing.T) {
+	for _, c := range []struct{ text, want string }{
+		{"CHINANET-GD", "电信"},
+		{"China Telecom Beijing", "电信"},
+		{"CHINA169-BJ", "联通"},
+		{"CNCGROUP Shandong", "联通"},
+		{"CHINAUNICOM", "联通"}, // 联通的名称常与其他词连写，按子串匹配
+		{"CMNET", "移动"},
+		{"China Mobile Communications Corporation", "移动"},
+		{"ChinaNetCenter Ltd", ""}, // 其他按整词匹配，不把网宿科技当作电信
+		{"CMNET2", ""},             // 数字也是词的一部分
+		{"Google LLC", ""},
+		{"", ""},
+	} {
+		if got := internal.MatchChinaIsp(internal.NormalizeWhois([]string{c.text})); got != c.want {
+			t.Errorf("%q 的运营商应为 %q，实际为 %q", c.text, c.want, got)
+		}
+	}
+}
+
+func TestMatchProvince(t *testing.T) {
+	for _, c := range []struct{ text, want string }{
+		{"CHINANET Guangdong province network", "广东"},
+		{"Beijing", "北京"},
+		{"Shaanxi", "陕西"},
+		{"Shanxi", "山西"},
+		{"Inner Mongolia", "内蒙古"},
+		{"hong-kong", "香港"},
+		{"Tibet", "西藏"},
+		{"Guangdongx", ""}, // 按整词匹配
+		{"Mountain View", ""},
+		{"", ""},
+	} {
+		if got := internal.MatchProvince(internal.NormalizeWhois([]string{c.text})); got != c.want {
+			t.Errorf("%q 的省份应为 %q，实际为 %q", c.text, c.want, got)
+		}
+	}
+}
+
+func TestParseWhois(t *testing.T) {
+	for _, c := range []struct {
+		name, resp, region, isp string
+	}{
+		{"电信各省网段取描述中的省份而非总部地址", apnicChinanetGd, "广东", "电信"},
+		{"描述中没有省份时取地址", apnicCmnet, "北京", "移动"},
+		{"国外组织", arinGoogle, "US", "Google LLC"},
+		{"IANA 保留地址没有可用的字段", ianaReserved, "", ""},
+		{"空应答", "", "", ""},
+	} {
+		region, isp := internal.ParseWhois(c.resp)
+		if region != c.region || isp != c.isp {
+			t.Errorf("%s: 应为 %q/%q，实际为 %q/%q", c.name, c.region, c.isp, region, isp)
+		}
+	}
+}
+
+func TestLookupWhois(t *testing.T) {
+	responses := map[string]string{
+		"whois.iana.org 113.96.1.1":  ianaApnic,
+		"whois.apnic.net 113.96.1.1": apnicChinanetGd,
+		"whois.iana.org 8.8.8.8":     ianaArin,
+		"whois.arin.net n + 8.8.8.8": arinGoogle,
+		"whois.iana.org 192.0.2.1":   ianaReserved,
+		"whois.iana.org 113.96.2.2":  ianaApnic,
+	}
+	for _, c := range []struct {
+		ip, region, isp string
+		queries         []string
+	}{
+		// 按 IANA 的 refer 转到 APNIC
+		{"113.96.1.1", "广东", "电信", []string{"whois.iana.org 113.96.1.1", "whois.apnic.net 113.96.1.1"}},
+		// ARIN 以 "n + IP" 查询网段
+		{"8.8.8.8", "US", "Google LLC", []string{"whois.iana.org 8.8.8.8", "whois.arin.net n + 8.8.8.8"}},
+		// 没有 refer 时使用 IANA 的应答
+		{"192.0.2.1", "", "", []string{"whois.iana.org 192.0.2.1"}},
+	} {
+		var queries []string
+		region, isp, err := internal.LookupWhois(func(server, query string) (string, error) {
+			queries = append(queries, server+" "+query)
+			return responses[server+" "+query], nil
+		}, c.ip)
+		if err != nil {
+			t.Errorf("%s: %v", c.ip, err)
+			continue
+		}
+		if region != c.region || isp != c.isp {
+			t.Errorf("%s: 应为 %q/%q，实际为 %q/%q", c.ip, c.region, c.isp, region, isp)
+		}
+		if !slices.Equal(queries, c.queries) {
+			t.Errorf("%s: 查询应为 %q，实际为 %q", c.ip, c.queries, queries)
+		}
+	}
+
+	// 转到的 RIR 查询失败时返回错误
+	errRefused := errors.New("connection refused")
+	_, _, err := internal.LookupWhois(func(server, query string) (string, error) {
+		if server != "whois.iana.org" {
+			return "", errRefused
+		}
+		return responses[server+" "+query], nil
+	}, "113.96.2.2")
+	if !errors.Is(err, errRefused) {
+		t.Errorf("RIR 查询失败时应返回其错误，实际为 %v", err)
+	}
+}
+
+func TestWhoisCacheTTL(t *testing.T) {
+	now := time.Now()
+	for _, c := range []struct {
+		age  time.Duration
+		want bool
+	}{
+		{0, true},
+		{29 * 24 * time.Hour, true},
+		{30*24*time.Hour - time.Minute, true},
+		{30*24*time.Hour + time.Minute, false},
+		{365 * 24 * time.Hour, false},
+	} {
+		if got := internal.WhoisCached(now.Add(-c.age)); got != c.want {
+			t.Errorf("%v 前查询的缓存是否有效应为 %v，实际为 %v", c.age, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+)
+
+func TestCheckArgs(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		args []string
+		want int
+		err  string // 为空时应没有多余的参数
+	}{
+		{"没有多余的参数", []string{"-des", "-S", "avgrtt"}, 0, ""},
+		{"布尔参数用等号赋值", []string{"-des=false", "-S", "avgrtt"}, 0, ""},
+		{"子命令需要的位置参数", []string{"-des", "a.json", "b.json"}, 2, ""},
+		{"布尔参数后跟 false", []string{"-des", "false", "-S", "avgrtt"}, 0,
+			"多余的参数 'false'：布尔参数需要用等号赋值，如 -des=false，否则其后的参数都会被忽略"},
+		{"布尔参数后跟 true", []string{"-des", "true"}, 0,
+			"多余的参数 'true'：布尔参数需要用等号赋值，如 -des=true，否则其后的参数都会被忽略"},
+		{"多余的参数", []string{"-des", "北京", "上海"}, 0, "多余的参数 '北京 上海'"},
+		{"位置参数之后多余的参数", []string{"a.json", "b.json", "c.json"}, 2, "多余的参数 'c.json'"},
+	} {
+		fs := flag.NewFlagSet("dping", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		fs.Bool("des", false, "")
+		fs.String("S", "loss", "")
+		if err := fs.Parse(c.args); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		err := checkArgs(fs, c.want)
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("%s: 不应报错，实际为 %v", c.name, err)
+		case c.err != "" && (err == nil || err.Error() != c.err):
+			t.Errorf("%s: 应为 %q，实际为 %v", c.name, c.err, err)
+		}
+	}
+}